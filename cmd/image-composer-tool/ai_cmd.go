@@ -4,12 +4,14 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/ai"
 	"github.com/open-edge-platform/image-composer-tool/internal/ai/rag"
+	"github.com/open-edge-platform/image-composer-tool/internal/ai/template"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
 	"github.com/spf13/cobra"
 )
@@ -17,10 +19,12 @@ import (
 var (
 	aiProvider     string
 	aiTemplatesDir string
+	aiCacheDir     string
 	aiClearCache   bool
 	aiCacheStats   bool
 	aiSearchOnly   bool
 	aiOutput       string
+	aiListUseCases bool
 )
 
 func createAICommand() *cobra.Command {
@@ -51,6 +55,9 @@ Examples:
   # Show cache statistics
   image-composer-tool ai --cache-stats
 
+  # List the use cases of the templates with their packages
+  image-composer-tool ai --list-use-cases
+
 Configuration:
   The AI feature uses sensible defaults. If Ollama is running locally, no configuration
   is needed. For OpenAI, set the OPENAI_API_KEY environment variable.
@@ -59,6 +66,8 @@ Configuration:
     ai:
       provider: ollama  # or "openai"
       templates_dir: ./image-templates
+      cache:
+        dir: ./.ai-cache
 `,
 		Args: cobra.MaximumNArgs(1),
 		RunE: runAICommand,
@@ -66,9 +75,11 @@ Configuration:
 
 	cmd.Flags().StringVar(&aiProvider, "provider", "", "AI provider: ollama or openai (default: ollama)")
 	cmd.Flags().StringVar(&aiTemplatesDir, "templates-dir", "", "Directory containing template files")
+	cmd.Flags().StringVar(&aiCacheDir, "cache-dir", "", "Directory of the embedding cache (default: ./.ai-cache)")
 	cmd.Flags().BoolVar(&aiClearCache, "clear-cache", false, "Clear the embedding cache")
 	cmd.Flags().BoolVar(&aiCacheStats, "cache-stats", false, "Show cache statistics")
 	cmd.Flags().BoolVar(&aiSearchOnly, "search-only", false, "Only search for templates, don't generate")
+	cmd.Flags().BoolVar(&aiListUseCases, "list-use-cases", false, "List the use cases of the templates with their packages, kernel and disk settings")
 	cmd.Flags().StringVar(&aiOutput, "output", "", "Save generated template to file (name saves to image-templates/<name>.yml, path saves to exact location)")
 
 	return cmd
@@ -87,6 +98,9 @@ func runAICommand(cmd *cobra.Command, args []string) error {
 	if aiTemplatesDir != "" {
 		config.TemplatesDir = aiTemplatesDir
 	}
+	if aiCacheDir != "" {
+		config.Cache.Dir = aiCacheDir
+	}
 
 	// Handle cache-stats command
 	if aiCacheStats {
@@ -98,6 +112,11 @@ func runAICommand(cmd *cobra.Command, args []string) error {
 		return clearCache(config)
 	}
 
+	// Handle list-use-cases command
+	if aiListUseCases {
+		return listUseCases(cmd.OutOrStdout(), config)
+	}
+
 	// Require a query for search/generate
 	if len(args) == 0 {
 		return fmt.Errorf("query is required for template search/generation")
@@ -128,6 +147,21 @@ func runAICommand(cmd *cobra.Command, args []string) error {
 	return runGenerate(engine, query, config.TemplatesDir)
 }
 
+// listUseCases writes the use cases of the templates in the templates
+// directory of config to w.
+func listUseCases(w io.Writer, config ai.Config) error {
+	templates, err := template.ScanTemplates(config.TemplatesDir)
+	if err != nil {
+		return fmt.Errorf("failed to scan templates: %w", err)
+	}
+	useCases := template.ListUseCases(templates)
+	if len(useCases) == 0 {
+		fmt.Fprintf(w, "No use cases found in the templates of %s\n", config.TemplatesDir)
+		return nil
+	}
+	return template.WriteUseCases(w, useCases)
+}
+
 func runSearch(engine *rag.Engine, query string) error {
 	log := logger.Logger()
 	ctx := context.Background()
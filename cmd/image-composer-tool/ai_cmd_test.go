@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -192,3 +194,48 @@ func TestMinFunc(t *testing.T) {
 		}
 	}
 }
+
+func TestListUseCases(t *testing.T) {
+	tmpDir := t.TempDir()
+	templateContent := `
+metadata:
+  use_cases:
+    - "edge computing"
+image:
+  name: edge
+target:
+  os: wind-river-elxr
+  dist: elxr12
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  packages:
+    - openssh-server
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "edge.yml"), []byte(templateContent), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	origTemplatesDir, origListUseCases := aiTemplatesDir, aiListUseCases
+	defer func() {
+		aiTemplatesDir, aiListUseCases = origTemplatesDir, origListUseCases
+	}()
+
+	cmd := createAICommand()
+	if err := cmd.Flags().Set("list-use-cases", "true"); err != nil {
+		t.Fatalf("failed to set --list-use-cases: %v", err)
+	}
+	if err := cmd.Flags().Set("templates-dir", tmpDir); err != nil {
+		t.Fatalf("failed to set --templates-dir: %v", err)
+	}
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+
+	if err := runAICommand(cmd, nil); err != nil {
+		t.Fatalf("expected use cases to be listed without a query, got: %v", err)
+	}
+	want := "edge computing (templates: 1, packages: 1)\n  edge.yml: wind-river-elxr elxr12 x86_64 raw\n    packages: openssh-server\n"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("expected output to contain %q, got:\n%s", want, out.String())
+	}
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imagesums"
 	"github.com/open-edge-platform/image-composer-tool/internal/image/isomaker"
 	"github.com/open-edge-platform/image-composer-tool/internal/provider"
 	"github.com/open-edge-platform/image-composer-tool/internal/provider/azl"
@@ -17,26 +21,74 @@ import (
 	"github.com/open-edge-platform/image-composer-tool/internal/provider/ubuntu"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/display"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
 	"github.com/spf13/cobra"
 )
 
 // Build command flags
 var (
-	workers            int    = -1 // -1 means use config file value
-	cacheDir           string = "" // Empty means use config file value
-	workDir            string = "" // Empty means use config file value
-	dotFile            string = "" // Generate a dot file for the dependency graph
-	systemPackagesOnly bool   = false
+	workers            int      = -1 // -1 means use config file value
+	cacheDir           string   = "" // Empty means use config file value
+	workDir            string   = "" // Empty means use config file value
+	tempDir            string   = "" // Empty means use config file value
+	dotFile            string   = "" // Generate a dot file for the dependency graph
+	systemPackagesOnly bool     = false
+	templateOverrides  []string          // Template field overrides in key=value form
+	buildOutput        string   = "text" // Build result format: text or json
+	failOnWarning      bool     = false  // Fail the build if any warning was logged
+	signChecksums      string   = ""     // GPG key to sign the checksum manifests with, empty means unsigned
+	continueOnInstall  bool     = false  // Keep installing image packages after a failure
+	forceUKI           bool     = false  // Rebuild the initramfs and UKI even when their inputs are unchanged
+	incremental        bool     = false  // Keep the rootfs and apply only the package delta to it on the next build
+	explain            bool     = false  // Explain why the dependency resolver included or failed on packages
+	resume             bool     = false  // Resume a failed build from its first incomplete stage
+	showConfig         string   = ""     // Print the effective template in this format instead of building
+	streamDownloads    bool     = false  // Download packages while dependency resolution is still running
+	skipGPGPreflight   bool     = false  // Do not check the repository GPG keys before the build starts
+	verifySecureBoot   bool     = false  // Inspect the built image and fail if its Secure Boot chain is incomplete
 )
 
+// Template source flags, shared by the build and validate commands. When
+// templateRepo is set, TEMPLATE_FILE is a path in that git repository.
+var (
+	templateRepo string // URL or path of the git repository to read the template from
+	templateRef  string // branch, tag or commit of templateRepo, empty for its default branch
+)
+
+// buildCheckpointFile is the file in the image build directory recording the
+// completed stages of a build until it succeeds
+const buildCheckpointFile = "build-checkpoint.json"
+
+// Limits of the commands run in the build chroot, applied to shell.CmdTimeout
+// and shell.CmdRetries
+var (
+	cmdTimeout time.Duration // 0 means no timeout
+	cmdRetries int
+)
+
+// buildDeadline bounds the whole build, applied to shell.BuildDeadline when
+// the build starts. 0 means no deadline.
+var buildDeadline time.Duration
+
+// checksumAlgorithm selects the checksums of the build artifacts listed in
+// the build result and written to the checksum manifests: sha256, sha512 or
+// both.
+var checksumAlgorithm = imagesums.SHA256
+
+// initProvider is the provider factory used by runBuild; tests replace it
+// with a stub.
+var initProvider = InitProvider
+
 // createBuildCommand creates the build subcommand
 func createBuildCommand() *cobra.Command {
 	buildCmd := &cobra.Command{
 		Use:   "build [flags] TEMPLATE_FILE",
 		Short: "Build a Linux distribution image",
 		Long: `Build a Linux distribution image based on the specified image template file.
-The template file must be in YAML format following the image template schema.`,
+The template file must be in YAML format following the image template schema.
+With --template-repo, TEMPLATE_FILE is the path of the template in that git
+repository, read from --template-ref with the files it references.`,
 		Args:              cobra.ExactArgs(1),
 		RunE:              executeBuild,
 		ValidArgsFunction: templateFileCompletion,
@@ -48,10 +100,49 @@ The template file must be in YAML format following the image template schema.`,
 	buildCmd.Flags().StringVarP(&cacheDir, "cache-dir", "d", "",
 		"Package cache directory")
 	buildCmd.Flags().StringVar(&workDir, "work-dir", "",
-		"Working directory for builds")
+		"Working directory for builds; use a separate one for each build run side by side")
+	buildCmd.Flags().StringVar(&tempDir, "temp-dir", "",
+		"Directory for temporary files generated during the build, such as apt sources and GPG keys (overrides config)")
+	buildCmd.Flags().BoolVar(&streamDownloads, "stream-downloads", false,
+		"Download packages while dependency resolution is still running instead of after it (overrides config)")
 	buildCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	buildCmd.Flags().StringVarP(&dotFile, "dotfile", "f", "", "Generate a dot file for the dependency graph")
 	buildCmd.Flags().BoolVar(&systemPackagesOnly, "system-packages-only", false, "When generating a dot graph, only include roots from SystemConfig.Packages")
+	buildCmd.Flags().StringVar(&buildOutput, "output", "text",
+		"Build result format: text, or json to print a BuildResult to stdout with logs on stderr")
+	buildCmd.Flags().BoolVar(&failOnWarning, "fail-on-warning", false,
+		"Exit with an error if the build logged any warning")
+	buildCmd.Flags().BoolVar(&continueOnInstall, "continue-on-install-error", false,
+		"Keep installing the remaining image packages after one fails and report every failure; the build still fails")
+	buildCmd.Flags().BoolVar(&forceUKI, "force-uki", false,
+		"Regenerate the initramfs and rebuild the UKI even when their inputs are unchanged")
+	buildCmd.Flags().BoolVar(&incremental, "incremental", false,
+		"Keep the rootfs of img, tar, oci and pxe images and, on the next build, install only added packages and remove deleted ones")
+	buildCmd.Flags().BoolVar(&resume, "resume", false,
+		"Resume a failed build of the same template from its first incomplete stage, reusing its work directory")
+	buildCmd.Flags().BoolVar(&explain, "explain", false,
+		"Show the dependency path behind resolve failures and why each package was included (Debian-based targets)")
+	buildCmd.Flags().DurationVar(&cmdTimeout, "cmd-timeout", 0,
+		"Kill commands run in the build chroot that take longer than this, e.g. 30m (0 means no timeout)")
+	buildCmd.Flags().IntVar(&cmdRetries, "cmd-retries", 0,
+		"Retry failed or timed-out idempotent chroot commands, such as package installs, this many times")
+	buildCmd.Flags().DurationVar(&buildDeadline, "deadline", 0,
+		"Abort the build, cleaning up its mounts and devices, when it takes longer than this in total, e.g. 2h (0 means no deadline)")
+	buildCmd.Flags().BoolVar(&skipGPGPreflight, "skip-gpg-preflight", false,
+		"Do not fetch and check the GPG keys of the template package repositories before the build starts")
+	buildCmd.Flags().BoolVar(&verifySecureBoot, "verify-secure-boot", false,
+		"When the template requests Secure Boot signing, inspect the built image and fail if its shim, boot loader or UKI is unsigned or its boot chain is incomplete")
+	buildCmd.Flags().StringVar(&signChecksums, "sign-checksums", "",
+		"GPG key ID or email to sign the checksum manifests of the build artifacts with")
+	buildCmd.Flags().StringVar(&checksumAlgorithm, "checksum-algorithm", imagesums.SHA256,
+		"Checksum algorithm of the build artifacts and their checksum manifests: sha256, sha512 or both")
+	buildCmd.Flags().StringVar(&showConfig, "show-config", "",
+		"Print the effective template, after merging defaults and applying --set overrides, as yaml or json and exit without building")
+	buildCmd.Flags().Lookup("show-config").NoOptDefVal = "yaml"
+	addTemplateSourceFlags(buildCmd)
+	buildCmd.Flags().StringArrayVar(&templateOverrides, "set", nil,
+		fmt.Sprintf("Override a template field as key=value, can be repeated (keys: %s)",
+			strings.Join(config.TemplateOverrideKeys, ", ")))
 
 	return buildCmd
 }
@@ -70,55 +161,224 @@ func executeBuild(cmd *cobra.Command, args []string) error {
 		currentConfig.CacheDir = cacheDir
 		config.SetGlobal(currentConfig)
 	}
+	if cmd.Flags().Changed("temp-dir") {
+		currentConfig := config.Global()
+		currentConfig.TempDir = tempDir
+		config.SetGlobal(currentConfig)
+	}
+	if cmd.Flags().Changed("stream-downloads") {
+		currentConfig := config.Global()
+		currentConfig.StreamDownloads = streamDownloads
+		config.SetGlobal(currentConfig)
+	}
 	if cmd.Flags().Changed("work-dir") {
+		resolvedWorkDir, err := config.PrepareWorkDir(workDir)
+		if err != nil {
+			return fmt.Errorf("invalid --work-dir: %w", err)
+		}
 		currentConfig := config.Global()
-		currentConfig.WorkDir = workDir
+		currentConfig.WorkDir = resolvedWorkDir
 		config.SetGlobal(currentConfig)
 	}
 
-	var buildErr error
-	log := logger.Logger()
+	if cmdTimeout < 0 || cmdRetries < 0 {
+		return fmt.Errorf("--cmd-timeout and --cmd-retries must not be negative")
+	}
+	if buildDeadline < 0 {
+		return fmt.Errorf("--deadline must not be negative")
+	}
+	if _, err := imagesums.ParseAlgorithms(checksumAlgorithm); err != nil {
+		return fmt.Errorf("invalid --checksum-algorithm: %w", err)
+	}
+	shell.CmdTimeout = cmdTimeout
+	shell.CmdRetries = cmdRetries
 
 	// Check if template file is provided as first positional argument
 	if len(args) < 1 {
 		return fmt.Errorf("no template file provided, usage: image-composer-tool build [flags] TEMPLATE_FILE")
 	}
-	templateFile := args[0]
+	templateFile, cleanup, err := resolveTemplateFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if showConfig != "" {
+		return showEffectiveConfig(cmd.OutOrStdout(), templateFile)
+	}
+
+	switch buildOutput {
+	case "text":
+		logger.StartWarningCapture()
+		_, err := runBuild(templateFile)
+		warnings := logger.StopWarningCapture()
+		if err != nil {
+			return err
+		}
+		return warningsError(warnings)
+	case "json":
+		// Keep anything printed directly to stdout during the build off the
+		// JSON stream; logs already go to stderr
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		logger.StartWarningCapture()
+		result, buildErr := runBuild(templateFile)
+		result.Warnings = logger.StopWarningCapture()
+		os.Stdout = stdout
+		if buildErr == nil {
+			if buildErr = warningsError(result.Warnings); buildErr != nil {
+				result.Success = false
+				result.Error = buildErr.Error()
+			}
+		}
+
+		if err := writeBuildResult(cmd.OutOrStdout(), result); err != nil {
+			return fmt.Errorf("writing build result: %w", err)
+		}
+		return buildErr
+	default:
+		return fmt.Errorf("invalid --output %q (expected text|json)", buildOutput)
+	}
+}
+
+// addTemplateSourceFlags adds the flags selecting a git repository to read
+// the template from to cmd.
+func addTemplateSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&templateRepo, "template-repo", "",
+		"Git repository URL or path to read TEMPLATE_FILE from, as a path in the repository")
+	cmd.Flags().StringVar(&templateRef, "template-ref", "",
+		"Branch, tag or commit of --template-repo to read the template from (default: its default branch)")
+}
+
+// resolveTemplateFile returns the path of the template file named by the
+// TEMPLATE_FILE argument, and a function to call once the template and the
+// files it references are no longer needed. With --template-repo, the
+// template is fetched from the git repository into a temporary checkout that
+// the function removes.
+func resolveTemplateFile(templateFile string) (string, func(), error) {
+	if templateRepo == "" {
+		if templateRef != "" {
+			return "", nil, fmt.Errorf("--template-ref requires --template-repo")
+		}
+		return templateFile, func() {}, nil
+	}
+	path, cleanup, err := config.FetchGitTemplate(config.GitTemplateSource{
+		Repo: templateRepo,
+		Ref:  templateRef,
+		Path: templateFile,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("fetching template from git repository: %w", err)
+	}
+	return path, cleanup, nil
+}
+
+// showEffectiveConfig prints the template that templateFile resolves to once
+// the defaults are merged in and the --set overrides applied, in the
+// --show-config format.
+func showEffectiveConfig(w io.Writer, templateFile string) error {
+	template, err := config.LoadAndMergeTemplateWithOverrides(templateFile, templateOverrides)
+	if err != nil {
+		return fmt.Errorf("loading and merging template: %v", err)
+	}
+	data, err := template.EffectiveConfig(showConfig)
+	if err != nil {
+		return fmt.Errorf("invalid --show-config: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("writing effective config: %w", err)
+	}
+	return nil
+}
+
+// warningsError returns the error that fails a build run with
+// --fail-on-warning once warnings were logged, or nil.
+func warningsError(warnings []string) error {
+	if !failOnWarning || len(warnings) == 0 {
+		return nil
+	}
+	return fmt.Errorf("build logged %d warning(s) and --fail-on-warning is set, first: %s",
+		len(warnings), warnings[0])
+}
+
+// runBuild builds the image described by templateFile and returns a summary of
+// the build. The result is filled in as far as the build got, so it is also
+// meaningful when an error is returned.
+func runBuild(templateFile string) (*BuildResult, error) {
+	var buildErr error
+	log := logger.Logger()
 
 	// get start time
 	startTime := time.Now()
+	result := newBuildResult(templateFile, startTime)
+	if buildDeadline > 0 {
+		shell.BuildDeadline = startTime.Add(buildDeadline)
+		defer func() { shell.BuildDeadline = time.Time{} }()
+	}
 
 	// Load user template and merge with default configuration
-	template, err := config.LoadAndMergeTemplate(templateFile)
+	template, err := config.LoadAndMergeTemplateWithOverrides(templateFile, templateOverrides)
 	if err != nil {
-		return fmt.Errorf("loading and merging template: %v", err)
+		buildErr = fmt.Errorf("loading and merging template: %v", err)
+		result.finish(nil, buildErr)
+		return result, buildErr
 	}
 	template.DotSystemOnly = systemPackagesOnly
+	template.ContinueOnPkgError = continueOnInstall
+	template.ForceUKI = forceUKI
+	template.Incremental = incremental
+	template.ExplainResolve = explain
+	// Generated files are only needed until the image is built
+	defer template.RemoveTempFiles()
+
+	if err := setupBuildCheckpoint(template); err != nil {
+		buildErr = err
+		result.finish(template, buildErr)
+		return result, buildErr
+	}
 
 	// assign start time to storage
 	template.StartBuildTimeline(startTime)
 
+	var p provider.Provider
+
 	if dotFile != "" {
 		dotFilePath, err := filepath.Abs(dotFile)
 		if err != nil {
-			return fmt.Errorf("resolving dotfile path: %w", err)
+			buildErr = fmt.Errorf("resolving dotfile path: %w", err)
+			result.finish(template, buildErr)
+			return result, buildErr
 		}
 		if err := os.MkdirAll(filepath.Dir(dotFilePath), 0755); err != nil {
-			return fmt.Errorf("preparing dotfile directory: %w", err)
+			buildErr = fmt.Errorf("preparing dotfile directory: %w", err)
+			result.finish(template, buildErr)
+			return result, buildErr
 		}
 		template.DotFilePath = dotFilePath
 		log.Infof("Dependency graph will be written to %s", dotFilePath)
 	}
 
+	// Fail on unreachable or invalid repository keys before anything is
+	// downloaded rather than during package installation
+	if !skipGPGPreflight {
+		if err := template.CheckRepositoryKeys(); err != nil {
+			buildErr = fmt.Errorf("repository GPG key check failed: %w", err)
+			result.finish(template, buildErr)
+			return result, buildErr
+		}
+	}
+
 	// For ISO builds, validate prerequisites (e.g., live-installer binary)
 	// before starting expensive provider init and package downloads
 	if template.Target.ImageType == "iso" {
 		if err := isomaker.ValidateISOPrerequisites(template); err != nil {
-			return fmt.Errorf("ISO prerequisites check failed: %w", err)
+			buildErr = fmt.Errorf("ISO prerequisites check failed: %w", err)
+			result.finish(template, buildErr)
+			return result, buildErr
 		}
 	}
 
-	p, err := InitProvider(template.Target.OS, template.Target.Dist, template.Target.Arch)
+	p, err = initProvider(template.Target.OS, template.Target.Dist, template.Target.Arch)
 	if err != nil {
 		buildErr = fmt.Errorf("initializing provider failed: %v", err)
 		goto post
@@ -129,6 +389,12 @@ func executeBuild(cmd *cobra.Command, args []string) error {
 		goto post
 	}
 
+	// Host dependencies are installed by now
+	if err := recordHostToolVersions(template); err != nil {
+		buildErr = err
+		goto post
+	}
+
 	template.StartPureImageBuildTimer()
 	if err := p.BuildImage(template); err != nil {
 		buildErr = fmt.Errorf("image build failed: %v", err)
@@ -137,9 +403,35 @@ func executeBuild(cmd *cobra.Command, args []string) error {
 
 post:
 
+	if buildErr != nil && shell.CheckBuildDeadline() != nil {
+		buildErr = deadlineError(template, buildErr)
+	}
+
 	if p != nil {
-		if err := p.PostProcess(template, buildErr); err != nil {
-			return fmt.Errorf("post-processing failed: %v", err)
+		// Post-processing releases what the build set up, which must
+		// happen even once the build deadline passed
+		endCleanup := shell.BeginCleanup()
+		err := p.PostProcess(template, buildErr)
+		endCleanup()
+		if err != nil {
+			buildErr = fmt.Errorf("post-processing failed: %v", err)
+			result.finish(template, buildErr)
+			return result, buildErr
+		}
+	}
+
+	if buildErr == nil && verifySecureBoot {
+		if err := verifySecureBootChain(template); err != nil {
+			buildErr = fmt.Errorf("secure boot verification failed: %w", err)
+		}
+	}
+
+	if buildErr == nil {
+		if err := template.Checkpoint.Remove(); err != nil {
+			log.Warnf("%v", err)
+		}
+		if err := writeChecksums(template); err != nil {
+			buildErr = fmt.Errorf("writing artifact checksums failed: %w", err)
 		}
 	}
 
@@ -153,7 +445,135 @@ post:
 		log.Errorf("image build failed (error type: %T)", buildErr)
 	}
 
-	return buildErr
+	result.finish(template, buildErr)
+	return result, buildErr
+}
+
+// recordHostToolVersions records the versions of the host tools used for
+// the build on template, for its SBOM, and checks them against the
+// min_tool_versions of the global configuration.
+func recordHostToolVersions(template *config.ImageTemplate) error {
+	versions, err := system.GetHostToolVersions()
+	if err != nil {
+		return fmt.Errorf("failed to get host tool versions: %w", err)
+	}
+	template.HostToolVersions = versions
+	if err := system.CheckHostToolVersions(versions, config.MinToolVersions()); err != nil {
+		return fmt.Errorf("host tool version check failed: %w", err)
+	}
+	return nil
+}
+
+// setupBuildCheckpoint sets the checkpoint recording the completed stages of
+// the build of template. With --resume it is the checkpoint left by the
+// failed build to resume, which must have been recorded for the same
+// template; otherwise it starts empty.
+func setupBuildCheckpoint(template *config.ImageTemplate) error {
+	buildDir, err := imageBuildDir(template)
+	if err != nil {
+		return err
+	}
+	checkpointPath := filepath.Join(buildDir, buildCheckpointFile)
+	if !resume {
+		template.Checkpoint, err = config.NewBuildCheckpoint(checkpointPath, template)
+		return err
+	}
+
+	checkpoint, err := config.ResumeBuildCheckpoint(checkpointPath, template)
+	if err != nil {
+		return fmt.Errorf("cannot resume build: %w", err)
+	}
+	if stage := checkpoint.ResumeStage(); stage != "" {
+		logger.Logger().Infof("Resuming build from the %s stage", stage)
+	} else {
+		logger.Logger().Infof("Resuming build after its last checkpointed stage")
+	}
+	template.Checkpoint = checkpoint
+	return nil
+}
+
+// deadlineError returns the error of a build of template that ran past
+// --deadline, naming the stage that was running: the first stage the build
+// checkpoint does not record as completed.
+func deadlineError(template *config.ImageTemplate, err error) error {
+	stage := "post-processing"
+	if s := template.Checkpoint.ResumeStage(); s != "" {
+		stage = s
+	}
+	return fmt.Errorf("%w: the build ran longer than %s and was aborted during the %s stage: %v",
+		shell.ErrBuildDeadline, buildDeadline, stage, err)
+}
+
+// secureBootImageExts are the extensions of the disk images in the image
+// build directory that --verify-secure-boot inspects
+var secureBootImageExts = []string{".raw", ".img", ".qcow2", ".vhd", ".vhdx", ".vmdk", ".vdi"}
+
+// verifySecureBootChain inspects the disk images built for template and
+// checks that their boot chain is signed for Secure Boot. Templates that do
+// not request Secure Boot signing are not checked.
+func verifySecureBootChain(template *config.ImageTemplate) error {
+	log := logger.Logger()
+	if !template.IsSecureBootRequested() {
+		log.Infof("Secure Boot signing not requested by the template, not verifying the boot chain")
+		return nil
+	}
+
+	buildDir, err := imageBuildDir(template)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(buildDir)
+	if err != nil {
+		return fmt.Errorf("failed to read build directory: %w", err)
+	}
+	var images []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && slices.Contains(secureBootImageExts, strings.ToLower(filepath.Ext(entry.Name()))) {
+			images = append(images, filepath.Join(buildDir, entry.Name()))
+		}
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("no disk image to inspect in %s", buildDir)
+	}
+
+	for _, image := range images {
+		summary, err := newInspector(false).Inspect(image)
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s: %w", filepath.Base(image), err)
+		}
+		if err := summary.CheckSecureBootChain(); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(image), err)
+		}
+		log.Infof("Secure Boot chain of %s verified", filepath.Base(image))
+	}
+	return nil
+}
+
+// writeChecksums writes the checksum manifests selected by
+// --checksum-algorithm of the artifacts in the image build directory of
+// template, and signs them when --sign-checksums is set.
+func writeChecksums(template *config.ImageTemplate) error {
+	buildDir, err := imageBuildDir(template)
+	if err != nil {
+		return err
+	}
+	algorithms, err := imagesums.ParseAlgorithms(checksumAlgorithm)
+	if err != nil {
+		return err
+	}
+	sumsPaths, err := imagesums.WriteSums(buildDir, algorithms)
+	if err != nil {
+		return err
+	}
+	if signChecksums == "" {
+		return nil
+	}
+	for _, sumsPath := range sumsPaths {
+		if _, err := imagesums.SignSums(sumsPath, signChecksums); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func displayImageBuildTiming(imageType string, template *config.ImageTemplate) {
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imagesums"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
+)
+
+// BuildResult is the machine-readable summary printed by `build --output json`.
+type BuildResult struct {
+	Success         bool            `json:"success"`
+	Error           string          `json:"error,omitempty"`
+	Template        string          `json:"template"`
+	Image           BuildImageInfo  `json:"image"`
+	Target          BuildTargetInfo `json:"target"`
+	BuildDir        string          `json:"buildDir,omitempty"`
+	Artifacts       []BuildArtifact `json:"artifacts"`
+	Warnings        []string        `json:"warnings"`
+	Timings         []BuildTiming   `json:"timings"`
+	StartedAt       time.Time       `json:"startedAt"`
+	FinishedAt      time.Time       `json:"finishedAt"`
+	DurationSeconds float64         `json:"durationSeconds"`
+}
+
+type BuildImageInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type BuildTargetInfo struct {
+	OS        string `json:"os"`
+	Dist      string `json:"dist"`
+	Arch      string `json:"arch"`
+	ImageType string `json:"imageType"`
+}
+
+// BuildArtifact is a file produced in the image build directory.
+type BuildArtifact struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	SizeBytes int64  `json:"sizeBytes"`
+	SHA256    string `json:"sha256,omitempty"`
+	SHA512    string `json:"sha512,omitempty"`
+}
+
+// BuildTiming is the duration of one build stage, using the same stage names
+// as the timing table printed at the end of a text build.
+type BuildTiming struct {
+	Stage   string  `json:"stage"`
+	Seconds float64 `json:"seconds"`
+}
+
+func newBuildResult(templateFile string, start time.Time) *BuildResult {
+	return &BuildResult{
+		Template:  templateFile,
+		Artifacts: []BuildArtifact{},
+		Warnings:  []string{},
+		Timings:   []BuildTiming{},
+		StartedAt: start,
+	}
+}
+
+// finish records the outcome of the build. template is nil when the build
+// failed before the template could be loaded.
+func (r *BuildResult) finish(template *config.ImageTemplate, buildErr error) {
+	log := logger.Logger()
+	r.FinishedAt = time.Now()
+	r.DurationSeconds = r.FinishedAt.Sub(r.StartedAt).Seconds()
+	r.Success = buildErr == nil
+	if buildErr != nil {
+		r.Error = buildErr.Error()
+	}
+	if template == nil {
+		return
+	}
+
+	r.Image = BuildImageInfo{Name: template.Image.Name, Version: template.Image.Version}
+	r.Target = BuildTargetInfo{
+		OS:        template.Target.OS,
+		Dist:      template.Target.Dist,
+		Arch:      template.Target.Arch,
+		ImageType: template.Target.ImageType,
+	}
+
+	for _, row := range []struct {
+		stage    string
+		duration time.Duration
+	}{
+		{stage: "Initialization and Configuration", duration: template.GetDurationStartToDownloadImagePkgs()},
+		{stage: "Package Download", duration: template.GetDownloadImagePkgsDuration()},
+		{stage: "Chroot Package Download", duration: template.GetChrootPkgDownloadDuration()},
+		{stage: "Chroot Env Initialization", duration: template.GetDurationDownloadImagePkgsToPureBuild()},
+		{stage: "Image Build", duration: template.GetPureImageBuildDuration()},
+		{stage: "Image Conversion", duration: template.GetConvertImageDuration()},
+		{stage: "Finalization and Clean Up", duration: template.GetDurationConvertImageFileToFinish()},
+	} {
+		r.Timings = append(r.Timings, BuildTiming{Stage: row.stage, Seconds: row.duration.Seconds()})
+	}
+
+	buildDir, err := imageBuildDir(template)
+	if err != nil {
+		log.Warnf("Failed to get image build directory for build result: %v", err)
+		return
+	}
+	r.BuildDir = buildDir
+
+	// Files left over from an earlier build would be reported as artifacts
+	// of this one, so only a successful build lists the build directory
+	if !r.Success {
+		return
+	}
+	artifacts, err := listBuildArtifacts(r.BuildDir)
+	if err != nil {
+		log.Warnf("Failed to list build artifacts in %s: %v", r.BuildDir, err)
+		return
+	}
+	r.Artifacts = artifacts
+}
+
+// imageBuildDir returns the directory the providers write the artifacts of
+// template to.
+func imageBuildDir(template *config.ImageTemplate) (string, error) {
+	globalWorkDir, err := config.WorkDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get work directory: %w", err)
+	}
+	return filepath.Join(
+		globalWorkDir,
+		system.GetProviderId(template.Target.OS, template.Target.Dist, template.Target.Arch),
+		"imagebuild",
+		template.GetSystemConfigName(),
+	), nil
+}
+
+// listBuildArtifacts returns the regular files directly under dir with their
+// size and their checksums selected by --checksum-algorithm.
+func listBuildArtifacts(dir string) ([]BuildArtifact, error) {
+	algorithms, err := imagesums.ParseAlgorithms(checksumAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build directory: %w", err)
+	}
+
+	artifacts := []BuildArtifact{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		size, digests, err := imagesums.FileDigests(path, algorithms)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, BuildArtifact{
+			Name:      entry.Name(),
+			Path:      path,
+			SizeBytes: size,
+			SHA256:    digests[imagesums.SHA256],
+			SHA512:    digests[imagesums.SHA512],
+		})
+	}
+	return artifacts, nil
+}
+
+// writeBuildResult writes r to w as indented JSON.
+func writeBuildResult(w io.Writer, r *BuildResult) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal build result: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
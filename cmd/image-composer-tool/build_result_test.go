@@ -0,0 +1,785 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imageinspect"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imagesums"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
+)
+
+// stubBuildProvider writes a fake image into the build directory, or fails
+// with buildErr, without touching the host. It checkpoints a fake download
+// and install stage like the real providers.
+type stubBuildProvider struct {
+	buildErr    error
+	postErr     error
+	downloads   int    // number of times the download stage ran
+	resumeStage string // first incomplete stage when the image build started
+	preProcess  func(t *config.ImageTemplate) error
+	buildImage  func(t *config.ImageTemplate) error // runs once the install stage completed
+	postCalls   int                                 // number of times PostProcess ran
+}
+
+func (s *stubBuildProvider) Name(dist, arch string) string { return "stub" }
+func (s *stubBuildProvider) Init(dist, arch string) error  { return nil }
+func (s *stubBuildProvider) PreProcess(t *config.ImageTemplate) error {
+	if s.preProcess != nil {
+		if err := s.preProcess(t); err != nil {
+			return err
+		}
+	}
+	return provider.RunDownloadStage(t, func() error {
+		s.downloads++
+		return nil
+	})
+}
+
+func (s *stubBuildProvider) BuildImage(t *config.ImageTemplate) error {
+	logger.Logger().Warnf("stub warning for %s", t.GetImageName())
+	s.resumeStage = t.Checkpoint.ResumeStage()
+	if !t.Checkpoint.IsCompleted(config.StageInstall) {
+		t.Checkpoint.Complete(config.StageInstall)
+	}
+	if s.buildImage != nil {
+		if err := s.buildImage(t); err != nil {
+			return err
+		}
+	}
+	if s.buildErr != nil {
+		return s.buildErr
+	}
+	workDir, err := config.WorkDir()
+	if err != nil {
+		return err
+	}
+	buildDir := filepath.Join(workDir, system.GetProviderId(t.Target.OS, t.Target.Dist, t.Target.Arch),
+		"imagebuild", t.GetSystemConfigName())
+	if err := os.MkdirAll(filepath.Join(buildDir, "rootfs"), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(buildDir, "test-image.raw"), []byte("image content"), 0644)
+}
+
+func (s *stubBuildProvider) PostProcess(t *config.ImageTemplate, err error) error {
+	s.postCalls++
+	return s.postErr
+}
+
+func (s *stubBuildProvider) Capabilities() provider.Capabilities { return provider.Capabilities{} }
+
+// useStubProvider points the build at stub and a temporary work directory.
+func useStubProvider(t *testing.T, stub *stubBuildProvider) string {
+	t.Helper()
+	origInitProvider := initProvider
+	origConfig := config.Global()
+	origWorkDir := origConfig.WorkDir
+	t.Cleanup(func() {
+		initProvider = origInitProvider
+		origConfig.WorkDir = origWorkDir
+		config.SetGlobal(origConfig)
+	})
+
+	initProvider = func(os, dist, arch string) (provider.Provider, error) {
+		return stub, nil
+	}
+	tempWorkDir := t.TempDir()
+	currentConfig := config.Global()
+	currentConfig.WorkDir = tempWorkDir
+	config.SetGlobal(currentConfig)
+	return tempWorkDir
+}
+
+func writeBuildResultTemplate(t *testing.T) string {
+	t.Helper()
+	templatePath := filepath.Join(t.TempDir(), "test-template.yml")
+	content := `image:
+  name: test-image
+  version: "1.0.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test-config
+  packages:
+    - bash
+  kernel:
+    version: "6.12"
+    cmdline: "quiet"
+`
+	if err := os.WriteFile(templatePath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create test template: %v", err)
+	}
+	return templatePath
+}
+
+func runJSONBuild(t *testing.T, templatePath string) (BuildResult, error) {
+	t.Helper()
+	defer resetBuildFlags()
+
+	cmd := createBuildCommand()
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	if err := cmd.Flags().Set("output", "json"); err != nil {
+		t.Fatalf("failed to set output flag: %v", err)
+	}
+	err := executeBuild(cmd, []string{templatePath})
+
+	var result BuildResult
+	if jsonErr := json.Unmarshal(stdout.Bytes(), &result); jsonErr != nil {
+		t.Fatalf("stdout is not a BuildResult: %v\n%s", jsonErr, stdout.String())
+	}
+	return result, err
+}
+
+func TestRunBuild_JSONResultSuccess(t *testing.T) {
+	workDir := useStubProvider(t, &stubBuildProvider{})
+	templatePath := writeBuildResultTemplate(t)
+
+	result, err := runJSONBuild(t, templatePath)
+	if err != nil {
+		t.Fatalf("expected build to succeed, got: %v", err)
+	}
+
+	if !result.Success || result.Error != "" {
+		t.Errorf("expected success without error, got success=%v error=%q", result.Success, result.Error)
+	}
+	if result.Template != templatePath {
+		t.Errorf("expected template %q, got %q", templatePath, result.Template)
+	}
+	if result.Image.Name != "test-image" || result.Image.Version != "1.0.0" {
+		t.Errorf("unexpected image info: %+v", result.Image)
+	}
+	expectedTarget := BuildTargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64", ImageType: "raw"}
+	if result.Target != expectedTarget {
+		t.Errorf("expected target %+v, got %+v", expectedTarget, result.Target)
+	}
+	if !strings.HasPrefix(result.BuildDir, workDir) {
+		t.Errorf("expected build dir under %s, got %s", workDir, result.BuildDir)
+	}
+	if len(result.Timings) != 7 || result.Timings[0].Stage != "Initialization and Configuration" {
+		t.Errorf("unexpected timings: %+v", result.Timings)
+	}
+	if result.FinishedAt.Before(result.StartedAt) {
+		t.Errorf("finishedAt %v is before startedAt %v", result.FinishedAt, result.StartedAt)
+	}
+	foundWarning := false
+	for _, warning := range result.Warnings {
+		foundWarning = foundWarning || warning == "stub warning for test-image"
+	}
+	if !foundWarning {
+		t.Errorf("expected the build warning to be captured, got %v", result.Warnings)
+	}
+
+	if len(result.Artifacts) != 2 {
+		t.Fatalf("expected the image and SHA256SUMS (directories skipped), got %+v", result.Artifacts)
+	}
+	sum := sha256.Sum256([]byte("image content"))
+	imageSum := hex.EncodeToString(sum[:])
+	sumsArtifact, artifact := result.Artifacts[0], result.Artifacts[1]
+	if artifact.Name != "test-image.raw" ||
+		artifact.Path != filepath.Join(result.BuildDir, "test-image.raw") ||
+		artifact.SizeBytes != int64(len("image content")) ||
+		artifact.SHA256 != imageSum {
+		t.Errorf("unexpected artifact: %+v", artifact)
+	}
+	if sumsArtifact.Name != imagesums.SumsFileName {
+		t.Fatalf("expected %s artifact, got %+v", imagesums.SumsFileName, sumsArtifact)
+	}
+	sums, err := os.ReadFile(sumsArtifact.Path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", sumsArtifact.Path, err)
+	}
+	if string(sums) != imageSum+"  test-image.raw\n" {
+		t.Errorf("unexpected %s content: %q", imagesums.SumsFileName, sums)
+	}
+}
+
+func TestRunBuild_SignChecksums(t *testing.T) {
+	useStubProvider(t, &stubBuildProvider{})
+	templatePath := writeBuildResultTemplate(t)
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "gpg .*--local-user release@example.com .*--detach-sign .*/SHA256SUMS$", Output: "", Error: nil},
+	})
+	signChecksums = "release@example.com"
+	defer func() { signChecksums = "" }()
+
+	if _, err := runBuild(templatePath); err != nil {
+		t.Fatalf("expected signed build to succeed, got: %v", err)
+	}
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "gpg", Output: "", Error: fmt.Errorf("no secret key")},
+	})
+	result, err := runBuild(templatePath)
+	if err == nil || !strings.Contains(err.Error(), "writing artifact checksums failed") {
+		t.Fatalf("expected a signing error, got: %v", err)
+	}
+	if result.Success {
+		t.Error("expected the build result to report failure")
+	}
+}
+
+func TestExecuteBuild_ChecksumAlgorithm(t *testing.T) {
+	defer resetBuildFlags()
+
+	cmd := createBuildCommand()
+	if err := cmd.Flags().Set("checksum-algorithm", "md5"); err != nil {
+		t.Fatalf("failed to set checksum-algorithm flag: %v", err)
+	}
+	err := executeBuild(cmd, []string{"template.yml"})
+	if err == nil || !strings.Contains(err.Error(), "invalid --checksum-algorithm") {
+		t.Errorf("expected an unknown algorithm to be rejected, got %v", err)
+	}
+
+	useStubProvider(t, &stubBuildProvider{})
+	templatePath := writeBuildResultTemplate(t)
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "gpg .*--detach-sign .*/SHA(256|512)SUMS$", Output: "", Error: nil},
+	})
+
+	cmd = createBuildCommand()
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	for flag, value := range map[string]string{"output": "json", "checksum-algorithm": "both", "sign-checksums": "release@example.com"} {
+		if err := cmd.Flags().Set(flag, value); err != nil {
+			t.Fatalf("failed to set %s flag: %v", flag, err)
+		}
+	}
+	if err := executeBuild(cmd, []string{templatePath}); err != nil {
+		t.Fatalf("expected build to succeed, got: %v", err)
+	}
+	var result BuildResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("stdout is not a BuildResult: %v\n%s", err, stdout.String())
+	}
+
+	imageSHA256 := sha256.Sum256([]byte("image content"))
+	imageSHA512 := sha512.Sum512([]byte("image content"))
+	var names []string
+	for _, artifact := range result.Artifacts {
+		names = append(names, artifact.Name)
+		if artifact.Name == "test-image.raw" &&
+			(artifact.SHA256 != hex.EncodeToString(imageSHA256[:]) || artifact.SHA512 != hex.EncodeToString(imageSHA512[:])) {
+			t.Errorf("expected both checksums of the image, got %+v", artifact)
+		}
+	}
+	if want := []string{imagesums.SumsFileName, imagesums.SHA512SumsFileName, "test-image.raw"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("expected artifacts %v, got %v", want, names)
+	}
+	sums, err := os.ReadFile(filepath.Join(result.BuildDir, imagesums.SHA512SumsFileName))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", imagesums.SHA512SumsFileName, err)
+	}
+	if string(sums) != hex.EncodeToString(imageSHA512[:])+"  test-image.raw\n" {
+		t.Errorf("unexpected %s content: %q", imagesums.SHA512SumsFileName, sums)
+	}
+}
+
+func TestRunBuild_Resume(t *testing.T) {
+	stub := &stubBuildProvider{buildErr: fmt.Errorf("signing failed")}
+	workDir := useStubProvider(t, stub)
+	templatePath := writeBuildResultTemplate(t)
+	defer resetBuildFlags()
+
+	if _, err := runBuild(templatePath); err == nil {
+		t.Fatal("expected the first build to fail")
+	}
+	checkpointPath := filepath.Join(workDir, "azure-linux-azl3-x86_64", "imagebuild", "test-config", buildCheckpointFile)
+	if _, err := os.Stat(checkpointPath); err != nil {
+		t.Fatalf("expected the failed build to leave a checkpoint: %v", err)
+	}
+
+	stub.buildErr = nil
+	resume = true
+	if _, err := runBuild(templatePath); err != nil {
+		t.Fatalf("expected the resumed build to succeed, got: %v", err)
+	}
+	if stub.downloads != 1 {
+		t.Errorf("expected the resumed build to skip the download stage, got %d downloads", stub.downloads)
+	}
+	if stub.resumeStage != config.StageConfig {
+		t.Errorf("expected the resumed build to start at the %s stage, got %q", config.StageConfig, stub.resumeStage)
+	}
+	if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+		t.Errorf("expected the checkpoint to be removed after a successful build, got %v", err)
+	}
+
+	// Nothing is left to resume
+	if _, err := runBuild(templatePath); err == nil || !strings.Contains(err.Error(), "no build checkpoint") {
+		t.Fatalf("expected a missing checkpoint error, got %v", err)
+	}
+}
+
+func TestRunBuild_ResumeRejectsChangedTemplate(t *testing.T) {
+	stub := &stubBuildProvider{buildErr: fmt.Errorf("signing failed")}
+	useStubProvider(t, stub)
+	templatePath := writeBuildResultTemplate(t)
+	defer resetBuildFlags()
+
+	if _, err := runBuild(templatePath); err == nil {
+		t.Fatal("expected the first build to fail")
+	}
+
+	resume = true
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		t.Fatalf("failed to read test template: %v", err)
+	}
+	content = bytes.Replace(content, []byte("- bash"), []byte("- bash\n    - curl"), 1)
+	if err := os.WriteFile(templatePath, content, 0644); err != nil {
+		t.Fatalf("failed to update test template: %v", err)
+	}
+	_, err = runBuild(templatePath)
+	if err == nil || !strings.Contains(err.Error(), "different template") {
+		t.Fatalf("expected a template mismatch error, got %v", err)
+	}
+	if stub.downloads != 1 {
+		t.Errorf("expected the rejected resume not to run the download stage, got %d downloads", stub.downloads)
+	}
+}
+
+func TestRunBuild_RepositoryKeyPreflight(t *testing.T) {
+	stub := &stubBuildProvider{}
+	useStubProvider(t, stub)
+	defer resetBuildFlags()
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	templatePath := writeBuildResultTemplate(t)
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		t.Fatalf("failed to read test template: %v", err)
+	}
+	content = append(content, []byte(`packageRepositories:
+  - codename: extras
+    url: `+server.URL+`
+    pkey: `+server.URL+`/key.asc
+`)...)
+	if err := os.WriteFile(templatePath, content, 0644); err != nil {
+		t.Fatalf("failed to update test template: %v", err)
+	}
+
+	_, err = runBuild(templatePath)
+	if err == nil || !strings.Contains(err.Error(), "repository GPG key check failed") {
+		t.Fatalf("expected the key preflight to fail the build, got %v", err)
+	}
+	if stub.downloads != 0 {
+		t.Errorf("expected the build to stop before downloading, got %d downloads", stub.downloads)
+	}
+
+	skipGPGPreflight = true
+	if _, err := runBuild(templatePath); err != nil {
+		t.Fatalf("expected the build to skip the key preflight, got %v", err)
+	}
+}
+
+func TestRunBuild_RemovesGeneratedTempFiles(t *testing.T) {
+	var generated []string
+	stub := &stubBuildProvider{
+		buildErr: fmt.Errorf("aborted"),
+		preProcess: func(template *config.ImageTemplate) error {
+			if err := template.GenerateAptSourcesFromRepositories(); err != nil {
+				return err
+			}
+			for _, file := range template.SystemConfig.AdditionalFiles {
+				generated = append(generated, file.Local)
+			}
+			return nil
+		},
+	}
+	useStubProvider(t, stub)
+	defer resetBuildFlags()
+	skipGPGPreflight = true
+
+	tempDir := t.TempDir()
+	origConfig := config.Global()
+	origTempDir := origConfig.TempDir
+	defer func() {
+		origConfig.TempDir = origTempDir
+		config.SetGlobal(origConfig)
+	}()
+	currentConfig := config.Global()
+	currentConfig.TempDir = tempDir
+	config.SetGlobal(currentConfig)
+
+	keyPath := filepath.Join(t.TempDir(), "repo.gpg")
+	if err := os.WriteFile(keyPath, []byte("key"), 0644); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	templatePath := filepath.Join(t.TempDir(), "ubuntu.yml")
+	content := `image:
+  name: test-image
+  version: "1.0.0"
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+packageRepositories:
+  - codename: noble
+    url: https://apt.example.com/ubuntu
+    pkey: ` + keyPath + `
+systemConfig:
+  name: test-config
+  packages:
+    - bash
+`
+	if err := os.WriteFile(templatePath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create test template: %v", err)
+	}
+
+	if _, err := runBuild(templatePath); err == nil {
+		t.Fatal("expected the aborted build to fail")
+	}
+	if len(generated) == 0 {
+		t.Fatal("expected the build to generate apt configuration files")
+	}
+	for _, path := range generated {
+		if filepath.Dir(path) != tempDir {
+			t.Errorf("expected %s to be generated in the configured temp dir %s", path, tempDir)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed after the build, got %v", path, err)
+		}
+	}
+}
+
+func TestRunBuild_JSONResultFailure(t *testing.T) {
+	tests := []struct {
+		name           string
+		stub           *stubBuildProvider
+		templatePath   func(t *testing.T) string
+		expectedError  string
+		expectedTarget BuildTargetInfo
+		expectTimings  bool
+	}{
+		{
+			name: "BuildImageFails",
+			stub: &stubBuildProvider{buildErr: fmt.Errorf("disk full")},
+			templatePath: func(t *testing.T) string {
+				return writeBuildResultTemplate(t)
+			},
+			expectedError:  "image build failed: disk full",
+			expectedTarget: BuildTargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64", ImageType: "raw"},
+			expectTimings:  true,
+		},
+		{
+			name: "TemplateMissing",
+			stub: &stubBuildProvider{},
+			templatePath: func(t *testing.T) string {
+				return filepath.Join(t.TempDir(), "missing.yml")
+			},
+			expectedError: "loading and merging template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useStubProvider(t, tt.stub)
+
+			result, err := runJSONBuild(t, tt.templatePath(t))
+			if err == nil {
+				t.Fatal("expected build to fail")
+			}
+
+			if result.Success {
+				t.Error("expected success=false")
+			}
+			if !strings.Contains(result.Error, tt.expectedError) {
+				t.Errorf("expected error containing %q, got %q", tt.expectedError, result.Error)
+			}
+			if result.Target != tt.expectedTarget {
+				t.Errorf("expected target %+v, got %+v", tt.expectedTarget, result.Target)
+			}
+			if (len(result.Timings) > 0) != tt.expectTimings {
+				t.Errorf("expected timings=%v, got %+v", tt.expectTimings, result.Timings)
+			}
+			if result.Artifacts == nil || len(result.Artifacts) != 0 {
+				t.Errorf("expected an empty artifact list, got %+v", result.Artifacts)
+			}
+		})
+	}
+}
+
+func TestExecuteBuild_InvalidOutput(t *testing.T) {
+	defer resetBuildFlags()
+
+	cmd := createBuildCommand()
+	if err := cmd.Flags().Set("output", "yaml"); err != nil {
+		t.Fatalf("failed to set output flag: %v", err)
+	}
+	err := executeBuild(cmd, []string{"template.yml"})
+	if err == nil || !strings.Contains(err.Error(), "invalid --output") {
+		t.Errorf("expected invalid --output error, got %v", err)
+	}
+}
+
+func TestExecuteBuild_ChrootCommandLimits(t *testing.T) {
+	defer resetBuildFlags()
+	originalTimeout, originalRetries := shell.CmdTimeout, shell.CmdRetries
+	defer func() { shell.CmdTimeout, shell.CmdRetries = originalTimeout, originalRetries }()
+
+	cmd := createBuildCommand()
+	if err := cmd.Flags().Set("cmd-timeout", "-1s"); err != nil {
+		t.Fatalf("failed to set cmd-timeout flag: %v", err)
+	}
+	err := executeBuild(cmd, []string{"template.yml"})
+	if err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("expected a negative timeout to be rejected, got %v", err)
+	}
+
+	useStubProvider(t, &stubBuildProvider{})
+	templatePath := writeBuildResultTemplate(t)
+	cmd = createBuildCommand()
+	for flag, value := range map[string]string{"cmd-timeout": "45m", "cmd-retries": "3"} {
+		if err := cmd.Flags().Set(flag, value); err != nil {
+			t.Fatalf("failed to set %s flag: %v", flag, err)
+		}
+	}
+	if err := executeBuild(cmd, []string{templatePath}); err != nil {
+		t.Fatalf("expected build to succeed, got: %v", err)
+	}
+	if shell.CmdTimeout != 45*time.Minute || shell.CmdRetries != 3 {
+		t.Errorf("expected the shell limits to be 45m and 3 retries, got %s and %d", shell.CmdTimeout, shell.CmdRetries)
+	}
+}
+
+func TestRunBuild_Deadline(t *testing.T) {
+	stub := &stubBuildProvider{
+		buildImage: func(template *config.ImageTemplate) error {
+			_, err := shell.ExecCmd("sleep 30", false, shell.HostPath, nil)
+			return err
+		},
+	}
+	useStubProvider(t, stub)
+	defer resetBuildFlags()
+	skipGPGPreflight = true
+	buildDeadline = 300 * time.Millisecond
+
+	start := time.Now()
+	_, err := runBuild(writeBuildResultTemplate(t))
+	if !errors.Is(err, shell.ErrBuildDeadline) {
+		t.Fatalf("expected a build deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("build was aborted %s after it started, expected it at the deadline", elapsed)
+	}
+	if !strings.Contains(err.Error(), "during the config stage") {
+		t.Errorf("expected the error to name the running config stage, got %v", err)
+	}
+	if stub.postCalls != 1 {
+		t.Errorf("expected post-processing to clean up once after the deadline, ran %d times", stub.postCalls)
+	}
+	if !shell.BuildDeadline.IsZero() {
+		t.Errorf("expected the deadline to be cleared after the build, got %s", shell.BuildDeadline)
+	}
+}
+
+func TestExecuteBuild_FailOnWarning(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        string
+		failOnWarning bool
+		expectError   bool
+	}{
+		{name: "TextDefault", output: "text"},
+		{name: "TextStrict", output: "text", failOnWarning: true, expectError: true},
+		{name: "JSONDefault", output: "json"},
+		{name: "JSONStrict", output: "json", failOnWarning: true, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetBuildFlags()
+			useStubProvider(t, &stubBuildProvider{})
+			templatePath := writeBuildResultTemplate(t)
+
+			cmd := createBuildCommand()
+			var stdout bytes.Buffer
+			cmd.SetOut(&stdout)
+			if err := cmd.Flags().Set("output", tt.output); err != nil {
+				t.Fatalf("failed to set output flag: %v", err)
+			}
+			if tt.failOnWarning {
+				if err := cmd.Flags().Set("fail-on-warning", "true"); err != nil {
+					t.Fatalf("failed to set fail-on-warning flag: %v", err)
+				}
+			}
+
+			err := executeBuild(cmd, []string{templatePath})
+			if !tt.expectError {
+				if err != nil {
+					t.Fatalf("expected warnings to be non-fatal, got: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), "--fail-on-warning") {
+				t.Fatalf("expected the build to fail on warnings, got: %v", err)
+			}
+
+			if tt.output == "json" {
+				var result BuildResult
+				if jsonErr := json.Unmarshal(stdout.Bytes(), &result); jsonErr != nil {
+					t.Fatalf("stdout is not a BuildResult: %v\n%s", jsonErr, stdout.String())
+				}
+				if result.Success == tt.expectError {
+					t.Errorf("expected success=%v, got %v (error %q)", !tt.expectError, result.Success, result.Error)
+				}
+				if tt.expectError && !strings.Contains(result.Error, "--fail-on-warning") {
+					t.Errorf("expected the result error to name --fail-on-warning, got %q", result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestRunBuild_VerifySecureBoot(t *testing.T) {
+	esp := func(ukiSigned bool) *imageinspect.ImageSummary {
+		return &imageinspect.ImageSummary{PartitionTable: imageinspect.PartitionTableSummary{
+			Partitions: []imageinspect.PartitionSummary{{
+				Index: 1,
+				Type:  "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+				Filesystem: &imageinspect.FilesystemSummary{Type: "vfat", EFIBinaries: []imageinspect.EFIBinaryEvidence{
+					{Path: "EFI/BOOT/BOOTX64.EFI", Kind: imageinspect.BootloaderSystemdBoot, Signed: true},
+					{Path: "EFI/Linux/linux.efi", Kind: imageinspect.BootloaderUKI, IsUKI: true, Signed: ukiSigned},
+				}},
+			}},
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		secureBoot  bool
+		summary     *imageinspect.ImageSummary
+		expectError string
+	}{
+		{name: "SignedChain", secureBoot: true, summary: esp(true)},
+		{name: "UnsignedUKI", secureBoot: true, summary: esp(false), expectError: "UKI EFI/Linux/linux.efi is not signed"},
+		{name: "SecureBootNotRequested", summary: esp(false)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetBuildFlags()
+			useStubProvider(t, &stubBuildProvider{})
+			skipGPGPreflight = true
+			verifySecureBoot = true
+
+			origNewInspector := newInspector
+			t.Cleanup(func() { newInspector = origNewInspector })
+			fi := &fakeInspector{summary: tt.summary}
+			newInspector = func(hash bool) inspector { return fi }
+
+			templatePath := writeBuildResultTemplate(t)
+			if tt.secureBoot {
+				content, err := os.ReadFile(templatePath)
+				if err != nil {
+					t.Fatalf("failed to read test template: %v", err)
+				}
+				content = append(content, []byte(`  immutability:
+    enabled: true
+    secureBootDBKey: /keys/db.key
+    secureBootDBCrt: /keys/db.crt
+    secureBootDBCer: /keys/db.cer
+`)...)
+				if err := os.WriteFile(templatePath, content, 0644); err != nil {
+					t.Fatalf("failed to update test template: %v", err)
+				}
+			}
+
+			result, err := runBuild(templatePath)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("expected the build to succeed, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "secure boot verification failed") ||
+				!strings.Contains(err.Error(), tt.expectError) {
+				t.Fatalf("expected secure boot verification to fail with %q, got: %v", tt.expectError, err)
+			}
+			if result.Success {
+				t.Error("expected the build result to record the failure")
+			}
+		})
+	}
+}
+
+func TestRunBuild_HostToolVersions(t *testing.T) {
+	tests := []struct {
+		name        string
+		minimums    map[string]string
+		expectError string
+	}{
+		{name: "Recorded"},
+		{name: "RecentEnough", minimums: map[string]string{"mmdebstrap": "1.3"}},
+		{name: "TooOld", minimums: map[string]string{"mmdebstrap": "1.4.0"}, expectError: "mmdebstrap 1.3.5 (minimum 1.4.0)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetBuildFlags()
+			var recorded map[string]string
+			built := false
+			useStubProvider(t, &stubBuildProvider{buildImage: func(template *config.ImageTemplate) error {
+				built = true
+				recorded = template.HostToolVersions
+				return nil
+			}})
+			skipGPGPreflight = true
+
+			currentConfig := *config.Global()
+			currentConfig.MinToolVersions = tt.minimums
+			config.SetGlobal(&currentConfig)
+
+			originalExecutor := shell.Default
+			defer func() { shell.Default = originalExecutor }()
+			shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+				{Pattern: "command -v mmdebstrap", Output: "/usr/bin/mmdebstrap\n", Error: nil},
+				{Pattern: "command -v", Output: "", Error: fmt.Errorf("exit status 1")},
+				{Pattern: "mmdebstrap --version", Output: "mmdebstrap 1.3.5\n", Error: nil},
+			})
+
+			_, err := runBuild(writeBuildResultTemplate(t))
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), "host tool version check failed") ||
+					!strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("expected the host tool version check to fail with %q, got: %v", tt.expectError, err)
+				}
+				if built {
+					t.Error("expected the image not to be built with a too old host tool")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the build to succeed, got: %v", err)
+			}
+			if len(recorded) != 1 || recorded["mmdebstrap"] != "1.3.5" {
+				t.Errorf("expected the mmdebstrap version to be recorded for the build, got %v", recorded)
+			}
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imagesums"
 	"github.com/open-edge-platform/image-composer-tool/internal/provider"
 	"github.com/open-edge-platform/image-composer-tool/internal/provider/azl"
 	"github.com/open-edge-platform/image-composer-tool/internal/provider/elxr"
@@ -20,6 +24,25 @@ func resetBuildFlags() {
 	workers = -1
 	cacheDir = ""
 	workDir = ""
+	tempDir = ""
+	templateOverrides = nil
+	buildOutput = "text"
+	failOnWarning = false
+	signChecksums = ""
+	continueOnInstall = false
+	incremental = false
+	explain = false
+	resume = false
+	showConfig = ""
+	streamDownloads = false
+	skipGPGPreflight = false
+	verifySecureBoot = false
+	templateRepo = ""
+	templateRef = ""
+	cmdTimeout = 0
+	cmdRetries = 0
+	buildDeadline = 0
+	checksumAlgorithm = imagesums.SHA256
 }
 
 // createTestTemplate creates a minimal valid template file for testing
@@ -104,6 +127,8 @@ func TestCreateBuildCommand(t *testing.T) {
 			{name: "workers", shorthand: "w", shouldExist: true},
 			{name: "cache-dir", shorthand: "d", shouldExist: true},
 			{name: "work-dir", shorthand: "", shouldExist: true},
+			{name: "temp-dir", shorthand: "", shouldExist: true},
+			{name: "set", shorthand: "", shouldExist: true},
 		}
 
 		for _, expected := range expectedFlags {
@@ -553,6 +578,30 @@ func TestBuildCommand_FlagParsing(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "RepeatedSetFlag",
+			args: []string{"--set", "target.arch=aarch64", "--set", "target.imageType=img", "template.yml"},
+			validate: func(t *testing.T) {
+				if err := cmd.ParseFlags([]string{"--set", "target.arch=aarch64", "--set", "target.imageType=img"}); err != nil {
+					t.Fatalf("failed to parse flags: %v", err)
+				}
+				expected := []string{"target.arch=aarch64", "target.imageType=img"}
+				if strings.Join(templateOverrides, ",") != strings.Join(expected, ",") {
+					t.Errorf("expected overrides %v, got %v", expected, templateOverrides)
+				}
+			},
+		}, {
+			name: "ChrootCommandLimits",
+			args: []string{"--cmd-timeout", "30m", "--cmd-retries", "2", "template.yml"},
+			validate: func(t *testing.T) {
+				if err := cmd.ParseFlags([]string{"--cmd-timeout", "30m", "--cmd-retries", "2"}); err != nil {
+					t.Fatalf("failed to parse flags: %v", err)
+				}
+				if cmdTimeout != 30*time.Minute || cmdRetries != 2 {
+					t.Errorf("expected cmdTimeout=30m and cmdRetries=2, got %s and %d", cmdTimeout, cmdRetries)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -739,3 +788,97 @@ func TestBuildCommand_ArgumentValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteBuild_ShowConfig(t *testing.T) {
+	defer resetBuildFlags()
+
+	origConfig := config.Global()
+	origInitProvider := initProvider
+	defer func() {
+		config.SetGlobal(origConfig)
+		initProvider = origInitProvider
+	}()
+	configDir, err := filepath.Abs(filepath.Join("..", "..", "config"))
+	if err != nil {
+		t.Fatalf("failed to resolve config directory: %v", err)
+	}
+	currentConfig := config.Global()
+	currentConfig.ConfigDir = configDir
+	config.SetGlobal(currentConfig)
+	initProvider = func(os, dist, arch string) (provider.Provider, error) {
+		t.Fatal("--show-config must not start a build")
+		return nil, nil
+	}
+
+	templatePath := writeBuildResultTemplate(t)
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		t.Fatalf("failed to read test template: %v", err)
+	}
+	content = append(content, []byte("  users:\n    - name: admin\n      password: \"s3cret\"\n      sudo: true\n")...)
+	if err := os.WriteFile(templatePath, content, 0644); err != nil {
+		t.Fatalf("failed to write test template: %v", err)
+	}
+
+	cmd := createBuildCommand()
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	if err := cmd.ParseFlags([]string{"--show-config=json", "--set", "target.arch=aarch64"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if err := executeBuild(cmd, []string{templatePath}); err != nil {
+		t.Fatalf("expected --show-config to succeed, got: %v", err)
+	}
+
+	var effective struct {
+		Target struct {
+			Arch string `json:"arch"`
+		} `json:"target"`
+		SystemConfig struct {
+			Packages []string `json:"packages"`
+			Kernel   struct {
+				Cmdline string `json:"cmdline"`
+			} `json:"kernel"`
+			Users []struct {
+				Name     string `json:"name"`
+				Password string `json:"password"`
+			} `json:"users"`
+		} `json:"systemConfig"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &effective); err != nil {
+		t.Fatalf("stdout is not a JSON template: %v\n%s", err, stdout.String())
+	}
+	if effective.Target.Arch != "aarch64" {
+		t.Errorf("expected the --set override to be applied, got arch %q", effective.Target.Arch)
+	}
+	packages := strings.Join(effective.SystemConfig.Packages, " ")
+	if !strings.Contains(packages, "bash") || !strings.Contains(packages, "filesystem") {
+		t.Errorf("expected the template packages merged with the defaults, got %v", effective.SystemConfig.Packages)
+	}
+	if effective.SystemConfig.Kernel.Cmdline != "quiet" {
+		t.Errorf("expected the template kernel command line to win over the default, got %q", effective.SystemConfig.Kernel.Cmdline)
+	}
+	if len(effective.SystemConfig.Users) == 0 || effective.SystemConfig.Users[0].Password != "[REDACTED]" {
+		t.Errorf("expected user passwords to be redacted, got %+v", effective.SystemConfig.Users)
+	}
+
+	// The flag alone prints YAML
+	resetBuildFlags()
+	cmd = createBuildCommand()
+	stdout.Reset()
+	cmd.SetOut(&stdout)
+	if err := cmd.ParseFlags([]string{"--show-config"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if err := executeBuild(cmd, []string{templatePath}); err != nil {
+		t.Fatalf("expected --show-config to succeed, got: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "arch: x86_64") {
+		t.Errorf("expected a YAML template, got:\n%s", stdout.String())
+	}
+
+	showConfig = "toml"
+	if err := executeBuild(cmd, []string{templatePath}); err == nil || !strings.Contains(err.Error(), "invalid --show-config") {
+		t.Errorf("expected an invalid format error, got: %v", err)
+	}
+}
@@ -12,10 +12,12 @@ import (
 
 // Output format command flags
 var (
-	prettyDiffJSON bool   = true  // Pretty-print JSON output
-	outFormat      string         // "text" | "json"
-	outMode        string = ""    // "full" | "diff" | "summary" | "spdx"
-	hashImages     bool   = false // Skip hashing during inspection
+	prettyDiffJSON bool     = true  // Pretty-print JSON output
+	outFormat      string           // "text" | "json"
+	outMode        string   = ""    // "full" | "diff" | "summary" | "spdx"
+	hashImages     bool     = false // Skip hashing during inspection
+	partitionKey   string   = ""    // "type-name" | "fs-uuid"
+	ignoreFields   []string         // Field paths left out of the comparison
 )
 
 // createCompareCommand creates the compare subcommand
@@ -42,6 +44,10 @@ func createCompareCommand() *cobra.Command {
 		"Output mode: full, diff, summary, or spdx (default: diff for text, full for json)")
 	compareCmd.Flags().BoolVar(&hashImages, "hash-images", false,
 		"Compute SHA256 hash of images during inspection (slower but enables binary identity verification")
+	compareCmd.Flags().StringVar(&partitionKey, "partition-key", imageinspect.PartitionKeyTypeName,
+		"How partitions are matched between images: type-name or fs-uuid")
+	compareCmd.Flags().StringSliceVar(&ignoreFields, "ignore", nil,
+		"Field paths expected to change between builds, left out of the comparison (e.g. filesystem.uuid,partition.guid)")
 	return compareCmd
 }
 
@@ -89,6 +95,15 @@ func executeCompare(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	switch partitionKey {
+	case "", imageinspect.PartitionKeyTypeName, imageinspect.PartitionKeyFSUUID:
+	default:
+		return fmt.Errorf("invalid --partition-key %q (expected type-name|fs-uuid)", partitionKey)
+	}
+	if err := imageinspect.ValidateIgnoreFields(ignoreFields); err != nil {
+		return fmt.Errorf("invalid --ignore: %w", err)
+	}
+
 	inspector := newInspector(hashImages)
 
 	image1, err1 := inspector.Inspect(imageFile1)
@@ -100,7 +115,8 @@ func executeCompare(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("image inspection failed: %v", err2)
 	}
 
-	compareResult := imageinspect.CompareImages(image1, image2)
+	compareResult := imageinspect.CompareImagesWithOptions(image1, image2,
+		imageinspect.CompareOptions{PartitionKey: partitionKey, Ignore: ignoreFields})
 
 	switch format {
 	case "json":
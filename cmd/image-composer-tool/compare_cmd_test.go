@@ -357,6 +357,58 @@ func TestCompareCommand_InvalidFormatErrors(t *testing.T) {
 	}
 }
 
+func TestCompareCommand_InvalidPartitionKeyErrors(t *testing.T) {
+	origNewInspector := newInspector
+	origOutFormat, origOutMode, origPartitionKey := outFormat, outMode, partitionKey
+	t.Cleanup(func() {
+		newInspector = origNewInspector
+		outFormat, outMode, partitionKey = origOutFormat, origOutMode, origPartitionKey
+	})
+
+	newInspector = func(hash bool) inspector {
+		return &fakeCompareInspector{imgByPath: map[string]*imageinspect.ImageSummary{
+			"a.raw": minimalImage("a.raw", 1),
+			"b.raw": minimalImage("b.raw", 1),
+		}}
+	}
+
+	cmd := &cobra.Command{}
+	outFormat = "json"
+	outMode = "diff"
+	partitionKey = "guid"
+
+	_, err := runCompareExecute(t, cmd, []string{"a.raw", "b.raw"})
+	if err == nil || !strings.Contains(err.Error(), "invalid --partition-key") {
+		t.Fatalf("expected invalid partition key error, got %v", err)
+	}
+}
+
+func TestCompareCommand_InvalidIgnoreFieldErrors(t *testing.T) {
+	origNewInspector := newInspector
+	origOutFormat, origOutMode, origIgnoreFields := outFormat, outMode, ignoreFields
+	t.Cleanup(func() {
+		newInspector = origNewInspector
+		outFormat, outMode, ignoreFields = origOutFormat, origOutMode, origIgnoreFields
+	})
+
+	newInspector = func(hash bool) inspector {
+		return &fakeCompareInspector{imgByPath: map[string]*imageinspect.ImageSummary{
+			"a.raw": minimalImage("a.raw", 1),
+			"b.raw": minimalImage("b.raw", 1),
+		}}
+	}
+
+	cmd := &cobra.Command{}
+	outFormat = "json"
+	outMode = "diff"
+	ignoreFields = []string{"filesystem.uuid", "build.timestamp"}
+
+	_, err := runCompareExecute(t, cmd, []string{"a.raw", "b.raw"})
+	if err == nil || !strings.Contains(err.Error(), "invalid --ignore") || !strings.Contains(err.Error(), "build.timestamp") {
+		t.Fatalf("expected invalid ignore field error, got %v", err)
+	}
+}
+
 func TestWriteCompareResult_MarshalError(t *testing.T) {
 	cmd := &cobra.Command{}
 	cmd.SetOut(&bytes.Buffer{})
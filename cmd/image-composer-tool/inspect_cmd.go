@@ -162,6 +162,7 @@ func writeInspectionResult(cmd *cobra.Command, summary *imageinspect.ImageSummar
 		return nil
 
 	case "json":
+		summary.Canonicalize()
 		var (
 			b   []byte
 			err error
@@ -178,6 +179,7 @@ func writeInspectionResult(cmd *cobra.Command, summary *imageinspect.ImageSummar
 		return nil
 
 	case "yaml":
+		summary.Canonicalize()
 		b, err := yaml.Marshal(summary)
 		if err != nil {
 			return fmt.Errorf("marshal yaml: %w", err)
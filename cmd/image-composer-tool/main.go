@@ -7,6 +7,7 @@ import (
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/security"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 	"github.com/spf13/cobra"
 )
 
@@ -140,6 +141,8 @@ func wrapWithLogging(cmd *cobra.Command) {
 	prev := cmd.PersistentPreRunE
 	cmd.PersistentPreRunE = func(c *cobra.Command, args []string) error {
 		applyLogOverrides(c)
+		// Debug runs also stream package installs and initramfs/UKI builds live
+		shell.StreamStageOutput = config.Global().Logging.Level == "debug"
 
 		logConfigurationDetails()
 		if prev != nil {
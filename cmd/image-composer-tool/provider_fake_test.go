@@ -30,6 +30,7 @@ func (f *fakeProvider) PostProcess(t *config.ImageTemplate, err error) error {
 	f.post = true
 	return nil
 }
+func (f *fakeProvider) Capabilities() provider.Capabilities { return provider.Capabilities{} }
 
 func TestProvider_Register_Get_AndLifecycle(t *testing.T) {
 	f := &fakeProvider{}
@@ -5,12 +5,14 @@ import (
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/network"
 	"github.com/spf13/cobra"
 )
 
 // Validate command flags
 var (
-	validateMerged bool = false // Whether to validate after merging with defaults
+	validateMerged     bool = false // Whether to validate after merging with defaults
+	validateCheckRepos bool = false // Whether to check that the package repositories are reachable
 )
 
 // createValidateCommand creates the validate subcommand
@@ -21,7 +23,11 @@ func createValidateCommand() *cobra.Command {
 		Long: `Validate an image template file for syntax and schema compliance.
 The template file must be in YAML format following the image template schema.
 By default, this validates the user template against the input schema.
-Use --merged to validate the template after merging with defaults.`,
+Use --merged to validate the template after merging with defaults.
+Use --check-repos to also check that the metadata of each of the
+packageRepositories of the template can be fetched; this needs network access.
+With --template-repo, TEMPLATE_FILE is the path of the template in that git
+repository, read from --template-ref.`,
 		Args:              cobra.ExactArgs(1),
 		RunE:              executeValidate,
 		ValidArgsFunction: templateFileCompletion,
@@ -30,6 +36,9 @@ Use --merged to validate the template after merging with defaults.`,
 	// Add flags
 	validateCmd.Flags().BoolVar(&validateMerged, "merged", false,
 		"Validate the template after merging with defaults")
+	validateCmd.Flags().BoolVar(&validateCheckRepos, "check-repos", false,
+		"Check that the package repositories of the template are reachable")
+	addTemplateSourceFlags(validateCmd)
 
 	return validateCmd
 }
@@ -37,8 +46,13 @@ Use --merged to validate the template after merging with defaults.`,
 // executeValidate handles the validate command execution logic
 func executeValidate(cmd *cobra.Command, args []string) error {
 	log := logger.Logger()
-	templateFile := args[0]
+	templateFile, cleanup, err := resolveTemplateFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
+	var validated *config.ImageTemplate
 	if validateMerged {
 		// Validate merged template (with defaults)
 		log.Infof("Validating merged template: %s", templateFile)
@@ -55,6 +69,7 @@ func executeValidate(cmd *cobra.Command, args []string) error {
 			mergedTemplate.Target.OS,
 			mergedTemplate.Target.Dist,
 			mergedTemplate.Target.Arch)
+		validated = mergedTemplate
 
 		// Show details about merged configuration
 		log.Infof("System Config: %s", mergedTemplate.SystemConfig.Name)
@@ -82,6 +97,7 @@ func executeValidate(cmd *cobra.Command, args []string) error {
 			template.Target.OS,
 			template.Target.Dist,
 			template.Target.Arch)
+		validated = template
 
 		// Show details about user configuration
 		log.Infof("System Config: %s", template.SystemConfig.Name)
@@ -98,5 +114,35 @@ func executeValidate(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if validateCheckRepos {
+		return checkRepoReachability(validated)
+	}
+	return nil
+}
+
+// checkRepoReachability probes the package repositories of template and
+// reports each of them, failing if any is unreachable.
+func checkRepoReachability(template *config.ImageTemplate) error {
+	log := logger.Logger()
+
+	results := template.CheckRepoReachability(network.GetSecureHTTPClient())
+	if len(results) == 0 {
+		log.Info("No package repositories to check")
+		return nil
+	}
+
+	unreachable := 0
+	for _, result := range results {
+		if result.Reachable() {
+			log.Infof("✓ Repository %s reachable: %s (%s)", result.Repo, result.MetadataURL, result.Status)
+			continue
+		}
+		unreachable++
+		log.Errorf("✗ Repository %s unreachable: %s: %v", result.Repo, result.MetadataURL, result.Err)
+	}
+	if unreachable > 0 {
+		return fmt.Errorf("validation failed: %d of %d package repositories unreachable", unreachable, len(results))
+	}
+	log.Infof("✓ All %d package repositories reachable", len(results))
 	return nil
 }
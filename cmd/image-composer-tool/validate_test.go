@@ -2,17 +2,24 @@ package main
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/spf13/cobra"
 )
 
 // resetValidateFlags resets validate command flags to their default values
 func resetValidateFlags() {
 	validateMerged = false
+	validateCheckRepos = false
+	templateRepo = ""
+	templateRef = ""
 }
 
 // TestCreateValidateCommand tests the validate command creation and structure
@@ -494,3 +501,160 @@ func TestValidateCommand_ErrorMessages(t *testing.T) {
 		})
 	}
 }
+
+// TestValidateCommand_CheckRepos tests that --check-repos fails validation
+// when a package repository is unreachable
+func TestValidateCommand_CheckRepos(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/good/repodata/repomd.xml" {
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		repoPath      string
+		checkRepos    bool
+		expectedError string
+	}{
+		{name: "ReachableRepo", repoPath: "/good", checkRepos: true},
+		{name: "UnreachableRepo", repoPath: "/missing", checkRepos: true, expectedError: "1 of 1 package repositories unreachable"},
+		{name: "UnreachableRepoWithoutFlag", repoPath: "/missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetValidateFlags()
+
+			templatePath := filepath.Join(t.TempDir(), "template.yml")
+			template := `image:
+  name: test-image
+  version: "1.0.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+packageRepositories:
+  - codename: extra
+    url: ` + server.URL + tt.repoPath + `
+    pkey: ` + server.URL + `/key.pub
+systemConfig:
+  name: test-config
+  packages:
+    - bash
+`
+			if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+				t.Fatalf("failed to create template: %v", err)
+			}
+
+			cmd := createValidateCommand()
+			args := []string{templatePath}
+			if tt.checkRepos {
+				args = append([]string{"--check-repos"}, args...)
+			}
+			cmd.SetArgs(args)
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("expected validation to pass, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got: %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+// TestValidateCommand_TemplateRepo tests that --template-repo and
+// --template-ref validate the template from the given ref of a git repository
+func TestValidateCommand_TemplateRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	defer resetValidateFlags()
+
+	origConfig := config.Global()
+	defer config.SetGlobal(origConfig)
+	currentConfig := *origConfig
+	currentConfig.TempDir = t.TempDir()
+	config.SetGlobal(&currentConfig)
+
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	root := t.TempDir()
+	repo := filepath.Join(root, "templates.git")
+	work := filepath.Join(root, "work")
+	git(root, "init", "-q", "--bare", repo)
+	git(root, "init", "-q", "-b", "main", work)
+	for i, imageType := range []string{"raw", "bogus"} {
+		template := `image:
+  name: test-image
+  version: "1.0.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: ` + imageType + `
+systemConfig:
+  name: test-config
+  packages:
+    - bash
+`
+		if err := os.WriteFile(filepath.Join(work, "template.yml"), []byte(template), 0644); err != nil {
+			t.Fatalf("failed to create template: %v", err)
+		}
+		git(work, "add", "-A")
+		git(work, "commit", "-q", "-m", imageType)
+		if i == 0 {
+			git(work, "tag", "good")
+		}
+	}
+	git(work, "push", "-q", repo, "main", "good")
+
+	tests := []struct {
+		name          string
+		args          []string
+		expectedError string
+	}{
+		{name: "ValidRef", args: []string{"--template-repo", repo, "--template-ref", "good", "template.yml"}},
+		{name: "InvalidRef", args: []string{"--template-repo", repo, "--template-ref", "main", "template.yml"}, expectedError: "validation failed"},
+		{name: "RefWithoutRepo", args: []string{"--template-ref", "good", "template.yml"}, expectedError: "--template-ref requires --template-repo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetValidateFlags()
+			cmd := createValidateCommand()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("expected validation to pass, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got: %v", tt.expectedError, err)
+			}
+		})
+	}
+}
@@ -155,6 +155,9 @@ func install(template *config.ImageTemplate, configDir, localRepo string) error
 		return fmt.Errorf("failed to update system packages: %w", err)
 	}
 
+	if err := imagedisc.ApplyABLayout(&template.Disk); err != nil {
+		return fmt.Errorf("failed to apply A/B disk layout: %w", err)
+	}
 	diskInfo := template.GetDiskConfig()
 	diskPath := template.Disk.Path
 	if diskPath == "" {
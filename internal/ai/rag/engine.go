@@ -27,8 +27,17 @@ type Engine struct {
 	templateCount int
 }
 
-// NewEngine creates a new RAG engine with the given configuration.
+// NewEngine creates a new RAG engine with the given configuration. The
+// templates directory, and the cache directory when the cache is enabled,
+// must be set: the engine never falls back to the current directory.
 func NewEngine(config ai.Config) (*Engine, error) {
+	if config.TemplatesDir == "" {
+		return nil, fmt.Errorf("templates directory is required")
+	}
+	if config.Cache.Enabled && config.Cache.Dir == "" {
+		return nil, fmt.Errorf("cache directory is required when the cache is enabled")
+	}
+
 	// Create embedding provider based on config
 	var embedProvider provider.EmbeddingProvider
 	var chatProvider provider.ChatProvider
@@ -81,7 +90,7 @@ func (e *Engine) Initialize(ctx context.Context) error {
 	// Scan templates
 	templates, err := template.ScanTemplates(e.templatesDir)
 	if err != nil {
-		return fmt.Errorf("failed to scan templates: %w", err)
+		return fmt.Errorf("failed to scan templates in %s: %w", e.templatesDir, err)
 	}
 
 	if len(templates) == 0 {
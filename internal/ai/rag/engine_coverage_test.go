@@ -2,8 +2,11 @@ package rag
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/ai"
@@ -489,3 +492,113 @@ systemConfig:
 		t.Logf("Initialize failed (expected if Ollama not running): %v", err)
 	}
 }
+
+// TestNewEngineRequiresPaths tests that engine creation fails without the
+// templates directory, or without the cache directory when caching.
+func TestNewEngineRequiresPaths(t *testing.T) {
+	config := ai.DefaultConfig()
+	config.TemplatesDir = ""
+	config.Cache.Enabled = false
+
+	_, err := NewEngine(config)
+	if err == nil || !strings.Contains(err.Error(), "templates directory is required") {
+		t.Errorf("expected templates directory error, got %v", err)
+	}
+
+	config.TemplatesDir = t.TempDir()
+	config.Cache.Enabled = true
+	config.Cache.Dir = ""
+
+	_, err = NewEngine(config)
+	if err == nil || !strings.Contains(err.Error(), "cache directory is required") {
+		t.Errorf("expected cache directory error, got %v", err)
+	}
+}
+
+// TestInitializeWithExplicitPaths tests that the engine indexes the templates
+// of the configured directory and caches their embeddings in the configured
+// cache directory, and nowhere else.
+func TestInitializeWithExplicitPaths(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"embedding": [0.1, 0.2, 0.3]}`))
+	}))
+	defer ollama.Close()
+
+	workDir := t.TempDir()
+	t.Chdir(workDir)
+
+	templatesDir := filepath.Join(t.TempDir(), "templates")
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("failed to create templates dir: %v", err)
+	}
+	templateContent := `image:
+  name: explicit-template
+  version: "1.0.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  packages:
+    - vim
+`
+	if err := os.WriteFile(filepath.Join(templatesDir, "explicit.yml"), []byte(templateContent), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	config := ai.DefaultConfig()
+	config.Provider = ai.ProviderOllama
+	config.Ollama.BaseURL = ollama.URL
+	config.TemplatesDir = templatesDir
+	config.Cache.Enabled = true
+	config.Cache.Dir = cacheDir
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	if err := engine.Initialize(context.Background()); err != nil {
+		t.Fatalf("failed to initialize engine: %v", err)
+	}
+
+	if stats := engine.GetStats(); stats.TemplateCount != 1 {
+		t.Errorf("expected 1 template indexed from %s, got %d", templatesDir, stats.TemplateCount)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "embeddings", "index.json")); err != nil {
+		t.Errorf("expected embeddings cached in %s: %v", cacheDir, err)
+	}
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		t.Fatalf("failed to read working directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected nothing written to the working directory, found %d entries", len(entries))
+	}
+}
+
+// TestInitializeWithMissingTemplatesDir tests that the error names the
+// missing templates directory.
+func TestInitializeWithMissingTemplatesDir(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	config := ai.DefaultConfig()
+	config.Provider = ai.ProviderOllama
+	config.Cache.Enabled = false
+	config.TemplatesDir = missing
+
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+
+	err = engine.Initialize(context.Background())
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("expected error naming %s, got %v", missing, err)
+	}
+}
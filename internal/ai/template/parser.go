@@ -63,6 +63,15 @@ type TemplateInfo struct {
 	// Packages is the list of packages from systemConfig.packages
 	Packages []string
 
+	// KernelVersion is the version from systemConfig.kernel.version
+	KernelVersion string
+
+	// KernelCmdline is the cmdline from systemConfig.kernel.cmdline
+	KernelCmdline string
+
+	// DiskName is the name from disk.name
+	DiskName string
+
 	// Metadata is the optional metadata section
 	Metadata Metadata
 
@@ -83,10 +92,17 @@ type rawTemplate struct {
 		Arch      string `yaml:"arch"`
 		ImageType string `yaml:"imageType"`
 	} `yaml:"target"`
+	Disk struct {
+		Name string `yaml:"name"`
+	} `yaml:"disk"`
 	SystemConfig struct {
 		Name        string   `yaml:"name"`
 		Description string   `yaml:"description"`
 		Packages    []string `yaml:"packages"`
+		Kernel      struct {
+			Version string `yaml:"version"`
+			Cmdline string `yaml:"cmdline"`
+		} `yaml:"kernel"`
 	} `yaml:"systemConfig"`
 }
 
@@ -103,17 +119,20 @@ func ParseTemplate(filePath string) (*TemplateInfo, error) {
 	}
 
 	info := &TemplateInfo{
-		FilePath:     filePath,
-		FileName:     filepath.Base(filePath),
-		ImageName:    raw.Image.Name,
-		ImageVersion: raw.Image.Version,
-		Distribution: raw.Target.Dist,
-		Architecture: raw.Target.Arch,
-		OS:           raw.Target.OS,
-		ImageType:    raw.Target.ImageType,
-		Packages:     raw.SystemConfig.Packages,
-		Metadata:     raw.Metadata,
-		RawContent:   content,
+		FilePath:      filePath,
+		FileName:      filepath.Base(filePath),
+		ImageName:     raw.Image.Name,
+		ImageVersion:  raw.Image.Version,
+		Distribution:  raw.Target.Dist,
+		Architecture:  raw.Target.Arch,
+		OS:            raw.Target.OS,
+		ImageType:     raw.Target.ImageType,
+		Packages:      raw.SystemConfig.Packages,
+		KernelVersion: raw.SystemConfig.Kernel.Version,
+		KernelCmdline: raw.SystemConfig.Kernel.Cmdline,
+		DiskName:      raw.Disk.Name,
+		Metadata:      raw.Metadata,
+		RawContent:    content,
 	}
 
 	// If metadata description is empty, use systemConfig description
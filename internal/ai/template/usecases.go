@@ -0,0 +1,106 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// UseCase is a use case listed in the metadata of one or more templates,
+// with the templates curated for it.
+type UseCase struct {
+	// Name is the use case as first spelled in a template
+	Name string
+
+	// Templates are the templates listing the use case, sorted by file name
+	Templates []*TemplateInfo
+}
+
+// Packages returns the packages of all the templates of the use case,
+// sorted and without duplicates.
+func (u UseCase) Packages() []string {
+	seen := make(map[string]bool)
+	var packages []string
+	for _, t := range u.Templates {
+		for _, pkg := range t.Packages {
+			if !seen[pkg] {
+				seen[pkg] = true
+				packages = append(packages, pkg)
+			}
+		}
+	}
+	sort.Strings(packages)
+	return packages
+}
+
+// ListUseCases returns the use cases listed in the metadata of templates,
+// sorted by name. Use cases differing only in case and surrounding spaces are
+// the same use case.
+func ListUseCases(templates []*TemplateInfo) []UseCase {
+	byKey := make(map[string]*UseCase)
+	for _, t := range templates {
+		for _, name := range t.Metadata.UseCases {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			key := strings.ToLower(name)
+			useCase, ok := byKey[key]
+			if !ok {
+				useCase = &UseCase{Name: name}
+				byKey[key] = useCase
+			}
+			useCase.Templates = append(useCase.Templates, t)
+		}
+	}
+
+	useCases := make([]UseCase, 0, len(byKey))
+	for _, useCase := range byKey {
+		sort.Slice(useCase.Templates, func(i, j int) bool {
+			return useCase.Templates[i].FileName < useCase.Templates[j].FileName
+		})
+		useCases = append(useCases, *useCase)
+	}
+	sort.Slice(useCases, func(i, j int) bool {
+		return strings.ToLower(useCases[i].Name) < strings.ToLower(useCases[j].Name)
+	})
+	return useCases
+}
+
+// WriteUseCases writes useCases to w: each use case with its templates, their
+// target, packages, and kernel and disk settings. Settings a template leaves
+// to the OS defaults are shown as "default".
+func WriteUseCases(w io.Writer, useCases []UseCase) error {
+	orDefault := func(value string) string {
+		if value == "" {
+			return "default"
+		}
+		return value
+	}
+
+	for i, useCase := range useCases {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s (templates: %d, packages: %d)\n",
+			useCase.Name, len(useCase.Templates), len(useCase.Packages())); err != nil {
+			return err
+		}
+		for _, t := range useCase.Templates {
+			packages := "default"
+			if len(t.Packages) > 0 {
+				packages = strings.Join(t.Packages, ", ")
+			}
+			_, err := fmt.Fprintf(w, "  %s: %s %s %s %s\n    packages: %s\n    kernel: %s, cmdline: %s\n    disk: %s\n",
+				t.FileName, t.OS, t.Distribution, t.Architecture, t.ImageType, packages,
+				orDefault(t.KernelVersion), orDefault(t.KernelCmdline), orDefault(t.DiskName))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeUseCaseTemplates(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	templates := map[string]string{
+		"edge-raw.yml": `
+metadata:
+  use_cases:
+    - "Edge computing"
+    - "IoT gateway"
+image:
+  name: edge-raw
+target:
+  os: wind-river-elxr
+  dist: elxr12
+  arch: x86_64
+  imageType: raw
+disk:
+  name: Default_Raw
+systemConfig:
+  packages:
+    - openssh-server
+    - docker-ce
+  kernel:
+    version: "6.12"
+    cmdline: "console=ttyS0,115200"
+`,
+		"edge-iso.yml": `
+metadata:
+  use_cases:
+    - " edge computing "
+image:
+  name: edge-iso
+target:
+  os: edge-microvisor-toolkit
+  dist: emt3
+  arch: x86_64
+  imageType: iso
+systemConfig:
+  packages:
+    - openssh-server
+    - vim
+`,
+		"plain.yml": `
+image:
+  name: plain
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+`,
+	}
+	for name, content := range templates {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write template %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestListUseCases(t *testing.T) {
+	templates, err := ScanTemplates(writeUseCaseTemplates(t))
+	if err != nil {
+		t.Fatalf("ScanTemplates failed: %v", err)
+	}
+
+	useCases := ListUseCases(templates)
+	if len(useCases) != 2 {
+		t.Fatalf("expected 2 use cases, got %d: %+v", len(useCases), useCases)
+	}
+
+	edge := useCases[0]
+	// edge-iso.yml is scanned first, so its spelling is kept
+	if edge.Name != "edge computing" {
+		t.Errorf("expected the edge computing use case first, got %q", edge.Name)
+	}
+	var files []string
+	for _, tmpl := range edge.Templates {
+		files = append(files, tmpl.FileName)
+	}
+	if !slices.Equal(files, []string{"edge-iso.yml", "edge-raw.yml"}) {
+		t.Errorf("expected both edge templates, got %v", files)
+	}
+	if got, want := edge.Packages(), []string{"docker-ce", "openssh-server", "vim"}; !slices.Equal(got, want) {
+		t.Errorf("expected packages %v, got %v", want, got)
+	}
+
+	gateway := useCases[1]
+	if gateway.Name != "IoT gateway" || len(gateway.Templates) != 1 {
+		t.Errorf("expected the IoT gateway use case with one template, got %+v", gateway)
+	}
+	raw := gateway.Templates[0]
+	if raw.KernelVersion != "6.12" || raw.KernelCmdline != "console=ttyS0,115200" || raw.DiskName != "Default_Raw" {
+		t.Errorf("expected kernel and disk settings of edge-raw.yml, got %q %q %q",
+			raw.KernelVersion, raw.KernelCmdline, raw.DiskName)
+	}
+}
+
+func TestWriteUseCases(t *testing.T) {
+	templates, err := ScanTemplates(writeUseCaseTemplates(t))
+	if err != nil {
+		t.Fatalf("ScanTemplates failed: %v", err)
+	}
+
+	var out strings.Builder
+	if err := WriteUseCases(&out, ListUseCases(templates)); err != nil {
+		t.Fatalf("WriteUseCases failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"edge computing (templates: 2, packages: 3)\n",
+		"  edge-iso.yml: edge-microvisor-toolkit emt3 x86_64 iso\n    packages: openssh-server, vim\n    kernel: default, cmdline: default\n    disk: default\n",
+		"IoT gateway (templates: 1, packages: 2)\n  edge-raw.yml: wind-river-elxr elxr12 x86_64 raw\n    packages: openssh-server, docker-ce\n    kernel: 6.12, cmdline: console=ttyS0,115200\n    disk: Default_Raw\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "plain.yml") {
+		t.Errorf("expected templates without use cases to be left out, got:\n%s", out.String())
+	}
+}
@@ -64,7 +64,6 @@ type ChrootenvConfig struct {
 }
 
 func NewChrootBuilder(targetOs string, targetDist string, targetArch string) (*ChrootBuilder, error) {
-	var targetOsConfig map[string]interface{}
 	if targetOs == "" || targetDist == "" || targetArch == "" {
 		return nil, fmt.Errorf("target OS, distribution, and architecture must be specified")
 	}
@@ -72,13 +71,23 @@ func NewChrootBuilder(targetOs string, targetDist string, targetArch string) (*C
 	if err != nil {
 		return nil, fmt.Errorf("failed to get global work directory: %w", err)
 	}
+	return NewChrootBuilderInWorkDir(globalWorkDir, targetOs, targetDist, targetArch)
+}
+
+// NewChrootBuilderInWorkDir creates a chroot builder that builds below workDir
+// rather than the global work directory. The package cache stays shared.
+func NewChrootBuilderInWorkDir(workDir, targetOs, targetDist, targetArch string) (*ChrootBuilder, error) {
+	var targetOsConfig map[string]interface{}
+	if targetOs == "" || targetDist == "" || targetArch == "" {
+		return nil, fmt.Errorf("target OS, distribution, and architecture must be specified")
+	}
 	globalCache, err := config.CacheDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get global cache dir: %w", err)
 	}
 
 	providerId := system.GetProviderId(targetOs, targetDist, targetArch)
-	chrootBuildDir := filepath.Join(globalWorkDir, providerId, "chrootbuild")
+	chrootBuildDir := filepath.Join(workDir, providerId, "chrootbuild")
 	chrootPkgCacheDir := filepath.Join(globalCache, "pkgCache", providerId)
 
 	targetOsConfigDir, err := config.GetTargetOsConfigDir(targetOs, targetDist)
@@ -8,11 +8,14 @@ import (
 
 	"github.com/open-edge-platform/image-composer-tool/internal/chroot/chrootbuild"
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/debutils"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/compression"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/mount"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/slice"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
 )
 
@@ -48,8 +51,8 @@ type ChrootEnvInterface interface {
 	RefreshLocalCacheRepo() error
 	InitChrootEnv(targetOs, targetDist, targetArch string) error
 	CleanupChrootEnv(targetOs, targetDist, targetArch string) error
-	TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error
-	AptInstallPackage(packageName, installRoot string, repoSrcList []string) error
+	TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error
+	AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error
 	UpdateSystemPkgs(template *config.ImageTemplate) error
 }
 
@@ -66,23 +69,34 @@ func NewChrootEnv(targetOs, targetDist, targetArch string) (*ChrootEnv, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get global work directory: %v", err)
 	}
+	return NewChrootEnvInWorkDir(globalWorkDir, targetOs, targetDist, targetArch)
+}
+
+// NewChrootEnvInWorkDir creates the chroot environment of the target below
+// workDir rather than the global work directory, so that builds using
+// distinct work directories do not share any chroot or image build paths.
+func NewChrootEnvInWorkDir(workDir, targetOs, targetDist, targetArch string) (*ChrootEnv, error) {
+	if !filepath.IsAbs(workDir) {
+		return nil, fmt.Errorf("work directory must be an absolute path, got %q", workDir)
+	}
 	providerId := system.GetProviderId(targetOs, targetDist, targetArch)
-	chrootEnvRoot := filepath.Join(globalWorkDir, providerId, "chrootenv")
+	chrootEnvRoot := filepath.Join(workDir, providerId, "chrootenv")
 	if _, err := os.Stat(chrootEnvRoot); os.IsNotExist(err) {
 		if err = os.MkdirAll(chrootEnvRoot, 0700); err != nil {
 			return nil, fmt.Errorf("failed to create chroot environment root directory: %w", err)
 		}
 	}
 
-	chrootBuilder, err := chrootbuild.NewChrootBuilder(targetOs, targetDist, targetArch)
+	chrootBuilder, err := chrootbuild.NewChrootBuilderInWorkDir(workDir, targetOs, targetDist, targetArch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create chroot builder: %w", err)
 	}
 
 	return &ChrootEnv{
-		ChrootEnvRoot: chrootEnvRoot,
-		ChrootBuilder: chrootBuilder,
-		TargetOs:      targetOs,
+		ChrootEnvRoot:       chrootEnvRoot,
+		ChrootImageBuildDir: chrootImageBuildDir(chrootEnvRoot),
+		ChrootBuilder:       chrootBuilder,
+		TargetOs:            targetOs,
 	}, nil
 }
 
@@ -370,23 +384,41 @@ func (chrootEnv *ChrootEnv) createChrootRepo(targetOs, targetDist string) error
 		}
 	}
 
-	// Copy local repo config file to chroot environment
+	// Write the local repo config to chroot environment, the Debian suite
+	// being taken from the target OS config
 	localRepoConfigPath := filepath.Join(targetOsConfigDir, "chrootenvconfigs", repoConfigFile)
 	if _, err := os.Stat(localRepoConfigPath); os.IsNotExist(err) {
 		return fmt.Errorf("chroot repo config file does not exist: %s", localRepoConfigPath)
 	}
+	var suite string
+	if pkgType == "deb" {
+		suite = debutils.DetectDebSuiteFromSourcesList(localRepoConfigPath)
+	}
+	localRepoConfig, err := LocalRepoConfig(pkgType, suite)
+	if err != nil {
+		return err
+	}
 
 	repoConfigDistFile := filepath.Join(repoConfigDir, repoConfigFile)
-	if err := chrootEnv.CopyFileFromHostToChroot(localRepoConfigPath, repoConfigDistFile); err != nil {
-		return fmt.Errorf("failed to copy local.repo: %w", err)
+	repoConfigDistHostPath, err := chrootEnv.GetChrootEnvHostPath(repoConfigDistFile)
+	if err != nil {
+		return fmt.Errorf("failed to get chroot host path for %s: %w", repoConfigDistFile, err)
+	}
+	if err := file.Write(localRepoConfig, repoConfigDistHostPath); err != nil {
+		return fmt.Errorf("failed to write %s: %w", repoConfigFile, err)
 	}
 
 	return nil
 }
 
+// chrootImageBuildDir returns the directory images are built in within the
+// chroot environment at chrootEnvRoot.
+func chrootImageBuildDir(chrootEnvRoot string) string {
+	return filepath.Join(chrootEnvRoot, "workspace", "imagebuild")
+}
+
 func (chrootEnv *ChrootEnv) initChrootWorkspace() error {
-	chrootWorkspace := filepath.Join(chrootEnv.ChrootEnvRoot, "workspace")
-	chrootEnv.ChrootImageBuildDir = filepath.Join(chrootWorkspace, "imagebuild")
+	chrootEnv.ChrootImageBuildDir = chrootImageBuildDir(chrootEnv.ChrootEnvRoot)
 	if _, err := os.Stat(chrootEnv.ChrootImageBuildDir); os.IsNotExist(err) {
 		if _, err = shell.ExecCmd("mkdir -p "+chrootEnv.ChrootImageBuildDir, true, shell.HostPath, nil); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", chrootEnv.ChrootImageBuildDir, err)
@@ -456,6 +488,7 @@ func (chrootEnv *ChrootEnv) InitChrootEnv(targetOs, targetDist, targetArch strin
 
 func (chrootEnv *ChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string) error {
 	log := logger.Logger()
+	defer shell.BeginCleanup()()
 	if _, err := os.Stat(chrootEnv.ChrootEnvRoot); err == nil {
 		if err := system.StopGPGComponents(chrootEnv.ChrootEnvRoot); err != nil {
 			return fmt.Errorf("failed to stop GPG components in chroot environment: %w", err)
@@ -509,14 +542,16 @@ func (chrootEnv *ChrootEnv) getPackageManagerCmd() string {
 	return "tdnf"
 }
 
-// buildInstallCmd builds the package installation command based on the package manager
-func (chrootEnv *ChrootEnv) buildInstallCmd(packageName, chrootInstallRoot string, repositoryIDList []string) string {
+// buildInstallCmd builds the package installation command based on the package manager,
+// with the extra installOptions appended. Signature checks are left to the
+// configuration of each repository, see LocalRepoConfig.
+func (chrootEnv *ChrootEnv) buildInstallCmd(packageName, chrootInstallRoot string, repositoryIDList, installOptions []string) string {
 	pkgManager := chrootEnv.getPackageManagerCmd()
 	releaseVersion := chrootEnv.GetTargetOsReleaseVersion()
 
 	if pkgManager == "dnf" {
 		// dnf syntax for RCD builds (similar to tdnf but with dnf)
-		installCmd := fmt.Sprintf("dnf install %s -y --nogpgcheck --installroot %s --setopt=reposdir=%s",
+		installCmd := fmt.Sprintf("dnf install %s -y --installroot %s --setopt=reposdir=%s",
 			packageName, chrootInstallRoot, RPMRepoConfigDir)
 
 		// Add repository configuration for dnf
@@ -526,10 +561,10 @@ func (chrootEnv *ChrootEnv) buildInstallCmd(packageName, chrootInstallRoot strin
 				installCmd += " --enablerepo=" + repoID
 			}
 		}
-		return installCmd
+		return appendInstallOptions(installCmd, installOptions)
 	} else {
 		// tdnf original syntax
-		installCmd := fmt.Sprintf("tdnf install %s --releasever %s --setopt reposdir=%s --nogpgcheck --assumeyes --installroot %s",
+		installCmd := fmt.Sprintf("tdnf install %s --releasever %s --setopt reposdir=%s --assumeyes --installroot %s",
 			packageName, releaseVersion, RPMRepoConfigDir, chrootInstallRoot)
 
 		// Add repository configuration for tdnf
@@ -539,25 +574,79 @@ func (chrootEnv *ChrootEnv) buildInstallCmd(packageName, chrootInstallRoot strin
 				installCmd += " --enablerepo=" + repoID
 			}
 		}
-		return installCmd
+		return appendInstallOptions(installCmd, installOptions)
+	}
+}
+
+// appendInstallOptions appends the extra package manager options of the
+// template, systemConfig.packageManagerOptions, to installCmd.
+func appendInstallOptions(installCmd string, installOptions []string) string {
+	for _, option := range installOptions {
+		installCmd += " " + option
 	}
+	return installCmd
 }
 
-func (chrootEnv *ChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+// TdnfInstallPackage installs packageName, or several space-separated
+// packages in one transaction, into installRoot with tdnf or dnf.
+func (chrootEnv *ChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	chrootInstallRoot, err := chrootEnv.GetChrootEnvPath(installRoot)
 	if err != nil {
 		return fmt.Errorf("failed to get chroot environment path for install root %s: %w", installRoot, err)
 	}
 
-	installCmd := chrootEnv.buildInstallCmd(packageName, chrootInstallRoot, repositoryIDList)
+	installCmd := chrootEnv.buildInstallCmd(packageName, chrootInstallRoot, repositoryIDList, installOptions)
 
-	if _, err := shell.ExecCmdWithStream(installCmd, true, chrootEnv.ChrootEnvRoot, nil); err != nil {
-		return fmt.Errorf("failed to install package %s: %w", packageName, err)
+	// Installing a package again is harmless, so a stuck install can be retried
+	if output, err := shell.WithRetry(func() (string, error) {
+		return shell.ExecCmdWithStreamStage("install", installCmd, true, chrootEnv.ChrootEnvRoot, nil)
+	}); err != nil {
+		return &PackageInstallError{Package: packageName, Output: output, Err: err}
 	}
 
 	return nil
 }
 
+// InstallOutputTailLines is the number of lines of package manager output
+// included in a PackageInstallError message.
+const InstallOutputTailLines = 20
+
+// PackageInstallError is returned when the package manager fails to install
+// a package. It keeps the whole output of the install command, which usually
+// tells why, such as a broken dependency or a full disk, and shows its last
+// InstallOutputTailLines lines in its message.
+type PackageInstallError struct {
+	Package string
+	Output  string
+	Err     error
+}
+
+func (e *PackageInstallError) Error() string {
+	msg := fmt.Sprintf("failed to install package %s: %v", e.Package, e.Err)
+	if tail := e.OutputTail(InstallOutputTailLines); tail != "" {
+		msg += "\nlast lines of the install output:\n" + tail
+	}
+	return msg
+}
+
+func (e *PackageInstallError) Unwrap() error {
+	return e.Err
+}
+
+// OutputTail returns the last n non-empty lines of the install output.
+func (e *PackageInstallError) OutputTail(n int) string {
+	var lines []string
+	for _, line := range strings.Split(e.Output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
 func CleanDebName(packageName string) string {
 	packageName = strings.Replace(packageName, "_", "=", 1)
 	if idx := strings.LastIndex(packageName, "_"); idx != -1 {
@@ -570,8 +659,14 @@ func CleanDebName(packageName string) string {
 	return packageName
 }
 
-func (chrootEnv *ChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
-	packageName = CleanDebName(packageName)
+// AptInstallPackage installs packageName, or several space-separated
+// packages in one transaction, into installRoot with apt-get.
+func (chrootEnv *ChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
+	pkgs := strings.Fields(packageName)
+	for i, pkg := range pkgs {
+		pkgs[i] = CleanDebName(pkg)
+	}
+	packageName = strings.Join(pkgs, " ")
 	installCmd := fmt.Sprintf("apt-get install -y --no-install-recommends %s", packageName)
 
 	if len(repoSrcList) > 0 {
@@ -579,6 +674,7 @@ func (chrootEnv *ChrootEnv) AptInstallPackage(packageName, installRoot string, r
 			installCmd += fmt.Sprintf(" -o Dir::Etc::sourcelist=%s", repoSrc)
 		}
 	}
+	installCmd = appendInstallOptions(installCmd, installOptions)
 
 	// Set environment variables to ensure non-interactive installation
 	envVars := []string{
@@ -587,11 +683,10 @@ func (chrootEnv *ChrootEnv) AptInstallPackage(packageName, installRoot string, r
 		"DEBCONF_NOWARNINGS=yes",
 	}
 
-	output, err := shell.ExecCmdWithStream(installCmd, true, installRoot, envVars)
+	output, err := shell.ExecCmdWithStreamStage("install", installCmd, true, installRoot, envVars)
 	if err != nil {
 		log.Errorf("Failed to install package %s: %v", packageName, err)
-		log.Errorf("Full apt-get output for %s:\n%s", packageName, output)
-		return fmt.Errorf("failed to install package %s: %w\napt output:\n%s", packageName, err, output)
+		return &PackageInstallError{Package: packageName, Output: output, Err: err}
 	}
 
 	return nil
@@ -632,6 +727,23 @@ func (chrootEnv *ChrootEnv) UpdateSystemPkgs(template *config.ImageTemplate) err
 		// To do: search for exact kernel version package name
 		template.KernelPkgList = kernelConfig.Packages
 	}
+	// The selected kernel package is always installed, with its version pin
+	if kernelConfig.Package != "" {
+		kernelPkgName := ospackage.ParsePackageSpec(kernelConfig.Package).Name
+		kernelPkgList := []string{kernelConfig.Package}
+		for _, pkg := range template.KernelPkgList {
+			if ospackage.ParsePackageSpec(pkg).Name != kernelPkgName {
+				kernelPkgList = append(kernelPkgList, pkg)
+			}
+		}
+		template.KernelPkgList = kernelPkgList
+	}
+	// Firmware and DKMS module packages are installed with the kernel
+	for _, pkg := range append(append([]string{}, kernelConfig.Firmware...), kernelConfig.DKMSModules...) {
+		if !slice.Contains(template.KernelPkgList, pkg) {
+			template.KernelPkgList = append(template.KernelPkgList, pkg)
+		}
+	}
 
 	return nil
 }
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	chroot "github.com/open-edge-platform/image-composer-tool/internal/chroot"
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
@@ -440,7 +444,7 @@ func TestChrootEnv_TdnfInstallPackage_ErrorPath(t *testing.T) {
 	chrootEnv := &chroot.ChrootEnv{ChrootEnvRoot: t.TempDir(), ChrootBuilder: mockBuilder}
 	// Simulate GetChrootEnvPath error
 	chrootEnv.ChrootEnvRoot = ""
-	if err := chrootEnv.TdnfInstallPackage("pkg", "/badroot", nil); err == nil {
+	if err := chrootEnv.TdnfInstallPackage("pkg", "/badroot", nil, nil); err == nil {
 		t.Errorf("expected error for bad install root, got nil")
 	}
 }
@@ -448,7 +452,7 @@ func TestChrootEnv_TdnfInstallPackage_ErrorPath(t *testing.T) {
 func TestChrootEnv_AptInstallPackage_ErrorPath(t *testing.T) {
 	chrootEnv := &chroot.ChrootEnv{ChrootEnvRoot: t.TempDir()}
 	// Simulate error from shell.ExecCmdWithStream
-	if err := chrootEnv.AptInstallPackage("pkg", "/badroot", nil); err == nil {
+	if err := chrootEnv.AptInstallPackage("pkg", "/badroot", nil, nil); err == nil {
 		t.Errorf("expected error for bad install root, got nil")
 	}
 }
@@ -732,6 +736,71 @@ func TestChrootEnv_CleanupChrootEnv(t *testing.T) {
 	}
 }
 
+// cleanupExecutor records the commands that the mock executor ran without
+// an error.
+type cleanupExecutor struct {
+	*shell.MockExecutor
+	ran []string
+}
+
+func (e *cleanupExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	output, err := e.MockExecutor.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+	if err == nil {
+		e.ran = append(e.ran, cmdStr)
+	}
+	return output, err
+}
+
+func (e *cleanupExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	output, err := e.MockExecutor.ExecCmdSilent(cmdStr, sudo, chrootPath, envVal)
+	if err == nil {
+		e.ran = append(e.ran, cmdStr)
+	}
+	return output, err
+}
+
+func TestChrootEnv_CleanupChrootEnvAfterBuildDeadline(t *testing.T) {
+	tempDir := t.TempDir()
+	chrootEnv := &chroot.ChrootEnv{
+		ChrootEnvRoot: tempDir,
+		ChrootBuilder: &mockChrootBuilder{tempDir: tempDir, pkgType: "deb"},
+	}
+	for _, path := range []string{"usr/bin/bash", "repo-config-backup/local.list", "etc/apt/sources.list.d/cdrom.list"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, filepath.Dir(path)), 0755); err != nil {
+			t.Fatalf("Failed to create test directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, path), []byte("test\n"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	originalShell, originalDeadline := shell.Default, shell.BuildDeadline
+	defer func() { shell.Default, shell.BuildDeadline = originalShell, originalDeadline }()
+	executor := &cleanupExecutor{MockExecutor: shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "command -v gpgconf", Output: "/usr/bin/gpgconf"},
+		{Pattern: "gpgconf --list-components", Output: "gpg-agent:GPG Agent"},
+		{Pattern: "gpgconf --kill", Output: ""},
+		{Pattern: "^mount$", Output: "proc on " + filepath.Join(tempDir, "proc") + " type proc (rw)"},
+		{Pattern: "umount ", Output: ""},
+		{Pattern: "rm -", Output: ""},
+		{Pattern: "cp -r", Output: ""},
+	})}
+	shell.Default = executor
+	shell.BuildDeadline = time.Now().Add(-time.Minute)
+
+	if err := chrootEnv.CleanupChrootEnv("os", "dist", "arch"); err != nil {
+		t.Fatalf("Expected the cleanup to run after the build deadline, got: %v", err)
+	}
+	for _, prefix := range []string{"gpgconf --kill gpg-agent", "mount", "umount " + filepath.Join(tempDir, "proc"), "rm -f ", "cp -r ", "rm -rf "} {
+		if !slices.ContainsFunc(executor.ran, func(cmd string) bool { return strings.HasPrefix(cmd, prefix) }) {
+			t.Errorf("Expected %q to run after the build deadline, ran: %v", prefix, executor.ran)
+		}
+	}
+	if _, err := shell.ExecCmd("mount", false, shell.HostPath, nil); !errors.Is(err, shell.ErrBuildDeadline) {
+		t.Errorf("Expected commands to be refused again after the cleanup, got: %v", err)
+	}
+}
+
 func TestChrootEnv_UpdateSystemPkgs(t *testing.T) {
 	mockBuilder := &mockChrootBuilder{
 		packageList: []string{"essential-pkg"},
@@ -812,6 +881,69 @@ func TestChrootEnv_UpdateSystemPkgs(t *testing.T) {
 	}
 }
 
+func TestChrootEnv_UpdateSystemPkgsKernelPackage(t *testing.T) {
+	mockBuilder := &mockChrootBuilder{
+		packageList: []string{"essential-pkg"},
+		tempDir:     t.TempDir(),
+	}
+	chrootEnv := &chroot.ChrootEnv{
+		ChrootBuilder: mockBuilder,
+	}
+
+	template := &config.ImageTemplate{
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{
+				Provider: "systemd-boot",
+				BootType: "efi",
+			},
+			Kernel: config.KernelConfig{
+				Package:  "kernel-rt=6.6.44-1.azl3",
+				Packages: []string{"kernel-rt", "kernel-drivers-gpu"},
+			},
+		},
+	}
+
+	if err := chrootEnv.UpdateSystemPkgs(template); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"kernel-rt=6.6.44-1.azl3", "kernel-drivers-gpu"}
+	if !reflect.DeepEqual(template.KernelPkgList, expected) {
+		t.Errorf("Expected kernel packages %v, got %v", expected, template.KernelPkgList)
+	}
+}
+
+func TestChrootEnv_UpdateSystemPkgsFirmwareAndDKMS(t *testing.T) {
+	mockBuilder := &mockChrootBuilder{
+		packageList: []string{"essential-pkg"},
+		tempDir:     t.TempDir(),
+	}
+	chrootEnv := &chroot.ChrootEnv{
+		ChrootBuilder: mockBuilder,
+	}
+
+	template := &config.ImageTemplate{
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{
+				Provider: "grub",
+				BootType: "efi",
+			},
+			Kernel: config.KernelConfig{
+				Packages:    []string{"linux-image-generic", "linux-headers-generic"},
+				Firmware:    []string{"linux-firmware-intel"},
+				DKMSModules: []string{"v4l2loopback-dkms", "linux-headers-generic"},
+			},
+		},
+	}
+
+	if err := chrootEnv.UpdateSystemPkgs(template); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"linux-image-generic", "linux-headers-generic", "linux-firmware-intel", "v4l2loopback-dkms"}
+	if !reflect.DeepEqual(template.KernelPkgList, expected) {
+		t.Errorf("Expected kernel packages %v, got %v", expected, template.KernelPkgList)
+	}
+}
+
 func TestChrootEnv_UpdateChrootLocalRepoMetadata_Success(t *testing.T) {
 	tempDir := t.TempDir()
 	mockBuilder := &mockChrootBuilder{tempDir: tempDir}
@@ -893,7 +1025,7 @@ func TestChrootEnv_TdnfInstallPackage_Success(t *testing.T) {
 		t.Fatalf("Failed to create install root: %v", err)
 	}
 
-	if err := chrootEnv.TdnfInstallPackage("pkg", installRoot, []string{"repo1"}); err != nil {
+	if err := chrootEnv.TdnfInstallPackage("pkg", installRoot, []string{"repo1"}, nil); err != nil {
 		t.Errorf("Tdnf install failed: %v", err)
 	}
 }
@@ -918,7 +1050,112 @@ func TestChrootEnv_AptInstallPackage_Success(t *testing.T) {
 	}
 
 	// Test with package name cleaning
-	if err := chrootEnv.AptInstallPackage("pkg_amd64", "/installroot", []string{"repo1"}); err != nil {
+	if err := chrootEnv.AptInstallPackage("pkg_amd64", "/installroot", []string{"repo1"}, nil); err != nil {
 		t.Errorf("Apt install failed: %v", err)
 	}
 }
+
+func TestChrootEnv_InstallPackage_Options(t *testing.T) {
+	originalShell := shell.Default
+	defer func() { shell.Default = originalShell }()
+
+	options := []string{"--nobest", "--setopt=throttle=100k"}
+	tests := []struct {
+		name    string
+		pattern string
+		install func(chrootEnv *chroot.ChrootEnv, installRoot string) error
+	}{
+		{
+			name:    "tdnf",
+			pattern: `tdnf install pkg .*--enablerepo=repo1 --nobest --setopt=throttle=100k$`,
+			install: func(chrootEnv *chroot.ChrootEnv, installRoot string) error {
+				return chrootEnv.TdnfInstallPackage("pkg", installRoot, []string{"repo1"}, options)
+			},
+		},
+		{
+			name:    "dnf",
+			pattern: ` dnf install pkg -y .*--enablerepo=repo1 --nobest --setopt=throttle=100k$`,
+			install: func(chrootEnv *chroot.ChrootEnv, installRoot string) error {
+				chrootEnv.TargetOs = "redhat-compatible-distro"
+				return chrootEnv.TdnfInstallPackage("pkg", installRoot, []string{"repo1"}, options)
+			},
+		},
+		{
+			name:    "apt",
+			pattern: `apt-get install -y --no-install-recommends pkg -o Dir::Etc::sourcelist=repo1 -oAcquire::http::Dl-Limit=100$`,
+			install: func(chrootEnv *chroot.ChrootEnv, installRoot string) error {
+				return chrootEnv.AptInstallPackage("pkg", installRoot, []string{"repo1"}, []string{"-oAcquire::http::Dl-Limit=100"})
+			},
+		},
+		{
+			name:    "apt several packages",
+			pattern: `apt-get install -y --no-install-recommends pkg=1.0 libfoo curl -o Dir::Etc::sourcelist=repo1$`,
+			install: func(chrootEnv *chroot.ChrootEnv, installRoot string) error {
+				return chrootEnv.AptInstallPackage("pkg_1.0_amd64 libfoo curl", installRoot, []string{"repo1"}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			chrootEnv := &chroot.ChrootEnv{ChrootEnvRoot: tempDir, ChrootBuilder: &mockChrootBuilder{tempDir: tempDir}}
+			installRoot := filepath.Join(tempDir, "installroot")
+			if err := os.Mkdir(installRoot, 0755); err != nil {
+				t.Fatalf("Failed to create install root: %v", err)
+			}
+			shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+				{Pattern: tt.pattern, Output: ""},
+				{Pattern: ".*", Error: fmt.Errorf("unexpected command")},
+			})
+			if err := tt.install(chrootEnv, installRoot); err != nil {
+				t.Errorf("expected the install options to be appended to the install command, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestChrootEnv_InstallPackage_FailureOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	chrootEnv := &chroot.ChrootEnv{ChrootEnvRoot: tempDir, ChrootBuilder: &mockChrootBuilder{tempDir: tempDir}}
+	installRoot := filepath.Join(tempDir, "installroot")
+	if err := os.Mkdir(installRoot, 0755); err != nil {
+		t.Fatalf("Failed to create install root: %v", err)
+	}
+
+	var output strings.Builder
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&output, "Unpacking file %02d\n", i)
+	}
+	output.WriteString("Error: No space left on device\n")
+
+	originalShell := shell.Default
+	defer func() { shell.Default = originalShell }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "tdnf install .*", Output: output.String(), Error: fmt.Errorf("exit status 1")},
+		{Pattern: "apt-get install .*", Output: output.String(), Error: fmt.Errorf("exit status 100")},
+	})
+
+	for name, install := range map[string]func() error{
+		"tdnf": func() error { return chrootEnv.TdnfInstallPackage("pkg", installRoot, []string{"repo1"}, nil) },
+		"apt":  func() error { return chrootEnv.AptInstallPackage("pkg", installRoot, nil, nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := install()
+			var installErr *chroot.PackageInstallError
+			if !errors.As(err, &installErr) {
+				t.Fatalf("expected a PackageInstallError, got %v", err)
+			}
+			if installErr.Package != "pkg" || installErr.Output != output.String() {
+				t.Errorf("expected the whole output of the install of pkg, got %+v", installErr)
+			}
+			msg := err.Error()
+			if !strings.Contains(msg, "Error: No space left on device") || !strings.Contains(msg, "Unpacking file 12") {
+				t.Errorf("expected the last %d lines of output in the error, got: %s", chroot.InstallOutputTailLines, msg)
+			}
+			if strings.Contains(msg, "Unpacking file 11") {
+				t.Errorf("expected only the last %d lines of output in the error, got: %s", chroot.InstallOutputTailLines, msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package chroot
+
+import (
+	"fmt"
+)
+
+// LocalRepoID is the repository ID of the local cache repository that image
+// packages are installed from.
+const LocalRepoID = "cache-repo"
+
+// LocalRepoConfig returns the configuration of the local cache repository
+// for pkgType, with suite as the Debian suite. The cache only holds packages
+// that were checked against the signed metadata of their remote repository
+// when downloaded, and its own metadata is generated during the build and
+// unsigned, so signature checks are turned off for this repository alone:
+// gpgcheck=0 and repo_gpgcheck=0 for rpm, [trusted=yes] for deb. Package
+// manager commands must not disable them globally, so any other repository
+// stays verified.
+func LocalRepoConfig(pkgType, suite string) (string, error) {
+	switch pkgType {
+	case "rpm":
+		return fmt.Sprintf(`[%s]
+name=Local Cache Repo
+baseurl=file://%s
+enabled=1
+gpgcheck=0
+repo_gpgcheck=0
+skip_if_unavailable=1
+sslverify=0
+`, LocalRepoID, ChrootRepoDir), nil
+	case "deb":
+		if suite == "" {
+			suite = "stable"
+		}
+		return fmt.Sprintf("deb [trusted=yes] file://%s %s main\n", ChrootRepoDir, suite), nil
+	default:
+		return "", fmt.Errorf("unsupported package type: %s", pkgType)
+	}
+}
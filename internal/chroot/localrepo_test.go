@@ -0,0 +1,61 @@
+package chroot_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	chroot "github.com/open-edge-platform/image-composer-tool/internal/chroot"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+func TestLocalRepoConfig(t *testing.T) {
+	rpmConfig, err := chroot.LocalRepoConfig("rpm", "")
+	if err != nil {
+		t.Fatalf("LocalRepoConfig(rpm) failed: %v", err)
+	}
+	for _, want := range []string{"[cache-repo]", "baseurl=file:///cdrom/cache-repo", "gpgcheck=0", "repo_gpgcheck=0"} {
+		if !strings.Contains(rpmConfig, want+"\n") {
+			t.Errorf("expected rpm local repo config to contain %q, got:\n%s", want, rpmConfig)
+		}
+	}
+
+	debConfig, err := chroot.LocalRepoConfig("deb", "noble")
+	if err != nil {
+		t.Fatalf("LocalRepoConfig(deb) failed: %v", err)
+	}
+	if want := "deb [trusted=yes] file:///cdrom/cache-repo noble main\n"; debConfig != want {
+		t.Errorf("expected deb local repo config %q, got %q", want, debConfig)
+	}
+
+	if debConfig, _ := chroot.LocalRepoConfig("deb", ""); !strings.Contains(debConfig, " stable main") {
+		t.Errorf("expected deb local repo config to default to the stable suite, got %q", debConfig)
+	}
+
+	if _, err := chroot.LocalRepoConfig("apk", ""); err == nil {
+		t.Error("expected error for unsupported package type")
+	}
+}
+
+func TestChrootEnv_TdnfInstallPackageKeepsGPGCheck(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	for _, targetOs := range []string{"azure-linux", "redhat-compatible-distro"} {
+		t.Run(targetOs, func(t *testing.T) {
+			// Signature checks must only be turned off by the cache-repo config,
+			// never for every repository on the command line
+			shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+				{Pattern: "--nogpgcheck", Error: fmt.Errorf("signature checks disabled globally")},
+				{Pattern: `install pkg .*--disablerepo=\* --enablerepo=cache-repo$`, Output: ""},
+				{Pattern: ".*", Error: fmt.Errorf("unexpected command")},
+			})
+			mockBuilder := &mockChrootBuilder{tempDir: t.TempDir()}
+			chrootEnv := &chroot.ChrootEnv{ChrootEnvRoot: t.TempDir(), ChrootBuilder: mockBuilder, TargetOs: targetOs}
+			installRoot := chrootEnv.ChrootEnvRoot + "/workspace/imagebuild/rootfs"
+			if err := chrootEnv.TdnfInstallPackage("pkg", installRoot, []string{chroot.LocalRepoID}, nil); err != nil {
+				t.Errorf("TdnfInstallPackage failed: %v", err)
+			}
+		})
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
@@ -33,8 +32,20 @@ func (t *ImageTemplate) GenerateAptSourcesFromRepositories() error {
 
 	log.Infof("Generating apt sources file from %d package repositories", len(t.PackageRepositories))
 
+	for i := range t.PackageRepositories {
+		if err := t.PackageRepositories[i].validateSignedBy(); err != nil {
+			return fmt.Errorf("invalid package repositories: %w", err)
+		}
+	}
+
 	// Normalize repository priorities (set default 500 if not specified)
 	normalizedRepos := normalizeRepositoryPriorities(t.PackageRepositories)
+	if err := CheckDuplicateRepositories(normalizedRepos); err != nil {
+		return fmt.Errorf("invalid package repositories: %w", err)
+	}
+	if err := checkOriginPriorityConflicts(normalizedRepos); err != nil {
+		return fmt.Errorf("invalid package repositories: %w", err)
+	}
 	t.PackageRepositories = normalizedRepos
 
 	// Generate apt sources content
@@ -49,6 +60,7 @@ func (t *ImageTemplate) GenerateAptSourcesFromRepositories() error {
 	if err != nil {
 		return fmt.Errorf("failed to create temporary apt sources file: %w", err)
 	}
+	t.registerTempFile(tempFile)
 
 	// Add to additionalFiles so it gets copied to the image
 	aptSourcesFile := AdditionalFileInfo{
@@ -118,7 +130,8 @@ func getRepositoryName(repo PackageRepository) string {
 }
 
 // generateAptSourcesContent creates apt sources.list content from PackageRepository slice
-// Following ubuntu-noble.list format: simple deb lines without signed-by directives
+// Following ubuntu-noble.list format: simple deb lines, with a signed-by directive
+// only for repositories verified with an existing keyring (signedBy)
 func generateAptSourcesContent(repos []PackageRepository) string {
 	var sources []string
 
@@ -134,8 +147,11 @@ func generateAptSourcesContent(repos []PackageRepository) string {
 			component = "main"
 		}
 
-		// Create the deb line in ubuntu-noble.list format (no signed-by directive)
+		// Create the deb line in ubuntu-noble.list format
 		debLine := fmt.Sprintf("deb %s %s %s", repo.URL, repo.Codename, component)
+		if repo.SignedBy != "" {
+			debLine = fmt.Sprintf("deb [signed-by=%s] %s %s %s", repo.SignedBy, repo.URL, repo.Codename, component)
+		}
 		sources = append(sources, debLine)
 	}
 
@@ -166,26 +182,11 @@ func extractGPGKeyFilename(keyURL string) string {
 
 // createTempAptSourcesFile creates a temporary file with the apt sources content
 func createTempAptSourcesFile(content string) (string, error) {
-	// Ensure temp directory exists
-	tempDir := TempDir()
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create temp directory %s: %w", tempDir, err)
-	}
-
-	// Create temporary file using proper temp directory
-	tempFile, err := os.CreateTemp(tempDir, "package-repositories-*.list")
+	path, err := writeTempFile("package-repositories-*.list", []byte(content))
 	if err != nil {
 		return "", fmt.Errorf("failed to create temporary apt sources file: %w", err)
 	}
-	defer tempFile.Close()
-
-	// Write content to temp file
-	if _, err := tempFile.WriteString(content); err != nil {
-		return "", fmt.Errorf("failed to write apt sources file: %w", err)
-	}
-
-	// Return relative path from default config location to tmp directory
-	return getRelativePathFromDefaultConfig(tempFile.Name()), nil
+	return path, nil
 }
 
 // addUniqueAdditionalFile adds an additional file if it doesn't already exist (by Final path)
@@ -226,6 +227,7 @@ func (t *ImageTemplate) generateAptPreferencesFromRepositories() error {
 		if err != nil {
 			return fmt.Errorf("failed to create temporary apt preferences file for %s: %w", repo.ID, err)
 		}
+		t.registerTempFile(tempFile)
 
 		// Determine filename for preferences
 		filename := generatePreferencesFilename(repo)
@@ -325,29 +327,13 @@ func sanitizeFilename(name string) string {
 
 // createTempAptPreferencesFile creates a temporary file with the preferences content
 func createTempAptPreferencesFile(repo PackageRepository, content string) (string, error) {
-	// Ensure temp directory exists
-	tempDir := TempDir()
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create temp directory %s: %w", tempDir, err)
-	}
-
 	// Create filename pattern based on repository
 	pattern := fmt.Sprintf("apt-preferences-%s-*.pref", generatePreferencesFilename(repo))
-
-	// Create temporary file using proper temp directory
-	tempFile, err := os.CreateTemp(tempDir, pattern)
+	path, err := writeTempFile(pattern, []byte(content))
 	if err != nil {
 		return "", fmt.Errorf("failed to create temporary apt preferences file for %s: %w", getRepositoryName(repo), err)
 	}
-	defer tempFile.Close()
-
-	// Write content to temp file
-	if _, err := tempFile.WriteString(content); err != nil {
-		return "", fmt.Errorf("failed to write apt preferences file: %w", err)
-	}
-
-	// Return relative path from default config location to tmp directory
-	return getRelativePathFromDefaultConfig(tempFile.Name()), nil
+	return path, nil
 }
 
 // downloadAndAddGPGKeys downloads GPG keys from repository URLs and adds them to additionalFiles
@@ -355,6 +341,12 @@ func (t *ImageTemplate) downloadAndAddGPGKeys(repos []PackageRepository) error {
 	log := logger.Logger()
 
 	for _, repo := range repos {
+		// Skip repositories verified with a keyring already in the image
+		if repo.SignedBy != "" {
+			log.Debugf("Repository %s uses existing keyring %s, skipping GPG key download", getRepositoryName(repo), repo.SignedBy)
+			continue
+		}
+
 		// Skip if no GPG key URL is specified
 		if repo.PKey == "" {
 			log.Debugf("Repository %s has no GPG key URL, skipping", getRepositoryName(repo))
@@ -413,6 +405,7 @@ func (t *ImageTemplate) downloadAndAddGPGKeys(repos []PackageRepository) error {
 		if err != nil {
 			return fmt.Errorf("failed to create temp GPG key file: %w", err)
 		}
+		t.registerTempFile(tempKeyFile)
 
 		// Determine the final destination path in the image
 		keyFilename := extractGPGKeyFilename(repo.PKey)
@@ -437,7 +430,7 @@ func downloadGPGKey(keyURL string) ([]byte, error) {
 
 	client := network.NewSecureHTTPClient()
 
-	resp, err := client.Get(keyURL)
+	resp, err := client.Get(RewriteRepoURL(keyURL))
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch GPG key from %s: %w", keyURL, err)
 	}
@@ -487,36 +480,8 @@ func dearmorGPGKey(keyData []byte) ([]byte, error) {
 	return dearmoredData, nil
 }
 
-// getRelativePathFromDefaultConfig converts an absolute temp file path to a relative path
-// from the default config directory (config/osv/{os}/{dist}/imageconfigs/defaultconfigs/)
-func getRelativePathFromDefaultConfig(absPath string) string {
-	// Get absolute path if not already absolute
-	if !filepath.IsAbs(absPath) {
-		var err error
-		absPath, err = filepath.Abs(absPath)
-		if err != nil {
-			// Fallback to returning the path as-is
-			return absPath
-		}
-	}
-
-	// Get the base filename from the absolute path
-	filename := filepath.Base(absPath)
-
-	// Default configs are at: config/osv/{os}/{dist}/imageconfigs/defaultconfigs/
-	// Tmp directory is at root: tmp/
-	// Relative path from defaultconfigs to tmp: ../../../../../../tmp/
-	return filepath.Join("..", "..", "..", "..", "..", "..", "tmp", filename)
-}
-
 // createTempGPGKeyFile creates a temporary file with the GPG key content
 func createTempGPGKeyFile(keyURL string, keyData []byte) (string, error) {
-	// Ensure temp directory exists
-	tempDir := TempDir()
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create temp directory %s: %w", tempDir, err)
-	}
-
 	// Extract key filename from URL for pattern
 	parts := strings.Split(keyURL, "/")
 	keyName := "gpg-key"
@@ -524,23 +489,9 @@ func createTempGPGKeyFile(keyURL string, keyData []byte) (string, error) {
 		keyName = strings.ReplaceAll(parts[len(parts)-1], ".", "-")
 	}
 
-	// Create temporary file
-	tempFile, err := os.CreateTemp(tempDir, fmt.Sprintf("%s-*.gpg", keyName))
+	path, err := writeTempFile(fmt.Sprintf("%s-*.gpg", keyName), keyData)
 	if err != nil {
 		return "", fmt.Errorf("failed to create temporary GPG key file: %w", err)
 	}
-	defer tempFile.Close()
-
-	// Write key data to temp file
-	if _, err := tempFile.Write(keyData); err != nil {
-		return "", fmt.Errorf("failed to write GPG key file: %w", err)
-	}
-
-	// Set permissions to 0644 so all users can read the GPG key
-	if err := os.Chmod(tempFile.Name(), 0644); err != nil {
-		return "", fmt.Errorf("failed to set permissions on GPG key file: %w", err)
-	}
-
-	// Return relative path from default config location to tmp directory
-	return getRelativePathFromDefaultConfig(tempFile.Name()), nil
+	return path, nil
 }
@@ -122,6 +122,10 @@ func TestGenerateAptSourcesContent(t *testing.T) {
 					t.Errorf("Expected content to contain: %q\nActual content:\n%s", expectedLine, content)
 				}
 			}
+			// Only the local cache repo is trusted without verification
+			if strings.Contains(content, "trusted=yes") {
+				t.Errorf("Expected remote repositories to keep signature verification, got:\n%s", content)
+			}
 		})
 	}
 }
@@ -415,6 +419,126 @@ func TestGenerateAptSourcesFromRepositories_PathOnlyRepo(t *testing.T) {
 	}
 }
 
+func TestGenerateAptSourcesFromRepositories_SignedBy(t *testing.T) {
+	template := &ImageTemplate{
+		Target: TargetInfo{
+			OS: "ubuntu",
+		},
+		PackageRepositories: []PackageRepository{
+			{
+				ID:        "vendor-repo",
+				Codename:  "noble",
+				URL:       "https://vendor.example.com/apt",
+				SignedBy:  "/usr/share/keyrings/vendor-archive-keyring.gpg",
+				Component: "main",
+			},
+		},
+		SystemConfig: SystemConfig{
+			AdditionalFiles: []AdditionalFileInfo{},
+		},
+	}
+
+	if err := template.GenerateAptSourcesFromRepositories(); err != nil {
+		t.Fatalf("GenerateAptSourcesFromRepositories() failed: %v", err)
+	}
+	defer func() {
+		for _, file := range template.SystemConfig.AdditionalFiles {
+			if path, err := resolveTestPath(file.Local); err == nil {
+				os.Remove(path)
+			}
+		}
+	}()
+
+	var sourcesFile *AdditionalFileInfo
+	for i := range template.SystemConfig.AdditionalFiles {
+		file := &template.SystemConfig.AdditionalFiles[i]
+		if strings.HasPrefix(file.Final, "/etc/apt/trusted.gpg.d/") {
+			t.Errorf("expected no GPG key file for a signedBy repository, got %s", file.Final)
+		}
+		if file.Final == "/etc/apt/sources.list.d/package-repositories.list" {
+			sourcesFile = file
+		}
+	}
+	if sourcesFile == nil {
+		t.Fatal("sources file not found")
+	}
+
+	path, err := resolveTestPath(sourcesFile.Local)
+	if err != nil {
+		t.Fatalf("failed to resolve sources file path: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read sources file: %v", err)
+	}
+	want := "deb [signed-by=/usr/share/keyrings/vendor-archive-keyring.gpg] https://vendor.example.com/apt noble main"
+	if string(content) != want {
+		t.Errorf("sources content = %q, want %q", content, want)
+	}
+}
+
+func TestGenerateAptSourcesFromRepositories_SignedByWithPKey(t *testing.T) {
+	tests := []struct {
+		name string
+		repo PackageRepository
+	}{
+		{
+			name: "pkey",
+			repo: PackageRepository{
+				Codename: "noble",
+				URL:      "https://vendor.example.com/apt",
+				PKey:     "https://vendor.example.com/key.gpg",
+				SignedBy: "/usr/share/keyrings/vendor-archive-keyring.gpg",
+			},
+		},
+		{
+			name: "pkeys",
+			repo: PackageRepository{
+				Codename: "noble",
+				URL:      "https://vendor.example.com/apt",
+				PKeys:    []string{"https://vendor.example.com/key.gpg"},
+				SignedBy: "/usr/share/keyrings/vendor-archive-keyring.gpg",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &ImageTemplate{
+				Target:              TargetInfo{OS: "ubuntu"},
+				PackageRepositories: []PackageRepository{tt.repo},
+			}
+
+			err := template.GenerateAptSourcesFromRepositories()
+			if err == nil || !strings.Contains(err.Error(), "cannot specify both 'pkey' and 'signedBy'") {
+				t.Fatalf("expected pkey/signedBy conflict error, got %v", err)
+			}
+			if len(template.SystemConfig.AdditionalFiles) != 0 {
+				t.Errorf("expected no additional files on error, got %d", len(template.SystemConfig.AdditionalFiles))
+			}
+		})
+	}
+}
+
+func TestValidatePackageRepositorySignedBy(t *testing.T) {
+	repo := PackageRepository{
+		Codename: "noble",
+		URL:      "https://vendor.example.com/apt",
+		SignedBy: "keyrings/vendor.gpg",
+	}
+	if err := repo.ValidatePackageRepository(); err == nil || !strings.Contains(err.Error(), "absolute keyring path") {
+		t.Errorf("expected relative signedBy path error, got %v", err)
+	}
+
+	repo.SignedBy = "/usr/share/keyrings/vendor.gpg"
+	if err := repo.ValidatePackageRepository(); err != nil {
+		t.Errorf("expected valid signedBy repository, got %v", err)
+	}
+	if got := repo.ReleaseKey(); got != repo.SignedBy {
+		t.Errorf("ReleaseKey() = %q, want %q", got, repo.SignedBy)
+	}
+}
+
 func TestAddUniqueAdditionalFile(t *testing.T) {
 	template := &ImageTemplate{
 		SystemConfig: SystemConfig{
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/slice"
+)
+
+// GPT type GUIDs of the firmware boot partitions
+const (
+	espTypeGUID      = "c12a7328-f81f-11d2-ba4b-00a0c93ec93b"
+	biosBootTypeGUID = "21686148-6449-6e6f-744e-656564454649"
+)
+
+// isESP reports whether p is an EFI system partition, by type name,
+// type GUID or flag.
+func (p PartitionInfo) isESP() bool {
+	return p.Type == "esp" || strings.EqualFold(p.TypeGUID, espTypeGUID) || slice.Contains(p.Flags, "esp")
+}
+
+// isBIOSBoot reports whether p is a BIOS boot partition, which GRUB
+// embeds its core image into for legacy boot from a GPT disk.
+func (p PartitionInfo) isBIOSBoot() bool {
+	return p.Type == "bios" || p.Type == "bios-boot" || strings.EqualFold(p.TypeGUID, biosBootTypeGUID) ||
+		slice.Contains(p.Flags, "bios_grub") || slice.Contains(p.Flags, "bios-grub")
+}
+
+// ValidateBootMode cross-checks the bootloader boot type against the disk
+// layout and the bootloader provider, so that an image the firmware cannot
+// boot is rejected before it is built. efi boot needs an ESP; legacy boot
+// from a GPT disk needs a BIOS boot partition; systemd-boot only supports efi
+// boot. A hybrid layout with both partitions is valid for either boot type.
+// Templates without partitions, such as ISO templates, are not checked.
+func (t *ImageTemplate) ValidateBootMode() error {
+	bootloader := t.GetBootloaderConfig()
+	if bootloader.Provider == "systemd-boot" && bootloader.BootType == "legacy" {
+		return fmt.Errorf("legacy boot requested but the systemd-boot bootloader only supports efi boot")
+	}
+
+	partitions := t.Disk.Partitions
+	if len(partitions) == 0 {
+		return nil
+	}
+	hasESP, hasBIOSBoot := false, false
+	for _, partition := range partitions {
+		hasESP = hasESP || partition.isESP()
+		hasBIOSBoot = hasBIOSBoot || partition.isBIOSBoot()
+	}
+
+	switch bootloader.BootType {
+	case "efi":
+		if !hasESP {
+			if hasBIOSBoot {
+				return fmt.Errorf("efi boot requested but only a BIOS boot partition is defined")
+			}
+			return fmt.Errorf("efi boot requested but no ESP partition is defined")
+		}
+	case "legacy":
+		// GRUB is embedded in the MBR gap of an MBR disk
+		if t.Disk.PartitionTableType == "mbr" || hasBIOSBoot {
+			return nil
+		}
+		if hasESP {
+			return fmt.Errorf("bios boot requested but only an ESP partition is defined")
+		}
+		return fmt.Errorf("bios boot requested but no BIOS boot partition is defined for the gpt partition table")
+	}
+	return nil
+}
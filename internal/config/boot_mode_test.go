@@ -0,0 +1,116 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateBootMode(t *testing.T) {
+	esp := PartitionInfo{ID: "EFI", Type: "esp", FsType: "fat32", MountPoint: "/boot/efi", Flags: []string{"esp", "boot"}}
+	biosBoot := PartitionInfo{ID: "BIOSBOOT", Type: "bios-boot", Flags: []string{"bios_grub"}}
+	root := PartitionInfo{ID: "rootfs", Type: "linux-root-amd64", FsType: "ext4", MountPoint: "/"}
+
+	tests := []struct {
+		name       string
+		bootType   string
+		provider   string
+		tableType  string
+		partitions []PartitionInfo
+		wantErr    string
+	}{
+		{
+			name:       "efi with ESP",
+			bootType:   "efi",
+			provider:   "grub",
+			partitions: []PartitionInfo{esp, root},
+		},
+		{
+			name:       "efi with ESP identified by type GUID",
+			bootType:   "efi",
+			provider:   "systemd-boot",
+			partitions: []PartitionInfo{{ID: "EFI", TypeGUID: "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"}, root},
+		},
+		{
+			name:       "efi without ESP",
+			bootType:   "efi",
+			provider:   "grub",
+			partitions: []PartitionInfo{root},
+			wantErr:    "efi boot requested but no ESP partition is defined",
+		},
+		{
+			name:       "efi with only a BIOS boot partition",
+			bootType:   "efi",
+			provider:   "grub",
+			partitions: []PartitionInfo{biosBoot, root},
+			wantErr:    "efi boot requested but only a BIOS boot partition is defined",
+		},
+		{
+			name:       "bios with only ESP",
+			bootType:   "legacy",
+			provider:   "grub",
+			tableType:  "gpt",
+			partitions: []PartitionInfo{esp, root},
+			wantErr:    "bios boot requested but only an ESP partition is defined",
+		},
+		{
+			name:       "bios on gpt without BIOS boot partition",
+			bootType:   "legacy",
+			provider:   "grub",
+			tableType:  "gpt",
+			partitions: []PartitionInfo{root},
+			wantErr:    "no BIOS boot partition is defined",
+		},
+		{
+			name:       "bios on mbr",
+			bootType:   "legacy",
+			provider:   "grub",
+			tableType:  "mbr",
+			partitions: []PartitionInfo{root},
+		},
+		{
+			name:       "hybrid layout with efi boot",
+			bootType:   "efi",
+			provider:   "grub",
+			tableType:  "gpt",
+			partitions: []PartitionInfo{biosBoot, esp, root},
+		},
+		{
+			name:       "hybrid layout with bios boot",
+			bootType:   "legacy",
+			provider:   "grub",
+			tableType:  "gpt",
+			partitions: []PartitionInfo{biosBoot, esp, root},
+		},
+		{
+			name:       "systemd-boot with bios boot",
+			bootType:   "legacy",
+			provider:   "systemd-boot",
+			tableType:  "gpt",
+			partitions: []PartitionInfo{biosBoot, esp, root},
+			wantErr:    "systemd-boot bootloader only supports efi boot",
+		},
+		{
+			name:     "no partitions",
+			bootType: "efi",
+			provider: "grub",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &ImageTemplate{Disk: DiskConfig{PartitionTableType: tt.tableType, Partitions: tt.partitions}}
+			template.SystemConfig.Bootloader = Bootloader{BootType: tt.bootType, Provider: tt.provider}
+
+			err := template.ValidateBootMode()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/slice"
+	"gopkg.in/yaml.v3"
+)
+
+// Stages of an image build recorded in a BuildCheckpoint, in pipeline order.
+// The providers resolve and download the image packages in one step, so the
+// resolve and download stages always complete together.
+const (
+	StageResolve  = "resolve"
+	StageDownload = "download"
+	StageInstall  = "install"
+	StageConfig   = "config"
+	StageBoot     = "boot"
+	StageSecure   = "secure"
+	StageUKI      = "uki"
+	StageSign     = "sign"
+)
+
+// BuildStages lists the checkpointed build stages in pipeline order.
+var BuildStages = []string{
+	StageResolve, StageDownload, StageInstall, StageConfig, StageBoot, StageSecure, StageUKI, StageSign,
+}
+
+// BuildCheckpoint records the stages a build completed, so that a failed
+// build can be resumed from its first incomplete stage, reusing the package
+// cache, chroot environment and partially built image it left in the work
+// directory. A nil checkpoint records nothing and never skips a stage.
+type BuildCheckpoint struct {
+	TemplateDigest string   `json:"templateDigest"` // digest of the template the stages were completed for
+	Completed      []string `json:"completed"`      // completed stages, in pipeline order
+
+	// Package lists of the resolve stage, restored when it is skipped
+	EssentialPkgList  []string                `json:"essentialPkgList,omitempty"`
+	KernelPkgList     []string                `json:"kernelPkgList,omitempty"`
+	BootloaderPkgList []string                `json:"bootloaderPkgList,omitempty"`
+	FullPkgList       []string                `json:"fullPkgList,omitempty"`
+	FullPkgListBom    []ospackage.PackageInfo `json:"fullPkgListBom,omitempty"`
+
+	// DiskPartitions maps the partition IDs to the partition devices of the
+	// raw image the install stage was completed on
+	DiskPartitions map[string]string `json:"diskPartitions,omitempty"`
+
+	// ConfigSteps lists the steps of the config stage applied by its last
+	// run, so that a failure part way through shows what the image got
+	ConfigSteps []string `json:"configSteps,omitempty"`
+
+	// PartialStage is a stage that failed after changing the image in a way
+	// that could not be rolled back. The image cannot be trusted to redo the
+	// stage on, so the build cannot be resumed.
+	PartialStage string `json:"partialStage,omitempty"`
+
+	path string
+}
+
+// templateDigest identifies everything in template that ends up in the image.
+func templateDigest(template *ImageTemplate) (string, error) {
+	data, err := yaml.Marshal(template)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize template: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewBuildCheckpoint returns an empty checkpoint for a build of template,
+// recorded in path. Any checkpoint left there by a previous build is
+// discarded.
+func NewBuildCheckpoint(path string, template *ImageTemplate) (*BuildCheckpoint, error) {
+	digest, err := templateDigest(template)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove previous build checkpoint %s: %w", path, err)
+	}
+	return &BuildCheckpoint{TemplateDigest: digest, path: path}, nil
+}
+
+// ResumeBuildCheckpoint loads the checkpoint recorded in path by a failed
+// build of template. It fails if there is none, or if it was recorded for a
+// different template, as the completed stages would not match the image.
+func ResumeBuildCheckpoint(path string, template *ImageTemplate) (*BuildCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no build checkpoint to resume from at %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build checkpoint: %w", err)
+	}
+	var checkpoint BuildCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse build checkpoint %s: %w", path, err)
+	}
+	digest, err := templateDigest(template)
+	if err != nil {
+		return nil, err
+	}
+	if digest != checkpoint.TemplateDigest {
+		return nil, fmt.Errorf("build checkpoint %s was recorded for a different template, rebuild without resuming", path)
+	}
+	if checkpoint.PartialStage != "" {
+		return nil, fmt.Errorf("build checkpoint %s records a %s stage that failed part way through and could not be rolled back, rebuild without resuming",
+			path, checkpoint.PartialStage)
+	}
+	checkpoint.path = path
+	return &checkpoint, nil
+}
+
+// IsCompleted reports whether stage was completed by the build being resumed.
+func (c *BuildCheckpoint) IsCompleted(stage string) bool {
+	return c != nil && slice.Contains(c.Completed, stage)
+}
+
+// ResumeStage returns the first stage that is not completed, or "" if all of
+// them are.
+func (c *BuildCheckpoint) ResumeStage() string {
+	for _, stage := range BuildStages {
+		if !c.IsCompleted(stage) {
+			return stage
+		}
+	}
+	return ""
+}
+
+// Complete records stages as completed. A checkpoint that cannot be written
+// only costs redoing the stages when resuming, so failures are logged and
+// otherwise ignored.
+func (c *BuildCheckpoint) Complete(stages ...string) {
+	if c == nil {
+		return
+	}
+	for _, stage := range stages {
+		if !slice.Contains(c.Completed, stage) {
+			c.Completed = append(c.Completed, stage)
+		}
+	}
+	if err := c.save(); err != nil {
+		log.Warnf("Failed to record build checkpoint: %v", err)
+	}
+}
+
+// RecordPackageLists keeps the package lists resolved for template, so that
+// a resumed build can skip the resolve stage.
+func (c *BuildCheckpoint) RecordPackageLists(template *ImageTemplate) {
+	if c == nil {
+		return
+	}
+	c.EssentialPkgList = template.EssentialPkgList
+	c.KernelPkgList = template.KernelPkgList
+	c.BootloaderPkgList = template.BootloaderPkgList
+	c.FullPkgList = template.FullPkgList
+	c.FullPkgListBom = template.FullPkgListBom
+}
+
+// RestorePackageLists sets the package lists recorded by RecordPackageLists
+// on template.
+func (c *BuildCheckpoint) RestorePackageLists(template *ImageTemplate) {
+	if c == nil {
+		return
+	}
+	template.EssentialPkgList = c.EssentialPkgList
+	template.KernelPkgList = c.KernelPkgList
+	template.BootloaderPkgList = c.BootloaderPkgList
+	template.FullPkgList = c.FullPkgList
+	template.FullPkgListBom = c.FullPkgListBom
+}
+
+// RecordDiskPartitions keeps the partition devices of the raw image being
+// built, so that a resumed build can attach it again.
+func (c *BuildCheckpoint) RecordDiskPartitions(diskPathIdMap map[string]string) {
+	if c == nil {
+		return
+	}
+	c.DiskPartitions = diskPathIdMap
+}
+
+// RecordConfigSteps keeps the steps of the config stage applied so far.
+func (c *BuildCheckpoint) RecordConfigSteps(steps []string) {
+	if c == nil {
+		return
+	}
+	c.ConfigSteps = append([]string(nil), steps...)
+	if err := c.save(); err != nil {
+		log.Warnf("Failed to record build checkpoint: %v", err)
+	}
+}
+
+// MarkPartial records that stage failed after changing the image in a way
+// that could not be rolled back, so that the build is not resumed.
+func (c *BuildCheckpoint) MarkPartial(stage string) {
+	if c == nil {
+		return
+	}
+	c.PartialStage = stage
+	if err := c.save(); err != nil {
+		log.Warnf("Failed to record build checkpoint: %v", err)
+	}
+}
+
+// Remove deletes the checkpoint file once the build completed.
+func (c *BuildCheckpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove build checkpoint %s: %w", c.path, err)
+	}
+	return nil
+}
+
+func (c *BuildCheckpoint) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize build checkpoint: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create build checkpoint directory: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write build checkpoint %s: %w", c.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+)
+
+func TestBuildCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build-checkpoint.json")
+	template := &ImageTemplate{
+		Image:        ImageInfo{Name: "test-image"},
+		SystemConfig: SystemConfig{Name: "test-config", Packages: []string{"bash"}},
+	}
+
+	if _, err := ResumeBuildCheckpoint(path, template); err == nil || !strings.Contains(err.Error(), "no build checkpoint") {
+		t.Fatalf("expected an error without a checkpoint, got %v", err)
+	}
+
+	checkpoint, err := NewBuildCheckpoint(path, template)
+	if err != nil {
+		t.Fatalf("NewBuildCheckpoint() error = %v", err)
+	}
+	if stage := checkpoint.ResumeStage(); stage != StageResolve {
+		t.Errorf("ResumeStage() = %q, want %q", stage, StageResolve)
+	}
+	template.FullPkgList = []string{"bash-5.2.rpm"}
+	template.FullPkgListBom = []ospackage.PackageInfo{{Name: "bash-5.2.rpm", Version: "5.2"}}
+	checkpoint.RecordPackageLists(template)
+	checkpoint.RecordDiskPartitions(map[string]string{"rootfs": "/dev/loop3p2"})
+	checkpoint.Complete(StageResolve, StageDownload)
+	checkpoint.Complete(StageInstall)
+
+	resumed, err := ResumeBuildCheckpoint(path, &ImageTemplate{
+		Image:        ImageInfo{Name: "test-image"},
+		SystemConfig: SystemConfig{Name: "test-config", Packages: []string{"bash"}},
+	})
+	if err != nil {
+		t.Fatalf("ResumeBuildCheckpoint() error = %v", err)
+	}
+	if !resumed.IsCompleted(StageInstall) || resumed.IsCompleted(StageConfig) {
+		t.Errorf("unexpected completed stages %v", resumed.Completed)
+	}
+	if stage := resumed.ResumeStage(); stage != StageConfig {
+		t.Errorf("ResumeStage() = %q, want %q", stage, StageConfig)
+	}
+	if resumed.DiskPartitions["rootfs"] != "/dev/loop3p2" {
+		t.Errorf("unexpected disk partitions %v", resumed.DiskPartitions)
+	}
+	restored := &ImageTemplate{}
+	resumed.RestorePackageLists(restored)
+	if !reflect.DeepEqual(restored.FullPkgList, template.FullPkgList) ||
+		!reflect.DeepEqual(restored.FullPkgListBom, template.FullPkgListBom) {
+		t.Errorf("restored package lists %v %v, want %v %v",
+			restored.FullPkgList, restored.FullPkgListBom, template.FullPkgList, template.FullPkgListBom)
+	}
+
+	template.SystemConfig.Packages = append(template.SystemConfig.Packages, "vim")
+	if _, err := ResumeBuildCheckpoint(path, template); err == nil || !strings.Contains(err.Error(), "different template") {
+		t.Fatalf("expected a template mismatch error, got %v", err)
+	}
+
+	if err := resumed.Remove(); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := ResumeBuildCheckpoint(path, template); err == nil {
+		t.Fatal("expected no checkpoint after Remove()")
+	}
+}
+
+func TestNilBuildCheckpoint(t *testing.T) {
+	var checkpoint *BuildCheckpoint
+	checkpoint.Complete(StageInstall)
+	checkpoint.RecordPackageLists(&ImageTemplate{})
+	checkpoint.RecordConfigSteps([]string{"hostname"})
+	checkpoint.MarkPartial(StageConfig)
+	if checkpoint.IsCompleted(StageInstall) {
+		t.Error("a nil checkpoint must not record completed stages")
+	}
+	if err := checkpoint.Remove(); err != nil {
+		t.Errorf("Remove() error = %v", err)
+	}
+}
+
+func TestBuildCheckpointPartialStage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build-checkpoint.json")
+	template := &ImageTemplate{Image: ImageInfo{Name: "test-image"}}
+
+	checkpoint, err := NewBuildCheckpoint(path, template)
+	if err != nil {
+		t.Fatalf("NewBuildCheckpoint() error = %v", err)
+	}
+	checkpoint.Complete(StageResolve, StageDownload, StageInstall)
+	checkpoint.RecordConfigSteps([]string{"hostname", "users"})
+
+	resumed, err := ResumeBuildCheckpoint(path, template)
+	if err != nil {
+		t.Fatalf("ResumeBuildCheckpoint() error = %v", err)
+	}
+	if !reflect.DeepEqual(resumed.ConfigSteps, []string{"hostname", "users"}) {
+		t.Errorf("ConfigSteps = %v, want the recorded steps", resumed.ConfigSteps)
+	}
+	if stage := resumed.ResumeStage(); stage != StageConfig {
+		t.Errorf("ResumeStage() = %q, want %q", stage, StageConfig)
+	}
+
+	checkpoint.MarkPartial(StageConfig)
+	if _, err := ResumeBuildCheckpoint(path, template); err == nil || !strings.Contains(err.Error(), "config stage that failed part way through") {
+		t.Fatalf("expected a partially applied stage to prevent resuming, got %v", err)
+	}
+}
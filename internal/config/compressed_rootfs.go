@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Read-only compressed filesystem types the root partition can use. Unlike
+// the other filesystem types they are not formatted up front and mounted
+// during the installation: the image is installed into a plain directory and
+// the filesystem is built from it once the installation is complete.
+const (
+	FsTypeSquashfs = "squashfs"
+	FsTypeErofs    = "erofs"
+)
+
+// IsCompressedFsType reports whether fsType is a read-only compressed
+// filesystem type.
+func IsCompressedFsType(fsType string) bool {
+	return fsType == FsTypeSquashfs || fsType == FsTypeErofs
+}
+
+// CompressedRootFsType returns the filesystem type of the root partition if
+// it is a read-only compressed type, or "" otherwise.
+func (t *ImageTemplate) CompressedRootFsType() string {
+	for _, partition := range t.Disk.Partitions {
+		if partition.MountPoint == "/" && IsCompressedFsType(partition.FsType) {
+			return partition.FsType
+		}
+	}
+	return ""
+}
+
+// ValidateCompressedRootfs checks the disk layout of a template that uses a
+// compressed filesystem type. Only the root partition (and its unmounted A/B
+// slot copy) can use one; it must not be mounted read-write; the kernel and
+// bootloader need a separate /boot partition as the root filesystem does not
+// exist yet when the bootloader is installed; and dm-verity immutability,
+// which hashes the root partition before the filesystem is built, is not
+// supported with it.
+func (t *ImageTemplate) ValidateCompressedRootfs() error {
+	rootFsType := ""
+	hasBoot := false
+	for _, partition := range t.Disk.Partitions {
+		mountPoint := strings.TrimSpace(partition.MountPoint)
+		if mountPoint != "" && filepath.Clean(mountPoint) == "/boot" {
+			hasBoot = true
+		}
+		if !IsCompressedFsType(partition.FsType) {
+			continue
+		}
+		if mountPoint != "" && mountPoint != "/" {
+			return fmt.Errorf("partition %q: fsType %s is only supported for the root partition, not %s",
+				partition.ID, partition.FsType, mountPoint)
+		}
+		for _, option := range strings.Split(partition.MountOptions, ",") {
+			if strings.TrimSpace(option) == "rw" {
+				return fmt.Errorf("partition %q: fsType %s is read-only and cannot be mounted with the rw option",
+					partition.ID, partition.FsType)
+			}
+		}
+		if mountPoint == "/" {
+			rootFsType = partition.FsType
+		}
+	}
+	if rootFsType == "" {
+		return nil
+	}
+	if !hasBoot {
+		return fmt.Errorf("a %s root partition requires a separate /boot partition", rootFsType)
+	}
+	if t.IsImmutabilityEnabled() {
+		return fmt.Errorf("a %s root partition is not supported together with immutability", rootFsType)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCompressedRootfs(t *testing.T) {
+	boot := PartitionInfo{ID: "boot", MountPoint: "/boot", FsType: "ext4"}
+
+	tests := []struct {
+		name       string
+		partitions []PartitionInfo
+		immutable  bool
+		wantErr    string
+	}{
+		{
+			name:       "squashfs root",
+			partitions: []PartitionInfo{boot, {ID: "rootfs", MountPoint: "/", FsType: FsTypeSquashfs}},
+		},
+		{
+			name: "erofs root with unmounted slot B",
+			partitions: []PartitionInfo{boot,
+				{ID: "rootfs", MountPoint: "/", FsType: FsTypeErofs, MountOptions: "defaults,ro"},
+				{ID: "rootfs_b", FsType: FsTypeErofs}},
+		},
+		{
+			name:       "no compressed partitions",
+			partitions: []PartitionInfo{{ID: "rootfs", MountPoint: "/", FsType: "ext4", MountOptions: "rw"}},
+		},
+		{
+			name:       "rw mount option",
+			partitions: []PartitionInfo{boot, {ID: "rootfs", MountPoint: "/", FsType: FsTypeSquashfs, MountOptions: "defaults,rw"}},
+			wantErr:    "cannot be mounted with the rw option",
+		},
+		{
+			name:       "rw mount option on erofs",
+			partitions: []PartitionInfo{boot, {ID: "rootfs", MountPoint: "/", FsType: FsTypeErofs, MountOptions: "rw"}},
+			wantErr:    "cannot be mounted with the rw option",
+		},
+		{
+			name: "non-root partition",
+			partitions: []PartitionInfo{boot, {ID: "rootfs", MountPoint: "/", FsType: "ext4"},
+				{ID: "data", MountPoint: "/data", FsType: FsTypeSquashfs}},
+			wantErr: "only supported for the root partition",
+		},
+		{
+			name:       "no boot partition",
+			partitions: []PartitionInfo{{ID: "rootfs", MountPoint: "/", FsType: FsTypeErofs}},
+			wantErr:    "requires a separate /boot partition",
+		},
+		{
+			name:       "immutability",
+			partitions: []PartitionInfo{boot, {ID: "rootfs", MountPoint: "/", FsType: FsTypeSquashfs}},
+			immutable:  true,
+			wantErr:    "not supported together with immutability",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &ImageTemplate{Disk: DiskConfig{Partitions: tt.partitions}}
+			template.SystemConfig.Immutability.Enabled = tt.immutable
+
+			err := template.ValidateCompressedRootfs()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCompressedRootFsType(t *testing.T) {
+	template := &ImageTemplate{Disk: DiskConfig{Partitions: []PartitionInfo{
+		{ID: "boot", MountPoint: "/boot", FsType: "ext4"},
+		{ID: "rootfs", MountPoint: "/", FsType: FsTypeErofs},
+	}}}
+	if got := template.CompressedRootFsType(); got != FsTypeErofs {
+		t.Errorf("CompressedRootFsType() = %q, want %q", got, FsTypeErofs)
+	}
+
+	template.Disk.Partitions[1].FsType = "ext4"
+	if got := template.CompressedRootFsType(); got != "" {
+		t.Errorf("CompressedRootFsType() = %q, want empty for an ext4 root", got)
+	}
+}
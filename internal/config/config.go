@@ -3,8 +3,10 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -39,19 +41,35 @@ type DiskConfig struct {
 	Artifacts          []ArtifactInfo  `yaml:"artifacts"`
 	Size               string          `yaml:"size"`
 	PartitionTableType string          `yaml:"partitionTableType"`
+	Layout             string          `yaml:"layout,omitempty"` // Layout: "standard" (default) or "ab" for A/B root slots
+	Sparse             bool            `yaml:"sparse,omitempty"` // Deallocate the zero blocks of the raw image before conversion and compression
 	Partitions         []PartitionInfo `yaml:"partitions"`
 }
 
+// Disk layouts selectable with DiskConfig.Layout
+const (
+	DiskLayoutStandard = "standard" // a single root (and boot) partition
+	DiskLayoutAB       = "ab"       // root (and boot) partitions duplicated into slots A and B
+)
+
 type PackageRepository struct {
-	ID            string   `yaml:"id,omitempty"`            // Auto-assigned
-	Codename      string   `yaml:"codename"`                // Repository identifier/codename
-	URL           string   `yaml:"url,omitempty"`           // Repository base URL
-	Path          string   `yaml:"path,omitempty"`          // Local directory path for file-based repositories
-	PKey          string   `yaml:"pkey"`                    // Public GPG key URL for verification
-	PKeys         []string `yaml:"pkeys,omitempty"`         // Multiple public GPG key URLs for verification
-	Component     string   `yaml:"component,omitempty"`     // Repository component (e.g., "main", "restricted")
-	Priority      int      `yaml:"priority,omitempty"`      // Repository priority (higher numbers = higher priority)
-	AllowPackages []string `yaml:"allowPackages,omitempty"` // Optional: specific packages to include from this repo (pinning)
+	ID               string   `yaml:"id,omitempty"`               // Auto-assigned
+	Codename         string   `yaml:"codename"`                   // Repository identifier/codename
+	URL              string   `yaml:"url,omitempty"`              // Repository base URL
+	Path             string   `yaml:"path,omitempty"`             // Local directory path for file-based repositories
+	PKey             string   `yaml:"pkey"`                       // Public GPG key URL for verification
+	PKeys            []string `yaml:"pkeys,omitempty"`            // Multiple public GPG key URLs for verification
+	SignedBy         string   `yaml:"signedBy,omitempty"`         // Keyring already present on the host and in the image, used instead of pkey
+	Component        string   `yaml:"component,omitempty"`        // Repository component (e.g., "main", "restricted")
+	Priority         int      `yaml:"priority,omitempty"`         // Repository priority (higher numbers = higher priority)
+	AllowPackages    []string `yaml:"allowPackages,omitempty"`    // Optional: specific packages to include from this repo (pinning)
+	SnapshotRevision string   `yaml:"snapshotRevision,omitempty"` // Optional: expected repomd.xml <revision> or Release Date
+	SnapshotChecksum string   `yaml:"snapshotChecksum,omitempty"` // Optional: expected sha256 of repomd.xml or of the Release file
+}
+
+// SnapshotPin returns the metadata snapshot the repository is pinned to.
+func (r PackageRepository) SnapshotPin() ospackage.SnapshotPin {
+	return ospackage.SnapshotPin{Revision: r.SnapshotRevision, Checksum: r.SnapshotChecksum}
 }
 
 // ProviderRepoConfig represents the repository configuration for a provider
@@ -70,6 +88,7 @@ type ProviderRepoConfig struct {
 	Enabled      bool     `yaml:"enabled"`
 	Component    string   `yaml:"component"` // Repository component/section identifier
 	BuildPath    string   `yaml:"buildPath"`
+	Arches       []string `yaml:"arches,omitempty"` // Architectures the repository provides, empty means all
 }
 
 // ProviderRepoConfigs represents multiple repository configurations for a provider
@@ -94,6 +113,14 @@ type ImageTemplate struct {
 	FullPkgListBom       []ospackage.PackageInfo `yaml:"-"`
 	DotFilePath          string                  `yaml:"-"`
 	DotSystemOnly        bool                    `yaml:"-"`
+	ContinueOnPkgError   bool                    `yaml:"-"`
+	ForceUKI             bool                    `yaml:"-"`
+	Incremental          bool                    `yaml:"-"`
+	ExplainResolve       bool                    `yaml:"-"`
+	HostToolVersions     map[string]string       `yaml:"-"` // versions of the host tools used for the build, by tool name
+	InstallOrderRules    []InstallOrderRule      `yaml:"-"`
+	Checkpoint           *BuildCheckpoint        `yaml:"-"`
+	tempFiles            []string                // generated files removed by RemoveTempFiles
 	pureBuildStart       time.Time
 	pureBuildDuration    time.Duration
 	downloadPkgsStart    time.Time
@@ -106,6 +133,16 @@ type ImageTemplate struct {
 	buildFinishedAt      time.Time
 }
 
+// InstallOrderRule places the packages named Prefix, or "Prefix-*", in the
+// image package install order. Packages are installed by ascending Priority
+// of the rule with the longest matching Prefix; packages no rule matches have
+// priority 0. Providers set them on ImageTemplate.InstallOrderRules, where they
+// take precedence over default rules of the package type with the same Prefix.
+type InstallOrderRule struct {
+	Prefix   string
+	Priority int
+}
+
 // PackageSource identifies why a package was requested in the merged template.
 type PackageSource string
 
@@ -118,7 +155,8 @@ const (
 )
 
 type Initramfs struct {
-	Template string `yaml:"template"` // Template: path to the initramfs configuration template file
+	Template    string `yaml:"template"`              // Template: path to the initramfs configuration template file
+	Compression string `yaml:"compression,omitempty"` // Compression: gzip, xz, zstd or lz4; empty keeps the distribution default
 }
 
 type Bootloader struct {
@@ -126,13 +164,21 @@ type Bootloader struct {
 	Provider string `yaml:"provider"` // Provider: bootloader provider (e.g., "grub2", "systemd-boot")
 }
 
+// Secure Boot signing backends selectable with ImmutabilityConfig.SecureBootSigner
+const (
+	SecureBootSignerLocal  = "local"  // sign with the private key file in SecureBootDBKey
+	SecureBootSignerPKCS11 = "pkcs11" // sign with the token key referenced by SecureBootDBKeyURI
+)
+
 // ImmutabilityConfig holds the immutability configuration
 type ImmutabilityConfig struct {
-	Enabled         bool   `yaml:"enabled"`                   // Enabled: whether immutability is enabled (default: false)
-	SecureBootDBKey string `yaml:"secureBootDBKey,omitempty"` // SecureBootDBKey: The private key file used to sign the bootloader for UEFI Secure Boot
-	SecureBootDBCrt string `yaml:"secureBootDBCrt,omitempty"` // SecureBootDBCrt: The certificate file in PEM format, which corresponds to the private key for UEFI Secure Boot
-	SecureBootDBCer string `yaml:"secureBootDBCer,omitempty"` // SecureBootDBCer: The same certificate file, but provided in DER (binary) format specifically for UEFI firmware
-	wasProvided     bool   `yaml:"-"`                         // Internal flag to track if section was provided
+	Enabled            bool   `yaml:"enabled"`                      // Enabled: whether immutability is enabled (default: false)
+	SecureBootSigner   string `yaml:"secureBootSigner,omitempty"`   // SecureBootSigner: signing backend, "local" (default) or "pkcs11"
+	SecureBootDBKey    string `yaml:"secureBootDBKey,omitempty"`    // SecureBootDBKey: The private key file used to sign the bootloader for UEFI Secure Boot
+	SecureBootDBKeyURI string `yaml:"secureBootDBKeyURI,omitempty"` // SecureBootDBKeyURI: PKCS#11 URI of the signing key when SecureBootSigner is "pkcs11"
+	SecureBootDBCrt    string `yaml:"secureBootDBCrt,omitempty"`    // SecureBootDBCrt: The certificate file in PEM format, which corresponds to the private key for UEFI Secure Boot
+	SecureBootDBCer    string `yaml:"secureBootDBCer,omitempty"`    // SecureBootDBCer: The same certificate file, but provided in DER (binary) format specifically for UEFI firmware
+	wasProvided        bool   `yaml:"-"`                            // Internal flag to track if section was provided
 }
 
 // UserConfig holds the user configuration
@@ -146,27 +192,123 @@ type UserConfig struct {
 	Sudo           bool     `yaml:"sudo,omitempty"`           // Sudo: whether to grant sudo permissions
 	Home           string   `yaml:"home,omitempty"`           // Home: custom home directory path
 	Shell          string   `yaml:"shell,omitempty"`          // Shell: login shell (e.g., /bin/bash, /bin/zsh)
+	Locked         bool     `yaml:"locked,omitempty"`         // Locked: lock the password so the account only allows key-based login
 }
 
 // SystemConfig represents a system configuration within the template
 type SystemConfig struct {
-	Name            string               `yaml:"name"`
-	Description     string               `yaml:"description"`
-	Initramfs       Initramfs            `yaml:"initramfs,omitempty"`
-	HostName        string               `yaml:"hostname,omitempty"`
-	Immutability    ImmutabilityConfig   `yaml:"immutability,omitempty"`
-	Users           []UserConfig         `yaml:"users,omitempty"`
-	Bootloader      Bootloader           `yaml:"bootloader"`
-	Packages        []string             `yaml:"packages"`
-	AdditionalFiles []AdditionalFileInfo `yaml:"additionalFiles"`
-	Configurations  []ConfigurationInfo  `yaml:"configurations"`
-	Kernel          KernelConfig         `yaml:"kernel"`
+	Name                string               `yaml:"name"`
+	Description         string               `yaml:"description"`
+	Initramfs           Initramfs            `yaml:"initramfs,omitempty"`
+	HostName            string               `yaml:"hostname,omitempty"`
+	ResolvConf          ResolvConf           `yaml:"resolvConf,omitempty"`
+	HostsEntries        []HostsEntry         `yaml:"hostsEntries,omitempty"`
+	ExtraFstabEntries   []string             `yaml:"extraFstabEntries,omitempty"`
+	ReadOnlyUsr         ReadOnlyUsrConfig    `yaml:"readOnlyUsr,omitempty"`
+	Environment         map[string]string    `yaml:"environment,omitempty"` // variables appended to /etc/environment
+	SystemdDropIns      []SystemdDropIn      `yaml:"systemdDropIns,omitempty"`
+	Immutability        ImmutabilityConfig   `yaml:"immutability,omitempty"`
+	Users               []UserConfig         `yaml:"users,omitempty"`
+	SSH                 SSHConfig            `yaml:"ssh,omitempty"`
+	Bootloader          Bootloader           `yaml:"bootloader"`
+	Packages            []string             `yaml:"packages"`
+	PackageFiles        []string             `yaml:"packageFiles,omitempty"`
+	ArchPackages        map[string][]string  `yaml:"archPackages,omitempty"` // extra packages per target architecture
+	RemovePackages      []string             `yaml:"removePackages,omitempty"`
+	PkgManagerOptions   []string             `yaml:"packageManagerOptions,omitempty"` // extra options of the apt-get, dnf or tdnf install commands
+	BulkInstall         bool                 `yaml:"bulkInstall,omitempty"`           // install the packages of each install order band in one transaction
+	LicensePolicy       LicensePolicy        `yaml:"licensePolicy,omitempty"`
+	VerifyFiles         FileVerification     `yaml:"verifyFiles,omitempty"`
+	Slim                SlimOptions          `yaml:"slim,omitempty"`
+	AdditionalFiles     []AdditionalFileInfo `yaml:"additionalFiles"`
+	Configurations      []ConfigurationInfo  `yaml:"configurations"`
+	PreInstallCommands  []string             `yaml:"preInstallCommands,omitempty"`
+	PostInstallCommands []string             `yaml:"postInstallCommands,omitempty"`
+	Kernel              KernelConfig         `yaml:"kernel"`
+}
+
+// LicensePolicy lists the license classes (see manifest.LicenseClassNames)
+// that fail the build when a package installed in the image has one of them
+type LicensePolicy struct {
+	Deny []string `yaml:"deny,omitempty"`
+}
+
+// FileVerification checks the files installed in the image against their
+// package metadata (rpm -V or dpkg --verify) once the installation is
+// complete, failing the build on files that differ and are not allowed to
+type FileVerification struct {
+	Enabled          bool     `yaml:"enabled,omitempty"`
+	AllowConfigFiles bool     `yaml:"allowConfigFiles,omitempty"` // tolerate changes to files the packages mark as configuration
+	Allow            []string `yaml:"allow,omitempty"`            // path globs allowed to differ; a trailing "/**" covers a whole directory
+}
+
+// SlimOptions drop documentation and unused locales from the image to make it
+// smaller. They are excluded from the package installation, and whatever was
+// installed anyway is removed once it is done
+type SlimOptions struct {
+	StripDocs   bool     `yaml:"stripDocs,omitempty"`   // drop /usr/share/doc, man and info pages
+	KeepLocales []string `yaml:"keepLocales,omitempty"` // locales to keep, e.g. en_US.UTF-8; all other locale translations are dropped
+}
+
+// ReadOnlyUsrConfig mounts /usr read-only in the booted image, leaving the
+// rest of the root filesystem writable. The /usr directories that must stay
+// writable get an overlay whose writable layer is on a tmpfs, so their changes
+// are lost on reboot. Automatic package updates are turned off in the image
+type ReadOnlyUsrConfig struct {
+	Enabled       bool     `yaml:"enabled,omitempty"`
+	WritablePaths []string `yaml:"writablePaths,omitempty"` // directories under /usr overlaid with a writable layer, e.g. /usr/local
+}
+
+// SSHConfig holds the SSH server settings of the image
+type SSHConfig struct {
+	DisablePasswordAuth bool        `yaml:"disablePasswordAuth,omitempty"` // only allow key-based SSH login
+	HostKeys            SSHHostKeys `yaml:"hostKeys,omitempty"`            // host keys of the SSH server
+}
+
+// SSH host key modes selectable with SSHHostKeys.Mode
+const (
+	SSHHostKeysRegenerate = "regenerate" // keys are removed from the image and generated on its first boot
+	SSHHostKeysInject     = "inject"     // the keys of SSHHostKeys.Keys are installed in the image
+)
+
+// SSHHostKeys selects the host keys of the SSH server of the image. Every
+// system booted from an image would otherwise share the keys generated when
+// the SSH server package was installed during the build
+type SSHHostKeys struct {
+	Mode string   `yaml:"mode,omitempty"` // regenerate (default) or inject
+	Keys []string `yaml:"keys,omitempty"` // private host key files named ssh_host_<type>_key, each with its .pub next to it; relative to the template
+}
+
+// ResolvConf holds static DNS settings of the image, independent of any
+// per-interface network configuration
+type ResolvConf struct {
+	Nameservers []string `yaml:"nameservers,omitempty"` // DNS server IP addresses, in order of preference
+	Search      []string `yaml:"search,omitempty"`      // search domains
+}
+
+// HostsEntry is an extra /etc/hosts line mapping IP to Hostnames
+type HostsEntry struct {
+	IP        string   `yaml:"ip"`
+	Hostnames []string `yaml:"hostnames"`
+}
+
+// SystemdDropIn is a drop-in overriding settings of a systemd unit of the
+// image, written to /etc/systemd/system/<Unit>.d/override.conf
+type SystemdDropIn struct {
+	Unit    string `yaml:"unit"`    // Unit: full unit name, e.g. nginx.service
+	Content string `yaml:"content"` // Content: unit file sections and settings, e.g. "[Service]\nEnvironment=FOO=bar"
 }
 
 // AdditionalFileInfo holds information about local file and final path to be placed in the image
 type AdditionalFileInfo struct {
-	Local string `yaml:"local"` // path to the file on the host system
-	Final string `yaml:"final"` // path where the file should be placed in the image
+	Local string `yaml:"local"`           // path to the file on the host system
+	Final string `yaml:"final"`           // path where the file should be placed in the image
+	Mode  string `yaml:"mode,omitempty"`  // optional octal file mode (e.g., "0600"); defaults to the source file's mode
+	Owner string `yaml:"owner,omitempty"` // optional owner name or uid, resolved inside the image
+	Group string `yaml:"group,omitempty"` // optional group name or gid, resolved inside the image
+	// Archive marks Local as a tar, tar.gz or zip archive that is extracted
+	// into the Final directory instead of being copied as a single file
+	Archive bool `yaml:"archive,omitempty"`
 }
 
 // ConfigurationInfo holds information about instructions to execute during system configuration
@@ -178,7 +320,10 @@ type ConfigurationInfo struct {
 type KernelConfig struct {
 	Version            string   `yaml:"version"`
 	Cmdline            string   `yaml:"cmdline"`
+	Package            string   `yaml:"package,omitempty"` // kernel package the image boots, "name" or "name=version", e.g. "kernel-rt"
 	Packages           []string `yaml:"packages"`
+	Firmware           []string `yaml:"firmware,omitempty"`    // firmware packages installed with the kernel, e.g. a linux-firmware subset
+	DKMSModules        []string `yaml:"dkmsModules,omitempty"` // DKMS module packages built against the target kernel, e.g. "v4l2loopback-dkms"
 	UKI                bool     `yaml:"uki,omitempty"`
 	EnableExtraModules string   `yaml:"enableExtraModules"`
 }
@@ -195,14 +340,28 @@ type PartitionInfo struct {
 	FsLabel      string   `yaml:"fsLabel"`         // FsLabel: filesystem label (e.g., "cloudimg-rootfs")
 	Start        string   `yaml:"start"`           // Start: start offset of the partition; can be a absolute size (e.g., "512MiB")
 	End          string   `yaml:"end"`             // End: end offset of the partition; can be a absolute size (e.g., "2GiB") or "0" for the end of the disk
+	Grow         bool     `yaml:"grow,omitempty"`  // Grow: the partition fills the remaining space of the disk, like an end of "0"
 	MountPoint   string   `yaml:"mountPoint"`      // MountPoint: optional mount point for the partition (e.g., "/boot", "/rootfs")
 	MountOptions string   `yaml:"mountOptions"`    // MountOptions: optional mount options for the partition (e.g., "defaults", "noatime")
 }
 
+// FillsRemaining reports whether the partition grows to fill the remaining
+// space of the disk, set with grow or an end of "0".
+func (p PartitionInfo) FillsRemaining() bool {
+	return p.Grow || p.End == "0"
+}
+
 var log = logger.Logger()
 
 // LoadTemplate loads an ImageTemplate from the specified YAML template path
 func LoadTemplate(path string, validateFull bool) (*ImageTemplate, error) {
+	return LoadTemplateWithOverrides(path, validateFull, nil)
+}
+
+// LoadTemplateWithOverrides loads a template and applies "key=value" overrides
+// (see TemplateOverrideKeys) to it before schema validation, so an override
+// that produces an invalid target is rejected like an invalid template file.
+func LoadTemplateWithOverrides(path string, validateFull bool, overrides []string) (*ImageTemplate, error) {
 
 	// Use safe file reading to prevent symlink attacks
 	data, err := security.SafeReadFile(path, security.RejectSymlinks)
@@ -218,11 +377,26 @@ func LoadTemplate(path string, validateFull bool) (*ImageTemplate, error) {
 		return nil, fmt.Errorf("unsupported file format: %s (only .yml and .yaml are supported)", ext)
 	}
 
+	if len(overrides) > 0 {
+		data, err = applyTemplateOverrides(data, overrides)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	template, err := parseYAMLTemplate(data, validateFull)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load template: %w", err)
 	}
 
+	if err := template.loadPackageFiles(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("failed to load template: %w", err)
+	}
+	template.resolveArchPackages()
+	if err := template.resolveSSHHostKeyFiles(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("failed to load template: %w", err)
+	}
+
 	// Store the template path info
 	if !slice.Contains(template.PathList, path) {
 		template.PathList = append(template.PathList, path)
@@ -233,6 +407,137 @@ func LoadTemplate(path string, validateFull bool) (*ImageTemplate, error) {
 	return template, nil
 }
 
+// packageNamePattern mirrors the systemConfig.packages item pattern in the
+// template schema, for package names read from packageFiles.
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+_.:~*?\[\]-]*$`)
+
+// loadPackageFiles reads the package-list files referenced by
+// systemConfig.packageFiles and merges their entries into
+// systemConfig.packages. Relative paths are resolved against templateDir.
+// Each file lists one package per line; blank lines and "#" comments are
+// ignored. The references are cleared once expanded.
+func (t *ImageTemplate) loadPackageFiles(templateDir string) error {
+	if len(t.SystemConfig.PackageFiles) == 0 {
+		return nil
+	}
+
+	var filePkgs []string
+	for _, pkgFile := range t.SystemConfig.PackageFiles {
+		pkgFilePath := pkgFile
+		if !filepath.IsAbs(pkgFilePath) {
+			pkgFilePath = filepath.Join(templateDir, pkgFilePath)
+		}
+
+		data, err := security.SafeReadFile(pkgFilePath, security.RejectSymlinks)
+		if err != nil {
+			log.Errorf("Failed to read package file %s: %v", pkgFilePath, err)
+			return fmt.Errorf("failed to read package file %s: %w", pkgFile, err)
+		}
+
+		for lineNum, line := range strings.Split(string(data), "\n") {
+			if idx := strings.Index(line, "#"); idx >= 0 {
+				line = line[:idx]
+			}
+			pkg := strings.TrimSpace(line)
+			if pkg == "" {
+				continue
+			}
+			if !packageNamePattern.MatchString(pkg) {
+				return fmt.Errorf("invalid package name %q in package file %s line %d", pkg, pkgFile, lineNum+1)
+			}
+			filePkgs = append(filePkgs, pkg)
+		}
+		log.Debugf("Loaded package file %s", pkgFilePath)
+	}
+
+	t.SystemConfig.Packages = mergePackages(t.SystemConfig.Packages, filePkgs)
+	t.SystemConfig.PackageFiles = nil
+	return nil
+}
+
+// resolveArchPackages merges the packages systemConfig.archPackages lists for
+// the target architecture into systemConfig.packages, so that one template
+// can be built for several architectures. It runs once the command-line
+// overrides are applied, against the effective target architecture. The
+// per-architecture lists are cleared once resolved.
+func (t *ImageTemplate) resolveArchPackages() {
+	if len(t.SystemConfig.ArchPackages) == 0 {
+		return
+	}
+	if archPkgs := t.SystemConfig.ArchPackages[t.Target.Arch]; len(archPkgs) > 0 {
+		log.Debugf("Adding %d package(s) for architecture %s: %v", len(archPkgs), t.Target.Arch, archPkgs)
+		t.SystemConfig.Packages = mergePackages(t.SystemConfig.Packages, archPkgs)
+	}
+	t.SystemConfig.ArchPackages = nil
+}
+
+// TemplateOverrideKeys lists the template fields that can be overridden from
+// the command line, as dotted YAML paths.
+var TemplateOverrideKeys = []string{"target.arch", "target.dist", "target.imageType"}
+
+// applyTemplateOverrides sets each "key=value" override in the YAML template
+// data and returns the updated YAML. The document is edited as a node tree so
+// every other value keeps its original form. Later overrides of the same key win.
+func applyTemplateOverrides(data []byte, overrides []string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		log.Errorf("Invalid YAML format: template parsing failed: %v", err)
+		return nil, fmt.Errorf("invalid YAML format: template parsing failed: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("cannot apply template overrides: template is not a YAML mapping")
+	}
+
+	for _, override := range overrides {
+		key, value, found := strings.Cut(override, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !found || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid template override %q: expected key=value", override)
+		}
+		if !slice.Contains(TemplateOverrideKeys, key) {
+			return nil, fmt.Errorf("unsupported template override key %q (supported: %s)",
+				key, strings.Join(TemplateOverrideKeys, ", "))
+		}
+
+		node := doc.Content[0]
+		for _, field := range strings.Split(key, ".") {
+			node = yamlMappingChild(node, field)
+		}
+		node.Kind = yaml.ScalarNode
+		node.Tag = "!!str"
+		node.Value = value
+		node.Content = nil
+		log.Infof("Template override: %s=%s", key, value)
+	}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply template overrides: %w", err)
+	}
+	return out, nil
+}
+
+// yamlMappingChild returns the value node for field in a mapping node, adding
+// an empty mapping entry if the field is missing or not itself a mapping.
+func yamlMappingChild(node *yaml.Node, field string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		node.Kind = yaml.MappingNode
+		node.Tag = "!!map"
+		node.Value = ""
+		node.Content = nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == field {
+			return node.Content[i+1]
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: field}, child)
+	return child
+}
+
 // parseYAMLTemplate loads an ImageTemplate from YAML data
 func parseYAMLTemplate(data []byte, validateFull bool) (*ImageTemplate, error) {
 	// Parse YAML to generic interface for validation
@@ -273,6 +578,39 @@ func parseYAMLTemplate(data []byte, validateFull bool) (*ImageTemplate, error) {
 	if err := template.validatePackageRepositories(); err != nil {
 		return nil, err
 	}
+	if err := template.validateNameResolution(); err != nil {
+		return nil, err
+	}
+	if err := template.validateDiskArtifacts(); err != nil {
+		return nil, err
+	}
+	if err := template.validateExtraFstabEntries(); err != nil {
+		return nil, err
+	}
+	if err := template.validatePkgManagerOptions(); err != nil {
+		return nil, err
+	}
+	if err := template.validateReadOnlyUsr(); err != nil {
+		return nil, err
+	}
+	if err := template.validateEnvironment(); err != nil {
+		return nil, err
+	}
+	if err := template.validateSystemdDropIns(); err != nil {
+		return nil, err
+	}
+	if err := template.validateGrowPartitions(); err != nil {
+		return nil, err
+	}
+	if err := template.validateOrphanPartitions(); err != nil {
+		return nil, err
+	}
+	if err := template.validateSSHHostKeys(); err != nil {
+		return nil, err
+	}
+	if err := template.validateShellSafety(); err != nil {
+		return nil, err
+	}
 
 	return &template, nil
 }
@@ -551,6 +889,18 @@ var packageSourcePriority = map[PackageSource]int{
 	PackageSourceEssential:  30,
 }
 
+// PackagesFromSource returns the packages of pkgList that pkgSources
+// attributes to source.
+func PackagesFromSource(pkgList []string, pkgSources map[string]PackageSource, source PackageSource) []string {
+	var pkgs []string
+	for _, pkg := range pkgList {
+		if pkgSources[pkg] == source {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs
+}
+
 // GetPackageSourceMap returns a map of package name to the template section that requested it.
 func (t *ImageTemplate) GetPackageSourceMap() map[string]PackageSource {
 	sources := make(map[string]PackageSource)
@@ -574,6 +924,11 @@ func (t *ImageTemplate) GetPackageSourceMap() map[string]PackageSource {
 	return sources
 }
 
+// GetRemovePackages returns the packages to uninstall after image package installation
+func (t *ImageTemplate) GetRemovePackages() []string {
+	return t.SystemConfig.RemovePackages
+}
+
 func (t *ImageTemplate) GetAdditionalFileInfo() []AdditionalFileInfo {
 	var PathUpdatedList []AdditionalFileInfo
 	if len(t.SystemConfig.AdditionalFiles) == 0 {
@@ -602,10 +957,8 @@ func (t *ImageTemplate) GetAdditionalFileInfo() []AdditionalFileInfo {
 						templateDir := filepath.Dir(path)
 						candidatePath := filepath.Join(templateDir, t.SystemConfig.AdditionalFiles[i].Local)
 						if _, err := os.Stat(candidatePath); err == nil {
-							newFileInfo := AdditionalFileInfo{
-								Local: candidatePath,
-								Final: t.SystemConfig.AdditionalFiles[i].Final,
-							}
+							newFileInfo := t.SystemConfig.AdditionalFiles[i]
+							newFileInfo.Local = candidatePath
 							PathUpdatedList = append(PathUpdatedList, newFileInfo)
 							found = true
 							break
@@ -626,6 +979,16 @@ func (t *ImageTemplate) GetConfigurationInfo() []ConfigurationInfo {
 	return t.SystemConfig.Configurations
 }
 
+// GetPreInstallCommands returns the commands to run before the image packages are installed
+func (t *ImageTemplate) GetPreInstallCommands() []string {
+	return t.SystemConfig.PreInstallCommands
+}
+
+// GetPostInstallCommands returns the commands to run in the image chroot after installation
+func (t *ImageTemplate) GetPostInstallCommands() []string {
+	return t.SystemConfig.PostInstallCommands
+}
+
 // GetKernel returns the kernel configuration from the system configuration
 func (t *ImageTemplate) GetKernel() KernelConfig {
 	return t.SystemConfig.Kernel
@@ -669,6 +1032,33 @@ func (t *ImageTemplate) SaveUpdatedConfigFile(path string) error {
 	return nil
 }
 
+// EffectiveConfig returns the template as it will be built, in format "yaml"
+// or "json". Passwords and secure boot keys are redacted, as in the debug log
+// of the merged template.
+func (t *ImageTemplate) EffectiveConfig(format string) ([]byte, error) {
+	if format != "yaml" && format != "json" {
+		return nil, fmt.Errorf("invalid config format %q (expected yaml|json)", format)
+	}
+	data, err := yaml.Marshal(redactSensitiveData(t))
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling template to YAML: %w", err)
+	}
+	if format == "yaml" {
+		return data, nil
+	}
+
+	// The template only has YAML field names, so convert through a generic value
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error converting template to JSON: %w", err)
+	}
+	out, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error converting template to JSON: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
 // GetImmutability returns the immutability configuration from systemConfig
 func (t *ImageTemplate) GetImmutability() ImmutabilityConfig {
 	return t.SystemConfig.Immutability
@@ -699,6 +1089,12 @@ func (t *ImageTemplate) HasSecureBootDBConfig() bool {
 	return t.SystemConfig.Immutability.HasSecureBootDBConfig()
 }
 
+// IsSecureBootRequested returns whether the image is to be signed for UEFI
+// Secure Boot: immutability is enabled with secure boot DB configuration
+func (t *ImageTemplate) IsSecureBootRequested() bool {
+	return t.IsImmutabilityEnabled() && t.HasSecureBootDBConfig()
+}
+
 // GetImmutability returns the immutability configuration (SystemConfig method)
 func (sc *SystemConfig) GetImmutability() ImmutabilityConfig {
 	return sc.Immutability
@@ -731,7 +1127,21 @@ func (sc *SystemConfig) HasSecureBootDBConfig() bool {
 
 // HasSecureBootDBConfig returns whether any secure boot DB configuration is provided
 func (ic *ImmutabilityConfig) HasSecureBootDBConfig() bool {
-	return ic.SecureBootDBKey != "" || ic.SecureBootDBCrt != "" || ic.SecureBootDBCer != ""
+	return ic.SecureBootDBKey != "" || ic.SecureBootDBKeyURI != "" ||
+		ic.SecureBootDBCrt != "" || ic.SecureBootDBCer != ""
+}
+
+// GetSecureBootSigner returns the secure boot signing backend, defaulting to local key files
+func (ic *ImmutabilityConfig) GetSecureBootSigner() string {
+	if ic.SecureBootSigner == "" {
+		return SecureBootSignerLocal
+	}
+	return ic.SecureBootSigner
+}
+
+// GetSecureBootDBKeyURI returns the PKCS#11 URI of the secure boot DB signing key
+func (ic *ImmutabilityConfig) GetSecureBootDBKeyURI() string {
+	return ic.SecureBootDBKeyURI
 }
 
 // GetSecureBootDBKeyPath returns the secure boot DB private key file path
@@ -818,8 +1228,15 @@ func LoadProviderRepoConfig(targetOS, targetDist string, arch string) ([]Provide
 		return nil, fmt.Errorf("failed to get target OS config directory: %w", err)
 	}
 
-	// Construct path to repo.yml
+	// Prefer the per-arch repo config, falling back to the shared repo.yml
+	// whose repositories declare the arches they provide
 	repoConfigPath := filepath.Join(targetOsConfigDir, "providerconfigs", arch+"_repo.yml")
+	if _, err := os.Stat(repoConfigPath); os.IsNotExist(err) {
+		sharedConfigPath := filepath.Join(targetOsConfigDir, "providerconfigs", "repo.yml")
+		if _, err := os.Stat(sharedConfigPath); err == nil {
+			repoConfigPath = sharedConfigPath
+		}
+	}
 
 	// Read the YAML file
 	yamlData, err := security.SafeReadFile(repoConfigPath, security.RejectSymlinks)
@@ -832,7 +1249,7 @@ func LoadProviderRepoConfig(targetOS, targetDist string, arch string) ([]Provide
 	var repoConfigs ProviderRepoConfigs
 	if err := yaml.Unmarshal(yamlData, &repoConfigs); err == nil && len(repoConfigs.Repositories) > 0 {
 		log.Infof("Loaded provider repo config from %s: %d repositories", repoConfigPath, len(repoConfigs.Repositories))
-		return repoConfigs.Repositories, nil
+		return SelectProviderReposForArch(repoConfigs.Repositories, arch)
 	}
 
 	// Fall back to old single repository format for backward compatibility
@@ -843,7 +1260,58 @@ func LoadProviderRepoConfig(targetOS, targetDist string, arch string) ([]Provide
 	}
 
 	log.Infof("Loaded provider repo config from %s: %s (single repository format)", repoConfigPath, singleRepoConfig.Name)
-	return []ProviderRepoConfig{singleRepoConfig}, nil
+	return SelectProviderReposForArch([]ProviderRepoConfig{singleRepoConfig}, arch)
+}
+
+// normalizeRepoArch maps the RPM architecture names to their Debian
+// equivalents, so repositories may list either form.
+func normalizeRepoArch(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	default:
+		return arch
+	}
+}
+
+// ProvidesArch reports whether the repository serves packages for arch. A
+// repository without an arches list serves every architecture.
+func (prc *ProviderRepoConfig) ProvidesArch(arch string) bool {
+	if len(prc.Arches) == 0 {
+		return true
+	}
+	for _, repoArch := range prc.Arches {
+		if normalizeRepoArch(repoArch) == normalizeRepoArch(arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectProviderReposForArch returns the repositories of repoConfigs that
+// provide arch, or an error listing the offered architectures if none does.
+func SelectProviderReposForArch(repoConfigs []ProviderRepoConfig, arch string) ([]ProviderRepoConfig, error) {
+	var selected []ProviderRepoConfig
+	var offered []string
+	for _, prc := range repoConfigs {
+		if prc.ProvidesArch(arch) {
+			selected = append(selected, prc)
+			continue
+		}
+		log.Debugf("Skipping repository %s, it does not provide architecture %s", prc.Name, arch)
+		for _, repoArch := range prc.Arches {
+			if !slice.Contains(offered, repoArch) {
+				offered = append(offered, repoArch)
+			}
+		}
+	}
+	if len(selected) == 0 && len(repoConfigs) > 0 {
+		return nil, fmt.Errorf("no configured repository provides architecture %s (available: %s)",
+			arch, strings.Join(offered, ", "))
+	}
+	return selected, nil
 }
 
 // ToRepoConfigData returns the unified repo configuration data for both DEB and RPM repositories
@@ -862,17 +1330,18 @@ func (prc *ProviderRepoConfig) ToRepoConfigData(arch string) (repoType, name, ur
 	gpgCheck = prc.GPGCheck
 	repoGPGCheck = prc.RepoGPGCheck
 	enabled = prc.Enabled
-	baseURL = prc.BaseURL
+	// Local directories, such as a mounted vendor ISO, are read through file:// URLs
+	baseURL = ospackage.LocalRepoURL(prc.BaseURL)
 
 	switch strings.ToLower(prc.Type) {
 	case "rpm":
 		// RPM repository configuration (Azure Linux, EMT)
 		// Check if baseURL contains {arch} placeholder for substitution
-		if strings.Contains(prc.BaseURL, "{arch}") {
-			url = strings.ReplaceAll(prc.BaseURL, "{arch}", arch)
+		if strings.Contains(baseURL, "{arch}") {
+			url = strings.ReplaceAll(baseURL, "{arch}", arch)
 		} else {
 			// For repositories without {arch} placeholder, use baseURL as-is (like EMT)
-			url = prc.BaseURL
+			url = baseURL
 		}
 
 		gpgKeyValues := make([]string, 0, len(prc.GPGKeys)+1)
@@ -889,7 +1358,7 @@ func (prc *ProviderRepoConfig) ToRepoConfigData(arch string) (repoType, name, ur
 			if keyURL == "" {
 				continue
 			}
-			if !strings.HasPrefix(keyURL, "http") {
+			if !strings.HasPrefix(keyURL, "http") && !strings.HasPrefix(keyURL, "file:") {
 				keyURL = fmt.Sprintf("%s/%s", url, keyURL)
 			}
 			resolvedKeys = append(resolvedKeys, keyURL)
@@ -903,16 +1372,16 @@ func (prc *ProviderRepoConfig) ToRepoConfigData(arch string) (repoType, name, ur
 
 	case "deb":
 		// DEB repository configuration (eLxr)
-		url = fmt.Sprintf("%s/binary-%s/Packages.gz", prc.BaseURL, arch)
+		url = fmt.Sprintf("%s/binary-%s/Packages.gz", baseURL, arch)
 		gpgKey = prc.PbGPGKey // Use pbGPGKey for DEB repositories
-		pkgPrefix = prc.PkgPrefix
-		releaseFile = prc.ReleaseFile
-		releaseSign = prc.ReleaseSign
+		pkgPrefix = ospackage.LocalRepoURL(prc.PkgPrefix)
+		releaseFile = ospackage.LocalRepoURL(prc.ReleaseFile)
+		releaseSign = ospackage.LocalRepoURL(prc.ReleaseSign)
 
 	default:
 		// Unknown repository type - log warning and default to RPM behavior
 		log.Warnf("Unknown repository type '%s', defaulting to RPM behavior", prc.Type)
-		url = fmt.Sprintf("%s/%s", prc.BaseURL, arch)
+		url = fmt.Sprintf("%s/%s", baseURL, arch)
 		gpgKey = prc.GPGKey
 		pkgPrefix = ""
 		releaseFile = ""
@@ -956,6 +1425,347 @@ func (i *ImmutabilityConfig) WasProvided() bool {
 	return i.wasProvided
 }
 
+// validateNameResolution checks that the nameservers and hosts entries of the
+// system configuration are IP addresses.
+func (t *ImageTemplate) validateNameResolution() error {
+	for _, ns := range t.SystemConfig.ResolvConf.Nameservers {
+		if net.ParseIP(ns) == nil {
+			return fmt.Errorf("invalid nameserver %q in systemConfig.resolvConf: not an IP address", ns)
+		}
+	}
+	for _, entry := range t.SystemConfig.HostsEntries {
+		if net.ParseIP(entry.IP) == nil {
+			return fmt.Errorf("invalid IP %q in systemConfig.hostsEntries: not an IP address", entry.IP)
+		}
+	}
+	return nil
+}
+
+// validateExtraFstabEntries checks that the extra fstab entries of the system
+// configuration have the six fstab fields, with a dump field of 0 or 1 and a
+// pass field of 0, 1 or 2, since they are appended to /etc/fstab as they are.
+func (t *ImageTemplate) validateExtraFstabEntries() error {
+	for _, entry := range t.SystemConfig.ExtraFstabEntries {
+		fields := strings.Fields(entry)
+		if len(fields) != 6 || strings.ContainsAny(entry, "\n\r") {
+			return fmt.Errorf("invalid entry %q in systemConfig.extraFstabEntries: expected 6 fields <spec> <file> <vfstype> <mntops> <freq> <passno> on one line, got %d",
+				entry, len(fields))
+		}
+		if fields[4] != "0" && fields[4] != "1" {
+			return fmt.Errorf("invalid entry %q in systemConfig.extraFstabEntries: dump field must be 0 or 1, got %q", entry, fields[4])
+		}
+		if fields[5] != "0" && fields[5] != "1" && fields[5] != "2" {
+			return fmt.Errorf("invalid entry %q in systemConfig.extraFstabEntries: pass field must be 0, 1 or 2, got %q", entry, fields[5])
+		}
+	}
+	return nil
+}
+
+// readOnlyUsrPathPattern matches the characters allowed in the writable paths
+// of systemConfig.readOnlyUsr, which end up in systemd mount units.
+var readOnlyUsrPathPattern = regexp.MustCompile(`^[A-Za-z0-9._+/-]+$`)
+
+// validateReadOnlyUsr checks that the writable paths of the read-only /usr
+// configuration are directories strictly under /usr, listed once.
+func (t *ImageTemplate) validateReadOnlyUsr() error {
+	readOnlyUsr := t.SystemConfig.ReadOnlyUsr
+	if !readOnlyUsr.Enabled && len(readOnlyUsr.WritablePaths) > 0 {
+		return fmt.Errorf("systemConfig.readOnlyUsr.writablePaths requires systemConfig.readOnlyUsr.enabled")
+	}
+	seen := make(map[string]bool)
+	for _, p := range readOnlyUsr.WritablePaths {
+		if !readOnlyUsrPathPattern.MatchString(p) || filepath.Clean(p) != p || !strings.HasPrefix(p, "/usr/") {
+			return fmt.Errorf("invalid path %q in systemConfig.readOnlyUsr.writablePaths: must be a clean absolute path under /usr", p)
+		}
+		if seen[p] {
+			return fmt.Errorf("duplicate path %q in systemConfig.readOnlyUsr.writablePaths", p)
+		}
+		seen[p] = true
+	}
+	return nil
+}
+
+// environmentNamePattern matches the variable names of systemConfig.environment.
+var environmentNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEnvironment checks that the variables of the system configuration
+// have valid names and values that fit on a double-quoted /etc/environment
+// line.
+func (t *ImageTemplate) validateEnvironment() error {
+	for name, value := range t.SystemConfig.Environment {
+		if !environmentNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q in systemConfig.environment", name)
+		}
+		if strings.ContainsAny(value, "\n\r\"\\") {
+			return fmt.Errorf("invalid value of %s in systemConfig.environment: newlines, double quotes and backslashes are not allowed", name)
+		}
+	}
+	return nil
+}
+
+// systemdUnitNamePattern matches the unit names of systemConfig.systemdDropIns.
+var systemdUnitNamePattern = regexp.MustCompile(
+	`^[A-Za-z0-9:_.\\@-]+\.(service|socket|timer|path|mount|automount|swap|target|slice|scope)$`)
+
+// Patterns of the lines of a systemd drop-in
+var (
+	systemdSectionPattern = regexp.MustCompile(`^\[[A-Za-z][A-Za-z0-9 -]*\]$`)
+	systemdSettingPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*\s*=`)
+)
+
+// validateSystemdDropIns checks that the drop-ins of the system configuration
+// are for valid unit names, one per unit, and hold settings in sections.
+func (t *ImageTemplate) validateSystemdDropIns() error {
+	seen := make(map[string]bool)
+	for _, dropIn := range t.SystemConfig.SystemdDropIns {
+		if !systemdUnitNamePattern.MatchString(dropIn.Unit) {
+			return fmt.Errorf("invalid unit name %q in systemConfig.systemdDropIns", dropIn.Unit)
+		}
+		if seen[dropIn.Unit] {
+			return fmt.Errorf("duplicate drop-in for unit %s in systemConfig.systemdDropIns", dropIn.Unit)
+		}
+		seen[dropIn.Unit] = true
+		if err := validateSystemdDropInContent(dropIn.Content); err != nil {
+			return fmt.Errorf("invalid drop-in for unit %s in systemConfig.systemdDropIns: %w", dropIn.Unit, err)
+		}
+	}
+	return nil
+}
+
+// validateSystemdDropInContent checks that content is made of section
+// headers, settings inside a section, comments and empty lines. A line ending
+// with a backslash continues on the next one.
+func validateSystemdDropInContent(content string) error {
+	inSection, hasSetting, continued := false, false, false
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		wasContinued := continued
+		continued = strings.HasSuffix(line, "\\")
+		switch {
+		case wasContinued:
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continued = false
+		case systemdSectionPattern.MatchString(line):
+			inSection = true
+		case systemdSettingPattern.MatchString(line):
+			if !inSection {
+				return fmt.Errorf("line %d: setting outside of a section: %q", i+1, line)
+			}
+			hasSetting = true
+		default:
+			return fmt.Errorf("line %d: expected a [Section] header, a Key=Value setting or a comment, got %q", i+1, line)
+		}
+	}
+	if !hasSetting {
+		return fmt.Errorf("no settings")
+	}
+	return nil
+}
+
+// unsafePkgManagerOptions are the package manager options, lower case, that
+// systemConfig.packageManagerOptions must not contain: they turn off package
+// signature or digest checks, or change the install root, the repositories or
+// the configuration of the package manager, which the build sets itself.
+var unsafePkgManagerOptions = []string{
+	"gpgcheck",
+	"skipsignature",
+	"skipdigest",
+	"nosignature",
+	"nodigest",
+	"allow-unauthenticated",
+	"allowunauthenticated",
+	"allowinsecurerepositories",
+	"allowdowngradetoinsecurerepositories",
+	"force-yes",
+	"allow-remove-essential",
+	"installroot",
+	"reposdir",
+	"repofrompath",
+	"enablerepo",
+	"disablerepo",
+	"--repo",
+	"--config",
+	"dir::",
+}
+
+// validatePkgManagerOptions checks that the extra package manager options of
+// the system configuration are single shell words starting with "-", so that
+// they are appended to the install commands as options and not as packages,
+// and that none of them is one of unsafePkgManagerOptions.
+func (t *ImageTemplate) validatePkgManagerOptions() error {
+	for _, option := range t.SystemConfig.PkgManagerOptions {
+		if !strings.HasPrefix(option, "-") {
+			return fmt.Errorf("invalid option %q in systemConfig.packageManagerOptions: options must start with \"-\"", option)
+		}
+		if err := security.ValidateShellWord("systemConfig.packageManagerOptions", option); err != nil {
+			return fmt.Errorf("invalid option in %w", err)
+		}
+		lower := strings.ToLower(option)
+		if lower == "-c" || strings.HasPrefix(lower, "-c=") {
+			return fmt.Errorf("option %q in systemConfig.packageManagerOptions is not allowed: the build sets the package manager configuration", option)
+		}
+		for _, unsafe := range unsafePkgManagerOptions {
+			if strings.Contains(lower, unsafe) {
+				return fmt.Errorf("option %q in systemConfig.packageManagerOptions is not allowed: it would turn off package signature checks or override the install root, repositories or configuration the build sets", option)
+			}
+		}
+	}
+	return nil
+}
+
+// sshHostKeyNamePattern matches the file names sshd expects for host keys.
+var sshHostKeyNamePattern = regexp.MustCompile(`^ssh_host_[a-z0-9]+_key$`)
+
+// validateSSHHostKeys checks that host keys are listed exactly when they are
+// injected, and that they are named like the host keys sshd loads, since they
+// are installed under their file names.
+func (t *ImageTemplate) validateSSHHostKeys() error {
+	hostKeys := t.SystemConfig.SSH.HostKeys
+	switch hostKeys.Mode {
+	case "", SSHHostKeysRegenerate:
+		if len(hostKeys.Keys) > 0 {
+			return fmt.Errorf("systemConfig.ssh.hostKeys.keys requires mode %s", SSHHostKeysInject)
+		}
+	case SSHHostKeysInject:
+		if len(hostKeys.Keys) == 0 {
+			return fmt.Errorf("systemConfig.ssh.hostKeys mode %s requires keys", SSHHostKeysInject)
+		}
+	default:
+		return fmt.Errorf("invalid systemConfig.ssh.hostKeys mode %q: expected %s or %s",
+			hostKeys.Mode, SSHHostKeysRegenerate, SSHHostKeysInject)
+	}
+	for _, key := range hostKeys.Keys {
+		if !sshHostKeyNamePattern.MatchString(filepath.Base(key)) {
+			return fmt.Errorf("invalid SSH host key %q in systemConfig.ssh.hostKeys: the file must be named ssh_host_<type>_key", key)
+		}
+	}
+	return nil
+}
+
+// resolveSSHHostKeyFiles resolves the host keys to inject against templateDir
+// and checks that each private key and its .pub file exist, so that a
+// missing key fails the build before it starts.
+func (t *ImageTemplate) resolveSSHHostKeyFiles(templateDir string) error {
+	keys := t.SystemConfig.SSH.HostKeys.Keys
+	for i, key := range keys {
+		if !filepath.IsAbs(key) {
+			keys[i] = filepath.Join(templateDir, key)
+		}
+		for _, keyFile := range []string{keys[i], keys[i] + ".pub"} {
+			if _, err := os.Stat(keyFile); err != nil {
+				return fmt.Errorf("SSH host key file of systemConfig.ssh.hostKeys not found: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetSSHHostKeysMode returns the SSH host key mode of the image,
+// SSHHostKeysRegenerate unless another one is set.
+func (t *ImageTemplate) GetSSHHostKeysMode() string {
+	if t.SystemConfig.SSH.HostKeys.Mode == "" {
+		return SSHHostKeysRegenerate
+	}
+	return t.SystemConfig.SSH.HostKeys.Mode
+}
+
+// validateGrowPartitions checks that at most one partition of the disk fills
+// its remaining space, since the space left by several of them would be
+// ambiguous, and that a growing partition does not also set an explicit end.
+func (t *ImageTemplate) validateGrowPartitions() error {
+	var growID string
+	for _, partition := range t.Disk.Partitions {
+		if partition.Grow && partition.End != "" && partition.End != "0" {
+			return fmt.Errorf("partition %q sets both grow and end %q: a growing partition ends at the end of the disk",
+				partition.ID, partition.End)
+		}
+		if !partition.FillsRemaining() {
+			continue
+		}
+		if growID != "" {
+			return fmt.Errorf("partitions %q and %q both fill the remaining disk space: at most one partition can grow or end at \"0\"",
+				growID, partition.ID)
+		}
+		growID = partition.ID
+	}
+	return nil
+}
+
+// isSwap reports whether p is a swap partition.
+func (p PartitionInfo) isSwap() bool {
+	return p.FsType == "swap" || p.FsType == "linux-swap"
+}
+
+// isUnmountedByRole reports whether partition is used by the image without
+// being mounted: swap, the BIOS boot partition, the dm-verity hash partition
+// (found by its ID like in validateAndFixImmutabilityConfig), and on a disk
+// with the "ab" layout the slot B copy of another partition, which is left
+// unmounted until an update switches slots.
+func (t *ImageTemplate) isUnmountedByRole(partition PartitionInfo) bool {
+	if partition.isSwap() || partition.isBIOSBoot() {
+		return true
+	}
+	if partition.ID == "roothashmap" || partition.ID == "hash" {
+		return true
+	}
+	if slotA, ok := strings.CutSuffix(partition.ID, "_b"); ok && t.Disk.Layout == DiskLayoutAB {
+		for _, p := range t.Disk.Partitions {
+			if p.ID == slotA {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateOrphanPartitions checks that every partition of the disk is used by
+// the image: a partition without a mount point and without a role that uses
+// it unmounted would be created and then silently left unused, and of two
+// partitions with the same mount point one would be hidden by the other. A
+// partition meant to stay unmounted sets its mount point to "none".
+func (t *ImageTemplate) validateOrphanPartitions() error {
+	mountedBy := make(map[string]string)
+	for _, partition := range t.Disk.Partitions {
+		mountPoint := strings.TrimSpace(partition.MountPoint)
+		// Swap is never mounted, whatever its mount point says
+		if mountPoint == "none" || partition.isSwap() {
+			continue
+		}
+		if mountPoint == "" {
+			if t.isUnmountedByRole(partition) {
+				continue
+			}
+			return fmt.Errorf("partition %q is never mounted or used by the image: set its mountPoint, or mountPoint \"none\" to leave it unmounted on purpose",
+				partition.ID)
+		}
+		mountPoint = filepath.Clean(mountPoint)
+		if id, ok := mountedBy[mountPoint]; ok {
+			return fmt.Errorf("partitions %q and %q are both mounted at %s: the first one would be hidden by the second",
+				id, partition.ID, mountPoint)
+		}
+		mountedBy[mountPoint] = partition.ID
+	}
+	return nil
+}
+
+// validateDiskArtifacts checks that the disk artifacts are consistent with
+// the image type: only raw images are converted to disk artifacts, so any
+// other image type defining them is rejected rather than silently ignored.
+func (t *ImageTemplate) validateDiskArtifacts() error {
+	if len(t.Disk.Artifacts) == 0 {
+		return nil
+	}
+	switch t.Target.ImageType {
+	case "", "raw":
+		return nil
+	case "iso":
+		return fmt.Errorf("imageType iso cannot define disk artifacts: iso images are not built from a disk")
+	default:
+		return fmt.Errorf("disk artifacts %s are inconsistent with imageType %s: only raw images produce disk artifacts",
+			t.Disk.Artifacts[0].Type, t.Target.ImageType)
+	}
+}
+
 func (t *ImageTemplate) validatePackageRepositories() error {
 	for _, repo := range t.PackageRepositories {
 		if err := repo.ValidatePackageRepository(); err != nil {
@@ -974,5 +1784,29 @@ func (pr *PackageRepository) ValidatePackageRepository() error {
 	if pr.URL != "" && pr.Path != "" {
 		return fmt.Errorf("repository '%s': cannot specify both 'url' and 'path', choose one", pr.Codename)
 	}
+	return pr.validateSignedBy()
+}
+
+// validateSignedBy checks that a repository verified with an existing keyring
+// does not also name keys to download.
+func (pr *PackageRepository) validateSignedBy() error {
+	if pr.SignedBy == "" {
+		return nil
+	}
+	if pr.PKey != "" || len(pr.PKeys) > 0 {
+		return fmt.Errorf("repository '%s': cannot specify both 'pkey' and 'signedBy', choose one", pr.Codename)
+	}
+	if !filepath.IsAbs(pr.SignedBy) {
+		return fmt.Errorf("repository '%s': 'signedBy' must be an absolute keyring path, got %q", pr.Codename, pr.SignedBy)
+	}
 	return nil
 }
+
+// ReleaseKey returns the key the repository metadata is verified with: the
+// pkey URL or path, or else the signedBy keyring.
+func (pr PackageRepository) ReleaseKey() string {
+	if pr.PKey != "" {
+		return pr.PKey
+	}
+	return pr.SignedBy
+}
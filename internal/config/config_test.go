@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -1157,6 +1158,114 @@ func TestLoadNonExistentFile(t *testing.T) {
 	}
 }
 
+func TestLoadTemplateWithPackageFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "packages"), 0700); err != nil {
+		t.Fatalf("failed to create packages dir: %v", err)
+	}
+	baseList := "# base packages\nopenssh-server\n\ncurl   # for downloads\nvim\n"
+	debugList := "  gdb\ncurl\n# strace is optional\nstrace\n"
+	if err := os.WriteFile(filepath.Join(dir, "packages", "base.list"), []byte(baseList), 0600); err != nil {
+		t.Fatalf("failed to write base.list: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "debug.list"), []byte(debugList), 0600); err != nil {
+		t.Fatalf("failed to write debug.list: %v", err)
+	}
+
+	yamlContent := `image:
+  name: test-image
+  version: "1.0.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  packages:
+    - vim
+    - bash
+  packageFiles:
+    - packages/base.list
+    - debug.list
+`
+	templatePath := filepath.Join(dir, "template.yml")
+	if err := os.WriteFile(templatePath, []byte(yamlContent), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	template, err := LoadTemplate(templatePath, false)
+	if err != nil {
+		t.Fatalf("failed to load template: %v", err)
+	}
+
+	expected := []string{"vim", "bash", "openssh-server", "curl", "gdb", "strace"}
+	if strings.Join(template.SystemConfig.Packages, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected packages %v, got %v", expected, template.SystemConfig.Packages)
+	}
+	if len(template.SystemConfig.PackageFiles) != 0 {
+		t.Errorf("expected package file references to be cleared, got %v", template.SystemConfig.PackageFiles)
+	}
+}
+
+func TestLoadTemplateWithMissingPackageFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlContent := `image:
+  name: test-image
+  version: "1.0.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  packageFiles:
+    - missing.list
+`
+	templatePath := filepath.Join(dir, "template.yml")
+	if err := os.WriteFile(templatePath, []byte(yamlContent), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	_, err := LoadTemplate(templatePath, false)
+	if err == nil {
+		t.Fatal("expected error for missing package file")
+	}
+	if !strings.Contains(err.Error(), "missing.list") {
+		t.Errorf("expected error to name the missing package file, got: %v", err)
+	}
+}
+
+func TestLoadTemplateWithInvalidPackageFileEntry(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad.list"), []byte("vim\nrm -rf /\n"), 0600); err != nil {
+		t.Fatalf("failed to write bad.list: %v", err)
+	}
+	yamlContent := `image:
+  name: test-image
+  version: "1.0.0"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  packageFiles:
+    - bad.list
+`
+	templatePath := filepath.Join(dir, "template.yml")
+	if err := os.WriteFile(templatePath, []byte(yamlContent), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	_, err := LoadTemplate(templatePath, false)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected invalid package name error on line 2, got: %v", err)
+	}
+}
+
 func TestLoadInvalidYAML(t *testing.T) {
 	invalidYAML := `
 image:
@@ -1669,6 +1778,44 @@ func TestMergeUserConfigHashAlgoOnly(t *testing.T) {
 	}
 }
 
+func TestMergeUserConfigLocked(t *testing.T) {
+	defaultUser := UserConfig{
+		Name:     "root",
+		Password: "defaultpass",
+		HashAlgo: "sha512",
+	}
+
+	// User locks the default account
+	merged := mergeUserConfig(defaultUser, UserConfig{Name: "root", Locked: true})
+
+	if !merged.Locked {
+		t.Errorf("expected merged user to be locked")
+	}
+	if merged.Password != "" || merged.HashAlgo != "" {
+		t.Errorf("expected a locked user to keep no password, got password %q and hash algo %q", merged.Password, merged.HashAlgo)
+	}
+}
+
+func TestValidateLockedUserTemplateJSON(t *testing.T) {
+	lockedUserTemplate := `{
+		"image": {"name": "test", "version": "1.0.0"},
+		"target": {"os": "azure-linux", "dist": "azl3", "arch": "x86_64", "imageType": "raw"},
+		"systemConfig": {
+			"name": "test",
+			"users": [{"name": "root", "locked": true}],
+			"ssh": {"disablePasswordAuth": true}
+		}
+	}`
+	if err := validate.ValidateUserTemplateJSON([]byte(lockedUserTemplate)); err != nil {
+		t.Errorf("locked user template should pass validation: %v", err)
+	}
+
+	lockedWithPassword := strings.Replace(lockedUserTemplate, `"locked": true`, `"locked": true, "password": "secret"`, 1)
+	if err := validate.ValidateUserTemplateJSON([]byte(lockedWithPassword)); err == nil {
+		t.Errorf("locked user with a password should fail validation")
+	}
+}
+
 func TestUserMergingOverrideExisting(t *testing.T) {
 	// Test that user merging properly overrides existing users by name
 	defaultUsers := []UserConfig{
@@ -2244,6 +2391,41 @@ func TestGlobalConfigValidate(t *testing.T) {
 	}
 }
 
+func TestPrepareWorkDir(t *testing.T) {
+	tempDir := t.TempDir()
+
+	workDir, err := PrepareWorkDir(filepath.Join(tempDir, "builds", "a"))
+	if err != nil {
+		t.Fatalf("PrepareWorkDir failed: %v", err)
+	}
+	if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+		t.Errorf("expected work directory %s to be created, got %v", workDir, err)
+	}
+	if entries, _ := os.ReadDir(workDir); len(entries) != 0 {
+		t.Errorf("expected the write check to leave no files behind, got %d entries", len(entries))
+	}
+
+	t.Chdir(tempDir)
+	workDir, err = PrepareWorkDir("relative")
+	if err != nil {
+		t.Fatalf("PrepareWorkDir failed for a relative path: %v", err)
+	}
+	if !filepath.IsAbs(workDir) || filepath.Base(workDir) != "relative" {
+		t.Errorf("expected an absolute path ending in relative, got %s", workDir)
+	}
+
+	filePath := filepath.Join(tempDir, "file")
+	if err := os.WriteFile(filePath, []byte("x"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := PrepareWorkDir(filePath); err == nil || !strings.Contains(err.Error(), "is not a directory") {
+		t.Errorf("expected not a directory error, got %v", err)
+	}
+	if _, err := PrepareWorkDir(" "); err == nil || !strings.Contains(err.Error(), "cannot be empty") {
+		t.Errorf("expected empty work directory error, got %v", err)
+	}
+}
+
 func TestLoadGlobalConfigFromFile(t *testing.T) {
 	// Create test config file
 	configContent := "workers: 6\n" +
@@ -2447,6 +2629,105 @@ systemConfig:
 	}
 }
 
+func TestParseYAMLTemplateNameResolution(t *testing.T) {
+	templateFor := func(nameserver, hostIP string) []byte {
+		return []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  resolvConf:
+    nameservers: ["` + nameserver + `"]
+    search: [corp.example.com]
+  hostsEntries:
+    - ip: "` + hostIP + `"
+      hostnames: [registry.corp.example.com, registry]
+`)
+	}
+
+	template, err := parseYAMLTemplate(templateFor("10.0.0.53", "10.0.0.10"), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	if got := template.SystemConfig.ResolvConf; !reflect.DeepEqual(got.Nameservers, []string{"10.0.0.53"}) ||
+		!reflect.DeepEqual(got.Search, []string{"corp.example.com"}) {
+		t.Errorf("unexpected resolvConf %+v", got)
+	}
+	wantHosts := []HostsEntry{{IP: "10.0.0.10", Hostnames: []string{"registry.corp.example.com", "registry"}}}
+	if !reflect.DeepEqual(template.SystemConfig.HostsEntries, wantHosts) {
+		t.Errorf("hostsEntries = %+v, want %+v", template.SystemConfig.HostsEntries, wantHosts)
+	}
+
+	if _, err := parseYAMLTemplate(templateFor("dns.example.com", "10.0.0.10"), false); err == nil ||
+		!strings.Contains(err.Error(), "invalid nameserver") {
+		t.Errorf("expected invalid nameserver error, got %v", err)
+	}
+	if _, err := parseYAMLTemplate(templateFor("10.0.0.53", "10.0.0"), false); err == nil ||
+		!strings.Contains(err.Error(), "invalid IP") {
+		t.Errorf("expected invalid hosts entry IP error, got %v", err)
+	}
+
+	merged := mergeSystemConfig(
+		SystemConfig{
+			ResolvConf:   ResolvConf{Nameservers: []string{"1.1.1.1"}},
+			HostsEntries: []HostsEntry{{IP: "127.0.1.1", Hostnames: []string{"edge"}}},
+		},
+		template.SystemConfig,
+	)
+	if !reflect.DeepEqual(merged.ResolvConf, template.SystemConfig.ResolvConf) {
+		t.Errorf("expected user resolvConf to replace the default, got %+v", merged.ResolvConf)
+	}
+	if len(merged.HostsEntries) != 2 || merged.HostsEntries[0].IP != "127.0.1.1" || merged.HostsEntries[1].IP != "10.0.0.10" {
+		t.Errorf("expected user hosts entries after the default ones, got %+v", merged.HostsEntries)
+	}
+}
+
+func TestParseYAMLTemplateDiskArtifacts(t *testing.T) {
+	templateFor := func(imageType string) []byte {
+		return []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: ` + imageType + `
+disk:
+  name: test
+  artifacts:
+    - type: raw
+      compression: gz
+    - type: qcow2
+systemConfig:
+  name: test
+`)
+	}
+
+	template, err := parseYAMLTemplate(templateFor("raw"), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed for a raw image with disk artifacts: %v", err)
+	}
+	if len(template.Disk.Artifacts) != 2 || template.Disk.Artifacts[1].Type != "qcow2" {
+		t.Errorf("unexpected disk artifacts %+v", template.Disk.Artifacts)
+	}
+
+	if _, err := parseYAMLTemplate(templateFor("iso"), false); err == nil ||
+		!strings.Contains(err.Error(), "iso cannot define disk artifacts") {
+		t.Errorf("expected iso disk artifacts error, got %v", err)
+	}
+	if _, err := parseYAMLTemplate(templateFor("img"), false); err == nil ||
+		!strings.Contains(err.Error(), "inconsistent with imageType img") {
+		t.Errorf("expected inconsistent image type error, got %v", err)
+	}
+}
+
 func TestLoadTemplateRejectsInvalidPackageRepository(t *testing.T) {
 	yamlContent := `image:
   name: test-invalid-repo
@@ -2496,6 +2777,100 @@ systemConfig:
 	}
 }
 
+func TestLoadTemplateWithOverrides(t *testing.T) {
+	yamlContent := `image:
+  name: test-overrides
+  version: "1.0"
+
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+
+systemConfig:
+  name: test
+  packages:
+    - test-package
+  kernel:
+    version: "6.12"
+    cmdline: "quiet"
+`
+	templatePath := filepath.Join(t.TempDir(), "overrides.yml")
+	if err := os.WriteFile(templatePath, []byte(yamlContent), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		overrides     []string
+		expected      TargetInfo
+		errorContains string
+	}{
+		{
+			name:      "no overrides",
+			overrides: nil,
+			expected:  TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+		},
+		{
+			name:      "override arch dist and image type",
+			overrides: []string{"target.arch=aarch64", "target.dist=ubuntu26", "target.imageType=img"},
+			expected:  TargetInfo{OS: "ubuntu", Dist: "ubuntu26", Arch: "aarch64", ImageType: "img"},
+		},
+		{
+			name:      "last override of a key wins",
+			overrides: []string{"target.arch=aarch64", "target.arch=x86_64"},
+			expected:  TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+		},
+		{
+			name:          "dist not valid for os",
+			overrides:     []string{"target.dist=azl3"},
+			errorContains: "template validation error",
+		},
+		{
+			name:          "unknown arch",
+			overrides:     []string{"target.arch=riscv64"},
+			errorContains: "template validation error",
+		},
+		{
+			name:          "unsupported key",
+			overrides:     []string{"image.name=other"},
+			errorContains: "unsupported template override key",
+		},
+		{
+			name:          "missing value",
+			overrides:     []string{"target.arch"},
+			errorContains: "expected key=value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := LoadTemplateWithOverrides(templatePath, false, tt.overrides)
+			if tt.errorContains != "" {
+				if err == nil {
+					t.Fatalf("expected error containing %q, got none", tt.errorContains)
+				}
+				if !strings.Contains(err.Error(), tt.errorContains) {
+					t.Errorf("expected error containing %q, got: %v", tt.errorContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if template.Target != tt.expected {
+				t.Errorf("expected target %+v, got %+v", tt.expected, template.Target)
+			}
+			// Values that were not overridden keep their original form
+			if template.Image.Version != "1.0" || template.SystemConfig.Kernel.Version != "6.12" {
+				t.Errorf("expected untouched fields to be preserved, got version %q kernel %q",
+					template.Image.Version, template.SystemConfig.Kernel.Version)
+			}
+		})
+	}
+}
+
 func TestGlobalConfigSaveWithCreateDirectory(t *testing.T) {
 	config := &GlobalConfig{
 		Workers:   4,
@@ -3527,6 +3902,26 @@ func TestImmutabilityConfigMethodsEmpty(t *testing.T) {
 	if ic.GetSecureBootDBCerPath() != "" {
 		t.Errorf("GetSecureBootDBCerPath() = %s, want empty", ic.GetSecureBootDBCerPath())
 	}
+	if ic.GetSecureBootSigner() != SecureBootSignerLocal {
+		t.Errorf("GetSecureBootSigner() = %s, want %s", ic.GetSecureBootSigner(), SecureBootSignerLocal)
+	}
+}
+
+func TestImmutabilityConfigMethodsPKCS11(t *testing.T) {
+	ic := ImmutabilityConfig{
+		Enabled:            true,
+		SecureBootSigner:   SecureBootSignerPKCS11,
+		SecureBootDBKeyURI: "pkcs11:token=sb;object=db",
+	}
+	if !ic.HasSecureBootDBConfig() {
+		t.Error("HasSecureBootDBConfig() = false, want true")
+	}
+	if ic.GetSecureBootSigner() != SecureBootSignerPKCS11 {
+		t.Errorf("GetSecureBootSigner() = %s, want %s", ic.GetSecureBootSigner(), SecureBootSignerPKCS11)
+	}
+	if ic.GetSecureBootDBKeyURI() != "pkcs11:token=sb;object=db" {
+		t.Errorf("GetSecureBootDBKeyURI() = %s, want pkcs11:token=sb;object=db", ic.GetSecureBootDBKeyURI())
+	}
 }
 
 func TestSystemConfigImmutabilityHelpers(t *testing.T) {
@@ -3949,6 +4344,69 @@ func TestUnifiedRepoConfig(t *testing.T) {
 	}
 }
 
+// TestLoadProviderRepoConfigArches verifies that a shared repo config whose
+// repository declares the arches it provides yields the Packages URL of the
+// target arch, and that a target arch no repository offers is rejected
+func TestLoadProviderRepoConfigArches(t *testing.T) {
+	originalGlobal := Global()
+	defer SetGlobal(originalGlobal)
+
+	configDir := t.TempDir()
+	providerDir := filepath.Join(configDir, "osv", "test-os", "test-dist", "providerconfigs")
+	if err := os.MkdirAll(providerDir, 0755); err != nil {
+		t.Fatalf("Failed to create provider config directory: %v", err)
+	}
+	repoYAML := `repositories:
+  - name: "aria"
+    type: "deb"
+    baseURL: "https://mirror.example.com/elxr/dists/aria/main"
+    arches: ["amd64", "arm64"]
+`
+	if err := os.WriteFile(filepath.Join(providerDir, "repo.yml"), []byte(repoYAML), 0644); err != nil {
+		t.Fatalf("Failed to write repo config: %v", err)
+	}
+	SetGlobal(&GlobalConfig{ConfigDir: configDir})
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		t.Run(arch, func(t *testing.T) {
+			repos, err := LoadProviderRepoConfig("test-os", "test-dist", arch)
+			if err != nil {
+				t.Fatalf("LoadProviderRepoConfig failed: %v", err)
+			}
+			if len(repos) != 1 {
+				t.Fatalf("Expected 1 repository, got %d", len(repos))
+			}
+			_, _, url, _, _, _, _, _, _, _, _, _, _ := repos[0].ToRepoConfigData(arch)
+			expectedURL := "https://mirror.example.com/elxr/dists/aria/main/binary-" + arch + "/Packages.gz"
+			if url != expectedURL {
+				t.Errorf("Expected URL %s, got %s", expectedURL, url)
+			}
+		})
+	}
+
+	_, err := LoadProviderRepoConfig("test-os", "test-dist", "riscv64")
+	if err == nil {
+		t.Fatal("Expected an error for an architecture no repository provides")
+	}
+	if !strings.Contains(err.Error(), "no configured repository provides architecture riscv64 (available: amd64, arm64)") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestProviderRepoConfigProvidesArch(t *testing.T) {
+	repo := ProviderRepoConfig{Name: "aria", Arches: []string{"amd64", "arm64"}}
+	for arch, expected := range map[string]bool{
+		"amd64": true, "x86_64": true, "arm64": true, "aarch64": true, "riscv64": false,
+	} {
+		if got := repo.ProvidesArch(arch); got != expected {
+			t.Errorf("ProvidesArch(%s) = %v, expected %v", arch, got, expected)
+		}
+	}
+	if !(&ProviderRepoConfig{Name: "any"}).ProvidesArch("riscv64") {
+		t.Error("Expected a repository without arches to provide every architecture")
+	}
+}
+
 // TestGetAdditionalFileInfo tests the GetAdditionalFileInfo method
 func TestGetAdditionalFileInfo(t *testing.T) {
 	// Create temporary test files
@@ -4046,6 +4504,35 @@ func TestGetAdditionalFileInfo(t *testing.T) {
 	}
 }
 
+// TestGetAdditionalFileInfoKeepsAttributes verifies mode and ownership survive path resolution
+func TestGetAdditionalFileInfoKeepsAttributes(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "keys"), []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	template := &ImageTemplate{
+		PathList: []string{filepath.Join(tmpDir, "template.yml")},
+		SystemConfig: SystemConfig{
+			AdditionalFiles: []AdditionalFileInfo{
+				{Local: "keys", Final: "/root/.ssh/authorized_keys", Mode: "0600", Owner: "root", Group: "root"},
+			},
+		},
+	}
+
+	result := template.GetAdditionalFileInfo()
+	if len(result) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(result))
+	}
+	got := result[0]
+	if got.Local != filepath.Join(tmpDir, "keys") {
+		t.Errorf("expected resolved local path, got %s", got.Local)
+	}
+	if got.Mode != "0600" || got.Owner != "root" || got.Group != "root" {
+		t.Errorf("expected mode/owner/group to be preserved, got %+v", got)
+	}
+}
+
 // TestWasProvided tests the WasProvided method for ImmutabilityConfig
 func TestWasProvided(t *testing.T) {
 	tests := []struct {
@@ -4425,3 +4912,654 @@ func TestSaveUpdatedConfigFileYAMLSerialization(t *testing.T) {
 		t.Error("YAML should not contain 'index: null' for partition with nil Index")
 	}
 }
+
+func TestParseYAMLTemplateExtraFstabEntries(t *testing.T) {
+	templateFor := func(entries ...string) []byte {
+		var b strings.Builder
+		b.WriteString(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  extraFstabEntries:
+`)
+		for _, entry := range entries {
+			b.WriteString("    - \"" + entry + "\"\n")
+		}
+		return []byte(b.String())
+	}
+
+	valid := []string{
+		"tmpfs /tmp tmpfs defaults,nosuid,nodev,size=512M 0 0",
+		"/data/logs /var/log none bind 0 0",
+		"nfs.example.com:/export /mnt/nfs nfs4 defaults,_netdev 0 0",
+	}
+	template, err := parseYAMLTemplate(templateFor(valid...), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	if !reflect.DeepEqual(template.SystemConfig.ExtraFstabEntries, valid) {
+		t.Errorf("extraFstabEntries = %v, want %v", template.SystemConfig.ExtraFstabEntries, valid)
+	}
+
+	for _, tt := range []struct {
+		entry   string
+		wantErr string
+	}{
+		{entry: "tmpfs /tmp tmpfs defaults", wantErr: "expected 6 fields"},
+		{entry: "tmpfs /tmp tmpfs defaults 0 0 extra", wantErr: "expected 6 fields"},
+		{entry: "tmpfs /tmp tmpfs defaults 2 0", wantErr: "dump field must be 0 or 1"},
+		{entry: "tmpfs /tmp tmpfs defaults 0 9", wantErr: "pass field must be 0, 1 or 2"},
+		{entry: "tmpfs /tmp tmpfs defaults 0 x", wantErr: "pass field must be 0, 1 or 2"},
+	} {
+		if _, err := parseYAMLTemplate(templateFor(tt.entry), false); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("entry %q: expected error containing %q, got %v", tt.entry, tt.wantErr, err)
+		}
+	}
+
+	merged := mergeSystemConfig(SystemConfig{ExtraFstabEntries: []string{"tmpfs /run/lock tmpfs defaults 0 0"}}, template.SystemConfig)
+	if len(merged.ExtraFstabEntries) != 4 || merged.ExtraFstabEntries[0] != "tmpfs /run/lock tmpfs defaults 0 0" {
+		t.Errorf("expected user fstab entries after the default ones, got %v", merged.ExtraFstabEntries)
+	}
+}
+
+func TestParseYAMLTemplatePkgManagerOptions(t *testing.T) {
+	templateFor := func(options ...string) []byte {
+		var b strings.Builder
+		b.WriteString(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  packageManagerOptions:
+`)
+		for _, option := range options {
+			b.WriteString("    - \"" + option + "\"\n")
+		}
+		return []byte(b.String())
+	}
+
+	valid := []string{"--nobest", "--setopt=throttle=100k", "-oAcquire::http::Dl-Limit=100"}
+	template, err := parseYAMLTemplate(templateFor(valid...), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	if !reflect.DeepEqual(template.SystemConfig.PkgManagerOptions, valid) {
+		t.Errorf("packageManagerOptions = %v, want %v", template.SystemConfig.PkgManagerOptions, valid)
+	}
+
+	for _, tt := range []struct {
+		option  string
+		wantErr string
+	}{
+		{option: "vim", wantErr: "packageManagerOptions"},
+		{option: "--nobest;reboot", wantErr: "shell metacharacter"},
+		{option: "--nogpgcheck", wantErr: "is not allowed"},
+		{option: "--setopt=gpgcheck=0", wantErr: "is not allowed"},
+		{option: "--skipsignature", wantErr: "is not allowed"},
+		{option: "--skipdigest", wantErr: "is not allowed"},
+		{option: "--nosignature", wantErr: "is not allowed"},
+		{option: "--nodigest", wantErr: "is not allowed"},
+		{option: "--allow-unauthenticated", wantErr: "is not allowed"},
+		{option: "-oAPT::Get::AllowUnauthenticated=true", wantErr: "is not allowed"},
+		{option: "-oDir::Etc::sourcelist=/tmp/evil.list", wantErr: "is not allowed"},
+		{option: "--installroot=/", wantErr: "is not allowed"},
+		{option: "--enablerepo=*", wantErr: "is not allowed"},
+		{option: "-c", wantErr: "is not allowed"},
+	} {
+		if _, err := parseYAMLTemplate(templateFor(tt.option), false); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("option %q: expected error containing %q, got %v", tt.option, tt.wantErr, err)
+		}
+	}
+
+	merged := mergeSystemConfig(SystemConfig{PkgManagerOptions: []string{"--setopt=throttle=100k", "--refresh"}}, template.SystemConfig)
+	want := []string{"--setopt=throttle=100k", "--refresh", "--nobest", "-oAcquire::http::Dl-Limit=100"}
+	if !reflect.DeepEqual(merged.PkgManagerOptions, want) {
+		t.Errorf("expected user options after the default ones, got %v, want %v", merged.PkgManagerOptions, want)
+	}
+}
+
+func TestParseYAMLTemplateBulkInstall(t *testing.T) {
+	template, err := parseYAMLTemplate([]byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  bulkInstall: true
+`), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	if !template.SystemConfig.BulkInstall {
+		t.Error("expected bulkInstall to be set")
+	}
+	if merged := mergeSystemConfig(SystemConfig{}, template.SystemConfig); !merged.BulkInstall {
+		t.Error("expected the user bulkInstall to be kept by the merge")
+	}
+	if merged := mergeSystemConfig(SystemConfig{BulkInstall: true}, SystemConfig{Name: "test"}); !merged.BulkInstall {
+		t.Error("expected the default bulkInstall to be kept by the merge")
+	}
+}
+
+func TestParseYAMLTemplateReadOnlyUsr(t *testing.T) {
+	templateFor := func(readOnlyUsr string) []byte {
+		return []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  readOnlyUsr:
+` + readOnlyUsr)
+	}
+
+	template, err := parseYAMLTemplate(templateFor("    enabled: true\n    writablePaths:\n      - /usr/local\n      - /usr/lib/my-app\n"), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	want := ReadOnlyUsrConfig{Enabled: true, WritablePaths: []string{"/usr/local", "/usr/lib/my-app"}}
+	if !reflect.DeepEqual(template.SystemConfig.ReadOnlyUsr, want) {
+		t.Errorf("readOnlyUsr = %+v, want %+v", template.SystemConfig.ReadOnlyUsr, want)
+	}
+
+	for _, tt := range []struct {
+		readOnlyUsr string
+		wantErr     string
+	}{
+		{readOnlyUsr: "    writablePaths:\n      - /usr/local\n", wantErr: "requires systemConfig.readOnlyUsr.enabled"},
+		{readOnlyUsr: "    enabled: true\n    writablePaths:\n      - /var/lib\n", wantErr: "writablePaths"},
+		{readOnlyUsr: "    enabled: true\n    writablePaths:\n      - /usr/../etc\n", wantErr: "must be a clean absolute path under /usr"},
+		{readOnlyUsr: "    enabled: true\n    writablePaths:\n      - /usr/local/\n", wantErr: "must be a clean absolute path under /usr"},
+	} {
+		if _, err := parseYAMLTemplate(templateFor(tt.readOnlyUsr), false); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("readOnlyUsr %q: expected error containing %q, got %v", tt.readOnlyUsr, tt.wantErr, err)
+		}
+	}
+
+	merged := mergeSystemConfig(SystemConfig{ReadOnlyUsr: ReadOnlyUsrConfig{Enabled: true, WritablePaths: []string{"/usr/local"}}},
+		SystemConfig{ReadOnlyUsr: ReadOnlyUsrConfig{WritablePaths: []string{"/usr/lib/my-app"}}})
+	want = ReadOnlyUsrConfig{Enabled: true, WritablePaths: []string{"/usr/local", "/usr/lib/my-app"}}
+	if !reflect.DeepEqual(merged.ReadOnlyUsr, want) {
+		t.Errorf("merged readOnlyUsr = %+v, want %+v", merged.ReadOnlyUsr, want)
+	}
+}
+
+func TestParseYAMLTemplateEnvironmentAndDropIns(t *testing.T) {
+	templateFor := func(systemConfig string) []byte {
+		return []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+` + systemConfig)
+	}
+
+	template, err := parseYAMLTemplate(templateFor(`  environment:
+    HTTP_PROXY: http://proxy.example.com:3128
+    APP_MODE: production
+  systemdDropIns:
+    - unit: nginx.service
+      content: |
+        [Service]
+        # Restart on failure
+        Environment=NGINX_PORT=8080
+        ExecStart=
+        ExecStart=/usr/sbin/nginx \
+          -g 'daemon off;'
+`), false)
+	if err != nil {
+		t.Fatalf("parseYAMLTemplate failed: %v", err)
+	}
+	wantEnv := map[string]string{"HTTP_PROXY": "http://proxy.example.com:3128", "APP_MODE": "production"}
+	if !reflect.DeepEqual(template.SystemConfig.Environment, wantEnv) {
+		t.Errorf("environment = %v, want %v", template.SystemConfig.Environment, wantEnv)
+	}
+	if len(template.SystemConfig.SystemdDropIns) != 1 || template.SystemConfig.SystemdDropIns[0].Unit != "nginx.service" {
+		t.Errorf("unexpected systemdDropIns %+v", template.SystemConfig.SystemdDropIns)
+	}
+
+	for _, tt := range []struct {
+		name         string
+		systemConfig string
+		wantErr      string
+	}{
+		{name: "invalid variable name", systemConfig: "  environment:\n    1FOO: bar\n", wantErr: "environment"},
+		{name: "quote in value", systemConfig: "  environment:\n    FOO: 'a\"b'\n", wantErr: "double quotes"},
+		{name: "unit without type", systemConfig: "  systemdDropIns:\n    - unit: nginx\n      content: \"[Service]\\nUser=www\"\n", wantErr: "invalid unit name"},
+		{name: "unit with path", systemConfig: "  systemdDropIns:\n    - unit: ../nginx.service\n      content: \"[Service]\\nUser=www\"\n", wantErr: "invalid unit name"},
+		{name: "setting outside section", systemConfig: "  systemdDropIns:\n    - unit: nginx.service\n      content: \"User=www\"\n", wantErr: "setting outside of a section"},
+		{name: "malformed line", systemConfig: "  systemdDropIns:\n    - unit: nginx.service\n      content: \"[Service]\\nUser www\"\n", wantErr: "expected a [Section] header"},
+		{name: "no settings", systemConfig: "  systemdDropIns:\n    - unit: nginx.service\n      content: \"[Service]\"\n", wantErr: "no settings"},
+		{
+			name:         "duplicate unit",
+			systemConfig: "  systemdDropIns:\n    - unit: a.service\n      content: \"[Service]\\nUser=a\"\n    - unit: a.service\n      content: \"[Service]\\nUser=b\"\n",
+			wantErr:      "duplicate drop-in",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseYAMLTemplate(templateFor(tt.systemConfig), false); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	merged := mergeSystemConfig(
+		SystemConfig{
+			Environment:    map[string]string{"APP_MODE": "debug", "LANG": "C.UTF-8"},
+			SystemdDropIns: []SystemdDropIn{{Unit: "nginx.service", Content: "[Service]\nUser=nginx"}, {Unit: "sshd.service", Content: "[Service]\nNice=5"}},
+		},
+		template.SystemConfig)
+	wantEnv = map[string]string{"HTTP_PROXY": "http://proxy.example.com:3128", "APP_MODE": "production", "LANG": "C.UTF-8"}
+	if !reflect.DeepEqual(merged.Environment, wantEnv) {
+		t.Errorf("merged environment = %v, want %v", merged.Environment, wantEnv)
+	}
+	if len(merged.SystemdDropIns) != 2 || merged.SystemdDropIns[0].Unit != "sshd.service" ||
+		merged.SystemdDropIns[1].Content != template.SystemConfig.SystemdDropIns[0].Content {
+		t.Errorf("expected the user nginx drop-in to replace the default one, got %+v", merged.SystemdDropIns)
+	}
+}
+
+func TestLoadTemplateWithArchPackages(t *testing.T) {
+	yamlContent := `image:
+  name: test-arch-packages
+  version: "1.0"
+
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+
+systemConfig:
+  name: test
+  packages:
+    - grub-common
+  archPackages:
+    x86_64:
+      - grub-efi-amd64
+      - intel-microcode
+    aarch64:
+      - grub-efi-arm64
+`
+	templatePath := filepath.Join(t.TempDir(), "arch-packages.yml")
+	if err := os.WriteFile(templatePath, []byte(yamlContent), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	tests := []struct {
+		arch     string
+		expected []string
+	}{
+		{arch: "x86_64", expected: []string{"grub-common", "grub-efi-amd64", "intel-microcode"}},
+		{arch: "aarch64", expected: []string{"grub-common", "grub-efi-arm64"}},
+		{arch: "armv7hl", expected: []string{"grub-common"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			template, err := LoadTemplateWithOverrides(templatePath, true, []string{"target.arch=" + tt.arch})
+			if err != nil {
+				t.Fatalf("failed to load template: %v", err)
+			}
+			if !reflect.DeepEqual(template.SystemConfig.Packages, tt.expected) {
+				t.Errorf("packages for %s = %v, want %v", tt.arch, template.SystemConfig.Packages, tt.expected)
+			}
+			if template.SystemConfig.ArchPackages != nil {
+				t.Errorf("expected archPackages to be cleared once resolved, got %v", template.SystemConfig.ArchPackages)
+			}
+		})
+	}
+
+	invalid := strings.Replace(yamlContent, "    aarch64:", "    riscv64:", 1)
+	invalidPath := filepath.Join(t.TempDir(), "invalid-arch.yml")
+	if err := os.WriteFile(invalidPath, []byte(invalid), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+	if _, err := LoadTemplateWithOverrides(invalidPath, true, nil); err == nil || !strings.Contains(err.Error(), "archPackages") {
+		t.Errorf("expected an unknown architecture in archPackages to fail validation, got %v", err)
+	}
+}
+
+func TestParseYAMLTemplateSlimOptions(t *testing.T) {
+	templateFor := func(locale string) []byte {
+		return []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  slim:
+    stripDocs: true
+    keepLocales:
+      - "` + locale + `"
+`)
+	}
+
+	for _, locale := range []string{"en", "en_US", "en_US.UTF-8", "sr_RS@latin"} {
+		template, err := parseYAMLTemplate(templateFor(locale), false)
+		if err != nil {
+			t.Fatalf("parseYAMLTemplate failed for locale %q: %v", locale, err)
+		}
+		want := SlimOptions{StripDocs: true, KeepLocales: []string{locale}}
+		if !reflect.DeepEqual(template.SystemConfig.Slim, want) {
+			t.Errorf("slim = %+v, want %+v", template.SystemConfig.Slim, want)
+		}
+	}
+	for _, locale := range []string{"", "../doc", "en US"} {
+		if _, err := parseYAMLTemplate(templateFor(locale), false); err == nil {
+			t.Errorf("expected locale %q to be rejected", locale)
+		}
+	}
+
+	merged := mergeSystemConfig(
+		SystemConfig{Slim: SlimOptions{KeepLocales: []string{"de_DE.UTF-8"}}},
+		SystemConfig{Slim: SlimOptions{StripDocs: true, KeepLocales: []string{"en_US.UTF-8"}}})
+	want := SlimOptions{StripDocs: true, KeepLocales: []string{"de_DE.UTF-8", "en_US.UTF-8"}}
+	if !reflect.DeepEqual(merged.Slim, want) {
+		t.Errorf("merged slim = %+v, want %+v", merged.Slim, want)
+	}
+}
+
+func TestParseYAMLTemplateOrphanPartitions(t *testing.T) {
+	templateFor := func(layout, partitions string) []byte {
+		return []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+disk:
+  name: test
+  size: 8GiB
+  partitionTableType: gpt
+  layout: ` + layout + `
+  partitions:
+    - {id: esp, start: 1MiB, end: 513MiB, fsType: fat32, mountPoint: /boot/efi}
+    - {id: rootfs, start: 513MiB, end: 3GiB, fsType: ext4, mountPoint: /}
+` + partitions + `
+systemConfig:
+  name: test
+`)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		layout     string
+		partitions string
+		wantErr    string
+	}{
+		{
+			name:       "orphan partition",
+			partitions: `    - {id: data, start: 3GiB, end: 5GiB, fsType: ext4}`,
+			wantErr:    `partition "data" is never mounted or used by the image`,
+		},
+		{
+			name:       "orphan partition marked no-mount",
+			partitions: `    - {id: data, start: 3GiB, end: 5GiB, fsType: ext4, mountPoint: none}`,
+		},
+		{
+			name: "partitions used unmounted",
+			partitions: `    - {id: swap, start: 3GiB, end: 4GiB, fsType: linux-swap}
+    - {id: bios, start: 4GiB, end: 4100MiB, type: bios-boot, flags: [bios_grub]}
+    - {id: roothashmap, start: 4100MiB, end: 4200MiB, fsType: ext4}`,
+		},
+		{
+			name:       "slot B of an A/B layout",
+			layout:     "ab",
+			partitions: `    - {id: rootfs_b, start: 3GiB, end: 6GiB, fsType: ext4}`,
+		},
+		{
+			name:       "slot B suffix outside of an A/B layout",
+			partitions: `    - {id: rootfs_b, start: 3GiB, end: 6GiB, fsType: ext4}`,
+			wantErr:    `partition "rootfs_b" is never mounted or used by the image`,
+		},
+		{
+			name:       "duplicate mount point",
+			partitions: `    - {id: root2, start: 3GiB, end: 6GiB, fsType: ext4, mountPoint: /}`,
+			wantErr:    `partitions "rootfs" and "root2" are both mounted at /`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := tt.layout
+			if layout == "" {
+				layout = "standard"
+			}
+			_, err := parseYAMLTemplate(templateFor(layout, tt.partitions), false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseYAMLTemplate failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLTemplateGrowPartitions(t *testing.T) {
+	templateFor := func(partitions string) []byte {
+		return []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+disk:
+  name: test
+  size: 4GiB
+  partitionTableType: gpt
+  partitions:
+` + partitions + `
+systemConfig:
+  name: test
+`)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		partitions string
+		wantErr    string
+	}{
+		{
+			name: "explicit sizes",
+			partitions: `    - {id: esp, start: 1MiB, end: 513MiB, fsType: fat32, mountPoint: /boot/efi}
+    - {id: rootfs, start: 513MiB, mountPoint: /, end: 3GiB, fsType: ext4}`,
+		},
+		{
+			name: "single grow",
+			partitions: `    - {id: esp, start: 1MiB, end: 513MiB, fsType: fat32, mountPoint: /boot/efi}
+    - {id: rootfs, start: 513MiB, mountPoint: /, grow: true, fsType: ext4}`,
+		},
+		{
+			name: "single end 0",
+			partitions: `    - {id: esp, start: 1MiB, end: 513MiB, fsType: fat32, mountPoint: /boot/efi}
+    - {id: rootfs, start: 513MiB, mountPoint: /, end: "0", fsType: ext4}`,
+		},
+		{
+			name: "two fill-to-end partitions",
+			partitions: `    - {id: rootfs, start: 1MiB, end: "0", fsType: ext4}
+    - {id: data, start: 3GiB, grow: true, fsType: ext4}`,
+			wantErr: `partitions "rootfs" and "data" both fill the remaining disk space`,
+		},
+		{
+			name:       "grow with an explicit end",
+			partitions: `    - {id: rootfs, start: 1MiB, end: 3GiB, grow: true, fsType: ext4}`,
+			wantErr:    `partition "rootfs" sets both grow and end "3GiB"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAMLTemplate(templateFor(tt.partitions), false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseYAMLTemplate failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLTemplateSSHHostKeys(t *testing.T) {
+	templateFor := func(hostKeys string) []byte {
+		return []byte(`
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  ssh:
+    hostKeys:
+` + hostKeys + `
+`)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		hostKeys string
+		wantMode string
+		wantErr  string
+	}{
+		{
+			name:     "regenerate",
+			hostKeys: `      mode: regenerate`,
+			wantMode: SSHHostKeysRegenerate,
+		},
+		{
+			name: "inject",
+			hostKeys: `      mode: inject
+      keys: [keys/ssh_host_ed25519_key]`,
+			wantMode: SSHHostKeysInject,
+		},
+		{
+			name:     "inject without keys",
+			hostKeys: `      mode: inject`,
+			wantErr:  "mode inject requires keys",
+		},
+		{
+			name:     "keys without inject",
+			hostKeys: `      keys: [keys/ssh_host_ed25519_key]`,
+			wantErr:  "systemConfig.ssh.hostKeys.keys requires mode inject",
+		},
+		{
+			name: "badly named key",
+			hostKeys: `      mode: inject
+      keys: [keys/id_ed25519]`,
+			wantErr: `invalid SSH host key "keys/id_ed25519"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := parseYAMLTemplate(templateFor(tt.hostKeys), false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseYAMLTemplate failed: %v", err)
+				}
+				if got := template.GetSSHHostKeysMode(); got != tt.wantMode {
+					t.Errorf("GetSSHHostKeysMode() = %q, want %q", got, tt.wantMode)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if got := (&ImageTemplate{}).GetSSHHostKeysMode(); got != SSHHostKeysRegenerate {
+		t.Errorf("expected SSH host keys to be regenerated by default, got %q", got)
+	}
+}
+
+func TestLoadTemplateResolvesSSHHostKeys(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "keys"), 0755); err != nil {
+		t.Fatalf("failed to create key directory: %v", err)
+	}
+	templatePath := filepath.Join(dir, "template.yml")
+	content := `
+image:
+  name: test
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: test
+  ssh:
+    hostKeys:
+      mode: inject
+      keys: [keys/ssh_host_ed25519_key]
+`
+	if err := os.WriteFile(templatePath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	key := filepath.Join(dir, "keys", "ssh_host_ed25519_key")
+	if err := os.WriteFile(key, []byte("key\n"), 0600); err != nil {
+		t.Fatalf("failed to write host key: %v", err)
+	}
+	if _, err := LoadTemplate(templatePath, false); err == nil || !strings.Contains(err.Error(), "ssh_host_ed25519_key.pub") {
+		t.Errorf("expected an error for the missing public key, got %v", err)
+	}
+
+	if err := os.WriteFile(key+".pub", []byte("key\n"), 0644); err != nil {
+		t.Fatalf("failed to write host public key: %v", err)
+	}
+	template, err := LoadTemplate(templatePath, false)
+	if err != nil {
+		t.Fatalf("LoadTemplate failed: %v", err)
+	}
+	if got := template.SystemConfig.SSH.HostKeys.Keys; len(got) != 1 || got[0] != key {
+		t.Errorf("expected the host key resolved to %s, got %v", key, got)
+	}
+}
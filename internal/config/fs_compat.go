@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+)
+
+// fsToolPackages maps filesystem types to the packages providing their fsck
+// and repair tools, any of which must be in the package set for the
+// filesystem to be checked at boot. fsToolRequired marks the types whose
+// partitions fail to mount at boot without them.
+var (
+	fsToolPackages = map[string][]string{
+		"f2fs":  {"f2fs-tools"},
+		"btrfs": {"btrfs-progs"},
+		"xfs":   {"xfsprogs"},
+	}
+	fsToolRequired = map[string]bool{
+		"f2fs": true,
+	}
+)
+
+// grubBootFsLimitations describes what GRUB does not support on the
+// filesystem types it can only partially handle as the boot filesystem.
+var grubBootFsLimitations = map[string]string{
+	"btrfs": "GRUB cannot write its environment block on btrfs, so saved boot entries and grub-reboot do not work",
+	"xfs":   "GRUB releases before 2.12 cannot read xfs filesystems created with the bigtime or inobtcount features",
+	"f2fs":  "GRUB cannot read f2fs filesystems created with the compression or encryption features",
+}
+
+// fsCompatProblem is an incompatibility between a filesystem of the disk
+// layout and the packages or bootloader of the image. Fatal problems make
+// the image unbootable; the others only break some features.
+type fsCompatProblem struct {
+	fatal   bool
+	message string
+}
+
+// ValidateFilesystemCompat cross-checks the filesystems of the disk layout
+// against the package set and the bootloader, so that a known-incompatible
+// combination is rejected before the image is built. Combinations that only
+// break some features are logged as warnings.
+func (t *ImageTemplate) ValidateFilesystemCompat() error {
+	var fatal []string
+	for _, problem := range t.filesystemCompatProblems() {
+		if problem.fatal {
+			fatal = append(fatal, problem.message)
+		} else {
+			log.Warnf("%s", problem.message)
+		}
+	}
+	if len(fatal) > 0 {
+		return fmt.Errorf("incompatible filesystem configuration: %s", strings.Join(fatal, "; "))
+	}
+	return nil
+}
+
+// filesystemCompatProblems returns the incompatibilities of the mounted
+// partitions with the package set, and of the filesystem the bootloader
+// reads the kernel from, /boot or else the root, with the bootloader.
+func (t *ImageTemplate) filesystemCompatProblems() []fsCompatProblem {
+	pkgNames := make(map[string]bool)
+	for _, pkg := range t.GetPackages() {
+		pkgNames[ospackage.ParsePackageSpec(pkg).Name] = true
+	}
+
+	var problems []fsCompatProblem
+	var rootFsType, bootFsType string
+	for _, partition := range t.Disk.Partitions {
+		mountPoint := strings.TrimSpace(partition.MountPoint)
+		if mountPoint == "" || mountPoint == "none" {
+			continue
+		}
+		switch filepath.Clean(mountPoint) {
+		case "/":
+			rootFsType = partition.FsType
+		case "/boot":
+			bootFsType = partition.FsType
+		}
+
+		tools, ok := fsToolPackages[partition.FsType]
+		if !ok || hasAnyPackage(pkgNames, tools) {
+			continue
+		}
+		problems = append(problems, fsCompatProblem{
+			fatal: fsToolRequired[partition.FsType],
+			message: fmt.Sprintf("partition %q: fsType %s needs the %s package, which is not in the package set",
+				partition.ID, partition.FsType, strings.Join(tools, " or ")),
+		})
+	}
+
+	if bootFsType == "" {
+		bootFsType = rootFsType
+	}
+	if t.GetBootloaderConfig().Provider == "grub" {
+		if limitation, ok := grubBootFsLimitations[bootFsType]; ok {
+			problems = append(problems, fsCompatProblem{
+				message: fmt.Sprintf("/boot on %s: %s", bootFsType, limitation),
+			})
+		}
+	}
+	return problems
+}
+
+// hasAnyPackage reports whether pkgNames contains one of pkgs.
+func hasAnyPackage(pkgNames map[string]bool, pkgs []string) bool {
+	for _, pkg := range pkgs {
+		if pkgNames[pkg] {
+			return true
+		}
+	}
+	return false
+}
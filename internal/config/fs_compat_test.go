@@ -0,0 +1,95 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateFilesystemCompat(t *testing.T) {
+	esp := PartitionInfo{ID: "EFI", Type: "esp", FsType: "fat32", MountPoint: "/boot/efi"}
+
+	tests := []struct {
+		name         string
+		provider     string
+		packages     []string
+		partitions   []PartitionInfo
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name:       "ext4 root with grub",
+			provider:   "grub",
+			packages:   []string{"grub-efi-amd64", "e2fsprogs"},
+			partitions: []PartitionInfo{esp, {ID: "rootfs", FsType: "ext4", MountPoint: "/"}},
+		},
+		{
+			name:         "f2fs root without f2fs-tools",
+			provider:     "grub",
+			packages:     []string{"grub-efi-amd64"},
+			partitions:   []PartitionInfo{esp, {ID: "rootfs", FsType: "f2fs", MountPoint: "/"}},
+			wantErr:      `partition "rootfs": fsType f2fs needs the f2fs-tools package`,
+			wantWarnings: []string{"/boot on f2fs: GRUB cannot read f2fs filesystems"},
+		},
+		{
+			name:     "f2fs root with f2fs-tools and an ext4 /boot",
+			provider: "grub",
+			packages: []string{"grub-efi-amd64", "f2fs-tools=1.16.0-1"},
+			partitions: []PartitionInfo{esp,
+				{ID: "boot", FsType: "ext4", MountPoint: "/boot"},
+				{ID: "rootfs", FsType: "f2fs", MountPoint: "/"}},
+		},
+		{
+			name:         "btrfs /boot with grub",
+			provider:     "grub",
+			packages:     []string{"btrfs-progs"},
+			partitions:   []PartitionInfo{esp, {ID: "rootfs", FsType: "btrfs", MountPoint: "/"}},
+			wantWarnings: []string{"/boot on btrfs: GRUB cannot write its environment block"},
+		},
+		{
+			name:         "xfs data partition without xfsprogs",
+			provider:     "systemd-boot",
+			partitions:   []PartitionInfo{esp, {ID: "rootfs", FsType: "ext4", MountPoint: "/"}, {ID: "data", FsType: "xfs", MountPoint: "/data"}},
+			wantWarnings: []string{`partition "data": fsType xfs needs the xfsprogs package`},
+		},
+		{
+			name:       "unmounted f2fs partition",
+			provider:   "grub",
+			partitions: []PartitionInfo{esp, {ID: "rootfs", FsType: "ext4", MountPoint: "/"}, {ID: "spare", FsType: "f2fs", MountPoint: "none"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &ImageTemplate{
+				Disk:         DiskConfig{Partitions: tt.partitions},
+				SystemConfig: SystemConfig{Packages: tt.packages, Bootloader: Bootloader{BootType: "efi", Provider: tt.provider}},
+			}
+
+			var warnings []string
+			for _, problem := range template.filesystemCompatProblems() {
+				if !problem.fatal {
+					warnings = append(warnings, problem.message)
+				}
+			}
+			if len(warnings) != len(tt.wantWarnings) {
+				t.Errorf("expected warnings %q, got %q", tt.wantWarnings, warnings)
+			}
+			for i, want := range tt.wantWarnings {
+				if i < len(warnings) && !strings.Contains(warnings[i], want) {
+					t.Errorf("expected warning containing %q, got %q", want, warnings[i])
+				}
+			}
+
+			err := template.ValidateFilesystemCompat()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -25,6 +26,17 @@ type GlobalConfig struct {
 	WorkDir   string `yaml:"work_dir" json:"work_dir"`     // Working directory for build operations and image assembly (default: ./workspace)
 	TempDir   string `yaml:"temp_dir" json:"temp_dir"`     // Temporary directory for short-lived files like GPG keys and metadata parsing (empty = system default)
 
+	// StreamDownloads starts downloading packages while dependency resolution
+	// is still running instead of after it (default: false)
+	StreamDownloads bool `yaml:"stream_downloads,omitempty" json:"stream_downloads,omitempty"`
+
+	// MinToolVersions maps host tools, such as mmdebstrap, to the minimum
+	// version a build accepts (default: no minimum)
+	MinToolVersions map[string]string `yaml:"min_tool_versions,omitempty" json:"min_tool_versions,omitempty"`
+
+	// Repository mirrors
+	RepoMirrors []RepoMirror `yaml:"repo_mirrors,omitempty" json:"repo_mirrors,omitempty"` // URL rewrite rules applied to all repository URLs before fetching
+
 	// Logging configuration
 	Logging LoggingConfig `yaml:"logging" json:"logging"` // Logging behavior settings
 
@@ -276,6 +288,11 @@ func (gc *GlobalConfig) renderCommentedYAML() string {
 	b.WriteString("# Higher values speed up package downloads but consume more network/CPU resources\n")
 	b.WriteString("# Recommended: 8-16 for most systems, 20+ for high-bandwidth servers\n\n")
 
+	if gc.StreamDownloads {
+		b.WriteString("stream_downloads: true\n")
+		b.WriteString("# Download packages while dependency resolution is still running\n\n")
+	}
+
 	fmt.Fprintf(&b, "config_dir: %q\n", gc.ConfigDir)
 	b.WriteString("# Directory containing configuration files for different target OSs (default: ./config)\n")
 	b.WriteString("# Should contain subdirectories for general and each target OS config files.\n\n")
@@ -310,6 +327,35 @@ func (gc *GlobalConfig) renderCommentedYAML() string {
 		b.WriteString("  # Tee logs to this file in addition to stdout/stderr (overwritten on each run)\n")
 	}
 
+	if len(gc.MinToolVersions) > 0 {
+		b.WriteString("\n# Minimum host tool versions\n")
+		b.WriteString("# A build fails if one of these host tools is installed with an older version\n")
+		b.WriteString("min_tool_versions:\n")
+		tools := make([]string, 0, len(gc.MinToolVersions))
+		for tool := range gc.MinToolVersions {
+			tools = append(tools, tool)
+		}
+		sort.Strings(tools)
+		for _, tool := range tools {
+			fmt.Fprintf(&b, "  %s: %q\n", tool, gc.MinToolVersions[tool])
+		}
+	}
+
+	if len(gc.RepoMirrors) > 0 {
+		b.WriteString("\n# Repository mirrors\n")
+		b.WriteString("# URL rewrite rules applied to all repository metadata, package and key URLs\n")
+		b.WriteString("# before fetching; the first matching rule wins\n")
+		b.WriteString("repo_mirrors:\n")
+		for _, m := range gc.RepoMirrors {
+			if m.Prefix != "" {
+				fmt.Fprintf(&b, "  - prefix: %q\n", m.Prefix)
+			} else {
+				fmt.Fprintf(&b, "  - regex: %q\n", m.Regex)
+			}
+			fmt.Fprintf(&b, "    replace: %q\n", m.Replace)
+		}
+	}
+
 	return b.String()
 }
 
@@ -345,6 +391,10 @@ func (gc *GlobalConfig) Validate() error {
 
 	gc.Logging.File = strings.TrimSpace(gc.Logging.File)
 
+	if err := validateRepoMirrors(gc.RepoMirrors); err != nil {
+		return err
+	}
+
 	// Ensure temp directory is set (can be empty to use system default)
 	if gc.TempDir == "" {
 		gc.TempDir = os.TempDir()
@@ -397,6 +447,18 @@ func Workers() int {
 	return Global().Workers
 }
 
+// StreamDownloads reports whether packages are downloaded while their
+// dependencies are being resolved.
+func StreamDownloads() bool {
+	return Global().StreamDownloads
+}
+
+// MinToolVersions returns the minimum versions of the host tools, by tool
+// name.
+func MinToolVersions() map[string]string {
+	return Global().MinToolVersions
+}
+
 func VerificationWorkers() int {
 	workers := Global().Workers
 	if workers > 4 {
@@ -432,6 +494,36 @@ func WorkDir() (string, error) {
 	return workDir, nil
 }
 
+// PrepareWorkDir validates the build working directory dir, creating it if it
+// does not exist yet, and returns its absolute path. Builds that run side by
+// side must each use their own working directory.
+func PrepareWorkDir(dir string) (string, error) {
+	if strings.TrimSpace(dir) == "" {
+		return "", fmt.Errorf("work directory cannot be empty")
+	}
+	workDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve work directory %s: %w", dir, err)
+	}
+	if info, err := os.Stat(workDir); err == nil {
+		if !info.IsDir() {
+			return "", fmt.Errorf("work directory %s is not a directory", workDir)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to access work directory %s: %w", workDir, err)
+	} else if err := os.MkdirAll(workDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create work directory %s: %w", workDir, err)
+	}
+
+	probe, err := os.CreateTemp(workDir, ".write-check-*")
+	if err != nil {
+		return "", fmt.Errorf("work directory %s is not writable: %w", workDir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return workDir, nil
+}
+
 func TempDir() string {
 	tempDir := Global().TempDir
 	if tempDir == "" {
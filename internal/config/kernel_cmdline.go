@@ -0,0 +1,35 @@
+package config
+
+// genericKernelCmdline is the kernel command line of the images of target
+// OSes without one in defaultKernelCmdlines: a serial and a VGA console.
+const genericKernelCmdline = "console=ttyS0,115200 console=tty0 loglevel=7"
+
+// defaultKernelCmdlines maps target OSes to the kernel command line their
+// images boot with when the template sets none. The root= argument is never
+// part of it: the bootloader configuration points it at the root partition.
+var defaultKernelCmdlines = map[string]string{
+	"edge-microvisor-toolkit":  genericKernelCmdline,
+	"azure-linux":              genericKernelCmdline,
+	"wind-river-elxr":          "quiet splash " + genericKernelCmdline,
+	"ubuntu":                   genericKernelCmdline,
+	"debian":                   genericKernelCmdline,
+	"redhat-compatible-distro": "rw " + genericKernelCmdline + " selinux=0",
+}
+
+// DefaultKernelCmdline returns the default kernel command line of the images
+// of targetOS.
+func DefaultKernelCmdline(targetOS string) string {
+	if cmdline, ok := defaultKernelCmdlines[targetOS]; ok {
+		return cmdline
+	}
+	return genericKernelCmdline
+}
+
+// GetKernelCmdline returns the kernel command line of the image: the one of
+// systemConfig.kernel, or else the default one of the target OS.
+func (t *ImageTemplate) GetKernelCmdline() string {
+	if cmdline := t.SystemConfig.Kernel.Cmdline; cmdline != "" {
+		return cmdline
+	}
+	return DefaultKernelCmdline(t.Target.OS)
+}
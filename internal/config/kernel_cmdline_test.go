@@ -0,0 +1,66 @@
+package config
+
+import "testing"
+
+func TestGetKernelCmdline(t *testing.T) {
+	tests := []struct {
+		name     string
+		targetOS string
+		cmdline  string
+		want     string
+	}{
+		{
+			name:     "edge microvisor toolkit default",
+			targetOS: "edge-microvisor-toolkit",
+			want:     "console=ttyS0,115200 console=tty0 loglevel=7",
+		},
+		{
+			name:     "azure linux default",
+			targetOS: "azure-linux",
+			want:     "console=ttyS0,115200 console=tty0 loglevel=7",
+		},
+		{
+			name:     "elxr default",
+			targetOS: "wind-river-elxr",
+			want:     "quiet splash console=ttyS0,115200 console=tty0 loglevel=7",
+		},
+		{
+			name:     "ubuntu default",
+			targetOS: "ubuntu",
+			want:     "console=ttyS0,115200 console=tty0 loglevel=7",
+		},
+		{
+			name:     "debian default",
+			targetOS: "debian",
+			want:     "console=ttyS0,115200 console=tty0 loglevel=7",
+		},
+		{
+			name:     "redhat compatible distro default",
+			targetOS: "redhat-compatible-distro",
+			want:     "rw console=ttyS0,115200 console=tty0 loglevel=7 selinux=0",
+		},
+		{
+			name:     "other target OS default",
+			targetOS: "unknown-os",
+			want:     "console=ttyS0,115200 console=tty0 loglevel=7",
+		},
+		{
+			name:     "template cmdline replaces the default",
+			targetOS: "wind-river-elxr",
+			cmdline:  "console=ttyS1,9600",
+			want:     "console=ttyS1,9600",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &ImageTemplate{
+				Target:       TargetInfo{OS: tt.targetOS},
+				SystemConfig: SystemConfig{Kernel: KernelConfig{Cmdline: tt.cmdline}},
+			}
+			if got := template.GetKernelCmdline(); got != tt.want {
+				t.Errorf("GetKernelCmdline() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/security"
+)
+
+// License classes packages are grouped into by the license audit
+const (
+	LicenseClassAGPL         = "AGPL"
+	LicenseClassGPL          = "GPL"
+	LicenseClassLGPL         = "LGPL"
+	LicenseClassWeakCopyleft = "weak-copyleft" // MPL, EPL, CDDL and similar file-level copyleft
+	LicenseClassPermissive   = "permissive"
+	LicenseClassUnknown      = "unknown"
+)
+
+// LicenseClassNames lists all license classes, as accepted by a license policy
+var LicenseClassNames = []string{
+	LicenseClassAGPL,
+	LicenseClassGPL,
+	LicenseClassLGPL,
+	LicenseClassWeakCopyleft,
+	LicenseClassPermissive,
+	LicenseClassUnknown,
+}
+
+var DefaultLicenseReportFile = "license_report.json"
+
+// licenseTokenClasses maps lowercase license identifier prefixes, as used by
+// SPDX identifiers and rpm and Debian license names, to their class
+var licenseTokenClasses = []struct {
+	prefix string
+	class  string
+}{
+	{"agpl", LicenseClassAGPL},
+	{"lgpl", LicenseClassLGPL},
+	{"gpl", LicenseClassGPL},
+	{"mpl", LicenseClassWeakCopyleft},
+	{"epl", LicenseClassWeakCopyleft},
+	{"cddl", LicenseClassWeakCopyleft},
+	{"mit", LicenseClassPermissive},
+	{"bsd", LicenseClassPermissive},
+	{"apache", LicenseClassPermissive},
+	{"asl", LicenseClassPermissive},
+	{"isc", LicenseClassPermissive},
+	{"zlib", LicenseClassPermissive},
+	{"boost", LicenseClassPermissive},
+	{"bsl", LicenseClassPermissive},
+	{"psf", LicenseClassPermissive},
+	{"python", LicenseClassPermissive},
+	{"openssl", LicenseClassPermissive},
+	{"x11", LicenseClassPermissive},
+	{"expat", LicenseClassPermissive},
+	{"curl", LicenseClassPermissive},
+	{"unlicense", LicenseClassPermissive},
+	{"cc0", LicenseClassPermissive},
+	{"public-domain", LicenseClassPermissive},
+	{"publicdomain", LicenseClassPermissive},
+}
+
+// LicenseReport groups the packages of an image by license, and by the
+// license classes those licenses fall into.
+type LicenseReport struct {
+	Packages  int                 `json:"packages"`
+	ByLicense map[string][]string `json:"byLicense"` // license as declared by the package -> package names
+	ByClass   map[string][]string `json:"byClass"`   // license class -> package names
+}
+
+// LicenseClasses returns the classes of the licenses in the license
+// expression license, such as "GPL-2.0-or-later AND BSD-3-Clause" or the
+// "GPLv2+ and LGPLv2+" of rpm metadata. Every license the expression mentions
+// counts, including either side of an "or", and license exceptions are
+// ignored. An expression without any recognized license is unknown.
+func LicenseClasses(license string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(license), func(r rune) bool {
+		switch r {
+		case ' ', '\t', '(', ')', ',', ';', '/', '|', '&':
+			return true
+		}
+		return false
+	})
+
+	seen := make(map[string]bool)
+	var classes []string
+	for i := 0; i < len(fields); i++ {
+		token := fields[i]
+		switch token {
+		case "and", "or":
+			continue
+		case "with":
+			i++ // skip the exception, e.g. "GCC-exception-3.1"
+			continue
+		case "public":
+			if i+1 < len(fields) && fields[i+1] == "domain" {
+				token = "public-domain"
+				i++
+			}
+		}
+		for _, tc := range licenseTokenClasses {
+			if strings.HasPrefix(token, tc.prefix) {
+				if !seen[tc.class] {
+					seen[tc.class] = true
+					classes = append(classes, tc.class)
+				}
+				break
+			}
+		}
+	}
+	if len(classes) == 0 {
+		return []string{LicenseClassUnknown}
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// BuildLicenseReport groups pkgs by license and license class. Package names
+// in each group are sorted.
+func BuildLicenseReport(pkgs []ospackage.PackageInfo) LicenseReport {
+	report := LicenseReport{
+		Packages:  len(pkgs),
+		ByLicense: make(map[string][]string),
+		ByClass:   make(map[string][]string),
+	}
+	for _, pkg := range pkgs {
+		name := licensePackageName(pkg)
+		license := strings.TrimSpace(pkg.License)
+		if license == "" {
+			license = DefaultLicense
+		}
+		report.ByLicense[license] = append(report.ByLicense[license], name)
+		for _, class := range LicenseClasses(pkg.License) {
+			report.ByClass[class] = append(report.ByClass[class], name)
+		}
+	}
+	for _, names := range report.ByLicense {
+		sort.Strings(names)
+	}
+	for _, names := range report.ByClass {
+		sort.Strings(names)
+	}
+	return report
+}
+
+// CheckLicensePolicy returns an error listing the packages of report in any of
+// the denied license classes, or nil if there are none.
+func CheckLicensePolicy(report LicenseReport, denied []string) error {
+	var violations []string
+	for _, class := range denied {
+		if names := report.ByClass[class]; len(names) > 0 {
+			violations = append(violations, fmt.Sprintf("%s: %s", class, strings.Join(names, ", ")))
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("packages with denied license classes found: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// WriteLicenseReportToFile writes report as JSON to outFile.
+func WriteLicenseReportToFile(report LicenseReport, outFile string) error {
+	if err := os.MkdirAll(filepath.Dir(outFile), 0700); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	jsonData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal license report JSON: %w", err)
+	}
+	if err := security.SafeWriteFile(outFile, jsonData, 0600, security.RejectSymlinks); err != nil {
+		return fmt.Errorf("failed to create license report file: %w", err)
+	}
+	log.Infof("License report written to staging %s", outFile)
+	return nil
+}
+
+// ParseCopyrightLicense returns the licenses of the Debian machine-readable
+// copyright file content, joined with " and ", or "" if it has none.
+func ParseCopyrightLicense(content string) string {
+	seen := make(map[string]bool)
+	var licenses []string
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(line, "License:") {
+			continue
+		}
+		license := strings.TrimSpace(strings.TrimPrefix(line, "License:"))
+		if license != "" && !seen[license] {
+			seen[license] = true
+			licenses = append(licenses, license)
+		}
+	}
+	return strings.Join(licenses, " and ")
+}
+
+func licensePackageName(pkg ospackage.PackageInfo) string {
+	if pkg.PkgName != "" {
+		return pkg.PkgName
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(pkg.Name, ".rpm"), ".deb")
+}
@@ -0,0 +1,145 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+)
+
+func TestLicenseClasses(t *testing.T) {
+	tests := []struct {
+		license string
+		want    []string
+	}{
+		{license: "MIT", want: []string{LicenseClassPermissive}},
+		{license: "Apache-2.0", want: []string{LicenseClassPermissive}},
+		{license: "GPLv2+", want: []string{LicenseClassGPL}},
+		{license: "GPL-3.0-or-later WITH GCC-exception-3.1", want: []string{LicenseClassGPL}},
+		{license: "LGPLv2+ and GPLv2+", want: []string{LicenseClassGPL, LicenseClassLGPL}},
+		{license: "AGPL-3.0-only", want: []string{LicenseClassAGPL}},
+		{license: "(MPL-2.0 OR BSD-3-Clause)", want: []string{LicenseClassPermissive, LicenseClassWeakCopyleft}},
+		{license: "Public Domain", want: []string{LicenseClassPermissive}},
+		{license: "Proprietary", want: []string{LicenseClassUnknown}},
+		{license: "", want: []string{LicenseClassUnknown}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.license, func(t *testing.T) {
+			if got := LicenseClasses(tt.license); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LicenseClasses(%q) = %v, want %v", tt.license, got, tt.want)
+			}
+		})
+	}
+}
+
+func testLicensePackages() []ospackage.PackageInfo {
+	return []ospackage.PackageInfo{
+		{Name: "zlib-1.3.1-1.azl3.x86_64.rpm", PkgName: "zlib", License: "zlib"},
+		{Name: "bash-5.2.15-3.azl3.x86_64.rpm", PkgName: "bash", License: "GPLv3+"},
+		{Name: "coreutils", Type: "deb", License: "GPL-3.0-or-later"},
+		{Name: "curl", Type: "deb", License: "MIT"},
+		{Name: "glibc-2.38-9.azl3.x86_64.rpm", PkgName: "glibc", License: "LGPLv2+ and GPLv2+"},
+		{Name: "ghostscript", Type: "deb", License: "AGPL-3.0-or-later"},
+		{Name: "vendor-blob", Type: "deb"},
+	}
+}
+
+func TestBuildLicenseReport(t *testing.T) {
+	report := BuildLicenseReport(testLicensePackages())
+
+	if report.Packages != 7 {
+		t.Errorf("Packages = %d, want 7", report.Packages)
+	}
+	wantByLicense := map[string][]string{
+		"zlib":               {"zlib"},
+		"GPLv3+":             {"bash"},
+		"GPL-3.0-or-later":   {"coreutils"},
+		"MIT":                {"curl"},
+		"LGPLv2+ and GPLv2+": {"glibc"},
+		"AGPL-3.0-or-later":  {"ghostscript"},
+		DefaultLicense:       {"vendor-blob"},
+	}
+	if !reflect.DeepEqual(report.ByLicense, wantByLicense) {
+		t.Errorf("ByLicense = %v, want %v", report.ByLicense, wantByLicense)
+	}
+	wantByClass := map[string][]string{
+		LicenseClassAGPL:       {"ghostscript"},
+		LicenseClassGPL:        {"bash", "coreutils", "glibc"},
+		LicenseClassLGPL:       {"glibc"},
+		LicenseClassPermissive: {"curl", "zlib"},
+		LicenseClassUnknown:    {"vendor-blob"},
+	}
+	if !reflect.DeepEqual(report.ByClass, wantByClass) {
+		t.Errorf("ByClass = %v, want %v", report.ByClass, wantByClass)
+	}
+
+	outFile := filepath.Join(t.TempDir(), DefaultLicenseReportFile)
+	if err := WriteLicenseReportToFile(report, outFile); err != nil {
+		t.Fatalf("WriteLicenseReportToFile failed: %v", err)
+	}
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("failed to read license report: %v", err)
+	}
+	var written LicenseReport
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("license report is not valid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(written, report) {
+		t.Errorf("written report = %+v, want %+v", written, report)
+	}
+}
+
+func TestCheckLicensePolicy(t *testing.T) {
+	report := BuildLicenseReport(testLicensePackages())
+
+	if err := CheckLicensePolicy(report, nil); err != nil {
+		t.Errorf("expected no error without a policy, got %v", err)
+	}
+	if err := CheckLicensePolicy(report, []string{LicenseClassWeakCopyleft}); err != nil {
+		t.Errorf("expected no error for a class no package has, got %v", err)
+	}
+
+	err := CheckLicensePolicy(report, []string{LicenseClassAGPL, LicenseClassUnknown})
+	if err == nil {
+		t.Fatal("expected denied license classes to fail the policy check")
+	}
+	for _, want := range []string{"AGPL: ghostscript", "unknown: vendor-blob"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestParseCopyrightLicense(t *testing.T) {
+	content := `Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: coreutils
+
+Files: *
+Copyright: 1984-2023 Free Software Foundation, Inc.
+License: GPL-3.0+
+
+Files: debian/*
+Copyright: 2004-2023 Debian maintainers
+License: GPL-3.0+
+
+Files: src/blake2/*
+License: CC0
+ This is the license text, not a License: field.
+
+License: GPL-3.0+
+ On Debian systems, the complete text of the GNU General Public License
+ can be found in /usr/share/common-licenses/GPL-3.
+`
+	if got, want := ParseCopyrightLicense(content), "GPL-3.0+ and CC0"; got != want {
+		t.Errorf("ParseCopyrightLicense() = %q, want %q", got, want)
+	}
+	if got := ParseCopyrightLicense("Copyright (C) 2020 Someone\nAll rights reserved.\n"); got != "" {
+		t.Errorf("expected no license for a free-form copyright file, got %q", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -75,6 +76,7 @@ type SPDXPackage struct {
 	Supplier         string         `json:"supplier,omitempty"`
 	Checksum         []SPDXChecksum `json:"checksum,omitempty"`
 	Description      string         `json:"description,omitempty"`
+	SourceInfo       string         `json:"sourceInfo,omitempty"` // repository the package was downloaded from
 }
 
 // Holds the checksum value for an SBOM instance item
@@ -120,7 +122,10 @@ func WriteManifestToFile(manifest SoftwarePackageManifest, outputFile string) er
 	return nil
 }
 
-func WriteSPDXToFile(pkgs []ospackage.PackageInfo, outFile string) error {
+// WriteSPDXToFile writes the SPDX SBOM of pkgs to outFile. hostTools, the
+// versions of the host tools used for the build by tool name, are listed as
+// creators of the SBOM next to the composer itself.
+func WriteSPDXToFile(pkgs []ospackage.PackageInfo, outFile string, hostTools map[string]string) error {
 
 	log.Infof("Generating SPDX manifest for %d packages", len(pkgs))
 
@@ -146,6 +151,15 @@ func WriteSPDXToFile(pkgs []ospackage.PackageInfo, outFile string) error {
 		},
 		Packages: make([]SPDXPackage, 0, len(pkgs)),
 	}
+	tools := make([]string, 0, len(hostTools))
+	for tool := range hostTools {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		spdx.CreationInfo.Creators = append(spdx.CreationInfo.Creators,
+			fmt.Sprintf("Tool: %s %s", tool, hostTools[tool]))
+	}
 
 	for _, pkg := range pkgs {
 		spdxPkg := SPDXPackage{
@@ -165,6 +179,10 @@ func WriteSPDXToFile(pkgs []ospackage.PackageInfo, outFile string) error {
 		// use the Organization form
 		spdxPkg.Supplier = spdxSupplier(pkg.Origin)
 
+		if pkg.Repository != "" {
+			spdxPkg.SourceInfo = fmt.Sprintf("acquired from package repository %s", pkg.Repository)
+		}
+
 		// If the checksum is not specified or missing, leave field out
 		// Valid values according to SPDX spec: SHA1, SHA256, MD5
 		var spdxChecksums []SPDXChecksum
@@ -271,6 +289,20 @@ func CopySBOMToImageBuildDir(imageBuildDir string) error {
 	}
 
 	log.Infof("Successfully copied SBOM to: %s", dstSBOM)
+
+	// The license report is generated along with the SBOM
+	srcReport := filepath.Join(config.TempDir(), DefaultLicenseReportFile)
+	if _, err := os.Stat(srcReport); err == nil {
+		data, err := security.SafeReadFile(srcReport, security.RejectSymlinks)
+		if err != nil {
+			return fmt.Errorf("failed to read license report: %w", err)
+		}
+		dstReport := filepath.Join(imageBuildDir, DefaultLicenseReportFile)
+		if err := security.SafeWriteFile(dstReport, data, 0644, security.RejectSymlinks); err != nil {
+			return fmt.Errorf("failed to write license report to image build directory: %w", err)
+		}
+		log.Infof("Successfully copied license report to: %s", dstReport)
+	}
 	return nil
 }
 
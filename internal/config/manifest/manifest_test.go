@@ -14,6 +14,31 @@ import (
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 )
 
+func TestWriteSPDXToFileRecordsHostTools(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "sbom.spdx.json")
+	hostTools := map[string]string{"xorriso": "1.5.4", "mmdebstrap": "1.3.5"}
+
+	if err := WriteSPDXToFile(nil, outFile, hostTools); err != nil {
+		t.Fatalf("WriteSPDXToFile failed: %v", err)
+	}
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("Failed to read SPDX output: %v", err)
+	}
+	var doc SPDXDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse SPDX JSON: %v", err)
+	}
+
+	creators := doc.CreationInfo.Creators
+	if len(creators) != 4 {
+		t.Fatalf("Expected the composer, its organization and 2 host tools as creators, got %v", creators)
+	}
+	if creators[2] != "Tool: mmdebstrap 1.3.5" || creators[3] != "Tool: xorriso 1.5.4" {
+		t.Errorf("Expected host tools sorted by name as creators, got %v", creators[2:])
+	}
+}
+
 func TestWriteSPDXToFile(t *testing.T) {
 	// Create a temporary directory for the test
 	tmpDir := t.TempDir()
@@ -30,13 +55,14 @@ func TestWriteSPDXToFile(t *testing.T) {
 			Description: "Sample package",
 			License:     "Apache-2.0",
 			Origin:      "Intel",
+			Repository:  "https://openedgeplatform.com/repo",
 			Checksums: []ospackage.Checksum{
 				{Algorithm: "sha256", Value: "abcd1234abcd1234abcd1234"},
 			},
 		},
 	}
 
-	err := WriteSPDXToFile(pkgs, outFile)
+	err := WriteSPDXToFile(pkgs, outFile, nil)
 	if err != nil {
 		t.Fatalf("WriteSPDXToFile failed: %v", err)
 	}
@@ -70,6 +96,9 @@ func TestWriteSPDXToFile(t *testing.T) {
 	if len(p.Checksum) != 1 || p.Checksum[0].Algorithm != "SHA256" {
 		t.Errorf("Expected SHA256 checksum, got %+v", p.Checksum)
 	}
+	if p.SourceInfo != "acquired from package repository https://openedgeplatform.com/repo" {
+		t.Errorf("Expected source info naming the repository, got %q", p.SourceInfo)
+	}
 }
 
 // Alternative test that creates subdirectories to match the original behavior
@@ -94,7 +123,7 @@ func TestWriteSPDXToFile_WithSubdirectory(t *testing.T) {
 		},
 	}
 
-	err := WriteSPDXToFile(pkgs, outFile)
+	err := WriteSPDXToFile(pkgs, outFile, nil)
 	if err != nil {
 		t.Fatalf("WriteSPDXToFile with subdirectory failed: %v", err)
 	}
@@ -233,7 +262,7 @@ func TestWriteSPDXToFile_InvalidChecksumAlgorithm(t *testing.T) {
 			},
 		},
 	}
-	err := WriteSPDXToFile(pkgs, outFile)
+	err := WriteSPDXToFile(pkgs, outFile, nil)
 	if err != nil {
 		t.Fatalf("WriteSPDXToFile failed: %v", err)
 	}
@@ -264,7 +293,7 @@ func TestWriteSPDXToFile_MissingFields(t *testing.T) {
 			Name: "empty",
 		},
 	}
-	err := WriteSPDXToFile(pkgs, outFile)
+	err := WriteSPDXToFile(pkgs, outFile, nil)
 	if err != nil {
 		t.Fatalf("WriteSPDXToFile failed: %v", err)
 	}
@@ -286,6 +315,9 @@ func TestWriteSPDXToFile_MissingFields(t *testing.T) {
 	if p.Supplier != "NOASSERTION" {
 		t.Errorf("Expected Supplier to be NOASSERTION, got %q", p.Supplier)
 	}
+	if p.SourceInfo != "" {
+		t.Errorf("Expected no source info without a repository, got %q", p.SourceInfo)
+	}
 }
 
 func TestCopySBOMToChroot_Success(t *testing.T) {
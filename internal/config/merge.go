@@ -26,7 +26,9 @@ func NewDefaultConfigLoader(os, dist, arch string) *DefaultConfigLoader {
 	}
 }
 
-// LoadDefaultConfig loads the appropriate default configuration based on image type
+// LoadDefaultConfig loads the appropriate default configuration based on image
+// type. It returns no template and no error for the image types that have no
+// default configuration.
 func (d *DefaultConfigLoader) LoadDefaultConfig(imageType string) (*ImageTemplate, error) {
 
 	// Determine the default config file based on image type
@@ -38,6 +40,11 @@ func (d *DefaultConfigLoader) LoadDefaultConfig(imageType string) (*ImageTemplat
 		defaultConfigFile = fmt.Sprintf("default-initrd-%s.yml", d.targetArch)
 	case "iso":
 		defaultConfigFile = fmt.Sprintf("default-iso-%s.yml", d.targetArch)
+	case "oci", "tar", "pxe":
+		// OCI images, rootfs tarballs and PXE artifacts carry only the user's
+		// rootfs; there is no default template to merge
+		log.Debugf("No default configuration for image type: %s", imageType)
+		return nil, nil
 	default:
 		log.Errorf("Unsupported image type: %s", imageType)
 		return nil, fmt.Errorf("unsupported image type: %s", imageType)
@@ -188,6 +195,10 @@ func redactSensitiveSystemConfig(config SystemConfig) SystemConfig {
 	if config.Immutability.SecureBootDBKey != "" {
 		redacted.Immutability.SecureBootDBKey = "[REDACTED]"
 	}
+	if config.Immutability.SecureBootDBKeyURI != "" {
+		// PKCS#11 URIs may carry the token PIN
+		redacted.Immutability.SecureBootDBKeyURI = "[REDACTED]"
+	}
 	if config.Immutability.SecureBootDBCrt != "" {
 		redacted.Immutability.SecureBootDBCrt = "[REDACTED]"
 	}
@@ -214,9 +225,50 @@ func mergeSystemConfig(defaultConfig, userConfig SystemConfig) SystemConfig {
 		merged.HostName = userConfig.HostName
 	}
 
+	// User DNS settings replace the default ones as a whole
+	if len(userConfig.ResolvConf.Nameservers) > 0 || len(userConfig.ResolvConf.Search) > 0 {
+		merged.ResolvConf = userConfig.ResolvConf
+	}
+
+	// Merge hosts entries - user entries are added after the default ones
+	if len(userConfig.HostsEntries) > 0 {
+		merged.HostsEntries = append(append([]HostsEntry{}, defaultConfig.HostsEntries...), userConfig.HostsEntries...)
+	}
+
+	// Merge extra fstab entries - user entries are added after the default ones
+	if len(userConfig.ExtraFstabEntries) > 0 {
+		merged.ExtraFstabEntries = append(append([]string{}, defaultConfig.ExtraFstabEntries...), userConfig.ExtraFstabEntries...)
+	}
+
+	// Merge environment variables - user values override default ones
+	if len(userConfig.Environment) > 0 {
+		merged.Environment = make(map[string]string, len(defaultConfig.Environment)+len(userConfig.Environment))
+		for name, value := range defaultConfig.Environment {
+			merged.Environment[name] = value
+		}
+		for name, value := range userConfig.Environment {
+			merged.Environment[name] = value
+		}
+	}
+
+	// Merge systemd drop-ins - a user drop-in replaces the default one of its unit
+	if len(userConfig.SystemdDropIns) > 0 {
+		merged.SystemdDropIns = mergeSystemdDropIns(defaultConfig.SystemdDropIns, userConfig.SystemdDropIns)
+	}
+
+	if userConfig.ReadOnlyUsr.Enabled {
+		merged.ReadOnlyUsr.Enabled = true
+	}
+	if len(userConfig.ReadOnlyUsr.WritablePaths) > 0 {
+		merged.ReadOnlyUsr.WritablePaths = mergePackages(defaultConfig.ReadOnlyUsr.WritablePaths, userConfig.ReadOnlyUsr.WritablePaths)
+	}
+
 	if userConfig.Initramfs.Template != "" {
 		merged.Initramfs.Template = userConfig.Initramfs.Template
 	}
+	if userConfig.Initramfs.Compression != "" {
+		merged.Initramfs.Compression = userConfig.Initramfs.Compression
+	}
 
 	// Merge immutability config - only if user provided some immutability configuration
 	if !userConfig.Immutability.wasProvided {
@@ -240,6 +292,16 @@ func mergeSystemConfig(defaultConfig, userConfig SystemConfig) SystemConfig {
 		merged.Configurations = mergeConfigurations(defaultConfig.Configurations, userConfig.Configurations)
 	}
 
+	// Merge pre-install commands - user commands run after the default ones
+	if len(userConfig.PreInstallCommands) > 0 {
+		merged.PreInstallCommands = append(append([]string{}, defaultConfig.PreInstallCommands...), userConfig.PreInstallCommands...)
+	}
+
+	// Merge post-install commands - user commands run after the default ones
+	if len(userConfig.PostInstallCommands) > 0 {
+		merged.PostInstallCommands = append(append([]string{}, defaultConfig.PostInstallCommands...), userConfig.PostInstallCommands...)
+	}
+
 	// Merge bootloader config
 	if !isEmptyBootloader(userConfig.Bootloader) {
 		merged.Bootloader = mergeBootloader(defaultConfig.Bootloader, userConfig.Bootloader)
@@ -250,6 +312,52 @@ func mergeSystemConfig(defaultConfig, userConfig SystemConfig) SystemConfig {
 		merged.Packages = mergePackages(defaultConfig.Packages, userConfig.Packages)
 	}
 
+	// Merge denied license classes - user classes are added to default ones
+	if len(userConfig.LicensePolicy.Deny) > 0 {
+		merged.LicensePolicy.Deny = mergePackages(defaultConfig.LicensePolicy.Deny, userConfig.LicensePolicy.Deny)
+	}
+
+	// Merge file verification - user allowed paths are added to default ones
+	if userConfig.VerifyFiles.Enabled {
+		merged.VerifyFiles.Enabled = true
+	}
+	if userConfig.VerifyFiles.AllowConfigFiles {
+		merged.VerifyFiles.AllowConfigFiles = true
+	}
+	if len(userConfig.VerifyFiles.Allow) > 0 {
+		merged.VerifyFiles.Allow = mergePackages(defaultConfig.VerifyFiles.Allow, userConfig.VerifyFiles.Allow)
+	}
+
+	// Merge slim options - user locales are kept in addition to default ones
+	if userConfig.Slim.StripDocs {
+		merged.Slim.StripDocs = true
+	}
+	if len(userConfig.Slim.KeepLocales) > 0 {
+		merged.Slim.KeepLocales = mergePackages(defaultConfig.Slim.KeepLocales, userConfig.Slim.KeepLocales)
+	}
+
+	if userConfig.SSH.DisablePasswordAuth {
+		merged.SSH.DisablePasswordAuth = true
+	}
+	// User host key settings replace the default ones as a whole
+	if userConfig.SSH.HostKeys.Mode != "" || len(userConfig.SSH.HostKeys.Keys) > 0 {
+		merged.SSH.HostKeys = userConfig.SSH.HostKeys
+	}
+
+	// Merge package manager options - user options are added after the default ones
+	if len(userConfig.PkgManagerOptions) > 0 {
+		merged.PkgManagerOptions = mergeStringSlices(defaultConfig.PkgManagerOptions, userConfig.PkgManagerOptions)
+	}
+
+	if userConfig.BulkInstall {
+		merged.BulkInstall = true
+	}
+
+	// Merge remove packages - user packages are added to default remove packages
+	if len(userConfig.RemovePackages) > 0 {
+		merged.RemovePackages = mergePackages(defaultConfig.RemovePackages, userConfig.RemovePackages)
+	}
+
 	// Merge kernel config
 	merged.Kernel = mergeKernelConfig(defaultConfig.Kernel, userConfig.Kernel)
 
@@ -264,10 +372,18 @@ func mergeImmutabilityConfig(defaultImmutability, userImmutability ImmutabilityC
 	merged.Enabled = userImmutability.Enabled
 
 	// Merge secure boot configuration - user values override defaults
+	if userImmutability.SecureBootSigner != "" {
+		merged.SecureBootSigner = userImmutability.SecureBootSigner
+	}
+
 	if userImmutability.SecureBootDBKey != "" {
 		merged.SecureBootDBKey = userImmutability.SecureBootDBKey
 	}
 
+	if userImmutability.SecureBootDBKeyURI != "" {
+		merged.SecureBootDBKeyURI = userImmutability.SecureBootDBKeyURI
+	}
+
 	if userImmutability.SecureBootDBCrt != "" {
 		merged.SecureBootDBCrt = userImmutability.SecureBootDBCrt
 	}
@@ -314,6 +430,23 @@ func mergeConfigurations(defaultConfigs, userConfigs []ConfigurationInfo) []Conf
 	return merged
 }
 
+// mergeSystemdDropIns merges systemd drop-ins, keeping the order of the
+// default drop-ins, with a user drop-in replacing the default one of its unit
+func mergeSystemdDropIns(defaultDropIns, userDropIns []SystemdDropIn) []SystemdDropIn {
+	userUnits := make(map[string]bool, len(userDropIns))
+	for _, dropIn := range userDropIns {
+		userUnits[dropIn.Unit] = true
+	}
+
+	merged := make([]SystemdDropIn, 0, len(defaultDropIns)+len(userDropIns))
+	for _, dropIn := range defaultDropIns {
+		if !userUnits[dropIn.Unit] {
+			merged = append(merged, dropIn)
+		}
+	}
+	return append(merged, userDropIns...)
+}
+
 // mergeUsers merges user configurations
 func mergeUsers(defaultUsers, userUsers []UserConfig) []UserConfig {
 	merged := make([]UserConfig, 0, len(defaultUsers)+len(userUsers))
@@ -390,8 +523,13 @@ func mergeUserConfig(defaultUser, userUser UserConfig) UserConfig {
 		merged.Groups = mergeStringSlices(defaultUser.Groups, userUser.Groups)
 	}
 
-	// Override sudo setting
+	// Override sudo and lock settings; a locked account keeps no password
 	merged.Sudo = userUser.Sudo
+	merged.Locked = userUser.Locked
+	if merged.Locked {
+		merged.Password = ""
+		merged.HashAlgo = ""
+	}
 
 	return merged
 }
@@ -473,9 +611,21 @@ func mergeKernelConfig(defaultKernel, userKernel KernelConfig) KernelConfig {
 		merged.Cmdline = userKernel.Cmdline
 	}
 
+	// A kernel package selected by the user replaces the default kernel
+	// packages, unless the user lists the kernel packages as well
+	if userKernel.Package != "" {
+		merged.Package = userKernel.Package
+		merged.Packages = nil
+	}
 	if len(userKernel.Packages) > 0 {
 		merged.Packages = userKernel.Packages
 	}
+	if len(userKernel.Firmware) > 0 {
+		merged.Firmware = userKernel.Firmware
+	}
+	if len(userKernel.DKMSModules) > 0 {
+		merged.DKMSModules = userKernel.DKMSModules
+	}
 
 	// Add the EnableExtraModules field merge logic
 	if userKernel.EnableExtraModules != "" {
@@ -565,9 +715,16 @@ func validateAndFixImmutabilityConfig(template *ImageTemplate) {
 
 // LoadAndMergeTemplate loads a user template and merges it with the appropriate default config
 func LoadAndMergeTemplate(templatePath string) (*ImageTemplate, error) {
+	return LoadAndMergeTemplateWithOverrides(templatePath, nil)
+}
+
+// LoadAndMergeTemplateWithOverrides is LoadAndMergeTemplate with "key=value"
+// overrides applied to the user template before it is validated, so the
+// default configuration is chosen for the overridden target.
+func LoadAndMergeTemplateWithOverrides(templatePath string, overrides []string) (*ImageTemplate, error) {
 
 	// Load the user template first
-	userTemplate, err := LoadTemplate(templatePath, false)
+	userTemplate, err := LoadTemplateWithOverrides(templatePath, false, overrides)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load user template: %w", err)
 	}
@@ -585,6 +742,9 @@ func LoadAndMergeTemplate(templatePath string) (*ImageTemplate, error) {
 		log.Info("Proceeding with user template only")
 		return userTemplate, nil
 	}
+	if defaultTemplate == nil {
+		return userTemplate, nil
+	}
 
 	// Merge configurations
 	mergedTemplate, err := MergeConfigurations(userTemplate, defaultTemplate)
@@ -3,7 +3,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
 )
 
 func TestNewDefaultConfigLoader(t *testing.T) {
@@ -36,6 +39,53 @@ func TestDefaultConfigLoaderUnsupportedImageTypeInMerge(t *testing.T) {
 	}
 }
 
+func TestDefaultConfigLoaderRootfsImageTypesHaveNoDefault(t *testing.T) {
+	loader := NewDefaultConfigLoader("ubuntu", "ubuntu24", "x86_64")
+
+	for _, imageType := range []string{"oci", "tar", "pxe"} {
+		template, err := loader.LoadDefaultConfig(imageType)
+		if err != nil {
+			t.Errorf("expected no error for %s image type, got %v", imageType, err)
+		}
+		if template != nil {
+			t.Errorf("expected no default template for %s, got %+v", imageType, template)
+		}
+	}
+}
+
+func TestLoadAndMergeTemplateWithoutDefaultConfigDoesNotWarn(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "rootfs.yml")
+	content := `image:
+  name: rootfs
+  version: 1.0.0
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: tar
+systemConfig:
+  name: rootfs
+  packages:
+    - bash
+`
+	if err := os.WriteFile(templatePath, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	logger.StartWarningCapture()
+	template, err := LoadAndMergeTemplate(templatePath)
+	warnings := logger.StopWarningCapture()
+	if err != nil {
+		t.Fatalf("LoadAndMergeTemplate failed: %v", err)
+	}
+	if template.SystemConfig.Name != "rootfs" {
+		t.Errorf("expected the user template, got system config %q", template.SystemConfig.Name)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("expected no warnings for an image type without default configuration, got %v", warnings)
+	}
+}
+
 func TestMergeConfigurationsNilUserTemplate(t *testing.T) {
 	defaultTemplate := &ImageTemplate{
 		Image: ImageInfo{Name: "default", Version: "1.0.0"},
@@ -410,6 +460,89 @@ func TestMergePackages(t *testing.T) {
 	}
 }
 
+func TestMergeSystemConfigRemovePackages(t *testing.T) {
+	defaultConfig := SystemConfig{
+		Name:           "default",
+		RemovePackages: []string{"man-db"},
+	}
+
+	// User config without removePackages keeps the defaults
+	merged := mergeSystemConfig(defaultConfig, SystemConfig{Name: "user"})
+	if len(merged.RemovePackages) != 1 || merged.RemovePackages[0] != "man-db" {
+		t.Errorf("expected default remove packages to be preserved, got %v", merged.RemovePackages)
+	}
+
+	// User remove packages are added to the defaults without duplicates
+	userConfig := SystemConfig{
+		Name:           "user",
+		RemovePackages: []string{"locales", "man-db"},
+	}
+	merged = mergeSystemConfig(defaultConfig, userConfig)
+	expected := []string{"man-db", "locales"}
+	if len(merged.RemovePackages) != len(expected) {
+		t.Fatalf("expected remove packages %v, got %v", expected, merged.RemovePackages)
+	}
+	for i, pkg := range expected {
+		if merged.RemovePackages[i] != pkg {
+			t.Errorf("expected remove package %d to be %q, got %q", i, pkg, merged.RemovePackages[i])
+		}
+	}
+}
+
+func TestMergeSystemConfigPostInstallCommands(t *testing.T) {
+	defaultConfig := SystemConfig{
+		Name:                "default",
+		PostInstallCommands: []string{"systemctl enable ssh"},
+	}
+
+	// User config without postInstallCommands keeps the defaults
+	merged := mergeSystemConfig(defaultConfig, SystemConfig{Name: "user"})
+	if len(merged.PostInstallCommands) != 1 || merged.PostInstallCommands[0] != "systemctl enable ssh" {
+		t.Errorf("expected default post-install commands to be preserved, got %v", merged.PostInstallCommands)
+	}
+
+	// User commands run after the defaults, duplicates included
+	userConfig := SystemConfig{
+		Name:                "user",
+		PostInstallCommands: []string{"/opt/vendor/setup.sh", "systemctl enable ssh"},
+	}
+	merged = mergeSystemConfig(defaultConfig, userConfig)
+	expected := []string{"systemctl enable ssh", "/opt/vendor/setup.sh", "systemctl enable ssh"}
+	if len(merged.PostInstallCommands) != len(expected) {
+		t.Fatalf("expected post-install commands %v, got %v", expected, merged.PostInstallCommands)
+	}
+	for i, cmd := range expected {
+		if merged.PostInstallCommands[i] != cmd {
+			t.Errorf("expected post-install command %d to be %q, got %q", i, cmd, merged.PostInstallCommands[i])
+		}
+	}
+	if len(defaultConfig.PostInstallCommands) != 1 {
+		t.Errorf("merging must not modify the default commands, got %v", defaultConfig.PostInstallCommands)
+	}
+}
+
+func TestMergeSystemConfigPreInstallCommands(t *testing.T) {
+	defaultConfig := SystemConfig{
+		Name:               "default",
+		PreInstallCommands: []string{"rpm --root \"$IMAGE_ROOT\" --import /etc/pki/vendor.key"},
+	}
+	userConfig := SystemConfig{
+		Name:               "user",
+		PreInstallCommands: []string{"echo 'assumeyes=1' >> /etc/tdnf/tdnf.conf"},
+	}
+
+	merged := mergeSystemConfig(defaultConfig, userConfig)
+	expected := append(append([]string{}, defaultConfig.PreInstallCommands...), userConfig.PreInstallCommands...)
+	if len(merged.PreInstallCommands) != len(expected) {
+		t.Fatalf("expected pre-install commands %v, got %v", expected, merged.PreInstallCommands)
+	}
+	for i, cmd := range expected {
+		if merged.PreInstallCommands[i] != cmd {
+			t.Errorf("expected pre-install command %d to be %q, got %q", i, cmd, merged.PreInstallCommands[i])
+		}
+	}
+}
+
 func TestMergeKernelConfig(t *testing.T) {
 	defaultKernel := KernelConfig{
 		Version:            "6.10",
@@ -455,6 +588,49 @@ func TestMergeKernelConfig(t *testing.T) {
 	}
 }
 
+func TestMergeKernelConfigPackage(t *testing.T) {
+	defaultKernel := KernelConfig{
+		Version:  "6.12",
+		Packages: []string{"linux-image-amd64"},
+	}
+
+	merged := mergeKernelConfig(defaultKernel, KernelConfig{Package: "linux-image-rt-amd64=6.12.74-2"})
+	if merged.Package != "linux-image-rt-amd64=6.12.74-2" {
+		t.Errorf("expected kernel package 'linux-image-rt-amd64=6.12.74-2', got '%s'", merged.Package)
+	}
+	if len(merged.Packages) != 0 {
+		t.Errorf("expected the kernel package to replace the default packages, got %v", merged.Packages)
+	}
+
+	merged = mergeKernelConfig(defaultKernel, KernelConfig{
+		Package:  "linux-image-rt-amd64",
+		Packages: []string{"linux-image-rt-amd64", "firmware-misc-nonfree"},
+	})
+	if len(merged.Packages) != 2 || merged.Packages[1] != "firmware-misc-nonfree" {
+		t.Errorf("expected user packages to be kept alongside the kernel package, got %v", merged.Packages)
+	}
+}
+
+func TestMergeKernelConfigFirmwareAndDKMS(t *testing.T) {
+	defaultKernel := KernelConfig{
+		Packages: []string{"linux-image-amd64"},
+		Firmware: []string{"firmware-linux-free"},
+	}
+
+	merged := mergeKernelConfig(defaultKernel, KernelConfig{DKMSModules: []string{"v4l2loopback-dkms"}})
+	if !reflect.DeepEqual(merged.Firmware, []string{"firmware-linux-free"}) {
+		t.Errorf("expected the default firmware to be kept, got %v", merged.Firmware)
+	}
+	if !reflect.DeepEqual(merged.DKMSModules, []string{"v4l2loopback-dkms"}) {
+		t.Errorf("expected the user DKMS modules, got %v", merged.DKMSModules)
+	}
+
+	merged = mergeKernelConfig(defaultKernel, KernelConfig{Firmware: []string{"firmware-iwlwifi"}})
+	if !reflect.DeepEqual(merged.Firmware, []string{"firmware-iwlwifi"}) {
+		t.Errorf("expected the user firmware to replace the default, got %v", merged.Firmware)
+	}
+}
+
 func TestMergePackageRepositoriesDetailed(t *testing.T) {
 	defaultRepos := []PackageRepository{
 		{Codename: "main", URL: "http://default.com/main"},
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CheckDuplicateRepositories returns an error if two of repos define the same
+// repository, that is the same URL or path, codename and component.
+// Placeholder repositories without a URL or path are ignored.
+func CheckDuplicateRepositories(repos []PackageRepository) error {
+	seen := make(map[string]PackageRepository)
+	for _, repo := range repos {
+		location := repositoryLocation(repo)
+		if location == "" {
+			continue
+		}
+		component := repo.Component
+		if component == "" {
+			component = "main"
+		}
+		key := location + " " + repo.Codename + " " + component
+		if first, ok := seen[key]; ok {
+			return fmt.Errorf("repositories %s and %s are duplicates: both use %s with codename %q and component %q",
+				getRepositoryName(first), getRepositoryName(repo), location, repo.Codename, component)
+		}
+		seen[key] = repo
+	}
+	return nil
+}
+
+// checkOriginPriorityConflicts returns an error if two of repos share an
+// origin host but have different priorities. Apt preferences pin by origin,
+// so only one priority could apply to both. repos must have their priorities
+// normalized already.
+func checkOriginPriorityConflicts(repos []PackageRepository) error {
+	byOrigin := make(map[string]PackageRepository)
+	for _, repo := range repos {
+		origin := strings.ToLower(extractOriginFromURL(repo.URL))
+		if origin == "" || repo.URL == "<URL>" {
+			continue
+		}
+		first, ok := byOrigin[origin]
+		if !ok {
+			byOrigin[origin] = repo
+			continue
+		}
+		if first.Priority != repo.Priority {
+			return fmt.Errorf("repositories %s (priority %d) and %s (priority %d) share origin %s, but apt pins priorities by origin; use the same priority for both",
+				getRepositoryName(first), first.Priority, getRepositoryName(repo), repo.Priority, origin)
+		}
+	}
+	return nil
+}
+
+// repositoryLocation returns the URL or path of repo in a form where
+// equivalent spellings compare equal, or "" for a placeholder repository.
+func repositoryLocation(repo PackageRepository) string {
+	if repo.Path != "" {
+		return strings.TrimRight(repo.Path, "/")
+	}
+	if repo.URL == "" || repo.URL == "<URL>" {
+		return ""
+	}
+	location := strings.TrimRight(repo.URL, "/")
+	if u, err := url.Parse(location); err == nil && u.Host != "" {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		location = u.String()
+	}
+	return location
+}
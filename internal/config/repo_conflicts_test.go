@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckDuplicateRepositories(t *testing.T) {
+	tests := []struct {
+		name   string
+		repos  []PackageRepository
+		errMsg string
+	}{
+		{
+			name: "distinct repositories",
+			repos: []PackageRepository{
+				{Codename: "noble", URL: "https://example.com/repo", Component: "main"},
+				{Codename: "noble", URL: "https://example.com/repo", Component: "universe"},
+				{Codename: "noble", URL: "https://mirror.example.com/repo"},
+			},
+		},
+		{
+			name: "exact duplicate",
+			repos: []PackageRepository{
+				{ID: "first", Codename: "noble", URL: "https://example.com/repo", Component: "main"},
+				{ID: "second", Codename: "noble", URL: "https://example.com/repo", Component: "main"},
+			},
+			errMsg: "repositories first and second are duplicates",
+		},
+		{
+			name: "duplicate spelled differently",
+			repos: []PackageRepository{
+				{Codename: "noble", URL: "https://Example.com/repo/"},
+				{Codename: "noble", URL: "https://example.com/repo", Component: "main"},
+			},
+			errMsg: "are duplicates",
+		},
+		{
+			name: "duplicate local path",
+			repos: []PackageRepository{
+				{Codename: "localrpm", Path: "/data/localrpm"},
+				{Codename: "localrpm", Path: "/data/localrpm/"},
+			},
+			errMsg: "are duplicates",
+		},
+		{
+			name: "placeholders are ignored",
+			repos: []PackageRepository{
+				{Codename: "custom", URL: "<URL>"},
+				{Codename: "custom", URL: "<URL>"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckDuplicateRepositories(tt.repos)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestGenerateAptSourcesFromRepositories_Conflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		repos  []PackageRepository
+		errMsg string
+	}{
+		{
+			name: "exact duplicate",
+			repos: []PackageRepository{
+				{ID: "intel", Codename: "noble", URL: "https://apt.example.com/intel", Priority: 990},
+				{ID: "intel-again", Codename: "noble", URL: "https://apt.example.com/intel", Priority: 990},
+			},
+			errMsg: "repositories intel and intel-again are duplicates",
+		},
+		{
+			name: "same origin different priority",
+			repos: []PackageRepository{
+				{ID: "sed", Codename: "noble", URL: "https://apt.example.com/sed", Priority: 1000},
+				{ID: "openvino", Codename: "ubuntu24", URL: "https://apt.example.com/openvino"},
+			},
+			errMsg: "repositories sed (priority 1000) and openvino (priority 500) share origin apt.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &ImageTemplate{
+				Target:              TargetInfo{OS: "ubuntu"},
+				PackageRepositories: tt.repos,
+			}
+			err := template.GenerateAptSourcesFromRepositories()
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+			if len(template.SystemConfig.AdditionalFiles) != 0 {
+				t.Errorf("expected no apt files for conflicting repositories, got %v", template.SystemConfig.AdditionalFiles)
+			}
+		})
+	}
+
+	// The same origin with the same priority is fine
+	template := &ImageTemplate{
+		Target: TargetInfo{OS: "ubuntu"},
+		PackageRepositories: []PackageRepository{
+			{ID: "sed", Codename: "noble", URL: "https://apt.example.com/sed", PKey: "[trusted=yes]", Priority: 990},
+			{ID: "openvino", Codename: "ubuntu24", URL: "https://apt.example.com/openvino", PKey: "[trusted=yes]", Priority: 990},
+		},
+	}
+	if err := template.GenerateAptSourcesFromRepositories(); err != nil {
+		t.Fatalf("expected same-origin repositories with equal priority to be accepted, got %v", err)
+	}
+	for _, file := range template.SystemConfig.AdditionalFiles {
+		defer os.Remove(file.Local)
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// CheckRepositoryKeys fetches the GPG keys of every package repository of the
+// template and checks that each one is valid key material, so a broken pkey
+// fails the build before anything is downloaded or installed rather than deep
+// in the package installation. ASCII-armored keys are dearmored first, as
+// they are for apt. All unreachable or invalid keys are reported at once.
+// Repositories without a key, marked [trusted=yes] or verified with signedBy
+// are skipped.
+func (t *ImageTemplate) CheckRepositoryKeys() error {
+	var failures []string
+	checked := make(map[string]bool)
+	for _, repo := range t.PackageRepositories {
+		if repo.SignedBy != "" {
+			continue
+		}
+		for _, keyRef := range append([]string{repo.PKey}, repo.PKeys...) {
+			if keyRef == "" || keyRef == "<PUBLIC_KEY_URL>" || keyRef == "[trusted=yes]" || checked[keyRef] {
+				continue
+			}
+			checked[keyRef] = true
+			log.Debugf("Checking GPG key %s of repository %s", keyRef, getRepositoryName(repo))
+			if err := checkRepositoryKey(keyRef); err != nil {
+				failures = append(failures, fmt.Sprintf("repository %s: %v", getRepositoryName(repo), err))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d repository GPG key(s) unreachable or invalid: %s",
+			len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// checkRepositoryKey fetches the key at keyRef, a URL or an absolute path on
+// the host, and checks that it holds at least one OpenPGP public key.
+func checkRepositoryKey(keyRef string) error {
+	var keyData []byte
+	var err error
+	if strings.HasPrefix(keyRef, "/") {
+		keyData, err = os.ReadFile(keyRef)
+		if err != nil {
+			return fmt.Errorf("failed to read GPG key %s: %w", keyRef, err)
+		}
+	} else {
+		keyData, err = downloadGPGKey(keyRef)
+		if err != nil {
+			return err
+		}
+	}
+	if err := validateGPGKeyData(keyData); err != nil {
+		return fmt.Errorf("invalid GPG key %s: %w", keyRef, err)
+	}
+	return nil
+}
+
+// validateGPGKeyData checks that keyData, ASCII-armored or binary, is a
+// keyring of at least one OpenPGP key.
+func validateGPGKeyData(keyData []byte) error {
+	var keyring openpgp.EntityList
+	var err error
+	if bytes.Contains(keyData, []byte("-----BEGIN PGP")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(keyData))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(keyData))
+	}
+	if err != nil {
+		return fmt.Errorf("not OpenPGP key material: %w", err)
+	}
+	if len(keyring) == 0 {
+		return fmt.Errorf("no OpenPGP key found")
+	}
+	return nil
+}
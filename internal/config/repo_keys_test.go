@@ -0,0 +1,86 @@
+package config
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// armoredTestKey returns a freshly generated ASCII-armored public key.
+func armoredTestKey(t *testing.T) []byte {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Test Repo", "", "repo@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	var buf bytes.Buffer
+	writer, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("failed to armor key: %v", err)
+	}
+	if err := entity.Serialize(writer); err != nil {
+		t.Fatalf("failed to serialize key: %v", err)
+	}
+	writer.Close()
+	return buf.Bytes()
+}
+
+func TestCheckRepositoryKeys(t *testing.T) {
+	validKey := armoredTestKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/valid.asc":
+			_, _ = w.Write(validKey)
+		case "/garbage.asc":
+			_, _ = w.Write([]byte("<html>not a key</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	localKey := filepath.Join(t.TempDir(), "local.asc")
+	if err := os.WriteFile(localKey, validKey, 0644); err != nil {
+		t.Fatalf("failed to write local key: %v", err)
+	}
+
+	t.Run("valid keys", func(t *testing.T) {
+		template := &ImageTemplate{PackageRepositories: []PackageRepository{
+			{Codename: "valid", URL: server.URL, PKey: server.URL + "/valid.asc"},
+			{Codename: "local", URL: server.URL, PKey: localKey, PKeys: []string{server.URL + "/valid.asc"}},
+			{Codename: "trusted", URL: server.URL, PKey: "[trusted=yes]"},
+			{Codename: "keyring", URL: server.URL, SignedBy: "/usr/share/keyrings/missing.gpg"},
+			{Codename: "nokey", URL: server.URL},
+		}}
+		if err := template.CheckRepositoryKeys(); err != nil {
+			t.Errorf("expected the preflight to pass, got %v", err)
+		}
+	})
+
+	t.Run("unreachable and invalid keys", func(t *testing.T) {
+		template := &ImageTemplate{PackageRepositories: []PackageRepository{
+			{Codename: "valid", URL: server.URL, PKey: server.URL + "/valid.asc"},
+			{Codename: "missing", URL: server.URL, PKey: server.URL + "/missing.asc"},
+			{Codename: "garbage", URL: server.URL, PKey: server.URL + "/garbage.asc"},
+		}}
+		err := template.CheckRepositoryKeys()
+		if err == nil {
+			t.Fatal("expected the preflight to fail")
+		}
+		for _, want := range []string{"2 repository GPG key(s)", "repository missing", "HTTP status 404", "repository garbage", "invalid GPG key"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error to contain %q, got %v", want, err)
+			}
+		}
+		if strings.Contains(err.Error(), "repository valid") {
+			t.Errorf("expected the valid key not to be reported, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RepoMirror rewrites the repository URLs matching it, so that metadata,
+// packages and keys are fetched from a mirror or proxy instead, e.g. from an
+// internal mirror of mirror.elxr.dev. Exactly one of Prefix and Regex is set.
+type RepoMirror struct {
+	Prefix  string `yaml:"prefix,omitempty" json:"prefix,omitempty"` // Prefix: URL prefix to replace, e.g. "https://mirror.elxr.dev/"
+	Regex   string `yaml:"regex,omitempty" json:"regex,omitempty"`   // Regex: regular expression to replace instead of a prefix
+	Replace string `yaml:"replace" json:"replace"`                   // Replace: replacement text; $1-style group references are expanded for Regex
+
+	re *regexp.Regexp // compiled Regex
+}
+
+// validate checks the rule and compiles its regular expression.
+func (m *RepoMirror) validate() error {
+	switch {
+	case m.Prefix == "" && m.Regex == "":
+		return fmt.Errorf("one of prefix or regex is required")
+	case m.Prefix != "" && m.Regex != "":
+		return fmt.Errorf("cannot specify both prefix and regex, choose one")
+	case strings.TrimSpace(m.Replace) == "":
+		return fmt.Errorf("replace cannot be empty")
+	}
+	if m.Regex != "" {
+		re, err := regexp.Compile(m.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %w", m.Regex, err)
+		}
+		m.re = re
+	}
+	return nil
+}
+
+// rewrite returns rawURL rewritten by the rule, and whether the rule matched.
+func (m *RepoMirror) rewrite(rawURL string) (string, bool) {
+	if m.Prefix != "" {
+		if rest, ok := strings.CutPrefix(rawURL, m.Prefix); ok {
+			return m.Replace + rest, true
+		}
+		return rawURL, false
+	}
+	re := m.re
+	if re == nil {
+		var err error
+		if re, err = regexp.Compile(m.Regex); err != nil {
+			return rawURL, false
+		}
+	}
+	if !re.MatchString(rawURL) {
+		return rawURL, false
+	}
+	return re.ReplaceAllString(rawURL, m.Replace), true
+}
+
+// validateRepoMirrors checks every rule of mirrors.
+func validateRepoMirrors(mirrors []RepoMirror) error {
+	for i := range mirrors {
+		if err := mirrors[i].validate(); err != nil {
+			return fmt.Errorf("repo_mirrors[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// RewriteRepoURL returns rawURL rewritten by the first repo_mirrors rule of
+// the global config that matches it, or rawURL itself if none does. It is
+// applied to every repository metadata, package and key URL right before
+// fetching, so the URLs recorded in manifests and lockfiles stay the
+// upstream ones.
+func RewriteRepoURL(rawURL string) string {
+	mirrors := Global().RepoMirrors
+	for i := range mirrors {
+		if rewritten, ok := mirrors[i].rewrite(rawURL); ok {
+			if rewritten != rawURL {
+				log.Debugf("Rewriting repository URL %s to %s", rawURL, rewritten)
+			}
+			return rewritten
+		}
+	}
+	return rawURL
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepoMirrorsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirror  RepoMirror
+		wantErr string
+	}{
+		{name: "prefix", mirror: RepoMirror{Prefix: "https://mirror.elxr.dev/", Replace: "https://mirror.internal/elxr/"}},
+		{name: "regex", mirror: RepoMirror{Regex: `^https://([a-z]+)\.ubuntu\.com/`, Replace: "https://mirror.internal/$1/"}},
+		{name: "neither", mirror: RepoMirror{Replace: "https://mirror.internal/"}, wantErr: "one of prefix or regex is required"},
+		{name: "both", mirror: RepoMirror{Prefix: "https://a/", Regex: "^https://a/", Replace: "https://b/"}, wantErr: "cannot specify both"},
+		{name: "empty replace", mirror: RepoMirror{Prefix: "https://a/"}, wantErr: "replace cannot be empty"},
+		{name: "bad regex", mirror: RepoMirror{Regex: "^https://(", Replace: "https://b/"}, wantErr: "invalid regex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gc := DefaultGlobalConfig()
+			gc.RepoMirrors = []RepoMirror{tt.mirror}
+			err := gc.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "repo_mirrors[0]") {
+				t.Fatalf("expected repo_mirrors[0] error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRewriteRepoURL(t *testing.T) {
+	originalGlobal := Global()
+	defer SetGlobal(originalGlobal)
+
+	gc := DefaultGlobalConfig()
+	gc.RepoMirrors = []RepoMirror{
+		{Prefix: "https://mirror.elxr.dev/", Replace: "https://mirror.internal/elxr/"},
+		{Regex: `^https?://([a-z]+)\.ubuntu\.com/ubuntu/`, Replace: "https://mirror.internal/ubuntu-$1/"},
+		// Never reached for elxr URLs, the first matching rule wins
+		{Prefix: "https://mirror.elxr.dev/elxr/", Replace: "https://other.internal/"},
+	}
+	if err := gc.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	SetGlobal(gc)
+
+	tests := map[string]string{
+		"https://mirror.elxr.dev/elxr/dists/aria/main/binary-amd64/Packages.gz": "https://mirror.internal/elxr/elxr/dists/aria/main/binary-amd64/Packages.gz",
+		"https://mirror.elxr.dev/elxr/pool/main/c/curl/curl_8.14.1-2_amd64.deb": "https://mirror.internal/elxr/elxr/pool/main/c/curl/curl_8.14.1-2_amd64.deb",
+		"http://archive.ubuntu.com/ubuntu/dists/noble/Release":                  "https://mirror.internal/ubuntu-archive/dists/noble/Release",
+		"https://packages.microsoft.com/azurelinux/3.0/prod/base/x86_64/":       "https://packages.microsoft.com/azurelinux/3.0/prod/base/x86_64/",
+		"file:///srv/repo/Packages.gz":                                          "file:///srv/repo/Packages.gz",
+	}
+	for rawURL, want := range tests {
+		if got := RewriteRepoURL(rawURL); got != want {
+			t.Errorf("RewriteRepoURL(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestLoadGlobalConfigRepoMirrors(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	content := `workers: 4
+cache_dir: ./cache
+work_dir: ./workspace
+logging:
+  level: info
+repo_mirrors:
+  - prefix: "https://mirror.elxr.dev/"
+    replace: "https://mirror.internal/elxr/"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	gc, err := LoadGlobalConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadGlobalConfig failed: %v", err)
+	}
+	if len(gc.RepoMirrors) != 1 || gc.RepoMirrors[0].Replace != "https://mirror.internal/elxr/" {
+		t.Fatalf("unexpected repo mirrors: %+v", gc.RepoMirrors)
+	}
+
+	invalid := strings.Replace(content, "    replace:", "    regex: \"^https://\"\n    replace:", 1)
+	if err := os.WriteFile(configPath, []byte(invalid), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := LoadGlobalConfig(configPath); err == nil {
+		t.Fatal("expected an error for a rule with both prefix and regex")
+	}
+}
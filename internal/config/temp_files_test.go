@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedTempFiles(t *testing.T) {
+	origConfig := Global()
+	defer SetGlobal(origConfig)
+	tempDir := t.TempDir()
+	currentConfig := *origConfig
+	currentConfig.TempDir = tempDir
+	SetGlobal(&currentConfig)
+
+	template := &ImageTemplate{
+		Target: TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "raw"},
+		PackageRepositories: []PackageRepository{{
+			Codename:  "noble",
+			URL:       "https://apt.example.com/ubuntu",
+			Component: "main",
+			PKey:      createLocalTestGPGKey(t, "example-key-*.gpg"),
+			Priority:  600,
+		}},
+	}
+	if err := template.GenerateAptSourcesFromRepositories(); err != nil {
+		t.Fatalf("GenerateAptSourcesFromRepositories failed: %v", err)
+	}
+
+	var generated []string
+	for _, file := range template.SystemConfig.AdditionalFiles {
+		if !filepath.IsAbs(file.Local) || !strings.HasPrefix(file.Local, tempDir+string(filepath.Separator)) {
+			t.Errorf("expected %s to be generated under the configured temp dir %s, got %s", file.Final, tempDir, file.Local)
+		}
+		if _, err := os.Stat(file.Local); err != nil {
+			t.Errorf("expected generated file %s to exist: %v", file.Local, err)
+		}
+		generated = append(generated, file.Local)
+	}
+	// apt sources, preferences and GPG key
+	if len(generated) != 3 {
+		t.Fatalf("expected 3 generated files, got %v", generated)
+	}
+	if resolved := template.GetAdditionalFileInfo(); len(resolved) != len(generated) {
+		t.Errorf("expected every generated file to resolve as an additional file, got %+v", resolved)
+	}
+
+	template.RemoveTempFiles()
+	for _, path := range generated {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", path, err)
+		}
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("failed to read temp dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected the temp dir to be left empty, got %d entries", len(entries))
+	}
+}
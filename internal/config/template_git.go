@@ -0,0 +1,89 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitTemplateSource is a template stored in a git repository.
+type GitTemplateSource struct {
+	Repo string // URL or path of the repository, as given to git fetch
+	Ref  string // branch, tag or commit to check out, empty for the default branch
+	Path string // path of the template file in the repository
+}
+
+// FetchGitTemplate shallow-clones the ref of src.Repo into a temporary
+// directory and returns the path of the template file in it. The whole
+// repository is checked out, so the additionalFiles, packageFiles and other
+// files the template references relative to its own directory are read from
+// the same ref. The caller must call cleanup, which removes the checkout,
+// once it is done with the template and its files.
+func FetchGitTemplate(src GitTemplateSource) (templatePath string, cleanup func(), err error) {
+	if src.Repo == "" {
+		return "", nil, fmt.Errorf("template repository is required")
+	}
+	for _, arg := range []string{src.Repo, src.Ref} {
+		if strings.HasPrefix(arg, "-") {
+			return "", nil, fmt.Errorf("invalid template repository or ref %q", arg)
+		}
+	}
+	relPath := filepath.Clean(src.Path)
+	if src.Path == "" || filepath.IsAbs(relPath) || relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return "", nil, fmt.Errorf("template path %q must be a relative path inside the repository", src.Path)
+	}
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return "", nil, fmt.Errorf("git command not found: %w", err)
+	}
+
+	baseDir, err := EnsureTempDir("template-git")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create template checkout directory: %w", err)
+	}
+	checkoutDir, err := os.MkdirTemp(baseDir, "checkout-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create template checkout directory: %w", err)
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(checkoutDir); err != nil {
+			log.Warnf("Failed to remove template checkout %s: %v", checkoutDir, err)
+		}
+	}
+
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	log.Infof("Fetching template %s from %s at %s", relPath, src.Repo, ref)
+	for _, step := range []struct {
+		name string
+		args []string
+	}{
+		{"init", []string{"init", "-q", checkoutDir}},
+		{"fetch", []string{"-C", checkoutDir, "fetch", "-q", "--depth", "1", src.Repo, ref}},
+		{"checkout", []string{"-C", checkoutDir, "checkout", "-q", "FETCH_HEAD"}},
+	} {
+		cmd := exec.Command(gitPath, step.args...)
+		// Fail instead of prompting for credentials
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("git %s failed: %w (stderr: %s)", step.name, err,
+				strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	templatePath = filepath.Join(checkoutDir, relPath)
+	if _, err := os.Stat(templatePath); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("template %s not found in %s at %s", relPath, src.Repo, ref)
+	}
+	return templatePath, cleanup, nil
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitTemplateFixture is a bare repository whose tag v1 and default branch
+// main hold different versions of templates/image.yml, its package list and
+// its additional file.
+type gitTemplateFixture struct {
+	repo     string // path of the bare repository
+	v1Commit string // commit tagged v1
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// useTempDir points the global temp directory, where the templates are
+// checked out, at a test directory.
+func useTempDir(t *testing.T) {
+	t.Helper()
+	origConfig := Global()
+	t.Cleanup(func() { SetGlobal(origConfig) })
+	currentConfig := *origConfig
+	currentConfig.TempDir = t.TempDir()
+	SetGlobal(&currentConfig)
+}
+
+func newGitTemplateFixture(t *testing.T) gitTemplateFixture {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	root := t.TempDir()
+	repo := filepath.Join(root, "templates.git")
+	work := filepath.Join(root, "work")
+	runGit(t, root, "init", "-q", "--bare", repo)
+	runGit(t, root, "init", "-q", "-b", "main", work)
+
+	writeVersion := func(version string) {
+		files := map[string]string{
+			"templates/image.yml": `image:
+  name: git-image
+  version: "` + version + `"
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+systemConfig:
+  name: default
+  packageFiles:
+    - packages.txt
+  additionalFiles:
+    - local: files/motd
+      final: /etc/motd
+`,
+			"templates/packages.txt": "pkg-" + version + "\n",
+			"templates/files/motd":   "motd " + version + "\n",
+		}
+		for name, content := range files {
+			path := filepath.Join(work, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("failed to write %s: %v", path, err)
+			}
+		}
+		runGit(t, work, "add", "-A")
+		runGit(t, work, "commit", "-q", "-m", "version "+version)
+	}
+
+	writeVersion("1.0.0")
+	runGit(t, work, "tag", "v1")
+	v1Commit := runGit(t, work, "rev-parse", "HEAD")
+	writeVersion("2.0.0")
+	runGit(t, work, "push", "-q", repo, "main", "v1")
+	runGit(t, repo, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	return gitTemplateFixture{repo: repo, v1Commit: v1Commit}
+}
+
+func TestFetchGitTemplate(t *testing.T) {
+	fixture := newGitTemplateFixture(t)
+	useTempDir(t)
+
+	tests := []struct {
+		name    string
+		repo    string
+		ref     string
+		version string
+	}{
+		{name: "tag", repo: fixture.repo, ref: "v1", version: "1.0.0"},
+		{name: "commit", repo: "file://" + fixture.repo, ref: fixture.v1Commit, version: "1.0.0"},
+		{name: "branch", repo: fixture.repo, ref: "main", version: "2.0.0"},
+		{name: "default branch", repo: fixture.repo, version: "2.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templatePath, cleanup, err := FetchGitTemplate(GitTemplateSource{
+				Repo: tt.repo,
+				Ref:  tt.ref,
+				Path: "templates/image.yml",
+			})
+			if err != nil {
+				t.Fatalf("FetchGitTemplate() error = %v", err)
+			}
+
+			template, err := LoadTemplate(templatePath, false)
+			if err != nil {
+				cleanup()
+				t.Fatalf("failed to load fetched template: %v", err)
+			}
+			if template.Image.Version != tt.version {
+				t.Errorf("expected template version %s, got %s", tt.version, template.Image.Version)
+			}
+			if !strings.Contains(strings.Join(template.SystemConfig.Packages, " "), "pkg-"+tt.version) {
+				t.Errorf("expected packages from the package file at %s, got %v", tt.version, template.SystemConfig.Packages)
+			}
+
+			files := template.GetAdditionalFileInfo()
+			if len(files) != 1 {
+				cleanup()
+				t.Fatalf("expected 1 additional file, got %+v", files)
+			}
+			content, err := os.ReadFile(files[0].Local)
+			if err != nil {
+				t.Errorf("failed to read additional file: %v", err)
+			} else if string(content) != "motd "+tt.version+"\n" {
+				t.Errorf("expected additional file from %s, got %q", tt.version, content)
+			}
+
+			cleanup()
+			if _, err := os.Stat(templatePath); !os.IsNotExist(err) {
+				t.Errorf("expected the checkout to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFetchGitTemplateErrors(t *testing.T) {
+	fixture := newGitTemplateFixture(t)
+	useTempDir(t)
+
+	tests := []struct {
+		name          string
+		src           GitTemplateSource
+		expectedError string
+	}{
+		{name: "missing repo", src: GitTemplateSource{Path: "image.yml"}, expectedError: "template repository is required"},
+		{name: "option injection", src: GitTemplateSource{Repo: "--upload-pack=sh", Path: "image.yml"}, expectedError: "invalid template repository or ref"},
+		{name: "path outside repo", src: GitTemplateSource{Repo: fixture.repo, Path: "../image.yml"}, expectedError: "must be a relative path inside the repository"},
+		{name: "unknown ref", src: GitTemplateSource{Repo: fixture.repo, Ref: "v9", Path: "templates/image.yml"}, expectedError: "git fetch failed"},
+		{name: "missing template", src: GitTemplateSource{Repo: fixture.repo, Ref: "v1", Path: "templates/other.yml"}, expectedError: "template templates/other.yml not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := FetchGitTemplate(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got: %v", tt.expectedError, err)
+			}
+		})
+	}
+}
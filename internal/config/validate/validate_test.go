@@ -241,6 +241,55 @@ systemConfig:
 	}
 }
 
+func TestInitramfsCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		valid       bool
+	}{
+		{"zstd", true},
+		{"lz4", true},
+		{"bzip2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.compression, func(t *testing.T) {
+			templateYAML := `image:
+  name: test-image
+  version: "1.0.0"
+
+target:
+  os: ubuntu
+  dist: ubuntu24
+  arch: x86_64
+  imageType: raw
+
+systemConfig:
+  name: default
+  initramfs:
+    compression: ` + tt.compression + `
+`
+
+			var raw interface{}
+			if err := yaml.Unmarshal([]byte(templateYAML), &raw); err != nil {
+				t.Fatalf("yml parsing error: %v", err)
+			}
+
+			dataJSON, err := json.Marshal(raw)
+			if err != nil {
+				t.Fatalf("json marshaling error: %v", err)
+			}
+
+			err = ValidateImageTemplateJSON(dataJSON)
+			if tt.valid && err != nil {
+				t.Errorf("expected initramfs compression %q to pass validation, but got: %v", tt.compression, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected initramfs compression %q to fail validation", tt.compression)
+			}
+		})
+	}
+}
+
 // Test global config validation
 func TestValidConfig(t *testing.T) {
 	v := loadFile(t, "/testdata/valid-config.yml")
@@ -728,3 +777,108 @@ systemConfig:
 		t.Errorf("expected template with local path repo to pass validation, but got: %v", err)
 	}
 }
+
+// TestImmutabilitySecureBootSigner validates the secure boot key fields
+// required by each signing backend
+func TestImmutabilitySecureBootSigner(t *testing.T) {
+	tests := []struct {
+		name         string
+		immutability string
+		expectValid  bool
+	}{
+		{
+			name: "local key files",
+			immutability: `    enabled: true
+    secureBootDBKey: /keys/db.key
+    secureBootDBCrt: /keys/db.crt
+    secureBootDBCer: /keys/db.cer
+`,
+			expectValid: true,
+		},
+		{
+			name: "pkcs11 token",
+			immutability: `    enabled: true
+    secureBootSigner: pkcs11
+    secureBootDBKeyURI: "pkcs11:token=secureboot;object=db-key"
+    secureBootDBCrt: /keys/db.crt
+    secureBootDBCer: /keys/db.cer
+`,
+			expectValid: true,
+		},
+		{
+			name: "pkcs11 without key URI",
+			immutability: `    enabled: true
+    secureBootSigner: pkcs11
+    secureBootDBCrt: /keys/db.crt
+    secureBootDBCer: /keys/db.cer
+`,
+		},
+		{
+			name: "key URI without pkcs11 signer",
+			immutability: `    enabled: true
+    secureBootDBKeyURI: "pkcs11:token=secureboot;object=db-key"
+    secureBootDBKey: /keys/db.key
+    secureBootDBCrt: /keys/db.crt
+    secureBootDBCer: /keys/db.cer
+`,
+		},
+		{
+			name: "key URI that is not pkcs11",
+			immutability: `    enabled: true
+    secureBootSigner: pkcs11
+    secureBootDBKeyURI: "file:/keys/db.key"
+    secureBootDBCrt: /keys/db.crt
+    secureBootDBCer: /keys/db.cer
+`,
+		},
+		{
+			name: "unknown signer",
+			immutability: `    enabled: true
+    secureBootSigner: kms
+    secureBootDBKey: /keys/db.key
+    secureBootDBCrt: /keys/db.crt
+    secureBootDBCer: /keys/db.cer
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templateYAML := `image:
+  name: test-secure-boot
+  version: "1.0.0"
+
+target:
+  os: azure-linux
+  dist: azl3
+  arch: x86_64
+  imageType: raw
+
+systemConfig:
+  name: test
+  immutability:
+` + tt.immutability + `  packages:
+    - test-package
+  kernel:
+    version: "6.12"
+`
+
+			var raw interface{}
+			if err := yaml.Unmarshal([]byte(templateYAML), &raw); err != nil {
+				t.Fatalf("YAML parsing error: %v", err)
+			}
+			dataJSON, err := json.Marshal(raw)
+			if err != nil {
+				t.Fatalf("JSON marshaling error: %v", err)
+			}
+
+			err = ValidateImageTemplateJSON(dataJSON)
+			if tt.expectValid && err != nil {
+				t.Errorf("expected template to pass validation, but got: %v", err)
+			}
+			if !tt.expectValid && err == nil {
+				t.Errorf("expected template to fail validation")
+			}
+		})
+	}
+}
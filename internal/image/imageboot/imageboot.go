@@ -218,6 +218,9 @@ func updateInitramfsForGrub(installRoot, kernelVersion string, template *config.
 
 	var cmd string
 	if updateInitramfsExists {
+		if err := configureInitramfsToolsCompression(installRoot, kernelVersion, template); err != nil {
+			return err
+		}
 		cmd = fmt.Sprintf("update-initramfs -u -k %s", kernelVersion)
 	} else {
 		dracutExists, dracutCheckErr := shell.IsCommandExist("dracut", installRoot)
@@ -233,11 +236,17 @@ func updateInitramfsForGrub(installRoot, kernelVersion string, template *config.
 		if extraModules != "" {
 			cmd = fmt.Sprintf("%s --add-drivers '%s'", cmd, extraModules)
 		}
+		if compression := template.SystemConfig.Initramfs.Compression; compression != "" {
+			if err := CheckInitramfsCompression(installRoot, kernelVersion, compression); err != nil {
+				return err
+			}
+			cmd = fmt.Sprintf("%s --compress %s", cmd, compression)
+		}
 		log.Infof("update-initramfs not found, using dracut fallback")
 	}
 
 	log.Debugf("Executing: %s", cmd)
-	_, err = shell.ExecCmd(cmd, true, installRoot, nil)
+	_, err = shell.ExecCmdWithStage("initramfs", cmd, true, installRoot, nil)
 	if err != nil {
 		log.Errorf("Failed to update initramfs: %v", err)
 		return fmt.Errorf("failed to update initramfs: %w", err)
@@ -315,25 +324,8 @@ func updateBootConfigTemplate(installRoot, rootDevID, bootUUID, bootPrefix, hash
 		}
 	} else {
 
-		rootPartition := rootDevID
-
 		// Special case for some security module like EMF required hardcoded root partition
-		cmdline := template.GetKernel().Cmdline
-		cmdlineMap := make(map[string]string)
-		if cmdline != "" {
-			// Parse cmdline into key-value pairs
-			fields := strings.Fields(cmdline)
-			for _, field := range fields {
-				parts := strings.SplitN(field, "=", 2)
-				if len(parts) == 2 {
-					cmdlineMap[parts[0]] = parts[1]
-				}
-			}
-			// Check if "root" key exists and assign to rootPartition
-			if rootVal, exists := cmdlineMap["root"]; exists {
-				rootPartition = rootVal
-			}
-		}
+		rootPartition, _ := splitKernelRootArg(template.GetKernelCmdline(), rootDevID)
 
 		if err := file.ReplacePlaceholdersInFile("{{.RootPartition}}", rootPartition, configFinalPath); err != nil {
 			log.Errorf("Failed to replace RootPartition in boot configuration: %v", err)
@@ -386,20 +378,14 @@ func updateBootConfigTemplate(installRoot, rootDevID, bootUUID, bootPrefix, hash
 		return fmt.Errorf("failed to replace CGroup in boot configuration: %w", err)
 	}
 
-	kernelConfig := template.GetKernel()
-	// Special cases for some security module like EMF required hardcoded root partition as additional cmdline arg
-	// Remove the "root" parameter and its value from the cmdline as it's has been handled previously
-	trimRootArgfromCmdLine := kernelConfig.Cmdline
-	if trimRootArgfromCmdLine != "" {
-		fields := strings.Fields(trimRootArgfromCmdLine)
-		var filteredFields []string
-		for _, field := range fields {
-			// Skip fields that start with "root="
-			if !strings.HasPrefix(field, "root=") {
-				filteredFields = append(filteredFields, field)
-			}
-		}
-		trimRootArgfromCmdLine = strings.Join(filteredFields, " ")
+	// The root= argument of the kernel command line has been handled previously
+	_, trimRootArgfromCmdLine := splitKernelRootArg(template.GetKernelCmdline(), rootDevID)
+
+	// A compressed root filesystem is read-only: mount it read-only, with a
+	// volatile overlay on top for the paths the running system writes to
+	if rootFsType := template.CompressedRootFsType(); rootFsType != "" {
+		readOnlyArgs := fmt.Sprintf("ro rootfstype=%s systemd.volatile=overlay", rootFsType)
+		trimRootArgfromCmdLine = strings.TrimSpace(readOnlyArgs + " " + trimRootArgfromCmdLine)
 	}
 
 	if err := file.ReplacePlaceholdersInFile("{{.ExtraCommandLine}}", trimRootArgfromCmdLine, configFinalPath); err != nil {
@@ -421,6 +407,23 @@ func updateBootConfigTemplate(installRoot, rootDevID, bootUUID, bootPrefix, hash
 	return nil
 }
 
+// splitKernelRootArg splits the root= argument off the kernel command line
+// cmdline. It returns the root device the command line sets, or else
+// rootDevID, the PARTUUID of the root partition of the image, and the rest of
+// the command line.
+func splitKernelRootArg(cmdline, rootDevID string) (string, string) {
+	rootPartition := rootDevID
+	var filteredFields []string
+	for _, field := range strings.Fields(cmdline) {
+		if value, ok := strings.CutPrefix(field, "root="); ok {
+			rootPartition = value
+			continue
+		}
+		filteredFields = append(filteredFields, field)
+	}
+	return rootPartition, strings.Join(filteredFields, " ")
+}
+
 func (imageBoot *ImageBoot) InstallImageBoot(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate, pkgType string) error {
 	var bootUUID string
 	var bootPrefix string = ""
@@ -491,7 +494,7 @@ func (imageBoot *ImageBoot) InstallImageBoot(installRoot string, diskPathIdMap m
 		// Update initramfs for Debian/Ubuntu systems with GRUB
 		// This must happen after updateBootConfigTemplate but before updateGrubConfig
 		if pkgType == "deb" {
-			kernelVersion, err := getKernelVersionFromBoot(installRoot)
+			kernelVersion, err := TargetKernelVersion(installRoot, pkgType, template)
 			if err != nil {
 				return fmt.Errorf("Failed to get kernel version for initramfs update: %w", err)
 			} else {
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imagedisc"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 )
 
@@ -1414,6 +1415,105 @@ func TestUpdateInitramfsForGrub_ModuleAddFailsContinues(t *testing.T) {
 	}
 }
 
+func TestUpdateInitramfsForGrub_Compression(t *testing.T) {
+	kernelVersion := "6.8.0-45-generic"
+	template := &config.ImageTemplate{
+		SystemConfig: config.SystemConfig{Initramfs: config.Initramfs{Compression: "zstd"}},
+	}
+
+	tests := []struct {
+		name          string
+		kernelConfig  string
+		mocks         []shell.MockCommand
+		wantCommand   string
+		expectedError string
+	}{
+		{
+			name:         "update-initramfs",
+			kernelConfig: "CONFIG_RD_GZIP=y\nCONFIG_RD_ZSTD=y\n",
+			mocks: []shell.MockCommand{
+				{Pattern: "command -v update-initramfs", Output: "/usr/sbin/update-initramfs\n", Error: nil},
+				{Pattern: "command -v zstd", Output: "/usr/bin/zstd\n", Error: nil},
+				{Pattern: "mkdir -p /etc/initramfs-tools/conf.d", Output: "", Error: nil},
+				{Pattern: "echo 'COMPRESS=zstd' > /etc/initramfs-tools/conf.d/compress", Output: "", Error: nil},
+				{Pattern: "update-initramfs -u -k " + kernelVersion, Output: "", Error: nil},
+			},
+			wantCommand: "echo 'COMPRESS=zstd' > /etc/initramfs-tools/conf.d/compress",
+		},
+		{
+			name:         "dracut fallback",
+			kernelConfig: "CONFIG_RD_ZSTD=y\n",
+			mocks: []shell.MockCommand{
+				{Pattern: "command -v update-initramfs", Output: "", Error: nil},
+				{Pattern: "command -v dracut", Output: "/usr/bin/dracut\n", Error: nil},
+				{Pattern: "command -v zstd", Output: "/usr/bin/zstd\n", Error: nil},
+				{Pattern: "dracut --force", Output: "", Error: nil},
+			},
+			wantCommand: "dracut --force --kver " + kernelVersion + " /boot/initrd.img-" + kernelVersion + " --compress zstd",
+		},
+		{
+			name:         "compressor missing",
+			kernelConfig: "CONFIG_RD_ZSTD=y\n",
+			mocks: []shell.MockCommand{
+				{Pattern: "command -v update-initramfs", Output: "/usr/sbin/update-initramfs\n", Error: nil},
+				{Pattern: "command -v zstd", Output: "", Error: nil},
+			},
+			expectedError: "initramfs compression zstd requires zstd to be installed in the image",
+		},
+		{
+			name:         "kernel without zstd support",
+			kernelConfig: "CONFIG_RD_GZIP=y\n# CONFIG_RD_ZSTD is not set\n",
+			mocks: []shell.MockCommand{
+				{Pattern: "command -v update-initramfs", Output: "/usr/sbin/update-initramfs\n", Error: nil},
+				{Pattern: "command -v zstd", Output: "/usr/bin/zstd\n", Error: nil},
+			},
+			expectedError: "CONFIG_RD_ZSTD is not enabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(tmpDir, "boot"), 0755); err != nil {
+				t.Fatalf("Failed to create boot directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(tmpDir, "boot", "config-"+kernelVersion), []byte(tt.kernelConfig), 0644); err != nil {
+				t.Fatalf("Failed to write kernel config: %v", err)
+			}
+
+			originalExecutor := shell.Default
+			defer func() { shell.Default = originalExecutor }()
+			recorder := &recordingExecutor{MockExecutor: shell.NewMockExecutor(tt.mocks)}
+			shell.Default = recorder
+
+			err := updateInitramfsForGrub(tmpDir, kernelVersion, template)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("Expected error containing %q, got: %v", tt.expectedError, err)
+				}
+				for _, cmd := range recorder.commands {
+					if strings.Contains(cmd, "update-initramfs -u") {
+						t.Errorf("Expected the initramfs not to be built, got command: %s", cmd)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			found := false
+			for _, cmd := range recorder.commands {
+				if cmd == tt.wantCommand {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected command %q, got: %v", tt.wantCommand, recorder.commands)
+			}
+		})
+	}
+}
+
 func TestInstallImageBoot_GrubWithEnableExtraModules(t *testing.T) {
 	setupConfigDir(t)
 	diskPathIdMap := map[string]string{
@@ -1561,3 +1661,378 @@ func TestInstallImageBoot_GrubWithEnableExtraModulesUbuntu(t *testing.T) {
 		t.Errorf("Expected no error, got: %v", err)
 	}
 }
+
+// recordingExecutor records the commands run through a MockExecutor
+type recordingExecutor struct {
+	*shell.MockExecutor
+	commands []string
+}
+
+func (r *recordingExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	r.commands = append(r.commands, cmdStr)
+	return r.MockExecutor.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func TestInstallImageBoot_ABLayoutBootsSlotA(t *testing.T) {
+	setupConfigDir(t)
+
+	template := &config.ImageTemplate{
+		Image: config.ImageInfo{
+			Name: "test-image",
+		},
+		Disk: config.DiskConfig{
+			PartitionTableType: "gpt",
+			Layout:             config.DiskLayoutAB,
+			Partitions: []config.PartitionInfo{
+				{ID: "esp", Start: "1MiB", End: "513MiB", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "rootfs", Start: "513MiB", End: "4557MiB", FsType: "ext4", MountPoint: "/"},
+			},
+		},
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{
+				Provider: "systemd-boot",
+				BootType: "efi",
+			},
+		},
+	}
+	if err := imagedisc.ApplyABLayout(&template.Disk); err != nil {
+		t.Fatalf("ApplyABLayout failed: %v", err)
+	}
+	diskPathIdMap := map[string]string{
+		"esp":      "/dev/loop0p1",
+		"rootfs":   "/dev/loop0p2",
+		"rootfs_b": "/dev/loop0p3",
+	}
+
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "boot", "efi", "loader", "entries"), 0755); err != nil {
+		t.Fatalf("Failed to create boot directories: %v", err)
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	recorder := &recordingExecutor{MockExecutor: shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir", Output: "", Error: nil},
+		{Pattern: "cp", Output: "", Error: nil},
+		{Pattern: "sed", Output: "", Error: nil},
+		{Pattern: `blkid /dev/loop0p2 -s PARTUUID`, Output: "partuuid-slot-a\n", Error: nil},
+		{Pattern: `blkid /dev/loop0p3 -s PARTUUID`, Output: "partuuid-slot-b\n", Error: nil},
+		{Pattern: "blkid.*UUID", Output: "test-uuid\n", Error: nil},
+		{Pattern: "bootctl", Output: "", Error: nil},
+	})}
+	shell.Default = recorder
+
+	imageBoot := NewImageBoot()
+	if err := imageBoot.InstallImageBoot(tmpDir, diskPathIdMap, template, "deb"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	rootReplaced := false
+	for _, cmd := range recorder.commands {
+		if strings.Contains(cmd, "/dev/loop0p3") || strings.Contains(cmd, "partuuid-slot-b") {
+			t.Errorf("Expected slot B to be left alone, got command: %s", cmd)
+		}
+		if strings.Contains(cmd, "{{.RootPartition}}|") {
+			rootReplaced = true
+			if !strings.Contains(cmd, "PARTUUID=partuuid-slot-a") {
+				t.Errorf("Expected the kernel command line to boot slot A, got command: %s", cmd)
+			}
+		}
+	}
+	if !rootReplaced {
+		t.Error("Expected the root partition to be set in the boot configuration")
+	}
+}
+
+func TestInstallImageBoot_CompressedRootIsReadOnly(t *testing.T) {
+	setupConfigDir(t)
+
+	template := &config.ImageTemplate{
+		Image: config.ImageInfo{
+			Name: "test-image",
+		},
+		Disk: config.DiskConfig{
+			PartitionTableType: "gpt",
+			Partitions: []config.PartitionInfo{
+				{ID: "esp", Start: "1MiB", End: "513MiB", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "boot", Start: "513MiB", End: "1537MiB", FsType: "ext4", MountPoint: "/boot"},
+				{ID: "rootfs", Start: "1537MiB", End: "0", FsType: config.FsTypeSquashfs, MountPoint: "/"},
+			},
+		},
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{
+				Provider: "systemd-boot",
+				BootType: "efi",
+			},
+		},
+	}
+	diskPathIdMap := map[string]string{
+		"esp":    "/dev/loop0p1",
+		"boot":   "/dev/loop0p2",
+		"rootfs": "/dev/loop0p3",
+	}
+
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "boot", "efi", "loader", "entries"), 0755); err != nil {
+		t.Fatalf("Failed to create boot directories: %v", err)
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	recorder := &recordingExecutor{MockExecutor: shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir", Output: "", Error: nil},
+		{Pattern: "cp", Output: "", Error: nil},
+		{Pattern: "sed", Output: "", Error: nil},
+		{Pattern: "blkid.*UUID", Output: "test-uuid\n", Error: nil},
+		{Pattern: "bootctl", Output: "", Error: nil},
+	})}
+	shell.Default = recorder
+
+	imageBoot := NewImageBoot()
+	if err := imageBoot.InstallImageBoot(tmpDir, diskPathIdMap, template, "deb"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	cmdlineReplaced := false
+	for _, cmd := range recorder.commands {
+		if strings.Contains(cmd, "{{.ExtraCommandLine}}|") {
+			cmdlineReplaced = true
+			if !strings.Contains(cmd, "ro rootfstype=squashfs systemd.volatile=overlay") {
+				t.Errorf("Expected a read-only squashfs root on the kernel command line, got command: %s", cmd)
+			}
+		}
+	}
+	if !cmdlineReplaced {
+		t.Error("Expected the extra command line to be set in the boot configuration")
+	}
+}
+
+func TestInstallImageBoot_DefaultKernelCmdline(t *testing.T) {
+	setupConfigDir(t)
+
+	template := &config.ImageTemplate{
+		Image: config.ImageInfo{
+			Name: "test-image",
+		},
+		Target: config.TargetInfo{
+			OS: "wind-river-elxr",
+		},
+		Disk: config.DiskConfig{
+			PartitionTableType: "gpt",
+			Partitions: []config.PartitionInfo{
+				{ID: "esp", Start: "1MiB", End: "513MiB", FsType: "fat32", MountPoint: "/boot/efi"},
+				{ID: "rootfs", Start: "513MiB", End: "0", FsType: "ext4", MountPoint: "/"},
+			},
+		},
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{
+				Provider: "systemd-boot",
+				BootType: "efi",
+			},
+		},
+	}
+	diskPathIdMap := map[string]string{
+		"esp":    "/dev/loop0p1",
+		"rootfs": "/dev/loop0p2",
+	}
+
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "boot", "efi", "loader", "entries"), 0755); err != nil {
+		t.Fatalf("Failed to create boot directories: %v", err)
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	recorder := &recordingExecutor{MockExecutor: shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir", Output: "", Error: nil},
+		{Pattern: "cp", Output: "", Error: nil},
+		{Pattern: "sed", Output: "", Error: nil},
+		{Pattern: `blkid /dev/loop0p2 -s PARTUUID`, Output: "partuuid-rootfs\n", Error: nil},
+		{Pattern: "blkid.*UUID", Output: "test-uuid\n", Error: nil},
+		{Pattern: "bootctl", Output: "", Error: nil},
+	})}
+	shell.Default = recorder
+
+	imageBoot := NewImageBoot()
+	if err := imageBoot.InstallImageBoot(tmpDir, diskPathIdMap, template, "deb"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	rootReplaced, cmdlineReplaced := false, false
+	for _, cmd := range recorder.commands {
+		if strings.Contains(cmd, "{{.RootPartition}}|") {
+			rootReplaced = true
+			if !strings.Contains(cmd, "|PARTUUID=partuuid-rootfs|") {
+				t.Errorf("Expected the root partition to be the rootfs partition, got command: %s", cmd)
+			}
+		}
+		if strings.Contains(cmd, "{{.ExtraCommandLine}}|") {
+			cmdlineReplaced = true
+			if !strings.Contains(cmd, "|quiet splash console=ttyS0,115200 console=tty0 loglevel=7|") {
+				t.Errorf("Expected the default eLxr kernel command line, got command: %s", cmd)
+			}
+		}
+	}
+	if !rootReplaced || !cmdlineReplaced {
+		t.Error("Expected the root partition and the extra command line to be set in the boot configuration")
+	}
+}
+
+func TestSplitKernelRootArg(t *testing.T) {
+	tests := []struct {
+		name      string
+		cmdline   string
+		wantRoot  string
+		wantExtra string
+	}{
+		{
+			name:      "root partition of the image",
+			cmdline:   "console=ttyS0,115200 console=tty0 loglevel=7",
+			wantRoot:  "PARTUUID=partuuid-rootfs",
+			wantExtra: "console=ttyS0,115200 console=tty0 loglevel=7",
+		},
+		{
+			name:      "root set by the command line",
+			cmdline:   "quiet root=/dev/mapper/rootfs_verity  console=tty0",
+			wantRoot:  "/dev/mapper/rootfs_verity",
+			wantExtra: "quiet console=tty0",
+		},
+		{
+			name:     "empty command line",
+			wantRoot: "PARTUUID=partuuid-rootfs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, extra := splitKernelRootArg(tt.cmdline, "PARTUUID=partuuid-rootfs")
+			if root != tt.wantRoot || extra != tt.wantExtra {
+				t.Errorf("splitKernelRootArg(%q) = %q, %q, want %q, %q", tt.cmdline, root, extra, tt.wantRoot, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestKernelPackageVersion(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "rpm -ql kernel-rt", Output: "/lib/modules/6.6.44-rt/modules.dep\n/lib/modules/6.6.44-rt/vmlinuz\n", Error: nil},
+		{Pattern: "rpm -ql kernel-headers", Output: "/usr/include/linux/version.h\n", Error: nil},
+		{Pattern: "dpkg -L linux-image-amd64", Output: "/usr/share/doc/linux-image-amd64\n", Error: nil},
+		{Pattern: "dpkg-query.*linux-image-amd64", Output: "linux-image-6.12.74+deb13-amd64 (= 6.12.74-2)", Error: nil},
+		{Pattern: "dpkg -L linux-image-6.12.74", Output: "/boot/System.map-6.12.74+deb13-amd64\n/boot/vmlinuz-6.12.74+deb13-amd64\n", Error: nil},
+	})
+
+	tests := []struct {
+		name        string
+		pkgType     string
+		pkg         string
+		want        string
+		expectError string
+	}{
+		{name: "rpm modules directory", pkgType: "rpm", pkg: "kernel-rt", want: "6.6.44-rt"},
+		{name: "deb metapackage", pkgType: "deb", pkg: "linux-image-amd64", want: "6.12.74+deb13-amd64"},
+		{name: "no kernel image", pkgType: "rpm", pkg: "kernel-headers", expectError: "installs no kernel image"},
+		{name: "unsupported package type", pkgType: "apk", pkg: "linux-lts", expectError: "unsupported package type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := KernelPackageVersion(t.TempDir(), tt.pkgType, tt.pkg)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got: %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected kernel version %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInstallImageBoot_GrubTargetsKernelPackage(t *testing.T) {
+	setupConfigDir(t)
+	diskPathIdMap := map[string]string{
+		"root": "/dev/sda1",
+	}
+
+	tmpDir := t.TempDir()
+	for _, dir := range []string{
+		filepath.Join(tmpDir, "boot", "efi", "boot", "grub2"),
+		filepath.Join(tmpDir, "boot", "grub2"),
+		filepath.Join(tmpDir, "etc", "default"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+	// The generic kernel sorts first in /boot, the requested one must still win
+	for _, kernel := range []string{"vmlinuz-6.12.74+deb13-amd64", "vmlinuz-6.12.74+deb13-rt-amd64"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, "boot", kernel), []byte(""), 0644); err != nil {
+			t.Fatalf("Failed to create mock kernel file: %v", err)
+		}
+	}
+
+	template := &config.ImageTemplate{
+		Image: config.ImageInfo{
+			Name: "test-image",
+		},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "root", MountPoint: "/"},
+			},
+		},
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{
+				Provider: "grub",
+				BootType: "efi",
+			},
+			Kernel: config.KernelConfig{
+				Cmdline: "console=tty0",
+				Package: "linux-image-6.12.74+deb13-rt-amd64=6.12.74-2",
+			},
+		},
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	recorder := &recordingExecutor{MockExecutor: shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "dpkg -L linux-image-6.12.74\\+deb13-rt-amd64", Output: "/boot/vmlinuz-6.12.74+deb13-rt-amd64\n", Error: nil},
+		{Pattern: "blkid.*UUID", Output: "UUID=test-uuid\n", Error: nil},
+		{Pattern: "blkid.*PARTUUID", Output: "PARTUUID=test-partuuid\n", Error: nil},
+		{Pattern: "command -v grub2-mkconfig", Output: "/usr/sbin/grub2-mkconfig", Error: nil},
+		{Pattern: "command -v update-initramfs", Output: "/usr/sbin/update-initramfs", Error: nil},
+		{Pattern: "mkdir", Output: "", Error: nil},
+		{Pattern: "cp", Output: "", Error: nil},
+		{Pattern: "sed", Output: "", Error: nil},
+		{Pattern: "chmod", Output: "", Error: nil},
+		{Pattern: "echo.*initramfs-tools/modules", Output: "", Error: nil},
+		{Pattern: "update-initramfs", Output: "", Error: nil},
+		{Pattern: "grub-install", Output: "", Error: nil},
+		{Pattern: "grub2-mkconfig", Output: "", Error: nil},
+	})}
+	shell.Default = recorder
+
+	imageBoot := NewImageBoot()
+	if err := imageBoot.InstallImageBoot(tmpDir, diskPathIdMap, template, "deb"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	updated := false
+	for _, cmd := range recorder.commands {
+		if strings.HasPrefix(cmd, "update-initramfs") {
+			updated = true
+			if cmd != "update-initramfs -u -k 6.12.74+deb13-rt-amd64" {
+				t.Errorf("Expected the initramfs of the requested kernel package to be updated, got command: %s", cmd)
+			}
+		}
+	}
+	if !updated {
+		t.Error("Expected the initramfs to be updated")
+	}
+}
@@ -0,0 +1,92 @@
+package imageboot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// initramfsCompressConf is the initramfs-tools configuration snippet that
+// overrides the COMPRESS= setting of initramfs.conf.
+const initramfsCompressConf = "/etc/initramfs-tools/conf.d/compress"
+
+// initramfsCompressor is the compressor the initramfs tools run in the image
+// for a compression algorithm, and the kernel option that lets the kernel
+// unpack an initramfs compressed with it.
+type initramfsCompressor struct {
+	command      string
+	kernelOption string
+}
+
+// initramfsCompressors are the supported systemConfig.initramfs.compression
+// algorithms, all of which dracut --compress and initramfs-tools COMPRESS=
+// accept under the same name.
+var initramfsCompressors = map[string]initramfsCompressor{
+	"gzip": {command: "gzip", kernelOption: "CONFIG_RD_GZIP"},
+	"xz":   {command: "xz", kernelOption: "CONFIG_RD_XZ"},
+	"zstd": {command: "zstd", kernelOption: "CONFIG_RD_ZSTD"},
+	"lz4":  {command: "lz4", kernelOption: "CONFIG_RD_LZ4"},
+}
+
+// CheckInitramfsCompression checks that the initramfs of kernelVersion can be
+// compressed with algorithm: the compressor must be installed in installRoot,
+// and the kernel must be able to unpack it. The kernel is only checked when
+// its configuration is installed as /boot/config-<kernelVersion>.
+func CheckInitramfsCompression(installRoot, kernelVersion, algorithm string) error {
+	compressor, ok := initramfsCompressors[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported initramfs compression %q", algorithm)
+	}
+
+	exists, err := shell.IsCommandExist(compressor.command, installRoot)
+	if err != nil {
+		return fmt.Errorf("failed to check %s availability: %w", compressor.command, err)
+	}
+	if !exists {
+		return fmt.Errorf("initramfs compression %s requires %s to be installed in the image", algorithm, compressor.command)
+	}
+
+	kernelConfig, err := os.ReadFile(filepath.Join(installRoot, "boot", "config-"+kernelVersion))
+	if err != nil {
+		log.Debugf("No configuration of kernel %s found, not checking its %s support: %v", kernelVersion, algorithm, err)
+		return nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(kernelConfig))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == compressor.kernelOption+"=y" {
+			return nil
+		}
+	}
+	return fmt.Errorf("kernel %s cannot unpack a %s compressed initramfs: %s is not enabled",
+		kernelVersion, algorithm, compressor.kernelOption)
+}
+
+// configureInitramfsToolsCompression makes update-initramfs compress the
+// initramfs with the algorithm of template, if it sets one.
+func configureInitramfsToolsCompression(installRoot, kernelVersion string, template *config.ImageTemplate) error {
+	algorithm := template.SystemConfig.Initramfs.Compression
+	if algorithm == "" {
+		return nil
+	}
+	if err := CheckInitramfsCompression(installRoot, kernelVersion, algorithm); err != nil {
+		return err
+	}
+
+	log.Infof("Compressing the initramfs with %s", algorithm)
+	cmds := []string{
+		fmt.Sprintf("mkdir -p %s", filepath.Dir(initramfsCompressConf)),
+		fmt.Sprintf("echo 'COMPRESS=%s' > %s", algorithm, initramfsCompressConf),
+	}
+	for _, cmd := range cmds {
+		if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+			return fmt.Errorf("failed to set initramfs compression: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package imageboot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// maxKernelMetapackageDepth bounds how many Debian metapackages, such as
+// linux-image-amd64 -> linux-image-6.12.74+deb13-amd64, are followed to the
+// package that ships the kernel image.
+const maxKernelMetapackageDepth = 3
+
+// TargetKernelVersion returns the version of the kernel the boot steps target,
+// as in /boot/vmlinuz-<version>: the one installed by systemConfig.kernel.package
+// if set, otherwise the first kernel image found in /boot.
+func TargetKernelVersion(installRoot, pkgType string, template *config.ImageTemplate) (string, error) {
+	kernelPkg := template.GetKernel().Package
+	if kernelPkg == "" {
+		return getKernelVersionFromBoot(installRoot)
+	}
+	version, err := KernelPackageVersion(installRoot, pkgType, ospackage.ParsePackageSpec(kernelPkg).Name)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Targeting kernel %s of kernel package %s", version, kernelPkg)
+	return version, nil
+}
+
+// KernelPackageVersion returns the version of the kernel image installed in
+// installRoot by the package pkg. Debian metapackages that ship no kernel
+// image are followed to the linux-image package they depend on.
+func KernelPackageVersion(installRoot, pkgType, pkg string) (string, error) {
+	current := pkg
+	for depth := 0; depth <= maxKernelMetapackageDepth; depth++ {
+		var listCmd string
+		switch pkgType {
+		case "rpm":
+			listCmd = "rpm -ql " + current
+		case "deb":
+			listCmd = "dpkg -L " + current
+		default:
+			return "", fmt.Errorf("unsupported package type for kernel package lookup: %s", pkgType)
+		}
+		output, err := shell.ExecCmd(listCmd, true, installRoot, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to list the files of kernel package %s: %w", current, err)
+		}
+		if version := kernelVersionFromFileList(output); version != "" {
+			return version, nil
+		}
+		if pkgType != "deb" {
+			break
+		}
+
+		dependsCmd := fmt.Sprintf("dpkg-query -W -f='${Depends}' %s", current)
+		output, err = shell.ExecCmd(dependsCmd, true, installRoot, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to query the dependencies of kernel package %s: %w", current, err)
+		}
+		next := kernelImageDependency(output)
+		if next == "" {
+			break
+		}
+		current = next
+	}
+	return "", fmt.Errorf("kernel package %s installs no kernel image", pkg)
+}
+
+// kernelVersionFromFileList returns the kernel version of the first kernel
+// image in the file list of a package, /boot/vmlinuz-<version> or
+// /lib/modules/<version>/vmlinuz, or "" if it has none.
+func kernelVersionFromFileList(files string) string {
+	for _, line := range strings.Split(files, "\n") {
+		line = strings.TrimSpace(line)
+		if version, ok := strings.CutPrefix(line, "/boot/vmlinuz-"); ok && version != "" && !strings.Contains(version, "/") {
+			return version
+		}
+		for _, modulesDir := range []string{"/lib/modules/", "/usr/lib/modules/"} {
+			if rest, ok := strings.CutPrefix(line, modulesDir); ok {
+				if version, ok := strings.CutSuffix(rest, "/vmlinuz"); ok && version != "" && !strings.Contains(version, "/") {
+					return version
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// kernelImageDependency returns the first linux-image package of a Debian
+// Depends field, or "" if there is none.
+func kernelImageDependency(depends string) string {
+	for _, dep := range strings.Split(depends, ",") {
+		name := ospackage.ParsePackageSpec(dep).Name
+		if strings.HasPrefix(name, "linux-image-") {
+			return name
+		}
+	}
+	return ""
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/compression"
@@ -25,50 +27,97 @@ func NewImageConvert() *ImageConvert {
 	return &ImageConvert{}
 }
 
+// ConvertImageFile writes every artifact of the template disk config next to
+// the raw image at filePath, so one build can produce e.g. a qcow2 image for
+// development and a zstd-compressed raw image for deployment. Each format is
+// converted from the raw image once, however many compressions it is
+// requested with, and an uncompressed output, the raw image included, is only
+// kept if an artifact requests it. A sparse disk config has the raw image
+// sparsified first.
 func (imageConvert *ImageConvert) ConvertImageFile(filePath string, template *config.ImageTemplate) error {
-	var keepRawImage bool
-	var rawImageCompressionType string
-
 	if template == nil {
 		return fmt.Errorf("image template is nil")
 	}
 
 	diskConfig := template.GetDiskConfig()
-	if diskConfig.Artifacts != nil {
-		if len(diskConfig.Artifacts) > 0 {
-			for _, artifact := range diskConfig.Artifacts {
-				if artifact.Type != "raw" {
-					outputFilePath, err := convertImageFile(filePath, artifact.Type)
-					if err != nil {
-						return fmt.Errorf("failed to convert image file: %w", err)
-					}
-					if artifact.Compression != "" {
-						if err = compressImageFile(outputFilePath, artifact.Compression); err != nil {
-							return fmt.Errorf("failed to compress image file: %w", err)
-						}
-					}
-				} else {
-					keepRawImage = true
-					if artifact.Compression != "" {
-						rawImageCompressionType = artifact.Compression
-					}
-				}
-			}
+	if len(diskConfig.Artifacts) == 0 {
+		return nil
+	}
 
-			if !keepRawImage {
-				if err := os.Remove(filePath); err != nil {
-					log.Warnf("Failed to remove raw image file: %v", err)
-				}
-			} else {
-				if rawImageCompressionType != "" {
-					if err := compressImageFile(filePath, rawImageCompressionType); err != nil {
-						return fmt.Errorf("failed to compress raw image file: %w", err)
-					}
-				}
-			}
+	if diskConfig.Sparse {
+		if err := sparsifyImageFile(filePath); err != nil {
+			return err
+		}
+	}
+
+	var rawOutput *artifactOutput
+	for _, output := range groupArtifacts(diskConfig.Artifacts) {
+		// The raw image is the source of every conversion, so it is
+		// compressed and removed last
+		if output.imageType == "raw" {
+			rawOutput = output
+			continue
+		}
+		outputFilePath, err := convertImageFile(filePath, output.imageType)
+		if err != nil {
+			return fmt.Errorf("failed to convert image file: %w", err)
+		}
+		if err := finishArtifact(outputFilePath, output); err != nil {
+			return fmt.Errorf("failed to compress image file: %w", err)
+		}
+	}
+
+	if rawOutput == nil {
+		rawOutput = &artifactOutput{imageType: "raw"}
+	}
+	if err := finishArtifact(filePath, rawOutput); err != nil {
+		return fmt.Errorf("failed to compress raw image file: %w", err)
+	}
+	return nil
+}
+
+// artifactOutput collects the artifacts requested for one image format.
+type artifactOutput struct {
+	imageType        string
+	keepUncompressed bool     // an artifact requests the format without compression
+	compressions     []string // compressions requested for the format
+}
+
+// groupArtifacts groups artifacts by image format, in the order the formats
+// are first requested, dropping duplicate artifacts.
+func groupArtifacts(artifacts []config.ArtifactInfo) []*artifactOutput {
+	var outputs []*artifactOutput
+	byType := make(map[string]*artifactOutput)
+	for _, artifact := range artifacts {
+		output, ok := byType[artifact.Type]
+		if !ok {
+			output = &artifactOutput{imageType: artifact.Type}
+			byType[artifact.Type] = output
+			outputs = append(outputs, output)
+		}
+		if artifact.Compression == "" {
+			output.keepUncompressed = true
+		} else if !slices.Contains(output.compressions, artifact.Compression) {
+			output.compressions = append(output.compressions, artifact.Compression)
 		}
 	}
+	return outputs
+}
 
+// finishArtifact compresses the image at filePath with every compression of
+// output, then removes it unless output keeps it uncompressed.
+func finishArtifact(filePath string, output *artifactOutput) error {
+	for _, compressionType := range output.compressions {
+		if err := compressImageFile(filePath, compressionType); err != nil {
+			return err
+		}
+	}
+	if output.keepUncompressed {
+		return nil
+	}
+	if err := os.Remove(filePath); err != nil {
+		log.Warnf("Failed to remove uncompressed %s image file: %v", output.imageType, err)
+	}
 	return nil
 }
 
@@ -84,7 +133,7 @@ func DetectImageFormat(filePath string) (string, error) {
 		return "", fmt.Errorf("image path is a directory: %s", filePath)
 	}
 
-	qPath := shellSingleQuote(filePath)
+	qPath := shell.SingleQuote(filePath)
 	cmdStr := fmt.Sprintf("qemu-img info --output=json -- %s", qPath)
 
 	out, err := shell.ExecCmd(cmdStr, false, shell.HostPath, nil)
@@ -139,14 +188,6 @@ func DetectImageFormat(filePath string) (string, error) {
 	return format, nil
 }
 
-// shellSingleQuote wraps s in single quotes for POSIX shells and escapes any
-// embedded single quotes using the pattern `'"'"'`, which ends the current
-// single-quoted string, adds an escaped single quote, and starts a new
-// single-quoted string.
-func shellSingleQuote(s string) string {
-	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
-}
-
 // formatFromExt provides a fallback format detection based on common file
 // extensions when qemu-img based detection fails.
 func formatFromExt(filePath string) string {
@@ -268,14 +309,42 @@ func convertImageFile(filePath, imageType string) (string, error) {
 	return outputFilePath, nil
 }
 
+// compressImageFile writes filePath compressed with compressionType next to
+// it, keeping filePath itself.
 func compressImageFile(filePath, compressionType string) error {
 	log.Infof("Compressing image file %s with %s", filePath, compressionType)
 
 	if err := compression.CompressFile(filePath, filePath+"."+compressionType, compressionType, false); err != nil {
 		return fmt.Errorf("failed to compress file: %w", err)
 	}
-	if err := os.Remove(filePath); err != nil {
-		log.Warnf("Failed to remove uncompressed image file: %v", err)
+	return nil
+}
+
+// sparsifyImageFile deallocates the blocks of the raw image at filePath that
+// only hold zeros, so they are not stored on disk. The logical size and
+// content of the image are unchanged, so conversions, compressions and
+// checksums read the same image as before.
+func sparsifyImageFile(filePath string) error {
+	before, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat image file %s: %w", filePath, err)
+	}
+
+	log.Infof("Sparsifying raw image file %s", filePath)
+	if _, err := shell.ExecCmd("fallocate --dig-holes "+filePath, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to sparsify image file %s: %w", filePath, err)
+	}
+
+	after, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat image file %s: %w", filePath, err)
+	}
+	if after.Size() != before.Size() {
+		return fmt.Errorf("sparsifying image file %s changed its size from %d to %d bytes",
+			filePath, before.Size(), after.Size())
+	}
+	if stat, ok := after.Sys().(*syscall.Stat_t); ok {
+		log.Infof("Sparse raw image file %s: %d bytes, %d bytes allocated", filePath, after.Size(), stat.Blocks*512)
 	}
 	return nil
 }
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"testing"
 
@@ -1181,3 +1184,175 @@ func TestConvertImageFile_ToRaw(t *testing.T) {
 		t.Fatalf("Expected .raw output path, got %s", outputPath)
 	}
 }
+
+// outputWritingExecutor records the commands it runs and creates the output
+// file of qemu-img convert and compression commands, like the real tools.
+type outputWritingExecutor struct {
+	*shell.MockExecutor
+	commands []string
+}
+
+func (e *outputWritingExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.commands = append(e.commands, cmdStr)
+	fields := strings.Fields(cmdStr)
+	var output string
+	switch {
+	case strings.HasPrefix(cmdStr, "qemu-img info"):
+		return `{"format": "raw"}`, nil
+	case strings.HasPrefix(cmdStr, "qemu-img convert"):
+		output = fields[len(fields)-1]
+	case strings.HasPrefix(cmdStr, "zstd"):
+		output = fields[len(fields)-2]
+	case strings.HasPrefix(cmdStr, "gzip"), strings.HasPrefix(cmdStr, "xz"):
+		output = fields[len(fields)-1]
+	default:
+		return e.MockExecutor.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+	}
+	return "", os.WriteFile(output, []byte("converted"), 0644)
+}
+
+func TestConvertImageFile_MultipleOutputFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		artifacts   []config.ArtifactInfo
+		conversions int
+		wantFiles   []string
+	}{
+		{
+			name:        "three formats",
+			artifacts:   []config.ArtifactInfo{{Type: "qcow2"}, {Type: "vhd"}, {Type: "vmdk"}},
+			conversions: 3,
+			wantFiles:   []string{"test-image.qcow2", "test-image.vhd", "test-image.vmdk"},
+		},
+		{
+			name:        "converted and compressed raw",
+			artifacts:   []config.ArtifactInfo{{Type: "qcow2"}, {Type: "raw", Compression: "zstd"}, {Type: "vmdk", Compression: "gz"}},
+			conversions: 2,
+			wantFiles:   []string{"test-image.qcow2", "test-image.raw.zstd", "test-image.vmdk.gz"},
+		},
+		{
+			name: "one format with several compressions",
+			artifacts: []config.ArtifactInfo{
+				{Type: "raw"}, {Type: "raw", Compression: "zstd"}, {Type: "qcow2", Compression: "xz"},
+				{Type: "qcow2"}, {Type: "qcow2", Compression: "xz"},
+			},
+			conversions: 1,
+			wantFiles:   []string{"test-image.raw", "test-image.raw.zstd", "test-image.qcow2", "test-image.qcow2.xz"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalExecutor := shell.Default
+			defer func() { shell.Default = originalExecutor }()
+			recorder := &outputWritingExecutor{MockExecutor: shell.NewMockExecutor(nil)}
+			shell.Default = recorder
+
+			tempDir := t.TempDir()
+			filePath := filepath.Join(tempDir, "test-image.raw")
+			if err := os.WriteFile(filePath, []byte("test data"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			template := &config.ImageTemplate{Disk: config.DiskConfig{Artifacts: tt.artifacts}}
+
+			if err := NewImageConvert().ConvertImageFile(filePath, template); err != nil {
+				t.Fatalf("ConvertImageFile() error = %v", err)
+			}
+
+			conversions := 0
+			for _, cmd := range recorder.commands {
+				if strings.HasPrefix(cmd, "qemu-img convert") {
+					if !strings.Contains(cmd, filePath) {
+						t.Errorf("expected conversion from the raw image, got %q", cmd)
+					}
+					conversions++
+				}
+			}
+			if conversions != tt.conversions {
+				t.Errorf("expected %d conversions, got %d: %v", tt.conversions, conversions, recorder.commands)
+			}
+
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to read output dir: %v", err)
+			}
+			var files []string
+			for _, entry := range entries {
+				files = append(files, entry.Name())
+			}
+			sort.Strings(files)
+			want := append([]string(nil), tt.wantFiles...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(files, want) {
+				t.Errorf("output files = %v, want %v", files, want)
+			}
+		})
+	}
+}
+
+func TestSparsifyImageFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test-image.raw")
+	const logicalSize = 8 * 1024 * 1024
+	if err := os.WriteFile(filePath, []byte("boot sector"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Truncate(filePath, logicalSize); err != nil {
+		t.Fatalf("Failed to extend test file: %v", err)
+	}
+
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "fallocate --dig-holes " + regexp.QuoteMeta(filePath) + "$", Output: ""},
+	})
+
+	if err := sparsifyImageFile(filePath); err != nil {
+		t.Fatalf("sparsifyImageFile failed: %v", err)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("Failed to stat sparse image: %v", err)
+	}
+	if info.Size() != logicalSize {
+		t.Errorf("Expected logical size %d, got %d", logicalSize, info.Size())
+	}
+
+	if err := sparsifyImageFile(filepath.Join(t.TempDir(), "missing.raw")); err == nil {
+		t.Error("Expected error for a missing image file")
+	}
+}
+
+func TestConvertImageFile_SparseBeforeCompression(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	for _, sparse := range []bool{true, false} {
+		t.Run(fmt.Sprintf("sparse=%v", sparse), func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "test-image.raw")
+			if err := os.WriteFile(filePath, []byte("test data"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			template := &config.ImageTemplate{
+				Disk: config.DiskConfig{
+					Sparse:    sparse,
+					Artifacts: []config.ArtifactInfo{{Type: "raw", Compression: "zstd"}},
+				},
+			}
+			shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+				{Pattern: "fallocate --dig-holes", Error: fmt.Errorf("dig holes invoked")},
+				{Pattern: "zstd", Output: ""},
+			})
+
+			err := NewImageConvert().ConvertImageFile(filePath, template)
+			if sparse {
+				if err == nil || !strings.Contains(err.Error(), "failed to sparsify image file") {
+					t.Errorf("Expected the sparsify step to run before compression, got %v", err)
+				}
+				if _, statErr := os.Stat(filePath); statErr != nil {
+					t.Errorf("Expected the raw image to be kept when sparsifying fails: %v", statErr)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no sparsify step for a non-sparse disk, got %v", err)
+			}
+		})
+	}
+}
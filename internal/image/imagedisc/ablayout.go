@@ -0,0 +1,176 @@
+package imagedisc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+)
+
+// Suffixes that tell the two slots of an A/B layout apart in partition IDs,
+// partition names and filesystem labels.
+const (
+	ABSlotASuffix = "_a"
+	ABSlotBSuffix = "_b"
+)
+
+// fsLabelMaxLen is the longest filesystem label mkfs accepts per fsType.
+var fsLabelMaxLen = map[string]int{
+	"fat16": 11,
+	"fat32": 11,
+	"vfat":  11,
+	"xfs":   12,
+}
+
+// isABSlotted reports whether the partition is duplicated in an A/B layout.
+func isABSlotted(partition config.PartitionInfo) bool {
+	return partition.MountPoint == "/" || partition.MountPoint == "/boot"
+}
+
+// ApplyABLayout expands the partitions of a disk with the "ab" layout. The
+// root partition, and the /boot partition if there is a separate one, is
+// followed by a slot B copy of the same size; later partitions move up and
+// the disk grows by the size of the copies. Slot A keeps the ID and mount
+// point, so the OS is installed into it and the bootloader and fstab point at
+// it, while slot B is formatted but left empty and unmounted. Both slots get
+// distinct partition names and filesystem labels. Disks with another layout,
+// or whose slots were already added, are left unchanged.
+func ApplyABLayout(disk *config.DiskConfig) error {
+	if disk.Layout != config.DiskLayoutAB {
+		return nil
+	}
+	if disk.PartitionTableType != PartitionTableTypeGpt {
+		return fmt.Errorf("A/B disk layout requires a gpt partition table, got %q", disk.PartitionTableType)
+	}
+
+	existingIDs := make(map[string]bool, len(disk.Partitions))
+	for _, partition := range disk.Partitions {
+		existingIDs[partition.ID] = true
+	}
+
+	var partitions []config.PartitionInfo
+	var shift, prevEnd uint64
+	hasRoot := false
+	for _, partition := range disk.Partitions {
+		start, err := parseOffset(partition.Start)
+		if err != nil {
+			return fmt.Errorf("invalid start %q of partition %q: %w", partition.Start, partition.ID, err)
+		}
+		if start < prevEnd {
+			return fmt.Errorf("A/B disk layout requires partitions in disk order, %q starts before the previous partition ends", partition.ID)
+		}
+
+		var end uint64
+		if !partition.FillsRemaining() {
+			if end, err = TranslateSizeStrToBytes(partition.End); err != nil {
+				return fmt.Errorf("invalid end %q of partition %q: %w", partition.End, partition.ID, err)
+			}
+			prevEnd = end
+		}
+
+		if !isABSlotted(partition) || existingIDs[partition.ID+ABSlotBSuffix] {
+			if shift > 0 {
+				if partition.Start, err = formatOffset(start + shift); err != nil {
+					return err
+				}
+				if !partition.FillsRemaining() {
+					if partition.End, err = formatOffset(end + shift); err != nil {
+						return err
+					}
+				}
+			}
+			hasRoot = hasRoot || partition.MountPoint == "/"
+			partitions = append(partitions, partition)
+			continue
+		}
+
+		if partition.FillsRemaining() {
+			return fmt.Errorf("A/B disk layout requires an explicit end for partition %q", partition.ID)
+		}
+		if partition.Index != nil {
+			return fmt.Errorf("A/B disk layout does not support an explicit index for partition %q", partition.ID)
+		}
+		hasRoot = hasRoot || partition.MountPoint == "/"
+
+		slotA, slotB := partition, partition
+		name := partition.Name
+		if name == "" {
+			name = partition.ID
+		}
+		slotA.Name = name + ABSlotASuffix
+		slotB.Name = name + ABSlotBSuffix
+		slotB.ID = partition.ID + ABSlotBSuffix
+		slotB.MountPoint = ""
+		slotB.MountOptions = ""
+		if partition.FsLabel != "" {
+			slotA.FsLabel = slotFsLabel(partition.FsLabel, partition.FsType, ABSlotASuffix)
+			slotB.FsLabel = slotFsLabel(partition.FsLabel, partition.FsType, ABSlotBSuffix)
+		}
+
+		size := end - start
+		if slotA.Start, err = formatOffset(start + shift); err != nil {
+			return err
+		}
+		if slotA.End, err = formatOffset(end + shift); err != nil {
+			return err
+		}
+		shift += size
+		slotB.Start = slotA.End
+		if slotB.End, err = formatOffset(end + shift); err != nil {
+			return err
+		}
+		partitions = append(partitions, slotA, slotB)
+	}
+
+	if !hasRoot {
+		return fmt.Errorf("A/B disk layout requires a root partition with mountPoint \"/\"")
+	}
+
+	if shift > 0 && disk.Size != "" {
+		size, err := TranslateSizeStrToBytes(disk.Size)
+		if err != nil {
+			return fmt.Errorf("invalid disk size %q: %w", disk.Size, err)
+		}
+		if disk.Size, err = formatOffset(size + shift); err != nil {
+			return err
+		}
+	}
+	disk.Partitions = partitions
+	return nil
+}
+
+// parseOffset converts a partition offset to bytes; "0" is the start of the
+// disk.
+func parseOffset(offset string) (uint64, error) {
+	if offset == "0" {
+		return 0, nil
+	}
+	return TranslateSizeStrToBytes(offset)
+}
+
+// formatOffset formats a byte offset in the largest binary unit that
+// represents it exactly.
+func formatOffset(bytes uint64) (string, error) {
+	const kib, mib = 1024, 1024 * 1024
+	switch {
+	case bytes%mib == 0:
+		return fmt.Sprintf("%dMiB", bytes/mib), nil
+	case bytes%kib == 0:
+		return fmt.Sprintf("%dKiB", bytes/kib), nil
+	default:
+		return "", fmt.Errorf("offset of %d bytes is not aligned to 1KiB", bytes)
+	}
+}
+
+// slotFsLabel appends the slot suffix to label, shortening label so the
+// result still fits the label length limit of fsType.
+func slotFsLabel(label, fsType, suffix string) string {
+	maxLen, ok := fsLabelMaxLen[strings.ToLower(fsType)]
+	if !ok {
+		maxLen = 16 // ext2/3/4 and swap
+	}
+	if len(label)+len(suffix) > maxLen {
+		label = label[:maxLen-len(suffix)]
+	}
+	return label + suffix
+}
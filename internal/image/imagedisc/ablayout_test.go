@@ -0,0 +1,190 @@
+package imagedisc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+)
+
+func abTestDisk() config.DiskConfig {
+	return config.DiskConfig{
+		Name:               "ab",
+		Size:               "6GiB",
+		PartitionTableType: "gpt",
+		Layout:             config.DiskLayoutAB,
+		Partitions: []config.PartitionInfo{
+			{ID: "esp", Type: "esp", Start: "1MiB", End: "513MiB", FsType: "fat32", MountPoint: "/boot/efi"},
+			{ID: "boot", Type: "linux", Start: "513MiB", End: "1GiB", FsType: "ext4", FsLabel: "boot", MountPoint: "/boot"},
+			{ID: "rootfs", Type: "linux-root-amd64", Start: "1GiB", End: "3GiB", FsType: "ext4",
+				FsLabel: "cloudimg-rootfs", MountPoint: "/", MountOptions: "defaults"},
+			{ID: "userdata", Type: "linux", Start: "3GiB", End: "0", FsType: "ext4", MountPoint: "/opt"},
+		},
+	}
+}
+
+func TestApplyABLayout(t *testing.T) {
+	disk := abTestDisk()
+	if err := ApplyABLayout(&disk); err != nil {
+		t.Fatalf("ApplyABLayout failed: %v", err)
+	}
+
+	expected := []config.PartitionInfo{
+		{ID: "esp", Type: "esp", Start: "1MiB", End: "513MiB", FsType: "fat32", MountPoint: "/boot/efi"},
+		{ID: "boot", Name: "boot_a", Type: "linux", Start: "513MiB", End: "1024MiB", FsType: "ext4",
+			FsLabel: "boot_a", MountPoint: "/boot"},
+		{ID: "boot_b", Name: "boot_b", Type: "linux", Start: "1024MiB", End: "1535MiB", FsType: "ext4",
+			FsLabel: "boot_b"},
+		{ID: "rootfs", Name: "rootfs_a", Type: "linux-root-amd64", Start: "1535MiB", End: "3583MiB", FsType: "ext4",
+			FsLabel: "cloudimg-rootf_a", MountPoint: "/", MountOptions: "defaults"},
+		{ID: "rootfs_b", Name: "rootfs_b", Type: "linux-root-amd64", Start: "3583MiB", End: "5631MiB", FsType: "ext4",
+			FsLabel: "cloudimg-rootf_b"},
+		{ID: "userdata", Type: "linux", Start: "5631MiB", End: "0", FsType: "ext4", MountPoint: "/opt"},
+	}
+	if !reflect.DeepEqual(disk.Partitions, expected) {
+		t.Errorf("unexpected A/B partitions:\ngot:  %+v\nwant: %+v", disk.Partitions, expected)
+	}
+	if disk.Size != "8703MiB" {
+		t.Errorf("expected the disk to grow by both slot B copies to 8703MiB, got %s", disk.Size)
+	}
+
+	// Applying the layout again must not add more slots
+	again := disk
+	again.Partitions = append([]config.PartitionInfo(nil), disk.Partitions...)
+	if err := ApplyABLayout(&again); err != nil {
+		t.Fatalf("ApplyABLayout failed on an expanded disk: %v", err)
+	}
+	if !reflect.DeepEqual(again, disk) {
+		t.Errorf("expected an expanded disk to be left unchanged, got %+v", again.Partitions)
+	}
+}
+
+func TestApplyABLayout_RootOnly(t *testing.T) {
+	disk := config.DiskConfig{
+		PartitionTableType: "gpt",
+		Layout:             config.DiskLayoutAB,
+		Partitions: []config.PartitionInfo{
+			{ID: "esp", Start: "1MiB", End: "513MiB", FsType: "fat32", MountPoint: "/boot/efi"},
+			{ID: "rootfs", Start: "513MiB", End: "4557MiB", FsType: "ext4", MountPoint: "/"},
+			{ID: "roothashmap", Start: "4557MiB", End: "5057MiB", FsType: "ext4", MountPoint: "none"},
+		},
+	}
+	if err := ApplyABLayout(&disk); err != nil {
+		t.Fatalf("ApplyABLayout failed: %v", err)
+	}
+
+	var ids []string
+	for _, partition := range disk.Partitions {
+		ids = append(ids, partition.ID)
+	}
+	if strings.Join(ids, ",") != "esp,rootfs,rootfs_b,roothashmap" {
+		t.Errorf("unexpected partitions %v", ids)
+	}
+	if disk.Partitions[2].Start != "4557MiB" || disk.Partitions[2].End != "8601MiB" ||
+		disk.Partitions[3].Start != "8601MiB" || disk.Partitions[3].End != "9101MiB" {
+		t.Errorf("unexpected offsets %+v", disk.Partitions)
+	}
+	if disk.Size != "" {
+		t.Errorf("expected an unset disk size to stay unset, got %s", disk.Size)
+	}
+}
+
+func TestApplyABLayout_Unchanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+	}{
+		{name: "default", layout: ""},
+		{name: "standard", layout: config.DiskLayoutStandard},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disk := abTestDisk()
+			disk.Layout = tt.layout
+			expected := abTestDisk()
+			expected.Layout = tt.layout
+
+			if err := ApplyABLayout(&disk); err != nil {
+				t.Fatalf("ApplyABLayout failed: %v", err)
+			}
+			if !reflect.DeepEqual(disk, expected) {
+				t.Errorf("expected the disk to be unchanged, got %+v", disk.Partitions)
+			}
+		})
+	}
+}
+
+func TestApplyABLayout_Errors(t *testing.T) {
+	index := 2
+	tests := []struct {
+		name        string
+		modify      func(disk *config.DiskConfig)
+		expectError string
+	}{
+		{
+			name:        "mbr",
+			modify:      func(disk *config.DiskConfig) { disk.PartitionTableType = "mbr" },
+			expectError: "requires a gpt partition table",
+		},
+		{
+			name:        "root fills the disk",
+			modify:      func(disk *config.DiskConfig) { disk.Partitions = disk.Partitions[:3]; disk.Partitions[2].End = "0" },
+			expectError: "requires an explicit end for partition \"rootfs\"",
+		},
+		{
+			name:        "no root",
+			modify:      func(disk *config.DiskConfig) { disk.Partitions[2].MountPoint = "/srv" },
+			expectError: "requires a root partition",
+		},
+		{
+			name: "out of order",
+			modify: func(disk *config.DiskConfig) {
+				disk.Partitions[1], disk.Partitions[2] = disk.Partitions[2], disk.Partitions[1]
+			},
+			expectError: "requires partitions in disk order",
+		},
+		{
+			name:        "explicit index",
+			modify:      func(disk *config.DiskConfig) { disk.Partitions[2].Index = &index },
+			expectError: "does not support an explicit index",
+		},
+		{
+			name:        "invalid offset",
+			modify:      func(disk *config.DiskConfig) { disk.Partitions[2].End = "3TB!" },
+			expectError: "invalid end",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disk := abTestDisk()
+			tt.modify(&disk)
+			err := ApplyABLayout(&disk)
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestSlotFsLabel(t *testing.T) {
+	tests := []struct {
+		label    string
+		fsType   string
+		suffix   string
+		expected string
+	}{
+		{"rootfs", "ext4", ABSlotASuffix, "rootfs_a"},
+		{"cloudimg-rootfs", "ext4", ABSlotBSuffix, "cloudimg-rootf_b"},
+		{"BOOTPARTITION", "fat32", ABSlotASuffix, "BOOTPARTI_a"},
+		{"xfs-rootfs-1", "xfs", ABSlotBSuffix, "xfs-rootfs_b"},
+	}
+
+	for _, tt := range tests {
+		if got := slotFsLabel(tt.label, tt.fsType, tt.suffix); got != tt.expected {
+			t.Errorf("slotFsLabel(%q, %q, %q) = %q, want %q", tt.label, tt.fsType, tt.suffix, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package imagedisc
+
+import (
+	"fmt"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+)
+
+// gptBackupBytes is the space the backup GPT takes at the end of a disk with
+// 512-byte sectors: the header and 32 sectors of partition entries.
+const gptBackupBytes = 33 * 512
+
+// GrowPartitionSize returns the index in disk.Partitions of the partition
+// that fills the remaining space of the disk, or -1 if none does, and its
+// size in bytes computed from the disk size. The growing partition must be
+// the last one on the disk, and the disk must leave room for it. Its size is
+// 0 when the disk size is not set, as for a live installation onto a disk
+// whose size is only known at install time.
+func GrowPartitionSize(disk config.DiskConfig) (int, uint64, error) {
+	growIdx := -1
+	for i, partition := range disk.Partitions {
+		if !partition.FillsRemaining() {
+			continue
+		}
+		if growIdx != -1 {
+			return -1, 0, fmt.Errorf("partitions %q and %q both fill the remaining disk space",
+				disk.Partitions[growIdx].ID, partition.ID)
+		}
+		growIdx = i
+	}
+	if growIdx == -1 {
+		return -1, 0, nil
+	}
+
+	grow := disk.Partitions[growIdx]
+	start, err := parseOffset(grow.Start)
+	if err != nil {
+		return -1, 0, fmt.Errorf("invalid start %q of partition %q: %w", grow.Start, grow.ID, err)
+	}
+	for i, partition := range disk.Partitions {
+		if i == growIdx {
+			continue
+		}
+		otherStart, err := parseOffset(partition.Start)
+		if err != nil {
+			return -1, 0, fmt.Errorf("invalid start %q of partition %q: %w", partition.Start, partition.ID, err)
+		}
+		if otherStart >= start {
+			return -1, 0, fmt.Errorf("partition %q fills the remaining disk space but is followed by partition %q",
+				grow.ID, partition.ID)
+		}
+	}
+
+	if disk.Size == "" {
+		return growIdx, 0, nil
+	}
+	diskSize, err := TranslateSizeStrToBytes(disk.Size)
+	if err != nil {
+		return -1, 0, fmt.Errorf("invalid disk size %q: %w", disk.Size, err)
+	}
+	end := diskSize
+	if disk.PartitionTableType == PartitionTableTypeGpt {
+		end -= min(end, gptBackupBytes)
+	}
+	if start >= end {
+		return -1, 0, fmt.Errorf("partition %q starts at %s, leaving no space on the %s disk to fill",
+			grow.ID, grow.Start, disk.Size)
+	}
+	return growIdx, end - start, nil
+}
@@ -0,0 +1,93 @@
+package imagedisc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+)
+
+func TestGrowPartitionSize(t *testing.T) {
+	const mib = 1024 * 1024
+	esp := config.PartitionInfo{ID: "esp", Start: "1MiB", End: "513MiB", FsType: "fat32"}
+
+	tests := []struct {
+		name       string
+		disk       config.DiskConfig
+		expectIdx  int
+		expectSize uint64
+		errorMsg   string
+	}{
+		{
+			name: "end 0 on gpt",
+			disk: config.DiskConfig{Size: "4GiB", PartitionTableType: "gpt", Partitions: []config.PartitionInfo{
+				esp, {ID: "rootfs", Start: "513MiB", End: "0", FsType: "ext4"},
+			}},
+			expectIdx:  1,
+			expectSize: (4096-513)*mib - gptBackupBytes,
+		},
+		{
+			name: "grow on mbr",
+			disk: config.DiskConfig{Size: "4GiB", PartitionTableType: "mbr", Partitions: []config.PartitionInfo{
+				esp, {ID: "rootfs", Start: "513MiB", Grow: true, FsType: "ext4"},
+			}},
+			expectIdx:  1,
+			expectSize: (4096 - 513) * mib,
+		},
+		{
+			name: "explicit sizes",
+			disk: config.DiskConfig{Size: "4GiB", PartitionTableType: "gpt", Partitions: []config.PartitionInfo{
+				esp, {ID: "rootfs", Start: "513MiB", End: "3GiB", FsType: "ext4"},
+			}},
+			expectIdx: -1,
+		},
+		{
+			name: "no disk size",
+			disk: config.DiskConfig{PartitionTableType: "gpt", Partitions: []config.PartitionInfo{
+				esp, {ID: "rootfs", Start: "513MiB", Grow: true, FsType: "ext4"},
+			}},
+			expectIdx: 1,
+		},
+		{
+			name: "two fill-to-end partitions",
+			disk: config.DiskConfig{Size: "4GiB", PartitionTableType: "gpt", Partitions: []config.PartitionInfo{
+				esp, {ID: "rootfs", Start: "513MiB", End: "0", FsType: "ext4"},
+				{ID: "data", Start: "3GiB", Grow: true, FsType: "ext4"},
+			}},
+			errorMsg: `partitions "rootfs" and "data" both fill the remaining disk space`,
+		},
+		{
+			name: "grow partition not last",
+			disk: config.DiskConfig{Size: "4GiB", PartitionTableType: "gpt", Partitions: []config.PartitionInfo{
+				{ID: "rootfs", Start: "1MiB", Grow: true, FsType: "ext4"},
+				{ID: "data", Start: "3GiB", End: "4000MiB", FsType: "ext4"},
+			}},
+			errorMsg: `partition "rootfs" fills the remaining disk space but is followed by partition "data"`,
+		},
+		{
+			name: "no space left",
+			disk: config.DiskConfig{Size: "512MiB", PartitionTableType: "gpt", Partitions: []config.PartitionInfo{
+				esp, {ID: "rootfs", Start: "513MiB", Grow: true, FsType: "ext4"},
+			}},
+			errorMsg: "leaving no space",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, size, err := GrowPartitionSize(tt.disk)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if idx != tt.expectIdx || size != tt.expectSize {
+				t.Errorf("expected partition %d of %d bytes, got partition %d of %d bytes", tt.expectIdx, tt.expectSize, idx, size)
+			}
+		})
+	}
+}
@@ -437,7 +437,8 @@ func diskPartitionCreate(
 	partitionType string) (string, error) {
 
 	partitionTypeList := []string{"primary", "extended", "logical"}
-	fsTypeList := []string{"fat32", "fat16", "vfat", "ext2", "ext3", "ext4", "xfs", "linux-swap"}
+	fsTypeList := []string{"fat32", "fat16", "vfat", "ext2", "ext3", "ext4", "xfs", "linux-swap",
+		config.FsTypeSquashfs, config.FsTypeErofs}
 
 	// Partition info
 	partitionName := partitionInfo.Name
@@ -466,7 +467,10 @@ func diskPartitionCreate(
 		log.Errorf("Invalid start size %s for partition %d: %v", partitionInfo.Start, partitionNum, err)
 		return "", fmt.Errorf("invalid start size %s for partition %d: %w", partitionInfo.Start, partitionNum, err)
 	}
-	endSizeStr, err := VerifyFileSize(partitionInfo.End)
+	endSizeStr := "0"
+	if !partitionInfo.FillsRemaining() {
+		endSizeStr, err = VerifyFileSize(partitionInfo.End)
+	}
 	if err != nil {
 		log.Errorf("Invalid end size %s for partition %d: %v", partitionInfo.End, partitionNum, err)
 		return "", fmt.Errorf("invalid end size %s for partition %d: %w", partitionInfo.End, partitionNum, err)
@@ -485,7 +489,7 @@ func diskPartitionCreate(
 
 	startSector, _ := getSectorOffsetFromSize(diskName, startSizeStr)
 	var endSector uint64
-	if partitionInfo.End == "0" {
+	if partitionInfo.FillsRemaining() {
 		endSector = 0
 	} else {
 		endSector, _ = getSectorOffsetFromSize(diskName, endSizeStr)
@@ -678,6 +682,9 @@ func diskPartitionCreate(
 			log.Errorf("Failed to enable swap on partition %d: %v", partitionNum, err)
 			return "", fmt.Errorf("failed to enable swap on partition %d: %w", partitionNum, err)
 		}
+	} else if config.IsCompressedFsType(partitionInfo.FsType) {
+		// Built from the install root once the image is installed
+		log.Debugf("Leaving %s partition %d unformatted until the root filesystem is built", partitionInfo.FsType, partitionNum)
 	}
 
 	return diskPartDev, nil
@@ -793,9 +800,9 @@ func DiskPartitionsCreate(diskPath string, partitionsList []config.PartitionInfo
 				if i == maxPrimaryPartitionsNum-1 {
 					partitionType = "extended"
 					partitionNum = i + 1
-					logicalPartitionEnd := partitionInfo.End
-					extendedPartitionEnd := partitionsList[partitionCount-1].End
-					partitionInfo.End = extendedPartitionEnd
+					logicalPartitionEnd, logicalPartitionGrow := partitionInfo.End, partitionInfo.Grow
+					lastPartition := partitionsList[partitionCount-1]
+					partitionInfo.End, partitionInfo.Grow = lastPartition.End, lastPartition.Grow
 					_, err := diskPartitionCreate(diskPath, partitionNum, partitionInfo, partitionTableType, partitionType)
 					if err != nil {
 						for i := 1; i < partitionNum; i++ {
@@ -806,7 +813,7 @@ func DiskPartitionsCreate(diskPath string, partitionsList []config.PartitionInfo
 						}
 						return nil, fmt.Errorf("failed to create extended partition %d: %w", partitionNum, err)
 					}
-					partitionInfo.End = logicalPartitionEnd
+					partitionInfo.End, partitionInfo.Grow = logicalPartitionEnd, logicalPartitionGrow
 					partitionType = "logical"
 					partitionNum = i + 1
 				} else {
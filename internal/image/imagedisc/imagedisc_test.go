@@ -830,6 +830,32 @@ func TestDiskPartitionsCreate(t *testing.T) {
 			expectError:     false,
 			expectedDevices: 1,
 		},
+		{
+			name:     "gpt_grow_partition",
+			diskPath: "/dev/sda",
+			partitionsList: []config.PartitionInfo{
+				{
+					ID:     "root",
+					Name:   "root",
+					Start:  "1MiB",
+					Grow:   true,
+					FsType: "ext4",
+					Type:   "linux",
+				},
+			},
+			partitionTableType: "gpt",
+			mockCommands: []shell.MockCommand{
+				{Pattern: ".*fdisk.*sda.*", Output: "Disk /dev/sda: 1 GiB", Error: nil},
+				{Pattern: ".*label.*gpt.*sfdisk.*", Output: "", Error: nil},
+				{Pattern: ".*hw_sector_size", Output: "512", Error: nil},
+				{Pattern: ".*physical_block_size", Output: "4096", Error: nil},
+				{Pattern: `.*sgdisk -n 1:\d+:0 .*sda.*`, Output: "", Error: nil},
+				{Pattern: ".*partx.*sda.*", Output: "", Error: nil},
+				{Pattern: ".*mkfs.*ext4.*sda.*", Output: "", Error: nil},
+			},
+			expectError:     false,
+			expectedDevices: 1,
+		},
 		{
 			name:     "mbr_single_partition",
 			diskPath: "/dev/sda",
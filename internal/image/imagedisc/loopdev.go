@@ -14,6 +14,7 @@ import (
 type LoopDevInterface interface {
 	LoopSetupDelete(loopDevPath string) error
 	CreateRawImageLoopDev(filePath string, template *config.ImageTemplate) (string, map[string]string, error)
+	AttachRawImageLoopDev(filePath string, template *config.ImageTemplate, prevDiskPathIdMap map[string]string) (string, map[string]string, error)
 }
 
 type LoopDev struct{}
@@ -54,6 +55,7 @@ func loopSetupCreateEmptyRawDisk(filePath, fileSize string) (string, error) {
 }
 
 func (loopDev *LoopDev) LoopSetupDelete(loopDevPath string) error {
+	defer shell.BeginCleanup()()
 	cmd := fmt.Sprintf("losetup -d %s", loopDevPath)
 	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
 		log.Errorf("Failed to delete loop device %s: %v", loopDevPath, err)
@@ -138,7 +140,25 @@ func (loopDev *LoopDev) CreateRawImageLoopDev(filePath string, template *config.
 	var diskPathIdMap map[string]string
 	var loopDevPath string
 
+	if err := template.ValidateCompressedRootfs(); err != nil {
+		return loopDevPath, diskPathIdMap, fmt.Errorf("invalid disk configuration: %w", err)
+	}
+	if err := template.ValidateBootMode(); err != nil {
+		return loopDevPath, diskPathIdMap, fmt.Errorf("invalid disk configuration: %w", err)
+	}
+	if err := template.ValidateFilesystemCompat(); err != nil {
+		return loopDevPath, diskPathIdMap, fmt.Errorf("invalid disk configuration: %w", err)
+	}
+	if err := ApplyABLayout(&template.Disk); err != nil {
+		return loopDevPath, diskPathIdMap, fmt.Errorf("failed to apply A/B disk layout: %w", err)
+	}
 	diskInfo := template.GetDiskConfig()
+	if growIdx, growSize, err := GrowPartitionSize(diskInfo); err != nil {
+		return loopDevPath, diskPathIdMap, fmt.Errorf("invalid disk configuration: %w", err)
+	} else if growIdx != -1 {
+		log.Infof("Partition %s fills the remaining %s of the disk", diskInfo.Partitions[growIdx].ID,
+			TranslateBytesToSizeStr(growSize))
+	}
 	loopDevPath, err := loopSetupCreateEmptyRawDisk(filePath, diskInfo.Size)
 	if err != nil {
 		return loopDevPath, diskPathIdMap, fmt.Errorf("failed to create loop device: %w", err)
@@ -149,3 +169,38 @@ func (loopDev *LoopDev) CreateRawImageLoopDev(filePath string, template *config.
 	}
 	return loopDevPath, diskPathIdMap, nil
 }
+
+// AttachRawImageLoopDev attaches the partitioned raw image a previous build
+// left at filePath to a new loop device, so that a resumed build can carry on
+// installing into it. prevDiskPathIdMap maps the partition IDs to the
+// partition devices of the previous loop device, and the returned map to the
+// same partitions of the new one.
+func (loopDev *LoopDev) AttachRawImageLoopDev(filePath string, template *config.ImageTemplate,
+	prevDiskPathIdMap map[string]string) (string, map[string]string, error) {
+	if len(prevDiskPathIdMap) == 0 {
+		return "", nil, fmt.Errorf("no partitions recorded for raw image %s", filePath)
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		return "", nil, fmt.Errorf("raw image of the resumed build not found: %w", err)
+	}
+	if err := ApplyABLayout(&template.Disk); err != nil {
+		return "", nil, fmt.Errorf("failed to apply A/B disk layout: %w", err)
+	}
+
+	loopDevPath, err := loopSetupCreate(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to attach loop device: %w", err)
+	}
+	diskPathIdMap := make(map[string]string, len(prevDiskPathIdMap))
+	for partID, prevPartDev := range prevDiskPathIdMap {
+		prevLoopDevPath, err := GetLoopDevPathFromLoopDevPart(prevPartDev)
+		if err != nil {
+			if detachErr := loopDev.LoopSetupDelete(loopDevPath); detachErr != nil {
+				log.Errorf("Failed to detach loopback device %s: %v", loopDevPath, detachErr)
+			}
+			return "", nil, fmt.Errorf("partition %q: %w", partID, err)
+		}
+		diskPathIdMap[partID] = loopDevPath + strings.TrimPrefix(prevPartDev, prevLoopDevPath)
+	}
+	return loopDevPath, diskPathIdMap, nil
+}
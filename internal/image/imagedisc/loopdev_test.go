@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -266,6 +267,42 @@ func TestCreateRawImageLoopDev(t *testing.T) {
 	})
 }
 
+func TestAttachRawImageLoopDev(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "losetup --direct-io=on --show -f -P", Output: "/dev/loop12\n", Error: nil},
+	})
+
+	filePath := filepath.Join(t.TempDir(), "disk.raw")
+	if err := os.WriteFile(filePath, []byte("raw"), 0600); err != nil {
+		t.Fatalf("failed to create placeholder raw file: %v", err)
+	}
+	template := &config.ImageTemplate{}
+	ld := &LoopDev{}
+
+	loopPath, partMap, err := ld.AttachRawImageLoopDev(filePath, template,
+		map[string]string{"boot": "/dev/loop3p1", "rootfs": "/dev/loop3p2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loopPath != "/dev/loop12" {
+		t.Fatalf("expected /dev/loop12, got %q", loopPath)
+	}
+	want := map[string]string{"boot": "/dev/loop12p1", "rootfs": "/dev/loop12p2"}
+	if !reflect.DeepEqual(partMap, want) {
+		t.Fatalf("partition map = %#v, want %#v", partMap, want)
+	}
+
+	if _, _, err := ld.AttachRawImageLoopDev(filepath.Join(t.TempDir(), "missing.raw"), template,
+		map[string]string{"rootfs": "/dev/loop3p2"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing raw image error, got %v", err)
+	}
+	if _, _, err := ld.AttachRawImageLoopDev(filePath, template, nil); err == nil {
+		t.Fatal("expected an error without recorded partitions")
+	}
+}
+
 func TestDiskPartitionDelete(t *testing.T) {
 	originalExecutor := shell.Default
 	defer func() { shell.Default = originalExecutor }()
@@ -0,0 +1,80 @@
+package imageinspect
+
+import (
+	"io"
+	"path"
+	"strings"
+)
+
+// BootMode is the firmware boot path an image supports.
+type BootMode string
+
+// Possible BootMode values
+const (
+	BootModeUEFI    BootMode = "uefi"
+	BootModeBIOS    BootMode = "bios"
+	BootModeHybrid  BootMode = "hybrid"  // both UEFI and BIOS
+	BootModeUnknown BootMode = "unknown" // neither boot path found
+)
+
+// biosBootPartitionType is the GPT type of the partition grub embeds its
+// BIOS core image in.
+const biosBootPartitionType = "21686148-6449-6E6F-744E-656564454649"
+
+// mbrBootCodeSize is the size of the boot code area at the start of the MBR,
+// before the disk signature and the partition entries.
+const mbrBootCodeSize = 440
+
+// hasMBRBootCode reports whether the boot code area of the MBR of img holds
+// any code. The area is left zeroed on images that don't boot with BIOS.
+func hasMBRBootCode(img io.ReaderAt) bool {
+	buf := make([]byte, mbrBootCodeSize)
+	if _, err := img.ReadAt(buf, 0); err != nil {
+		return false
+	}
+	for _, b := range buf {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isFallbackBootLoader reports whether efiPath is a removable media boot
+// loader, EFI/BOOT/BOOT<arch>.EFI, which the firmware starts when it has no
+// boot entry for the disk.
+func isFallbackBootLoader(efiPath string) bool {
+	p := strings.ToLower(strings.TrimPrefix(efiPath, "/"))
+	return path.Dir(p) == efiFallbackDir && strings.HasPrefix(path.Base(p), "boot")
+}
+
+// detectBootMode determines the boot mode of an image from its partition
+// table: it boots with UEFI if an ESP holds a fallback boot loader, and with
+// BIOS if it has a BIOS boot partition or MBR boot code.
+func detectBootMode(pt PartitionTableSummary) BootMode {
+	uefi, bios := false, pt.MBRBootCode
+	for _, p := range pt.Partitions {
+		if strings.EqualFold(p.Type, biosBootPartitionType) {
+			bios = true
+		}
+		if p.Filesystem == nil || !isESPPartition(p) {
+			continue
+		}
+		for _, b := range p.Filesystem.EFIBinaries {
+			if isFallbackBootLoader(b.Path) {
+				uefi = true
+			}
+		}
+	}
+
+	switch {
+	case uefi && bios:
+		return BootModeHybrid
+	case uefi:
+		return BootModeUEFI
+	case bios:
+		return BootModeBIOS
+	default:
+		return BootModeUnknown
+	}
+}
@@ -0,0 +1,103 @@
+package imageinspect
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func bootModeTestTable(espLoader string, biosBootPartition, mbrBootCode bool) PartitionTableSummary {
+	pt := PartitionTableSummary{Type: "gpt", ProtectiveMBR: true, MBRBootCode: mbrBootCode}
+	if biosBootPartition {
+		pt.Partitions = append(pt.Partitions, PartitionSummary{Name: "bios_grub", Type: biosBootPartitionType})
+	}
+	esp := PartitionSummary{
+		Name:       "esp",
+		Type:       "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+		Filesystem: &FilesystemSummary{Type: "vfat"},
+	}
+	if espLoader != "" {
+		esp.Filesystem.EFIBinaries = []EFIBinaryEvidence{{Path: espLoader, Kind: BootloaderShim}}
+	}
+	pt.Partitions = append(pt.Partitions, esp,
+		PartitionSummary{Name: "rootfs", Type: "0FC63DAF-8483-4772-8E79-3D69D8477DE4", Filesystem: &FilesystemSummary{Type: "ext4"}})
+	for i := range pt.Partitions {
+		pt.Partitions[i].Index = i + 1
+	}
+	return pt
+}
+
+func TestDetectBootMode(t *testing.T) {
+	tests := []struct {
+		name string
+		pt   PartitionTableSummary
+		want BootMode
+	}{
+		{name: "UEFI only", pt: bootModeTestTable("/EFI/BOOT/BOOTX64.EFI", false, false), want: BootModeUEFI},
+		{name: "BIOS boot partition", pt: bootModeTestTable("", true, false), want: BootModeBIOS},
+		{
+			name: "MBR boot code",
+			pt: PartitionTableSummary{Type: "mbr", MBRBootCode: true, Partitions: []PartitionSummary{
+				{Index: 1, Type: "0x83", Filesystem: &FilesystemSummary{Type: "ext4"}},
+			}},
+			want: BootModeBIOS,
+		},
+		{name: "hybrid", pt: bootModeTestTable("EFI/BOOT/BOOTX64.EFI", true, true), want: BootModeHybrid},
+		{name: "ESP without fallback boot loader", pt: bootModeTestTable("EFI/ubuntu/grubx64.efi", false, false), want: BootModeUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectBootMode(tt.pt); got != tt.want {
+				t.Errorf("detectBootMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasMBRBootCode(t *testing.T) {
+	img := make([]byte, 1024)
+	if hasMBRBootCode(bytes.NewReader(img)) {
+		t.Error("expected a zeroed MBR to have no boot code")
+	}
+	img[0] = 0xeb
+	if !hasMBRBootCode(bytes.NewReader(img)) {
+		t.Error("expected boot code to be found")
+	}
+	if hasMBRBootCode(bytes.NewReader(img[:100])) {
+		t.Error("expected an image shorter than the MBR to have no boot code")
+	}
+}
+
+func TestCompareImagesBootModeChange(t *testing.T) {
+	uefi := &ImageSummary{PartitionTable: bootModeTestTable("EFI/BOOT/BOOTX64.EFI", false, false)}
+	uefi.BootMode = detectBootMode(uefi.PartitionTable)
+	hybrid := &ImageSummary{PartitionTable: bootModeTestTable("EFI/BOOT/BOOTX64.EFI", false, true)}
+	hybrid.BootMode = detectBootMode(hybrid.PartitionTable)
+
+	res := CompareImages(uefi, hybrid)
+	if !res.Summary.BootModeChanged || !res.Summary.Changed {
+		t.Fatalf("expected the boot mode change to be flagged, got summary %+v", res.Summary)
+	}
+	if bm := res.Diff.Image.BootMode; bm == nil || bm.From != BootModeUEFI || bm.To != BootModeHybrid {
+		t.Fatalf("expected boot mode uefi -> hybrid, got %+v", bm)
+	}
+	if res.Equality.Class != EqualityDifferent {
+		t.Errorf("expected the images to be different, got %s", res.Equality.Class)
+	}
+	if !strings.Contains(strings.Join(res.Equality.MeaningfulReasons, "\n"), "boot mode changed") {
+		t.Errorf("expected a boot mode meaningful reason, got %v", res.Equality.MeaningfulReasons)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderCompareText(&buf, &res, CompareTextOptions{Mode: "diff"}); err != nil {
+		t.Fatalf("RenderCompareText failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Boot mode: uefi -> hybrid") {
+		t.Errorf("expected the boot mode change in the text output, got:\n%s", buf.String())
+	}
+
+	if res := CompareImages(uefi, uefi); res.Summary.BootModeChanged || res.Diff.Image.BootMode != nil {
+		t.Errorf("expected no boot mode change for the same image, got %+v", res.Diff.Image)
+	}
+}
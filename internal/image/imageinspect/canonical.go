@@ -0,0 +1,113 @@
+package imageinspect
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Canonicalize puts s into a canonical form so that inspections of
+// byte-identical images marshal to byte-identical JSON and YAML: every slice
+// is sorted, OSReleaseSorted is rebuilt from OSRelease, and empty slices and
+// maps are replaced with nil. Map keys are already sorted by the encoders.
+func (s *ImageSummary) Canonicalize() {
+	if s.Verity != nil {
+		s.Verity.Notes = canonicalStrings(s.Verity.Notes)
+	}
+	s.SBOM.Notes = canonicalStrings(s.SBOM.Notes)
+
+	pt := &s.PartitionTable
+	slices.Sort(pt.MisalignedPartitions)
+	if len(pt.MisalignedPartitions) == 0 {
+		pt.MisalignedPartitions = nil
+	}
+	if len(pt.Partitions) == 0 {
+		pt.Partitions = nil
+	}
+	slices.SortStableFunc(pt.Partitions, func(a, b PartitionSummary) int {
+		return cmp.Or(cmp.Compare(a.Index, b.Index), cmp.Compare(a.StartLBA, b.StartLBA))
+	})
+	for i := range pt.Partitions {
+		if fs := pt.Partitions[i].Filesystem; fs != nil {
+			fs.canonicalize()
+		}
+	}
+}
+
+func (fs *FilesystemSummary) canonicalize() {
+	fs.Features = canonicalStrings(fs.Features)
+	fs.Notes = canonicalStrings(fs.Notes)
+	fs.FsFlags = canonicalStrings(fs.FsFlags)
+
+	for i := range fs.EFIBinaries {
+		fs.EFIBinaries[i].canonicalize()
+	}
+	if len(fs.EFIBinaries) == 0 {
+		fs.EFIBinaries = nil
+	}
+	slices.SortStableFunc(fs.EFIBinaries, func(a, b EFIBinaryEvidence) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.SHA256, b.SHA256))
+	})
+}
+
+func (efi *EFIBinaryEvidence) canonicalize() {
+	efi.Sections = canonicalStrings(efi.Sections)
+	efi.Notes = canonicalStrings(efi.Notes)
+	efi.OSRelease = canonicalMap(efi.OSRelease)
+	efi.SectionSHA256 = canonicalMap(efi.SectionSHA256)
+
+	efi.OSReleaseSorted = nil
+	for key, value := range efi.OSRelease {
+		efi.OSReleaseSorted = append(efi.OSReleaseSorted, KeyValue{Key: key, Value: value})
+	}
+	slices.SortFunc(efi.OSReleaseSorted, func(a, b KeyValue) int {
+		return cmp.Compare(a.Key, b.Key)
+	})
+
+	if efi.BootConfig != nil {
+		efi.BootConfig.canonicalize()
+	}
+}
+
+func (bc *BootloaderConfig) canonicalize() {
+	bc.ConfigFiles = canonicalMap(bc.ConfigFiles)
+	bc.ConfigRaw = canonicalMap(bc.ConfigRaw)
+	bc.Notes = canonicalStrings(bc.Notes)
+
+	if len(bc.KernelReferences) == 0 {
+		bc.KernelReferences = nil
+	}
+	slices.SortStableFunc(bc.KernelReferences, func(a, b KernelReference) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.BootEntry, b.BootEntry),
+			cmp.Compare(a.PartitionUUID, b.PartitionUUID), cmp.Compare(a.RootUUID, b.RootUUID))
+	})
+	if len(bc.BootEntries) == 0 {
+		bc.BootEntries = nil
+	}
+	slices.SortStableFunc(bc.BootEntries, func(a, b BootEntry) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Kernel, b.Kernel),
+			cmp.Compare(a.Initrd, b.Initrd), cmp.Compare(a.Cmdline, b.Cmdline), cmp.Compare(a.UKIPath, b.UKIPath))
+	})
+	if len(bc.UUIDReferences) == 0 {
+		bc.UUIDReferences = nil
+	}
+	slices.SortStableFunc(bc.UUIDReferences, func(a, b UUIDReference) int {
+		return cmp.Or(cmp.Compare(a.UUID, b.UUID), cmp.Compare(a.Context, b.Context))
+	})
+}
+
+// canonicalStrings returns s sorted, or nil if it is empty.
+func canonicalStrings(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	slices.Sort(s)
+	return s
+}
+
+// canonicalMap returns m, or nil if it is empty.
+func canonicalMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,129 @@
+package imageinspect
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// syntheticSummary returns the summary of an image with an ESP and a root
+// partition, with every slice in reverse order when reversed is set, as
+// another inspection of the same image may return it.
+func syntheticSummary(reversed bool) *ImageSummary {
+	order := func(s []string) []string {
+		s = slices.Clone(s)
+		if reversed {
+			slices.Reverse(s)
+		}
+		return s
+	}
+
+	shim := EFIBinaryEvidence{
+		Path:     "EFI/BOOT/BOOTX64.EFI",
+		SHA256:   "aa",
+		Kind:     BootloaderShim,
+		Sections: order([]string{".text", ".data", ".sbat"}),
+	}
+	uki := EFIBinaryEvidence{
+		Path:          "EFI/Linux/linux.efi",
+		SHA256:        "bb",
+		Kind:          BootloaderUKI,
+		IsUKI:         true,
+		Sections:      order([]string{".linux", ".initrd", ".cmdline", ".osrel"}),
+		OSRelease:     map[string]string{"ID": "ubuntu", "VERSION_ID": "24.04"},
+		SectionSHA256: map[string]string{".linux": "cc", ".initrd": "dd"},
+		BootConfig: &BootloaderConfig{
+			ConfigFiles: map[string]string{},
+			BootEntries: []BootEntry{{Name: "Ubuntu"}, {Name: "Ubuntu (recovery)"}},
+			UUIDReferences: []UUIDReference{
+				{UUID: "1111", Context: "root_device"},
+				{UUID: "2222", Context: "kernel_cmdline"},
+			},
+			Notes: order([]string{"first note", "second note"}),
+		},
+	}
+	efiBinaries := []EFIBinaryEvidence{shim, uki}
+	if reversed {
+		slices.Reverse(efiBinaries)
+		slices.Reverse(uki.BootConfig.BootEntries)
+		slices.Reverse(uki.BootConfig.UUIDReferences)
+		uki.OSReleaseSorted = []KeyValue{{Key: "VERSION_ID", Value: "24.04"}, {Key: "ID", Value: "ubuntu"}}
+	}
+
+	partitions := []PartitionSummary{
+		{
+			Index: 1, Name: "esp", StartLBA: 2048,
+			Filesystem: &FilesystemSummary{
+				Type:        "vfat",
+				Features:    order([]string{"fat32", "lfn"}),
+				EFIBinaries: efiBinaries,
+			},
+		},
+		{
+			Index: 2, Name: "rootfs", StartLBA: 1050624,
+			Filesystem: &FilesystemSummary{
+				Type:     "ext4",
+				Features: order([]string{"has_journal", "extent", "64bit"}),
+				Notes:    []string{},
+			},
+		},
+	}
+	misaligned := []int{1, 2}
+	if reversed {
+		slices.Reverse(partitions)
+		slices.Reverse(misaligned)
+	}
+
+	return &ImageSummary{
+		File:      "image.raw",
+		SizeBytes: 4 << 30,
+		PartitionTable: PartitionTableSummary{
+			Type:                 "gpt",
+			Partitions:           partitions,
+			MisalignedPartitions: misaligned,
+		},
+		Verity: &VeritySummary{Notes: order([]string{"no hash partition", "no roothash"})},
+		SBOM:   SBOMSummary{Notes: []string{}},
+	}
+}
+
+func TestImageSummaryCanonicalize(t *testing.T) {
+	canonicalJSON := func(s *ImageSummary) string {
+		t.Helper()
+		s.Canonicalize()
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			t.Fatalf("marshal json: %v", err)
+		}
+		return string(b)
+	}
+
+	first := canonicalJSON(syntheticSummary(false))
+	second := canonicalJSON(syntheticSummary(true))
+	if first != second {
+		t.Fatalf("expected identical canonical JSON\nfirst:\n%s\nsecond:\n%s", first, second)
+	}
+
+	s := syntheticSummary(true)
+	s.Canonicalize()
+	if got := s.PartitionTable.Partitions[0].Name; got != "esp" {
+		t.Errorf("expected partitions sorted by index, got %q first", got)
+	}
+	esp := s.PartitionTable.Partitions[0].Filesystem
+	if got := esp.EFIBinaries[0].Path; got != "EFI/BOOT/BOOTX64.EFI" {
+		t.Errorf("expected EFI binaries sorted by path, got %q first", got)
+	}
+	uki := esp.EFIBinaries[1]
+	if want := []string{".cmdline", ".initrd", ".linux", ".osrel"}; !slices.Equal(uki.Sections, want) {
+		t.Errorf("sections = %v, want %v", uki.Sections, want)
+	}
+	if want := []KeyValue{{Key: "ID", Value: "ubuntu"}, {Key: "VERSION_ID", Value: "24.04"}}; !slices.Equal(uki.OSReleaseSorted, want) {
+		t.Errorf("osReleaseSorted = %v, want %v", uki.OSReleaseSorted, want)
+	}
+	if uki.BootConfig.ConfigFiles != nil {
+		t.Errorf("expected the empty config file map to be dropped, got %v", uki.BootConfig.ConfigFiles)
+	}
+	if root := s.PartitionTable.Partitions[1].Filesystem; root.Notes != nil {
+		t.Errorf("expected the empty notes to be dropped, got %v", root.Notes)
+	}
+}
@@ -28,6 +28,7 @@ type CompareSummary struct {
 	FilesystemsChanged    bool `json:"filesystemsChanged,omitempty"`
 	EFIBinariesChanged    bool `json:"efiBinariesChanged,omitempty"`
 	SBOMChanged           bool `json:"sbomChanged,omitempty"`
+	BootModeChanged       bool `json:"bootModeChanged,omitempty"`
 
 	AddedCount    int `json:"addedCount,omitempty"`
 	RemovedCount  int `json:"removedCount,omitempty"`
@@ -60,7 +61,8 @@ type SBOMDiff struct {
 
 // MetaDiff represents differences in image-level metadata.
 type MetaDiff struct {
-	SizeBytes *ValueDiff[int64] `json:"sizeBytes,omitempty"`
+	SizeBytes *ValueDiff[int64]    `json:"sizeBytes,omitempty"`
+	BootMode  *ValueDiff[BootMode] `json:"bootMode,omitempty"`
 }
 
 // VerityDiff represents differences in dm-verity configuration.
@@ -266,8 +268,39 @@ type UUIDRefChange struct {
 	MismatchTo   bool   `json:"mismatchTo,omitempty" yaml:"mismatchTo,omitempty"`
 }
 
+// Partition key modes control how partitions are matched between images.
+const (
+	// PartitionKeyTypeName matches partitions by partition table type
+	// (GPT type GUID / MBR type) and name.
+	PartitionKeyTypeName = "type-name"
+	// PartitionKeyFSUUID matches partitions by filesystem UUID when one is
+	// available, falling back to type and name otherwise. A renamed
+	// partition that keeps its filesystem is then reported as modified
+	// instead of as an added/removed pair.
+	PartitionKeyFSUUID = "fs-uuid"
+)
+
+// CompareOptions tunes how two images are compared.
+type CompareOptions struct {
+	PartitionKey string // "type-name" (default) | "fs-uuid"
+
+	// Ignore lists field paths, such as "filesystem.uuid" or
+	// "partition.guid", that are expected to change between builds. Changes
+	// to them are left out of the diff, the summary counts and the equality
+	// class. See IgnorableFields for the accepted paths. Ignoring
+	// "filesystem.uuid" makes the fs-uuid partition key fall back to type
+	// and name, as the filesystem UUIDs no longer identify partitions.
+	Ignore []string
+}
+
 // CompareImages compares two ImageSummary objects and returns a structured diff.
 func CompareImages(from, to *ImageSummary) ImageCompareResult {
+	return CompareImagesWithOptions(from, to, CompareOptions{})
+}
+
+// CompareImagesWithOptions compares two ImageSummary objects using opts and
+// returns a structured diff.
+func CompareImagesWithOptions(from, to *ImageSummary, opts CompareOptions) ImageCompareResult {
 	if from == nil || to == nil {
 		return ImageCompareResult{
 			SchemaVersion: "1",
@@ -281,12 +314,21 @@ func CompareImages(from, to *ImageSummary) ImageCompareResult {
 		To:            *to,
 	}
 
+	// The result reports the images as inspected, the diff is computed
+	// without the ignored fields
+	from, to = maskIgnoredFields(from, opts.Ignore), maskIgnoredFields(to, opts.Ignore)
+
 	// --- image meta ---
 	res.Diff.Image = compareMeta(*from, *to)
 	if res.Diff.Image.SizeBytes != nil {
 		res.Summary.ModifiedCount++
 		res.Summary.Changed = true
 	}
+	if res.Diff.Image.BootMode != nil {
+		res.Summary.BootModeChanged = true
+		res.Summary.ModifiedCount++
+		res.Summary.Changed = true
+	}
 
 	// --- partition table ---
 	res.Diff.PartitionTable = comparePartitionTable(from.PartitionTable, to.PartitionTable)
@@ -296,7 +338,7 @@ func CompareImages(from, to *ImageSummary) ImageCompareResult {
 	}
 
 	// --- partitions ---
-	res.Diff.Partitions = comparePartitions(from.PartitionTable, to.PartitionTable)
+	res.Diff.Partitions = comparePartitionsByKey(from.PartitionTable, to.PartitionTable, opts.PartitionKey)
 	if len(res.Diff.Partitions.Added) > 0 || len(res.Diff.Partitions.Removed) > 0 || len(res.Diff.Partitions.Modified) > 0 {
 		res.Summary.PartitionsChanged = true
 		res.Summary.Changed = true
@@ -372,6 +414,9 @@ func compareMeta(from, to ImageSummary) MetaDiff {
 	if from.SizeBytes != to.SizeBytes {
 		out.SizeBytes = &ValueDiff[int64]{From: from.SizeBytes, To: to.SizeBytes}
 	}
+	if from.BootMode != to.BootMode {
+		out.BootMode = &ValueDiff[BootMode]{From: from.BootMode, To: to.BootMode}
+	}
 	return out
 }
 
@@ -515,8 +560,14 @@ func comparePartitionTable(from, to PartitionTableSummary) PartitionTableDiff {
 
 // comparePartitions compares two PartitionTableSummary objects and returns a PartitionDiff.
 func comparePartitions(fromPT, toPT PartitionTableSummary) PartitionDiff {
-	fromParts := indexPartitions(fromPT)
-	toParts := indexPartitions(toPT)
+	return comparePartitionsByKey(fromPT, toPT, PartitionKeyTypeName)
+}
+
+// comparePartitionsByKey compares two PartitionTableSummary objects, matching
+// partitions according to keyMode, and returns a PartitionDiff.
+func comparePartitionsByKey(fromPT, toPT PartitionTableSummary, keyMode string) PartitionDiff {
+	fromParts := indexPartitionsByKey(fromPT, keyMode)
+	toParts := indexPartitionsByKey(toPT, keyMode)
 
 	out := PartitionDiff{}
 
@@ -579,11 +630,14 @@ func comparePartitions(fromPT, toPT PartitionTableSummary) PartitionDiff {
 	return out
 }
 
-func indexPartitions(pt PartitionTableSummary) map[string]PartitionSummary {
+func indexPartitionsByKey(pt PartitionTableSummary, keyMode string) map[string]PartitionSummary {
 	out := make(map[string]PartitionSummary, len(pt.Partitions))
 
 	for _, p := range pt.Partitions {
 		key := partitionKey(pt.Type, p)
+		if keyMode == PartitionKeyFSUUID {
+			key = partitionFSUUIDKey(pt.Type, p)
+		}
 
 		// Ensure uniqueness even if names collide (rare but possible)
 		if _, exists := out[key]; exists {
@@ -635,6 +689,18 @@ func partitionKey(ptType string, p PartitionSummary) string {
 	}
 }
 
+// partitionFSUUIDKey keys a partition by its filesystem UUID, which survives
+// renames and type changes. Partitions without a filesystem UUID fall back
+// to partitionKey.
+func partitionFSUUIDKey(ptType string, p PartitionSummary) string {
+	if p.Filesystem != nil {
+		if uuid := strings.ToLower(strings.TrimSpace(p.Filesystem.UUID)); uuid != "" {
+			return "fsuuid:" + uuid
+		}
+	}
+	return partitionKey(ptType, p)
+}
+
 // partitionsEqual checks if two PartitionSummary objects are equal.
 func partitionsEqual(a, b PartitionSummary) bool {
 
@@ -647,6 +713,9 @@ func partitionsEqual(a, b PartitionSummary) bool {
 		a.SizeBytes != b.SizeBytes ||
 		a.Flags != b.Flags ||
 		a.AttrRaw != b.AttrRaw ||
+		a.AttrRequired != b.AttrRequired ||
+		a.AttrLegacyBIOSBootable != b.AttrLegacyBIOSBootable ||
+		a.AttrReadOnly != b.AttrReadOnly ||
 		a.LogicalSectorSize != b.LogicalSectorSize {
 		return false
 	}
@@ -844,6 +913,16 @@ func appendPartitionFieldChanges(dst []FieldChange, a, b PartitionSummary) []Fie
 	if a.AttrRaw != b.AttrRaw {
 		add("attrRaw", a.AttrRaw, b.AttrRaw)
 	}
+	// The decoded attribute bits tell which attribute changed
+	if a.AttrRequired != b.AttrRequired {
+		add("attrRequired", a.AttrRequired, b.AttrRequired)
+	}
+	if a.AttrLegacyBIOSBootable != b.AttrLegacyBIOSBootable {
+		add("attrLegacyBiosBootable", a.AttrLegacyBIOSBootable, b.AttrLegacyBIOSBootable)
+	}
+	if a.AttrReadOnly != b.AttrReadOnly {
+		add("attrReadOnly", a.AttrReadOnly, b.AttrReadOnly)
+	}
 	if a.LogicalSectorSize != b.LogicalSectorSize {
 		add("logicalSectorSize", a.LogicalSectorSize, b.LogicalSectorSize)
 	}
@@ -903,6 +982,9 @@ func tallyDiffs(d ImageDiff) diffTally {
 	if d.Image.SizeBytes != nil {
 		t.addMeaningful(1, "image size changed")
 	}
+	if d.Image.BootMode != nil {
+		t.addMeaningful(1, "boot mode changed")
+	}
 
 	if d.PartitionTable.DiskGUID != nil {
 		t.addVolatile(1, "PT DiskGUID")
@@ -0,0 +1,120 @@
+package imageinspect
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ignorableFields maps the field paths CompareOptions.Ignore accepts to the
+// function clearing that field in an image summary. Paths use the JSON field
+// names of the compare output, prefixed with the object they belong to.
+var ignorableFields = map[string]func(*ImageSummary){
+	"image.sizeBytes": func(s *ImageSummary) { s.SizeBytes = 0 },
+
+	"partitionTable.diskGuid":             func(s *ImageSummary) { s.PartitionTable.DiskGUID = "" },
+	"partitionTable.largestFreeSpan":      func(s *ImageSummary) { s.PartitionTable.LargestFreeSpan = nil },
+	"partitionTable.misalignedPartitions": func(s *ImageSummary) { s.PartitionTable.MisalignedPartitions = nil },
+
+	"partition.guid":    eachPartition(func(p *PartitionSummary) { p.GUID = "" }),
+	"partition.name":    eachPartition(func(p *PartitionSummary) { p.Name = "" }),
+	"partition.flags":   eachPartition(func(p *PartitionSummary) { p.Flags = "" }),
+	"partition.attrRaw": eachPartition(clearPartitionAttributes),
+
+	"filesystem.uuid":  eachFilesystem(func(fs *FilesystemSummary) { fs.UUID = "" }),
+	"filesystem.label": eachFilesystem(func(fs *FilesystemSummary) { fs.Label = "" }),
+
+	"efi.sha256": eachEFIBinary(func(e *EFIBinaryEvidence) { e.SHA256 = "" }),
+	"efi.size":   eachEFIBinary(func(e *EFIBinaryEvidence) { e.Size = 0 }),
+	"efi.signed": eachEFIBinary(func(e *EFIBinaryEvidence) { e.Signed, e.SignatureSize = false, 0 }),
+
+	"sbom.fileName":  func(s *ImageSummary) { s.SBOM.FileName = "" },
+	"sbom.sizeBytes": func(s *ImageSummary) { s.SBOM.SizeBytes = 0 },
+	// The raw and canonical hashes both track the SBOM content
+	"sbom.sha256": func(s *ImageSummary) { s.SBOM.SHA256, s.SBOM.CanonicalSHA256 = "", "" },
+}
+
+// IgnorableFields returns the field paths CompareOptions.Ignore accepts, sorted.
+func IgnorableFields() []string {
+	fields := make([]string, 0, len(ignorableFields))
+	for field := range ignorableFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ValidateIgnoreFields returns an error naming the first entry of fields that
+// is not an ignorable field path.
+func ValidateIgnoreFields(fields []string) error {
+	for _, field := range fields {
+		if _, ok := ignorableFields[strings.TrimSpace(field)]; !ok {
+			return fmt.Errorf("unknown compare field %q (expected one of %s)", field, strings.Join(IgnorableFields(), ", "))
+		}
+	}
+	return nil
+}
+
+// maskIgnoredFields returns a copy of s with the fields in ignore cleared, so
+// that they never differ between the two compared images. Unknown fields are
+// skipped. s itself is left untouched.
+func maskIgnoredFields(s *ImageSummary, ignore []string) *ImageSummary {
+	if len(ignore) == 0 {
+		return s
+	}
+	masked := cloneSummaryForMasking(*s)
+	for _, field := range ignore {
+		if reset, ok := ignorableFields[strings.TrimSpace(field)]; ok {
+			reset(&masked)
+		}
+	}
+	return &masked
+}
+
+// cloneSummaryForMasking copies s deep enough for the ignorableFields
+// functions to modify the copy: partitions, their filesystems and the EFI
+// binaries on them.
+func cloneSummaryForMasking(s ImageSummary) ImageSummary {
+	s.PartitionTable.Partitions = append([]PartitionSummary(nil), s.PartitionTable.Partitions...)
+	for i := range s.PartitionTable.Partitions {
+		p := &s.PartitionTable.Partitions[i]
+		if p.Filesystem == nil {
+			continue
+		}
+		fs := *p.Filesystem
+		fs.EFIBinaries = append([]EFIBinaryEvidence(nil), fs.EFIBinaries...)
+		p.Filesystem = &fs
+	}
+	return s
+}
+
+func eachPartition(reset func(*PartitionSummary)) func(*ImageSummary) {
+	return func(s *ImageSummary) {
+		for i := range s.PartitionTable.Partitions {
+			reset(&s.PartitionTable.Partitions[i])
+		}
+	}
+}
+
+// clearPartitionAttributes clears the GPT attributes of p, the raw value
+// along with the bits decoded from it.
+func clearPartitionAttributes(p *PartitionSummary) {
+	p.AttrRaw = 0
+	p.AttrRequired, p.AttrLegacyBIOSBootable, p.AttrReadOnly = false, false, false
+}
+
+func eachFilesystem(reset func(*FilesystemSummary)) func(*ImageSummary) {
+	return eachPartition(func(p *PartitionSummary) {
+		if p.Filesystem != nil {
+			reset(p.Filesystem)
+		}
+	})
+}
+
+func eachEFIBinary(reset func(*EFIBinaryEvidence)) func(*ImageSummary) {
+	return eachFilesystem(func(fs *FilesystemSummary) {
+		for i := range fs.EFIBinaries {
+			reset(&fs.EFIBinaries[i])
+		}
+	})
+}
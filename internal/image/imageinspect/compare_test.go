@@ -1,6 +1,7 @@
 package imageinspect
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -241,6 +242,81 @@ func TestCompareImages_PartitionsAddedRemovedModified_ByFSUUIDKey(t *testing.T)
 	}
 }
 
+func TestCompareImagesWithOptions_RenamedPartitionByFSUUIDKey(t *testing.T) {
+	mk := func(file, name string) *ImageSummary {
+		return &ImageSummary{
+			File:      file,
+			SizeBytes: 100,
+			PartitionTable: PartitionTableSummary{
+				Type:              "gpt",
+				LogicalSectorSize: 512,
+				Partitions: []PartitionSummary{
+					{
+						Index:     2,
+						Name:      name,
+						Type:      "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+						StartLBA:  4096,
+						EndLBA:    8191,
+						SizeBytes: 2048,
+						Filesystem: &FilesystemSummary{
+							Type:  "ext4",
+							UUID:  "UUID-ROOT",
+							Label: "rootfs",
+						},
+					},
+				},
+			},
+		}
+	}
+	a := mk("a.raw", "root")
+	b := mk("b.raw", "rootfs")
+
+	// Default keying treats the rename as a removed + added pair.
+	res := CompareImages(a, b)
+	if len(res.Diff.Partitions.Added) != 1 || len(res.Diff.Partitions.Removed) != 1 || len(res.Diff.Partitions.Modified) != 0 {
+		t.Fatalf("expected added+removed with default key, got %+v", res.Diff.Partitions)
+	}
+
+	res = CompareImagesWithOptions(a, b, CompareOptions{PartitionKey: PartitionKeyFSUUID})
+	if len(res.Diff.Partitions.Added) != 0 || len(res.Diff.Partitions.Removed) != 0 {
+		t.Fatalf("expected no added/removed partitions with fs-uuid key, got %+v", res.Diff.Partitions)
+	}
+	if len(res.Diff.Partitions.Modified) != 1 {
+		t.Fatalf("expected 1 modified partition, got %d", len(res.Diff.Partitions.Modified))
+	}
+	mod := res.Diff.Partitions.Modified[0]
+	if mod.Key != "fsuuid:uuid-root" {
+		t.Fatalf("expected fsuuid key, got %q", mod.Key)
+	}
+	if mod.From.Name != "root" || mod.To.Name != "rootfs" {
+		t.Fatalf("expected name change root->rootfs, got %q->%q", mod.From.Name, mod.To.Name)
+	}
+	if res.Summary.ModifiedCount != 1 || res.Summary.AddedCount != 0 || res.Summary.RemovedCount != 0 {
+		t.Fatalf("unexpected summary counts: %+v", res.Summary)
+	}
+}
+
+func TestCompareImagesWithOptions_FSUUIDKeyFallsBackWithoutFilesystem(t *testing.T) {
+	pt := PartitionTableSummary{
+		Type: "gpt",
+		Partitions: []PartitionSummary{
+			{Index: 1, Name: "bios", Type: "21686148-6449-6E6F-744E-656564454649", StartLBA: 34, EndLBA: 2047},
+		},
+	}
+	to := pt
+	to.Partitions = []PartitionSummary{
+		{Index: 1, Name: "bios", Type: "21686148-6449-6E6F-744E-656564454649", StartLBA: 34, EndLBA: 4095},
+	}
+
+	diff := comparePartitionsByKey(pt, to, PartitionKeyFSUUID)
+	if len(diff.Modified) != 1 || len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Fatalf("expected 1 modified partition, got %+v", diff)
+	}
+	if !strings.HasPrefix(diff.Modified[0].Key, "gpt:") {
+		t.Fatalf("expected type/name fallback key, got %q", diff.Modified[0].Key)
+	}
+}
+
 func TestCompareImages_EFIBinaries_ModifiedAndUKIDiff(t *testing.T) {
 	a := &ImageSummary{
 		File:      "a.raw",
@@ -1178,3 +1254,169 @@ func TestTallyBootloaderConfigDiff_ClassificationCoverage(t *testing.T) {
 		t.Fatalf("expected metadata-only boot entry change to be classified volatile, reasons=%v", tally.vReasons)
 	}
 }
+
+func TestCompareImagesWithOptions_IgnoreFields(t *testing.T) {
+	mk := func(file, diskGUID, rootUUID, partGUID string, rootEnd uint64) *ImageSummary {
+		return &ImageSummary{
+			File:      file,
+			SizeBytes: 100,
+			PartitionTable: PartitionTableSummary{
+				Type:              "gpt",
+				DiskGUID:          diskGUID,
+				LogicalSectorSize: 512,
+				Partitions: []PartitionSummary{
+					{
+						Index:     1,
+						Name:      "esp",
+						Type:      "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+						StartLBA:  2048,
+						EndLBA:    4095,
+						SizeBytes: 1024,
+						Filesystem: &FilesystemSummary{
+							Type: "vfat",
+							UUID: "ESP-" + rootUUID,
+						},
+					},
+					{
+						Index:     2,
+						Name:      "rootfs",
+						Type:      "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+						GUID:      partGUID,
+						StartLBA:  4096,
+						EndLBA:    rootEnd,
+						SizeBytes: (rootEnd - 4096 + 1) * 512,
+						Filesystem: &FilesystemSummary{
+							Type:  "ext4",
+							UUID:  rootUUID,
+							Label: "rootfs",
+						},
+					},
+				},
+			},
+		}
+	}
+	a := mk("a.raw", "DISK-A", "UUID-A", "PART-A", 8191)
+	b := mk("b.raw", "DISK-B", "UUID-B", "PART-B", 8191)
+	ignore := []string{"partitionTable.diskGuid", "partition.guid", "filesystem.uuid"}
+
+	// Without the ignore-list the regenerated UUIDs are reported as changes.
+	res := CompareImages(a, b)
+	if !res.Summary.Changed || res.Equality.VolatileDiffs == 0 {
+		t.Fatalf("expected volatile UUID changes without ignore-list, got %+v", res.Equality)
+	}
+
+	for _, key := range []string{PartitionKeyTypeName, PartitionKeyFSUUID} {
+		t.Run(key, func(t *testing.T) {
+			res := CompareImagesWithOptions(a, b, CompareOptions{PartitionKey: key, Ignore: ignore})
+			if res.Equality.Class != EqualityUnverified {
+				t.Fatalf("expected %s with ignored UUIDs, got %v (%+v)", EqualityUnverified, res.Equality.Class, res.Equality)
+			}
+			if res.Summary.Changed || res.Equality.VolatileDiffs != 0 || res.Equality.MeaningfulDiffs != 0 {
+				t.Fatalf("expected no counted changes, got summary %+v equality %+v", res.Summary, res.Equality)
+			}
+			if len(res.Diff.Partitions.Added) != 0 || len(res.Diff.Partitions.Removed) != 0 || len(res.Diff.Partitions.Modified) != 0 {
+				t.Fatalf("expected partitions to be matched and unchanged, got %+v", res.Diff.Partitions)
+			}
+			// The result still reports the images as inspected
+			if res.From.PartitionTable.Partitions[1].Filesystem.UUID != "UUID-A" ||
+				res.To.PartitionTable.Partitions[1].Filesystem.UUID != "UUID-B" {
+				t.Fatalf("expected original UUIDs in the result, got %+v", res.To.PartitionTable.Partitions[1].Filesystem)
+			}
+
+			// A real partition change is still reported.
+			c := mk("c.raw", "DISK-C", "UUID-C", "PART-C", 16383)
+			res = CompareImagesWithOptions(a, c, CompareOptions{PartitionKey: key, Ignore: ignore})
+			if res.Equality.Class != EqualityDifferent {
+				t.Fatalf("expected %s for a resized partition, got %v", EqualityDifferent, res.Equality.Class)
+			}
+			if len(res.Diff.Partitions.Added) != 0 || len(res.Diff.Partitions.Removed) != 0 || len(res.Diff.Partitions.Modified) != 1 {
+				t.Fatalf("expected the resized partition to be modified, got %+v", res.Diff.Partitions)
+			}
+			for _, ch := range res.Diff.Partitions.Modified[0].Changes {
+				if ch.Field == "guid" {
+					t.Fatalf("expected the ignored guid change to be left out, got %+v", res.Diff.Partitions.Modified[0].Changes)
+				}
+			}
+			if res.Diff.Partitions.Modified[0].Filesystem != nil {
+				t.Fatalf("expected the ignored filesystem UUID change to be left out, got %+v", res.Diff.Partitions.Modified[0].Filesystem)
+			}
+		})
+	}
+
+	// The inputs are not modified
+	if a.PartitionTable.DiskGUID != "DISK-A" || a.PartitionTable.Partitions[1].Filesystem.UUID != "UUID-A" {
+		t.Fatalf("expected CompareImagesWithOptions to leave its inputs untouched")
+	}
+}
+
+func TestValidateIgnoreFields(t *testing.T) {
+	if err := ValidateIgnoreFields([]string{"filesystem.uuid", "partition.guid", "sbom.sha256"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ValidateIgnoreFields([]string{"filesystem.uuid", "filesystem.uid"}); err == nil || !strings.Contains(err.Error(), "filesystem.uid") {
+		t.Fatalf("expected an error naming the unknown field, got %v", err)
+	}
+}
+
+func TestCompareImages_PartitionGUIDAndAttributes(t *testing.T) {
+	mk := func(file, partGUID string, attrRaw uint64) *ImageSummary {
+		return &ImageSummary{
+			File: file,
+			PartitionTable: PartitionTableSummary{
+				Type: "gpt",
+				Partitions: []PartitionSummary{{
+					Index:        1,
+					Name:         "rootfs",
+					Type:         "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+					GUID:         partGUID,
+					StartLBA:     2048,
+					EndLBA:       4095,
+					SizeBytes:    2048 * 512,
+					AttrRaw:      attrRaw,
+					AttrReadOnly: attrRaw&(1<<60) != 0,
+				}},
+			},
+		}
+	}
+
+	t.Run("only the partition GUID differs", func(t *testing.T) {
+		a, b := mk("a.raw", "PART-A", 0), mk("b.raw", "PART-B", 0)
+		if partitionsEqual(a.PartitionTable.Partitions[0], b.PartitionTable.Partitions[0]) {
+			t.Fatal("expected partitions with different GUIDs not to be equal")
+		}
+		res := CompareImages(a, b)
+		if len(res.Diff.Partitions.Added) != 0 || len(res.Diff.Partitions.Removed) != 0 || len(res.Diff.Partitions.Modified) != 1 {
+			t.Fatalf("expected the partition to be modified, got %+v", res.Diff.Partitions)
+		}
+		changes := res.Diff.Partitions.Modified[0].Changes
+		want := []FieldChange{{Field: "guid", From: "PART-A", To: "PART-B"}}
+		if !reflect.DeepEqual(changes, want) {
+			t.Fatalf("expected only a guid change, got %+v", changes)
+		}
+		// The GUID is regenerated on every build, a volatile change
+		if !res.Summary.Changed || res.Equality.VolatileDiffs == 0 {
+			t.Fatalf("expected the GUID change to be counted, got summary %+v equality %+v", res.Summary, res.Equality)
+		}
+	})
+
+	t.Run("only the attributes differ", func(t *testing.T) {
+		a, b := mk("a.raw", "PART-A", 0), mk("b.raw", "PART-A", 1<<60)
+		res := CompareImages(a, b)
+		if len(res.Diff.Partitions.Modified) != 1 {
+			t.Fatalf("expected the partition to be modified, got %+v", res.Diff.Partitions)
+		}
+		changes := res.Diff.Partitions.Modified[0].Changes
+		want := []FieldChange{
+			{Field: "attrRaw", From: uint64(0), To: uint64(1 << 60)},
+			{Field: "attrReadOnly", From: false, To: true},
+		}
+		if !reflect.DeepEqual(changes, want) {
+			t.Fatalf("expected attribute changes %+v, got %+v", want, changes)
+		}
+
+		res = CompareImagesWithOptions(a, b, CompareOptions{Ignore: []string{"partition.attrRaw"}})
+		if len(res.Diff.Partitions.Modified) != 0 {
+			t.Fatalf("expected ignored attributes to be left out, got %+v", res.Diff.Partitions.Modified)
+		}
+	})
+}
@@ -27,6 +27,7 @@ type ImageSummary struct {
 	SHA256         string                `json:"sha256,omitempty"`
 	SizeBytes      int64                 `json:"sizeBytes,omitempty"`
 	PartitionTable PartitionTableSummary `json:"partitionTable,omitempty"`
+	BootMode       BootMode              `json:"bootMode,omitempty" yaml:"bootMode,omitempty"`
 	Verity         *VeritySummary        `json:"verity,omitempty" yaml:"verity,omitempty"`
 	SBOM           SBOMSummary           `json:"sbom,omitempty" yaml:"sbom,omitempty"`
 }
@@ -47,6 +48,7 @@ type PartitionTableSummary struct {
 	LogicalSectorSize  int64
 	PhysicalSectorSize int64
 	ProtectiveMBR      bool
+	MBRBootCode        bool `json:"mbrBootCode,omitempty" yaml:"mbrBootCode,omitempty"`
 	Partitions         []PartitionSummary
 
 	LargestFreeSpan      *FreeSpanSummary `json:"largestFreeSpan,omitempty" yaml:"largestFreeSpan,omitempty"`
@@ -294,7 +296,7 @@ func (d *DiskfsInspector) Inspect(imagePath string) (*ImageSummary, error) {
 		}
 
 		// Check available disk space before conversion
-		if err := file.CheckDiskSpace(tmpDir, fi.Size(), 0.20); err != nil {
+		if err := file.CheckDiskSpace(0.20, file.DiskSpaceRequirement{Path: tmpDir, Bytes: fi.Size(), Purpose: "image conversion"}); err != nil {
 			return nil, fmt.Errorf("insufficient disk space for image conversion: %w", err)
 		}
 
@@ -380,6 +382,7 @@ func (d *DiskfsInspector) inspectCore(
 		return nil, fmt.Errorf("inspect filesystems: %w", err)
 	}
 	ptSummary.Partitions = partitionsWithFS
+	ptSummary.MBRBootCode = hasMBRBootCode(img)
 
 	// Detect dm-verity configuration
 	verityInfo := detectVerity(ptSummary)
@@ -402,6 +405,7 @@ func (d *DiskfsInspector) inspectCore(
 		File:           imagePath,
 		SizeBytes:      sizeBytes,
 		PartitionTable: ptSummary,
+		BootMode:       detectBootMode(ptSummary),
 		SHA256:         sha256sum,
 		Verity:         verityInfo,
 		SBOM:           sbomInfo,
@@ -39,6 +39,7 @@ func RenderCompareText(w io.Writer, r *ImageCompareResult, opts CompareTextOptio
 		fmt.Fprintf(w, "PartitionsChanged: %v\n", s.PartitionsChanged)
 		fmt.Fprintf(w, "EFIBinariesChanged: %v\n", s.EFIBinariesChanged)
 		fmt.Fprintf(w, "SBOMChanged: %v\n", s.SBOMChanged)
+		fmt.Fprintf(w, "BootModeChanged: %v\n", s.BootModeChanged)
 		obj := computeObjectCountsFromDiff(r.Diff)
 		fmt.Fprintf(w, "Counts (objects): +%d -%d ~%d\n", obj.added, obj.removed, obj.modified)
 
@@ -67,6 +68,10 @@ func RenderCompareText(w io.Writer, r *ImageCompareResult, opts CompareTextOptio
 		fmt.Fprintf(w, "Counts (fields):  volatile=%d meaningful=%d\n",
 			r.Equality.VolatileDiffs, r.Equality.MeaningfulDiffs)
 	}
+	if bm := r.Diff.Image.BootMode; bm != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Boot mode: %s -> %s\n", emptyIfWhitespace(string(bm.From)), emptyIfWhitespace(string(bm.To)))
+	}
 	// Partition table diff
 	if r.Diff.PartitionTable.Changed {
 		pt := r.Diff.PartitionTable
@@ -196,6 +201,9 @@ func RenderSummaryText(w io.Writer, summary *ImageSummary, opts TextOptions) err
 	if strings.TrimSpace(summary.SHA256) != "" {
 		fmt.Fprintf(w, "SHA256:\t%s\n", summary.SHA256)
 	}
+	if summary.BootMode != "" {
+		fmt.Fprintf(w, "Boot mode:\t%s\n", summary.BootMode)
+	}
 	// Partition table section
 	renderPartitionTableHeader(w, summary.PartitionTable)
 
@@ -652,6 +660,7 @@ func renderPartitionTableHeader(w io.Writer, pt PartitionTableSummary) {
 	if strings.EqualFold(pt.Type, "gpt") {
 		fmt.Fprintf(tw, "Protective MBR:\t%t\n", pt.ProtectiveMBR)
 	}
+	fmt.Fprintf(tw, "MBR boot code:\t%t\n", pt.MBRBootCode)
 	if pt.LargestFreeSpan != nil {
 		fmt.Fprintf(tw, "Largest free span:\t%s\n", freeSpanString(pt.LargestFreeSpan))
 	}
@@ -1250,6 +1259,9 @@ func renderEqualityHeader(w io.Writer, r *ImageCompareResult) {
 	if r.Equality.Class == EqualityDifferent {
 		var areas []string
 
+		if r.Summary.BootModeChanged {
+			areas = append(areas, "boot mode")
+		}
 		if r.Summary.PartitionTableChanged {
 			areas = append(areas, "partition table")
 		}
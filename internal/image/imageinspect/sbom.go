@@ -431,19 +431,34 @@ func parseAndCanonicalizeSPDX(spdxData []byte) (spdxComparableDoc, string, int,
 }
 
 func diffSPDXPackages(fromPkgs, toPkgs []spdxComparablePackage) ([]string, []string) {
-	fromSet := make(map[string]struct{}, len(fromPkgs))
-	toSet := make(map[string]struct{}, len(toPkgs))
+	fromKeys := make([]string, 0, len(fromPkgs))
+	toKeys := make([]string, 0, len(toPkgs))
 
 	for _, pkg := range fromPkgs {
-		fromSet[spdxPackageKey(pkg)] = struct{}{}
+		fromKeys = append(fromKeys, spdxPackageKey(pkg))
 	}
 
 	for _, pkg := range toPkgs {
-		toSet[spdxPackageKey(pkg)] = struct{}{}
+		toKeys = append(toKeys, spdxPackageKey(pkg))
 	}
 
-	var added []string
-	var removed []string
+	return DiffPackageSets(fromKeys, toKeys)
+}
+
+// DiffPackageSets returns the sorted entries of to that are missing from from
+// (added) and the sorted entries of from that are missing from to (removed).
+// Duplicates are ignored.
+func DiffPackageSets(from, to []string) (added, removed []string) {
+	fromSet := make(map[string]struct{}, len(from))
+	toSet := make(map[string]struct{}, len(to))
+
+	for _, key := range from {
+		fromSet[key] = struct{}{}
+	}
+
+	for _, key := range to {
+		toSet[key] = struct{}{}
+	}
 
 	for key := range toSet {
 		if _, exists := fromSet[key]; !exists {
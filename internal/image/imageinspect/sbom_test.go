@@ -176,6 +176,24 @@ func TestCompareSPDXFiles(t *testing.T) {
 	}
 }
 
+func TestDiffPackageSets(t *testing.T) {
+	from := []string{"curl", "vim", "wget", "vim"}
+	to := []string{"wget", "curl", "htop"}
+
+	added, removed := DiffPackageSets(from, to)
+	if strings.Join(added, ",") != "htop" {
+		t.Fatalf("expected added [htop], got %v", added)
+	}
+	if strings.Join(removed, ",") != "vim" {
+		t.Fatalf("expected removed [vim], got %v", removed)
+	}
+
+	added, removed = DiffPackageSets(to, to)
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("expected no difference, got added=%v removed=%v", added, removed)
+	}
+}
+
 func TestPartitionStartOffset_DefaultSectorSize(t *testing.T) {
 	pt := PartitionTableSummary{LogicalSectorSize: 512}
 	part := PartitionSummary{StartLBA: 2048}
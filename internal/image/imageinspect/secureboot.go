@@ -0,0 +1,106 @@
+package imageinspect
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// efiFallbackDir is the ESP directory of the removable media boot loaders
+// the firmware starts when it has no boot entry for the disk, which is how
+// a freshly written image boots.
+const efiFallbackDir = "efi/boot"
+
+// CheckSecureBootChain checks that the boot chain of the EFI binaries found
+// on the ESPs of the image can boot with UEFI Secure Boot enabled, with the
+// checks of the CheckSecureBootChain function.
+func (s *ImageSummary) CheckSecureBootChain() error {
+	var binaries []EFIBinaryEvidence
+	for _, p := range s.PartitionTable.Partitions {
+		if p.Filesystem != nil && isESPPartition(p) {
+			binaries = append(binaries, p.Filesystem.EFIBinaries...)
+		}
+	}
+	return CheckSecureBootChain(binaries)
+}
+
+// CheckSecureBootChain checks that the boot chain starting at each fallback
+// boot loader (EFI/BOOT/BOOT<arch>.EFI) of binaries is signed end to end:
+//
+//   - the fallback boot loader is signed;
+//   - a shim has an SBAT section, and loads a signed grub<arch>.efi with an
+//     SBAT section from its own directory;
+//   - systemd-boot has at least one UKI to boot in EFI/Linux, and all of
+//     them are signed.
+//
+// Signatures are only checked to be present, not verified against a key.
+// All the problems found are reported in the returned error.
+func CheckSecureBootChain(binaries []EFIBinaryEvidence) error {
+	byPath := make(map[string]EFIBinaryEvidence, len(binaries))
+	var loaders, ukis []EFIBinaryEvidence
+	for _, b := range binaries {
+		p := strings.ToLower(strings.TrimPrefix(b.Path, "/"))
+		byPath[p] = b
+		switch {
+		case isFallbackBootLoader(p):
+			loaders = append(loaders, b)
+		case path.Dir(p) == "efi/linux" && (b.IsUKI || b.Kind == BootloaderUKI):
+			ukis = append(ukis, b)
+		}
+	}
+	if len(loaders) == 0 {
+		return fmt.Errorf("secure boot chain incomplete: no fallback boot loader %s/BOOT<arch>.EFI found on the ESP",
+			strings.ToUpper(efiFallbackDir))
+	}
+
+	var problems []string
+	unsigned := func(b EFIBinaryEvidence, what string) {
+		if !b.Signed {
+			problems = append(problems, fmt.Sprintf("%s %s is not signed", what, b.Path))
+		}
+	}
+	ukisChecked := false
+	for _, loader := range loaders {
+		unsigned(loader, "boot loader")
+
+		switch loader.Kind {
+		case BootloaderShim:
+			if !loader.HasSBAT {
+				problems = append(problems, fmt.Sprintf("shim %s has no SBAT section", loader.Path))
+			}
+			// shim loads grub<arch>.efi, named after its own BOOT<arch>.EFI
+			arch := strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(path.Base(loader.Path)), "boot"), ".efi")
+			grubPath := path.Join(efiFallbackDir, "grub"+arch+".efi")
+			grub, ok := byPath[grubPath]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("shim %s has no second stage boot loader %s to load",
+					loader.Path, strings.ToUpper(path.Dir(grubPath))+"/"+path.Base(grubPath)))
+				continue
+			}
+			unsigned(grub, "second stage boot loader")
+			if !grub.HasSBAT {
+				problems = append(problems, fmt.Sprintf("second stage boot loader %s has no SBAT section, shim refuses to load it", grub.Path))
+			}
+		case BootloaderSystemdBoot:
+			if len(ukis) == 0 {
+				problems = append(problems, fmt.Sprintf("systemd-boot %s has no UKI in EFI/Linux to boot", loader.Path))
+			}
+			if !ukisChecked {
+				for _, uki := range ukis {
+					unsigned(uki, "UKI")
+				}
+				ukisChecked = true
+			}
+		case BootloaderGrub, BootloaderUKI:
+			// Nothing else on the ESP is loaded: a UKI is the kernel, and
+			// grub loads the kernel from the root or boot partition
+		default:
+			problems = append(problems, fmt.Sprintf("boot loader %s is not a shim, grub, systemd-boot or UKI", loader.Path))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("secure boot chain incomplete: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package imageinspect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckSecureBootChain(t *testing.T) {
+	systemdBoot := EFIBinaryEvidence{Path: "EFI/BOOT/BOOTX64.EFI", Kind: BootloaderSystemdBoot, Signed: true}
+	signedUKI := EFIBinaryEvidence{Path: "EFI/Linux/linux.efi", Kind: BootloaderUKI, IsUKI: true, Signed: true, HasSBAT: true}
+	shim := EFIBinaryEvidence{Path: "EFI/BOOT/BOOTX64.EFI", Kind: BootloaderShim, Signed: true, HasSBAT: true}
+	grub := EFIBinaryEvidence{Path: "EFI/BOOT/grubx64.efi", Kind: BootloaderGrub, Signed: true, HasSBAT: true}
+
+	unsignedUKI := signedUKI
+	unsignedUKI.Signed = false
+	grubWithoutSBAT := grub
+	grubWithoutSBAT.HasSBAT = false
+	unsignedShim := shim
+	unsignedShim.Signed = false
+
+	tests := []struct {
+		name      string
+		binaries  []EFIBinaryEvidence
+		wantError []string
+	}{
+		{
+			name:     "signed systemd-boot and UKI",
+			binaries: []EFIBinaryEvidence{systemdBoot, signedUKI},
+		},
+		{
+			name:     "signed shim and grub",
+			binaries: []EFIBinaryEvidence{shim, grub, {Path: "EFI/BOOT/mmx64.efi", Kind: BootloaderMokManager}},
+		},
+		{
+			name:      "unsigned UKI",
+			binaries:  []EFIBinaryEvidence{systemdBoot, unsignedUKI},
+			wantError: []string{"UKI EFI/Linux/linux.efi is not signed"},
+		},
+		{
+			name:      "systemd-boot without UKI",
+			binaries:  []EFIBinaryEvidence{systemdBoot},
+			wantError: []string{"has no UKI in EFI/Linux to boot"},
+		},
+		{
+			name:      "shim without second stage",
+			binaries:  []EFIBinaryEvidence{shim},
+			wantError: []string{"has no second stage boot loader EFI/BOOT/grubx64.efi"},
+		},
+		{
+			name:     "unsigned shim loading grub without SBAT",
+			binaries: []EFIBinaryEvidence{unsignedShim, grubWithoutSBAT},
+			wantError: []string{
+				"boot loader EFI/BOOT/BOOTX64.EFI is not signed",
+				"second stage boot loader EFI/BOOT/grubx64.efi has no SBAT section",
+			},
+		},
+		{
+			name:      "no fallback boot loader",
+			binaries:  []EFIBinaryEvidence{signedUKI},
+			wantError: []string{"no fallback boot loader EFI/BOOT/BOOT<arch>.EFI"},
+		},
+		{
+			name:      "unrecognized boot loader",
+			binaries:  []EFIBinaryEvidence{{Path: "EFI/BOOT/BOOTX64.EFI", Kind: BootloaderUnknown, Signed: true}},
+			wantError: []string{"is not a shim, grub, systemd-boot or UKI"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSecureBootChain(tt.binaries)
+			if len(tt.wantError) == 0 {
+				if err != nil {
+					t.Fatalf("expected a complete chain, got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an incomplete chain error containing %q", tt.wantError)
+			}
+			for _, want := range tt.wantError {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestImageSummaryCheckSecureBootChain(t *testing.T) {
+	summary := &ImageSummary{PartitionTable: PartitionTableSummary{Partitions: []PartitionSummary{
+		{
+			Index: 1,
+			Type:  "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+			Filesystem: &FilesystemSummary{Type: "vfat", HasUKI: true, EFIBinaries: []EFIBinaryEvidence{
+				{Path: "EFI/BOOT/BOOTX64.EFI", Kind: BootloaderSystemdBoot, Signed: true},
+				{Path: "EFI/Linux/linux.efi", Kind: BootloaderUKI, IsUKI: true},
+			}},
+		},
+		{Index: 2, Type: "0FC63DAF-8483-4772-8E79-3D69D8477DE4", Filesystem: &FilesystemSummary{Type: "ext4"}},
+	}}}
+
+	err := summary.CheckSecureBootChain()
+	if err == nil || !strings.Contains(err.Error(), "UKI EFI/Linux/linux.efi is not signed") {
+		t.Fatalf("expected the unsigned UKI of the ESP to be reported, got: %v", err)
+	}
+
+	summary.PartitionTable.Partitions[0].Filesystem.EFIBinaries[1].Signed = true
+	if err := summary.CheckSecureBootChain(); err != nil {
+		t.Fatalf("expected the signed chain to pass, got: %v", err)
+	}
+}
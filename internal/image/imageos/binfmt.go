@@ -0,0 +1,88 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// binfmtMiscDir is the mount point of the binfmt_misc filesystem, and
+// qemuBinDir the directory of the QEMU user emulators. Tests point them at
+// temporary directories.
+var (
+	binfmtMiscDir = "/proc/sys/fs/binfmt_misc"
+	qemuBinDir    = "/usr/bin"
+)
+
+// binfmtServices are the services that register the QEMU user emulators on
+// systemd hosts, tried in order.
+var binfmtServices = []string{"systemd-binfmt.service", "qemu-binfmt.service"}
+
+// qemuBinfmtMagic holds the ELF header magic and mask that identify the
+// binaries of each target architecture, as in qemu-binfmt-conf.sh. They are
+// written as the escaped strings binfmt_misc expects.
+var qemuBinfmtMagic = map[string]struct{ magic, mask string }{
+	"aarch64": {
+		magic: `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7\x00`,
+		mask:  `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+	"x86_64": {
+		magic: `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00`,
+		mask:  `\xff\xff\xff\xff\xff\xfe\xfe\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+}
+
+// registerBinfmt makes sure the QEMU user emulator for the target
+// architecture arch is registered with binfmt_misc, so that the binaries of
+// the image run during a cross-architecture build. It restarts the binfmt
+// services of systemd hosts, and when none of them registers the emulator,
+// as on hosts without systemd or in containers, it registers the emulator
+// directly through the binfmt_misc register file.
+func registerBinfmt(arch string) error {
+	entry, ok := qemuBinfmtMagic[arch]
+	if !ok {
+		return fmt.Errorf("unsupported target architecture for binfmt registration: %s", arch)
+	}
+	name := "qemu-" + arch
+	if binfmtRegistered(name) {
+		log.Debugf("binfmt entry %s is already registered", name)
+		return nil
+	}
+
+	for _, service := range binfmtServices {
+		if _, err := shell.ExecCmd("systemctl restart "+service, true, shell.HostPath, nil); err != nil {
+			log.Debugf("Failed to restart %s: %v", service, err)
+			continue
+		}
+		if binfmtRegistered(name) {
+			log.Infof("Registered binfmt entry %s with %s", name, service)
+			return nil
+		}
+	}
+
+	interpreter := filepath.Join(qemuBinDir, name+"-static")
+	if _, err := os.Stat(interpreter); err != nil {
+		return fmt.Errorf("QEMU user emulator %s for binfmt registration not found: %w", interpreter, err)
+	}
+	registration := fmt.Sprintf(":%s:M::%s:%s:%s:F", name, entry.magic, entry.mask, interpreter)
+
+	registerPath := filepath.Join(binfmtMiscDir, "register")
+	registerFile, err := os.OpenFile(registerPath, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open binfmt_misc register file %s: %w", registerPath, err)
+	}
+	defer registerFile.Close()
+	if _, err := registerFile.WriteString(registration); err != nil {
+		return fmt.Errorf("failed to register binfmt entry %s: %w", name, err)
+	}
+	log.Infof("Registered binfmt entry %s through %s", name, registerPath)
+	return nil
+}
+
+// binfmtRegistered reports whether the binfmt_misc entry name is registered.
+func binfmtRegistered(name string) bool {
+	_, err := os.Stat(filepath.Join(binfmtMiscDir, name))
+	return err == nil
+}
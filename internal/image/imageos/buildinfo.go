@@ -0,0 +1,80 @@
+package imageos
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/config/version"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
+)
+
+// buildMetadataPath is the file recording how and when the image was built,
+// readable from the running image.
+const buildMetadataPath = "/etc/os-image-composer-build.json"
+
+// BuildMetadata is the content of the build metadata file.
+type BuildMetadata struct {
+	Template        string `json:"template,omitempty"` // file name of the user template
+	ImageName       string `json:"imageName"`
+	ImageVersion    string `json:"imageVersion"`
+	OS              string `json:"os"`
+	Dist            string `json:"dist"`
+	Arch            string `json:"arch"`
+	ImageType       string `json:"imageType"`
+	ComposerVersion string `json:"composerVersion"`
+	ComposerCommit  string `json:"composerCommit"`
+	BuildDate       string `json:"buildDate"` // RFC 3339, UTC
+}
+
+// buildTimestamp returns the time the image is considered built at. In
+// reproducible-build mode, when SOURCE_DATE_EPOCH is set, it is pinned to
+// that timestamp so two builds of the same template record the same date.
+func buildTimestamp() time.Time {
+	if epoch, ok := system.SourceDateEpoch(); ok {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Now().UTC()
+}
+
+// newBuildMetadata returns the build metadata of template, built at buildTime.
+func newBuildMetadata(template *config.ImageTemplate, buildTime time.Time) BuildMetadata {
+	metadata := BuildMetadata{
+		ImageName:       template.Image.Name,
+		ImageVersion:    template.Image.Version,
+		OS:              template.Target.OS,
+		Dist:            template.Target.Dist,
+		Arch:            template.Target.Arch,
+		ImageType:       template.Target.ImageType,
+		ComposerVersion: version.Version,
+		ComposerCommit:  version.CommitSHA,
+		BuildDate:       buildTime.Format(time.RFC3339),
+	}
+	// The user template is loaded, and merged into the defaults, last
+	if n := len(template.PathList); n > 0 {
+		metadata.Template = filepath.Base(template.PathList[n-1])
+	}
+	return metadata
+}
+
+// addBuildMetadataFile writes the build metadata file into the image.
+func addBuildMetadataFile(installRoot string, template *config.ImageTemplate) error {
+	metadata := newBuildMetadata(template, buildTimestamp())
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal build metadata: %w", err)
+	}
+	metadataPath := filepath.Join(installRoot, buildMetadataPath)
+	if err := file.Write(string(data)+"\n", metadataPath); err != nil {
+		return fmt.Errorf("failed to write build metadata %s: %w", metadataPath, err)
+	}
+	if _, err := shell.ExecCmd("chmod 0644 "+metadataPath, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to set permissions for %s: %w", metadataPath, err)
+	}
+	log.Debugf("Wrote build metadata to %s", metadataPath)
+	return nil
+}
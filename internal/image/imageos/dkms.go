@@ -0,0 +1,119 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// dkmsModule is a module source tree registered with DKMS, as in
+// /usr/src/<name>-<version>/dkms.conf.
+type dkmsModule struct {
+	Name    string
+	Version string
+}
+
+// buildDKMSModules builds and installs the modules of the DKMS packages of
+// systemConfig.kernel.dkmsModules against the kernel the image boots, inside
+// the chroot. A module that fails to build fails the image build, rather
+// than leaving an image that boots without it.
+func buildDKMSModules(installRoot, pkgType string, template *config.ImageTemplate) error {
+	dkmsPkgs := template.GetKernel().DKMSModules
+	if len(dkmsPkgs) == 0 {
+		return nil
+	}
+	kernelVersion, err := getTargetKernelVersion(installRoot, pkgType, template)
+	if err != nil {
+		return fmt.Errorf("failed to get the kernel version to build DKMS modules for: %w", err)
+	}
+
+	for _, pkg := range dkmsPkgs {
+		pkgName := ospackage.ParsePackageSpec(pkg).Name
+		modules, err := dkmsPackageModules(installRoot, pkgType, pkgName)
+		if err != nil {
+			return err
+		}
+		for _, module := range modules {
+			log.Infof("Building DKMS module %s/%s of package %s for kernel %s", module.Name, module.Version, pkgName, kernelVersion)
+			cmd := fmt.Sprintf("dkms install -m %s -v %s -k %s", module.Name, module.Version, kernelVersion)
+			if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+				return fmt.Errorf("DKMS module %s/%s of package %s failed to build for kernel %s: %w",
+					module.Name, module.Version, pkgName, kernelVersion, err)
+			}
+		}
+	}
+	return nil
+}
+
+// dkmsPackageModules returns the DKMS modules whose source the package pkg
+// installs in installRoot.
+func dkmsPackageModules(installRoot, pkgType, pkg string) ([]dkmsModule, error) {
+	var listCmd string
+	switch pkgType {
+	case "rpm":
+		listCmd = "rpm -ql " + pkg
+	case "deb":
+		listCmd = "dpkg -L " + pkg
+	default:
+		return nil, fmt.Errorf("unsupported package type for DKMS module lookup: %s", pkgType)
+	}
+	output, err := shell.ExecCmd(listCmd, true, installRoot, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the files of DKMS package %s: %w", pkg, err)
+	}
+
+	var modules []dkmsModule
+	for _, line := range strings.Split(output, "\n") {
+		confPath := strings.TrimSpace(line)
+		srcDir, ok := strings.CutSuffix(confPath, "/dkms.conf")
+		if !ok || filepath.Dir(srcDir) != "/usr/src" {
+			continue
+		}
+		module := readDKMSModule(filepath.Join(installRoot, confPath), filepath.Base(srcDir))
+		if module.Name == "" || module.Version == "" {
+			return nil, fmt.Errorf("failed to get the DKMS module name and version of %s", confPath)
+		}
+		modules = append(modules, module)
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("package %s installs no DKMS module source in /usr/src", pkg)
+	}
+	return modules, nil
+}
+
+// readDKMSModule returns the module of the dkms.conf at confPath, in the
+// source directory srcDirName. The name and version are taken from
+// PACKAGE_NAME and PACKAGE_VERSION, or else from the directory name.
+func readDKMSModule(confPath, srcDirName string) dkmsModule {
+	var module dkmsModule
+	if i := strings.LastIndex(srcDirName, "-"); i > 0 {
+		module = dkmsModule{Name: srcDirName[:i], Version: srcDirName[i+1:]}
+	}
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		log.Debugf("Failed to read %s, using the source directory name: %v", confPath, err)
+		return module
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if value == "" || strings.ContainsAny(value, "$#") {
+			continue
+		}
+		switch key {
+		case "PACKAGE_NAME":
+			module.Name = value
+		case "PACKAGE_VERSION":
+			module.Version = value
+		}
+	}
+	return module
+}
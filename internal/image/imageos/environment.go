@@ -0,0 +1,81 @@
+package imageos
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// systemdDropInName is the file name of the drop-ins of
+// systemConfig.systemdDropIns in the drop-in directory of their unit.
+const systemdDropInName = "override.conf"
+
+// updateImageEnvironment appends the variables of systemConfig.environment to
+// /etc/environment of the image, keeping the variables already set there.
+func updateImageEnvironment(installRoot string, template *config.ImageTemplate) error {
+	environment := template.SystemConfig.Environment
+	if len(environment) == 0 {
+		return nil
+	}
+	log.Infof("Configuring environment variables...")
+	environmentPath := filepath.Join(installRoot, "etc", "environment")
+	if err := file.Append(environmentContent(environment), environmentPath); err != nil {
+		return fmt.Errorf("failed to append environment variables to %s: %w", environmentPath, err)
+	}
+	return nil
+}
+
+// environmentContent returns the /etc/environment lines of environment,
+// sorted by variable name.
+func environmentContent(environment map[string]string) string {
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# Added from systemConfig.environment of the image template\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", name, environment[name])
+	}
+	return b.String()
+}
+
+// systemdDropInPath returns the path in the image of the drop-in of unit.
+func systemdDropInPath(unit string) string {
+	return filepath.Join("/etc/systemd/system", unit+".d", systemdDropInName)
+}
+
+// systemdDropInContent returns the drop-in file holding content.
+func systemdDropInContent(content string) string {
+	return "# Generated from systemConfig.systemdDropIns of the image template\n" +
+		strings.TrimSpace(content) + "\n"
+}
+
+// updateImageSystemdDropIns writes the drop-ins of systemConfig.systemdDropIns
+// into the image, replacing any drop-in of the same name.
+func updateImageSystemdDropIns(installRoot string, template *config.ImageTemplate) error {
+	dropIns := template.SystemConfig.SystemdDropIns
+	if len(dropIns) == 0 {
+		return nil
+	}
+	log.Infof("Configuring systemd drop-ins...")
+	for _, dropIn := range dropIns {
+		dropInPath := filepath.Join(installRoot, systemdDropInPath(dropIn.Unit))
+		if err := file.Write(systemdDropInContent(dropIn.Content), dropInPath); err != nil {
+			return fmt.Errorf("failed to write drop-in %s: %w", dropInPath, err)
+		}
+		// Unit names may hold a backslash, quote the path for the shell
+		if _, err := shell.ExecCmd(fmt.Sprintf("chmod 0644 '%s'", dropInPath), true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to set permissions for %s: %w", dropInPath, err)
+		}
+		log.Debugf("Added drop-in for %s", dropIn.Unit)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package imageos
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// verifiedFile is one entry of an rpm -V or dpkg --verify report: a file that
+// differs from its package metadata.
+type verifiedFile struct {
+	Path   string
+	Flags  string // changed attributes, e.g. "S.5....T." or "missing"
+	Config bool   // the package marks the file as a configuration file
+}
+
+// parseVerifyReport parses the output of rpm -V or dpkg --verify, which share
+// the "<flags> [<attribute>] <path>" line format, e.g.
+//
+//	S.5....T.  c /etc/ssh/sshd_config
+//	missing      /usr/bin/ping
+//
+// Lines that are not report entries, such as warnings, are skipped.
+func parseVerifyReport(output string) []verifiedFile {
+	var files []verifiedFile
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !isVerifyFlags(fields[0]) {
+			continue
+		}
+		pathIdx := strings.Index(line, " /")
+		if pathIdx == -1 {
+			continue
+		}
+		entry := verifiedFile{
+			Path:  strings.TrimSpace(line[pathIdx+1:]),
+			Flags: fields[0],
+		}
+		// The optional attribute marker sits between the flags and the path
+		if len(fields) > 2 && fields[1] == "c" {
+			entry.Config = true
+		}
+		files = append(files, entry)
+	}
+	return files
+}
+
+// isVerifyFlags reports whether s is the flags column of a verify report.
+func isVerifyFlags(s string) bool {
+	if s == "missing" {
+		return true
+	}
+	if len(s) != 9 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune(".?SM5DLUGTP", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAllowedModification reports whether file may differ from its package
+// metadata under verify.
+func isAllowedModification(file verifiedFile, verify config.FileVerification) bool {
+	if file.Config && verify.AllowConfigFiles {
+		return true
+	}
+	for _, pattern := range verify.Allow {
+		if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if file.Path == dir || strings.HasPrefix(file.Path, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, file.Path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyInstalledFiles checks the files installed in installRoot against
+// their package metadata when systemConfig.verifyFiles is enabled. Every
+// modified file is reported; the build fails if any of them is not allowed.
+func (imageOs *ImageOs) verifyInstalledFiles(installRoot string, template *config.ImageTemplate) error {
+	verify := template.SystemConfig.VerifyFiles
+	if !verify.Enabled {
+		return nil
+	}
+	log.Infof("Verifying installed files against package metadata...")
+
+	var cmd, chrootPath string
+	switch pkgType := imageOs.chrootEnv.GetTargetOsPkgType(); pkgType {
+	case "rpm":
+		chrootInstallRoot, err := imageOs.chrootEnv.GetChrootEnvPath(installRoot)
+		if err != nil {
+			return fmt.Errorf("failed to get chroot environment path: %w", err)
+		}
+		// mtime changes are left out, they do not change file content
+		cmd = fmt.Sprintf("rpm --root %s -Va --nomtime", chrootInstallRoot)
+		chrootPath = imageOs.chrootEnv.GetChrootEnvRoot()
+	case "deb":
+		cmd = "dpkg --verify"
+		chrootPath = installRoot
+	default:
+		return fmt.Errorf("unsupported package type for file verification: %s", pkgType)
+	}
+
+	// Both tools exit non-zero when they find modified files, so the
+	// command only failed if it produced no report
+	output, err := shell.ExecCmd(cmd, true, chrootPath, nil)
+	files := parseVerifyReport(output)
+	if err != nil && len(files) == 0 {
+		return fmt.Errorf("failed to verify installed files: %w", err)
+	}
+
+	var unexpected []string
+	for _, file := range files {
+		if file.Flags == "missing" && isSlimDroppedFile(file.Path, template.SystemConfig.Slim) {
+			log.Debugf("Dropped by systemConfig.slim: %s", file.Path)
+			continue
+		}
+		if isAllowedModification(file, verify) {
+			log.Infof("Allowed modified file: %s (%s)", file.Path, file.Flags)
+			continue
+		}
+		log.Errorf("Unexpected modified file: %s (%s)", file.Path, file.Flags)
+		unexpected = append(unexpected, file.Path)
+	}
+	if len(unexpected) > 0 {
+		return fmt.Errorf("%d installed files differ from their package metadata: %s",
+			len(unexpected), strings.Join(unexpected, ", "))
+	}
+	log.Infof("Installed files verified, %d allowed modifications", len(files))
+	return nil
+}
@@ -1,14 +1,18 @@
 package imageos
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/open-edge-platform/image-composer-tool/internal/chroot"
@@ -40,6 +44,7 @@ type ImageOs struct {
 	template    *config.ImageTemplate
 	chrootEnv   chroot.ChrootEnvInterface
 	imageBoot   imageboot.ImageBootInterface
+	incremental *incrementalPlan // package delta applied to a kept rootfs, nil for a full install
 }
 
 var log = logger.Logger()
@@ -77,16 +82,26 @@ func (imageOs *ImageOs) GetInstallRoot() string {
 func (imageOs *ImageOs) InstallInitrd() (installRoot, versionInfo string, err error) {
 	installRoot = imageOs.installRoot
 	versionInfo = ""
+	stage := "rootfs initialization"
 	log.Infof("Installing initrd for image: %s", imageOs.template.GetImageName())
 
+	// Registered first so that it runs last, after the unmounts below
+	defer recoverInstallPanic(&stage, &err)
+
+	if err = imageOs.prepareIncrementalInstall(imageOs.installRoot, imageOs.template); err != nil {
+		return
+	}
+
 	pkgType := imageOs.chrootEnv.GetTargetOsPkgType()
-	if pkgType == "deb" {
+	// A reused rootfs already holds the essential packages
+	if pkgType == "deb" && imageOs.incremental == nil {
 		if err = imageOs.initRootfsForDeb(imageOs.installRoot); err != nil {
 			err = fmt.Errorf("failed to initialize rootfs for deb: %w", err)
 			return
 		}
 	}
 
+	stage = "sysfs mount"
 	if err = imageOs.mountSysfsToRootfs(imageOs.installRoot); err != nil {
 		return
 	}
@@ -101,30 +116,42 @@ func (imageOs *ImageOs) InstallInitrd() (installRoot, versionInfo string, err er
 		}
 	}()
 
+	stage = "pre-install"
 	log.Infof("Image installation pre-processing...")
 	if err = preImageOsInstall(imageOs.installRoot, imageOs.template); err != nil {
 		err = fmt.Errorf("pre-install failed: %w", err)
 		return
 	}
 
+	stage = "package installation"
 	log.Infof("Image package installation...")
 	if err = imageOs.installImagePkgs(imageOs.installRoot, imageOs.template); err != nil {
 		err = fmt.Errorf("failed to install image packages: %w", err)
 		return
 	}
 
+	stage = "package removal"
+	log.Infof("Image package removal...")
+	if err = imageOs.removeImagePkgs(imageOs.installRoot, imageOs.template); err != nil {
+		err = fmt.Errorf("failed to remove image packages: %w", err)
+		return
+	}
+
+	stage = "system configuration"
 	log.Infof("Image system configuration...")
 	if err = updateInitrdConfig(imageOs.installRoot, imageOs.template); err != nil {
 		err = fmt.Errorf("failed to update image config: %w", err)
 		return
 	}
 
+	stage = "post-install"
 	log.Infof("Image installation post-processing...")
 	versionInfo, err = imageOs.postImageOsInstall(imageOs.installRoot, imageOs.template)
 	if err != nil {
 		err = fmt.Errorf("post-install failed: %w", err)
 		return
 	}
+	imageOs.recordIncrementalState(imageOs.installRoot, imageOs.template)
 
 	return
 }
@@ -133,8 +160,28 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 	versionInfo = ""
 	var mountPointInfoList []map[string]string
 	var mounted bool = false
+	stage := "disk mount"
 	log.Infof("Installing OS for image: %s", imageOs.template.GetImageName())
 
+	// Registered first so that it runs last, after the unmounts below
+	defer recoverInstallPanic(&stage, &err)
+
+	if imageOs.template.Incremental {
+		log.Infof("Disk images are always installed in full, ignoring incremental build")
+	}
+
+	// A compressed root filesystem is installed into a plain directory that
+	// does not survive the build, so its stages cannot be resumed
+	checkpoint := imageOs.template.Checkpoint
+	compressedRootFsType := imageOs.template.CompressedRootFsType()
+	if compressedRootFsType != "" {
+		checkpoint = nil
+		if err = prepareCompressedInstallRoot(imageOs.installRoot); err != nil {
+			err = fmt.Errorf("failed to prepare install root for %s root filesystem: %w", compressedRootFsType, err)
+			return
+		}
+	}
+
 	defer func() {
 		if mounted {
 			if umountErr := imageOs.umountDiskFromChroot(imageOs.installRoot, mountPointInfoList); umountErr != nil {
@@ -154,9 +201,11 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 			return
 		}
 		mounted = true
-		if err = imageOs.initRootfsForDeb(imageOs.installRoot); err != nil {
-			err = fmt.Errorf("failed to initialize rootfs for deb: %w", err)
-			return
+		if !checkpoint.IsCompleted(config.StageInstall) {
+			if err = imageOs.initRootfsForDeb(imageOs.installRoot); err != nil {
+				err = fmt.Errorf("failed to initialize rootfs for deb: %w", err)
+				return
+			}
 		}
 	}
 
@@ -167,36 +216,74 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 	}
 	mounted = true
 
-	log.Infof("Image installation pre-processing...")
-	if err = preImageOsInstall(imageOs.installRoot, imageOs.template); err != nil {
-		err = fmt.Errorf("pre-install failed: %w", err)
-		return
-	}
+	if !skipCompletedStage(checkpoint, config.StageInstall) {
+		stage = "pre-install"
+		log.Infof("Image installation pre-processing...")
+		if err = preImageOsInstall(imageOs.installRoot, imageOs.template); err != nil {
+			err = fmt.Errorf("pre-install failed: %w", err)
+			return
+		}
+		if err = imageOs.configureSlimExcludes(imageOs.installRoot, imageOs.template); err != nil {
+			err = fmt.Errorf("pre-install failed: %w", err)
+			return
+		}
 
-	log.Infof("Image package installation...")
-	if err = imageOs.installImagePkgs(imageOs.installRoot, imageOs.template); err != nil {
-		err = fmt.Errorf("failed to install image packages: %w", err)
-		return
-	}
+		stage = "package installation"
+		log.Infof("Image package installation...")
+		if err = imageOs.installImagePkgs(imageOs.installRoot, imageOs.template); err != nil {
+			err = fmt.Errorf("failed to install image packages: %w", err)
+			return
+		}
+
+		stage = "package removal"
+		log.Infof("Image package removal...")
+		if err = imageOs.removeImagePkgs(imageOs.installRoot, imageOs.template); err != nil {
+			err = fmt.Errorf("failed to remove image packages: %w", err)
+			return
+		}
+
+		stage = "kernel symlinks creation"
+		log.Infof("Image Kernel symlinks creation...")
+		if err := fixKernelSymlinks(imageOs.installRoot); err != nil {
+			// Don't fail the build if symlink fix fails, just warn as some distros may not need it
+			log.Warnf("Failed to fix kernel symlinks: %v (continuing anyway)", err)
+		}
+
+		stage = "DKMS module build"
+		if err = buildDKMSModules(imageOs.installRoot, pkgType, imageOs.template); err != nil {
+			err = fmt.Errorf("failed to build DKMS modules: %w", err)
+			return
+		}
 
-	log.Infof("Image Kernel symlinks creation...")
-	if err := fixKernelSymlinks(imageOs.installRoot); err != nil {
-		// Don't fail the build if symlink fix fails, just warn as some distros may not need it
-		log.Warnf("Failed to fix kernel symlinks: %v (continuing anyway)", err)
+		stage = "documentation and locale removal"
+		if err = imageOs.removeSlimFiles(imageOs.installRoot, imageOs.template); err != nil {
+			err = fmt.Errorf("failed to remove documentation and locales: %w", err)
+			return
+		}
+		checkpoint.Complete(config.StageInstall)
 	}
 
-	log.Infof("Image system configuration...")
-	if err = updateImageConfig(imageOs.installRoot, diskPathIdMap, imageOs.template); err != nil {
-		err = fmt.Errorf("failed to update image config: %w", err)
-		return
+	if !skipCompletedStage(checkpoint, config.StageConfig) {
+		stage = "system configuration"
+		log.Infof("Image system configuration...")
+		if err = updateImageConfig(imageOs.installRoot, diskPathIdMap, imageOs.template, checkpoint); err != nil {
+			err = fmt.Errorf("failed to update image config: %w", err)
+			return
+		}
+		checkpoint.Complete(config.StageConfig)
 	}
 
-	log.Infof("Installing bootloader...")
-	if err = imageOs.imageBoot.InstallImageBoot(imageOs.installRoot, diskPathIdMap, imageOs.template, pkgType); err != nil {
-		err = fmt.Errorf("failed to install image boot: %w", err)
-		return
+	if !skipCompletedStage(checkpoint, config.StageBoot) {
+		stage = "bootloader installation"
+		log.Infof("Installing bootloader...")
+		if err = imageOs.imageBoot.InstallImageBoot(imageOs.installRoot, diskPathIdMap, imageOs.template, pkgType); err != nil {
+			err = fmt.Errorf("failed to install image boot: %w", err)
+			return
+		}
+		checkpoint.Complete(config.StageBoot)
 	}
 
+	stage = "SBOM generation"
 	log.Infof("Image SBOM generation...")
 	versionInfo, err = imageOs.generateSBOM(imageOs.installRoot, imageOs.template)
 	if err != nil {
@@ -204,23 +291,36 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 		return
 	}
 
-	if err = imagesecure.ConfigImageSecurity(imageOs.installRoot, imageOs.template); err != nil {
-		err = fmt.Errorf("failed to configure image security: %w", err)
-		return
+	if !skipCompletedStage(checkpoint, config.StageSecure) {
+		stage = "security configuration"
+		if err = imagesecure.ConfigImageSecurity(imageOs.installRoot, imageOs.template); err != nil {
+			err = fmt.Errorf("failed to configure image security: %w", err)
+			return
+		}
+		checkpoint.Complete(config.StageSecure)
 	}
 
-	log.Infof("Configuring UKI... ")
-	if err = buildImageUKI(imageOs.installRoot, imageOs.template); err != nil {
-		err = fmt.Errorf("failed to configure UKI: %w", err)
-		return
+	if !skipCompletedStage(checkpoint, config.StageUKI) {
+		stage = "UKI configuration"
+		log.Infof("Configuring UKI... ")
+		if err = buildImageUKI(imageOs.installRoot, imageOs.chrootEnv.GetTargetOsPkgType(), imageOs.template); err != nil {
+			err = fmt.Errorf("failed to configure UKI: %w", err)
+			return
+		}
+		checkpoint.Complete(config.StageUKI)
 	}
 
-	log.Infof("Configuring Sign Image...")
-	if err = imagesign.SignImage(imageOs.installRoot, imageOs.template); err != nil {
-		err = fmt.Errorf("failed to sign image: %w", err)
-		return
+	if !skipCompletedStage(checkpoint, config.StageSign) {
+		stage = "image signing"
+		log.Infof("Configuring Sign Image...")
+		if err = imagesign.SignImage(imageOs.installRoot, imageOs.template); err != nil {
+			err = fmt.Errorf("failed to sign image: %w", err)
+			return
+		}
+		checkpoint.Complete(config.StageSign)
 	}
 
+	stage = "post-install"
 	log.Infof("Image installation post-processing...")
 	versionInfo, err = imageOs.postImageOsInstall(imageOs.installRoot, imageOs.template)
 	if err != nil {
@@ -228,9 +328,60 @@ func (imageOs *ImageOs) InstallImageOs(diskPathIdMap map[string]string) (version
 		return
 	}
 
+	stage = "file verification"
+	if err = imageOs.verifyInstalledFiles(imageOs.installRoot, imageOs.template); err != nil {
+		err = fmt.Errorf("installed file verification failed: %w", err)
+		return
+	}
+
+	if compressedRootFsType != "" {
+		// The other partitions are unmounted first so that their content
+		// does not end up in the root filesystem
+		stage = "compressed root filesystem creation"
+		mounted = false
+		if err = imageOs.umountDiskFromChroot(imageOs.installRoot, mountPointInfoList); err != nil {
+			err = fmt.Errorf("failed to unmount disk from chroot: %w", err)
+			return
+		}
+		log.Infof("Building %s root filesystem...", compressedRootFsType)
+		if err = buildCompressedRootfs(imageOs.installRoot, diskPathIdMap, imageOs.template); err != nil {
+			err = fmt.Errorf("failed to build %s root filesystem: %w", compressedRootFsType, err)
+			return
+		}
+	}
+
 	return
 }
 
+// skipCompletedStage reports whether stage was completed by the build being
+// resumed from checkpoint, so that it is skipped.
+func skipCompletedStage(checkpoint *config.BuildCheckpoint, stage string) bool {
+	if !checkpoint.IsCompleted(stage) {
+		return false
+	}
+	log.Infof("Skipping the %s stage, completed by the resumed build", stage)
+	return true
+}
+
+// recoverInstallPanic turns a panic raised during the install stage into an
+// error. It must be deferred before the deferred unmounts of the install so
+// that those still run while the panic unwinds, and the caller gets an error
+// to tear down the chroot environment with instead of a crashed process that
+// leaves the image filesystems mounted.
+func recoverInstallPanic(stage *string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Errorf("Panic during %s: %v\n%s", *stage, r, debug.Stack())
+	panicErr := fmt.Errorf("panic during %s: %v", *stage, r)
+	if *err != nil {
+		*err = fmt.Errorf("operation failed: %w, cleanup errors: %v", panicErr, *err)
+	} else {
+		*err = panicErr
+	}
+}
+
 func (imageOs *ImageOs) initRootfsForDeb(installRoot string) error {
 	essentialPkgsList, err := imageOs.chrootEnv.GetChrootEnvEssentialPackageList()
 	if err != nil {
@@ -275,7 +426,7 @@ func (imageOs *ImageOs) initRootfsForDeb(installRoot string) error {
 		targetArch, pkgListStr, suite, chrootInstallRoot, localRepoConfigChrootPath)
 
 	chrootEnvRoot := imageOs.chrootEnv.GetChrootEnvRoot()
-	if _, err = shell.ExecCmdWithStream(cmd, true, chrootEnvRoot, nil); err != nil {
+	if _, err = shell.ExecCmdWithStreamStage("install", cmd, true, chrootEnvRoot, nil); err != nil {
 		log.Errorf("Failed to install essential packages into image: %v", err)
 		return fmt.Errorf("failed to install packages into image: %w", err)
 	}
@@ -294,6 +445,7 @@ func (imageOs *ImageOs) mountSysfsToRootfs(installRoot string) error {
 }
 
 func (imageOs *ImageOs) umountSysfsFromRootfs(installRoot string) error {
+	defer shell.BeginCleanup()()
 	chrootInstallRoot, err := imageOs.chrootEnv.GetChrootEnvPath(installRoot)
 	if err != nil {
 		return fmt.Errorf("failed to get chroot environment path: %w", err)
@@ -311,8 +463,15 @@ func mountDiskRootToChroot(installRoot string, diskPathIdMap map[string]string,
 		for _, partition := range partions {
 			if partition.ID == diskId {
 				if partition.MountPoint == "/" {
+					if config.IsCompressedFsType(partition.FsType) {
+						log.Debugf("Installing the %s root filesystem into %s before building it", partition.FsType, installRoot)
+						return nil
+					}
 					mountPoint := filepath.Join(installRoot, partition.MountPoint)
-					mountFlags := fmt.Sprintf("-t %s", partition.FsType)
+					mountFlags, err := partitionMountFlags(partition)
+					if err != nil {
+						return err
+					}
 					if err := mount.MountPath(diskPath, mountPoint, mountFlags); err != nil {
 						log.Errorf("Failed to mount %s to %s: %v", diskPath, mountPoint, err)
 						return fmt.Errorf("failed to mount %s to %s: %w", diskPath, mountPoint, err)
@@ -330,9 +489,53 @@ func isSwapFsType(fsType string) bool {
 	return fsType == "swap" || fsType == "linux-swap"
 }
 
+// isNonMountablePartition reports whether partition is left unmounted during
+// the installation: partitions without a mount point, swap, and a compressed
+// root partition, whose filesystem is only built after the installation.
 func isNonMountablePartition(partition config.PartitionInfo) bool {
 	mountPoint := strings.TrimSpace(partition.MountPoint)
-	return mountPoint == "" || mountPoint == "none" || isSwapFsType(partition.FsType)
+	return mountPoint == "" || mountPoint == "none" || isSwapFsType(partition.FsType) ||
+		config.IsCompressedFsType(partition.FsType)
+}
+
+// espPartitionTypeGUID is the GPT partition type GUID of an EFI System Partition.
+const espPartitionTypeGUID = "c12a7328-f81f-11d2-ba4b-00a0c93ec93b"
+
+// mountFsType returns the filesystem type to pass to mount for the template
+// filesystem type fsType, normalizing the FAT types to vfat.
+func mountFsType(fsType string) string {
+	switch strings.ToLower(fsType) {
+	case "fat16", "fat32", "vfat":
+		return "vfat"
+	}
+	return fsType
+}
+
+// isEspPartition reports whether partition is an EFI System Partition, by its
+// partition type, type GUID or esp flag. A partition mounted at /boot/efi is
+// taken as the ESP too, as templates may leave its type unset.
+func isEspPartition(partition config.PartitionInfo) bool {
+	if strings.EqualFold(partition.Type, imagedisc.PartitionFlagESP) ||
+		strings.EqualFold(partition.TypeGUID, espPartitionTypeGUID) ||
+		slice.Contains(partition.Flags, imagedisc.PartitionFlagESP) {
+		return true
+	}
+	return filepath.Clean(partition.MountPoint) == "/boot/efi"
+}
+
+// partitionMountFlags returns the mount flags for partition. An ESP must use a
+// FAT filesystem, as that is all UEFI firmware reads, and is mounted with
+// umask=0077 wherever it is mounted.
+func partitionMountFlags(partition config.PartitionInfo) (string, error) {
+	fsType := mountFsType(partition.FsType)
+	if !isEspPartition(partition) {
+		return fmt.Sprintf("-t %s", fsType), nil
+	}
+	if fsType != "vfat" {
+		log.Errorf("EFI System Partition %s uses filesystem %q instead of FAT", partition.ID, partition.FsType)
+		return "", fmt.Errorf("EFI System Partition %s must use a FAT filesystem (fat16 or fat32), got %q", partition.ID, partition.FsType)
+	}
+	return fmt.Sprintf("-t %s -o umask=0077", fsType), nil
 }
 
 func (imageOs *ImageOs) mountDiskToChroot(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) ([]map[string]string, error) {
@@ -352,16 +555,11 @@ func (imageOs *ImageOs) mountDiskToChroot(installRoot string, diskPathIdMap map[
 				mountPointInfo["Id"] = diskId
 				mountPointInfo["Path"] = diskPath
 				mountPointInfo["MountPoint"] = filepath.Join(installRoot, partition.MountPoint)
-				// Normalize FAT filesystem types to vfat for Linux mount compatibility
-				fsType := partition.FsType
-				if fsType == "fat32" || fsType == "fat16" {
-					fsType = "vfat"
-				}
-				if partition.MountPoint == "/boot/efi" {
-					mountPointInfo["Flags"] = fmt.Sprintf("-t %s -o umask=0077", fsType)
-				} else {
-					mountPointInfo["Flags"] = fmt.Sprintf("-t %s", fsType)
+				flags, err := partitionMountFlags(partition)
+				if err != nil {
+					return nil, err
 				}
+				mountPointInfo["Flags"] = flags
 				mountPointInfoList = append(mountPointInfoList, mountPointInfo)
 			}
 		}
@@ -372,11 +570,10 @@ func (imageOs *ImageOs) mountDiskToChroot(installRoot string, diskPathIdMap map[
 		return nil, fmt.Errorf("no mount points found for the provided diskPathIdMap")
 	}
 
-	// sort the mountPointInfoList by the partition.MountPoint
-	// mount requires order that the "/" mounted first, then "/boot", "/boot/efi", etc.
-	sort.Slice(mountPointInfoList, func(i, j int) bool {
-		return mountPointInfoList[i]["MountPoint"] < mountPointInfoList[j]["MountPoint"]
-	})
+	// sort the mountPointInfoList by the depth of partition.MountPoint, so a
+	// mount point is mounted after the one it is nested in: "/" first, then
+	// "/boot" and "/var", then "/boot/efi" and "/var/lib", etc.
+	sortMountPoints(mountPointInfoList)
 
 	for _, mountPointInfo := range mountPointInfoList {
 		mountPoint := mountPointInfo["MountPoint"]
@@ -395,7 +592,32 @@ func (imageOs *ImageOs) mountDiskToChroot(installRoot string, diskPathIdMap map[
 	return mountPointInfoList, nil
 }
 
+// mountPointDepth returns the number of path elements of mountPoint, 0 for
+// "/" and 2 for "/var/lib".
+func mountPointDepth(mountPoint string) int {
+	mountPoint = filepath.Clean(mountPoint)
+	if mountPoint == "/" {
+		return 0
+	}
+	return strings.Count(mountPoint, "/")
+}
+
+// sortMountPoints sorts mountPointInfoList in mount order: shallower mount
+// points first, and mount points of the same depth by path.
+func sortMountPoints(mountPointInfoList []map[string]string) {
+	sort.SliceStable(mountPointInfoList, func(i, j int) bool {
+		mi, mj := mountPointInfoList[i]["MountPoint"], mountPointInfoList[j]["MountPoint"]
+		if di, dj := mountPointDepth(mi), mountPointDepth(mj); di != dj {
+			return di < dj
+		}
+		return mi < mj
+	})
+}
+
+// umountDiskFromChroot unmounts the partitions mounted by mountDiskToChroot
+// in reverse mount order, so nested mount points are unmounted first.
 func (imageOs *ImageOs) umountDiskFromChroot(installRoot string, mountPointInfoList []map[string]string) error {
+	defer shell.BeginCleanup()()
 	if err := imageOs.umountSysfsFromRootfs(installRoot); err != nil {
 		return err
 	}
@@ -413,40 +635,16 @@ func (imageOs *ImageOs) umountDiskFromChroot(installRoot string, mountPointInfoL
 }
 
 func getRpmPkgInstallList(template *config.ImageTemplate) []string {
-	var head, middle, tail []string
-	imagePkgList := template.GetPackages()
-	for _, pkg := range imagePkgList {
-		if strings.HasPrefix(pkg, "filesystem") {
-			head = append(head, pkg)
-		} else if strings.HasPrefix(pkg, "initramfs") {
-			tail = append(tail, pkg)
-		} else {
-			middle = append(middle, pkg)
-		}
-	}
-	return append(append(head, middle...), tail...)
+	return orderPkgInstallList(template.GetPackages(), installOrderRules(template, rpmInstallOrderRules))
 }
 
 func getDebPkgInstallList(template *config.ImageTemplate) []string {
-	var head, middle, tail []string
 	var imagePkgList []string
 	// Exclude the template.EssentialPkgList as it is already installed by mmdebstrap
 	imagePkgList = append(imagePkgList, template.KernelPkgList...)
 	imagePkgList = append(imagePkgList, template.SystemConfig.Packages...)
 	imagePkgList = append(imagePkgList, template.BootloaderPkgList...)
-
-	for _, pkg := range imagePkgList {
-		if strings.HasPrefix(pkg, "base-files") {
-			head = append(head, pkg)
-		} else if strings.HasPrefix(pkg, "dracut") {
-			tail = append(tail, pkg)
-		} else if strings.HasPrefix(pkg, "systemd-boot") {
-			tail = append(tail, pkg)
-		} else {
-			middle = append(middle, pkg)
-		}
-	}
-	return append(append(head, middle...), tail...)
+	return orderPkgInstallList(imagePkgList, installOrderRules(template, debInstallOrderRules))
 }
 
 func (imageOs *ImageOs) initImageRpmDb(installRoot string, template *config.ImageTemplate) error {
@@ -464,13 +662,58 @@ func (imageOs *ImageOs) initImageRpmDb(installRoot string, template *config.Imag
 	}
 	cmd := fmt.Sprintf("rpm --root %s --initdb", chrootInstallRoot)
 	chrootEnvRoot := imageOs.chrootEnv.GetChrootEnvRoot()
-	if _, err := shell.ExecCmd(cmd, true, chrootEnvRoot, nil); err != nil {
+	if _, err := shell.WithRetry(func() (string, error) {
+		return shell.ExecCmd(cmd, true, chrootEnvRoot, nil)
+	}); err != nil {
 		log.Errorf("Failed to initialize RPM database in %s: %v", chrootInstallRoot, err)
 		return fmt.Errorf("failed to initialize RPM database: %w", err)
 	}
 	return nil
 }
 
+// importImageRpmGPGKeys imports the GPG keys of the repositories with
+// gpgcheck enabled into the RPM database of the image, so that the installed
+// packages, and those the image later installs from the same repositories,
+// pass their signature checks. The keys are fetched on the host, as the
+// chroot environment has no network access of its own.
+func (imageOs *ImageOs) importImageRpmGPGKeys(installRoot string) error {
+	keyURLs := rpmutils.ImageGPGKeyURLs()
+	if len(keyURLs) == 0 {
+		log.Debugf("No repository GPG keys to import into the image RPM database")
+		return nil
+	}
+	keyPaths, cleanup, err := rpmutils.CreateTempGPGKeyFiles(keyURLs)
+	if err != nil {
+		return fmt.Errorf("failed to fetch repository GPG keys: %w", err)
+	}
+	defer cleanup()
+
+	chrootInstallRoot, err := imageOs.chrootEnv.GetChrootEnvPath(installRoot)
+	if err != nil {
+		return fmt.Errorf("failed to get chroot environment path: %w", err)
+	}
+	chrootEnvRoot := imageOs.chrootEnv.GetChrootEnvRoot()
+	for i, keyPath := range keyPaths {
+		chrootKeyPath := fmt.Sprintf("/tmp/image-rpm-gpg-key-%d.asc", i)
+		if err := imageOs.chrootEnv.CopyFileFromHostToChroot(keyPath, chrootKeyPath); err != nil {
+			return fmt.Errorf("failed to copy GPG key %s to chroot: %w", keyURLs[i], err)
+		}
+		log.Infof("Importing repository GPG key %s into the image RPM database", keyURLs[i])
+		cmd := fmt.Sprintf("rpm --root %s --import %s", chrootInstallRoot, chrootKeyPath)
+		_, importErr := shell.ExecCmd(cmd, true, chrootEnvRoot, nil)
+		if hostKeyPath, err := imageOs.chrootEnv.GetChrootEnvHostPath(chrootKeyPath); err == nil {
+			if _, err := shell.ExecCmd("rm -f "+hostKeyPath, true, shell.HostPath, nil); err != nil {
+				log.Warnf("Failed to remove GPG key %s from chroot: %v", hostKeyPath, err)
+			}
+		}
+		if importErr != nil {
+			log.Errorf("Failed to import GPG key %s into the image RPM database: %v", keyURLs[i], importErr)
+			return fmt.Errorf("failed to import GPG key %s into the image RPM database: %w", keyURLs[i], importErr)
+		}
+	}
+	return nil
+}
+
 func (imageOs *ImageOs) initDebLocalRepoWithinInstallRoot(installRoot string) error {
 	chrootInstallRoot, err := imageOs.chrootEnv.GetChrootEnvPath(installRoot)
 	if err != nil {
@@ -491,7 +734,11 @@ func (imageOs *ImageOs) initDebLocalRepoWithinInstallRoot(installRoot string) er
 		return fmt.Errorf("failed to remove existing local repo config files: %w", err)
 	}
 
-	repoCongfigPath := filepath.Join(imageOs.chrootEnv.GetTargetOsConfigDir(), "chrootenvconfigs", "local.list")
+	// The local repo config generated for the chroot environment
+	repoCongfigPath, err := imageOs.chrootEnv.GetChrootEnvHostPath("/etc/apt/sources.list.d/local.list")
+	if err != nil {
+		return fmt.Errorf("failed to get chroot environment host path for local repo config: %w", err)
+	}
 	if _, err := os.Stat(repoCongfigPath); os.IsNotExist(err) {
 		log.Errorf("Repo config file does not exist: %s", repoCongfigPath)
 		return fmt.Errorf("repo config file does not exist: %s", repoCongfigPath)
@@ -601,6 +848,9 @@ func preImageOsInstall(installRoot string, template *config.ImageTemplate) error
 			if _, err := shell.ExecCmd(binfmtCmd, true, shell.HostPath, nil); err != nil {
 				log.Debugf("binfmt_misc mount attempt: %v", err)
 			}
+			if err := registerBinfmt(template.Target.Arch); err != nil {
+				log.Warnf("Failed to register QEMU user emulator for %s: %v", template.Target.Arch, err)
+			}
 
 			// Add target architecture to dpkg in the chroot
 			dpkgConfigCmd := fmt.Sprintf("dpkg --add-architecture %s 2>/dev/null || true", targetArch)
@@ -618,6 +868,128 @@ func preImageOsInstall(installRoot string, template *config.ImageTemplate) error
 	return nil
 }
 
+// runPreInstallCommands runs the template's pre-install commands once the
+// package database of the image is initialized, before any image package is
+// installed. An RPM image root is still empty at that point, so the commands
+// run in the build chroot instead; IMAGE_ROOT holds the path of the image root
+// as seen by the commands in both cases.
+func (imageOs *ImageOs) runPreInstallCommands(installRoot string, template *config.ImageTemplate) error {
+	cmds := template.GetPreInstallCommands()
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	if imageOs.chrootEnv.GetTargetOsPkgType() != "rpm" {
+		return runChrootHookCommands("pre-install", installRoot, []string{"IMAGE_ROOT=/"}, cmds)
+	}
+
+	chrootInstallRoot, err := imageOs.chrootEnv.GetChrootEnvPath(installRoot)
+	if err != nil {
+		return fmt.Errorf("failed to get chroot environment path: %w", err)
+	}
+	return runChrootHookCommands("pre-install", imageOs.chrootEnv.GetChrootEnvRoot(),
+		[]string{"IMAGE_ROOT=" + chrootInstallRoot}, cmds)
+}
+
+// pkgInstallFailures collects the packages that failed to install when
+// template.ContinueOnPkgError lets the install go on past a failure.
+type pkgInstallFailures struct {
+	pkgs   []string
+	errors []error
+}
+
+func (f *pkgInstallFailures) add(pkg string, err error) {
+	log.Errorf("Failed to install package %s, continuing with the remaining packages: %v", pkg, err)
+	f.pkgs = append(f.pkgs, pkg)
+	f.errors = append(f.errors, err)
+}
+
+// err returns nil if no package failed, or an error listing every failed
+// package with the reason it failed.
+func (f *pkgInstallFailures) err(total int) error {
+	if len(f.pkgs) == 0 {
+		return nil
+	}
+	log.Errorf("Installed %d of %d packages, failed: %s", total-len(f.pkgs), total, strings.Join(f.pkgs, ", "))
+	var details strings.Builder
+	for i, pkg := range f.pkgs {
+		fmt.Fprintf(&details, "\n  %s: %v", pkg, f.errors[i])
+	}
+	return fmt.Errorf("failed to install %d of %d packages:%s", len(f.pkgs), total, details.String())
+}
+
+// pkgInstallLogDir is the directory of the image build directory the whole
+// output of the failed package installs is written to.
+const pkgInstallLogDir = "install-logs"
+
+// savePkgInstallLog writes the output of a failed package install, kept by a
+// chroot.PackageInstallError, to a log file named after the package in the
+// pkgInstallLogDir directory of the image build directory, and returns err
+// with the path of the log. The error only shows the last lines of the
+// output. Other errors are returned as they are.
+func savePkgInstallLog(template *config.ImageTemplate, err error) error {
+	var installErr *chroot.PackageInstallError
+	if !errors.As(err, &installErr) || installErr.Output == "" {
+		return err
+	}
+	globalWorkDir, workDirErr := config.WorkDir()
+	if workDirErr != nil {
+		log.Warnf("Failed to get work directory for the install log of %s: %v", installErr.Package, workDirErr)
+		return err
+	}
+	logDir := filepath.Join(globalWorkDir,
+		system.GetProviderId(template.Target.OS, template.Target.Dist, template.Target.Arch),
+		"imagebuild", template.GetSystemConfigName(), pkgInstallLogDir)
+	if mkdirErr := os.MkdirAll(logDir, 0700); mkdirErr != nil {
+		log.Warnf("Failed to create install log directory %s: %v", logDir, mkdirErr)
+		return err
+	}
+	logPath := filepath.Join(logDir, strings.ReplaceAll(installErr.Package, "/", "_")+".log")
+	if writeErr := os.WriteFile(logPath, []byte(installErr.Output), 0644); writeErr != nil {
+		log.Warnf("Failed to write install log %s: %v", logPath, writeErr)
+		return err
+	}
+	log.Errorf("Full install output of %s written to %s", installErr.Package, logPath)
+	return fmt.Errorf("%w\nfull install log: %s", err, logPath)
+}
+
+// installPkgTransactions installs the package transactions of
+// pkgInstallTransactions in order with install. A failed transaction of
+// several packages is retried one package at a time, so that the failure is
+// attributed to the package causing it.
+func installPkgTransactions(template *config.ImageTemplate, transactions [][]string, install func(pkgs []string) error) error {
+	total := 0
+	for _, pkgs := range transactions {
+		total += len(pkgs)
+	}
+	var failures pkgInstallFailures
+	installed := 0
+	for _, pkgs := range transactions {
+		if len(pkgs) > 1 {
+			log.Infof("Installing packages %d-%d/%d in one transaction: %s",
+				installed+1, installed+len(pkgs), total, strings.Join(pkgs, " "))
+			err := install(pkgs)
+			if err == nil {
+				installed += len(pkgs)
+				continue
+			}
+			log.Warnf("Failed to install %d packages in one transaction, installing them one at a time: %v", len(pkgs), err)
+		}
+		for _, pkg := range pkgs {
+			installed++
+			log.Infof("Installing package %d/%d: %s", installed, total, pkg)
+			if err := install([]string{pkg}); err != nil {
+				err = savePkgInstallLog(template, err)
+				if !template.ContinueOnPkgError {
+					return fmt.Errorf("failed to install package %s: %w", pkg, err)
+				}
+				failures.add(pkg, err)
+			}
+		}
+	}
+	return failures.err(total)
+}
+
 func (imageOs *ImageOs) installImagePkgs(installRoot string, template *config.ImageTemplate) error {
 	pkgType := imageOs.chrootEnv.GetTargetOsPkgType()
 
@@ -625,14 +997,28 @@ func (imageOs *ImageOs) installImagePkgs(installRoot string, template *config.Im
 		if err := imageOs.initImageRpmDb(installRoot, template); err != nil {
 			return fmt.Errorf("failed to initialize RPM database: %w", err)
 		}
+		if err := imageOs.importImageRpmGPGKeys(installRoot); err != nil {
+			return err
+		}
 		imagePkgOrderedList := getRpmPkgInstallList(template)
-		imagePkgNum := len(imagePkgOrderedList)
+		// The pre-install commands already ran when the reused rootfs was populated
+		if imageOs.incremental != nil {
+			imagePkgOrderedList = imageOs.incremental.installList
+		} else if err := imageOs.runPreInstallCommands(installRoot, template); err != nil {
+			return err
+		}
 		// Force to use the local cache repository
-		var repositoryIDList []string = []string{"cache-repo"}
-		for i, pkg := range imagePkgOrderedList {
-			log.Infof("Installing package %d/%d: %s", i+1, imagePkgNum, pkg)
-			if err := imageOs.chrootEnv.TdnfInstallPackage(pkg, installRoot, repositoryIDList); err != nil {
-				return fmt.Errorf("failed to install package %s: %w", pkg, err)
+		var repositoryIDList []string = []string{chroot.LocalRepoID}
+		transactions := pkgInstallTransactions(imagePkgOrderedList, installOrderRules(template, rpmInstallOrderRules),
+			template.SystemConfig.BulkInstall, func(string) bool { return false })
+		if err := installPkgTransactions(template, transactions, func(pkgs []string) error {
+			return imageOs.chrootEnv.TdnfInstallPackage(strings.Join(pkgs, " "), installRoot, repositoryIDList, template.SystemConfig.PkgManagerOptions)
+		}); err != nil {
+			return err
+		}
+		if imageOs.incremental != nil && len(imageOs.incremental.removeList) > 0 {
+			if err := imageOs.removeRpmPkgs(installRoot, imageOs.incremental.removeList, template); err != nil {
+				return fmt.Errorf("failed to remove packages dropped from the template: %w", err)
 			}
 		}
 	} else if pkgType == "deb" {
@@ -641,10 +1027,17 @@ func (imageOs *ImageOs) installImagePkgs(installRoot string, template *config.Im
 		if err := imageOs.initDebLocalRepoWithinInstallRoot(installRoot); err != nil {
 			return fmt.Errorf("failed to initialize local repository within install root: %w", err)
 		}
-		imagePkgNum := len(imagePkgOrderedList)
+		if imageOs.incremental != nil {
+			imagePkgOrderedList = imageOs.incremental.installList
+		} else if err := imageOs.runPreInstallCommands(installRoot, template); err != nil {
+			return err
+		}
 		// Force to use the local cache repository
 		var repoSrcList []string = []string{"/etc/apt/sources.list.d/local.list"}
 		var efiVariableAccessPkg = []string{"systemd-boot", "dracut-core"}
+		isApparmorPkg := func(pkg string) bool {
+			return strings.Split(pkg, "_")[0] == "apparmor"
+		}
 
 		var initramfsBinaries = []string{"/usr/bin/dracut", "/usr/sbin/mkinitramfs", "/usr/sbin/update-initramfs"}
 		backupPaths, divertedPaths := prepareInitramfsBinariesForDebInstall(installRoot, initramfsBinaries)
@@ -653,8 +1046,13 @@ func (imageOs *ImageOs) installImagePkgs(installRoot string, template *config.Im
 			restoreInitramfsBinariesAfterDebInstall(installRoot, backupPaths, divertedPaths)
 		}()
 
-		for i, pkg := range imagePkgOrderedList {
-			log.Infof("Installing package %d/%d: %s", i+1, imagePkgNum, pkg)
+		// The packages needing special handling are installed on their own
+		transactions := pkgInstallTransactions(imagePkgOrderedList, installOrderRules(template, debInstallOrderRules),
+			template.SystemConfig.BulkInstall, func(pkg string) bool {
+				return slice.Contains(efiVariableAccessPkg, pkg) || isApparmorPkg(pkg)
+			})
+		installErr := installPkgTransactions(template, transactions, func(pkgs []string) error {
+			pkg := strings.Join(pkgs, " ")
 			if slice.Contains(efiVariableAccessPkg, pkg) {
 				// systemd-boot and dracut-core are special cases that may fail post-install in chroot.
 				// Skip post-install scripts using DPkg::Pre-Install-Pkgs and handle expected errors gracefully.
@@ -665,6 +1063,9 @@ func (imageOs *ImageOs) installImagePkgs(installRoot string, template *config.Im
 						installCmd += fmt.Sprintf(" -o Dir::Etc::sourcelist=%s", repoSrc)
 					}
 				}
+				for _, option := range template.SystemConfig.PkgManagerOptions {
+					installCmd += " " + option
+				}
 
 				// Set environment variables to ensure non-interactive installation
 				envVars := []string{
@@ -673,7 +1074,7 @@ func (imageOs *ImageOs) installImagePkgs(installRoot string, template *config.Im
 					"DEBCONF_NOWARNINGS=yes",
 				}
 
-				output, err := shell.ExecCmdWithStream(installCmd, true, installRoot, envVars)
+				output, err := shell.ExecCmdWithStreamStage("install", installCmd, true, installRoot, envVars)
 				// Always log the full output for debugging
 				log.Infof("apt-get install output for %s:\n%s", pkg, output)
 				if err != nil {
@@ -688,13 +1089,12 @@ func (imageOs *ImageOs) installImagePkgs(installRoot string, template *config.Im
 					}
 				}
 			} else {
-				if err := imageOs.chrootEnv.AptInstallPackage(pkg, installRoot, repoSrcList); err != nil {
-					return fmt.Errorf("failed to install package %s: %w", pkg, err)
+				if err := imageOs.chrootEnv.AptInstallPackage(pkg, installRoot, repoSrcList, template.SystemConfig.PkgManagerOptions); err != nil {
+					return err
 				}
 
 				// After apparmor is installed, create a wrapper to prevent postinst failures in chroot
-				pkgNameOnly := strings.Split(pkg, "_")[0]
-				if pkgNameOnly == "apparmor" {
+				if isApparmorPkg(pkg) {
 					// Create a wrapper script for apparmor_parser that always succeeds
 					apparmorOrigPath := filepath.Join(installRoot, "usr/sbin/apparmor_parser")
 					apparmorRealPath := filepath.Join(installRoot, "usr/sbin/apparmor_parser.real")
@@ -723,8 +1123,8 @@ exit 0
 					}
 				}
 			}
-
-		}
+			return nil
+		})
 		if err := imageOs.deInitDebLocalRepoWithinInstallRoot(installRoot); err != nil {
 			return fmt.Errorf("failed to de-initialize local repository within install root: %w", err)
 		}
@@ -744,12 +1144,135 @@ exit 0
 				log.Debugf("Restored original apparmor_parser after package installation")
 			}
 		}
+		if installErr != nil {
+			return installErr
+		}
+		if imageOs.incremental != nil && len(imageOs.incremental.removeList) > 0 {
+			if err := removeDebPkgs(installRoot, imageOs.incremental.removeList); err != nil {
+				return fmt.Errorf("failed to remove packages dropped from the template: %w", err)
+			}
+		}
 	} else {
 		return fmt.Errorf("unsupported package type: %s", pkgType)
 	}
 	return nil
 }
 
+// removeImagePkgs uninstalls the packages listed in systemConfig.removePackages.
+// Packages that were never installed are skipped, and the removal is rejected
+// if it would also take out a package that is still installed and depends on it.
+func (imageOs *ImageOs) removeImagePkgs(installRoot string, template *config.ImageTemplate) error {
+	removePkgList := template.GetRemovePackages()
+	if len(removePkgList) == 0 {
+		log.Debug("No packages to remove from the image")
+		return nil
+	}
+
+	pkgType := imageOs.chrootEnv.GetTargetOsPkgType()
+	switch pkgType {
+	case "rpm":
+		return imageOs.removeRpmPkgs(installRoot, removePkgList, template)
+	case "deb":
+		return removeDebPkgs(installRoot, removePkgList)
+	default:
+		return fmt.Errorf("unsupported package type: %s", pkgType)
+	}
+}
+
+func (imageOs *ImageOs) removeRpmPkgs(installRoot string, removePkgList []string, template *config.ImageTemplate) error {
+	chrootInstallRoot, err := imageOs.chrootEnv.GetChrootEnvPath(installRoot)
+	if err != nil {
+		return fmt.Errorf("failed to get chroot environment path: %w", err)
+	}
+	chrootEnvRoot := imageOs.chrootEnv.GetChrootEnvRoot()
+
+	var installedPkgList []string
+	for _, pkg := range removePkgList {
+		queryCmd := fmt.Sprintf("rpm --root %s -q %s", chrootInstallRoot, pkg)
+		if _, err := shell.ExecCmdSilent(queryCmd, true, chrootEnvRoot, nil); err != nil {
+			log.Infof("Package %s is not installed in the image, skipping removal", pkg)
+			continue
+		}
+		installedPkgList = append(installedPkgList, pkg)
+	}
+	if len(installedPkgList) == 0 {
+		return nil
+	}
+	pkgListStr := strings.Join(installedPkgList, " ")
+
+	// rpm refuses the erase transaction if an installed package still requires one of the packages
+	testCmd := fmt.Sprintf("rpm --root %s -e --test %s", chrootInstallRoot, pkgListStr)
+	if output, err := shell.ExecCmd(testCmd, true, chrootEnvRoot, nil); err != nil {
+		log.Errorf("Removing packages %s would break installed dependencies:\n%s", pkgListStr, output)
+		return fmt.Errorf("cannot remove packages %s, still required by installed packages: %s: %w",
+			pkgListStr, strings.TrimSpace(output), err)
+	}
+
+	var removeCmd string
+	if template.Target.OS == "redhat-compatible-distro" {
+		removeCmd = fmt.Sprintf("dnf remove %s -y --installroot %s --disablerepo=*",
+			pkgListStr, chrootInstallRoot)
+	} else {
+		removeCmd = fmt.Sprintf("tdnf remove %s --releasever %s --assumeyes --installroot %s --disablerepo=*",
+			pkgListStr, imageOs.chrootEnv.GetTargetOsReleaseVersion(), chrootInstallRoot)
+	}
+	log.Infof("Removing packages: %s", pkgListStr)
+	if _, err := shell.ExecCmdWithStreamStage("remove", removeCmd, true, chrootEnvRoot, nil); err != nil {
+		return fmt.Errorf("failed to remove packages %s: %w", pkgListStr, err)
+	}
+	return nil
+}
+
+func removeDebPkgs(installRoot string, removePkgList []string) error {
+	var installedPkgList []string
+	for _, pkg := range removePkgList {
+		output, err := shell.ExecCmdSilent("dpkg -s "+pkg, true, installRoot, nil)
+		if err != nil || !strings.Contains(output, "Status: install ok installed") {
+			log.Infof("Package %s is not installed in the image, skipping removal", pkg)
+			continue
+		}
+		installedPkgList = append(installedPkgList, pkg)
+	}
+	if len(installedPkgList) == 0 {
+		return nil
+	}
+	pkgListStr := strings.Join(installedPkgList, " ")
+
+	// apt-get removes reverse dependencies along with the requested packages,
+	// so simulate first and reject the removal if anything else would go.
+	output, err := shell.ExecCmd("apt-get -s remove "+pkgListStr, true, installRoot, nil)
+	if err != nil {
+		log.Errorf("Failed to simulate removal of packages %s:\n%s", pkgListStr, output)
+		return fmt.Errorf("failed to simulate removal of packages %s: %w", pkgListStr, err)
+	}
+	var dependentPkgList []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "Remv" {
+			continue
+		}
+		if !slice.Contains(installedPkgList, fields[1]) {
+			dependentPkgList = append(dependentPkgList, fields[1])
+		}
+	}
+	if len(dependentPkgList) > 0 {
+		return fmt.Errorf("cannot remove packages %s, still required by installed packages: %s",
+			pkgListStr, strings.Join(dependentPkgList, ", "))
+	}
+
+	envVars := []string{
+		"DEBIAN_FRONTEND=noninteractive",
+		"DEBCONF_NONINTERACTIVE_SEEN=true",
+		"DEBCONF_NOWARNINGS=yes",
+	}
+	log.Infof("Removing packages: %s", pkgListStr)
+	if output, err := shell.ExecCmdWithStreamStage("remove", "apt-get remove -y "+pkgListStr, true, installRoot, envVars); err != nil {
+		log.Errorf("Full apt-get output:\n%s", output)
+		return fmt.Errorf("failed to remove packages %s: %w", pkgListStr, err)
+	}
+	return nil
+}
+
 func prepareInitramfsBinariesForDebInstall(installRoot string, initramfsBinaries []string) (map[string]string, map[string]string) {
 	backupPaths := make(map[string]string)
 	divertedPaths := make(map[string]string)
@@ -835,12 +1358,24 @@ func updateInitrdConfig(installRoot string, template *config.ImageTemplate) erro
 	if err := updateImageUsrGroup(installRoot, template); err != nil {
 		return fmt.Errorf("failed to update image user/group: %w", err)
 	}
+	if err := updateImageSSHConfig(installRoot, template); err != nil {
+		return fmt.Errorf("failed to update image SSH configuration: %w", err)
+	}
+	if err := updateAdditionalFilesAttributes(installRoot, template); err != nil {
+		return fmt.Errorf("failed to update additional files attributes: %w", err)
+	}
 	if err := updateImageNetwork(installRoot, template); err != nil {
 		return fmt.Errorf("failed to update image network: %w", err)
 	}
+	if err := updateImageNameResolution(installRoot, template); err != nil {
+		return fmt.Errorf("failed to update image name resolution: %w", err)
+	}
 	if err := addImageIDFile(installRoot, template); err != nil {
 		return fmt.Errorf("failed to add image ID file: %w", err)
 	}
+	if err := addBuildMetadataFile(installRoot, template); err != nil {
+		return fmt.Errorf("failed to add build metadata file: %w", err)
+	}
 	if err := createResolvConfSymlink(installRoot, template); err != nil {
 		return fmt.Errorf("failed to create resolv.conf: %w", err)
 	}
@@ -850,34 +1385,115 @@ func updateInitrdConfig(installRoot string, template *config.ImageTemplate) erro
 	return nil
 }
 
-func updateImageConfig(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) error {
-	if err := updateImageHostname(installRoot, template); err != nil {
-		return fmt.Errorf("failed to update image hostname: %w", err)
-	}
-	if err := addImageAdditionalFiles(installRoot, template); err != nil {
-		return fmt.Errorf("failed to add additional files to image: %w", err)
-	}
-	if err := updateImageUsrGroup(installRoot, template); err != nil {
-		return fmt.Errorf("failed to update image user/group: %w", err)
-	}
-	if err := updateImageNetwork(installRoot, template); err != nil {
-		return fmt.Errorf("failed to update image network: %w", err)
-	}
-	if err := addImageIDFile(installRoot, template); err != nil {
-		return fmt.Errorf("failed to add image ID file: %w", err)
+// imageConfigStep is a step of the config stage, applied by updateImageConfig.
+type imageConfigStep struct {
+	name   string // name recorded in the build checkpoint
+	action string // what the step does, for its error
+	apply  func() error
+}
+
+// updateImageConfig applies the system configuration of template to the
+// image. The steps applied are recorded in checkpoint as they complete. If a
+// step fails, the /etc directory of the image, where the steps make most of
+// their changes, is restored from a copy taken before the first one, so that
+// a resumed build redoes the stage on an unconfigured /etc instead of on top
+// of a half-configured one. Changes outside /etc, such as additional files,
+// home directories and custom configuration commands, are kept. If the
+// restore fails too, the stage is marked partial in checkpoint so that the
+// build is not resumed. Without a checkpoint the build cannot be resumed and
+// nothing is rolled back.
+func updateImageConfig(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate,
+	checkpoint *config.BuildCheckpoint) error {
+	steps := []imageConfigStep{
+		{"hostname", "update image hostname", func() error { return updateImageHostname(installRoot, template) }},
+		{"additional files", "add additional files to image", func() error { return addImageAdditionalFiles(installRoot, template) }},
+		{"users", "update image user/group", func() error { return updateImageUsrGroup(installRoot, template) }},
+		{"SSH config", "update image SSH configuration", func() error { return updateImageSSHConfig(installRoot, template) }},
+		{"additional file attributes", "update additional files attributes", func() error { return updateAdditionalFilesAttributes(installRoot, template) }},
+		{"network", "update image network", func() error { return updateImageNetwork(installRoot, template) }},
+		{"name resolution", "update image name resolution", func() error { return updateImageNameResolution(installRoot, template) }},
+		{"image ID", "add image ID file", func() error { return addImageIDFile(installRoot, template) }},
+		{"build metadata", "add build metadata file", func() error { return addBuildMetadataFile(installRoot, template) }},
+		{"fstab", "update image fstab", func() error { return updateImageFstab(installRoot, diskPathIdMap, template) }},
+		{"read-only /usr", "configure read-only /usr", func() error { return updateImageReadOnlyUsr(installRoot, template) }},
+		{"environment", "update image environment", func() error { return updateImageEnvironment(installRoot, template) }},
+		{"systemd drop-ins", "add systemd drop-ins to image", func() error { return updateImageSystemdDropIns(installRoot, template) }},
+		{"SSH host keys", "update image SSH host keys", func() error { return updateImageSSHHostKeys(installRoot, template) }},
+		{"resolv.conf", "create resolv.conf", func() error { return createResolvConfSymlink(installRoot, template) }},
+		{"custom configurations", "execute customized configurations to image", func() error { return addImageConfigs(installRoot, template) }},
+	}
+
+	var etcBackupDir string
+	if checkpoint != nil {
+		if len(checkpoint.ConfigSteps) > 0 {
+			log.Infof("Redoing the config steps %v applied by the resumed build, their /etc changes were rolled back",
+				checkpoint.ConfigSteps)
+		}
+		checkpoint.RecordConfigSteps(nil)
+		var err error
+		if etcBackupDir, err = backupImageEtc(installRoot); err != nil {
+			return err
+		}
+		defer removeImageEtcBackup(etcBackupDir)
+	}
+
+	var applied []string
+	for _, step := range steps {
+		if err := step.apply(); err != nil {
+			err = fmt.Errorf("failed to %s: %w", step.action, err)
+			if etcBackupDir == "" {
+				return err
+			}
+			if restoreErr := restoreImageEtc(installRoot, etcBackupDir); restoreErr != nil {
+				checkpoint.MarkPartial(config.StageConfig)
+				return fmt.Errorf("%w, rollback errors: %v", err, restoreErr)
+			}
+			log.Warnf("Rolled back the /etc changes of the config steps %v after the %s step failed", applied, step.name)
+			return err
+		}
+		applied = append(applied, step.name)
+		checkpoint.RecordConfigSteps(applied)
 	}
-	if err := updateImageFstab(installRoot, diskPathIdMap, template); err != nil {
-		return fmt.Errorf("failed to update image fstab: %w", err)
+	return nil
+}
+
+// backupImageEtc copies the /etc directory of the image into a new host
+// temporary directory, which it returns.
+func backupImageEtc(installRoot string) (string, error) {
+	backupDir, err := os.MkdirTemp(config.TempDir(), "etc-backup-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create image /etc backup directory: %w", err)
 	}
-	if err := createResolvConfSymlink(installRoot, template); err != nil {
-		return fmt.Errorf("failed to create resolv.conf: %w", err)
+	cmd := fmt.Sprintf("cp -a '%s' '%s'", filepath.Join(installRoot, "etc"), backupDir)
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		removeImageEtcBackup(backupDir)
+		return "", fmt.Errorf("failed to back up image /etc directory: %w", err)
 	}
-	if err := addImageConfigs(installRoot, template); err != nil {
-		return fmt.Errorf("failed to execute customized configurations to image: %w", err)
+	return backupDir, nil
+}
+
+// restoreImageEtc replaces the /etc directory of the image with the copy
+// taken by backupImageEtc.
+func restoreImageEtc(installRoot, backupDir string) error {
+	etcDir := filepath.Join(installRoot, "etc")
+	if _, err := shell.ExecCmd(fmt.Sprintf("rm -rf '%s'", etcDir), true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to remove image /etc directory: %w", err)
+	}
+	cmd := fmt.Sprintf("cp -a '%s' '%s'", filepath.Join(backupDir, "etc"), etcDir)
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to restore image /etc directory: %w", err)
 	}
 	return nil
 }
 
+// removeImageEtcBackup removes the copy taken by backupImageEtc, which holds
+// files only root can remove.
+func removeImageEtcBackup(backupDir string) {
+	if _, err := shell.ExecCmd(fmt.Sprintf("rm -rf '%s'", backupDir), true, shell.HostPath, nil); err != nil {
+		log.Warnf("Failed to remove image /etc backup %s: %v", backupDir, err)
+	}
+}
+
 func (imageOs *ImageOs) getImageVersionInfo(installRoot string, template *config.ImageTemplate) (string, error) {
 	var versionInfo string
 	log.Infof("Getting image version info for: %s", template.GetImageName())
@@ -916,7 +1532,35 @@ func (imageOs *ImageOs) getImageVersionInfo(installRoot string, template *config
 	return versionInfo, nil
 }
 
+// runChrootHookCommands runs template-provided hook commands in order inside
+// chrootPath. Each command is fed to bash on stdin, so the template content
+// never becomes part of the host command line, and the first failing command
+// aborts the remaining ones.
+func runChrootHookCommands(stage, chrootPath string, envVal []string, cmds []string) error {
+	for i, cmdStr := range cmds {
+		if strings.TrimSpace(cmdStr) == "" {
+			return fmt.Errorf("%s command %d is empty", stage, i+1)
+		}
+		log.Infof("Running %s command %d/%d", stage, i+1, len(cmds))
+		output, err := shell.ExecCmdWithInput(cmdStr+"\n", "bash -e -s", true, chrootPath, envVal)
+		for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+			if line != "" {
+				log.Infof("[%s] %s", stage, line)
+			}
+		}
+		if err != nil {
+			log.Errorf("Failed to execute %s command %d (%s): %v", stage, i+1, cmdStr, err)
+			return fmt.Errorf("failed to execute %s command %d (%s): %w", stage, i+1, cmdStr, err)
+		}
+	}
+	return nil
+}
+
 func (imageOs *ImageOs) postImageOsInstall(installRoot string, template *config.ImageTemplate) (string, error) {
+	if err := runChrootHookCommands("post-install", installRoot, nil, template.GetPostInstallCommands()); err != nil {
+		return "", err
+	}
+
 	versionInfo, err := imageOs.getImageVersionInfo(installRoot, template)
 	if err != nil {
 		return versionInfo, fmt.Errorf("failed to get image version info: %w", err)
@@ -942,6 +1586,7 @@ func updateImageHostname(installRoot string, template *config.ImageTemplate) err
 
 func updateImageUsrGroup(installRoot string, template *config.ImageTemplate) error {
 	log.Infof("Configuring User...")
+	warnIfNoLoginPath(template)
 	if err := createUser(installRoot, template); err != nil {
 		return fmt.Errorf("failed to configuring User: %w", err)
 	}
@@ -964,8 +1609,8 @@ func updateImageNetwork(installRoot string, template *config.ImageTemplate) erro
 func addImageIDFile(installRoot string, template *config.ImageTemplate) error {
 	log.Infof("Adding image ID file for image: %s", template.GetImageName())
 	imageIDFilePath := filepath.Join(installRoot, "etc", "image-id")
-	// Get the current time in UTC and in format "YYYYMMDDHHMMSS"
-	imageBuildDate := time.Now().UTC().Format("20060102150405")
+	// Get the build time in UTC and in format "YYYYMMDDHHMMSS"
+	imageBuildDate := buildTimestamp().Format("20060102150405")
 	imageIDContent := fmt.Sprintf("IMAGE_BUILD_DATE=%s\nIMAGE_UUID=%s\n", imageBuildDate, uuid.New().String())
 	if err := file.Write(imageIDContent, imageIDFilePath); err != nil {
 		log.Errorf("Failed to write file %s: %v", imageIDFilePath, err)
@@ -987,8 +1632,20 @@ func addImageAdditionalFiles(installRoot string, template *config.ImageTemplate)
 	}
 
 	for _, fileInfo := range additionalFiles {
+		if fileInfo.Archive {
+			if err := extractAdditionalArchive(installRoot, fileInfo); err != nil {
+				return err
+			}
+			continue
+		}
+		if fileInfo.Mode != "" {
+			if _, err := parseAdditionalFileMode(fileInfo); err != nil {
+				return err
+			}
+		}
 		srcFile := fileInfo.Local
 		dstFile := filepath.Join(installRoot, fileInfo.Final)
+		// Copy with -p so the source file's mode is kept unless the template overrides it
 		if err := file.CopyFile(srcFile, dstFile, "-p", true); err != nil {
 			log.Errorf("Failed to copy additional file %s to image: %v", srcFile, err)
 			return fmt.Errorf("failed to copy additional file %s to image: %w", srcFile, err)
@@ -997,6 +1654,120 @@ func addImageAdditionalFiles(installRoot string, template *config.ImageTemplate)
 	}
 	return nil
 }
+
+// extractAdditionalArchive extracts the archive of fileInfo into its Final
+// directory inside installRoot. The archive is first extracted into a host
+// temporary directory, where entries escaping the directory are rejected, and
+// only then copied into the image.
+func extractAdditionalArchive(installRoot string, fileInfo config.AdditionalFileInfo) error {
+	if fileInfo.Mode != "" {
+		return fmt.Errorf("mode is not supported for additional archive %s, set the modes inside the archive", fileInfo.Local)
+	}
+	extractDir, err := os.MkdirTemp(config.TempDir(), "additional-archive-")
+	if err != nil {
+		return fmt.Errorf("failed to create extraction directory for %s: %w", fileInfo.Local, err)
+	}
+	defer os.RemoveAll(extractDir)
+
+	if err := file.ExtractArchive(fileInfo.Local, extractDir); err != nil {
+		log.Errorf("Failed to extract additional archive %s: %v", fileInfo.Local, err)
+		return fmt.Errorf("failed to extract additional archive %s: %w", fileInfo.Local, err)
+	}
+
+	dstDir := filepath.Join(installRoot, fileInfo.Final)
+	if _, err := shell.ExecCmd(fmt.Sprintf("mkdir -p '%s'", dstDir), true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to create directory %s for additional archive: %w", dstDir, err)
+	}
+	// Copy the directory content, including dot files, so existing files of
+	// the image that are not in the archive are kept. The copies are owned by
+	// root rather than by the build user that extracted them, and existing
+	// directories keep their owner
+	cmd := fmt.Sprintf("cp -a --no-preserve=ownership '%s'/. '%s'", extractDir, dstDir)
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to copy additional archive %s to image: %v", fileInfo.Local, err)
+		return fmt.Errorf("failed to copy additional archive %s to image: %w", fileInfo.Local, err)
+	}
+	log.Debugf("Successfully extracted additional archive %s to %s", fileInfo.Local, dstDir)
+	return nil
+}
+
+// chownArgsPerCmd bounds how many paths a single chown command is given.
+const chownArgsPerCmd = 200
+
+// chownArchiveEntries gives the entries of the archive of fileInfo, extracted
+// under its Final directory, to ownership. Files of the image that were not
+// in the archive, including the directories it was extracted into, keep
+// their owner. Symlinks are changed themselves, not their targets.
+func chownArchiveEntries(installRoot string, fileInfo config.AdditionalFileInfo, ownership string) error {
+	entries, err := file.ArchiveEntries(fileInfo.Local)
+	if err != nil {
+		return fmt.Errorf("failed to list additional archive %s: %w", fileInfo.Local, err)
+	}
+	for start := 0; start < len(entries); start += chownArgsPerCmd {
+		var paths []string
+		for _, entry := range entries[start:min(start+chownArgsPerCmd, len(entries))] {
+			paths = append(paths, shell.SingleQuote(filepath.Join(fileInfo.Final, entry)))
+		}
+		cmd := fmt.Sprintf("chown -h %s %s", ownership, strings.Join(paths, " "))
+		if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+			log.Errorf("Failed to set ownership %s for additional archive %s: %v", ownership, fileInfo.Local, err)
+			return fmt.Errorf("failed to set ownership %s for additional archive %s: %w", ownership, fileInfo.Local, err)
+		}
+	}
+	log.Debugf("Set ownership %s for the %d entries of additional archive: %s", ownership, len(entries), fileInfo.Local)
+	return nil
+}
+
+func parseAdditionalFileMode(fileInfo config.AdditionalFileInfo) (uint64, error) {
+	mode, err := strconv.ParseUint(fileInfo.Mode, 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, fmt.Errorf("invalid mode %q for additional file %s", fileInfo.Mode, fileInfo.Final)
+	}
+	return mode, nil
+}
+
+// updateAdditionalFilesAttributes sets the owner, group and mode of additional files.
+// It runs inside the image so that names resolve against the image's own passwd and
+// group databases, which is why it must run after the template users have been created.
+// Files without an owner are given to root so host uids do not leak into the image, and
+// the mode is applied after chown because chown clears the setuid and setgid bits.
+func updateAdditionalFilesAttributes(installRoot string, template *config.ImageTemplate) error {
+	for _, fileInfo := range template.GetAdditionalFileInfo() {
+		owner := fileInfo.Owner
+		if owner == "" {
+			owner = "root"
+		}
+		// "owner:" with an empty group selects the owner's login group
+		ownership := owner + ":" + fileInfo.Group
+		if fileInfo.Archive {
+			if err := chownArchiveEntries(installRoot, fileInfo, ownership); err != nil {
+				return err
+			}
+			continue
+		}
+		cmd := fmt.Sprintf("chown %s %s", ownership, fileInfo.Final)
+		if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+			log.Errorf("Failed to set ownership %s for additional file %s: %v", ownership, fileInfo.Final, err)
+			return fmt.Errorf("failed to set ownership %s for additional file %s: %w", ownership, fileInfo.Final, err)
+		}
+		log.Debugf("Set ownership %s for additional file: %s", ownership, fileInfo.Final)
+
+		if fileInfo.Mode == "" {
+			continue
+		}
+		mode, err := parseAdditionalFileMode(fileInfo)
+		if err != nil {
+			return err
+		}
+		cmd = fmt.Sprintf("chmod %04o %s", mode, fileInfo.Final)
+		if _, err := shell.ExecCmd(cmd, true, installRoot, nil); err != nil {
+			log.Errorf("Failed to set mode %s for additional file %s: %v", fileInfo.Mode, fileInfo.Final, err)
+			return fmt.Errorf("failed to set mode %s for additional file %s: %w", fileInfo.Mode, fileInfo.Final, err)
+		}
+	}
+	return nil
+}
+
 func addImageConfigs(installRoot string, template *config.ImageTemplate) error {
 	customConfigs := template.GetConfigurationInfo()
 	if len(customConfigs) == 0 {
@@ -1030,11 +1801,19 @@ func updateImageFstab(installRoot string, diskPathIdMap map[string]string, templ
 	)
 	log.Infof("Updating fstab for image: %s", template.GetImageName())
 	fstabFullPath := filepath.Join(installRoot, "etc", "fstab")
+	readOnlyUsr := template.SystemConfig.ReadOnlyUsr.Enabled
+	hasUsrPartition := false
 	diskInfo := template.GetDiskConfig()
 	partitions := diskInfo.Partitions
 	for diskId, diskPath := range diskPathIdMap {
 		for _, partition := range partitions {
 			if partition.ID == diskId {
+				// Partitions without a mount point, such as slot B of an
+				// A/B layout, are not mounted by the image
+				if strings.TrimSpace(partition.MountPoint) == "" && !isSwapFsType(partition.FsType) {
+					continue
+				}
+
 				// Get the partition UUID and mount point
 				partUUID, err := imagedisc.GetPartUUID(diskPath)
 				if err != nil {
@@ -1044,12 +1823,8 @@ func updateImageFstab(installRoot string, diskPathIdMap map[string]string, templ
 				mountPoint := partition.MountPoint
 
 				// Get the filesystem type
-				var fsType, options, pass string
-				if partition.FsType == "fat16" || partition.FsType == "fat32" {
-					fsType = "vfat"
-				} else {
-					fsType = partition.FsType
-				}
+				var options, pass string
+				fsType := mountFsType(partition.FsType)
 
 				// Get the mount options
 				options = defaultOptions
@@ -1063,6 +1838,17 @@ func updateImageFstab(installRoot string, diskPathIdMap map[string]string, templ
 					pass = rootPass
 				}
 
+				// Compressed filesystems are read-only and have no fsck
+				if config.IsCompressedFsType(fsType) {
+					options = readOnlyMountOptions(options)
+					pass = disablePass
+				}
+
+				if readOnlyUsr && filepath.Clean(mountPoint) == usrMountPoint {
+					options = readOnlyMountOptions(options)
+					hasUsrPartition = true
+				}
+
 				if isSwapFsType(fsType) {
 					fsType = "swap"
 					if strings.TrimSpace(mountPoint) == "" {
@@ -1085,6 +1871,136 @@ func updateImageFstab(installRoot string, diskPathIdMap map[string]string, templ
 			}
 		}
 	}
+
+	// Without a /usr partition, /usr is a read-only bind mount of the
+	// directory of the writable root filesystem
+	if readOnlyUsr && !hasUsrPartition {
+		if err := file.Append(readOnlyUsrFstabContent(), fstabFullPath); err != nil {
+			return fmt.Errorf("failed to append read-only /usr fstab entry: %w", err)
+		}
+	}
+
+	if extraEntries := template.SystemConfig.ExtraFstabEntries; len(extraEntries) > 0 {
+		log.Debugf("Adding %d extra fstab entries", len(extraEntries))
+		if err := file.Append(extraFstabEntriesContent(extraEntries), fstabFullPath); err != nil {
+			return fmt.Errorf("failed to append extra fstab entries: %w", err)
+		}
+	}
+	return nil
+}
+
+// extraFstabEntriesContent returns the extra fstab entries of the template,
+// validated when it is loaded, as appended to /etc/fstab.
+func extraFstabEntriesContent(entries []string) string {
+	var b strings.Builder
+	b.WriteString("# Added from systemConfig.extraFstabEntries of the image template\n")
+	for _, entry := range entries {
+		b.WriteString(strings.TrimSpace(entry) + "\n")
+	}
+	return b.String()
+}
+
+// readOnlyMountOptions returns the fstab mount options with "ro" added, unless
+// they already have it.
+func readOnlyMountOptions(options string) string {
+	for _, option := range strings.Split(options, ",") {
+		if strings.TrimSpace(option) == "ro" {
+			return options
+		}
+	}
+	return options + ",ro"
+}
+
+// ensureNothingMountedUnder returns an error if any path under dir is mounted.
+func ensureNothingMountedUnder(dir string) error {
+	mountedPaths, err := mount.GetMountSubPathList(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check mounts under %s: %w", dir, err)
+	}
+	if len(mountedPaths) > 0 {
+		return fmt.Errorf("paths under %s are still mounted: %s", dir, strings.Join(mountedPaths, ", "))
+	}
+	return nil
+}
+
+// prepareCompressedInstallRoot empties installRoot, which is a plain directory
+// rather than the mounted root partition when the root filesystem is built
+// after the installation, so that nothing left from an earlier build ends up
+// in the image.
+func prepareCompressedInstallRoot(installRoot string) error {
+	return emptyInstallRoot(installRoot)
+}
+
+// emptyInstallRoot removes everything in installRoot, refusing to do so while
+// anything is mounted under it.
+func emptyInstallRoot(installRoot string) error {
+	if err := ensureNothingMountedUnder(installRoot); err != nil {
+		return err
+	}
+	if _, err := shell.ExecCmd("rm -rf "+installRoot, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", installRoot, err)
+	}
+	if _, err := shell.ExecCmd("mkdir -p "+installRoot, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to create %s: %w", installRoot, err)
+	}
+	return nil
+}
+
+// compressedRootfsCmd returns the command that builds a filesystem of type
+// fsType with the content of installRoot on the partition device partDev.
+func compressedRootfsCmd(fsType, installRoot, partDev, fsLabel string) (string, error) {
+	switch fsType {
+	case config.FsTypeSquashfs:
+		if fsLabel != "" {
+			log.Warnf("squashfs has no filesystem label, ignoring fsLabel %q", fsLabel)
+		}
+		return fmt.Sprintf("mksquashfs %s %s -noappend -comp zstd -xattrs", installRoot, partDev), nil
+	case config.FsTypeErofs:
+		labelFlag := ""
+		if fsLabel != "" {
+			labelFlag = " -L " + fsLabel
+		}
+		return fmt.Sprintf("mkfs.erofs -zlz4hc%s %s %s", labelFlag, partDev, installRoot), nil
+	}
+	return "", fmt.Errorf("unsupported compressed filesystem type: %s", fsType)
+}
+
+// buildCompressedRootfs builds the compressed root filesystem of the image
+// from installRoot on the root partition. Nothing may be mounted under
+// installRoot anymore.
+func buildCompressedRootfs(installRoot string, diskPathIdMap map[string]string, template *config.ImageTemplate) error {
+	var rootPartition config.PartitionInfo
+	var rootDev string
+	for _, partition := range template.GetDiskConfig().Partitions {
+		if partition.MountPoint == "/" {
+			rootPartition, rootDev = partition, diskPathIdMap[partition.ID]
+			break
+		}
+	}
+	if rootDev == "" {
+		return fmt.Errorf("no root partition found in diskPathIdMap")
+	}
+
+	cmdStr, err := compressedRootfsCmd(rootPartition.FsType, installRoot, rootDev, rootPartition.FsLabel)
+	if err != nil {
+		return err
+	}
+	tool := strings.Fields(cmdStr)[0]
+	exists, err := shell.IsCommandExist(tool, shell.HostPath)
+	if err != nil {
+		return fmt.Errorf("failed to check if %s exists: %w", tool, err)
+	}
+	if !exists {
+		return fmt.Errorf("%s not found on the host, install it to build %s root filesystems", tool, rootPartition.FsType)
+	}
+	if err := ensureNothingMountedUnder(installRoot); err != nil {
+		return err
+	}
+
+	if _, err := shell.ExecCmdWithStream(cmdStr, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to build %s root filesystem on %s: %v", rootPartition.FsType, rootDev, err)
+		return fmt.Errorf("failed to build %s root filesystem on %s: %w", rootPartition.FsType, rootDev, err)
+	}
 	return nil
 }
 
@@ -1106,39 +2022,53 @@ func createResolvConfSymlink(installRoot string, template *config.ImageTemplate)
 	return nil
 }
 
-func buildImageUKI(installRoot string, template *config.ImageTemplate) error {
+func buildImageUKI(installRoot, pkgType string, template *config.ImageTemplate) error {
 	bootloaderConfig := template.GetBootloaderConfig()
 	if bootloaderConfig.Provider == "systemd-boot" {
 		// 1. Update initramfs
-		kernelVersion, err := getKernelVersion(installRoot)
+		kernelVersion, err := getTargetKernelVersion(installRoot, pkgType, template)
 		if err != nil {
 			return fmt.Errorf("failed to get kernel version: %w", err)
 		}
 
 		log.Debugf("Kernel version:%s", kernelVersion)
 
-		if err := updateInitramfs(installRoot, kernelVersion, template); err != nil {
-			return fmt.Errorf("failed to update initramfs: %w", err)
+		initramfsStamp := ukiInputsStampPath(installRoot, "initramfs-"+kernelVersion)
+		initramfsDigest := initramfsInputsDigest(installRoot, kernelVersion, template)
+		if !template.ForceUKI && initramfsUpToDate(installRoot, kernelVersion, initramfsStamp, initramfsDigest) {
+			log.Infof("Initramfs for kernel %s is up to date, skipping regeneration", kernelVersion)
+		} else {
+			if err := updateInitramfs(installRoot, kernelVersion, template); err != nil {
+				return fmt.Errorf("failed to update initramfs: %w", err)
+			}
+			writeUKIInputsStamp(initramfsStamp, initramfsDigest,
+				filepath.Join(installRoot, "boot", fmt.Sprintf("initramfs-%s.img", kernelVersion)))
+			log.Debug("Initramfs updated successfully")
 		}
 
-		log.Debug("Initramfs updated successfully")
-
 		// 2. Build UKI with ukify
 		kernelPath := filepath.Join("/boot", "vmlinuz-"+kernelVersion)
 		initrdPath := fmt.Sprintf("/boot/initramfs-%s.img", kernelVersion)
+		cmdlineFile := filepath.Join("/boot", "cmdline.conf")
+
+		espDir := "/boot/efi"
+		outputPath := filepath.Join(espDir, "EFI", "Linux", "linux.efi")
+		log.Debugf("UKI Path:", outputPath)
+
+		ukiStamp := ukiInputsStampPath(installRoot, "uki")
+		ukiDigest := ukiInputsDigest(installRoot, kernelPath, initrdPath, cmdlineFile, template)
+		if !template.ForceUKI && ukiUpToDate(installRoot, outputPath, ukiStamp, ukiDigest, template) {
+			log.Infof("UKI %s is up to date, skipping rebuild", outputPath)
+			return copyUKIBootloader(installRoot, espDir, template)
+		}
 
 		espRoot := installRoot
-		espDir, err := prepareESPDir(espRoot)
+		espDir, err = prepareESPDir(espRoot)
 		if err != nil {
 			return fmt.Errorf("failed to prepare ESP directory: %w", err)
 		}
 		log.Debugf("Succesfully Creating EspPath:", espDir)
 
-		outputPath := filepath.Join(espDir, "EFI", "Linux", "linux.efi")
-		log.Debugf("UKI Path:", outputPath)
-
-		cmdlineFile := filepath.Join("/boot", "cmdline.conf")
-
 		// do checks for file paths
 		if _, err := os.Stat(installRoot); err == nil {
 			log.Infof("Install Root Exists at %s", installRoot)
@@ -1173,41 +2103,203 @@ func buildImageUKI(installRoot string, template *config.ImageTemplate) error {
 		if err := buildUKI(installRoot, kernelPath, initrdPath, cmdlineFile, outputPath, template); err != nil {
 			return fmt.Errorf("failed to build UKI: %w", err)
 		}
+		writeUKIInputsStamp(ukiStamp, ukiDigest, filepath.Join(installRoot, outputPath))
 		log.Debugf("UKI created successfully on:", outputPath)
-		log.Infof("Target architecture is %v ", template.Target.Arch)
 
-		srcBootloader := ""
-		dstBootloader := ""
+		return copyUKIBootloader(installRoot, espDir, template)
+	} else {
+		log.Infof("Skipping UKI build for image: %s, bootloader provider is not systemd-boot", template.GetImageName())
+	}
 
-		switch template.Target.Arch {
-		case "x86_64":
-			log.Infof("Target architecture is x86_64, proceeding with bootloader copy")
-			// 3. Copy systemd-bootx64.efi to ESP/EFI/BOOT/BOOTX64.EFI
-			srcBootloader = filepath.Join("usr", "lib", "systemd", "boot", "efi", "systemd-bootx64.efi")
-			dstBootloader = filepath.Join(espDir, "EFI", "BOOT", "BOOTX64.EFI")
-		case "aarch64":
-			log.Infof("Target architecture is ARM64, proceeding with bootloader copy")
-			// 3. Copy systemd-bootx64.efi to ESP/EFI/BOOT/BOOT64.EFI
-			srcBootloader = filepath.Join("usr", "lib", "systemd", "boot", "efi", "systemd-bootaa64.efi")
-			dstBootloader = filepath.Join(espDir, "EFI", "BOOT", "BOOTAA64.EFI")
-		default:
-			log.Infof("Skipping bootloader copy for architecture: %s", template.Target.Arch)
-			return nil
+	return nil
+}
+
+// copyUKIBootloader copies the systemd-boot EFI binary of the target
+// architecture to the default boot path of the ESP.
+func copyUKIBootloader(installRoot, espDir string, template *config.ImageTemplate) error {
+	log.Infof("Target architecture is %v ", template.Target.Arch)
+
+	srcBootloader := ""
+	dstBootloader := ""
+
+	switch template.Target.Arch {
+	case "x86_64":
+		log.Infof("Target architecture is x86_64, proceeding with bootloader copy")
+		// 3. Copy systemd-bootx64.efi to ESP/EFI/BOOT/BOOTX64.EFI
+		srcBootloader = filepath.Join("usr", "lib", "systemd", "boot", "efi", "systemd-bootx64.efi")
+		dstBootloader = filepath.Join(espDir, "EFI", "BOOT", "BOOTX64.EFI")
+	case "aarch64":
+		log.Infof("Target architecture is ARM64, proceeding with bootloader copy")
+		// 3. Copy systemd-bootx64.efi to ESP/EFI/BOOT/BOOT64.EFI
+		srcBootloader = filepath.Join("usr", "lib", "systemd", "boot", "efi", "systemd-bootaa64.efi")
+		dstBootloader = filepath.Join(espDir, "EFI", "BOOT", "BOOTAA64.EFI")
+	default:
+		log.Infof("Skipping bootloader copy for architecture: %s", template.Target.Arch)
+		return nil
+	}
+	if err := copyBootloader(installRoot, srcBootloader, dstBootloader); err != nil {
+		signedSrc := srcBootloader + ".signed"
+		log.Warnf("Primary bootloader copy failed (%v). Retrying with signed EFI: %s", err, signedSrc)
+
+		if err2 := copyBootloader(installRoot, signedSrc, dstBootloader); err2 != nil {
+			return fmt.Errorf("failed to copy bootloader (unsigned: %s -> %s): %w; and signed attempt (signed: %s -> %s) failed: %v", srcBootloader, dstBootloader, err, signedSrc, dstBootloader, err2)
+		}
+	}
+	log.Debugf("BuildImage UKI: Bootloader copied successfully to %s, from %s:", dstBootloader, srcBootloader)
+	return nil
+}
+
+// ukiInputsStampPath returns the file recording the inputs an initramfs or UKI
+// of installRoot was last built from, and the file built from them. Stamps are
+// kept next to the install root so they never end up in the image.
+func ukiInputsStampPath(installRoot, name string) string {
+	return filepath.Join(filepath.Dir(installRoot), ".uki-inputs", filepath.Base(installRoot), name+".sha256")
+}
+
+// fileDigest returns the SHA-256 of the content of path, or "" if it cannot
+// be read.
+func fileDigest(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeUKIInputsStamp records in stampPath the digest of the inputs and of
+// outputPath, the file built from them. A missing stamp only costs a rebuild
+// next time, so failures are logged and otherwise ignored.
+func writeUKIInputsStamp(stampPath, digest, outputPath string) {
+	outputDigest := fileDigest(outputPath)
+	if outputDigest == "" {
+		log.Warnf("Failed to read %s, not recording the inputs it was built from", outputPath)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(stampPath), 0o755); err != nil {
+		log.Warnf("Failed to create UKI inputs stamp directory %s: %v", filepath.Dir(stampPath), err)
+		return
+	}
+	if err := os.WriteFile(stampPath, []byte(digest+" "+outputDigest+"\n"), 0o644); err != nil {
+		log.Warnf("Failed to write UKI inputs stamp %s: %v", stampPath, err)
+	}
+}
+
+// stampMatches reports whether stampPath records digest, and outputPath is
+// still the file that was built from it. A file written by anything else, such
+// as the initramfs a kernel package generates when it is installed into a new
+// root filesystem, does not match a stamp left by an earlier build.
+func stampMatches(stampPath, digest, outputPath string) bool {
+	data, err := os.ReadFile(stampPath)
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] != digest {
+		return false
+	}
+	return fields[1] == fileDigest(outputPath)
+}
+
+// digestInputs hashes the given values and the content of the given files
+// below installRoot. A missing file is hashed as such, so its later
+// appearance changes the digest.
+func digestInputs(installRoot string, values []string, files []string) string {
+	h := sha256.New()
+	for _, value := range values {
+		fmt.Fprintf(h, "value:%s\n", value)
+	}
+	for _, f := range files {
+		fmt.Fprintf(h, "file:%s\n", f)
+		fh, err := os.Open(filepath.Join(installRoot, f))
+		if err != nil {
+			fmt.Fprintf(h, "missing\n")
+			continue
 		}
-		if err := copyBootloader(installRoot, srcBootloader, dstBootloader); err != nil {
-			signedSrc := srcBootloader + ".signed"
-			log.Warnf("Primary bootloader copy failed (%v). Retrying with signed EFI: %s", err, signedSrc)
+		_, err = io.Copy(h, fh)
+		fh.Close()
+		if err != nil {
+			fmt.Fprintf(h, "unreadable\n")
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// initramfsInputsDigest identifies the dracut invocation that builds the
+// initramfs of kernelVersion for template.
+func initramfsInputsDigest(installRoot, kernelVersion string, template *config.ImageTemplate) string {
+	return digestInputs(installRoot, []string{getInitramfsCmd(kernelVersion, template)},
+		[]string{filepath.Join("/boot", "vmlinuz-"+kernelVersion)})
+}
+
+// initramfsUpToDate reports whether the initramfs of kernelVersion is the one
+// built by the dracut invocation recorded in stampPath and is not older than
+// the installed kernel and its modules.
+func initramfsUpToDate(installRoot, kernelVersion, stampPath, digest string) bool {
+	initrdPath := filepath.Join(installRoot, "boot", fmt.Sprintf("initramfs-%s.img", kernelVersion))
+	initrdInfo, err := os.Stat(initrdPath)
+	if err != nil || initrdInfo.Size() == 0 {
+		return false
+	}
+	if !stampMatches(stampPath, digest, initrdPath) {
+		return false
+	}
+
+	kernelInfo, err := os.Stat(filepath.Join(installRoot, "boot", "vmlinuz-"+kernelVersion))
+	if err != nil || initrdInfo.ModTime().Before(kernelInfo.ModTime()) {
+		return false
+	}
 
-			if err2 := copyBootloader(installRoot, signedSrc, dstBootloader); err2 != nil {
-				return fmt.Errorf("failed to copy bootloader (unsigned: %s -> %s): %w; and signed attempt (signed: %s -> %s) failed: %v", srcBootloader, dstBootloader, err, signedSrc, dstBootloader, err2)
+	for _, modulesDir := range []string{"lib/modules", "usr/lib/modules"} {
+		dir := filepath.Join(installRoot, modulesDir, kernelVersion)
+		if _, err := os.Lstat(dir); err != nil {
+			continue
+		}
+		newer := false
+		walkErr := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.ModTime().After(initrdInfo.ModTime()) {
+				newer = true
+				return filepath.SkipAll
 			}
+			return nil
+		})
+		if walkErr != nil || newer {
+			return false
 		}
-		log.Debugf("BuildImage UKI: Bootloader copied successfully to %s, from %s:", dstBootloader, srcBootloader)
-	} else {
-		log.Infof("Skipping UKI build for image: %s, bootloader provider is not systemd-boot", template.GetImageName())
 	}
+	return true
+}
 
-	return nil
+// ukiInputsDigest identifies the kernel, initramfs, command line, EFI stub and
+// os-release a UKI is built from.
+func ukiInputsDigest(installRoot, kernelPath, initrdPath, cmdlineFile string, template *config.ImageTemplate) string {
+	stubPath, err := getUkifyStubPath(template.Target.Arch)
+	if err != nil {
+		stubPath = ""
+	}
+	return digestInputs(installRoot, []string{template.Target.Arch},
+		[]string{kernelPath, initrdPath, cmdlineFile, stubPath, "/etc/os-release"})
+}
+
+// ukiUpToDate reports whether the UKI at outputPath was built from the inputs
+// recorded in stampPath. Images with immutability enabled are always rebuilt
+// because their command line embeds the dm-verity root hash of the current
+// root filesystem.
+func ukiUpToDate(installRoot, outputPath, stampPath, digest string, template *config.ImageTemplate) bool {
+	if template.IsImmutabilityEnabled() {
+		return false
+	}
+	if info, err := os.Stat(filepath.Join(installRoot, outputPath)); err != nil || info.Size() == 0 {
+		return false
+	}
+	return stampMatches(stampPath, digest, filepath.Join(installRoot, outputPath))
 }
 
 // Helper to get the current kernel version from the rootfs
@@ -1227,8 +2319,25 @@ func getKernelVersion(installRoot string) (string, error) {
 	return "", fmt.Errorf("kernel image not found in %s", kernelDir)
 }
 
-// Helper to update initramfs for the given kernel version
-func updateInitramfs(installRoot, kernelVersion string, template *config.ImageTemplate) error {
+// getTargetKernelVersion returns the version of the kernel the UKI is built
+// for: the one installed by systemConfig.kernel.package if set, otherwise the
+// current kernel of the rootfs.
+func getTargetKernelVersion(installRoot, pkgType string, template *config.ImageTemplate) (string, error) {
+	kernelPkg := template.GetKernel().Package
+	if kernelPkg == "" {
+		return getKernelVersion(installRoot)
+	}
+	kernelVersion, err := imageboot.KernelPackageVersion(installRoot, pkgType, ospackage.ParsePackageSpec(kernelPkg).Name)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Targeting kernel %s of kernel package %s", kernelVersion, kernelPkg)
+	return kernelVersion, nil
+}
+
+// getInitramfsCmd returns the dracut command that builds the initramfs of
+// kernelVersion for template.
+func getInitramfsCmd(kernelVersion string, template *config.ImageTemplate) string {
 	// Other distributions use initramfs- prefix
 	initrdPath := fmt.Sprintf("/boot/initramfs-%s.img", kernelVersion)
 
@@ -1261,14 +2370,29 @@ func updateInitramfs(installRoot, kernelVersion string, template *config.ImageTe
 		cmdParts = append(cmdParts, fmt.Sprintf("--add-drivers '%s'", extraModules))
 	}
 
+	if compression := template.SystemConfig.Initramfs.Compression; compression != "" {
+		cmdParts = append(cmdParts, "--compress", compression)
+	}
+
 	// Add kernel version and output path
 	cmdParts = append(cmdParts, "--kver", kernelVersion)
 	cmdParts = append(cmdParts, initrdPath)
 
+	return strings.Join(cmdParts, " ")
+}
+
+// Helper to update initramfs for the given kernel version
+func updateInitramfs(installRoot, kernelVersion string, template *config.ImageTemplate) error {
+	if compression := template.SystemConfig.Initramfs.Compression; compression != "" {
+		if err := imageboot.CheckInitramfsCompression(installRoot, kernelVersion, compression); err != nil {
+			return fmt.Errorf("invalid initramfs compression: %w", err)
+		}
+	}
+
 	// Execute single dracut command
-	cmd := strings.Join(cmdParts, " ")
+	cmd := getInitramfsCmd(kernelVersion, template)
 	log.Debugf("\nInitramfs updated cmd string is: %s \n", cmd)
-	_, err := shell.ExecCmd(cmd, true, installRoot, nil)
+	_, err := shell.ExecCmdWithStage("initramfs", cmd, true, installRoot, nil)
 	if err != nil {
 		if template.IsImmutabilityEnabled() {
 			log.Errorf("Failed to update initramfs with veritysetup and USB drivers: %v", err)
@@ -1559,7 +2683,9 @@ func buildUKI(installRoot, kernelPath, initrdPath, cmdlineFile, outputPath strin
 	if template.IsImmutabilityEnabled() {
 		// Set TMPDIR environment variable to use the mounted tmpfs
 		envVars := []string{"TMPDIR=/tmp"}
-		output, execErr := shell.ExecCmd(cmd, true, installRoot, envVars)
+		output, execErr := shell.WithRetry(func() (string, error) {
+			return shell.ExecCmdWithStage("uki", cmd, true, installRoot, envVars)
+		})
 		if execErr != nil {
 			log.Errorf("Failed to build UKI with veritysetup: %v", execErr)
 			err = wrapUkifyErr("failed to build UKI with veritysetup", execErr, output)
@@ -1567,7 +2693,9 @@ func buildUKI(installRoot, kernelPath, initrdPath, cmdlineFile, outputPath strin
 		installRoot = backInstallRoot
 		removeVerityTmp(installRoot)
 	} else {
-		output, execErr := shell.ExecCmd(cmd, true, installRoot, nil)
+		output, execErr := shell.WithRetry(func() (string, error) {
+			return shell.ExecCmdWithStage("uki", cmd, true, installRoot, nil)
+		})
 		if execErr != nil {
 			log.Errorf("non-immutable: Failed to build UKI: %v", execErr)
 			err = wrapUkifyErr("failed to build UKI", execErr, output)
@@ -1649,8 +2777,12 @@ func createUser(installRoot string, template *config.ImageTemplate) error {
 			}
 		}
 
-		// Set password if provided
-		if user.Password != "" {
+		// Lock the password of locked accounts, set it if provided
+		if user.Locked {
+			if err := lockUserPassword(installRoot, user.Name); err != nil {
+				return fmt.Errorf("failed to lock password for user %s: %w", user.Name, err)
+			}
+		} else if user.Password != "" {
 			if err := setUserPassword(installRoot, user); err != nil {
 				return fmt.Errorf("failed to set password for user %s: %w", user.Name, err)
 			}
@@ -1761,7 +2893,7 @@ func setUserPassword(installRoot string, user config.UserConfig) error {
 		// Check if password is already in hashed format (starts with $)
 		if strings.HasPrefix(user.Password, "$") {
 			// Password is already hashed, use usermod to set it directly
-			usermodCmd := fmt.Sprintf("usermod -p '%s' %s", user.Password, user.Name)
+			usermodCmd := fmt.Sprintf("usermod -p %s %s", shell.SingleQuote(user.Password), user.Name)
 			if _, err := shell.ExecCmd(usermodCmd, true, installRoot, nil); err != nil {
 				// log.Errorf("Failed to set hashed password for user %s: %v", user.Name, err)
 				// return fmt.Errorf("failed to set hashed password for user %s: %w", user.Name, err)
@@ -1775,7 +2907,7 @@ func setUserPassword(installRoot string, user config.UserConfig) error {
 				return fmt.Errorf("failed to hash password for user %s: %w", user.Name, err)
 			}
 
-			usermodCmd := fmt.Sprintf("usermod -p '%s' %s", hashedPassword, user.Name)
+			usermodCmd := fmt.Sprintf("usermod -p %s %s", shell.SingleQuote(hashedPassword), user.Name)
 			if _, err := shell.ExecCmd(usermodCmd, true, installRoot, nil); err != nil {
 				// log.Errorf("Failed to set hashed password for user %s: %v", user.Name, err)
 				// return fmt.Errorf("failed to set hashed password for user %s: %w", user.Name, err)
@@ -1798,24 +2930,25 @@ func setUserPassword(installRoot string, user config.UserConfig) error {
 	return nil
 }
 
-// Helper function to hash password using specified algorithm
+// Helper function to hash password using specified algorithm. The password is
+// passed as a single-quoted argument, so any character it contains is kept.
 func hashPassword(password, hashAlgo, installRoot string) (string, error) {
 	var cmd string
 
 	switch strings.ToLower(hashAlgo) {
 	case "sha512":
 		// Use openssl to generate SHA-512 hash
-		cmd = fmt.Sprintf("openssl passwd -6 '%s'", password)
+		cmd = fmt.Sprintf("openssl passwd -6 %s", shell.SingleQuote(password))
 	case "sha256":
 		// Use openssl to generate SHA-256 hash
-		cmd = fmt.Sprintf("openssl passwd -5 '%s'", password)
+		cmd = fmt.Sprintf("openssl passwd -5 %s", shell.SingleQuote(password))
 	case "md5":
 		// Use openssl to generate MD5 hash (not recommended for production)
-		cmd = fmt.Sprintf("openssl passwd -1 '%s'", password)
+		cmd = fmt.Sprintf("openssl passwd -1 %s", shell.SingleQuote(password))
 	case "bcrypt":
 		// Use python3 to generate bcrypt hash
-		pythonScript := fmt.Sprintf("import bcrypt; print(bcrypt.hashpw(b'%s', bcrypt.gensalt()).decode())", password)
-		cmd = fmt.Sprintf("python3 -c \"%s\"", pythonScript)
+		pythonScript := "import bcrypt, sys; print(bcrypt.hashpw(sys.argv[1].encode(), bcrypt.gensalt()).decode())"
+		cmd = fmt.Sprintf("python3 -c %s %s", shell.SingleQuote(pythonScript), shell.SingleQuote(password))
 	default:
 		return "", fmt.Errorf("unsupported hash algorithm: %s", hashAlgo)
 	}
@@ -1907,9 +3040,13 @@ func (imageOs *ImageOs) generateSBOM(installRoot string, template *config.ImageT
 
 	log.Infof("SBOM raw data (installed=%d, downloaded=%d, final=%d)", len(installRootPkgs), len(downloadedPkgs), len(finalPkgs))
 
+	if pkgType == "deb" {
+		addDebCopyrightLicenses(installRoot, finalPkgs)
+	}
+
 	// Generate SPDX manifest, generated in temp directory
 	spdxFile := filepath.Join(config.TempDir(), manifest.DefaultSPDXFile)
-	if err := manifest.WriteSPDXToFile(finalPkgs, spdxFile); err != nil {
+	if err := manifest.WriteSPDXToFile(finalPkgs, spdxFile, template.HostToolVersions); err != nil {
 		log.Warnf("SPDX SBOM creation error: %v", err)
 	}
 	log.Infof("SPDX file created at %s", spdxFile)
@@ -1920,9 +3057,54 @@ func (imageOs *ImageOs) generateSBOM(installRoot string, template *config.ImageT
 		// Don't fail the build if SBOM copy fails, just log warning
 	}
 
+	if err := auditImageLicenses(finalPkgs, template); err != nil {
+		return "", err
+	}
+
 	return result, nil
 }
 
+// addDebCopyrightLicenses fills in the license of the deb packages in pkgs
+// whose repository metadata had none from the License fields of their
+// machine-readable copyright file in installRoot.
+func addDebCopyrightLicenses(installRoot string, pkgs []ospackage.PackageInfo) {
+	for i := range pkgs {
+		if pkgs[i].License != "" {
+			continue
+		}
+		copyrightPath := filepath.Join(installRoot, "usr", "share", "doc", pkgs[i].Name, "copyright")
+		content, err := os.ReadFile(copyrightPath)
+		if err != nil {
+			log.Debugf("No copyright file for package %s: %v", pkgs[i].Name, err)
+			continue
+		}
+		pkgs[i].License = manifest.ParseCopyrightLicense(string(content))
+	}
+}
+
+// auditImageLicenses writes the license report of the packages installed in
+// the image and fails if any of them has a license class denied by the
+// license policy of template.
+func auditImageLicenses(pkgs []ospackage.PackageInfo, template *config.ImageTemplate) error {
+	report := manifest.BuildLicenseReport(pkgs)
+	for _, class := range manifest.LicenseClassNames {
+		if names := report.ByClass[class]; len(names) > 0 {
+			log.Infof("License class %s: %d packages", class, len(names))
+		}
+	}
+
+	reportFile := filepath.Join(config.TempDir(), manifest.DefaultLicenseReportFile)
+	if err := manifest.WriteLicenseReportToFile(report, reportFile); err != nil {
+		log.Warnf("License report creation error: %v", err)
+	}
+
+	if err := manifest.CheckLicensePolicy(report, template.SystemConfig.LicensePolicy.Deny); err != nil {
+		log.Errorf("License policy check failed: %v", err)
+		return fmt.Errorf("license policy check failed: %w", err)
+	}
+	return nil
+}
+
 // isSymlink checks if a given path is a symbolic link
 func isSymlink(path string) (bool, error) {
 	fileInfo, err := os.Lstat(path)
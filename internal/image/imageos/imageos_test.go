@@ -1,17 +1,32 @@
 package imageos
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/chroot"
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/config/manifest"
+	"github.com/open-edge-platform/image-composer-tool/internal/config/version"
 	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/rpmutils"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
 )
 
 // Helper function to create a test ImageTemplate
@@ -113,10 +128,10 @@ func (m *MockChrootEnv) InitChrootEnv(targetOs, targetDist, targetArch string) e
 	return nil
 }
 func (m *MockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string) error { return nil }
-func (m *MockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *MockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return nil
 }
-func (m *MockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *MockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return nil
 }
 func (m *MockChrootEnv) UpdateSystemPkgs(template *config.ImageTemplate) error { return nil }
@@ -439,6 +454,16 @@ func TestImageOsPackageOrderingRpm(t *testing.T) {
 			packages: []string{"curl", "filesystem-base", "filesystem-extra", "vim"},
 			expected: []string{"filesystem-base", "filesystem-extra", "curl", "vim"},
 		},
+		{
+			name:     "version pinned filesystem packages",
+			packages: []string{"curl", "initramfs=1.2-3", "filesystem=3.18-1", "vim"},
+			expected: []string{"filesystem=3.18-1", "curl", "vim", "initramfs=1.2-3"},
+		},
+		{
+			name:     "names only sharing a prefix",
+			packages: []string{"filesystemd", "curl", "initramfstools"},
+			expected: []string{"filesystemd", "curl", "initramfstools"},
+		},
 		{
 			name:     "no special packages",
 			packages: []string{"curl", "wget", "vim"},
@@ -497,6 +522,16 @@ func TestImageOsPackageOrderingDeb(t *testing.T) {
 			packages: []string{"dracut", "systemd-boot"},
 			expected: []string{"dracut", "systemd-boot"},
 		},
+		{
+			name:     "versioned and arch qualified packages",
+			packages: []string{"dracut-core:amd64", "curl", "systemd-boot (>= 252)", "base-files=13.1"},
+			expected: []string{"base-files=13.1", "curl", "dracut-core:amd64", "systemd-boot (>= 252)"},
+		},
+		{
+			name:     "names only sharing a prefix",
+			packages: []string{"dracutx", "base-filesystem", "curl"},
+			expected: []string{"dracutx", "base-filesystem", "curl"},
+		},
 		{
 			name:     "empty package list",
 			packages: []string{},
@@ -528,6 +563,45 @@ func TestImageOsPackageOrderingDeb(t *testing.T) {
 	}
 }
 
+// TestImageOsPackageOrderingProviderRules tests that provider-supplied install
+// order rules apply on top of the default filesystem/initramfs placement
+func TestImageOsPackageOrderingProviderRules(t *testing.T) {
+	rules := []config.InstallOrderRule{
+		{Prefix: "gpg-keys", Priority: -200},
+		{Prefix: "systemd", Priority: -50},
+		{Prefix: "filesystem-extras", Priority: 0},
+	}
+
+	t.Run("rpm", func(t *testing.T) {
+		template := &config.ImageTemplate{
+			SystemConfig: config.SystemConfig{
+				Packages: []string{"curl", "initramfs", "systemd-networkd", "filesystem", "filesystem-extras", "gpg-keys", "vim", "systemd"},
+			},
+			InstallOrderRules: rules,
+		}
+		expected := []string{"gpg-keys", "filesystem", "systemd-networkd", "systemd", "curl", "filesystem-extras", "vim", "initramfs"}
+		if result := getRpmPkgInstallList(template); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected order %v, got %v", expected, result)
+		}
+	})
+
+	t.Run("deb", func(t *testing.T) {
+		template := &config.ImageTemplate{
+			SystemConfig: config.SystemConfig{
+				Packages: []string{"curl", "gpg-keys=1.0", "base-files", "systemd"},
+			},
+			KernelPkgList:     []string{"dracut-core"},
+			BootloaderPkgList: []string{"systemd-boot"},
+			InstallOrderRules: rules,
+		}
+		// systemd-boot is in the systemd family, but the more specific default rule keeps it last
+		expected := []string{"gpg-keys=1.0", "base-files", "systemd", "curl", "dracut-core", "systemd-boot"}
+		if result := getDebPkgInstallList(template); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected order %v, got %v", expected, result)
+		}
+	})
+}
+
 // TestImageOsInstallInitrdWithoutSystemDeps tests InstallInitrd method behavior without system dependencies
 func TestImageOsInstallInitrdWithoutSystemDeps(t *testing.T) {
 	// This test focuses on the method call structure and error handling
@@ -1659,6 +1733,59 @@ func TestUpdateInitramfsVariants(t *testing.T) {
 		}
 	})
 
+	t.Run("compression", func(t *testing.T) {
+		installRoot := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(installRoot, "boot"), 0755); err != nil {
+			t.Fatalf("failed to create boot directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(installRoot, "boot", "config-6.1.0"), []byte("CONFIG_RD_XZ=y\n"), 0644); err != nil {
+			t.Fatalf("failed to write kernel config: %v", err)
+		}
+		recorder := &recordingExecutor{mockCommands: []shell.MockCommand{
+			{Pattern: `command -v xz`, Output: "/usr/bin/xz\n", Error: nil},
+		}}
+		shell.Default = recorder
+
+		template := &config.ImageTemplate{
+			Target:       config.TargetInfo{OS: "azure-linux"},
+			SystemConfig: config.SystemConfig{Initramfs: config.Initramfs{Compression: "xz"}},
+		}
+
+		if err := updateInitramfs(installRoot, "6.1.0", template); err != nil {
+			t.Fatalf("updateInitramfs() returned unexpected error: %v", err)
+		}
+		if !recorder.hasCommand("dracut --force --no-hostonly --verbose --add systemd --compress xz --kver 6.1.0 /boot/initramfs-6.1.0.img") {
+			t.Errorf("expected dracut to compress the initramfs with xz, got: %v", recorder.commands)
+		}
+	})
+
+	t.Run("compression unsupported by kernel", func(t *testing.T) {
+		installRoot := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(installRoot, "boot"), 0755); err != nil {
+			t.Fatalf("failed to create boot directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(installRoot, "boot", "config-6.1.0"), []byte("# CONFIG_RD_LZ4 is not set\n"), 0644); err != nil {
+			t.Fatalf("failed to write kernel config: %v", err)
+		}
+		recorder := &recordingExecutor{mockCommands: []shell.MockCommand{
+			{Pattern: `command -v lz4`, Output: "/usr/bin/lz4\n", Error: nil},
+		}}
+		shell.Default = recorder
+
+		template := &config.ImageTemplate{
+			Target:       config.TargetInfo{OS: "azure-linux"},
+			SystemConfig: config.SystemConfig{Initramfs: config.Initramfs{Compression: "lz4"}},
+		}
+
+		err := updateInitramfs(installRoot, "6.1.0", template)
+		if err == nil || !strings.Contains(err.Error(), "CONFIG_RD_LZ4 is not enabled") {
+			t.Fatalf("expected unsupported compression error, got: %v", err)
+		}
+		if recorder.hasCommand("dracut") {
+			t.Errorf("expected dracut not to run, got: %v", recorder.commands)
+		}
+	})
+
 	t.Run("non-immutable command failure", func(t *testing.T) {
 		mockCommands := []shell.MockCommand{
 			{
@@ -2011,6 +2138,350 @@ func TestInstallImagePkgs(t *testing.T) {
 	t.Log("installImagePkgs test completed")
 }
 
+// shellInstallMockChrootEnv installs packages through the shell so tests can
+// make single installs fail with a MockExecutor.
+type shellInstallMockChrootEnv struct {
+	MockChrootEnv
+}
+
+func (m *shellInstallMockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
+	if output, err := shell.ExecCmd("tdnf install "+packageName, true, shell.HostPath, nil); err != nil {
+		return &chroot.PackageInstallError{Package: packageName, Output: output, Err: err}
+	}
+	return nil
+}
+
+// TestInstallImagePkgs_ContinueOnPkgError tests that a failed install either
+// stops the install or, with ContinueOnPkgError, is reported together with
+// every other failed package
+func TestInstallImagePkgs_ContinueOnPkgError(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name             string
+		continueOnError  bool
+		expectedInstalls []string
+		expectedErrors   []string
+		unexpectedErrors []string
+	}{
+		{
+			name:             "fail fast",
+			continueOnError:  false,
+			expectedInstalls: []string{"filesystem-base", "curl", "wget"},
+			expectedErrors:   []string{"failed to install package wget", "no match for wget"},
+			unexpectedErrors: []string{"vim"},
+		},
+		{
+			name:             "continue",
+			continueOnError:  true,
+			expectedInstalls: []string{"filesystem-base", "curl", "wget", "vim", "initramfs-tools"},
+			expectedErrors: []string{
+				"failed to install 2 of 5 packages",
+				"wget: failed to install package wget",
+				"no match for wget",
+				"initramfs-tools: failed to install package initramfs-tools",
+				"initramfs-tools: conflicts with dracut",
+			},
+			unexpectedErrors: []string{"curl:", "vim:", "filesystem-base:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockExecutor := shell.NewMockExecutor([]shell.MockCommand{
+				{Pattern: "rpm --root", Output: "", Error: nil},
+				{Pattern: "mkdir -p", Output: "", Error: nil},
+				{Pattern: "tdnf install wget", Output: "", Error: fmt.Errorf("no match for wget")},
+				{Pattern: "tdnf install initramfs-tools", Output: "", Error: fmt.Errorf("initramfs-tools: conflicts with dracut")},
+				{Pattern: "tdnf install", Output: "", Error: nil},
+			})
+			recorder := &installRecorder{MockExecutor: mockExecutor}
+			shell.Default = recorder
+
+			template := createTestImageTemplate()
+			template.ContinueOnPkgError = tt.continueOnError
+			imageOs := &ImageOs{
+				installRoot: filepath.Join(t.TempDir(), template.SystemConfig.Name),
+				chrootEnv:   &shellInstallMockChrootEnv{MockChrootEnv{pkgType: "rpm", chrootRoot: shell.HostPath}},
+				template:    template,
+			}
+
+			err := imageOs.installImagePkgs(imageOs.GetInstallRoot(), template)
+			if err == nil {
+				t.Fatal("Expected the package install to fail")
+			}
+			for _, expected := range tt.expectedErrors {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error to contain %q, got: %v", expected, err)
+				}
+			}
+			for _, unexpected := range tt.unexpectedErrors {
+				if strings.Contains(err.Error(), unexpected) {
+					t.Errorf("Expected error not to contain %q, got: %v", unexpected, err)
+				}
+			}
+			if strings.Join(recorder.installs, ",") != strings.Join(tt.expectedInstalls, ",") {
+				t.Errorf("Expected installs %v, got %v", tt.expectedInstalls, recorder.installs)
+			}
+		})
+	}
+}
+
+// TestInstallImagePkgs_BulkInstall tests that systemConfig.bulkInstall
+// installs each install order band in one transaction, in order, and retries
+// a failed transaction one package at a time
+func TestInstallImagePkgs_BulkInstall(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name             string
+		failingInstall   string
+		expectedInstalls []string
+		expectedError    string
+	}{
+		{
+			name:             "one transaction per band",
+			expectedInstalls: []string{"filesystem-base", "curl wget vim", "initramfs-tools"},
+		},
+		{
+			name:             "failed transaction retried per package",
+			failingInstall:   "tdnf install .*wget",
+			expectedInstalls: []string{"filesystem-base", "curl wget vim", "curl", "wget"},
+			expectedError:    "failed to install package wget",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCommands := []shell.MockCommand{
+				{Pattern: "rpm --root", Output: "", Error: nil},
+				{Pattern: "mkdir -p", Output: "", Error: nil},
+			}
+			if tt.failingInstall != "" {
+				mockCommands = append(mockCommands, shell.MockCommand{Pattern: tt.failingInstall, Error: fmt.Errorf("no match for wget")})
+			}
+			mockCommands = append(mockCommands, shell.MockCommand{Pattern: "tdnf install", Output: "", Error: nil})
+			recorder := &installRecorder{MockExecutor: shell.NewMockExecutor(mockCommands)}
+			shell.Default = recorder
+
+			template := createTestImageTemplate()
+			template.SystemConfig.BulkInstall = true
+			imageOs := &ImageOs{
+				installRoot: filepath.Join(t.TempDir(), template.SystemConfig.Name),
+				chrootEnv:   &shellInstallMockChrootEnv{MockChrootEnv{pkgType: "rpm", chrootRoot: shell.HostPath}},
+				template:    template,
+			}
+
+			err := imageOs.installImagePkgs(imageOs.GetInstallRoot(), template)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("Expected the bulk install to succeed, got: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expectedError, err)
+			}
+			if strings.Join(recorder.installs, ",") != strings.Join(tt.expectedInstalls, ",") {
+				t.Errorf("Expected installs %v, got %v", tt.expectedInstalls, recorder.installs)
+			}
+		})
+	}
+}
+
+func TestPkgInstallTransactions(t *testing.T) {
+	pkgs := []string{"base-files", "bash", "apparmor_3.0_amd64", "curl", "vim", "dracut-core", "systemd-boot"}
+	solo := func(pkg string) bool { return pkg == "apparmor_3.0_amd64" || pkg == "dracut-core" }
+
+	tests := []struct {
+		name     string
+		bulk     bool
+		expected [][]string
+	}{
+		{
+			name:     "one package per transaction",
+			expected: [][]string{{"base-files"}, {"bash"}, {"apparmor_3.0_amd64"}, {"curl"}, {"vim"}, {"dracut-core"}, {"systemd-boot"}},
+		},
+		{
+			name:     "bulk",
+			bulk:     true,
+			expected: [][]string{{"base-files"}, {"bash"}, {"apparmor_3.0_amd64"}, {"curl", "vim"}, {"dracut-core"}, {"systemd-boot"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pkgInstallTransactions(pkgs, debInstallOrderRules, tt.bulk, solo)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected transactions %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// installRecorder records the packages a MockExecutor was asked to install
+// and remove, and whether it was asked to remove the install root
+type installRecorder struct {
+	*shell.MockExecutor
+	installs      []string
+	removes       []string
+	rootfsRemoved bool
+}
+
+func (r *installRecorder) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	if pkg, ok := strings.CutPrefix(cmdStr, "tdnf install "); ok {
+		r.installs = append(r.installs, pkg)
+	}
+	if strings.HasPrefix(cmdStr, "rm -rf ") {
+		r.rootfsRemoved = true
+	}
+	return r.MockExecutor.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (r *installRecorder) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	if args, ok := strings.CutPrefix(cmdStr, "tdnf remove "); ok {
+		r.removes = append(r.removes, strings.Split(args, " --")[0])
+	}
+	return r.MockExecutor.ExecCmdWithStream(cmdStr, sudo, chrootPath, envVal)
+}
+
+// TestInstallImagePkgs_Incremental tests that an incremental build applies only
+// the package delta to the rootfs kept by a previous build, and removes that
+// rootfs and installs every package when anything else changed
+func TestInstallImagePkgs_Incremental(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	allPkgs := []string{"filesystem-base", "curl", "wget", "vim", "initramfs-tools"}
+	tests := []struct {
+		name             string
+		incremental      bool
+		packages         []string
+		hostname         string
+		changePackageDB  bool
+		expectedInstalls []string
+		expectedRemoves  []string
+		expectedReset    bool
+	}{
+		{
+			name:             "one package added",
+			incremental:      true,
+			packages:         []string{"curl", "wget", "vim", "filesystem-base", "initramfs-tools", "htop"},
+			expectedInstalls: []string{"htop"},
+		},
+		{
+			name:            "one package removed",
+			incremental:     true,
+			packages:        []string{"curl", "wget", "filesystem-base", "initramfs-tools"},
+			expectedRemoves: []string{"vim"},
+		},
+		{
+			name:             "one package replaced",
+			incremental:      true,
+			packages:         []string{"curl", "wget", "nano", "filesystem-base", "initramfs-tools"},
+			expectedInstalls: []string{"nano"},
+			expectedRemoves:  []string{"vim"},
+		},
+		{
+			name:             "package version changed",
+			incremental:      true,
+			packages:         []string{"curl", "wget", "vim=9.1", "filesystem-base", "initramfs-tools"},
+			expectedInstalls: []string{"filesystem-base", "curl", "wget", "vim=9.1", "initramfs-tools"},
+			expectedReset:    true,
+		},
+		{
+			name:             "non-package config changed",
+			incremental:      true,
+			packages:         []string{"curl", "wget", "vim", "filesystem-base", "initramfs-tools"},
+			hostname:         "changed-host",
+			expectedInstalls: allPkgs,
+			expectedReset:    true,
+		},
+		{
+			name:             "package database changed",
+			incremental:      true,
+			packages:         []string{"curl", "wget", "vim", "filesystem-base", "initramfs-tools"},
+			changePackageDB:  true,
+			expectedInstalls: allPkgs,
+			expectedReset:    true,
+		},
+		{
+			name:             "incremental disabled",
+			incremental:      false,
+			packages:         []string{"curl", "wget", "vim", "filesystem-base", "initramfs-tools"},
+			expectedInstalls: allPkgs,
+			expectedReset:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockExecutor := shell.NewMockExecutor([]shell.MockCommand{
+				{Pattern: "^mount$", Output: "", Error: nil},
+				{Pattern: "rm -rf", Output: "", Error: nil},
+				{Pattern: "rpm --root", Output: "", Error: nil},
+				{Pattern: "mkdir -p", Output: "", Error: nil},
+				{Pattern: "tdnf install", Output: "", Error: nil},
+				{Pattern: "tdnf remove", Output: "", Error: nil},
+			})
+			recorder := &installRecorder{MockExecutor: mockExecutor}
+			shell.Default = recorder
+
+			installRoot := filepath.Join(t.TempDir(), "test-system")
+			rpmDb := filepath.Join(installRoot, "var", "lib", "rpm", "rpmdb.sqlite")
+			if err := os.MkdirAll(filepath.Dir(rpmDb), 0755); err != nil {
+				t.Fatalf("Failed to create RPM database directory: %v", err)
+			}
+			if err := os.WriteFile(rpmDb, []byte("previous build"), 0644); err != nil {
+				t.Fatalf("Failed to write RPM database: %v", err)
+			}
+
+			// Keep the rootfs of a previous build of the default test template
+			previous := createTestImageTemplate()
+			previous.Incremental = true
+			imageOs := &ImageOs{
+				installRoot: installRoot,
+				chrootEnv:   &shellInstallMockChrootEnv{MockChrootEnv{pkgType: "rpm", chrootRoot: shell.HostPath}},
+				template:    previous,
+			}
+			imageOs.recordIncrementalState(installRoot, previous)
+			if !RootfsKept(installRoot, previous) {
+				t.Fatal("Expected the rootfs of the previous build to be kept")
+			}
+			if tt.changePackageDB {
+				if err := os.WriteFile(rpmDb, []byte("rebuilt"), 0644); err != nil {
+					t.Fatalf("Failed to rewrite RPM database: %v", err)
+				}
+			}
+
+			template := createTestImageTemplate()
+			template.Incremental = tt.incremental
+			template.SystemConfig.Packages = tt.packages
+			template.SystemConfig.HostName = tt.hostname
+			imageOs.template = template
+
+			if err := imageOs.prepareIncrementalInstall(installRoot, template); err != nil {
+				t.Fatalf("prepareIncrementalInstall failed: %v", err)
+			}
+			if recorder.rootfsRemoved != tt.expectedReset {
+				t.Errorf("Expected rootfs removal %v, got %v", tt.expectedReset, recorder.rootfsRemoved)
+			}
+			if RootfsKept(installRoot, template) {
+				t.Error("Expected package state to be cleared until the build records it again")
+			}
+			if err := imageOs.installImagePkgs(installRoot, template); err != nil {
+				t.Fatalf("installImagePkgs failed: %v", err)
+			}
+			if strings.Join(recorder.installs, ",") != strings.Join(tt.expectedInstalls, ",") {
+				t.Errorf("Expected installs %v, got %v", tt.expectedInstalls, recorder.installs)
+			}
+			if strings.Join(recorder.removes, ",") != strings.Join(tt.expectedRemoves, ",") {
+				t.Errorf("Expected removes %v, got %v", tt.expectedRemoves, recorder.removes)
+			}
+		})
+	}
+}
+
 // TestUpdateImageConfig tests the updateImageConfig functionality
 func TestUpdateImageConfig(t *testing.T) {
 	// Set up mock executor
@@ -2035,7 +2506,7 @@ func TestUpdateImageConfig(t *testing.T) {
 		"boot": "/dev/sda2",
 	}
 
-	err = updateImageConfig(testDir, diskPathIdMap, template)
+	err = updateImageConfig(testDir, diskPathIdMap, template, nil)
 	if err != nil {
 		// This is expected to fail in test environment due to missing dependencies
 		t.Logf("updateImageConfig failed as expected in test environment: %v", err)
@@ -2226,37 +2697,295 @@ func TestMountDiskToChrootSkipsNonMountablePartitions(t *testing.T) {
 	}
 }
 
-// TestGetImageVersionInfo tests the getImageVersionInfo functionality
-func TestGetImageVersionInfoDetailed(t *testing.T) {
-	// Set up mock executor
-	originalExecutor := shell.Default
-	defer func() { shell.Default = originalExecutor }()
-
-	mockExecutor := &shell.MockExecutor{}
-	shell.Default = mockExecutor
-
-	// Create test directory
-	testDir, err := os.MkdirTemp("", "imageos_version_test_*")
-	if err != nil {
-		t.Fatalf("Failed to create test directory: %v", err)
+func TestPartitionMountFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		partition config.PartitionInfo
+		want      string
+		errMsg    string
+	}{
+		{
+			name:      "esp_at_boot_efi",
+			partition: config.PartitionInfo{ID: "boot", Type: "esp", FsType: "fat32", MountPoint: "/boot/efi"},
+			want:      "-t vfat -o umask=0077",
+		},
+		{
+			name:      "esp_at_non_default_mount_point",
+			partition: config.PartitionInfo{ID: "boot", Type: "esp", FsType: "fat32", MountPoint: "/efi"},
+			want:      "-t vfat -o umask=0077",
+		},
+		{
+			name:      "esp_by_type_guid",
+			partition: config.PartitionInfo{ID: "boot", TypeGUID: "C12A7328-F81F-11D2-BA4B-00A0C93EC93B", FsType: "vfat", MountPoint: "/boot"},
+			want:      "-t vfat -o umask=0077",
+		},
+		{
+			name:      "esp_by_flag",
+			partition: config.PartitionInfo{ID: "boot", Flags: []string{"esp", "boot"}, FsType: "fat16", MountPoint: "/efi"},
+			want:      "-t vfat -o umask=0077",
+		},
+		{
+			name:      "untyped_boot_efi",
+			partition: config.PartitionInfo{ID: "boot", FsType: "fat32", MountPoint: "/boot/efi"},
+			want:      "-t vfat -o umask=0077",
+		},
+		{
+			name:      "fat32_not_esp",
+			partition: config.PartitionInfo{ID: "data", Type: "linux", FsType: "fat32", MountPoint: "/data"},
+			want:      "-t vfat",
+		},
+		{
+			name:      "ext4_root",
+			partition: config.PartitionInfo{ID: "root", Type: "linux-root-amd64", FsType: "ext4", MountPoint: "/"},
+			want:      "-t ext4",
+		},
+		{
+			name:      "esp_with_ext4",
+			partition: config.PartitionInfo{ID: "boot", Type: "esp", FsType: "ext4", MountPoint: "/efi"},
+			errMsg:    "must use a FAT filesystem",
+		},
 	}
-	defer os.RemoveAll(testDir)
 
-	// Create mock chroot environment
-	mockChrootEnv := &MockChrootEnv{
-		chrootImageBuildDir: testDir,
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := partitionMountFlags(tt.partition)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("partitionMountFlags() = %q, want %q", got, tt.want)
+			}
+		})
 	}
+}
 
-	template := createTestImageTemplate()
+func TestMountDiskToChrootFatPartitions(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
 
-	// Create ImageOs directly without NewImageOs to avoid sudo dependency
+	testDir := t.TempDir()
+	template := &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{Name: "test-system"},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "esp", Type: "esp", FsType: "fat32", MountPoint: "/efi"},
+				{ID: "root", Type: "linux-root-amd64", FsType: "ext4", MountPoint: "/"},
+				{ID: "data", Type: "linux", FsType: "fat32", MountPoint: "/data"},
+			},
+		},
+	}
 	imageOs := &ImageOs{
 		installRoot: filepath.Join(testDir, template.SystemConfig.Name),
-		chrootEnv:   mockChrootEnv,
+		chrootEnv:   &MockChrootEnv{chrootImageBuildDir: testDir},
 		template:    template,
 	}
+	diskPathIdMap := map[string]string{
+		"esp":  "/dev/loop9p1",
+		"root": "/dev/loop9p2",
+		"data": "/dev/loop9p3",
+	}
 
-	installRoot := imageOs.GetInstallRoot()
+	recorder := &recordingExecutor{}
+	shell.Default = recorder
+	if _, err := imageOs.mountDiskToChroot(imageOs.installRoot, diskPathIdMap, template); err != nil {
+		t.Fatalf("mountDiskToChroot failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"mount -t vfat -o umask=0077 /dev/loop9p1 " + filepath.Join(imageOs.installRoot, "efi"),
+		"mount -t ext4 /dev/loop9p2 " + imageOs.installRoot,
+		"mount -t vfat /dev/loop9p3 " + filepath.Join(imageOs.installRoot, "data"),
+	} {
+		if !recorder.hasCommand(want) {
+			t.Errorf("expected command %q, got %v", want, recorder.commands)
+		}
+	}
+
+	template.Disk.Partitions[0].FsType = "ext4"
+	_, err := imageOs.mountDiskToChroot(imageOs.installRoot, diskPathIdMap, template)
+	if err == nil || !strings.Contains(err.Error(), "must use a FAT filesystem") {
+		t.Fatalf("expected FAT filesystem error for an ext4 ESP, got %v", err)
+	}
+}
+
+func TestMountDiskToChrootNestedMountOrder(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	testDir := t.TempDir()
+	template := &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{Name: "test-system"},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "varlib", Type: "linux", FsType: "ext4", MountPoint: "/var/lib"},
+				{ID: "home", Type: "linux", FsType: "ext4", MountPoint: "/home"},
+				{ID: "root", Type: "linux-root-amd64", FsType: "ext4", MountPoint: "/"},
+				{ID: "var", Type: "linux", FsType: "ext4", MountPoint: "/var"},
+			},
+		},
+	}
+	imageOs := &ImageOs{
+		installRoot: filepath.Join(testDir, template.SystemConfig.Name),
+		chrootEnv:   &MockChrootEnv{chrootImageBuildDir: testDir},
+		template:    template,
+	}
+	diskPathIdMap := map[string]string{
+		"root":   "/dev/loop9p1",
+		"var":    "/dev/loop9p2",
+		"varlib": "/dev/loop9p3",
+		"home":   "/dev/loop9p4",
+	}
+	wantOrder := []string{
+		imageOs.installRoot,
+		filepath.Join(imageOs.installRoot, "home"),
+		filepath.Join(imageOs.installRoot, "var"),
+		filepath.Join(imageOs.installRoot, "var", "lib"),
+	}
+	commandTargets := func(commands []string, prefix string) []string {
+		var targets []string
+		for _, cmd := range commands {
+			if strings.HasPrefix(cmd, prefix) {
+				fields := strings.Fields(cmd)
+				targets = append(targets, fields[len(fields)-1])
+			}
+		}
+		return targets
+	}
+
+	recorder := &recordingExecutor{}
+	shell.Default = recorder
+	mountPointInfoList, err := imageOs.mountDiskToChroot(imageOs.installRoot, diskPathIdMap, template)
+	if err != nil {
+		t.Fatalf("mountDiskToChroot failed: %v", err)
+	}
+	if got := commandTargets(recorder.commands, "mount -t"); !reflect.DeepEqual(got, wantOrder) {
+		t.Errorf("expected mount order %v, got %v", wantOrder, got)
+	}
+
+	// Report every partition as mounted, so that each one is unmounted
+	var mounted []string
+	for _, mountPoint := range wantOrder {
+		mounted = append(mounted, "/dev/loop9 on "+mountPoint+" type ext4 (rw)")
+	}
+	recorder = &recordingExecutor{mockCommands: []shell.MockCommand{
+		{Pattern: "^mount$", Output: strings.Join(mounted, "\n")},
+	}}
+	shell.Default = recorder
+	if err := imageOs.umountDiskFromChroot(imageOs.installRoot, mountPointInfoList); err != nil {
+		t.Fatalf("umountDiskFromChroot failed: %v", err)
+	}
+	wantUmountOrder := append([]string(nil), wantOrder...)
+	slices.Reverse(wantUmountOrder)
+	if got := commandTargets(recorder.commands, "umount "); !reflect.DeepEqual(got, wantUmountOrder) {
+		t.Errorf("expected unmount order %v, got %v", wantUmountOrder, got)
+	}
+}
+
+func TestMountPointDepth(t *testing.T) {
+	for mountPoint, want := range map[string]int{"/": 0, "/var": 1, "/var/": 1, "/var/lib": 2, "/boot/efi": 2} {
+		if got := mountPointDepth(mountPoint); got != want {
+			t.Errorf("mountPointDepth(%q) = %d, want %d", mountPoint, got, want)
+		}
+	}
+}
+
+// successRecorder records the commands that the mock executor ran without
+// an error.
+type successRecorder struct {
+	*shell.MockExecutor
+	ran []string
+}
+
+func (e *successRecorder) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	output, err := e.MockExecutor.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+	if err == nil {
+		e.ran = append(e.ran, cmdStr)
+	}
+	return output, err
+}
+
+func (e *successRecorder) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	output, err := e.MockExecutor.ExecCmdSilent(cmdStr, sudo, chrootPath, envVal)
+	if err == nil {
+		e.ran = append(e.ran, cmdStr)
+	}
+	return output, err
+}
+
+func TestUmountDiskFromChrootAfterBuildDeadline(t *testing.T) {
+	originalExecutor, originalDeadline := shell.Default, shell.BuildDeadline
+	defer func() { shell.Default, shell.BuildDeadline = originalExecutor, originalDeadline }()
+
+	testDir := t.TempDir()
+	imageOs := &ImageOs{
+		installRoot: filepath.Join(testDir, "rootfs"),
+		chrootEnv:   &MockChrootEnv{chrootImageBuildDir: testDir},
+		template:    createTestImageTemplate(),
+	}
+	bootMountPoint := filepath.Join(imageOs.installRoot, "boot", "efi")
+	mountPointInfoList := []map[string]string{
+		{"MountPoint": imageOs.installRoot},
+		{"MountPoint": bootMountPoint},
+	}
+	recorder := &successRecorder{MockExecutor: shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "^mount$", Output: "/dev/loop9p2 on " + imageOs.installRoot + " type ext4 (rw)\n" +
+			"/dev/loop9p1 on " + bootMountPoint + " type vfat (rw)"},
+		{Pattern: "umount ", Output: ""},
+	})}
+	shell.Default = recorder
+	shell.BuildDeadline = time.Now().Add(-time.Minute)
+
+	if err := imageOs.umountDiskFromChroot(imageOs.installRoot, mountPointInfoList); err != nil {
+		t.Fatalf("Expected the partitions to be unmounted after the build deadline, got: %v", err)
+	}
+	want := []string{"mount", "umount " + bootMountPoint, "mount", "umount " + imageOs.installRoot}
+	if !reflect.DeepEqual(recorder.ran, want) {
+		t.Errorf("Expected %v to run after the build deadline, ran: %v", want, recorder.ran)
+	}
+	if _, err := shell.ExecCmd("umount "+imageOs.installRoot, true, shell.HostPath, nil); !errors.Is(err, shell.ErrBuildDeadline) {
+		t.Errorf("Expected commands to be refused again after unmounting, got: %v", err)
+	}
+}
+
+// TestGetImageVersionInfo tests the getImageVersionInfo functionality
+func TestGetImageVersionInfoDetailed(t *testing.T) {
+	// Set up mock executor
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	mockExecutor := &shell.MockExecutor{}
+	shell.Default = mockExecutor
+
+	// Create test directory
+	testDir, err := os.MkdirTemp("", "imageos_version_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	// Create mock chroot environment
+	mockChrootEnv := &MockChrootEnv{
+		chrootImageBuildDir: testDir,
+	}
+
+	template := createTestImageTemplate()
+
+	// Create ImageOs directly without NewImageOs to avoid sudo dependency
+	imageOs := &ImageOs{
+		installRoot: filepath.Join(testDir, template.SystemConfig.Name),
+		chrootEnv:   mockChrootEnv,
+		template:    template,
+	}
+
+	installRoot := imageOs.GetInstallRoot()
 
 	// Test getImageVersionInfo
 	versionInfo, err := imageOs.getImageVersionInfo(installRoot, template)
@@ -2770,7 +3499,7 @@ func TestBuildImageUKI(t *testing.T) {
 				},
 			}
 
-			err = buildImageUKI(tempDir, template)
+			err = buildImageUKI(tempDir, "rpm", template)
 
 			if tt.expectError {
 				if err == nil {
@@ -3507,6 +4236,39 @@ func TestHashPassword(t *testing.T) {
 	}
 }
 
+func TestHashPasswordQuotesPassword(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	password := "pa'ss; reboot; echo '$(id)"
+	for algo, prefix := range map[string]string{
+		"sha512": "openssl passwd -6 ",
+		"sha256": "openssl passwd -5 ",
+		"md5":    "openssl passwd -1 ",
+		"bcrypt": "python3 -c ",
+	} {
+		executor := &recordingExecutor{mockCommands: []shell.MockCommand{{Pattern: ".*", Output: "$hash"}}}
+		shell.Default = executor
+		if _, err := hashPassword(password, algo, "/tmp/test-install-root"); err != nil {
+			t.Fatalf("hashPassword failed for %s: %v", algo, err)
+		}
+		cmd := executor.commands[0]
+		if !strings.HasPrefix(cmd, prefix) || !strings.HasSuffix(cmd, " "+shell.SingleQuote(password)) {
+			t.Errorf("expected %s to pass the password as one quoted argument, got: %s", algo, cmd)
+		}
+	}
+
+	executor := &recordingExecutor{}
+	shell.Default = executor
+	user := config.UserConfig{Name: "admin", Password: "$6$salt'$(reboot)", HashAlgo: "sha512"}
+	if err := setUserPassword("/tmp/test-install-root", user); err != nil {
+		t.Fatalf("setUserPassword failed: %v", err)
+	}
+	if want := "usermod -p " + shell.SingleQuote(user.Password) + " admin"; !reflect.DeepEqual(executor.commands, []string{want}) {
+		t.Errorf("expected %q, got: %v", want, executor.commands)
+	}
+}
+
 func TestConfigUserStartupScript(t *testing.T) {
 	originalExecutor := shell.Default
 	defer func() { shell.Default = originalExecutor }()
@@ -5301,3 +6063,2655 @@ func TestFixKernelSymlinksEdgeCases(t *testing.T) {
 		t.Error("Unexpected symlink created for regular file")
 	}
 }
+
+// recordingExecutor records every command it receives and answers them from
+// a list of regex-matched mock commands, returning empty success otherwise.
+type recordingExecutor struct {
+	mockCommands []shell.MockCommand
+	mockInputs   []shell.MockCommand // matched against the stdin of ExecCmdWithInput
+	commands     []string
+	inputs       []string
+	inputEnvs    [][]string
+}
+
+func (e *recordingExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.commands = append(e.commands, cmdStr)
+	for _, mockCmd := range e.mockCommands {
+		if matched, _ := regexp.MatchString(mockCmd.Pattern, cmdStr); matched {
+			return mockCmd.Output, mockCmd.Error
+		}
+	}
+	return "", nil
+}
+
+func (e *recordingExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *recordingExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *recordingExecutor) ExecCmdWithInput(inputStr string, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.inputs = append(e.inputs, inputStr)
+	e.inputEnvs = append(e.inputEnvs, envVal)
+	for _, mockInput := range e.mockInputs {
+		if matched, _ := regexp.MatchString(mockInput.Pattern, inputStr); matched {
+			e.commands = append(e.commands, cmdStr)
+			return mockInput.Output, mockInput.Error
+		}
+	}
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *recordingExecutor) hasCommand(prefix string) bool {
+	for _, cmd := range e.commands {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRemoveImagePkgs(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name           string
+		pkgType        string
+		targetOs       string
+		removePkgs     []string
+		mockCommands   []shell.MockCommand
+		expectError    bool
+		errorContains  string
+		expectCmds     []string
+		unexpectedCmds []string
+	}{
+		{
+			name:        "No packages to remove",
+			pkgType:     "deb",
+			removePkgs:  nil,
+			expectError: false,
+		},
+		{
+			name:       "DEB removal issues apt-get remove",
+			pkgType:    "deb",
+			removePkgs: []string{"man-db", "locales"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "^dpkg -s", Output: "Package: x\nStatus: install ok installed\n"},
+				{Pattern: "^apt-get -s remove", Output: "Remv man-db [2.12.0-4]\nRemv locales [2.39-0ubuntu8]\n"},
+			},
+			expectError: false,
+			expectCmds:  []string{"apt-get -s remove man-db locales", "apt-get remove -y man-db locales"},
+		},
+		{
+			name:       "DEB package never installed is skipped",
+			pkgType:    "deb",
+			removePkgs: []string{"man-db", "not-installed"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "^dpkg -s not-installed", Output: "dpkg-query: package 'not-installed' is not installed", Error: fmt.Errorf("exit status 1")},
+				{Pattern: "^dpkg -s", Output: "Status: install ok installed\n"},
+				{Pattern: "^apt-get -s remove", Output: "Remv man-db [2.12.0-4]\n"},
+			},
+			expectError: false,
+			expectCmds:  []string{"apt-get remove -y man-db"},
+		},
+		{
+			name:       "DEB nothing installed issues no remove",
+			pkgType:    "deb",
+			removePkgs: []string{"not-installed"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "^dpkg -s", Output: "", Error: fmt.Errorf("exit status 1")},
+			},
+			expectError:    false,
+			unexpectedCmds: []string{"apt-get"},
+		},
+		{
+			name:       "DEB removal of depended-upon package is rejected",
+			pkgType:    "deb",
+			removePkgs: []string{"libssl3"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "^dpkg -s", Output: "Status: install ok installed\n"},
+				{Pattern: "^apt-get -s remove", Output: "Remv openssh-server [1:9.6p1]\nRemv libssl3 [3.0.13]\n"},
+			},
+			expectError:    true,
+			errorContains:  "still required by installed packages: openssh-server",
+			unexpectedCmds: []string{"apt-get remove -y"},
+		},
+		{
+			name:       "RPM removal issues tdnf remove",
+			pkgType:    "rpm",
+			targetOs:   "edge-microvisor-toolkit",
+			removePkgs: []string{"man-pages"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "^rpm --root .* -q", Output: "man-pages-6.06-1.emt3.noarch\n"},
+			},
+			expectError: false,
+			expectCmds:  []string{"rpm --root /tmp/mock-chroot-path -e --test man-pages", "tdnf remove man-pages"},
+		},
+		{
+			name:       "RPM removal uses dnf for redhat-compatible-distro",
+			pkgType:    "rpm",
+			targetOs:   "redhat-compatible-distro",
+			removePkgs: []string{"man-pages"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "^rpm --root .* -q", Output: "man-pages-6.06-1.noarch\n"},
+			},
+			expectError: false,
+			expectCmds:  []string{"dnf remove man-pages"},
+		},
+		{
+			name:       "RPM package never installed is skipped",
+			pkgType:    "rpm",
+			removePkgs: []string{"not-installed"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "^rpm --root .* -q", Output: "package not-installed is not installed", Error: fmt.Errorf("exit status 1")},
+			},
+			expectError:    false,
+			unexpectedCmds: []string{"rpm --root /tmp/mock-chroot-path -e", "tdnf remove"},
+		},
+		{
+			name:       "RPM removal of depended-upon package is rejected",
+			pkgType:    "rpm",
+			removePkgs: []string{"openssl-libs"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "^rpm --root .* -q", Output: "openssl-libs-3.3.0-1.emt3.x86_64\n"},
+				{Pattern: "^rpm --root .* -e --test", Output: "error: Failed dependencies:\n\tlibssl.so.3()(64bit) is needed by (installed) openssh-server-9.8p1-1.emt3.x86_64\n", Error: fmt.Errorf("exit status 1")},
+			},
+			expectError:    true,
+			errorContains:  "still required by installed packages",
+			unexpectedCmds: []string{"tdnf remove"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &recordingExecutor{mockCommands: tt.mockCommands}
+			shell.Default = executor
+
+			template := createTestImageTemplate()
+			template.SystemConfig.RemovePackages = tt.removePkgs
+			if tt.targetOs != "" {
+				template.Target.OS = tt.targetOs
+			}
+
+			imageOs := &ImageOs{
+				installRoot: "/tmp/install-root",
+				chrootEnv:   &MockChrootEnv{pkgType: tt.pkgType},
+				template:    template,
+			}
+
+			err := imageOs.removeImagePkgs(imageOs.installRoot, template)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				if tt.errorContains != "" && !strings.Contains(err.Error(), tt.errorContains) {
+					t.Errorf("expected error to contain %q, got: %v", tt.errorContains, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, expected := range tt.expectCmds {
+				if !executor.hasCommand(expected) {
+					t.Errorf("expected command %q to be issued, got: %v", expected, executor.commands)
+				}
+			}
+			for _, unexpected := range tt.unexpectedCmds {
+				if executor.hasCommand(unexpected) {
+					t.Errorf("did not expect command %q to be issued, got: %v", unexpected, executor.commands)
+				}
+			}
+		})
+	}
+}
+
+func TestAddImageAdditionalFilesModeAndOwnership(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "authorized_keys")
+	if err := os.WriteFile(srcFile, []byte("ssh-ed25519 AAAA test"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	installRoot := filepath.Join(tempDir, "install")
+
+	tests := []struct {
+		name           string
+		fileInfo       config.AdditionalFileInfo
+		expectError    bool
+		errorContains  string
+		expectCmds     []string
+		unexpectedCmds []string
+	}{
+		{
+			name:           "Defaults keep source mode and give file to root",
+			fileInfo:       config.AdditionalFileInfo{Local: srcFile, Final: "/etc/motd"},
+			expectCmds:     []string{"chown root: /etc/motd"},
+			unexpectedCmds: []string{"chmod"},
+		},
+		{
+			name:       "Mode is applied inside the image",
+			fileInfo:   config.AdditionalFileInfo{Local: srcFile, Final: "/etc/secret.conf", Mode: "600"},
+			expectCmds: []string{"chown root: /etc/secret.conf", "chmod 0600 /etc/secret.conf"},
+		},
+		{
+			name:       "Owner and group are applied inside the image",
+			fileInfo:   config.AdditionalFileInfo{Local: srcFile, Final: "/home/user/.ssh/authorized_keys", Mode: "0600", Owner: "user", Group: "user"},
+			expectCmds: []string{"chown user:user /home/user/.ssh/authorized_keys", "chmod 0600 /home/user/.ssh/authorized_keys"},
+		},
+		{
+			name:       "Setuid mode is applied after chown",
+			fileInfo:   config.AdditionalFileInfo{Local: srcFile, Final: "/usr/bin/helper", Mode: "4755", Owner: "root"},
+			expectCmds: []string{"chown root: /usr/bin/helper", "chmod 4755 /usr/bin/helper"},
+		},
+		{
+			name:       "Owner only uses the owner's login group",
+			fileInfo:   config.AdditionalFileInfo{Local: srcFile, Final: "/etc/app.conf", Owner: "1000"},
+			expectCmds: []string{"chown 1000: /etc/app.conf"},
+		},
+		{
+			name:           "Invalid mode is rejected before copying",
+			fileInfo:       config.AdditionalFileInfo{Local: srcFile, Final: "/etc/app.conf", Mode: "0899"},
+			expectError:    true,
+			errorContains:  "invalid mode",
+			unexpectedCmds: []string{"cp", "chown", "chmod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &recordingExecutor{}
+			shell.Default = executor
+
+			template := createTestImageTemplate()
+			template.SystemConfig.AdditionalFiles = []config.AdditionalFileInfo{tt.fileInfo}
+
+			err := addImageAdditionalFiles(installRoot, template)
+			if err == nil {
+				err = updateAdditionalFilesAttributes(installRoot, template)
+			}
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				if !strings.Contains(err.Error(), tt.errorContains) {
+					t.Errorf("expected error to contain %q, got: %v", tt.errorContains, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Expected commands must be issued in the listed order
+			next := 0
+			for _, cmd := range executor.commands {
+				if next < len(tt.expectCmds) && strings.HasPrefix(cmd, tt.expectCmds[next]) {
+					next++
+				}
+			}
+			if next != len(tt.expectCmds) {
+				t.Errorf("expected commands %v in order, got: %v", tt.expectCmds, executor.commands)
+			}
+			for _, cmd := range tt.unexpectedCmds {
+				if executor.hasCommand(cmd) {
+					t.Errorf("unexpected command with prefix %q, got: %v", cmd, executor.commands)
+				}
+			}
+		})
+	}
+}
+
+func writeTestTarGz(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	defer f.Close()
+	gzWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzWriter)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(hdr); err != nil {
+			t.Fatalf("Failed to write archive header: %v", err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write archive entry: %v", err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("Failed to close tar writer: %v", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatalf("Failed to close gzip writer: %v", err)
+	}
+}
+
+func TestAddImageAdditionalFilesArchive(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	tempDir := t.TempDir()
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = filepath.Join(tempDir, "tmp")
+	config.SetGlobal(newGlobal)
+
+	payload := filepath.Join(tempDir, "webapp.tar.gz")
+	writeTestTarGz(t, payload, map[string]string{"bin/webapp": "binary", "etc/webapp.conf": "port=80"})
+	malicious := filepath.Join(tempDir, "malicious.tar.gz")
+	writeTestTarGz(t, malicious, map[string]string{"../../etc/passwd": "root::0:0::/:/bin/sh"})
+	installRoot := filepath.Join(tempDir, "install")
+
+	tests := []struct {
+		name           string
+		fileInfo       config.AdditionalFileInfo
+		expectError    bool
+		errorContains  string
+		expectCmds     []string
+		unexpectedCmds []string
+	}{
+		{
+			name:     "Archive is extracted into the final directory",
+			fileInfo: config.AdditionalFileInfo{Local: payload, Final: "/opt/webapp", Archive: true, Owner: "webapp"},
+			expectCmds: []string{
+				"mkdir -p '" + filepath.Join(installRoot, "opt/webapp") + "'",
+				"cp -a --no-preserve=ownership '" + newGlobal.TempDir,
+				"chown -h webapp: '/opt/webapp/bin/webapp' '/opt/webapp/etc/webapp.conf'",
+			},
+			unexpectedCmds: []string{"chown -R", "chown -h webapp: '/opt/webapp' "},
+		},
+		{
+			name:           "Archive entries escaping the final directory are rejected",
+			fileInfo:       config.AdditionalFileInfo{Local: malicious, Final: "/opt/webapp", Archive: true},
+			expectError:    true,
+			errorContains:  "escapes the extraction directory",
+			unexpectedCmds: []string{"cp", "chown"},
+		},
+		{
+			name:           "Mode is rejected for archives",
+			fileInfo:       config.AdditionalFileInfo{Local: payload, Final: "/opt/webapp", Archive: true, Mode: "0755"},
+			expectError:    true,
+			errorContains:  "mode is not supported",
+			unexpectedCmds: []string{"cp", "chown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &recordingExecutor{}
+			shell.Default = executor
+
+			template := createTestImageTemplate()
+			template.SystemConfig.AdditionalFiles = []config.AdditionalFileInfo{tt.fileInfo}
+
+			err := addImageAdditionalFiles(installRoot, template)
+			if err == nil {
+				err = updateAdditionalFilesAttributes(installRoot, template)
+			}
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				if !strings.Contains(err.Error(), tt.errorContains) {
+					t.Errorf("expected error to contain %q, got: %v", tt.errorContains, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			next := 0
+			for _, cmd := range executor.commands {
+				if next < len(tt.expectCmds) && strings.HasPrefix(cmd, tt.expectCmds[next]) {
+					next++
+				}
+			}
+			if next != len(tt.expectCmds) {
+				t.Errorf("expected commands %v in order, got: %v", tt.expectCmds, executor.commands)
+			}
+			for _, cmd := range tt.unexpectedCmds {
+				if executor.hasCommand(cmd) {
+					t.Errorf("unexpected command with prefix %q, got: %v", cmd, executor.commands)
+				}
+			}
+		})
+	}
+}
+
+func TestPostImageOsInstallCommands(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name          string
+		commands      []string
+		mockInputs    []shell.MockCommand
+		expectError   bool
+		errorContains string
+		expectInputs  []string
+	}{
+		{
+			name:         "No commands configured",
+			commands:     nil,
+			expectInputs: nil,
+		},
+		{
+			name:         "Commands run in order in the chroot",
+			commands:     []string{"systemctl enable vendor.service", "/opt/vendor/setup.sh --quiet", "echo done > /etc/vendor-done"},
+			mockInputs:   []shell.MockCommand{{Pattern: ".", Output: "ok\n"}},
+			expectInputs: []string{"systemctl enable vendor.service\n", "/opt/vendor/setup.sh --quiet\n", "echo done > /etc/vendor-done\n"},
+		},
+		{
+			name:     "Failing command aborts the remaining ones",
+			commands: []string{"true", "false", "never-run"},
+			mockInputs: []shell.MockCommand{
+				{Pattern: "^false", Output: "setup failed\n", Error: fmt.Errorf("exit status 1")},
+			},
+			expectError:   true,
+			errorContains: "post-install command 2",
+			expectInputs:  []string{"true\n", "false\n"},
+		},
+		{
+			name:          "Empty command is rejected",
+			commands:      []string{"   "},
+			expectError:   true,
+			errorContains: "post-install command 1 is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			installRoot := filepath.Join(tempDir, "rootfs")
+
+			executor := &recordingExecutor{mockInputs: tt.mockInputs}
+			shell.Default = executor
+
+			template := createTestImageTemplate()
+			template.SystemConfig.PostInstallCommands = tt.commands
+			imageOs := &ImageOs{
+				installRoot: installRoot,
+				chrootEnv:   &MockChrootEnv{},
+				template:    template,
+			}
+
+			_, err := imageOs.postImageOsInstall(installRoot, template)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				if !strings.Contains(err.Error(), tt.errorContains) {
+					t.Errorf("expected error to contain %q, got: %v", tt.errorContains, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(executor.inputs) != len(tt.expectInputs) {
+				t.Fatalf("expected %d hook commands, got %d: %q", len(tt.expectInputs), len(executor.inputs), executor.inputs)
+			}
+			for i, input := range tt.expectInputs {
+				if executor.inputs[i] != input {
+					t.Errorf("expected hook command %d to be %q, got %q", i, input, executor.inputs[i])
+				}
+				if executor.commands[i] != "bash -e -s" {
+					t.Errorf("expected hook command %d to run through bash stdin, got %q", i, executor.commands[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInstallImagePkgsPreInstallCommands(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name          string
+		pkgType       string
+		commands      []string
+		mockInputs    []shell.MockCommand
+		expectError   bool
+		errorContains string
+		expectCmds    []string
+		expectEnv     string
+	}{
+		{
+			name:       "RPM commands run after initdb and before installs",
+			pkgType:    "rpm",
+			commands:   []string{"rpm --root \"$IMAGE_ROOT\" --import /keys/vendor.asc", "echo configured"},
+			expectCmds: []string{"rpm --root", "bash -e -s", "bash -e -s", "tdnf install"},
+			expectEnv:  "IMAGE_ROOT=/workspace/rootfs",
+		},
+		{
+			name:     "Failing command stops before any install",
+			pkgType:  "rpm",
+			commands: []string{"rpm --import /keys/missing.asc", "echo never"},
+			mockInputs: []shell.MockCommand{
+				{Pattern: "missing", Output: "error: /keys/missing.asc: import read failed\n", Error: fmt.Errorf("exit status 1")},
+			},
+			expectError:   true,
+			errorContains: "pre-install command 1",
+			expectCmds:    []string{"rpm --root", "bash -e -s"},
+		},
+		{
+			name:       "No commands configured",
+			pkgType:    "rpm",
+			expectCmds: []string{"rpm --root", "tdnf install"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &recordingExecutor{mockInputs: tt.mockInputs}
+			shell.Default = executor
+
+			template := createTestImageTemplate()
+			template.SystemConfig.PreInstallCommands = tt.commands
+			imageOs := &ImageOs{
+				installRoot: filepath.Join(t.TempDir(), template.SystemConfig.Name),
+				chrootEnv: &shellInstallMockChrootEnv{MockChrootEnv{
+					pkgType:    tt.pkgType,
+					chrootRoot: shell.HostPath,
+					chrootPath: "/workspace/rootfs",
+				}},
+				template: template,
+			}
+
+			err := imageOs.installImagePkgs(imageOs.GetInstallRoot(), template)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				if !strings.Contains(err.Error(), tt.errorContains) {
+					t.Errorf("expected error to contain %q, got: %v", tt.errorContains, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Skip the mkdir of the RPM database directory, if any
+			var cmds []string
+			for _, cmd := range executor.commands {
+				if !strings.HasPrefix(cmd, "mkdir") {
+					cmds = append(cmds, cmd)
+				}
+			}
+			if len(cmds) < len(tt.expectCmds) {
+				t.Fatalf("expected commands starting with %v, got: %v", tt.expectCmds, cmds)
+			}
+			for i, prefix := range tt.expectCmds {
+				if !strings.HasPrefix(cmds[i], prefix) {
+					t.Errorf("expected command %d to start with %q, got: %v", i, prefix, cmds)
+				}
+			}
+			if tt.expectError && executor.hasCommand("tdnf install") {
+				t.Errorf("no package must be installed after a failed pre-install command, got: %v", cmds)
+			}
+			if len(executor.inputs) > 0 {
+				if executor.inputs[0] != tt.commands[0]+"\n" {
+					t.Errorf("expected first pre-install command %q, got %q", tt.commands[0], executor.inputs[0])
+				}
+			}
+			for _, env := range executor.inputEnvs {
+				if tt.expectEnv != "" && strings.Join(env, " ") != tt.expectEnv {
+					t.Errorf("expected pre-install commands to get %s, got %v", tt.expectEnv, env)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildImageUKISkipsUnchangedInputs(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	installRoot := filepath.Join(t.TempDir(), "rootfs")
+	writeFile := func(relPath, content string) {
+		t.Helper()
+		fullPath := filepath.Join(installRoot, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", relPath, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", relPath, err)
+		}
+	}
+	writeFile("boot/vmlinuz-6.1.0", "fake kernel")
+	writeFile("lib/modules/6.1.0/modules.dep", "")
+	writeFile("boot/initramfs-6.1.0.img", "fake initramfs")
+	writeFile("boot/cmdline.conf", "console=ttyS0 quiet")
+	writeFile("etc/os-release", "NAME=Test\nVERSION=1.0")
+
+	template := &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{Provider: "systemd-boot"},
+		},
+	}
+
+	build := func(force bool) *recordingExecutor {
+		t.Helper()
+		executor := &recordingExecutor{mockCommands: []shell.MockCommand{
+			{Pattern: "^ls ", Output: "cmdline.conf initramfs-6.1.0.img vmlinuz-6.1.0\n"},
+			{Pattern: "^cat ", Output: "console=ttyS0 quiet\n"},
+		}}
+		shell.Default = executor
+		template.ForceUKI = force
+		if err := buildImageUKI(installRoot, "rpm", template); err != nil {
+			t.Fatalf("buildImageUKI failed: %v", err)
+		}
+		return executor
+	}
+
+	// The first build has nothing recorded, so both steps run. ukify is
+	// mocked, so put the UKI it would have written in place.
+	writeFile("boot/efi/EFI/Linux/linux.efi", "fake uki")
+	first := build(false)
+	if !first.hasCommand("dracut ") || !first.hasCommand("ukify build") {
+		t.Fatalf("expected the first build to run dracut and ukify, got: %v", first.commands)
+	}
+
+	unchanged := build(false)
+	if unchanged.hasCommand("dracut ") || unchanged.hasCommand("ukify build") {
+		t.Errorf("expected unchanged inputs to skip dracut and ukify, got: %v", unchanged.commands)
+	}
+	if unchanged.hasCommand("sh -c 'rm -rf /boot/efi/*'") {
+		t.Errorf("expected a skipped UKI rebuild to keep the ESP, got: %v", unchanged.commands)
+	}
+	if !unchanged.hasCommand("cp usr/lib/systemd/boot/efi/systemd-bootx64.efi") {
+		t.Errorf("expected the bootloader to be copied even when the UKI is kept, got: %v", unchanged.commands)
+	}
+
+	forced := build(true)
+	if !forced.hasCommand("dracut ") || !forced.hasCommand("ukify build") {
+		t.Errorf("expected --force-uki to run dracut and ukify, got: %v", forced.commands)
+	}
+
+	// A changed command line only needs a new UKI
+	writeFile("boot/cmdline.conf", "console=ttyS0 quiet loglevel=3")
+	cmdlineChanged := build(false)
+	if cmdlineChanged.hasCommand("dracut ") {
+		t.Errorf("expected a command line change to keep the initramfs, got: %v", cmdlineChanged.commands)
+	}
+	if !cmdlineChanged.hasCommand("ukify build") {
+		t.Errorf("expected a command line change to rebuild the UKI, got: %v", cmdlineChanged.commands)
+	}
+
+	// A kernel module newer than the initramfs needs both
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(installRoot, "lib/modules/6.1.0/modules.dep"), future, future); err != nil {
+		t.Fatalf("Failed to touch modules.dep: %v", err)
+	}
+	modulesChanged := build(false)
+	if !modulesChanged.hasCommand("dracut ") {
+		t.Errorf("expected newer kernel modules to regenerate the initramfs, got: %v", modulesChanged.commands)
+	}
+
+	// An initramfs written by something else, like the kernel package
+	// scriptlet of a new root filesystem, does not match the stamp of the
+	// last dracut run, even with the same inputs and a newer time
+	writeFile("boot/initramfs-6.1.0.img", "initramfs of the kernel package scriptlet")
+	if err := os.Chtimes(filepath.Join(installRoot, "boot/initramfs-6.1.0.img"), future.Add(time.Hour), future.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to touch the initramfs: %v", err)
+	}
+	replaced := build(false)
+	if !replaced.hasCommand("dracut ") || !replaced.hasCommand("ukify build") {
+		t.Errorf("expected a replaced initramfs to be regenerated, got: %v", replaced.commands)
+	}
+
+	// The same goes for a UKI that is not the one the last build produced
+	writeFile("boot/efi/EFI/Linux/linux.efi", "another uki")
+	ukiReplaced := build(false)
+	if !ukiReplaced.hasCommand("ukify build") {
+		t.Errorf("expected a replaced UKI to be rebuilt, got: %v", ukiReplaced.commands)
+	}
+}
+
+func TestBuildDKMSModules(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	installRoot := t.TempDir()
+	for relPath, content := range map[string]string{
+		"boot/vmlinuz-6.8.0-31-generic":         "generic kernel",
+		"boot/vmlinuz-6.17.0-5-generic":         "hwe kernel",
+		"usr/src/v4l2loopback-0.12.7/dkms.conf": "PACKAGE_NAME=\"v4l2loopback\"\nPACKAGE_VERSION=\"0.12.7\"\n",
+		"usr/src/acpi-call-1.2.2/dkms.conf":     "PACKAGE_NAME=\"acpi_call\"\nPACKAGE_VERSION=1.2.2\n",
+	} {
+		fullPath := filepath.Join(installRoot, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", relPath, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", relPath, err)
+		}
+	}
+	template := &config.ImageTemplate{SystemConfig: config.SystemConfig{Kernel: config.KernelConfig{
+		Package:     "linux-image-generic-hwe-24.04",
+		DKMSModules: []string{"v4l2loopback-dkms", "acpi-call-dkms"},
+	}}}
+	mockCommands := []shell.MockCommand{
+		{Pattern: "^dpkg -L linux-image-generic-hwe-24.04$", Output: "/usr/share/doc/linux-image-generic-hwe-24.04\n"},
+		{Pattern: "^dpkg-query .*linux-image-generic-hwe-24.04$", Output: "linux-image-6.17.0-5-generic, linux-firmware"},
+		{Pattern: "^dpkg -L linux-image-6.17.0-5-generic$", Output: "/boot/vmlinuz-6.17.0-5-generic\n"},
+		{Pattern: "^dpkg -L v4l2loopback-dkms$", Output: "/usr/src/v4l2loopback-0.12.7\n/usr/src/v4l2loopback-0.12.7/dkms.conf\n"},
+		{Pattern: "^dpkg -L acpi-call-dkms$", Output: "/usr/src/acpi-call-1.2.2/dkms.conf\n"},
+	}
+
+	t.Run("builds against the resolved kernel", func(t *testing.T) {
+		executor := &recordingExecutor{mockCommands: mockCommands}
+		shell.Default = executor
+		if err := buildDKMSModules(installRoot, "deb", template); err != nil {
+			t.Fatalf("buildDKMSModules failed: %v", err)
+		}
+		var dkmsCommands []string
+		for _, cmd := range executor.commands {
+			if strings.HasPrefix(cmd, "dkms ") {
+				dkmsCommands = append(dkmsCommands, cmd)
+			}
+		}
+		want := []string{
+			"dkms install -m v4l2loopback -v 0.12.7 -k 6.17.0-5-generic",
+			"dkms install -m acpi_call -v 1.2.2 -k 6.17.0-5-generic",
+		}
+		if !reflect.DeepEqual(dkmsCommands, want) {
+			t.Errorf("DKMS commands = %q, want %q", dkmsCommands, want)
+		}
+	})
+
+	t.Run("build failure aborts", func(t *testing.T) {
+		executor := &recordingExecutor{mockCommands: append([]shell.MockCommand{
+			{Pattern: "^dkms install -m v4l2loopback ", Error: fmt.Errorf("bad exit status: 10")},
+		}, mockCommands...)}
+		shell.Default = executor
+		err := buildDKMSModules(installRoot, "deb", template)
+		if err == nil || !strings.Contains(err.Error(), "v4l2loopback/0.12.7 of package v4l2loopback-dkms failed to build for kernel 6.17.0-5-generic") {
+			t.Fatalf("expected a DKMS build error, got %v", err)
+		}
+		for _, cmd := range executor.commands {
+			if strings.Contains(cmd, "acpi_call") {
+				t.Errorf("expected the build to stop at the first failing module, got %s", cmd)
+			}
+		}
+	})
+
+	t.Run("no modules", func(t *testing.T) {
+		executor := &recordingExecutor{}
+		shell.Default = executor
+		if err := buildDKMSModules(installRoot, "deb", &config.ImageTemplate{}); err != nil {
+			t.Fatalf("buildDKMSModules failed: %v", err)
+		}
+		if len(executor.commands) != 0 {
+			t.Errorf("expected no commands without DKMS modules, got %v", executor.commands)
+		}
+	})
+}
+
+func TestBuildImageUKITargetsKernelPackage(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	installRoot := filepath.Join(t.TempDir(), "rootfs")
+	for relPath, content := range map[string]string{
+		"boot/vmlinuz-6.6.44":    "generic kernel",
+		"boot/vmlinuz-6.6.44-rt": "rt kernel",
+		"boot/cmdline.conf":      "console=ttyS0",
+		"etc/os-release":         "NAME=Test\nVERSION=1.0",
+	} {
+		fullPath := filepath.Join(installRoot, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", relPath, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", relPath, err)
+		}
+	}
+
+	template := &config.ImageTemplate{
+		Target: config.TargetInfo{Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{
+			Bootloader: config.Bootloader{Provider: "systemd-boot"},
+			Kernel:     config.KernelConfig{Package: "kernel-rt=6.6.44-1.azl3"},
+		},
+	}
+	executor := &recordingExecutor{mockCommands: []shell.MockCommand{
+		{Pattern: "^ls ", Output: "cmdline.conf vmlinuz-6.6.44 vmlinuz-6.6.44-rt\n"},
+		{Pattern: "^cat ", Output: "console=ttyS0\n"},
+		{Pattern: "^rpm -ql kernel-rt$", Output: "/lib/modules/6.6.44-rt/vmlinuz\n"},
+	}}
+	shell.Default = executor
+
+	if err := buildImageUKI(installRoot, "rpm", template); err != nil {
+		t.Fatalf("buildImageUKI failed: %v", err)
+	}
+	for _, step := range []struct{ prefix, want string }{
+		{"dracut ", "--kver 6.6.44-rt /boot/initramfs-6.6.44-rt.img"},
+		{"ukify build", `/boot/vmlinuz-6.6.44-rt" --initrd`},
+	} {
+		found := false
+		for _, cmd := range executor.commands {
+			if strings.HasPrefix(cmd, step.prefix) {
+				found = true
+				if !strings.Contains(cmd, step.want) {
+					t.Errorf("expected %q to target the kernel of kernel-rt, got: %s", step.prefix, cmd)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected a %q command, got: %v", step.prefix, executor.commands)
+		}
+	}
+}
+
+func TestNameResolutionContent(t *testing.T) {
+	resolvConf := config.ResolvConf{
+		Nameservers: []string{"10.0.0.53", "2001:db8::53"},
+		Search:      []string{"corp.example.com", "example.com"},
+	}
+	hostsEntries := []config.HostsEntry{
+		{IP: "10.0.0.10", Hostnames: []string{"registry.corp.example.com", "registry"}},
+		{IP: "10.0.0.11", Hostnames: []string{"ntp"}},
+	}
+
+	wantResolvConf := "# Generated from systemConfig.resolvConf of the image template\n" +
+		"nameserver 10.0.0.53\n" +
+		"nameserver 2001:db8::53\n" +
+		"search corp.example.com example.com\n"
+	if got := resolvConfContent(resolvConf); got != wantResolvConf {
+		t.Errorf("resolvConfContent() = %q, want %q", got, wantResolvConf)
+	}
+
+	wantDropIn := "# Generated from systemConfig.resolvConf of the image template\n" +
+		"[Resolve]\n" +
+		"DNS=10.0.0.53 2001:db8::53\n" +
+		"Domains=corp.example.com example.com\n"
+	if got := resolvedDropInContent(resolvConf); got != wantDropIn {
+		t.Errorf("resolvedDropInContent() = %q, want %q", got, wantDropIn)
+	}
+
+	wantHosts := "\n# Added from systemConfig.hostsEntries of the image template\n" +
+		"10.0.0.10\tregistry.corp.example.com registry\n" +
+		"10.0.0.11\tntp\n"
+	if got := hostsEntriesContent(hostsEntries); got != wantHosts {
+		t.Errorf("hostsEntriesContent() = %q, want %q", got, wantHosts)
+	}
+}
+
+func TestUpdateImageNameResolution(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = t.TempDir()
+	config.SetGlobal(newGlobal)
+
+	template := createTestImageTemplate()
+	template.SystemConfig.ResolvConf = config.ResolvConf{Nameservers: []string{"10.0.0.53"}, Search: []string{"example.com"}}
+	template.SystemConfig.HostsEntries = []config.HostsEntry{{IP: "10.0.0.10", Hostnames: []string{"registry"}}}
+
+	t.Run("static resolv.conf replaces symlink", func(t *testing.T) {
+		installRoot := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(installRoot, "etc"), 0755); err != nil {
+			t.Fatalf("failed to create etc: %v", err)
+		}
+		resolvConfPath := filepath.Join(installRoot, "etc", "resolv.conf")
+		if err := os.Symlink("/run/systemd/resolve/stub-resolv.conf", resolvConfPath); err != nil {
+			t.Fatalf("failed to create resolv.conf symlink: %v", err)
+		}
+
+		recorder := &recordingExecutor{}
+		shell.Default = recorder
+		if err := updateImageNameResolution(installRoot, template); err != nil {
+			t.Fatalf("updateImageNameResolution failed: %v", err)
+		}
+
+		for _, want := range []string{
+			"rm -f " + resolvConfPath,
+			"chmod 0644 " + resolvConfPath,
+		} {
+			if !recorder.hasCommand(want) {
+				t.Errorf("expected command %q, got %v", want, recorder.commands)
+			}
+		}
+		if !slices.ContainsFunc(recorder.commands, func(cmd string) bool {
+			return strings.HasPrefix(cmd, "cp ") && strings.HasSuffix(cmd, "'"+resolvConfPath+"'")
+		}) {
+			t.Errorf("expected resolv.conf to be written, got %v", recorder.commands)
+		}
+		if !slices.ContainsFunc(recorder.commands, func(cmd string) bool {
+			return strings.HasSuffix(cmd, "tee -a "+filepath.Join(installRoot, "etc", "hosts")+" >/dev/null")
+		}) {
+			t.Errorf("expected hosts entries to be appended, got %v", recorder.commands)
+		}
+	})
+
+	t.Run("systemd-resolved drop-in", func(t *testing.T) {
+		installRoot := t.TempDir()
+		unitDir := filepath.Join(installRoot, "usr", "lib", "systemd", "system")
+		if err := os.MkdirAll(unitDir, 0755); err != nil {
+			t.Fatalf("failed to create unit directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(unitDir, "systemd-resolved.service"), []byte("[Unit]\n"), 0644); err != nil {
+			t.Fatalf("failed to write unit file: %v", err)
+		}
+
+		recorder := &recordingExecutor{}
+		shell.Default = recorder
+		if err := updateImageNameResolution(installRoot, template); err != nil {
+			t.Fatalf("updateImageNameResolution failed: %v", err)
+		}
+
+		dropInPath := filepath.Join(installRoot, resolvedDropInPath)
+		if !recorder.hasCommand("chmod 0644 " + dropInPath) {
+			t.Errorf("expected systemd-resolved drop-in to be written, got %v", recorder.commands)
+		}
+		if recorder.hasCommand("rm -f") || slices.ContainsFunc(recorder.commands, func(cmd string) bool {
+			return strings.Contains(cmd, filepath.Join(installRoot, "etc", "resolv.conf"))
+		}) {
+			t.Errorf("expected resolv.conf to be left to systemd-resolved, got %v", recorder.commands)
+		}
+	})
+
+	t.Run("nothing configured", func(t *testing.T) {
+		recorder := &recordingExecutor{}
+		shell.Default = recorder
+		if err := updateImageNameResolution(t.TempDir(), createTestImageTemplate()); err != nil {
+			t.Fatalf("updateImageNameResolution failed: %v", err)
+		}
+		if len(recorder.commands) != 0 {
+			t.Errorf("expected no commands, got %v", recorder.commands)
+		}
+	})
+}
+
+func TestAuditImageLicenses(t *testing.T) {
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = t.TempDir()
+	config.SetGlobal(newGlobal)
+
+	installRoot := t.TempDir()
+	docDir := filepath.Join(installRoot, "usr", "share", "doc", "ghostscript")
+	if err := os.MkdirAll(docDir, 0755); err != nil {
+		t.Fatalf("failed to create doc directory: %v", err)
+	}
+	copyright := "Files: *\nLicense: AGPL-3.0-or-later\n"
+	if err := os.WriteFile(filepath.Join(docDir, "copyright"), []byte(copyright), 0644); err != nil {
+		t.Fatalf("failed to write copyright file: %v", err)
+	}
+
+	pkgs := []ospackage.PackageInfo{
+		{Name: "curl", Type: "deb", License: "MIT"},
+		{Name: "ghostscript", Type: "deb"},
+	}
+	addDebCopyrightLicenses(installRoot, pkgs)
+	if pkgs[1].License != "AGPL-3.0-or-later" {
+		t.Fatalf("expected license from the copyright file, got %q", pkgs[1].License)
+	}
+
+	template := createTestImageTemplate()
+	if err := auditImageLicenses(pkgs, template); err != nil {
+		t.Fatalf("expected no error without a license policy, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(newGlobal.TempDir, manifest.DefaultLicenseReportFile)); err != nil {
+		t.Errorf("expected license report to be written: %v", err)
+	}
+
+	template.SystemConfig.LicensePolicy.Deny = []string{"AGPL"}
+	err := auditImageLicenses(pkgs, template)
+	if err == nil || !strings.Contains(err.Error(), "AGPL: ghostscript") {
+		t.Fatalf("expected denied AGPL package to fail the audit, got %v", err)
+	}
+}
+
+// panicChrootEnv panics while the image packages are installed
+type panicChrootEnv struct {
+	MockChrootEnv
+	sysfsUmounted bool
+}
+
+func (m *panicChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
+	panic("tdnf crashed installing " + packageName)
+}
+
+func (m *panicChrootEnv) UmountChrootSysfs(chrootPath string) error {
+	m.sysfsUmounted = true
+	return nil
+}
+
+func newPanicInstallImageOs(t *testing.T) (*ImageOs, *panicChrootEnv) {
+	t.Helper()
+	testDir := t.TempDir()
+	template := &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		Target:       config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{Name: "test-system", Packages: []string{"filesystem"}},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "root", Type: "linux-root-amd64", FsType: "ext4", MountPoint: "/"},
+			},
+		},
+	}
+	chrootEnv := &panicChrootEnv{MockChrootEnv: MockChrootEnv{chrootImageBuildDir: testDir, pkgType: "rpm"}}
+	return &ImageOs{
+		installRoot: filepath.Join(testDir, template.SystemConfig.Name),
+		chrootEnv:   chrootEnv,
+		template:    template,
+	}, chrootEnv
+}
+
+func TestInstallImageOsPanicUnmounts(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	imageOs, chrootEnv := newPanicInstallImageOs(t)
+	recorder := &recordingExecutor{mockCommands: []shell.MockCommand{
+		// Report the root partition as mounted, so the unmount is attempted
+		{Pattern: "^mount$", Output: "/dev/loop9p1 on " + imageOs.installRoot + " type ext4 (rw)"},
+	}}
+	shell.Default = recorder
+
+	_, err := imageOs.InstallImageOs(map[string]string{"root": "/dev/loop9p1"})
+	if err == nil || !strings.Contains(err.Error(), "panic during package installation: tdnf crashed installing filesystem") {
+		t.Fatalf("expected the panic to be returned as an error, got %v", err)
+	}
+	if !chrootEnv.sysfsUmounted {
+		t.Errorf("expected sysfs to be unmounted after the panic")
+	}
+	if !recorder.hasCommand("umount " + imageOs.installRoot) {
+		t.Errorf("expected the root partition to be unmounted after the panic, got %v", recorder.commands)
+	}
+}
+
+func TestInstallInitrdPanicUnmounts(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = &recordingExecutor{}
+
+	imageOs, chrootEnv := newPanicInstallImageOs(t)
+
+	installRoot, _, err := imageOs.InstallInitrd()
+	if err == nil || !strings.Contains(err.Error(), "panic during package installation") {
+		t.Fatalf("expected the panic to be returned as an error, got %v", err)
+	}
+	if installRoot != imageOs.installRoot {
+		t.Errorf("installRoot = %q, want %q", installRoot, imageOs.installRoot)
+	}
+	if !chrootEnv.sysfsUmounted {
+		t.Errorf("expected sysfs to be unmounted after the panic")
+	}
+}
+
+func TestRecoverInstallPanicKeepsCleanupError(t *testing.T) {
+	var err error
+	func() {
+		stage := "bootloader installation"
+		defer recoverInstallPanic(&stage, &err)
+		defer func() { err = fmt.Errorf("failed to unmount disk from chroot: busy") }()
+		panic("boom")
+	}()
+	if err == nil {
+		t.Fatal("expected an error after the panic")
+	}
+	for _, want := range []string{"panic during bootloader installation: boom", "cleanup errors: failed to unmount disk from chroot: busy"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestInstallRootsOfDistinctWorkDirs(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+
+	g := config.DefaultGlobalConfig()
+	g.ConfigDir = filepath.Join("..", "..", "..", "config")
+	g.CacheDir = t.TempDir()
+	g.TempDir = t.TempDir()
+	config.SetGlobal(g)
+
+	template := &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		Target:       config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{Name: "test-system"},
+	}
+
+	var installRoots []string
+	workDirs := []string{t.TempDir(), t.TempDir()}
+	for _, workDir := range workDirs {
+		recorder := &recordingExecutor{}
+		shell.Default = recorder
+
+		chrootEnv, err := chroot.NewChrootEnvInWorkDir(workDir, template.Target.OS, template.Target.Dist, template.Target.Arch)
+		if err != nil {
+			t.Fatalf("NewChrootEnvInWorkDir(%s) failed: %v", workDir, err)
+		}
+		for _, dir := range []string{chrootEnv.GetChrootEnvRoot(), chrootEnv.ChrootBuilder.GetChrootBuildDir(), chrootEnv.GetChrootImageBuildDir()} {
+			if !strings.HasPrefix(dir, workDir+string(filepath.Separator)) {
+				t.Errorf("expected %s to be below the work directory %s", dir, workDir)
+			}
+		}
+
+		// InitChrootEnv creates the image build directory
+		if err := os.MkdirAll(chrootEnv.GetChrootImageBuildDir(), 0700); err != nil {
+			t.Fatalf("failed to create image build directory: %v", err)
+		}
+		imageOs, err := NewImageOs(chrootEnv, template)
+		if err != nil {
+			t.Fatalf("NewImageOs failed: %v", err)
+		}
+		if !recorder.hasCommand("mkdir -p " + imageOs.GetInstallRoot()) {
+			t.Errorf("expected the install root to be created, got %v", recorder.commands)
+		}
+		installRoots = append(installRoots, imageOs.GetInstallRoot())
+	}
+
+	if installRoots[0] == installRoots[1] ||
+		strings.HasPrefix(installRoots[0], installRoots[1]) || strings.HasPrefix(installRoots[1], installRoots[0]) {
+		t.Errorf("expected install roots of distinct work directories not to overlap, got %v", installRoots)
+	}
+	for i, installRoot := range installRoots {
+		if !strings.HasPrefix(installRoot, workDirs[i]) {
+			t.Errorf("install root %s is not below its work directory %s", installRoot, workDirs[i])
+		}
+	}
+
+	if _, err := chroot.NewChrootEnvInWorkDir("relative/work", template.Target.OS, template.Target.Dist, template.Target.Arch); err == nil {
+		t.Error("expected an error for a relative work directory")
+	}
+}
+
+func compressedRootTemplate(fsType string) *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Image: config.ImageInfo{Name: "test-image"},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "boot", MountPoint: "/boot", FsType: "ext4"},
+				{ID: "rootfs", MountPoint: "/", FsType: fsType, FsLabel: "rootfs"},
+			},
+		},
+	}
+}
+
+func TestBuildCompressedRootfs(t *testing.T) {
+	originalShell := shell.Default
+	defer func() { shell.Default = originalShell }()
+
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "rootfs": "/dev/loop0p2"}
+	installRoot := "/tmp/imagebuild/test"
+
+	tests := []struct {
+		fsType  string
+		wantCmd string
+	}{
+		{config.FsTypeSquashfs, "mksquashfs " + installRoot + " /dev/loop0p2 -noappend -comp zstd -xattrs"},
+		{config.FsTypeErofs, "mkfs.erofs -zlz4hc -L rootfs /dev/loop0p2 " + installRoot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fsType, func(t *testing.T) {
+			recorder := &recordingExecutor{mockCommands: []shell.MockCommand{
+				{Pattern: `^command -v `, Output: "/usr/bin/tool\n"},
+			}}
+			shell.Default = recorder
+
+			if err := buildCompressedRootfs(installRoot, diskPathIdMap, compressedRootTemplate(tt.fsType)); err != nil {
+				t.Fatalf("buildCompressedRootfs failed: %v", err)
+			}
+			if !recorder.hasCommand(tt.wantCmd) {
+				t.Errorf("expected %q to run, got %v", tt.wantCmd, recorder.commands)
+			}
+		})
+	}
+}
+
+func TestBuildCompressedRootfsErrors(t *testing.T) {
+	originalShell := shell.Default
+	defer func() { shell.Default = originalShell }()
+
+	installRoot := "/tmp/imagebuild/test"
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "rootfs": "/dev/loop0p2"}
+
+	t.Run("tool missing", func(t *testing.T) {
+		recorder := &recordingExecutor{}
+		shell.Default = recorder
+		err := buildCompressedRootfs(installRoot, diskPathIdMap, compressedRootTemplate(config.FsTypeSquashfs))
+		if err == nil || !strings.Contains(err.Error(), "mksquashfs not found") {
+			t.Fatalf("expected a missing tool error, got %v", err)
+		}
+		if recorder.hasCommand("mksquashfs") {
+			t.Error("expected mksquashfs not to run")
+		}
+	})
+
+	t.Run("partition still mounted", func(t *testing.T) {
+		recorder := &recordingExecutor{mockCommands: []shell.MockCommand{
+			{Pattern: `^command -v `, Output: "/usr/bin/mkfs.erofs\n"},
+			{Pattern: `^mount$`, Output: "/dev/loop0p1 on " + installRoot + "/boot type ext4 (rw)\n"},
+		}}
+		shell.Default = recorder
+		err := buildCompressedRootfs(installRoot, diskPathIdMap, compressedRootTemplate(config.FsTypeErofs))
+		if err == nil || !strings.Contains(err.Error(), "still mounted") {
+			t.Fatalf("expected a still mounted error, got %v", err)
+		}
+		if recorder.hasCommand("mkfs.erofs") {
+			t.Error("expected mkfs.erofs not to run")
+		}
+	})
+
+	t.Run("no root partition", func(t *testing.T) {
+		shell.Default = &recordingExecutor{}
+		err := buildCompressedRootfs(installRoot, map[string]string{"boot": "/dev/loop0p1"}, compressedRootTemplate(config.FsTypeErofs))
+		if err == nil {
+			t.Fatal("expected an error without a root partition device")
+		}
+	})
+}
+
+func TestCompressedRootPartitionIsNotMounted(t *testing.T) {
+	originalShell := shell.Default
+	defer func() { shell.Default = originalShell }()
+	recorder := &recordingExecutor{}
+	shell.Default = recorder
+
+	template := compressedRootTemplate(config.FsTypeSquashfs)
+	if !isNonMountablePartition(template.Disk.Partitions[1]) {
+		t.Error("expected a squashfs root partition not to be mounted during the installation")
+	}
+	diskPathIdMap := map[string]string{"boot": "/dev/loop0p1", "rootfs": "/dev/loop0p2"}
+	if err := mountDiskRootToChroot("/tmp/imagebuild/test", diskPathIdMap, template); err != nil {
+		t.Fatalf("mountDiskRootToChroot failed: %v", err)
+	}
+	for _, cmd := range recorder.commands {
+		if strings.Contains(cmd, "/dev/loop0p2") {
+			t.Errorf("expected the squashfs root partition not to be mounted, got %q", cmd)
+		}
+	}
+}
+
+func TestReadOnlyMountOptions(t *testing.T) {
+	tests := map[string]string{
+		"defaults":          "defaults,ro",
+		"ro":                "ro",
+		"defaults,ro":       "defaults,ro",
+		"noatime,nodev":     "noatime,nodev,ro",
+		"defaults, ro ,x=1": "defaults, ro ,x=1",
+	}
+	for options, want := range tests {
+		if got := readOnlyMountOptions(options); got != want {
+			t.Errorf("readOnlyMountOptions(%q) = %q, want %q", options, got, want)
+		}
+	}
+}
+
+func TestParseVerifyReport(t *testing.T) {
+	output := `S.5....T.  c /etc/ssh/sshd_config
+missing     /usr/bin/ping
+.M.......    /usr/lib/file with space
+??5?????? c /etc/default/grub
+dpkg: warning: systemd: unable to open /var/lib/x: No such file
+Unsatisfied dependencies for foo: bar
+`
+	files := parseVerifyReport(output)
+	want := []verifiedFile{
+		{Path: "/etc/ssh/sshd_config", Flags: "S.5....T.", Config: true},
+		{Path: "/usr/bin/ping", Flags: "missing"},
+		{Path: "/usr/lib/file with space", Flags: ".M......."},
+		{Path: "/etc/default/grub", Flags: "??5??????", Config: true},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("parseVerifyReport() = %+v, want %+v", files, want)
+	}
+}
+
+func TestVerifyInstalledFiles(t *testing.T) {
+	originalShell := shell.Default
+	defer func() { shell.Default = originalShell }()
+
+	report := `S.5....T.  c /etc/ssh/sshd_config
+..5......    /usr/bin/sudo
+..5......    /opt/vendor/cache/index.db
+missing      /usr/share/doc/bash/README
+`
+	tests := []struct {
+		name           string
+		pkgType        string
+		verify         config.FileVerification
+		verifyErr      error
+		wantCmd        string
+		wantErr        bool
+		wantFlagged    []string
+		wantNotFlagged []string
+	}{
+		{
+			name:    "disabled",
+			pkgType: "rpm",
+			verify:  config.FileVerification{},
+		},
+		{
+			name:           "rpm flags unexpected files",
+			pkgType:        "rpm",
+			verify:         config.FileVerification{Enabled: true, AllowConfigFiles: true, Allow: []string{"/opt/vendor/**"}},
+			verifyErr:      fmt.Errorf("exit status 1"),
+			wantCmd:        "rpm --root /tmp/mock-chroot-path -Va --nomtime",
+			wantErr:        true,
+			wantFlagged:    []string{"/usr/bin/sudo", "/usr/share/doc/bash/README"},
+			wantNotFlagged: []string{"/etc/ssh/sshd_config", "/opt/vendor/cache/index.db"},
+		},
+		{
+			name:    "deb with everything allowed",
+			pkgType: "deb",
+			verify: config.FileVerification{Enabled: true, AllowConfigFiles: true,
+				Allow: []string{"/opt/vendor/**", "/usr/bin/sudo", "/usr/share/doc/*/README"}},
+			verifyErr: fmt.Errorf("exit status 1"),
+			wantCmd:   "dpkg --verify",
+		},
+		{
+			name:        "config files are not allowed by default",
+			pkgType:     "deb",
+			verify:      config.FileVerification{Enabled: true, Allow: []string{"/opt/vendor/**", "/usr/bin/sudo", "/usr/share/doc/*/README"}},
+			wantCmd:     "dpkg --verify",
+			wantErr:     true,
+			wantFlagged: []string{"/etc/ssh/sshd_config"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingExecutor{mockCommands: []shell.MockCommand{
+				{Pattern: `--verify|-Va`, Output: report, Error: tt.verifyErr},
+			}}
+			shell.Default = recorder
+			imageOs := &ImageOs{chrootEnv: &MockChrootEnv{pkgType: tt.pkgType}}
+			template := &config.ImageTemplate{}
+			template.SystemConfig.VerifyFiles = tt.verify
+
+			err := imageOs.verifyInstalledFiles("/tmp/install-root", template)
+			if tt.wantCmd == "" {
+				if err != nil || len(recorder.commands) != 0 {
+					t.Fatalf("expected no verification, got err %v and commands %v", err, recorder.commands)
+				}
+				return
+			}
+			if !recorder.hasCommand(tt.wantCmd) {
+				t.Errorf("expected %q to run, got %v", tt.wantCmd, recorder.commands)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyInstalledFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, path := range tt.wantFlagged {
+				if !strings.Contains(err.Error(), path) {
+					t.Errorf("expected %s to be flagged, got %v", path, err)
+				}
+			}
+			for _, path := range tt.wantNotFlagged {
+				if strings.Contains(err.Error(), path) {
+					t.Errorf("expected allowed %s not to be flagged, got %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyInstalledFilesCommandFailure(t *testing.T) {
+	originalShell := shell.Default
+	defer func() { shell.Default = originalShell }()
+	shell.Default = &recordingExecutor{mockCommands: []shell.MockCommand{
+		{Pattern: `dpkg --verify`, Output: "dpkg: error: cannot access archive\n", Error: fmt.Errorf("exit status 2")},
+	}}
+
+	imageOs := &ImageOs{chrootEnv: &MockChrootEnv{pkgType: "deb"}}
+	template := &config.ImageTemplate{}
+	template.SystemConfig.VerifyFiles.Enabled = true
+	err := imageOs.verifyInstalledFiles("/tmp/install-root", template)
+	if err == nil || !strings.Contains(err.Error(), "failed to verify installed files") {
+		t.Fatalf("expected a verification command error, got %v", err)
+	}
+}
+
+func TestInstallImageOsResumeSkipsCompletedStages(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	recorder := &recordingExecutor{}
+	shell.Default = recorder
+
+	imageOs, _ := newPanicInstallImageOs(t)
+	checkpoint, err := config.NewBuildCheckpoint(filepath.Join(t.TempDir(), "build-checkpoint.json"), imageOs.template)
+	if err != nil {
+		t.Fatalf("failed to create build checkpoint: %v", err)
+	}
+	checkpoint.Complete(config.StageResolve, config.StageDownload, config.StageInstall)
+	imageOs.template.Checkpoint = checkpoint
+
+	// The package installation panics if it runs, and the bootloader
+	// installation without an image boot after the config stage
+	_, err = imageOs.InstallImageOs(map[string]string{"root": "/dev/loop9p1"})
+	if err == nil || !strings.Contains(err.Error(), "panic during bootloader installation") {
+		t.Fatalf("expected the resumed install to start at the config stage and stop at the boot stage, got %v", err)
+	}
+	if !recorder.hasCommand("mount -t ext4 /dev/loop9p1 " + imageOs.installRoot) {
+		t.Errorf("expected the root partition of the resumed image to be mounted, got %v", recorder.commands)
+	}
+	want := []string{config.StageResolve, config.StageDownload, config.StageInstall, config.StageConfig}
+	if !reflect.DeepEqual(checkpoint.Completed, want) {
+		t.Errorf("completed stages = %v, want %v", checkpoint.Completed, want)
+	}
+	if stage := checkpoint.ResumeStage(); stage != config.StageBoot {
+		t.Errorf("ResumeStage() = %q, want %q", stage, config.StageBoot)
+	}
+}
+
+func TestLockUserPassword(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	executor := &fileOpExecutor{}
+	shell.Default = executor
+
+	installRoot := t.TempDir()
+	shadowPath := filepath.Join(installRoot, "etc", "shadow")
+	if err := os.MkdirAll(filepath.Dir(shadowPath), 0755); err != nil {
+		t.Fatalf("failed to create etc directory: %v", err)
+	}
+	shadow := "root::19000:0:99999:7:::\nadmin:$6$salt$hash:19000:0:99999:7:::\n"
+	if err := os.WriteFile(shadowPath, []byte(shadow), 0600); err != nil {
+		t.Fatalf("failed to write shadow file: %v", err)
+	}
+
+	for _, user := range []string{"root", "admin", "root"} {
+		if err := lockUserPassword(installRoot, user); err != nil {
+			t.Fatalf("lockUserPassword(%s) failed: %v", user, err)
+		}
+	}
+	data, err := os.ReadFile(shadowPath)
+	if err != nil {
+		t.Fatalf("failed to read shadow file: %v", err)
+	}
+	want := "root:!:19000:0:99999:7:::\nadmin:!$6$salt$hash:19000:0:99999:7:::\n"
+	if string(data) != want {
+		t.Errorf("shadow file = %q, want %q", data, want)
+	}
+	if info, err := os.Stat(shadowPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the shadow file mode to be kept, got %v (%v)", info.Mode().Perm(), err)
+	}
+	if !executor.hasCommand("cat "+shadowPath) || !slices.ContainsFunc(executor.commands, func(cmd string) bool {
+		return strings.HasPrefix(cmd, "cp ") && strings.HasSuffix(cmd, "'"+shadowPath+"'")
+	}) {
+		t.Errorf("expected the shadow file to be read and written through the shell, got %v", executor.commands)
+	}
+
+	if err := lockUserPassword(installRoot, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a missing user error, got %v", err)
+	}
+}
+
+func TestCreateUserLocked(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	recorder := &fileOpExecutor{}
+	shell.Default = recorder
+
+	installRoot := t.TempDir()
+	shadowPath := filepath.Join(installRoot, "etc", "shadow")
+	if err := os.MkdirAll(filepath.Dir(shadowPath), 0755); err != nil {
+		t.Fatalf("failed to create etc directory: %v", err)
+	}
+	if err := os.WriteFile(shadowPath, []byte("root:*:19000:0:99999:7:::\n"), 0600); err != nil {
+		t.Fatalf("failed to write shadow file: %v", err)
+	}
+
+	template := createTestImageTemplate()
+	template.SystemConfig.Users = []config.UserConfig{{Name: "root", Locked: true}}
+	if err := createUser(installRoot, template); err != nil {
+		t.Fatalf("createUser failed: %v", err)
+	}
+
+	data, err := os.ReadFile(shadowPath)
+	if err != nil {
+		t.Fatalf("failed to read shadow file: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "root:!*:") {
+		t.Errorf("expected the root shadow entry to be locked, got %q", data)
+	}
+	if recorder.hasCommand("passwd") {
+		t.Errorf("expected no password to be set or deleted for a locked user, got %v", recorder.commands)
+	}
+}
+
+func TestUpdateImageSSHConfig(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = &fileOpExecutor{}
+
+	template := createTestImageTemplate()
+
+	t.Run("disabled", func(t *testing.T) {
+		installRoot := t.TempDir()
+		if err := updateImageSSHConfig(installRoot, template); err != nil {
+			t.Fatalf("updateImageSSHConfig failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(installRoot, sshdDropInPath)); !os.IsNotExist(err) {
+			t.Errorf("expected no sshd drop-in, got %v", err)
+		}
+	})
+
+	template.SystemConfig.SSH.DisablePasswordAuth = true
+
+	for _, tc := range []struct {
+		name       string
+		sshdConfig string
+		wantConfig string
+	}{
+		{
+			name:       "config with include",
+			sshdConfig: "Include /etc/ssh/sshd_config.d/*.conf\nPasswordAuthentication yes\n",
+			wantConfig: "Include /etc/ssh/sshd_config.d/*.conf\nPasswordAuthentication yes\n",
+		},
+		{
+			name:       "config without include",
+			sshdConfig: "PasswordAuthentication yes\n",
+			wantConfig: "Include /etc/ssh/sshd_config.d/*.conf\nPasswordAuthentication yes\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			installRoot := t.TempDir()
+			configPath := filepath.Join(installRoot, "etc", "ssh", "sshd_config")
+			if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+				t.Fatalf("failed to create ssh directory: %v", err)
+			}
+			if err := os.WriteFile(configPath, []byte(tc.sshdConfig), 0600); err != nil {
+				t.Fatalf("failed to write sshd_config: %v", err)
+			}
+
+			if err := updateImageSSHConfig(installRoot, template); err != nil {
+				t.Fatalf("updateImageSSHConfig failed: %v", err)
+			}
+
+			dropIn, err := os.ReadFile(filepath.Join(installRoot, sshdDropInPath))
+			if err != nil {
+				t.Fatalf("expected the sshd drop-in to be written: %v", err)
+			}
+			if !strings.Contains(string(dropIn), "PasswordAuthentication no\n") {
+				t.Errorf("expected the drop-in to disable password login, got %q", dropIn)
+			}
+			sshdConfig, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("failed to read sshd_config: %v", err)
+			}
+			if string(sshdConfig) != tc.wantConfig {
+				t.Errorf("sshd_config = %q, want %q", sshdConfig, tc.wantConfig)
+			}
+		})
+	}
+}
+
+func TestUpdateImageSSHHostKeys(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	newInstallRoot := func(t *testing.T) (string, []string) {
+		t.Helper()
+		installRoot := t.TempDir()
+		sshDir := filepath.Join(installRoot, "etc", "ssh")
+		if err := os.MkdirAll(sshDir, 0755); err != nil {
+			t.Fatalf("failed to create ssh directory: %v", err)
+		}
+		var buildKeys []string
+		for _, name := range []string{"ssh_host_ed25519_key", "ssh_host_ed25519_key.pub"} {
+			keyPath := filepath.Join(sshDir, name)
+			if err := os.WriteFile(keyPath, []byte("build key\n"), 0600); err != nil {
+				t.Fatalf("failed to write host key: %v", err)
+			}
+			buildKeys = append(buildKeys, keyPath)
+		}
+		return installRoot, buildKeys
+	}
+
+	t.Run("no ssh", func(t *testing.T) {
+		recorder := &recordingExecutor{}
+		shell.Default = recorder
+		if err := updateImageSSHHostKeys(t.TempDir(), createTestImageTemplate()); err != nil {
+			t.Fatalf("updateImageSSHHostKeys failed: %v", err)
+		}
+		if len(recorder.commands) != 0 {
+			t.Errorf("expected no commands without /etc/ssh, got %v", recorder.commands)
+		}
+	})
+
+	t.Run("regenerate", func(t *testing.T) {
+		recorder := &recordingExecutor{}
+		shell.Default = recorder
+		installRoot, buildKeys := newInstallRoot(t)
+		if err := updateImageSSHHostKeys(installRoot, createTestImageTemplate()); err != nil {
+			t.Fatalf("updateImageSSHHostKeys failed: %v", err)
+		}
+
+		unitPath := filepath.Join(installRoot, "etc", "systemd", "system", sshKeygenUnit)
+		for _, want := range []string{
+			"rm -f " + strings.Join(buildKeys, " "),
+			"chmod 0644 " + unitPath,
+			"systemctl enable --root=\"" + installRoot + "\" " + sshKeygenUnit,
+		} {
+			if !slices.Contains(recorder.commands, want) {
+				t.Errorf("expected command %q, got %v", want, recorder.commands)
+			}
+		}
+		if !slices.ContainsFunc(recorder.commands, func(cmd string) bool {
+			return strings.HasPrefix(cmd, "cp ") && strings.HasSuffix(cmd, "'"+unitPath+"'")
+		}) {
+			t.Errorf("expected the regeneration unit to be written to %s, got %v", unitPath, recorder.commands)
+		}
+		for _, line := range []string{"ExecStart=/usr/bin/ssh-keygen -A", "Before=ssh.service sshd.service", "WantedBy=multi-user.target"} {
+			if !strings.Contains(sshKeygenUnitContent, line+"\n") {
+				t.Errorf("expected the regeneration unit to contain %q", line)
+			}
+		}
+	})
+
+	t.Run("inject", func(t *testing.T) {
+		recorder := &recordingExecutor{}
+		shell.Default = recorder
+		installRoot, buildKeys := newInstallRoot(t)
+		keyDir := t.TempDir()
+		key := filepath.Join(keyDir, "ssh_host_rsa_key")
+		for _, keyPath := range []string{key, key + ".pub"} {
+			if err := os.WriteFile(keyPath, []byte("provided key\n"), 0600); err != nil {
+				t.Fatalf("failed to write host key: %v", err)
+			}
+		}
+		template := createTestImageTemplate()
+		template.SystemConfig.SSH.HostKeys = config.SSHHostKeys{Mode: config.SSHHostKeysInject, Keys: []string{key}}
+		if err := updateImageSSHHostKeys(installRoot, template); err != nil {
+			t.Fatalf("updateImageSSHHostKeys failed: %v", err)
+		}
+
+		imageKey := filepath.Join(installRoot, "etc", "ssh", "ssh_host_rsa_key")
+		for _, want := range []string{
+			"rm -f " + strings.Join(buildKeys, " "),
+			"cp '" + key + "' '" + imageKey + "'",
+			"chown root:root " + imageKey,
+			"chmod 0600 " + imageKey,
+			"cp '" + key + ".pub' '" + imageKey + ".pub'",
+			"chown root:root " + imageKey + ".pub",
+			"chmod 0644 " + imageKey + ".pub",
+		} {
+			if !slices.Contains(recorder.commands, want) {
+				t.Errorf("expected command %q, got %v", want, recorder.commands)
+			}
+		}
+		for _, cmd := range recorder.commands {
+			if strings.Contains(cmd, sshKeygenUnit) {
+				t.Errorf("expected no regeneration unit in inject mode, got %q", cmd)
+			}
+		}
+	})
+}
+
+func TestAddBuildMetadataFile(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = &fileOpExecutor{}
+
+	template := createTestImageTemplate()
+	template.PathList = []string{"/defaults/default-raw-x86_64.yml", "/templates/my-image.yml"}
+
+	readMetadata := func(t *testing.T, installRoot string) BuildMetadata {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(installRoot, buildMetadataPath))
+		if err != nil {
+			t.Fatalf("expected the build metadata file to be written: %v", err)
+		}
+		var metadata BuildMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			t.Fatalf("invalid build metadata %q: %v", data, err)
+		}
+		return metadata
+	}
+
+	t.Run("fields", func(t *testing.T) {
+		t.Setenv("SOURCE_DATE_EPOCH", "")
+		installRoot := t.TempDir()
+		before := time.Now().UTC().Truncate(time.Second)
+		if err := addBuildMetadataFile(installRoot, template); err != nil {
+			t.Fatalf("addBuildMetadataFile failed: %v", err)
+		}
+		metadata := readMetadata(t, installRoot)
+
+		buildDate, err := time.Parse(time.RFC3339, metadata.BuildDate)
+		if err != nil || buildDate.Before(before) || buildDate.After(time.Now().UTC()) {
+			t.Errorf("expected the current time as build date, got %q (%v)", metadata.BuildDate, err)
+		}
+		metadata.BuildDate = ""
+		want := BuildMetadata{
+			Template:        "my-image.yml",
+			ImageName:       "test-image",
+			ImageVersion:    "1.0.0",
+			OS:              "linux",
+			Dist:            "test",
+			Arch:            "x86_64",
+			ImageType:       "qcow2",
+			ComposerVersion: version.Version,
+			ComposerCommit:  version.CommitSHA,
+		}
+		if metadata != want {
+			t.Errorf("build metadata = %+v, want %+v", metadata, want)
+		}
+	})
+
+	t.Run("reproducible", func(t *testing.T) {
+		t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+		for i := 0; i < 2; i++ {
+			installRoot := t.TempDir()
+			if err := addBuildMetadataFile(installRoot, template); err != nil {
+				t.Fatalf("addBuildMetadataFile failed: %v", err)
+			}
+			if got := readMetadata(t, installRoot).BuildDate; got != "2023-11-14T22:13:20Z" {
+				t.Errorf("expected the build date pinned to SOURCE_DATE_EPOCH, got %q", got)
+			}
+		}
+	})
+}
+
+func TestWarnIfNoLoginPath(t *testing.T) {
+	keys := config.AdditionalFileInfo{Local: "keys", Final: "/home/admin/.ssh/authorized_keys"}
+	tests := []struct {
+		name     string
+		users    []config.UserConfig
+		files    []config.AdditionalFileInfo
+		wantWarn bool
+	}{
+		{
+			name:  "root not locked",
+			users: []config.UserConfig{{Name: "root"}},
+		},
+		{
+			name:     "root locked without other users",
+			users:    []config.UserConfig{{Name: "root", Locked: true}},
+			wantWarn: true,
+		},
+		{
+			name:  "sudo user with keys",
+			users: []config.UserConfig{{Name: "root", Locked: true}, {Name: "admin", Sudo: true}},
+			files: []config.AdditionalFileInfo{keys},
+		},
+		{
+			name:     "sudo user without keys",
+			users:    []config.UserConfig{{Name: "root", Locked: true}, {Name: "admin", Sudo: true}},
+			wantWarn: true,
+		},
+		{
+			name:     "user with keys but no sudo",
+			users:    []config.UserConfig{{Name: "root", Locked: true}, {Name: "admin"}},
+			files:    []config.AdditionalFileInfo{keys},
+			wantWarn: true,
+		},
+		{
+			name:  "keys in custom home",
+			users: []config.UserConfig{{Name: "root", Locked: true}, {Name: "ops", Sudo: true, Home: "/var/ops"}},
+			files: []config.AdditionalFileInfo{{Local: "keys", Final: "/var/ops/.ssh/authorized_keys"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := createTestImageTemplate()
+			template.SystemConfig.Users = tt.users
+			template.SystemConfig.AdditionalFiles = tt.files
+
+			logger.StartWarningCapture()
+			warnIfNoLoginPath(template)
+			warnings := logger.StopWarningCapture()
+
+			warned := slices.ContainsFunc(warnings, func(msg string) bool {
+				return strings.Contains(msg, "no usable login path")
+			})
+			if warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v (warnings: %v)", warned, tt.wantWarn, warnings)
+			}
+		})
+	}
+}
+
+func TestRegisterBinfmtFallback(t *testing.T) {
+	originalExecutor := shell.Default
+	originalMiscDir, originalBinDir := binfmtMiscDir, qemuBinDir
+	defer func() {
+		shell.Default = originalExecutor
+		binfmtMiscDir, qemuBinDir = originalMiscDir, originalBinDir
+	}()
+
+	// No binfmt service is available, as on hosts without systemd
+	recorder := &recordingExecutor{mockCommands: []shell.MockCommand{
+		{Pattern: "systemctl restart", Error: fmt.Errorf("System has not been booted with systemd")},
+	}}
+	shell.Default = recorder
+	qemuBinDir = t.TempDir()
+
+	tests := []struct {
+		arch      string
+		magicByte string
+	}{
+		{arch: "aarch64", magicByte: `\xb7`},
+		{arch: "x86_64", magicByte: `\x3e`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			binfmtMiscDir = t.TempDir()
+			registerPath := filepath.Join(binfmtMiscDir, "register")
+			if err := os.WriteFile(registerPath, nil, 0200); err != nil {
+				t.Fatalf("failed to create register file: %v", err)
+			}
+			interpreter := filepath.Join(qemuBinDir, "qemu-"+tt.arch+"-static")
+			if err := os.WriteFile(interpreter, nil, 0755); err != nil {
+				t.Fatalf("failed to create interpreter: %v", err)
+			}
+
+			if err := registerBinfmt(tt.arch); err != nil {
+				t.Fatalf("registerBinfmt failed: %v", err)
+			}
+			for _, service := range binfmtServices {
+				if !recorder.hasCommand("systemctl restart " + service) {
+					t.Errorf("expected %s to be tried first, got %v", service, recorder.commands)
+				}
+			}
+
+			data, err := os.ReadFile(registerPath)
+			if err != nil {
+				t.Fatalf("failed to read register file: %v", err)
+			}
+			fields := strings.Split(string(data), ":")
+			if len(fields) != 8 || fields[0] != "" || fields[3] != "" {
+				t.Fatalf("malformed registration %q", data)
+			}
+			if fields[1] != "qemu-"+tt.arch || fields[2] != "M" || fields[6] != interpreter || fields[7] != "F" {
+				t.Errorf("unexpected registration %q", data)
+			}
+			magic, mask := fields[4], fields[5]
+			if !strings.HasPrefix(magic, `\x7fELF\x02`) || !strings.HasSuffix(magic, tt.magicByte+`\x00`) {
+				t.Errorf("unexpected magic %q for %s", magic, tt.arch)
+			}
+			if !regexp.MustCompile(`^(\\x[0-9a-f]{2})+$`).MatchString(mask) || len(mask) != len(`\x7f`)*20 {
+				t.Errorf("malformed mask %q", mask)
+			}
+			// 16 bytes of e_ident, then e_type and e_machine
+			escapes := strings.Count(magic, `\x`)
+			if escapes+len(magic)-len(`\x7f`)*escapes != 20 {
+				t.Errorf("magic %q does not match the 20 byte mask", magic)
+			}
+		})
+	}
+
+	t.Run("already registered", func(t *testing.T) {
+		binfmtMiscDir = t.TempDir()
+		if err := os.WriteFile(filepath.Join(binfmtMiscDir, "qemu-aarch64"), []byte("enabled\n"), 0644); err != nil {
+			t.Fatalf("failed to create binfmt entry: %v", err)
+		}
+		recorder.commands = nil
+		if err := registerBinfmt("aarch64"); err != nil {
+			t.Fatalf("registerBinfmt failed: %v", err)
+		}
+		if len(recorder.commands) != 0 {
+			t.Errorf("expected no command for a registered entry, got %v", recorder.commands)
+		}
+	})
+
+	if err := registerBinfmt("riscv64"); err == nil {
+		t.Error("expected error for unsupported architecture")
+	}
+}
+
+func TestUpdateImageFstabExtraEntries(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	recorder := &recordingExecutor{}
+	shell.Default = recorder
+
+	entries := []string{
+		"tmpfs /tmp tmpfs defaults,nosuid,nodev,size=512M 0 0",
+		"/data/logs /var/log none bind 0 0",
+	}
+	content := extraFstabEntriesContent(entries)
+	for _, entry := range entries {
+		if !strings.Contains(content, "\n"+entry+"\n") {
+			t.Errorf("expected fstab content to contain %q, got:\n%s", entry, content)
+		}
+	}
+
+	installRoot := t.TempDir()
+	template := &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{ExtraFstabEntries: entries},
+	}
+	if err := updateImageFstab(installRoot, map[string]string{}, template); err != nil {
+		t.Fatalf("updateImageFstab failed: %v", err)
+	}
+	fstabPath := filepath.Join(installRoot, "etc", "fstab")
+	if !slices.ContainsFunc(recorder.commands, func(cmd string) bool {
+		return strings.HasSuffix(cmd, "tee -a "+fstabPath+" >/dev/null")
+	}) {
+		t.Errorf("expected the extra entries to be appended to %s, got %v", fstabPath, recorder.commands)
+	}
+
+	recorder.commands = nil
+	template.SystemConfig.ExtraFstabEntries = nil
+	if err := updateImageFstab(installRoot, map[string]string{}, template); err != nil {
+		t.Fatalf("updateImageFstab failed: %v", err)
+	}
+	if len(recorder.commands) != 0 {
+		t.Errorf("expected nothing appended without extra entries, got %v", recorder.commands)
+	}
+}
+
+func TestConfigureSlimExcludes(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	slim := config.SlimOptions{StripDocs: true, KeepLocales: []string{"en_US.UTF-8"}}
+	dpkgConfig := slimDpkgConfigContent(slim)
+	for _, line := range []string{
+		"path-exclude=/usr/share/doc/*",
+		"path-exclude=/usr/share/man/*",
+		"path-exclude=/usr/share/locale/*",
+		"path-include=/usr/share/locale/en_US/*",
+		"path-include=/usr/share/locale/en/*",
+	} {
+		if !strings.Contains(dpkgConfig, line+"\n") {
+			t.Errorf("expected dpkg excludes to contain %q, got:\n%s", line, dpkgConfig)
+		}
+	}
+	rpmMacros := slimRpmMacrosContent(slim)
+	for _, line := range []string{"%_excludedocs 1", "%_install_langs en_US.UTF-8:en_US:en"} {
+		if !strings.Contains(rpmMacros, line+"\n") {
+			t.Errorf("expected rpm macros to contain %q, got:\n%s", line, rpmMacros)
+		}
+	}
+
+	chrootMacrosPath := "/tmp/chroot-host/etc/rpm/macros.image-composer-slim"
+	tests := []struct {
+		name        string
+		pkgType     string
+		imagePath   string
+		chrootPaths []string
+	}{
+		{name: "deb", pkgType: "deb", imagePath: "/etc/dpkg/dpkg.cfg.d/01-image-composer-slim"},
+		{name: "rpm", pkgType: "rpm", imagePath: "/etc/rpm/macros.image-composer-slim", chrootPaths: []string{chrootMacrosPath}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingExecutor{}
+			shell.Default = recorder
+			installRoot := t.TempDir()
+			imageOs := &ImageOs{chrootEnv: &MockChrootEnv{
+				pkgType:  tt.pkgType,
+				hostPath: chrootMacrosPath,
+			}}
+			template := &config.ImageTemplate{SystemConfig: config.SystemConfig{Slim: slim}}
+			if err := imageOs.configureSlimExcludes(installRoot, template); err != nil {
+				t.Fatalf("configureSlimExcludes failed: %v", err)
+			}
+			for _, destPath := range append([]string{filepath.Join(installRoot, tt.imagePath)}, tt.chrootPaths...) {
+				if !slices.ContainsFunc(recorder.commands, func(cmd string) bool {
+					return strings.HasPrefix(cmd, "cp ") && strings.HasSuffix(cmd, "'"+destPath+"'")
+				}) {
+					t.Errorf("expected the excludes to be written to %s, got %v", destPath, recorder.commands)
+				}
+			}
+
+			recorder.commands = nil
+			template.SystemConfig.Slim = config.SlimOptions{}
+			if err := imageOs.configureSlimExcludes(installRoot, template); err != nil {
+				t.Fatalf("configureSlimExcludes failed: %v", err)
+			}
+			if len(recorder.commands) != 0 {
+				t.Errorf("expected nothing written without slim options, got %v", recorder.commands)
+			}
+		})
+	}
+}
+
+func TestRemoveSlimFiles(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	recorder := &recordingExecutor{}
+	shell.Default = recorder
+
+	installRoot := t.TempDir()
+	localeDir := filepath.Join(installRoot, "usr", "share", "locale")
+	for _, locale := range []string{"de", "en", "en_US", "fr_FR"} {
+		if err := os.MkdirAll(filepath.Join(localeDir, locale, "LC_MESSAGES"), 0755); err != nil {
+			t.Fatalf("failed to create locale directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(localeDir, "locale.alias"), []byte("german de_DE.ISO-8859-1\n"), 0644); err != nil {
+		t.Fatalf("failed to write locale.alias: %v", err)
+	}
+
+	imageOs := &ImageOs{chrootEnv: &MockChrootEnv{pkgType: "deb"}}
+	template := &config.ImageTemplate{SystemConfig: config.SystemConfig{
+		Slim: config.SlimOptions{StripDocs: true, KeepLocales: []string{"en_US.UTF-8"}},
+	}}
+	if err := imageOs.removeSlimFiles(installRoot, template); err != nil {
+		t.Fatalf("removeSlimFiles failed: %v", err)
+	}
+
+	for _, dir := range []string{"usr/share/doc", "usr/share/man", "usr/share/info", "usr/share/locale/de", "usr/share/locale/fr_FR"} {
+		if !slices.Contains(recorder.commands, "rm -rf "+filepath.Join(installRoot, dir)) {
+			t.Errorf("expected %s to be removed, got %v", dir, recorder.commands)
+		}
+	}
+	for _, kept := range []string{"usr/share/locale/en", "usr/share/locale/en_US", "usr/share/locale/locale.alias"} {
+		if slices.Contains(recorder.commands, "rm -rf "+filepath.Join(installRoot, kept)) {
+			t.Errorf("expected %s to be kept, got %v", kept, recorder.commands)
+		}
+	}
+
+	if !isSlimDroppedFile("/usr/share/locale/de/LC_MESSAGES/coreutils.mo", template.SystemConfig.Slim) ||
+		isSlimDroppedFile("/usr/share/locale/en/LC_MESSAGES/coreutils.mo", template.SystemConfig.Slim) ||
+		!isSlimDroppedFile("/usr/share/man/man1/ls.1.gz", template.SystemConfig.Slim) ||
+		isSlimDroppedFile("/usr/bin/ls", template.SystemConfig.Slim) {
+		t.Error("expected file verification to skip exactly the files dropped by the slim options")
+	}
+}
+
+// fileOpExecutor records every command and runs the file operations for
+// real, so that changes to a test image can be checked. Commands matching a
+// mock are not run.
+type fileOpExecutor struct {
+	recordingExecutor
+}
+
+func (e *fileOpExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.commands = append(e.commands, cmdStr)
+	for _, mockCmd := range e.mockCommands {
+		if matched, _ := regexp.MatchString(mockCmd.Pattern, cmdStr); matched {
+			return mockCmd.Output, mockCmd.Error
+		}
+	}
+	for _, prefix := range []string{"mkdir ", "cp ", "rm ", "chmod ", "cat "} {
+		if strings.HasPrefix(cmdStr, prefix) {
+			output, err := exec.Command("bash", "-c", cmdStr).CombinedOutput()
+			if err != nil {
+				return string(output), fmt.Errorf("%s: %w", output, err)
+			}
+			return string(output), nil
+		}
+	}
+	return "", nil
+}
+
+func (e *fileOpExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *fileOpExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *fileOpExecutor) ExecCmdWithInput(inputStr string, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func TestUpdateImageConfigRollback(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = t.TempDir()
+	config.SetGlobal(newGlobal)
+
+	appliedSteps := []string{"hostname", "additional files", "users", "SSH config", "additional file attributes",
+		"network", "name resolution", "image ID", "build metadata"}
+
+	tests := []struct {
+		name        string
+		restoreErr  error
+		wantPartial bool
+	}{
+		{name: "rolled back"},
+		{name: "rollback failure", restoreErr: fmt.Errorf("exit status 1"), wantPartial: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installRoot := t.TempDir()
+			etcDir := filepath.Join(installRoot, "etc")
+			if err := os.MkdirAll(etcDir, 0755); err != nil {
+				t.Fatalf("failed to create etc directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(etcDir, "hostname"), []byte("localhost\n"), 0644); err != nil {
+				t.Fatalf("failed to write hostname: %v", err)
+			}
+
+			template := &config.ImageTemplate{
+				Image:        config.ImageInfo{Name: "test-image"},
+				SystemConfig: config.SystemConfig{Name: "test-system", HostName: "configured-host"},
+				Disk: config.DiskConfig{Partitions: []config.PartitionInfo{
+					{ID: "root", FsType: "ext4", MountPoint: "/"},
+				}},
+			}
+			checkpoint, err := config.NewBuildCheckpoint(filepath.Join(t.TempDir(), "build-checkpoint.json"), template)
+			if err != nil {
+				t.Fatalf("failed to create build checkpoint: %v", err)
+			}
+
+			mockCommands := []shell.MockCommand{
+				// The fstab step fails getting the partition UUID
+				{Pattern: "^blkid ", Error: fmt.Errorf("exit status 2")},
+			}
+			if tt.restoreErr != nil {
+				mockCommands = append(mockCommands, shell.MockCommand{
+					Pattern: "^cp -a '.*/etc' '" + regexp.QuoteMeta(etcDir) + "'$", Error: tt.restoreErr,
+				})
+			}
+			executor := &fileOpExecutor{recordingExecutor{mockCommands: mockCommands}}
+			shell.Default = executor
+
+			err = updateImageConfig(installRoot, map[string]string{"root": "/dev/loop9p1"}, template, checkpoint)
+			if err == nil || !strings.Contains(err.Error(), "failed to update image fstab") {
+				t.Fatalf("expected the fstab step to fail, got %v", err)
+			}
+
+			if checkpoint.IsCompleted(config.StageConfig) {
+				t.Error("expected the config stage to be incomplete")
+			}
+			if !reflect.DeepEqual(checkpoint.ConfigSteps, appliedSteps) {
+				t.Errorf("ConfigSteps = %v, want %v", checkpoint.ConfigSteps, appliedSteps)
+			}
+			if !executor.hasCommand("cp '") || !executor.hasCommand("rm -rf '"+etcDir+"'") {
+				t.Errorf("expected the hostname to be written and /etc to be restored, got %v", executor.commands)
+			}
+
+			if tt.wantPartial {
+				if checkpoint.PartialStage != config.StageConfig || !strings.Contains(err.Error(), "rollback errors") {
+					t.Errorf("expected the config stage to be marked partial, got %q and %v", checkpoint.PartialStage, err)
+				}
+				return
+			}
+			if checkpoint.PartialStage != "" {
+				t.Errorf("expected no partial stage after a rollback, got %q", checkpoint.PartialStage)
+			}
+			hostname, err := os.ReadFile(filepath.Join(etcDir, "hostname"))
+			if err != nil || string(hostname) != "localhost\n" {
+				t.Errorf("expected the hostname change to be rolled back, got %q, %v", hostname, err)
+			}
+			if _, err := os.Stat(filepath.Join(etcDir, "image-id")); !os.IsNotExist(err) {
+				t.Errorf("expected the image ID file to be rolled back, got %v", err)
+			}
+			if entries, _ := os.ReadDir(config.TempDir()); len(entries) != 0 {
+				t.Errorf("expected the /etc backup to be removed, got %v", entries)
+			}
+		})
+	}
+}
+
+// runDiskImageConfig applies the config stage of a disk image with the root
+// partition /dev/loop9p1 to installRoot, running its file operations for real
+func runDiskImageConfig(t *testing.T, installRoot string, template *config.ImageTemplate) {
+	t.Helper()
+	originalExecutor := shell.Default
+	t.Cleanup(func() { shell.Default = originalExecutor })
+	shell.Default = &fileOpExecutor{recordingExecutor{mockCommands: []shell.MockCommand{
+		{Pattern: "^blkid ", Output: "11111111-2222-3333-4444-555555555555\n"},
+		{Pattern: "sudo tee -a ", Output: ""},
+	}}}
+
+	template.Disk = config.DiskConfig{Partitions: []config.PartitionInfo{
+		{ID: "root", FsType: "ext4", MountPoint: "/"},
+	}}
+	if err := updateImageConfig(installRoot, map[string]string{"root": "/dev/loop9p1"}, template, nil); err != nil {
+		t.Fatalf("updateImageConfig failed: %v", err)
+	}
+}
+
+// TestUpdateImageConfigSSH tests that the config stage of disk images writes
+// the sshd drop-in disabling password login
+func TestUpdateImageConfigSSH(t *testing.T) {
+	installRoot := t.TempDir()
+	configPath := filepath.Join(installRoot, "etc", "ssh", "sshd_config")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		t.Fatalf("failed to create ssh directory: %v", err)
+	}
+	if err := os.WriteFile(configPath, []byte("Include /etc/ssh/sshd_config.d/*.conf\n"), 0644); err != nil {
+		t.Fatalf("failed to write sshd_config: %v", err)
+	}
+
+	template := &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{Name: "test-system", SSH: config.SSHConfig{DisablePasswordAuth: true}},
+	}
+	runDiskImageConfig(t, installRoot, template)
+
+	dropIn, err := os.ReadFile(filepath.Join(installRoot, sshdDropInPath))
+	if err != nil {
+		t.Fatalf("expected the sshd drop-in to be written: %v", err)
+	}
+	if string(dropIn) != sshdDropInContent {
+		t.Errorf("sshd drop-in = %q, want %q", dropIn, sshdDropInContent)
+	}
+}
+
+// TestUpdateImageConfigBuildMetadata tests that the config stage of disk
+// images writes the build metadata file
+func TestUpdateImageConfigBuildMetadata(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	installRoot := t.TempDir()
+	template := &config.ImageTemplate{
+		Image:        config.ImageInfo{Name: "test-image", Version: "1.0.0"},
+		Target:       config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64", ImageType: "raw"},
+		SystemConfig: config.SystemConfig{Name: "test-system"},
+	}
+	runDiskImageConfig(t, installRoot, template)
+
+	data, err := os.ReadFile(filepath.Join(installRoot, buildMetadataPath))
+	if err != nil {
+		t.Fatalf("expected the build metadata file to be written: %v", err)
+	}
+	var metadata BuildMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatalf("invalid build metadata %q: %v", data, err)
+	}
+	if metadata.ImageType != "raw" || metadata.BuildDate != "2023-11-14T22:13:20Z" {
+		t.Errorf("expected the metadata of the raw image built at SOURCE_DATE_EPOCH, got %+v", metadata)
+	}
+}
+
+func TestInstallImagePkgsImportsRepoGPGKeys(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	originalRepoCfg := rpmutils.RepoCfg
+	originalUserRepo := rpmutils.UserRepo
+	defer func() {
+		rpmutils.RepoCfg = originalRepoCfg
+		rpmutils.UserRepo = originalUserRepo
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.asc" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("-----BEGIN PGP PUBLIC KEY BLOCK-----\nkey\n-----END PGP PUBLIC KEY BLOCK-----\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		repoCfg       rpmutils.RepoConfig
+		userRepo      []config.PackageRepository
+		mockCommands  []shell.MockCommand
+		errorContains string
+		expectCmds    []string
+	}{
+		{
+			name:     "Keys imported before installs",
+			repoCfg:  rpmutils.RepoConfig{GPGCheck: true, GPGKey: server.URL + "/base.asc"},
+			userRepo: []config.PackageRepository{{URL: server.URL + "/vendor", PKey: server.URL + "/vendor.asc"}},
+			expectCmds: []string{
+				"rpm --root /workspace/rootfs --initdb",
+				"rpm --root /workspace/rootfs --import /tmp/image-rpm-gpg-key-0.asc",
+				"rm -f",
+				"rpm --root /workspace/rootfs --import /tmp/image-rpm-gpg-key-1.asc",
+				"rm -f",
+				"tdnf install",
+			},
+		},
+		{
+			name:       "gpgcheck disabled",
+			repoCfg:    rpmutils.RepoConfig{GPGCheck: false, GPGKey: server.URL + "/base.asc"},
+			expectCmds: []string{"rpm --root /workspace/rootfs --initdb", "tdnf install"},
+		},
+		{
+			name:          "Key fetch failure",
+			repoCfg:       rpmutils.RepoConfig{GPGCheck: true, GPGKey: server.URL + "/missing.asc"},
+			errorContains: "failed to fetch repository GPG keys",
+			expectCmds:    []string{"rpm --root /workspace/rootfs --initdb"},
+		},
+		{
+			name:          "Key import failure",
+			repoCfg:       rpmutils.RepoConfig{GPGCheck: true, GPGKey: server.URL + "/base.asc"},
+			mockCommands:  []shell.MockCommand{{Pattern: "--import", Output: "error: import read failed\n", Error: fmt.Errorf("exit status 1")}},
+			errorContains: "failed to import GPG key " + server.URL + "/base.asc into the image RPM database",
+			expectCmds:    []string{"rpm --root /workspace/rootfs --initdb", "rpm --root /workspace/rootfs --import", "rm -f"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rpmutils.RepoCfg = tt.repoCfg
+			rpmutils.UserRepo = tt.userRepo
+			executor := &recordingExecutor{mockCommands: tt.mockCommands}
+			shell.Default = executor
+
+			template := createTestImageTemplate()
+			imageOs := &ImageOs{
+				installRoot: filepath.Join(t.TempDir(), template.SystemConfig.Name),
+				chrootEnv: &shellInstallMockChrootEnv{MockChrootEnv{
+					pkgType:    "rpm",
+					chrootRoot: shell.HostPath,
+					chrootPath: "/workspace/rootfs",
+				}},
+				template: template,
+			}
+
+			err := imageOs.installImagePkgs(imageOs.GetInstallRoot(), template)
+			if tt.errorContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorContains) {
+					t.Fatalf("expected error containing %q, got: %v", tt.errorContains, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var cmds []string
+			for _, cmd := range executor.commands {
+				if !strings.HasPrefix(cmd, "mkdir") {
+					cmds = append(cmds, cmd)
+				}
+			}
+			if tt.errorContains != "" && len(cmds) != len(tt.expectCmds) {
+				t.Errorf("expected no command after the failure, got: %v", cmds)
+			}
+			if len(cmds) < len(tt.expectCmds) {
+				t.Fatalf("expected commands starting with %v, got: %v", tt.expectCmds, cmds)
+			}
+			for i, prefix := range tt.expectCmds {
+				if !strings.HasPrefix(cmds[i], prefix) {
+					t.Errorf("expected command %d to start with %q, got: %v", i, prefix, cmds)
+				}
+			}
+		})
+	}
+}
+
+func TestInstallImagePkgsSavesInstallLog(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.WorkDir = t.TempDir()
+	config.SetGlobal(newGlobal)
+
+	var output strings.Builder
+	output.WriteString("Refreshing metadata for: 'cache-repo'\n")
+	for i := 1; i <= 25; i++ {
+		fmt.Fprintf(&output, "Checking dependency %02d\n", i)
+	}
+	output.WriteString("Error(1011) : No matching packages: nothing provides libfoo.so.2 needed by broken-pkg\n")
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "rpm --root", Output: "", Error: nil},
+		{Pattern: "mkdir -p", Output: "", Error: nil},
+		{Pattern: "tdnf install broken-pkg", Output: output.String(), Error: fmt.Errorf("exit status 1")},
+		{Pattern: "tdnf install", Output: "", Error: nil},
+	})
+
+	template := createTestImageTemplate()
+	template.SystemConfig.Packages = []string{"curl", "broken-pkg"}
+	imageOs := &ImageOs{
+		installRoot: filepath.Join(t.TempDir(), template.SystemConfig.Name),
+		chrootEnv:   &shellInstallMockChrootEnv{MockChrootEnv{pkgType: "rpm", chrootRoot: shell.HostPath}},
+		template:    template,
+	}
+
+	err := imageOs.installImagePkgs(imageOs.GetInstallRoot(), template)
+	if err == nil {
+		t.Fatal("expected the install of broken-pkg to fail")
+	}
+	if !strings.Contains(err.Error(), "nothing provides libfoo.so.2 needed by broken-pkg") {
+		t.Errorf("expected the tail of the install output in the error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "Refreshing metadata") {
+		t.Errorf("expected only the last lines of the install output in the error, got: %v", err)
+	}
+
+	logPath := filepath.Join(newGlobal.WorkDir,
+		system.GetProviderId(template.Target.OS, template.Target.Dist, template.Target.Arch),
+		"imagebuild", template.GetSystemConfigName(), pkgInstallLogDir, "broken-pkg.log")
+	if !strings.Contains(err.Error(), "full install log: "+logPath) {
+		t.Errorf("expected the path of the install log in the error, got: %v", err)
+	}
+	content, readErr := os.ReadFile(logPath)
+	if readErr != nil {
+		t.Fatalf("expected the install log to be written: %v", readErr)
+	}
+	if string(content) != output.String() {
+		t.Errorf("expected the whole install output in the log, got %q", content)
+	}
+}
+
+// fileCapturingExecutor records the content file.Write and file.Append write
+// to each destination, as the commands themselves are not run.
+type fileCapturingExecutor struct {
+	*recordingExecutor
+	files map[string]string
+}
+
+var (
+	capturedAppendPattern = regexp.MustCompile(`^cat (\S+) \| sudo tee -a (\S+) >/dev/null$`)
+	capturedCopyPattern   = regexp.MustCompile(`^cp '([^']+)' '([^']+)'$`)
+)
+
+func (e *fileCapturingExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	if m := capturedAppendPattern.FindStringSubmatch(cmdStr); m != nil {
+		data, _ := os.ReadFile(m[1])
+		e.files[m[2]] += string(data)
+	} else if m := capturedCopyPattern.FindStringSubmatch(cmdStr); m != nil {
+		data, _ := os.ReadFile(m[1])
+		e.files[m[2]] = string(data)
+	}
+	return e.recordingExecutor.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func TestUpdateImageFstabReadOnlyUsr(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	template := &config.ImageTemplate{
+		Image: config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{
+			ReadOnlyUsr: config.ReadOnlyUsrConfig{Enabled: true, WritablePaths: []string{"/usr/local"}},
+		},
+		Disk: config.DiskConfig{
+			Partitions: []config.PartitionInfo{
+				{ID: "root", Type: "linux-root-amd64", FsType: "ext4", MountPoint: "/"},
+				{ID: "usr", Type: "linux", FsType: "ext4", MountPoint: "/usr"},
+			},
+		},
+	}
+	installRoot := t.TempDir()
+	fstabPath := filepath.Join(installRoot, "etc", "fstab")
+
+	updateFstab := func(diskPathIdMap map[string]string) string {
+		t.Helper()
+		executor := &fileCapturingExecutor{
+			recordingExecutor: &recordingExecutor{mockCommands: []shell.MockCommand{
+				{Pattern: `blkid /dev/loop9p1 `, Output: "1111"},
+				{Pattern: `blkid /dev/loop9p2 `, Output: "2222"},
+			}},
+			files: make(map[string]string),
+		}
+		shell.Default = executor
+		if err := updateImageFstab(installRoot, diskPathIdMap, template); err != nil {
+			t.Fatalf("updateImageFstab failed: %v", err)
+		}
+		return executor.files[fstabPath]
+	}
+
+	// /usr on the root filesystem is bind mounted read-only, the root stays writable
+	fstab := updateFstab(map[string]string{"root": "/dev/loop9p1"})
+	for _, want := range []string{"PARTUUID=1111 / ext4 defaults 0 1\n", "/usr /usr none bind,ro 0 0\n"} {
+		if !strings.Contains(fstab, want) {
+			t.Errorf("expected fstab entry %q, got:\n%s", want, fstab)
+		}
+	}
+
+	// A /usr partition is mounted read-only instead
+	fstab = updateFstab(map[string]string{"root": "/dev/loop9p1", "usr": "/dev/loop9p2"})
+	for _, want := range []string{"PARTUUID=1111 / ext4 defaults 0 1\n", "PARTUUID=2222 /usr ext4 defaults,ro 0 2\n"} {
+		if !strings.Contains(fstab, want) {
+			t.Errorf("expected fstab entry %q, got:\n%s", want, fstab)
+		}
+	}
+	if strings.Contains(fstab, "bind,ro") {
+		t.Errorf("expected no /usr bind mount with a /usr partition, got:\n%s", fstab)
+	}
+
+	template.SystemConfig.ReadOnlyUsr.Enabled = false
+	fstab = updateFstab(map[string]string{"root": "/dev/loop9p1", "usr": "/dev/loop9p2"})
+	if strings.Contains(fstab, ",ro") || !strings.Contains(fstab, "PARTUUID=2222 /usr ext4 defaults 0 2\n") {
+		t.Errorf("expected a writable /usr without readOnlyUsr, got:\n%s", fstab)
+	}
+}
+
+func TestUpdateImageReadOnlyUsr(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = t.TempDir()
+	config.SetGlobal(newGlobal)
+
+	installRoot := t.TempDir()
+	unitLibDir := filepath.Join(installRoot, "usr", "lib", "systemd", "system")
+	if err := os.MkdirAll(unitLibDir, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", unitLibDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(unitLibDir, "apt-daily-upgrade.timer"), nil, 0644); err != nil {
+		t.Fatalf("failed to create timer unit: %v", err)
+	}
+
+	template := createTestImageTemplate()
+	template.SystemConfig.ReadOnlyUsr = config.ReadOnlyUsrConfig{
+		Enabled:       true,
+		WritablePaths: []string{"/usr/local", "/usr/lib/my-app"},
+	}
+	executor := &fileCapturingExecutor{recordingExecutor: &recordingExecutor{}, files: make(map[string]string)}
+	shell.Default = executor
+	if err := updateImageReadOnlyUsr(installRoot, template); err != nil {
+		t.Fatalf("updateImageReadOnlyUsr failed: %v", err)
+	}
+
+	unitDir := filepath.Join(installRoot, "etc", "systemd", "system")
+	unit := executor.files[filepath.Join(unitDir, "usr-local.mount")]
+	for _, want := range []string{
+		"Where=/usr/local\n",
+		"Type=overlay\n",
+		"Options=lowerdir=/usr/local,upperdir=/run/usr-overlay/usr-local/upper,workdir=/run/usr-overlay/usr-local/work\n",
+		"Requires=usr-overlay-dirs.service\n",
+		"WantedBy=local-fs.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("expected the overlay unit to contain %q, got:\n%s", want, unit)
+		}
+	}
+	if _, ok := executor.files[filepath.Join(unitDir, `usr-lib-my\x2dapp.mount`)]; !ok {
+		t.Errorf("expected an escaped unit name for /usr/lib/my-app, got files %v", executor.files)
+	}
+	service := executor.files[filepath.Join(unitDir, "usr-overlay-dirs.service")]
+	if !strings.Contains(service, "ExecStart=/usr/bin/mkdir -p /run/usr-overlay/usr-local/upper /run/usr-overlay/usr-local/work "+
+		`/run/usr-overlay/usr-lib-my\x2dapp/upper`) {
+		t.Errorf("expected the service to create the writable layers, got:\n%s", service)
+	}
+
+	for _, want := range []string{
+		fmt.Sprintf("ln -sf '/etc/systemd/system/usr-local.mount' '%s'", filepath.Join(unitDir, "local-fs.target.wants", "usr-local.mount")),
+		"ln -sf /dev/null " + filepath.Join(unitDir, "apt-daily-upgrade.timer"),
+	} {
+		if !executor.hasCommand(want) {
+			t.Errorf("expected command %q, got %v", want, executor.commands)
+		}
+	}
+	if executor.hasCommand("ln -sf /dev/null " + filepath.Join(unitDir, "dnf-automatic.timer")) {
+		t.Errorf("expected units missing from the image not to be masked, got %v", executor.commands)
+	}
+
+	executor = &fileCapturingExecutor{recordingExecutor: &recordingExecutor{}, files: make(map[string]string)}
+	shell.Default = executor
+	template.SystemConfig.ReadOnlyUsr.Enabled = false
+	if err := updateImageReadOnlyUsr(installRoot, template); err != nil {
+		t.Fatalf("updateImageReadOnlyUsr failed: %v", err)
+	}
+	if len(executor.commands) != 0 {
+		t.Errorf("expected nothing done without readOnlyUsr, got %v", executor.commands)
+	}
+}
+
+func TestUpdateImageEnvironmentAndDropIns(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	newGlobal := config.DefaultGlobalConfig()
+	newGlobal.TempDir = t.TempDir()
+	config.SetGlobal(newGlobal)
+
+	installRoot := t.TempDir()
+	template := createTestImageTemplate()
+	template.SystemConfig.Environment = map[string]string{
+		"HTTP_PROXY": "http://proxy.example.com:3128",
+		"APP_MODE":   "production mode",
+	}
+	template.SystemConfig.SystemdDropIns = []config.SystemdDropIn{
+		{Unit: "nginx.service", Content: "[Service]\nEnvironment=NGINX_PORT=8080\nExecStart=\nExecStart=/usr/sbin/nginx -g 'daemon off;'\n"},
+		{Unit: `getty@tty1.service`, Content: "[Service]\nTTYVTDisallocate=no"},
+	}
+
+	executor := &fileCapturingExecutor{recordingExecutor: &recordingExecutor{}, files: make(map[string]string)}
+	shell.Default = executor
+	if err := updateImageEnvironment(installRoot, template); err != nil {
+		t.Fatalf("updateImageEnvironment failed: %v", err)
+	}
+	if err := updateImageSystemdDropIns(installRoot, template); err != nil {
+		t.Fatalf("updateImageSystemdDropIns failed: %v", err)
+	}
+
+	environment := executor.files[filepath.Join(installRoot, "etc", "environment")]
+	wantEnvironment := "# Added from systemConfig.environment of the image template\n" +
+		"APP_MODE=\"production mode\"\n" +
+		"HTTP_PROXY=\"http://proxy.example.com:3128\"\n"
+	if environment != wantEnvironment {
+		t.Errorf("expected /etc/environment to be appended with:\n%s\ngot:\n%s", wantEnvironment, environment)
+	}
+
+	nginxPath := filepath.Join(installRoot, "etc", "systemd", "system", "nginx.service.d", "override.conf")
+	wantNginx := "# Generated from systemConfig.systemdDropIns of the image template\n" +
+		"[Service]\nEnvironment=NGINX_PORT=8080\nExecStart=\nExecStart=/usr/sbin/nginx -g 'daemon off;'\n"
+	if got := executor.files[nginxPath]; got != wantNginx {
+		t.Errorf("expected drop-in %s:\n%s\ngot:\n%s", nginxPath, wantNginx, got)
+	}
+	gettyPath := filepath.Join(installRoot, "etc", "systemd", "system", "getty@tty1.service.d", "override.conf")
+	if got := executor.files[gettyPath]; !strings.HasSuffix(got, "[Service]\nTTYVTDisallocate=no\n") {
+		t.Errorf("expected drop-in %s, got files %v", gettyPath, executor.files)
+	}
+	if !executor.hasCommand("chmod 0644 '" + nginxPath + "'") {
+		t.Errorf("expected the drop-in permissions to be set, got %v", executor.commands)
+	}
+
+	executor = &fileCapturingExecutor{recordingExecutor: &recordingExecutor{}, files: make(map[string]string)}
+	shell.Default = executor
+	template.SystemConfig.Environment = nil
+	template.SystemConfig.SystemdDropIns = nil
+	if err := updateImageEnvironment(installRoot, template); err != nil {
+		t.Fatalf("updateImageEnvironment failed: %v", err)
+	}
+	if err := updateImageSystemdDropIns(installRoot, template); err != nil {
+		t.Fatalf("updateImageSystemdDropIns failed: %v", err)
+	}
+	if len(executor.commands) != 0 {
+		t.Errorf("expected nothing written without environment or drop-ins, got %v", executor.commands)
+	}
+}
@@ -0,0 +1,210 @@
+package imageos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imageinspect"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/slice"
+	"gopkg.in/yaml.v3"
+)
+
+// incrementalState records the packages installed into an install root kept
+// after the build, so that a later build with template.Incremental set can
+// install only the packages added to the template and remove the ones dropped
+// from it.
+type incrementalState struct {
+	ConfigDigest    string   `json:"configDigest"`    // digest of the template without its package list
+	PackageDBDigest string   `json:"packageDbDigest"` // digest of the package database after the build
+	Packages        []string `json:"packages"`        // package install list of the build
+}
+
+// incrementalStatePath returns the file holding the incrementalState of
+// installRoot. Like the UKI input stamps it is kept next to the install root
+// so it never ends up in the image.
+func incrementalStatePath(installRoot string) string {
+	return filepath.Join(filepath.Dir(installRoot), ".incremental", filepath.Base(installRoot), "packages.json")
+}
+
+// getPkgInstallList returns the ordered package install list of template for
+// pkgType.
+func getPkgInstallList(pkgType string, template *config.ImageTemplate) []string {
+	if pkgType == "deb" {
+		return getDebPkgInstallList(template)
+	}
+	return getRpmPkgInstallList(template)
+}
+
+// packageDBDigest hashes the package database of installRoot, or returns an
+// empty string if installRoot has none.
+func packageDBDigest(installRoot, pkgType string) string {
+	dbFiles := []string{"var/lib/rpm/rpmdb.sqlite", "var/lib/rpm/Packages"}
+	if pkgType == "deb" {
+		dbFiles = []string{"var/lib/dpkg/status"}
+	}
+	for _, f := range dbFiles {
+		if _, err := os.Stat(filepath.Join(installRoot, f)); err == nil {
+			return digestInputs(installRoot, []string{pkgType}, dbFiles)
+		}
+	}
+	return ""
+}
+
+// nonPackageConfigDigest identifies everything in template that ends up in
+// the image apart from the system configuration package list. Any change to
+// it invalidates the rootfs of a previous build.
+func nonPackageConfigDigest(template *config.ImageTemplate) (string, error) {
+	stripped := *template
+	stripped.SystemConfig.Packages = nil
+	stripped.SystemConfig.PackageFiles = nil
+	data, err := yaml.Marshal(&stripped)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize template: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// incrementalPlan is the package delta applied to the rootfs kept by a
+// previous build instead of installing every package of the template.
+type incrementalPlan struct {
+	installList []string // packages added to the template, in install order
+	removeList  []string // packages dropped from the template
+}
+
+// planIncrementalInstall returns the package delta between the rootfs kept by
+// a previous build of installRoot and pkgList, or nil when every package of
+// pkgList has to be installed into a fresh rootfs. The delta is only used when
+// the previous build had the same non-package configuration, its package
+// database is unchanged and no package merely changed its version.
+func (imageOs *ImageOs) planIncrementalInstall(installRoot string, pkgList []string,
+	template *config.ImageTemplate) *incrementalPlan {
+	statePath := incrementalStatePath(installRoot)
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		log.Infof("No package state recorded by a previous build of %s, installing all packages", installRoot)
+		return nil
+	}
+	var state incrementalState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Warnf("Ignoring unreadable package state %s, installing all packages: %v", statePath, err)
+		return nil
+	}
+
+	digest, err := nonPackageConfigDigest(template)
+	if err != nil || digest != state.ConfigDigest {
+		log.Infof("Configuration changed since the previous build of %s, installing all packages", installRoot)
+		return nil
+	}
+	dbDigest := packageDBDigest(installRoot, imageOs.chrootEnv.GetTargetOsPkgType())
+	if dbDigest == "" || dbDigest != state.PackageDBDigest {
+		log.Infof("Package database of %s changed since the previous build, installing all packages", installRoot)
+		return nil
+	}
+
+	added, removed := imageinspect.DiffPackageSets(state.Packages, pkgList)
+	addedNames := make(map[string]bool, len(added))
+	for _, pkg := range added {
+		addedNames[ospackage.ParsePackageSpec(pkg).Name] = true
+	}
+	for _, pkg := range removed {
+		// Removing the old spec of a package would uninstall its new version
+		if addedNames[ospackage.ParsePackageSpec(pkg).Name] {
+			log.Infof("Version of %s changed since the previous build of %s, installing all packages", pkg, installRoot)
+			return nil
+		}
+	}
+
+	plan := &incrementalPlan{removeList: removed}
+	// Keep the install order of pkgList for the added packages
+	for _, pkg := range pkgList {
+		if slice.Contains(added, pkg) {
+			plan.installList = append(plan.installList, pkg)
+		}
+	}
+	log.Infof("Incremental build of %s: installing %d and removing %d packages",
+		installRoot, len(plan.installList), len(plan.removeList))
+	return plan
+}
+
+// prepareIncrementalInstall decides how the packages of the template get into
+// installRoot. With template.Incremental set, the rootfs kept by the previous
+// build is reused and imageOs.incremental holds the package delta to apply to
+// it. A kept rootfs that cannot be reused is emptied, so nothing of it ends up
+// in a full build.
+func (imageOs *ImageOs) prepareIncrementalInstall(installRoot string, template *config.ImageTemplate) error {
+	imageOs.incremental = nil
+	_, statErr := os.Stat(incrementalStatePath(installRoot))
+	rootfsKept := statErr == nil
+	if template.Incremental && rootfsKept {
+		pkgList := getPkgInstallList(imageOs.chrootEnv.GetTargetOsPkgType(), template)
+		imageOs.incremental = imageOs.planIncrementalInstall(installRoot, pkgList, template)
+	}
+	clearIncrementalState(installRoot)
+
+	if rootfsKept && imageOs.incremental == nil {
+		log.Infof("Removing the rootfs kept by the previous build of %s", installRoot)
+		if err := emptyInstallRoot(installRoot); err != nil {
+			return fmt.Errorf("failed to remove the rootfs of the previous build: %w", err)
+		}
+	}
+	return nil
+}
+
+// RootfsKept reports whether the rootfs in installRoot is kept for the next
+// incremental build, in which case the image makers must not remove it after
+// a successful build.
+func RootfsKept(installRoot string, template *config.ImageTemplate) bool {
+	if !template.Incremental {
+		return false
+	}
+	_, err := os.Stat(incrementalStatePath(installRoot))
+	return err == nil
+}
+
+// clearIncrementalState drops the package state of installRoot before its
+// packages change, so a failed build is never mistaken for a complete one.
+func clearIncrementalState(installRoot string) {
+	if err := os.Remove(incrementalStatePath(installRoot)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Failed to remove package state of %s: %v", installRoot, err)
+	}
+}
+
+// recordIncrementalState records the packages installed into installRoot for
+// the next incremental build. A missing state only costs a full install next
+// time, so failures are logged and otherwise ignored.
+func (imageOs *ImageOs) recordIncrementalState(installRoot string, template *config.ImageTemplate) {
+	if !template.Incremental {
+		return
+	}
+	pkgType := imageOs.chrootEnv.GetTargetOsPkgType()
+	digest, err := nonPackageConfigDigest(template)
+	if err != nil {
+		log.Warnf("Failed to record package state of %s: %v", installRoot, err)
+		return
+	}
+	state := incrementalState{
+		ConfigDigest:    digest,
+		PackageDBDigest: packageDBDigest(installRoot, pkgType),
+		Packages:        getPkgInstallList(pkgType, template),
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Warnf("Failed to record package state of %s: %v", installRoot, err)
+		return
+	}
+	statePath := incrementalStatePath(installRoot)
+	if err := os.MkdirAll(filepath.Dir(statePath), 0o755); err != nil {
+		log.Warnf("Failed to create package state directory %s: %v", filepath.Dir(statePath), err)
+		return
+	}
+	if err := os.WriteFile(statePath, data, 0o644); err != nil {
+		log.Warnf("Failed to write package state %s: %v", statePath, err)
+	}
+}
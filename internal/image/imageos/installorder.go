@@ -0,0 +1,95 @@
+package imageos
+
+import (
+	"sort"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+)
+
+// Priorities of the default install order rules, which install the packages
+// providing the filesystem layout first and the initramfs generators last.
+const (
+	installOrderFirst = -100
+	installOrderLast  = 100
+)
+
+var rpmInstallOrderRules = []config.InstallOrderRule{
+	{Prefix: "filesystem", Priority: installOrderFirst},
+	{Prefix: "initramfs", Priority: installOrderLast},
+}
+
+var debInstallOrderRules = []config.InstallOrderRule{
+	{Prefix: "base-files", Priority: installOrderFirst},
+	{Prefix: "dracut", Priority: installOrderLast},
+	{Prefix: "systemd-boot", Priority: installOrderLast},
+}
+
+// installOrderRules returns the provider-supplied rules of template followed
+// by defaults, so that a provider rule wins over a default with the same
+// prefix.
+func installOrderRules(template *config.ImageTemplate, defaults []config.InstallOrderRule) []config.InstallOrderRule {
+	rules := make([]config.InstallOrderRule, 0, len(template.InstallOrderRules)+len(defaults))
+	rules = append(rules, template.InstallOrderRules...)
+	return append(rules, defaults...)
+}
+
+// orderPkgInstallList returns pkgs sorted by the priority of the most specific
+// rule matching each package, that is the one with the longest prefix. The sort is stable, so packages of the same priority
+// keep their order in pkgs.
+func orderPkgInstallList(pkgs []string, rules []config.InstallOrderRule) []string {
+	ordered := make([]string, len(pkgs))
+	copy(ordered, pkgs)
+	priorities := make(map[string]int, len(pkgs))
+	for _, pkg := range pkgs {
+		priorities[pkg] = installOrderPriority(pkg, rules)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return priorities[ordered[i]] < priorities[ordered[j]]
+	})
+	return ordered
+}
+
+func installOrderPriority(pkg string, rules []config.InstallOrderRule) int {
+	spec := ospackage.ParsePackageSpec(pkg)
+	priority, matchLen := 0, -1
+	for _, rule := range rules {
+		if len(rule.Prefix) > matchLen && spec.InFamily(rule.Prefix) {
+			priority, matchLen = rule.Priority, len(rule.Prefix)
+		}
+	}
+	return priority
+}
+
+// pkgInstallTransactions splits the ordered install list pkgs into the
+// transactions installing it. Without bulk, every package is a transaction of
+// its own. With bulk, each run of packages of the same install order priority
+// is one transaction, so the packages the rules install first or last are
+// still installed before or after the others. The packages solo reports true
+// for are always installed in a transaction of their own.
+func pkgInstallTransactions(pkgs []string, rules []config.InstallOrderRule, bulk bool, solo func(pkg string) bool) [][]string {
+	var transactions [][]string
+	var current []string
+	currentPriority := 0
+	for _, pkg := range pkgs {
+		priority := installOrderPriority(pkg, rules)
+		if !bulk || solo(pkg) {
+			if len(current) > 0 {
+				transactions = append(transactions, current)
+				current = nil
+			}
+			transactions = append(transactions, []string{pkg})
+			continue
+		}
+		if len(current) > 0 && priority != currentPriority {
+			transactions = append(transactions, current)
+			current = nil
+		}
+		current = append(current, pkg)
+		currentPriority = priority
+	}
+	if len(current) > 0 {
+		transactions = append(transactions, current)
+	}
+	return transactions
+}
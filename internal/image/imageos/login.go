@@ -0,0 +1,218 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// sshdDropInPath is the sshd_config drop-in that disables password login when
+// systemConfig.ssh.disablePasswordAuth is set. sshd keeps the first value it
+// reads for an option, so the low sort order makes it override other drop-ins.
+const sshdDropInPath = "/etc/ssh/sshd_config.d/01-image-composer-tool.conf"
+
+const sshdDropInContent = `# Written by image-composer-tool: only allow key-based login
+PasswordAuthentication no
+KbdInteractiveAuthentication no
+`
+
+// sshKeygenUnit is the systemd unit that generates the SSH host keys on the
+// first boot of an image whose host keys were removed during the build,
+// before the SSH server starts.
+const sshKeygenUnit = "image-composer-ssh-keygen.service"
+
+const sshKeygenUnitContent = `# Written by image-composer-tool: generate SSH host keys on first boot
+[Unit]
+Description=Generate SSH host keys
+Before=ssh.service sshd.service
+ConditionPathExistsGlob=!/etc/ssh/ssh_host_*_key
+
+[Service]
+Type=oneshot
+ExecStart=/usr/bin/ssh-keygen -A
+RemainAfterExit=yes
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// lockUserPassword locks the password of username in the shadow file of
+// installRoot, like passwd -l: the password field is prefixed with "!", so no
+// password matches it while key-based login keeps working. The shadow file is
+// only readable by root, and copying over it keeps its owner and mode.
+func lockUserPassword(installRoot, username string) error {
+	shadowPath := filepath.Join(installRoot, "etc", "shadow")
+	data, err := file.Read(shadowPath)
+	if err != nil {
+		return fmt.Errorf("failed to read shadow file: %w", err)
+	}
+	locked, found := lockShadowEntry(data, username)
+	if !found {
+		return fmt.Errorf("user %s not found in shadow file", username)
+	}
+	if err := file.Write(locked, shadowPath); err != nil {
+		return fmt.Errorf("failed to write shadow file: %w", err)
+	}
+	log.Debugf("Locked password of user %s", username)
+	return nil
+}
+
+// lockShadowEntry returns the shadow file content with the password field of
+// username locked, and whether username has an entry. Locking an already
+// locked entry leaves it unchanged.
+func lockShadowEntry(content, username string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || fields[0] != username {
+			continue
+		}
+		if !strings.HasPrefix(fields[1], "!") {
+			fields[1] = "!" + fields[1]
+		}
+		lines[i] = strings.Join(fields, ":")
+		return strings.Join(lines, "\n"), true
+	}
+	return content, false
+}
+
+// updateImageSSHConfig writes the sshd_config drop-in disabling password
+// login when systemConfig.ssh.disablePasswordAuth is set. An sshd_config that
+// does not include its drop-in directory gets the include prepended.
+func updateImageSSHConfig(installRoot string, template *config.ImageTemplate) error {
+	if !template.SystemConfig.SSH.DisablePasswordAuth {
+		return nil
+	}
+	log.Infof("Disabling SSH password login...")
+
+	dropInPath := filepath.Join(installRoot, sshdDropInPath)
+	if err := file.Write(sshdDropInContent, dropInPath); err != nil {
+		return fmt.Errorf("failed to write sshd drop-in %s: %w", dropInPath, err)
+	}
+	if _, err := shell.ExecCmd("chmod 0644 "+dropInPath, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to set permissions for %s: %w", dropInPath, err)
+	}
+
+	configPath := filepath.Join(installRoot, "etc", "ssh", "sshd_config")
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		log.Warnf("sshd_config not found in the image, SSH password login is only disabled if sshd reads %s", sshdDropInPath)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to stat sshd_config: %w", err)
+	}
+	data, err := file.Read(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read sshd_config: %w", err)
+	}
+	if strings.Contains(data, "sshd_config.d/") {
+		return nil
+	}
+	include := "Include /etc/ssh/sshd_config.d/*.conf\n"
+	if err := file.Write(include+data, configPath); err != nil {
+		return fmt.Errorf("failed to write sshd_config: %w", err)
+	}
+	return nil
+}
+
+// updateImageSSHHostKeys removes the SSH host keys generated when the SSH
+// server was installed, so that systems booted from the image do not share
+// them. With the regenerate mode, a first-boot unit generates new keys; with
+// the inject mode, the host keys of the template are installed instead.
+// Images without /etc/ssh are left alone.
+func updateImageSSHHostKeys(installRoot string, template *config.ImageTemplate) error {
+	sshDir := filepath.Join(installRoot, "etc", "ssh")
+	if _, err := os.Stat(sshDir); os.IsNotExist(err) {
+		log.Debugf("No /etc/ssh in the image, skipping SSH host keys")
+		return nil
+	}
+	buildKeys, err := filepath.Glob(filepath.Join(sshDir, "ssh_host_*"))
+	if err != nil {
+		return fmt.Errorf("failed to list SSH host keys: %w", err)
+	}
+	if len(buildKeys) > 0 {
+		log.Infof("Removing %d SSH host key files generated during the build...", len(buildKeys))
+		if _, err := shell.ExecCmd("rm -f "+strings.Join(buildKeys, " "), true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to remove SSH host keys: %w", err)
+		}
+	}
+
+	if template.GetSSHHostKeysMode() == config.SSHHostKeysInject {
+		return injectSSHHostKeys(sshDir, template.SystemConfig.SSH.HostKeys.Keys)
+	}
+
+	log.Infof("Installing %s to generate SSH host keys on first boot...", sshKeygenUnit)
+	unitPath := filepath.Join(installRoot, "etc", "systemd", "system", sshKeygenUnit)
+	if err := file.Write(sshKeygenUnitContent, unitPath); err != nil {
+		return fmt.Errorf("failed to write %s: %w", unitPath, err)
+	}
+	if _, err := shell.ExecCmd("chmod 0644 "+unitPath, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to set permissions for %s: %w", unitPath, err)
+	}
+	cmd := "systemctl enable --root=\"" + installRoot + "\" " + sshKeygenUnit
+	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to enable %s: %w", sshKeygenUnit, err)
+	}
+	return nil
+}
+
+// injectSSHHostKeys installs the private host key files keys and their .pub
+// files into sshDir, readable by root only for the private keys as sshd
+// requires.
+func injectSSHHostKeys(sshDir string, keys []string) error {
+	log.Infof("Installing %d SSH host keys...", len(keys))
+	for _, key := range keys {
+		keyPath := filepath.Join(sshDir, filepath.Base(key))
+		for _, keyFile := range []struct{ src, dst, mode string }{
+			{key, keyPath, "0600"},
+			{key + ".pub", keyPath + ".pub", "0644"},
+		} {
+			if err := file.CopyFile(keyFile.src, keyFile.dst, "", true); err != nil {
+				return fmt.Errorf("failed to install SSH host key %s: %w", keyFile.dst, err)
+			}
+			if _, err := shell.ExecCmd("chown root:root "+keyFile.dst, true, shell.HostPath, nil); err != nil {
+				return fmt.Errorf("failed to set the owner of SSH host key %s: %w", keyFile.dst, err)
+			}
+			if _, err := shell.ExecCmd("chmod "+keyFile.mode+" "+keyFile.dst, true, shell.HostPath, nil); err != nil {
+				return fmt.Errorf("failed to set permissions for SSH host key %s: %w", keyFile.dst, err)
+			}
+		}
+	}
+	return nil
+}
+
+// warnIfNoLoginPath warns when the root account is locked but no other sudo
+// user has SSH keys installed, as the image may then be impossible to log in
+// to or administer.
+func warnIfNoLoginPath(template *config.ImageTemplate) {
+	root := template.GetUserByName("root")
+	if root == nil || !root.Locked {
+		return
+	}
+	for _, user := range template.SystemConfig.Users {
+		if user.Name != "root" && user.Sudo && !user.Locked && hasAuthorizedKeys(user, template) {
+			return
+		}
+	}
+	log.Warnf("The root account is locked and no other sudo user with SSH authorized keys is defined, the image may have no usable login path")
+}
+
+// hasAuthorizedKeys reports whether the additional files of template install
+// an SSH authorized_keys file in the home directory of user.
+func hasAuthorizedKeys(user config.UserConfig, template *config.ImageTemplate) bool {
+	home := user.Home
+	if home == "" {
+		home = filepath.Join("/home", user.Name)
+	}
+	keysPath := filepath.Join(home, ".ssh", "authorized_keys")
+	for _, fileInfo := range template.SystemConfig.AdditionalFiles {
+		if filepath.Clean(fileInfo.Final) == keysPath {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// resolvedDropInPath is the systemd-resolved drop-in holding the DNS settings
+// of systemConfig.resolvConf when the image uses systemd-resolved.
+const resolvedDropInPath = "/etc/systemd/resolved.conf.d/image-composer-tool.conf"
+
+// updateImageNameResolution writes the static DNS settings and extra hosts
+// entries of template into the image. It runs before createResolvConfSymlink,
+// so a static /etc/resolv.conf written here is kept as it is.
+func updateImageNameResolution(installRoot string, template *config.ImageTemplate) error {
+	if err := updateImageResolvConf(installRoot, template.SystemConfig.ResolvConf); err != nil {
+		return err
+	}
+	return updateImageHosts(installRoot, template.SystemConfig.HostsEntries)
+}
+
+// updateImageResolvConf writes resolvConf as a systemd-resolved drop-in if the
+// image has systemd-resolved, leaving /etc/resolv.conf pointed at its stub
+// resolver. Otherwise it writes /etc/resolv.conf itself, replacing a
+// resolv.conf symlink, which would be dangling without systemd-resolved and
+// which cp would follow out of the install root.
+func updateImageResolvConf(installRoot string, resolvConf config.ResolvConf) error {
+	if len(resolvConf.Nameservers) == 0 && len(resolvConf.Search) == 0 {
+		return nil
+	}
+	log.Infof("Configuring DNS...")
+
+	if hasSystemdUnit(installRoot, "systemd-resolved.service") {
+		dropInPath := filepath.Join(installRoot, resolvedDropInPath)
+		if err := file.Write(resolvedDropInContent(resolvConf), dropInPath); err != nil {
+			return fmt.Errorf("failed to write systemd-resolved configuration %s: %w", dropInPath, err)
+		}
+		if _, err := shell.ExecCmd("chmod 0644 "+dropInPath, true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to set permissions for %s: %w", dropInPath, err)
+		}
+		return nil
+	}
+
+	resolvConfPath := filepath.Join(installRoot, "etc", "resolv.conf")
+	if info, err := os.Lstat(resolvConfPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		log.Debugf("Replacing resolv.conf symlink in %s with a static file", installRoot)
+		if _, err := shell.ExecCmd("rm -f "+resolvConfPath, true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to remove resolv.conf symlink %s: %w", resolvConfPath, err)
+		}
+	}
+	if err := file.Write(resolvConfContent(resolvConf), resolvConfPath); err != nil {
+		return fmt.Errorf("failed to write %s: %w", resolvConfPath, err)
+	}
+	if _, err := shell.ExecCmd("chmod 0644 "+resolvConfPath, true, shell.HostPath, nil); err != nil {
+		return fmt.Errorf("failed to set permissions for %s: %w", resolvConfPath, err)
+	}
+	return nil
+}
+
+// updateImageHosts appends entries to /etc/hosts of the image.
+func updateImageHosts(installRoot string, entries []config.HostsEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	log.Infof("Configuring hosts entries...")
+	hostsPath := filepath.Join(installRoot, "etc", "hosts")
+	if err := file.Append(hostsEntriesContent(entries), hostsPath); err != nil {
+		return fmt.Errorf("failed to append hosts entries to %s: %w", hostsPath, err)
+	}
+	return nil
+}
+
+// hasSystemdUnit reports whether the systemd unit file unit is installed in
+// installRoot.
+func hasSystemdUnit(installRoot, unit string) bool {
+	for _, dir := range []string{"usr/lib/systemd/system", "lib/systemd/system", "etc/systemd/system"} {
+		if _, err := os.Stat(filepath.Join(installRoot, dir, unit)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func resolvConfContent(resolvConf config.ResolvConf) string {
+	var b strings.Builder
+	b.WriteString("# Generated from systemConfig.resolvConf of the image template\n")
+	for _, ns := range resolvConf.Nameservers {
+		fmt.Fprintf(&b, "nameserver %s\n", ns)
+	}
+	if len(resolvConf.Search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(resolvConf.Search, " "))
+	}
+	return b.String()
+}
+
+func resolvedDropInContent(resolvConf config.ResolvConf) string {
+	var b strings.Builder
+	b.WriteString("# Generated from systemConfig.resolvConf of the image template\n[Resolve]\n")
+	if len(resolvConf.Nameservers) > 0 {
+		fmt.Fprintf(&b, "DNS=%s\n", strings.Join(resolvConf.Nameservers, " "))
+	}
+	if len(resolvConf.Search) > 0 {
+		fmt.Fprintf(&b, "Domains=%s\n", strings.Join(resolvConf.Search, " "))
+	}
+	return b.String()
+}
+
+func hostsEntriesContent(entries []config.HostsEntry) string {
+	var b strings.Builder
+	b.WriteString("\n# Added from systemConfig.hostsEntries of the image template\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "%s\t%s\n", entry.IP, strings.Join(entry.Hostnames, " "))
+	}
+	return b.String()
+}
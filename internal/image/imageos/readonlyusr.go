@@ -0,0 +1,167 @@
+package imageos
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+const (
+	// usrMountPoint is the mount point systemConfig.readOnlyUsr makes
+	// read-only.
+	usrMountPoint = "/usr"
+
+	// usrOverlayRunDir holds the writable layers of the overlays on the
+	// writable paths of a read-only /usr. It is on the /run tmpfs, so their
+	// changes are lost on reboot.
+	usrOverlayRunDir = "/run/usr-overlay"
+
+	// usrOverlayDirsService creates the writable layer directories before the
+	// overlays are mounted.
+	usrOverlayDirsService = "usr-overlay-dirs.service"
+)
+
+// packageUpdateUnits are the systemd units updating the packages of a
+// running system, masked when /usr is read-only.
+var packageUpdateUnits = []string{
+	"apt-daily-upgrade.timer",
+	"unattended-upgrades.service",
+	"dnf-automatic.timer",
+	"dnf-automatic-install.timer",
+	"tdnf-automatic.timer",
+}
+
+// readOnlyUsrFstabContent returns the fstab entry bind mounting /usr
+// read-only onto itself, for images without a /usr partition.
+func readOnlyUsrFstabContent() string {
+	return "# Added from systemConfig.readOnlyUsr of the image template\n" +
+		usrMountPoint + " " + usrMountPoint + " none bind,ro 0 0\n"
+}
+
+// systemdEscapePath returns path escaped like systemd-escape --path does, as
+// used in the name of the mount unit of path.
+func systemdEscapePath(path string) string {
+	path = strings.Trim(filepath.Clean(path), "/")
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == ':',
+			c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
+// usrOverlayUnitName returns the name of the mount unit of the overlay on
+// writablePath.
+func usrOverlayUnitName(writablePath string) string {
+	return systemdEscapePath(writablePath) + ".mount"
+}
+
+// usrOverlayLayerDirs returns the upper and work directories of the overlay
+// on writablePath.
+func usrOverlayLayerDirs(writablePath string) (string, string) {
+	dir := filepath.Join(usrOverlayRunDir, systemdEscapePath(writablePath))
+	return filepath.Join(dir, "upper"), filepath.Join(dir, "work")
+}
+
+// usrOverlayMountUnitContent returns the mount unit of the overlay making
+// writablePath writable on top of the read-only /usr.
+func usrOverlayMountUnitContent(writablePath string) string {
+	upperDir, workDir := usrOverlayLayerDirs(writablePath)
+	var b strings.Builder
+	b.WriteString("# Generated from systemConfig.readOnlyUsr of the image template\n")
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=Writable overlay on %s\n", writablePath)
+	b.WriteString("DefaultDependencies=no\n")
+	fmt.Fprintf(&b, "Requires=%s\n", usrOverlayDirsService)
+	fmt.Fprintf(&b, "After=%s\n", usrOverlayDirsService)
+	b.WriteString("Before=local-fs.target umount.target\n")
+	b.WriteString("Conflicts=umount.target\n\n")
+	b.WriteString("[Mount]\n")
+	b.WriteString("What=overlay\n")
+	fmt.Fprintf(&b, "Where=%s\n", writablePath)
+	b.WriteString("Type=overlay\n")
+	fmt.Fprintf(&b, "Options=lowerdir=%s,upperdir=%s,workdir=%s\n\n", writablePath, upperDir, workDir)
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=local-fs.target\n")
+	return b.String()
+}
+
+// usrOverlayDirsServiceContent returns the service creating the writable
+// layer directories of the overlays on writablePaths.
+func usrOverlayDirsServiceContent(writablePaths []string) string {
+	var dirs []string
+	for _, writablePath := range writablePaths {
+		upperDir, workDir := usrOverlayLayerDirs(writablePath)
+		dirs = append(dirs, upperDir, workDir)
+	}
+	var b strings.Builder
+	b.WriteString("# Generated from systemConfig.readOnlyUsr of the image template\n")
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Create the writable layers of the overlays on the read-only /usr\n")
+	b.WriteString("DefaultDependencies=no\n")
+	b.WriteString("RequiresMountsFor=" + usrOverlayRunDir + "\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	b.WriteString("RemainAfterExit=yes\n")
+	fmt.Fprintf(&b, "ExecStart=/usr/bin/mkdir -p %s\n", strings.Join(dirs, " "))
+	return b.String()
+}
+
+// updateImageReadOnlyUsr installs the overlay units of the writable paths of
+// systemConfig.readOnlyUsr and masks the automatic package updates of the
+// image, which would fail on its read-only /usr. The read-only /usr mount
+// itself is set up in fstab by updateImageFstab.
+func updateImageReadOnlyUsr(installRoot string, template *config.ImageTemplate) error {
+	readOnlyUsr := template.SystemConfig.ReadOnlyUsr
+	if !readOnlyUsr.Enabled {
+		return nil
+	}
+	log.Infof("Configuring read-only /usr...")
+
+	unitDir := filepath.Join(installRoot, "etc", "systemd", "system")
+	if len(readOnlyUsr.WritablePaths) > 0 {
+		servicePath := filepath.Join(unitDir, usrOverlayDirsService)
+		if err := file.Write(usrOverlayDirsServiceContent(readOnlyUsr.WritablePaths), servicePath); err != nil {
+			return fmt.Errorf("failed to write %s: %w", servicePath, err)
+		}
+		wantsDir := filepath.Join(unitDir, "local-fs.target.wants")
+		if _, err := shell.ExecCmd("mkdir -p "+wantsDir, true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to create %s: %w", wantsDir, err)
+		}
+		for _, writablePath := range readOnlyUsr.WritablePaths {
+			unit := usrOverlayUnitName(writablePath)
+			unitPath := filepath.Join(unitDir, unit)
+			if err := file.Write(usrOverlayMountUnitContent(writablePath), unitPath); err != nil {
+				return fmt.Errorf("failed to write %s: %w", unitPath, err)
+			}
+			// The unit name holds backslashes, quote the paths for the shell
+			cmd := fmt.Sprintf("ln -sf '%s' '%s'", filepath.Join("/etc/systemd/system", unit), filepath.Join(wantsDir, unit))
+			if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+				return fmt.Errorf("failed to enable %s: %w", unit, err)
+			}
+		}
+	}
+
+	for _, unit := range packageUpdateUnits {
+		if !hasSystemdUnit(installRoot, unit) {
+			continue
+		}
+		log.Debugf("Masking %s on the read-only /usr", unit)
+		if _, err := shell.ExecCmd("ln -sf /dev/null "+filepath.Join(unitDir, unit), true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to mask %s: %w", unit, err)
+		}
+	}
+	return nil
+}
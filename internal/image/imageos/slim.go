@@ -0,0 +1,204 @@
+package imageos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/slice"
+)
+
+// slimDpkgConfigPath is the dpkg configuration excluding documentation and
+// locales from the packages installed in the image, and slimRpmMacrosPath
+// the rpm macros doing the same.
+const (
+	slimDpkgConfigPath = "/etc/dpkg/dpkg.cfg.d/01-image-composer-slim"
+	slimRpmMacrosPath  = "/etc/rpm/macros.image-composer-slim"
+)
+
+// slimDocDirs are the documentation directories dropped by slim.stripDocs,
+// and slimLocaleDir the directory of the translations dropped for the
+// locales that slim.keepLocales does not keep.
+var (
+	slimDocDirs   = []string{"/usr/share/doc", "/usr/share/man", "/usr/share/info"}
+	slimLocaleDir = "/usr/share/locale"
+)
+
+// keptLocaleDirs returns the names of the translation directories kept for
+// locales: each locale as given, without its codeset and modifier, and its
+// language alone, e.g. en_US.UTF-8, en_US and en for en_US.UTF-8.
+func keptLocaleDirs(locales []string) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, locale := range locales {
+		name, _, _ := strings.Cut(locale, "@")
+		name, _, _ = strings.Cut(name, ".")
+		lang, _, _ := strings.Cut(name, "_")
+		for _, dir := range []string{locale, name, lang} {
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// slimDpkgConfigContent returns the dpkg path excludes of slim.
+func slimDpkgConfigContent(slim config.SlimOptions) string {
+	var content strings.Builder
+	content.WriteString("# Written from systemConfig.slim of the image template\n")
+	if slim.StripDocs {
+		for _, dir := range slimDocDirs {
+			fmt.Fprintf(&content, "path-exclude=%s/*\n", dir)
+		}
+	}
+	if len(slim.KeepLocales) > 0 {
+		fmt.Fprintf(&content, "path-exclude=%s/*\n", slimLocaleDir)
+		fmt.Fprintf(&content, "path-include=%s/locale.alias\n", slimLocaleDir)
+		for _, dir := range keptLocaleDirs(slim.KeepLocales) {
+			fmt.Fprintf(&content, "path-include=%s/%s/*\n", slimLocaleDir, dir)
+		}
+	}
+	return content.String()
+}
+
+// slimRpmMacrosContent returns the rpm macros of slim.
+func slimRpmMacrosContent(slim config.SlimOptions) string {
+	var content strings.Builder
+	content.WriteString("# Written from systemConfig.slim of the image template\n")
+	if slim.StripDocs {
+		content.WriteString("%_excludedocs 1\n")
+	}
+	if len(slim.KeepLocales) > 0 {
+		fmt.Fprintf(&content, "%%_install_langs %s\n", strings.Join(keptLocaleDirs(slim.KeepLocales), ":"))
+	}
+	return content.String()
+}
+
+// slimEnabled reports whether slim drops anything from the image.
+func slimEnabled(slim config.SlimOptions) bool {
+	return slim.StripDocs || len(slim.KeepLocales) > 0
+}
+
+// configureSlimExcludes writes the dpkg or rpm configuration excluding the
+// documentation and locales dropped by systemConfig.slim into the image,
+// before its packages are installed, so that later package installs in the
+// image exclude them too. rpm reads its macros from the build chroot when
+// installing into the image, so they are also written there until
+// removeSlimFiles runs.
+func (imageOs *ImageOs) configureSlimExcludes(installRoot string, template *config.ImageTemplate) error {
+	slim := template.SystemConfig.Slim
+	if !slimEnabled(slim) {
+		return nil
+	}
+	log.Infof("Configuring documentation and locale excludes...")
+
+	switch pkgType := imageOs.chrootEnv.GetTargetOsPkgType(); pkgType {
+	case "deb":
+		configPath := filepath.Join(installRoot, slimDpkgConfigPath)
+		if err := file.Write(slimDpkgConfigContent(slim), configPath); err != nil {
+			return fmt.Errorf("failed to write dpkg excludes %s: %w", configPath, err)
+		}
+	case "rpm":
+		chrootMacrosPath, err := imageOs.chrootEnv.GetChrootEnvHostPath(slimRpmMacrosPath)
+		if err != nil {
+			return fmt.Errorf("failed to get chroot environment host path: %w", err)
+		}
+		for _, macrosPath := range []string{filepath.Join(installRoot, slimRpmMacrosPath), chrootMacrosPath} {
+			if err := file.Write(slimRpmMacrosContent(slim), macrosPath); err != nil {
+				return fmt.Errorf("failed to write rpm macros %s: %w", macrosPath, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported package type for documentation and locale excludes: %s", pkgType)
+	}
+	return nil
+}
+
+// removeSlimFiles removes the documentation and locales dropped by
+// systemConfig.slim that were installed in the image anyway, such as by the
+// packages of the initial rootfs, once the image packages are installed.
+func (imageOs *ImageOs) removeSlimFiles(installRoot string, template *config.ImageTemplate) error {
+	slim := template.SystemConfig.Slim
+	if !slimEnabled(slim) {
+		return nil
+	}
+
+	if imageOs.chrootEnv.GetTargetOsPkgType() == "rpm" {
+		chrootMacrosPath, err := imageOs.chrootEnv.GetChrootEnvHostPath(slimRpmMacrosPath)
+		if err != nil {
+			return fmt.Errorf("failed to get chroot environment host path: %w", err)
+		}
+		if _, err := shell.ExecCmd("rm -f "+chrootMacrosPath, true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to remove rpm macros %s: %w", chrootMacrosPath, err)
+		}
+	}
+
+	var removeDirs []string
+	if slim.StripDocs {
+		removeDirs = append(removeDirs, slimDocDirs...)
+	}
+	if len(slim.KeepLocales) > 0 {
+		localeDirs, err := droppedLocaleDirs(installRoot, slim.KeepLocales)
+		if err != nil {
+			return err
+		}
+		removeDirs = append(removeDirs, localeDirs...)
+	}
+	log.Infof("Removing %d documentation and locale directories...", len(removeDirs))
+	for _, dir := range removeDirs {
+		dirPath := filepath.Join(installRoot, dir)
+		if _, err := shell.ExecCmd("rm -rf "+dirPath, true, shell.HostPath, nil); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", dirPath, err)
+		}
+	}
+	return nil
+}
+
+// droppedLocaleDirs returns the translation directories of installRoot that
+// do not belong to one of the locales to keep.
+func droppedLocaleDirs(installRoot string, keepLocales []string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(installRoot, slimLocaleDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list locales in %s: %w", slimLocaleDir, err)
+	}
+	kept := keptLocaleDirs(keepLocales)
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() || slice.Contains(kept, entry.Name()) {
+			continue
+		}
+		dirs = append(dirs, filepath.Join(slimLocaleDir, entry.Name()))
+	}
+	return dirs, nil
+}
+
+// isSlimDroppedFile reports whether path is a file that systemConfig.slim
+// drops from the image, and that file verification reports as missing.
+func isSlimDroppedFile(path string, slim config.SlimOptions) bool {
+	var dirs []string
+	if slim.StripDocs {
+		dirs = append(dirs, slimDocDirs...)
+	}
+	if len(slim.KeepLocales) > 0 {
+		rel, ok := strings.CutPrefix(path, slimLocaleDir+"/")
+		if ok {
+			locale, _, found := strings.Cut(rel, "/")
+			return found && !slice.Contains(keptLocaleDirs(slim.KeepLocales), locale)
+		}
+	}
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,342 @@
+package imagesign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"unicode/utf16"
+)
+
+var (
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSHA256                 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256        = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSpcIndirectDataContent = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+	oidSpcSpOpusInfo          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 12}
+	oidSpcPEImageData         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 15}
+)
+
+const (
+	peMagicPE32               = 0x10b
+	peMagicPE32Plus           = 0x20b
+	peSecurityDirectoryIndex  = 4
+	peDataDirectoryEntrySize  = 8
+	winCertRevision2          = 0x0200
+	winCertTypePKCSSignedData = 0x0002
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type digestInfo struct {
+	DigestAlgorithm algorithmIdentifier
+	Digest          []byte
+}
+
+type spcAttributeTypeAndOptionalValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type spcIndirectDataContent struct {
+	Data          spcAttributeTypeAndOptionalValue
+	MessageDigest digestInfo
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           algorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue
+	DigestEncryptionAlgorithm algorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+// peLayout holds the offsets of the PE header fields that are excluded from
+// the Authenticode digest.
+type peLayout struct {
+	checksumOffset    int
+	securityDirOffset int
+	sizeOfHeaders     int
+	certTableOffset   int
+	certTableSize     int
+}
+
+func parsePELayout(data []byte) (peLayout, error) {
+	var layout peLayout
+	if len(data) < 0x40 || data[0] != 'M' || data[1] != 'Z' {
+		return layout, fmt.Errorf("not a PE/COFF binary: missing MZ header")
+	}
+	peOffset := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	if peOffset+24 > len(data) || !bytes.Equal(data[peOffset:peOffset+4], []byte("PE\x00\x00")) {
+		return layout, fmt.Errorf("not a PE/COFF binary: missing PE signature")
+	}
+	optOffset := peOffset + 24
+	if optOffset+2 > len(data) {
+		return layout, fmt.Errorf("truncated PE optional header")
+	}
+
+	var numDirsOffset, dataDirOffset int
+	switch binary.LittleEndian.Uint16(data[optOffset:]) {
+	case peMagicPE32:
+		numDirsOffset, dataDirOffset = optOffset+92, optOffset+96
+	case peMagicPE32Plus:
+		numDirsOffset, dataDirOffset = optOffset+108, optOffset+112
+	default:
+		return layout, fmt.Errorf("unsupported PE optional header magic 0x%x", binary.LittleEndian.Uint16(data[optOffset:]))
+	}
+	if numDirsOffset+4 > len(data) {
+		return layout, fmt.Errorf("truncated PE optional header")
+	}
+	if int(binary.LittleEndian.Uint32(data[numDirsOffset:])) <= peSecurityDirectoryIndex {
+		return layout, fmt.Errorf("PE binary has no security directory entry")
+	}
+
+	layout.checksumOffset = optOffset + 64
+	layout.securityDirOffset = dataDirOffset + peSecurityDirectoryIndex*peDataDirectoryEntrySize
+	if layout.securityDirOffset+peDataDirectoryEntrySize > len(data) {
+		return layout, fmt.Errorf("truncated PE data directories")
+	}
+	layout.sizeOfHeaders = int(binary.LittleEndian.Uint32(data[optOffset+60:]))
+	layout.certTableOffset = int(binary.LittleEndian.Uint32(data[layout.securityDirOffset:]))
+	layout.certTableSize = int(binary.LittleEndian.Uint32(data[layout.securityDirOffset+4:]))
+	if layout.sizeOfHeaders < layout.securityDirOffset+peDataDirectoryEntrySize || layout.sizeOfHeaders > len(data) {
+		return layout, fmt.Errorf("invalid PE SizeOfHeaders %d", layout.sizeOfHeaders)
+	}
+	return layout, nil
+}
+
+// prepareForSigning removes an existing signature from the end of the binary
+// and pads it to the 8-byte alignment required for the certificate table.
+func prepareForSigning(data []byte) ([]byte, peLayout, error) {
+	layout, err := parsePELayout(data)
+	if err != nil {
+		return nil, layout, err
+	}
+
+	unsigned := append([]byte(nil), data...)
+	if layout.certTableSize != 0 {
+		if layout.certTableOffset+layout.certTableSize != len(data) {
+			return nil, layout, fmt.Errorf("existing signature is not at the end of the binary")
+		}
+		unsigned = unsigned[:layout.certTableOffset]
+		binary.LittleEndian.PutUint64(unsigned[layout.securityDirOffset:], 0)
+		layout.certTableOffset, layout.certTableSize = 0, 0
+	}
+	if pad := len(unsigned) % 8; pad != 0 {
+		unsigned = append(unsigned, make([]byte, 8-pad)...)
+	}
+	return unsigned, layout, nil
+}
+
+// authenticodeDigest returns the SHA-256 Authenticode digest of an unsigned
+// PE binary: the whole file except the checksum field and the security
+// directory entry.
+func authenticodeDigest(data []byte, layout peLayout) []byte {
+	h := sha256.New()
+	h.Write(data[:layout.checksumOffset])
+	h.Write(data[layout.checksumOffset+4 : layout.securityDirOffset])
+	h.Write(data[layout.securityDirOffset+peDataDirectoryEntrySize:])
+	return h.Sum(nil)
+}
+
+// spcPEImageData is the SpcPeImageData value with empty flags and the
+// "<<<Obsolete>>>" file link that signing tools conventionally emit.
+func spcPEImageData() []byte {
+	var obsolete []byte
+	for _, r := range utf16.Encode([]rune("<<<Obsolete>>>")) {
+		obsolete = append(obsolete, byte(r>>8), byte(r))
+	}
+	bmp, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: obsolete})
+	link, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: bmp})
+	file, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: link})
+	flags, _ := asn1.Marshal(asn1.BitString{})
+	value, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: append(flags, file...)})
+	return value
+}
+
+func marshalAttribute(oid asn1.ObjectIdentifier, value interface{}) ([]byte, error) {
+	valueDER, err := asn1.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(attribute{
+		Type:   oid,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: valueDER},
+	})
+}
+
+// signatureAlgorithm returns the digestEncryptionAlgorithm matching the
+// public key of the signing certificate.
+func signatureAlgorithm(publicKey crypto.PublicKey) (algorithmIdentifier, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return algorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return algorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	default:
+		return algorithmIdentifier{}, fmt.Errorf("unsupported signing key type %T", publicKey)
+	}
+}
+
+// buildAuthenticodeSignature creates the PKCS#7 SignedData for a PE binary
+// with the given Authenticode digest. The only private key operation is the
+// call to signer.Sign with the SHA-256 digest of the authenticated
+// attributes, so the key can live on a token.
+func buildAuthenticodeSignature(peDigest []byte, signer crypto.Signer, cert *x509.Certificate) ([]byte, error) {
+	sha256Alg := algorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	sigAlg, err := signatureAlgorithm(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	indirectData, err := asn1.Marshal(spcIndirectDataContent{
+		Data: spcAttributeTypeAndOptionalValue{
+			Type:  oidSpcPEImageData,
+			Value: asn1.RawValue{FullBytes: spcPEImageData()},
+		},
+		MessageDigest: digestInfo{DigestAlgorithm: sha256Alg, Digest: peDigest},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode indirect data: %w", err)
+	}
+
+	// The message digest covers the content of SpcIndirectDataContent
+	// without its outer tag and length
+	var indirectRaw asn1.RawValue
+	if _, err := asn1.Unmarshal(indirectData, &indirectRaw); err != nil {
+		return nil, fmt.Errorf("failed to decode indirect data: %w", err)
+	}
+	contentDigest := sha256.Sum256(indirectRaw.Bytes)
+
+	var attrs [][]byte
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidAttributeContentType, oidSpcIndirectDataContent},
+		{oidSpcSpOpusInfo, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true}},
+		{oidAttributeMessageDigest, contentDigest[:]},
+	} {
+		encoded, err := marshalAttribute(attr.oid, attr.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode authenticated attribute: %w", err)
+		}
+		attrs = append(attrs, encoded)
+	}
+	// DER requires SET OF members in ascending order of their encoding
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	attrsBytes := bytes.Join(attrs, nil)
+
+	attrsSet, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrsBytes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode authenticated attributes: %w", err)
+	}
+	attrsDigest := sha256.Sum256(attrsSet)
+	signature, err := signer.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("signing backend failed: %w", err)
+	}
+
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []algorithmIdentifier{sha256Alg},
+		ContentInfo: contentInfo{
+			ContentType: oidSpcIndirectDataContent,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: indirectData},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			DigestAlgorithm:           sha256Alg,
+			AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrsBytes},
+			DigestEncryptionAlgorithm: sigAlg,
+			EncryptedDigest:           signature,
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signed data: %w", err)
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+// embedAuthenticodeSignature appends pkcs7 as a WIN_CERTIFICATE to an
+// unsigned, 8-byte aligned binary and points the security directory at it.
+func embedAuthenticodeSignature(unsigned []byte, layout peLayout, pkcs7 []byte) []byte {
+	length := 8 + len(pkcs7)
+	if pad := length % 8; pad != 0 {
+		length += 8 - pad
+	}
+
+	signed := make([]byte, len(unsigned), len(unsigned)+length)
+	copy(signed, unsigned)
+	binary.LittleEndian.PutUint32(signed[layout.securityDirOffset:], uint32(len(unsigned)))
+	binary.LittleEndian.PutUint32(signed[layout.securityDirOffset+4:], uint32(length))
+
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header, uint32(length))
+	binary.LittleEndian.PutUint16(header[4:], winCertRevision2)
+	binary.LittleEndian.PutUint16(header[6:], winCertTypePKCSSignedData)
+	signed = append(signed, header...)
+	signed = append(signed, pkcs7...)
+	return append(signed, make([]byte, length-8-len(pkcs7))...)
+}
+
+// signPEBinary returns data signed with an embedded Authenticode signature
+// made by signer. An existing signature is replaced.
+func signPEBinary(data []byte, signer crypto.Signer, cert *x509.Certificate) ([]byte, error) {
+	unsigned, layout, err := prepareForSigning(data)
+	if err != nil {
+		return nil, err
+	}
+	pkcs7, err := buildAuthenticodeSignature(authenticodeDigest(unsigned, layout), signer, cert)
+	if err != nil {
+		return nil, err
+	}
+	return embedAuthenticodeSignature(unsigned, layout, pkcs7), nil
+}
@@ -0,0 +1,451 @@
+package imagesign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+const testKeyURI = "pkcs11:object=db-key"
+
+// fakeTokenSigner stands in for a PKCS#11 token: it records every digest it
+// is asked to sign and signs it with an in-memory RSA key.
+type fakeTokenSigner struct {
+	key        *rsa.PrivateKey
+	digests    [][]byte
+	opts       []crypto.SignerOpts
+	signatures [][]byte
+}
+
+func (f *fakeTokenSigner) Public() crypto.PublicKey {
+	return &f.key.PublicKey
+}
+
+func (f *fakeTokenSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	f.digests = append(f.digests, append([]byte(nil), digest...))
+	f.opts = append(f.opts, opts)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, f.key, opts.HashFunc(), digest)
+	if err != nil {
+		return nil, err
+	}
+	f.signatures = append(f.signatures, signature)
+	return signature, nil
+}
+
+// testPEBinary builds a minimal unsigned PE32+ image: DOS header, PE
+// signature, COFF header, optional header with 16 data directories and some
+// section data after SizeOfHeaders.
+func testPEBinary(t *testing.T) []byte {
+	t.Helper()
+	const (
+		peOffset      = 0x40
+		optOffset     = peOffset + 24
+		sizeOfHeaders = 0x200
+	)
+	data := make([]byte, sizeOfHeaders+0x100)
+	copy(data, "MZ")
+	binary.LittleEndian.PutUint32(data[0x3c:], peOffset)
+	copy(data[peOffset:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(data[peOffset+4:], 0x8664) // Machine: x86-64
+	binary.LittleEndian.PutUint16(data[peOffset+20:], 240)   // SizeOfOptionalHeader
+	binary.LittleEndian.PutUint16(data[optOffset:], peMagicPE32Plus)
+	binary.LittleEndian.PutUint32(data[optOffset+60:], sizeOfHeaders)
+	binary.LittleEndian.PutUint32(data[optOffset+108:], 16) // NumberOfRvaAndSizes
+	for i := sizeOfHeaders; i < len(data); i++ {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+// writeTestCertificate creates a self-signed secure boot DB certificate and
+// returns its key and the paths of the PEM and DER copies.
+func writeTestCertificate(t *testing.T, dir string) (*rsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	certTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1880),
+		Subject:      pkix.Name{CommonName: "Test Secure Boot DB"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, certTemplate, certTemplate, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	crtPath := filepath.Join(dir, "db.crt")
+	cerPath := filepath.Join(dir, "db.cer")
+	if err := os.WriteFile(crtPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(cerPath, der, 0644); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	return key, crtPath, cerPath
+}
+
+// useFakeToken replaces the PKCS#11 token and the work directory for the
+// duration of the test.
+func useFakeToken(t *testing.T, signer *fakeTokenSigner) *string {
+	t.Helper()
+	origNewPKCS11Signer := newPKCS11Signer
+	origConfig := config.Global()
+	origWorkDir := origConfig.WorkDir
+	t.Cleanup(func() {
+		newPKCS11Signer = origNewPKCS11Signer
+		origConfig.WorkDir = origWorkDir
+		config.SetGlobal(origConfig)
+	})
+
+	currentConfig := config.Global()
+	currentConfig.WorkDir = t.TempDir()
+	config.SetGlobal(currentConfig)
+
+	var requestedURI string
+	newPKCS11Signer = func(uri string, cert *x509.Certificate) (crypto.Signer, error) {
+		requestedURI = uri
+		return signer, nil
+	}
+	return &requestedURI
+}
+
+// setupESP writes unsigned PE binaries to the UKI and bootloader paths.
+func setupESP(t *testing.T, installRoot string, binary []byte) (string, string) {
+	t.Helper()
+	ukiPath := filepath.Join(installRoot, "boot", "efi", "EFI", "Linux", "linux.efi")
+	bootloaderPath := filepath.Join(installRoot, "boot", "efi", "EFI", "BOOT", "BOOTX64.EFI")
+	for _, path := range []string{ukiPath, bootloaderPath} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create ESP directory: %v", err)
+		}
+		if err := os.WriteFile(path, binary, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+	return ukiPath, bootloaderPath
+}
+
+func pkcs11Template(keyURI, crtPath, cerPath string) *config.ImageTemplate {
+	return &config.ImageTemplate{
+		Target: config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		SystemConfig: config.SystemConfig{
+			Name: "test-config",
+			Immutability: config.ImmutabilityConfig{
+				Enabled:            true,
+				SecureBootSigner:   config.SecureBootSignerPKCS11,
+				SecureBootDBKeyURI: keyURI,
+				SecureBootDBCrt:    crtPath,
+				SecureBootDBCer:    cerPath,
+			},
+		},
+	}
+}
+
+// embeddedSignature checks the certificate table of a signed binary and
+// returns the PKCS#7 SignedData it holds.
+func embeddedSignature(t *testing.T, signed []byte) (peLayout, signedData) {
+	t.Helper()
+	layout, err := parsePELayout(signed)
+	if err != nil {
+		t.Fatalf("signed binary is not a PE binary: %v", err)
+	}
+	if layout.certTableOffset == 0 || layout.certTableOffset+layout.certTableSize != len(signed) {
+		t.Fatalf("unexpected certificate table at %d+%d in %d bytes",
+			layout.certTableOffset, layout.certTableSize, len(signed))
+	}
+	header := signed[layout.certTableOffset:]
+	if binary.LittleEndian.Uint32(header) != uint32(layout.certTableSize) ||
+		binary.LittleEndian.Uint16(header[4:]) != winCertRevision2 ||
+		binary.LittleEndian.Uint16(header[6:]) != winCertTypePKCSSignedData {
+		t.Fatalf("unexpected WIN_CERTIFICATE header % x", header[:8])
+	}
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(header[8:], &ci); err != nil {
+		t.Fatalf("failed to parse PKCS#7 content info: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		t.Fatalf("unexpected content type %v", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatalf("failed to parse PKCS#7 signed data: %v", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		t.Fatalf("expected 1 signer, got %d", len(sd.SignerInfos))
+	}
+	return layout, sd
+}
+
+func TestSignImage_PKCS11Backend(t *testing.T) {
+	dir := t.TempDir()
+	key, crtPath, cerPath := writeTestCertificate(t, dir)
+	token := &fakeTokenSigner{key: key}
+	requestedURI := useFakeToken(t, token)
+
+	installRoot := t.TempDir()
+	unsignedBinary := testPEBinary(t)
+	ukiPath, bootloaderPath := setupESP(t, installRoot, unsignedBinary)
+
+	if err := SignImage(installRoot, pkcs11Template(testKeyURI, crtPath, cerPath)); err != nil {
+		t.Fatalf("SignImage failed: %v", err)
+	}
+
+	if *requestedURI != testKeyURI {
+		t.Errorf("expected token key %q, got %q", testKeyURI, *requestedURI)
+	}
+	if len(token.digests) != 2 {
+		t.Fatalf("expected the token to sign the UKI and the bootloader, got %d signatures", len(token.digests))
+	}
+
+	unsigned, unsignedLayout, err := prepareForSigning(unsignedBinary)
+	if err != nil {
+		t.Fatalf("failed to prepare test binary: %v", err)
+	}
+	peDigest := authenticodeDigest(unsigned, unsignedLayout)
+
+	for i, path := range []string{ukiPath, bootloaderPath} {
+		if len(token.digests[i]) != 32 || token.opts[i].HashFunc() != crypto.SHA256 {
+			t.Errorf("%s: expected a SHA-256 digest, got %d bytes with %v", path, len(token.digests[i]), token.opts[i].HashFunc())
+		}
+
+		signed, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read signed binary: %v", err)
+		}
+		layout, sd := embeddedSignature(t, signed)
+
+		// The signature covers the binary as it was before signing
+		if got := authenticodeDigest(signed[:layout.certTableOffset], layout); !bytes.Equal(got, peDigest) {
+			t.Errorf("%s: Authenticode digest changed by signing", path)
+		}
+		if !bytes.Contains(sd.ContentInfo.Content.Bytes, peDigest) {
+			t.Errorf("%s: PKCS#7 content does not hold the Authenticode digest", path)
+		}
+
+		// The signature returned by the token is embedded as is and
+		// verifies against the digest the token was given
+		if !bytes.Equal(sd.SignerInfos[0].EncryptedDigest, token.signatures[i]) {
+			t.Errorf("%s: embedded signature is not the one returned by the token", path)
+		}
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, token.digests[i], sd.SignerInfos[0].EncryptedDigest); err != nil {
+			t.Errorf("%s: embedded signature does not verify: %v", path, err)
+		}
+	}
+
+	if _, err := os.Stat(ukiPath + ".signed"); !os.IsNotExist(err) {
+		t.Errorf("expected the signed UKI to replace the original")
+	}
+}
+
+func TestSignPEBinary_ReplacesExistingSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	_, crtPath, _ := writeTestCertificate(t, t.TempDir())
+	cert, err := loadCertificate(crtPath)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	token := &fakeTokenSigner{key: key}
+
+	once, err := signPEBinary(testPEBinary(t), token, cert)
+	if err != nil {
+		t.Fatalf("first signing failed: %v", err)
+	}
+	twice, err := signPEBinary(once, token, cert)
+	if err != nil {
+		t.Fatalf("re-signing failed: %v", err)
+	}
+
+	if len(once) != len(twice) {
+		t.Errorf("expected re-signing to replace the signature, size changed from %d to %d", len(once), len(twice))
+	}
+	if !bytes.Equal(token.digests[0], token.digests[1]) {
+		t.Errorf("expected both signatures to cover the same content")
+	}
+	embeddedSignature(t, twice)
+}
+
+func TestSignPEBinary_InvalidBinary(t *testing.T) {
+	token := &fakeTokenSigner{}
+
+	notPE := testPEBinary(t)
+	copy(notPE, "XX")
+	wrongMagic := testPEBinary(t)
+	binary.LittleEndian.PutUint16(wrongMagic[0x40+24:], 0x107)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		expectError string
+	}{
+		{name: "empty", data: nil, expectError: "missing MZ header"},
+		{name: "no MZ header", data: notPE, expectError: "missing MZ header"},
+		{name: "no PE signature", data: testPEBinary(t)[:0x42], expectError: "missing PE signature"},
+		{name: "unknown optional header", data: wrongMagic, expectError: "unsupported PE optional header magic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := signPEBinary(tt.data, token, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectError, err)
+			}
+			if len(token.digests) != 0 {
+				t.Errorf("expected nothing to be signed")
+			}
+		})
+	}
+}
+
+func TestSignImage_PKCS11Config(t *testing.T) {
+	_, crtPath, cerPath := writeTestCertificate(t, t.TempDir())
+	token := &fakeTokenSigner{}
+	useFakeToken(t, token)
+
+	tests := []struct {
+		name        string
+		template    *config.ImageTemplate
+		expectError string
+	}{
+		{
+			name:     "missing key URI skips signing",
+			template: pkcs11Template("", crtPath, cerPath),
+		},
+		{
+			name: "key file is ignored",
+			template: func() *config.ImageTemplate {
+				template := pkcs11Template(testKeyURI, crtPath, cerPath)
+				template.SystemConfig.Immutability.SecureBootDBKey = "/nonexistent/db.key"
+				return template
+			}(),
+			expectError: "failed to sign UKI",
+		},
+		{
+			name:        "certificate is not PEM",
+			template:    pkcs11Template(testKeyURI, cerPath, cerPath),
+			expectError: "is not a PEM certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SignImage(t.TempDir(), tt.template)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+	if len(token.digests) != 0 {
+		t.Errorf("expected nothing to be signed, got %d signatures", len(token.digests))
+	}
+}
+
+func TestNewPKCS11Signer(t *testing.T) {
+	_, crtPath, _ := writeTestCertificate(t, t.TempDir())
+	cert, err := loadCertificate(crtPath)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+
+	if _, err := newPKCS11Signer("/keys/db.key", cert); err == nil ||
+		!strings.Contains(err.Error(), "must start with pkcs11:") {
+		t.Errorf("expected a non-PKCS#11 URI to be rejected, got %v", err)
+	}
+
+	signer, err := newPKCS11Signer(testKeyURI, cert)
+	if err != nil {
+		t.Fatalf("expected a PKCS#11 URI to be accepted, got %v", err)
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		t.Errorf("expected the public key of the certificate, got %T", signer.Public())
+	}
+}
+
+func TestPKCS11SignerCommand(t *testing.T) {
+	originalExecutor := shell.Default
+	origConfig := config.Global()
+	origTempDir := origConfig.TempDir
+	defer func() {
+		shell.Default = originalExecutor
+		origConfig.TempDir = origTempDir
+		config.SetGlobal(origConfig)
+	}()
+
+	currentConfig := config.Global()
+	currentConfig.TempDir = t.TempDir()
+	config.SetGlobal(currentConfig)
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: `openssl pkeyutl -sign -engine pkcs11 -keyform engine -inkey 'pkcs11:object=db-key' -pkeyopt digest:sha256 -in .*/digest\.bin -out .*/signature\.bin`,
+			Error: errors.New("engine not available")},
+	})
+
+	signer := &pkcs11Signer{uri: testKeyURI}
+	digest := make([]byte, 32)
+	if _, err := signer.Sign(rand.Reader, digest, crypto.SHA256); err == nil ||
+		!strings.Contains(err.Error(), "PKCS#11 signing failed: engine not available") {
+		t.Errorf("expected the openssl pkcs11 engine to be used, got %v", err)
+	}
+	if _, err := signer.Sign(rand.Reader, digest, crypto.SHA1); err == nil ||
+		!strings.Contains(err.Error(), "unsupported PKCS#11 signing hash") {
+		t.Errorf("expected SHA-1 to be rejected, got %v", err)
+	}
+}
+
+func TestPKCS11SignerCommandQuotesHostileURI(t *testing.T) {
+	originalExecutor := shell.Default
+	origConfig := config.Global()
+	origTempDir := origConfig.TempDir
+	defer func() {
+		shell.Default = originalExecutor
+		origConfig.TempDir = origTempDir
+		config.SetGlobal(origConfig)
+	}()
+
+	currentConfig := config.Global()
+	currentConfig.TempDir = t.TempDir()
+	config.SetGlobal(currentConfig)
+
+	// The whole URI must stay a single argument of openssl
+	hostileURI := "pkcs11:object=db-key' -in /etc/shadow; touch /tmp/pwned; echo '"
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "-inkey " + regexp.QuoteMeta(`'pkcs11:object=db-key'"'"' -in /etc/shadow; touch /tmp/pwned; echo '"'"''`) + " -pkeyopt ",
+			Error: errors.New("engine not available")},
+		{Pattern: ".*", Error: errors.New("unexpected command")},
+	})
+
+	signer := &pkcs11Signer{uri: hostileURI}
+	if _, err := signer.Sign(rand.Reader, make([]byte, 32), crypto.SHA256); err == nil ||
+		!strings.Contains(err.Error(), "engine not available") {
+		t.Errorf("expected the key URI to be quoted as a single argument, got %v", err)
+	}
+}
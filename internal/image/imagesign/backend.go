@@ -0,0 +1,147 @@
+package imagesign
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// SigningBackend signs an EFI binary for UEFI Secure Boot, writing the signed
+// copy of inputPath to outputPath.
+type SigningBackend interface {
+	SignEFI(inputPath, outputPath string) error
+}
+
+// localKeyBackend signs with sbsign and a private key file on disk.
+type localKeyBackend struct {
+	keyPath  string
+	certPath string
+}
+
+func (b *localKeyBackend) SignEFI(inputPath, outputPath string) error {
+	cmd := fmt.Sprintf("sbsign --key %s --cert %s --output %s %s",
+		b.keyPath, b.certPath, outputPath, inputPath)
+	_, err := shell.ExecCmd(cmd, true, shell.HostPath, nil)
+	return err
+}
+
+// tokenBackend builds the Authenticode signature itself and only hands the
+// digest to signer, so the private key never has to leave the token.
+type tokenBackend struct {
+	signer crypto.Signer
+	cert   *x509.Certificate
+}
+
+func (b *tokenBackend) SignEFI(inputPath, outputPath string) error {
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", inputPath, err)
+	}
+	signed, err := signPEBinary(data, b.signer, b.cert)
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %w", inputPath, err)
+	}
+	if err := os.WriteFile(outputPath, signed, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+// pkcs11Signer is a crypto.Signer for a key held in a PKCS#11 token. The
+// signature is produced by the OpenSSL pkcs11 engine, addressed by a PKCS#11
+// URI (RFC 7512).
+type pkcs11Signer struct {
+	uri  string
+	cert *x509.Certificate
+}
+
+// newPKCS11Signer is replaced in tests with a fake token.
+var newPKCS11Signer = func(uri string, cert *x509.Certificate) (crypto.Signer, error) {
+	if !strings.HasPrefix(uri, "pkcs11:") {
+		return nil, fmt.Errorf("invalid PKCS#11 key URI %q: must start with pkcs11:", uri)
+	}
+	return &pkcs11Signer{uri: uri, cert: cert}, nil
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.cert.PublicKey
+}
+
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported PKCS#11 signing hash %v", opts.HashFunc())
+	}
+
+	tempDir, err := os.MkdirTemp(config.TempDir(), "pkcs11-sign-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	digestPath := filepath.Join(tempDir, "digest.bin")
+	signaturePath := filepath.Join(tempDir, "signature.bin")
+	if err := os.WriteFile(digestPath, digest, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write digest: %w", err)
+	}
+
+	cmd := fmt.Sprintf("openssl pkeyutl -sign -engine pkcs11 -keyform engine -inkey %s "+
+		"-pkeyopt digest:sha256 -in %s -out %s", shell.SingleQuote(s.uri), digestPath, signaturePath)
+	if _, err := shell.ExecCmd(cmd, false, shell.HostPath, nil); err != nil {
+		return nil, fmt.Errorf("PKCS#11 signing failed: %w", err)
+	}
+	signature, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PKCS#11 signature: %w", err)
+	}
+	return signature, nil
+}
+
+// newSigningBackend returns the backend selected by the immutability
+// configuration: "local" (the default) signs with the key file,
+// "pkcs11" with the key referenced by the PKCS#11 URI.
+func newSigningBackend(immutability config.ImmutabilityConfig) (SigningBackend, error) {
+	switch signer := immutability.GetSecureBootSigner(); signer {
+	case config.SecureBootSignerLocal:
+		return &localKeyBackend{
+			keyPath:  immutability.GetSecureBootDBKeyPath(),
+			certPath: immutability.GetSecureBootDBCrtPath(),
+		}, nil
+	case config.SecureBootSignerPKCS11:
+		cert, err := loadCertificate(immutability.GetSecureBootDBCrtPath())
+		if err != nil {
+			return nil, err
+		}
+		tokenSigner, err := newPKCS11Signer(immutability.GetSecureBootDBKeyURI(), cert)
+		if err != nil {
+			return nil, err
+		}
+		return &tokenBackend{signer: tokenSigner, cert: cert}, nil
+	default:
+		return nil, fmt.Errorf("unsupported secure boot signer %q", signer)
+	}
+}
+
+// loadCertificate reads a PEM encoded X.509 certificate.
+func loadCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secure boot certificate %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("secure boot certificate %s is not a PEM certificate", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secure boot certificate %s: %w", path, err)
+	}
+	return cert, nil
+}
@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
-	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
 )
 
@@ -19,9 +18,16 @@ func SignImage(installRoot string, template *config.ImageTemplate) error {
 		return nil
 	}
 
+	immutability := template.SystemConfig.Immutability
+	useToken := immutability.GetSecureBootSigner() == config.SecureBootSignerPKCS11
+
 	// Check if secure boot keys are provided
 	// If not, skip signing
-	if template.GetSecureBootDBKeyPath() == "" ||
+	keyConfigured := template.GetSecureBootDBKeyPath() != ""
+	if useToken {
+		keyConfigured = immutability.GetSecureBootDBKeyURI() != ""
+	}
+	if !keyConfigured ||
 		template.GetSecureBootDBCrtPath() == "" ||
 		template.GetSecureBootDBCerPath() == "" {
 		fmt.Println("***Skipping Signing because secure boot keys are not provided***")
@@ -32,9 +38,12 @@ func SignImage(installRoot string, template *config.ImageTemplate) error {
 	prKeyPath := template.GetSecureBootDBCrtPath()
 	prCerPath := template.GetSecureBootDBCerPath()
 
-	// Check if the key and certificate files exist
-	if _, err := os.Stat(pbKeyPath); err != nil {
-		return fmt.Errorf("secure boot key file not found at %s: %w", pbKeyPath, err)
+	// Check if the key and certificate files exist. A PKCS#11 key stays in
+	// its token, so there is no key file to check.
+	if !useToken {
+		if _, err := os.Stat(pbKeyPath); err != nil {
+			return fmt.Errorf("secure boot key file not found at %s: %w", pbKeyPath, err)
+		}
 	}
 	if _, err := os.Stat(prKeyPath); err != nil {
 		return fmt.Errorf("secure boot certificate file not found at %s: %w", prKeyPath, err)
@@ -43,15 +52,18 @@ func SignImage(installRoot string, template *config.ImageTemplate) error {
 		return fmt.Errorf("secure boot UEFI certificate file not found at %s: %w", prCerPath, err)
 	}
 
+	backend, err := newSigningBackend(immutability)
+	if err != nil {
+		return fmt.Errorf("failed to set up secure boot signing: %w", err)
+	}
+
 	espDir := filepath.Join(installRoot, "boot", "efi")
 	ukiPath := filepath.Join(espDir, "EFI", "Linux", "linux.efi")
 	bootloaderPath := filepath.Join(espDir, "EFI", "BOOT", "BOOTX64.EFI")
 
 	// Sign the UKI (Unified Kernel Image) - create signed file then replace original
 	ukiSignedPath := filepath.Join(espDir, "EFI", "Linux", "linux.efi.signed")
-	cmd := fmt.Sprintf("sbsign --key %s --cert %s --output %s %s",
-		pbKeyPath, prKeyPath, ukiSignedPath, ukiPath)
-	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+	if err := backend.SignEFI(ukiPath, ukiSignedPath); err != nil {
 		return fmt.Errorf("failed to sign UKI: %w", err)
 	}
 
@@ -62,12 +74,11 @@ func SignImage(installRoot string, template *config.ImageTemplate) error {
 
 	// Sign the bootloader - create signed file then replace original
 	bootloaderSignedPath := filepath.Join(espDir, "EFI", "BOOT", "BOOTX64.EFI.signed")
-	cmd = fmt.Sprintf("sbsign --key %s --cert %s --output %s %s",
-		pbKeyPath, prKeyPath, bootloaderSignedPath, bootloaderPath)
-	if _, err := shell.ExecCmd(cmd, true, shell.HostPath, nil); err != nil {
+	if err := backend.SignEFI(bootloaderPath, bootloaderSignedPath); err != nil {
 		return fmt.Errorf("failed to sign bootloader: %w", err)
 	}
-	fmt.Println("***Successfully signed the bootloader and UKI with sbsign***")
+	fmt.Printf("***Successfully signed the bootloader and UKI with the %s signer***\n",
+		immutability.GetSecureBootSigner())
 
 	// Replace original with signed version
 	if err := os.Rename(bootloaderSignedPath, bootloaderPath); err != nil {
@@ -340,6 +340,17 @@ func TestSignImage_SuccessfulSigning(t *testing.T) {
 	originalExecutor := shell.Default
 	defer func() { shell.Default = originalExecutor }()
 
+	// The DB certificate is copied into the work directory
+	origConfig := config.Global()
+	origWorkDir := origConfig.WorkDir
+	defer func() {
+		origConfig.WorkDir = origWorkDir
+		config.SetGlobal(origConfig)
+	}()
+	currentConfig := config.Global()
+	currentConfig.WorkDir = t.TempDir()
+	config.SetGlobal(currentConfig)
+
 	// Create complete directory structure
 	espDir := filepath.Join(installRoot, "boot", "efi", "EFI")
 	linuxDir := filepath.Join(espDir, "Linux")
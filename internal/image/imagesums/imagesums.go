@@ -0,0 +1,200 @@
+package imagesums
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+const (
+	// SumsFileName is the SHA-256 checksum manifest written to the image build directory
+	SumsFileName = "SHA256SUMS"
+	// SHA512SumsFileName is the SHA-512 checksum manifest written to the image build directory
+	SHA512SumsFileName = "SHA512SUMS"
+	// SignatureFileName is the detached, ASCII-armored GPG signature of SumsFileName
+	SignatureFileName = SumsFileName + signatureSuffix
+
+	signatureSuffix = ".gpg"
+)
+
+// Checksum algorithms, and the value of ParseAlgorithms selecting both.
+const (
+	SHA256        = "sha256"
+	SHA512        = "sha512"
+	AlgorithmBoth = "both"
+)
+
+// sumsFileNames maps the checksum algorithms to their manifest file names.
+var sumsFileNames = map[string]string{
+	SHA256: SumsFileName,
+	SHA512: SHA512SumsFileName,
+}
+
+var log = logger.Logger()
+
+// gpgKeyIDPattern matches the key IDs, fingerprints and user ID email
+// addresses accepted for signing; anything else could not be passed to gpg
+// safely on the command line.
+var gpgKeyIDPattern = regexp.MustCompile(`^[A-Za-z0-9@._+-]+$`)
+
+// ParseAlgorithms returns the checksum algorithms selected by value: sha256,
+// sha512 or both.
+func ParseAlgorithms(value string) ([]string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case SHA256:
+		return []string{SHA256}, nil
+	case SHA512:
+		return []string{SHA512}, nil
+	case AlgorithmBoth:
+		return []string{SHA256, SHA512}, nil
+	default:
+		return nil, fmt.Errorf("invalid checksum algorithm %q, expected %s, %s or %s",
+			value, SHA256, SHA512, AlgorithmBoth)
+	}
+}
+
+// FileDigests computes the checksums of path with each of algorithms in a
+// single pass over the file. Returns the size of the file and the
+// hex-encoded checksums by algorithm.
+func FileDigests(path string, algorithms []string) (int64, map[string]string, error) {
+	hashes := make(map[string]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		var h hash.Hash
+		switch algorithm {
+		case SHA256:
+			h = sha256.New()
+		case SHA512:
+			h = sha512.New()
+		default:
+			return 0, nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+		}
+		hashes[algorithm] = h
+		writers = append(writers, h)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open artifact %s: %w", path, err)
+	}
+	defer f.Close()
+
+	size, err := io.Copy(io.MultiWriter(writers...), f)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to checksum artifact %s: %w", path, err)
+	}
+	digests := make(map[string]string, len(hashes))
+	for algorithm, h := range hashes {
+		digests[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return size, digests, nil
+}
+
+// isSumsFile reports whether name is a checksum manifest or its signature,
+// which are not checksummed themselves.
+func isSumsFile(name string) bool {
+	for _, sumsName := range sumsFileNames {
+		if name == sumsName || name == sumsName+signatureSuffix {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteSHA256Sums writes the SHA256SUMS of dir with WriteSums. Returns the
+// path of the written file.
+func WriteSHA256Sums(dir string) (string, error) {
+	sumsPaths, err := WriteSums(dir, []string{SHA256})
+	if err != nil {
+		return "", err
+	}
+	return sumsPaths[0], nil
+}
+
+// WriteSums computes the checksums with each of algorithms of every regular
+// file directly under dir, reading each file once, and writes them to the
+// manifest of the algorithm in dir, SHA256SUMS or SHA512SUMS, one
+// "<hash>  <filename>" line per file sorted by file name, the format
+// `sha256sum -c` and `sha512sum -c` read. Previous manifests and their
+// signatures are not included, and those of the algorithms not selected are
+// removed. Returns the paths of the written files.
+func WriteSums(dir string, algorithms []string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact directory %s: %w", dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || isSumsFile(entry.Name()) {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	sums := make(map[string]*strings.Builder, len(algorithms))
+	for _, algorithm := range algorithms {
+		sums[algorithm] = &strings.Builder{}
+	}
+	for _, name := range names {
+		_, digests, err := FileDigests(filepath.Join(dir, name), algorithms)
+		if err != nil {
+			return nil, err
+		}
+		for _, algorithm := range algorithms {
+			fmt.Fprintf(sums[algorithm], "%s  %s\n", digests[algorithm], name)
+		}
+	}
+
+	var sumsPaths []string
+	for algorithm, sumsName := range sumsFileNames {
+		sumsPath := filepath.Join(dir, sumsName)
+		// A signature of an earlier manifest would no longer match
+		staleFiles := []string{sumsPath + signatureSuffix}
+		if content, ok := sums[algorithm]; ok {
+			if err := os.WriteFile(sumsPath, []byte(content.String()), 0644); err != nil {
+				return nil, fmt.Errorf("failed to write %s: %w", sumsPath, err)
+			}
+			log.Infof("Wrote checksums of %d artifact(s) to %s", len(names), sumsPath)
+			sumsPaths = append(sumsPaths, sumsPath)
+		} else {
+			staleFiles = append(staleFiles, sumsPath)
+		}
+		for _, stale := range staleFiles {
+			if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove stale %s: %w", filepath.Base(stale), err)
+			}
+		}
+	}
+	sort.Strings(sumsPaths)
+	return sumsPaths, nil
+}
+
+// SignSums writes a detached, ASCII-armored GPG signature of the checksum
+// manifest sumsPath next to it, as sumsPath.gpg, using the secret key keyID
+// from the default GPG keyring. Returns the path of the signature.
+func SignSums(sumsPath, keyID string) (string, error) {
+	if !gpgKeyIDPattern.MatchString(keyID) {
+		return "", fmt.Errorf("invalid GPG key %q, expected a key ID, fingerprint or email address", keyID)
+	}
+	sigPath := sumsPath + signatureSuffix
+	cmd := fmt.Sprintf("gpg --batch --yes --armor --local-user %s --output %s --detach-sign %s",
+		keyID, sigPath, sumsPath)
+	if _, err := shell.ExecCmd(cmd, false, shell.HostPath, nil); err != nil {
+		return "", fmt.Errorf("failed to sign %s with GPG key %s: %w", sumsPath, keyID, err)
+	}
+	log.Infof("Signed %s with GPG key %s", sumsPath, keyID)
+	return sigPath, nil
+}
@@ -0,0 +1,279 @@
+package imagesums
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha512Hex(data string) string {
+	sum := sha512.Sum512([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+}
+
+func TestWriteSHA256Sums(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"minimal-os.raw":           "raw image data",
+		"minimal-os.raw.gz":        "compressed image data",
+		"image-manifest.json":      `{"name":"minimal-os"}`,
+		"spdx_manifest_deb.json":   `{"spdxVersion":"SPDX-2.3"}`,
+		"Minimal-OS-uppercase.txt": "",
+	}
+	writeFiles(t, dir, files)
+	if err := os.Mkdir(filepath.Join(dir, "chroot"), 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "minimal-os.raw"), filepath.Join(dir, "latest.raw")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	sumsPath, err := WriteSHA256Sums(dir)
+	if err != nil {
+		t.Fatalf("WriteSHA256Sums failed: %v", err)
+	}
+	if sumsPath != filepath.Join(dir, SumsFileName) {
+		t.Errorf("Expected %s, got %s", filepath.Join(dir, SumsFileName), sumsPath)
+	}
+
+	data, err := os.ReadFile(sumsPath)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", sumsPath, err)
+	}
+	// Sorted byte-wise, so upper case names come first
+	var expected strings.Builder
+	for _, name := range []string{
+		"Minimal-OS-uppercase.txt",
+		"image-manifest.json",
+		"minimal-os.raw",
+		"minimal-os.raw.gz",
+		"spdx_manifest_deb.json",
+	} {
+		fmt.Fprintf(&expected, "%s  %s\n", sha256Hex(files[name]), name)
+	}
+	if string(data) != expected.String() {
+		t.Errorf("Unexpected %s content:\ngot:\n%s\nwant:\n%s", SumsFileName, data, expected.String())
+	}
+}
+
+func TestWriteSHA256Sums_Rewrite(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"image.raw":       "first build",
+		SumsFileName:      "stale sums\n",
+		SignatureFileName: "stale signature\n",
+	})
+
+	first, err := WriteSHA256Sums(dir)
+	if err != nil {
+		t.Fatalf("WriteSHA256Sums failed: %v", err)
+	}
+	firstData, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", first, err)
+	}
+	expected := sha256Hex("first build") + "  image.raw\n"
+	if string(firstData) != expected {
+		t.Errorf("Expected only the image to be listed, got:\n%s", firstData)
+	}
+	if _, err := os.Stat(filepath.Join(dir, SignatureFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale signature to be removed, got %v", err)
+	}
+
+	// Running again over the same files gives the same manifest
+	second, err := WriteSHA256Sums(dir)
+	if err != nil {
+		t.Fatalf("WriteSHA256Sums failed on rerun: %v", err)
+	}
+	secondData, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", second, err)
+	}
+	if string(secondData) != string(firstData) {
+		t.Errorf("Expected a deterministic manifest, got:\n%s\nthen:\n%s", firstData, secondData)
+	}
+}
+
+func TestParseAlgorithms(t *testing.T) {
+	for value, want := range map[string][]string{
+		"sha256":   {SHA256},
+		"SHA512":   {SHA512},
+		"both":     {SHA256, SHA512},
+		"md5":      nil,
+		"":         nil,
+		"sha1,md5": nil,
+	} {
+		got, err := ParseAlgorithms(value)
+		if want == nil {
+			if err == nil || !strings.Contains(err.Error(), "invalid checksum algorithm") {
+				t.Errorf("ParseAlgorithms(%q): expected an error, got %v", value, got)
+			}
+			continue
+		}
+		if err != nil || strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("ParseAlgorithms(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+}
+
+func TestFileDigests(t *testing.T) {
+	dir := t.TempDir()
+	content := "sample artifact content\n"
+	writeFiles(t, dir, map[string]string{"sample.raw": content})
+	path := filepath.Join(dir, "sample.raw")
+
+	size, digests, err := FileDigests(path, []string{SHA256, SHA512})
+	if err != nil {
+		t.Fatalf("FileDigests failed: %v", err)
+	}
+	if size != int64(len(content)) {
+		t.Errorf("Expected size %d, got %d", len(content), size)
+	}
+	if digests[SHA256] != sha256Hex(content) {
+		t.Errorf("Unexpected SHA-256 %s, want %s", digests[SHA256], sha256Hex(content))
+	}
+	if digests[SHA512] != sha512Hex(content) {
+		t.Errorf("Unexpected SHA-512 %s, want %s", digests[SHA512], sha512Hex(content))
+	}
+
+	_, digests, err = FileDigests(path, []string{SHA512})
+	if err != nil {
+		t.Fatalf("FileDigests failed: %v", err)
+	}
+	if _, ok := digests[SHA256]; ok || len(digests) != 1 {
+		t.Errorf("Expected only the SHA-512 digest, got %v", digests)
+	}
+
+	if _, _, err := FileDigests(path, []string{"md5"}); err == nil || !strings.Contains(err.Error(), "unsupported checksum algorithm") {
+		t.Errorf("Expected an unsupported algorithm error, got %v", err)
+	}
+}
+
+func TestWriteSums_Both(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"image.raw":                          "image data",
+		"image.raw.gz":                       "compressed data",
+		SHA512SumsFileName + signatureSuffix: "stale signature\n",
+		SignatureFileName:                    "stale signature\n",
+	})
+
+	sumsPaths, err := WriteSums(dir, []string{SHA256, SHA512})
+	if err != nil {
+		t.Fatalf("WriteSums failed: %v", err)
+	}
+	want := []string{filepath.Join(dir, SumsFileName), filepath.Join(dir, SHA512SumsFileName)}
+	if strings.Join(sumsPaths, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected %v, got %v", want, sumsPaths)
+	}
+	for i, hexSum := range []func(string) string{sha256Hex, sha512Hex} {
+		data, err := os.ReadFile(sumsPaths[i])
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", sumsPaths[i], err)
+		}
+		expected := hexSum("image data") + "  image.raw\n" + hexSum("compressed data") + "  image.raw.gz\n"
+		if string(data) != expected {
+			t.Errorf("Unexpected %s content:\ngot:\n%s\nwant:\n%s", sumsPaths[i], data, expected)
+		}
+		if _, err := os.Stat(sumsPaths[i] + signatureSuffix); !os.IsNotExist(err) {
+			t.Errorf("Expected the stale signature of %s to be removed, got %v", sumsPaths[i], err)
+		}
+	}
+
+	// Switching back to SHA-256 only removes the SHA-512 manifest
+	if _, err := WriteSums(dir, []string{SHA256}); err != nil {
+		t.Fatalf("WriteSums failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, SHA512SumsFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale %s to be removed, got %v", SHA512SumsFileName, err)
+	}
+}
+
+func TestWriteSHA256Sums_MissingDir(t *testing.T) {
+	_, err := WriteSHA256Sums(filepath.Join(t.TempDir(), "missing"))
+	if err == nil || !strings.Contains(err.Error(), "failed to read artifact directory") {
+		t.Errorf("Expected a read error, got %v", err)
+	}
+}
+
+func TestSignSums(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	sumsPath := filepath.Join(t.TempDir(), SumsFileName)
+	sigPath := filepath.Join(filepath.Dir(sumsPath), SignatureFileName)
+
+	tests := []struct {
+		name        string
+		keyID       string
+		mockCmds    []shell.MockCommand
+		expectError string
+	}{
+		{
+			name:  "success",
+			keyID: "release@example.com",
+			mockCmds: []shell.MockCommand{
+				{Pattern: "gpg --batch --yes --armor --local-user release@example.com --output " + sigPath +
+					" --detach-sign " + sumsPath, Output: "", Error: nil},
+			},
+		},
+		{
+			name:  "gpg failure",
+			keyID: "0xDEADBEEF",
+			mockCmds: []shell.MockCommand{
+				{Pattern: "gpg", Output: "", Error: fmt.Errorf("no secret key")},
+			},
+			expectError: "failed to sign",
+		},
+		{
+			name:        "empty key",
+			keyID:       "",
+			expectError: "invalid GPG key",
+		},
+		{
+			name:        "unsafe key",
+			keyID:       "key; rm -rf /",
+			expectError: "invalid GPG key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shell.Default = shell.NewMockExecutor(tt.mockCmds)
+			got, err := SignSums(sumsPath, tt.keyID)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SignSums failed: %v", err)
+			}
+			if got != sigPath {
+				t.Errorf("Expected signature at %s, got %s", sigPath, got)
+			}
+		})
+	}
+}
@@ -277,6 +277,11 @@ func (initrdMaker *InitrdMaker) CleanInitrdRootfs() error {
 			initrdMaker.InitrdRootfsPath+"/cdrom/cache-repo", err)
 	}
 
+	if imageos.RootfsKept(initrdMaker.InitrdRootfsPath, initrdMaker.template) {
+		log.Infof("Keeping initrd rootfs %s for the next incremental build", initrdMaker.InitrdRootfsPath)
+		return nil
+	}
+
 	// Remove the initrd rootfs directory
 	if _, err := shell.ExecCmd("rm -rf "+initrdMaker.InitrdRootfsPath, true, shell.HostPath, nil); err != nil {
 		log.Errorf("Failed to remove initrd rootfs directory %s: %v",
@@ -150,11 +150,11 @@ func (m *mockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string
 	return m.err
 }
 
-func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return m.err
 }
 
-func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return m.err
 }
 
@@ -291,8 +291,9 @@ func (isoMaker *IsoMaker) copyConfigFilesToIso(template *config.ImageTemplate, i
 				return fmt.Errorf("failed to copy additional file %s to image: %w", srcFile, err)
 			}
 			newFileInfo := config.AdditionalFileInfo{
-				Local: newPath,
-				Final: fileInfo.Final,
+				Local:   newPath,
+				Final:   fileInfo.Final,
+				Archive: fileInfo.Archive,
 			}
 			PathUpdatedList = append(PathUpdatedList, newFileInfo)
 		}
@@ -128,13 +128,13 @@ func (m *mockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string
 	return nil
 }
 
-func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	// Mock implementation: always succeed
 	return nil
 }
 
 // Add missing method to satisfy chroot.ChrootEnvInterface
-func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	// Mock implementation: always succeed
 	return nil
 }
@@ -0,0 +1,391 @@
+package ocimaker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/chroot"
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/config/manifest"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imageos"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/mount"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
+)
+
+const (
+	ociLayoutVersion     = "1.0.0"
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType    = "application/vnd.oci.image.layer.v1.tar"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+type OciMakerInterface interface {
+	Init() error
+	BuildOciImage() error
+	GetOciVersion() string
+	GetOciLayoutPath() string
+	GetOciRootfsPath() string
+	CleanOciRootfs() error
+}
+
+type OciMaker struct {
+	template      *config.ImageTemplate
+	ImageBuildDir string
+	OciRootfsPath string
+	OciLayoutPath string
+	VersionInfo   string
+	ChrootEnv     chroot.ChrootEnvInterface
+	ImageOs       imageos.ImageOsInterface
+}
+
+// ociDescriptor references a blob in the layout by media type, digest and size.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociImageConfig struct {
+	Created      string            `json:"created"`
+	Architecture string            `json:"architecture"`
+	OS           string            `json:"os"`
+	Config       ociRuntimeConfig  `json:"config"`
+	RootFS       ociRootFS         `json:"rootfs"`
+	History      []ociHistoryEntry `json:"history"`
+}
+
+type ociRuntimeConfig struct {
+	Env []string `json:"Env"`
+	Cmd []string `json:"Cmd"`
+}
+
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ociHistoryEntry struct {
+	Created   string `json:"created"`
+	CreatedBy string `json:"created_by"`
+}
+
+var log = logger.Logger()
+
+func NewOciMaker(chrootEnv chroot.ChrootEnvInterface, template *config.ImageTemplate) (*OciMaker, error) {
+	// nil checking is done in the constructor only; the template schema has
+	// already been validated at load time
+	if template == nil {
+		return nil, fmt.Errorf("image template cannot be nil")
+	}
+	if chrootEnv == nil {
+		return nil, fmt.Errorf("chroot environment cannot be nil")
+	}
+
+	imageOs, err := imageos.NewImageOs(chrootEnv, template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image OS: %w", err)
+	}
+
+	return &OciMaker{
+		template:  template,
+		ChrootEnv: chrootEnv,
+		ImageOs:   imageOs,
+	}, nil
+}
+
+func (ociMaker *OciMaker) Init() error {
+	globalWorkDir, err := config.WorkDir()
+	if err != nil {
+		return fmt.Errorf("failed to get global work directory: %w", err)
+	}
+
+	providerId := system.GetProviderId(
+		ociMaker.template.Target.OS,
+		ociMaker.template.Target.Dist,
+		ociMaker.template.Target.Arch,
+	)
+
+	ociMaker.ImageBuildDir = filepath.Join(
+		globalWorkDir,
+		providerId,
+		"imagebuild",
+		ociMaker.template.GetSystemConfigName(),
+	)
+
+	return os.MkdirAll(ociMaker.ImageBuildDir, 0700)
+}
+
+func (ociMaker *OciMaker) GetOciVersion() string {
+	return ociMaker.VersionInfo
+}
+
+func (ociMaker *OciMaker) GetOciLayoutPath() string {
+	return ociMaker.OciLayoutPath
+}
+
+func (ociMaker *OciMaker) GetOciRootfsPath() string {
+	return ociMaker.OciRootfsPath
+}
+
+// BuildOciImage installs the image rootfs and packages it as a single-layer
+// OCI image in an oci-layout directory. The rootfs is installed the same way
+// as for initrd images, so no disk, partition or bootloader steps are run.
+func (ociMaker *OciMaker) BuildOciImage() (err error) {
+	log.Infof("Building OCI image for: %s", ociMaker.template.GetImageName())
+
+	imageName := ociMaker.template.GetImageName()
+
+	ociMaker.OciRootfsPath, ociMaker.VersionInfo, err = ociMaker.ImageOs.InstallInitrd()
+	if err != nil {
+		if cleanErr := ociMaker.CleanOciRootfs(); cleanErr != nil {
+			log.Errorf("Failed to clean OCI rootfs after install failure: %v", cleanErr)
+		}
+		return fmt.Errorf("failed to install OCI rootfs: %w", err)
+	}
+
+	// Copy SBOM into the rootfs (inside the image)
+	if err := manifest.CopySBOMToChroot(ociMaker.OciRootfsPath); err != nil {
+		log.Warnf("Failed to copy SBOM into OCI rootfs: %v", err)
+		// Don't fail the build if SBOM copy fails, just log warning
+	}
+
+	if err := mount.UmountPath(ociMaker.OciRootfsPath + chroot.ChrootRepoDir); err != nil {
+		log.Errorf("Failed to unmount cache-repo %s: %v",
+			ociMaker.OciRootfsPath+chroot.ChrootRepoDir, err)
+		return fmt.Errorf("failed to unmount cache-repo %s: %w",
+			ociMaker.OciRootfsPath+chroot.ChrootRepoDir, err)
+	}
+
+	layerPath := filepath.Join(ociMaker.ImageBuildDir, imageName+"-rootfs.tar")
+	if err := createRootfsLayer(ociMaker.OciRootfsPath, layerPath); err != nil {
+		return fmt.Errorf("failed to create OCI rootfs layer: %w", err)
+	}
+
+	ociMaker.OciLayoutPath = filepath.Join(ociMaker.ImageBuildDir, fmt.Sprintf("%s-%s-oci",
+		imageName, ociMaker.VersionInfo))
+	refName := ociMaker.VersionInfo
+	if refName == "" {
+		refName = "latest"
+	}
+	if err := writeOciLayout(ociMaker.OciLayoutPath, layerPath, ociMaker.template.Target.Arch,
+		refName, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to write OCI layout: %w", err)
+	}
+
+	// Copy SBOM to image build directory
+	if err := manifest.CopySBOMToImageBuildDir(ociMaker.ImageBuildDir); err != nil {
+		log.Warnf("Failed to copy SBOM to image build directory: %v", err)
+		// Don't fail the build if SBOM copy fails, just log warning
+	}
+
+	ociMaker.template.FinishPureImageBuildTimer()
+	pureImageBuildDuration := ociMaker.template.GetPureImageBuildDuration()
+	if pureImageBuildDuration > 0 {
+		log.Infof("Pure OCI image build time: %s", pureImageBuildDuration.Round(time.Millisecond))
+		log.Infof("OCI image build completed successfully: %s", ociMaker.OciLayoutPath)
+	}
+
+	return nil
+}
+
+// createRootfsLayer archives the installed rootfs into an uncompressed layer
+// tarball, keeping numeric ownership, permissions and extended attributes.
+func createRootfsLayer(rootfsPath, layerPath string) error {
+	cmdStr := fmt.Sprintf("tar --numeric-owner --xattrs --xattrs-include=* --exclude=.%s -C %s -cf %s .",
+		chroot.ChrootRepoDir, rootfsPath, layerPath)
+	if _, err := shell.ExecCmdWithStage("oci", cmdStr, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to archive OCI rootfs %s: %v", rootfsPath, err)
+		return fmt.Errorf("failed to archive OCI rootfs %s: %w", rootfsPath, err)
+	}
+	// The archive is created with sudo; make it readable for digesting
+	if _, err := shell.ExecCmd("chmod 0644 "+layerPath, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to set permissions for OCI layer %s: %v", layerPath, err)
+		return fmt.Errorf("failed to set permissions for OCI layer %s: %w", layerPath, err)
+	}
+	if _, err := os.Stat(layerPath); os.IsNotExist(err) {
+		log.Errorf("OCI layer file does not exist: %s", layerPath)
+		return fmt.Errorf("OCI layer file does not exist: %s", layerPath)
+	}
+	return nil
+}
+
+// writeOciLayout moves layerPath into a new oci-layout directory at layoutPath
+// and writes the image config, manifest and index referencing it.
+func writeOciLayout(layoutPath, layerPath, arch, refName string, created time.Time) error {
+	blobDir := filepath.Join(layoutPath, "blobs", "sha256")
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		return fmt.Errorf("failed to create OCI blob directory %s: %w", blobDir, err)
+	}
+
+	layerDigest, layerSize, err := digestFile(layerPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(layerPath, filepath.Join(blobDir, layerDigest)); err != nil {
+		return fmt.Errorf("failed to move OCI layer into layout: %w", err)
+	}
+	layerDesc := ociDescriptor{
+		MediaType: ociLayerMediaType,
+		Digest:    "sha256:" + layerDigest,
+		Size:      layerSize,
+	}
+
+	createdStr := created.Format(time.RFC3339)
+	imageConfig := ociImageConfig{
+		Created:      createdStr,
+		Architecture: ociArchitecture(arch),
+		OS:           "linux",
+		Config: ociRuntimeConfig{
+			Env: []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+			Cmd: []string{"/bin/sh"},
+		},
+		RootFS: ociRootFS{
+			Type:    "layers",
+			DiffIDs: []string{layerDesc.Digest},
+		},
+		History: []ociHistoryEntry{
+			{Created: createdStr, CreatedBy: "image-composer-tool"},
+		},
+	}
+	configDesc, err := writeJSONBlob(blobDir, ociConfigMediaType, imageConfig)
+	if err != nil {
+		return fmt.Errorf("failed to write OCI image config: %w", err)
+	}
+
+	imageManifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config:        configDesc,
+		Layers:        []ociDescriptor{layerDesc},
+	}
+	manifestDesc, err := writeJSONBlob(blobDir, ociManifestMediaType, imageManifest)
+	if err != nil {
+		return fmt.Errorf("failed to write OCI image manifest: %w", err)
+	}
+	manifestDesc.Annotations = map[string]string{ociRefNameAnnotation: refName}
+
+	index := ociIndex{
+		SchemaVersion: 2,
+		MediaType:     ociIndexMediaType,
+		Manifests:     []ociDescriptor{manifestDesc},
+	}
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to marshal OCI index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(layoutPath, "index.json"), indexData, 0644); err != nil {
+		return fmt.Errorf("failed to write OCI index: %w", err)
+	}
+
+	layoutData := fmt.Sprintf("{\"imageLayoutVersion\":\"%s\"}", ociLayoutVersion)
+	if err := os.WriteFile(filepath.Join(layoutPath, "oci-layout"), []byte(layoutData), 0644); err != nil {
+		return fmt.Errorf("failed to write oci-layout file: %w", err)
+	}
+
+	log.Infof("OCI layout written to %s", layoutPath)
+	return nil
+}
+
+func writeJSONBlob(blobDir, mediaType string, v interface{}) (ociDescriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ociDescriptor{}, fmt.Errorf("failed to marshal %s: %w", mediaType, err)
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if err := os.WriteFile(filepath.Join(blobDir, digest), data, 0644); err != nil {
+		return ociDescriptor{}, fmt.Errorf("failed to write blob %s: %w", digest, err)
+	}
+	return ociDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + digest,
+		Size:      int64(len(data)),
+	}, nil
+}
+
+func digestFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to digest %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// ociArchitecture maps a template architecture to its OCI/GOARCH name.
+func ociArchitecture(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "armv7hl":
+		return "arm"
+	default:
+		return arch
+	}
+}
+
+func (ociMaker *OciMaker) CleanOciRootfs() error {
+	log.Infof("Cleaning up OCI rootfs: %s", ociMaker.OciRootfsPath)
+
+	if ociMaker.OciRootfsPath == "" {
+		log.Debugf("OCI rootfs path is empty, nothing to clean")
+		return nil
+	}
+
+	if _, err := os.Stat(ociMaker.OciRootfsPath); os.IsNotExist(err) {
+		log.Debugf("OCI rootfs path does not exist: %s", ociMaker.OciRootfsPath)
+		return nil
+	}
+
+	if err := mount.UmountPath(ociMaker.OciRootfsPath + chroot.ChrootRepoDir); err != nil {
+		log.Errorf("Failed to unmount cache-repo %s: %v",
+			ociMaker.OciRootfsPath+chroot.ChrootRepoDir, err)
+		return fmt.Errorf("failed to unmount cache-repo %s: %w",
+			ociMaker.OciRootfsPath+chroot.ChrootRepoDir, err)
+	}
+
+	if imageos.RootfsKept(ociMaker.OciRootfsPath, ociMaker.template) {
+		log.Infof("Keeping OCI rootfs %s for the next incremental build", ociMaker.OciRootfsPath)
+		return nil
+	}
+
+	if _, err := shell.ExecCmd("rm -rf "+ociMaker.OciRootfsPath, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to remove OCI rootfs directory %s: %v",
+			ociMaker.OciRootfsPath, err)
+		return fmt.Errorf("failed to remove OCI rootfs directory: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,293 @@
+package ocimaker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// tarRecordingExecutor records every command and creates the layer archive
+// when the rootfs tar command is executed.
+type tarRecordingExecutor struct {
+	commands []string
+}
+
+func (e *tarRecordingExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.commands = append(e.commands, cmdStr)
+	if strings.HasPrefix(cmdStr, "tar ") {
+		fields := strings.Fields(cmdStr)
+		for i, field := range fields {
+			if field == "-cf" && i+1 < len(fields) {
+				if err := os.WriteFile(fields[i+1], []byte("mock rootfs layer"), 0644); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+func (e *tarRecordingExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *tarRecordingExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *tarRecordingExecutor) ExecCmdWithInput(inputStr string, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+type mockImageOs struct {
+	installRoot         string
+	versionInfo         string
+	err                 error
+	installInitrdCalls  int
+	installImageOsCalls int
+}
+
+func (m *mockImageOs) GetInstallRoot() string {
+	return m.installRoot
+}
+
+func (m *mockImageOs) InstallInitrd() (string, string, error) {
+	m.installInitrdCalls++
+	return m.installRoot, m.versionInfo, m.err
+}
+
+func (m *mockImageOs) InstallImageOs(diskPathIdMap map[string]string) (string, error) {
+	m.installImageOsCalls++
+	return m.versionInfo, m.err
+}
+
+func readJSONFile(t *testing.T, path string, v interface{}) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("Failed to parse %s: %v", path, err)
+	}
+	return data
+}
+
+func blobPath(layoutPath, digest string) string {
+	return filepath.Join(layoutPath, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// verifyOciLayout checks the layout is self-consistent and returns its manifest.
+func verifyOciLayout(t *testing.T, layoutPath string) (ociIndex, ociManifest, ociImageConfig) {
+	t.Helper()
+
+	layoutData, err := os.ReadFile(filepath.Join(layoutPath, "oci-layout"))
+	if err != nil {
+		t.Fatalf("Failed to read oci-layout: %v", err)
+	}
+	if string(layoutData) != `{"imageLayoutVersion":"1.0.0"}` {
+		t.Errorf("Unexpected oci-layout content: %s", layoutData)
+	}
+
+	var index ociIndex
+	readJSONFile(t, filepath.Join(layoutPath, "index.json"), &index)
+	if index.SchemaVersion != 2 || index.MediaType != ociIndexMediaType {
+		t.Errorf("Unexpected index header: %+v", index)
+	}
+	if len(index.Manifests) != 1 {
+		t.Fatalf("Expected 1 manifest in index, got %d", len(index.Manifests))
+	}
+
+	var manifest ociManifest
+	manifestData := readJSONFile(t, blobPath(layoutPath, index.Manifests[0].Digest), &manifest)
+	if sha256Digest(manifestData) != index.Manifests[0].Digest {
+		t.Errorf("Manifest digest mismatch: index has %s", index.Manifests[0].Digest)
+	}
+	if int64(len(manifestData)) != index.Manifests[0].Size {
+		t.Errorf("Manifest size mismatch: %d != %d", len(manifestData), index.Manifests[0].Size)
+	}
+	if manifest.MediaType != ociManifestMediaType || len(manifest.Layers) != 1 {
+		t.Fatalf("Unexpected manifest: %+v", manifest)
+	}
+
+	var imageConfig ociImageConfig
+	configData := readJSONFile(t, blobPath(layoutPath, manifest.Config.Digest), &imageConfig)
+	if sha256Digest(configData) != manifest.Config.Digest {
+		t.Errorf("Config digest mismatch: manifest has %s", manifest.Config.Digest)
+	}
+
+	layerData, err := os.ReadFile(blobPath(layoutPath, manifest.Layers[0].Digest))
+	if err != nil {
+		t.Fatalf("Failed to read layer blob: %v", err)
+	}
+	if sha256Digest(layerData) != manifest.Layers[0].Digest {
+		t.Errorf("Layer digest mismatch: manifest has %s", manifest.Layers[0].Digest)
+	}
+	if int64(len(layerData)) != manifest.Layers[0].Size {
+		t.Errorf("Layer size mismatch: %d != %d", len(layerData), manifest.Layers[0].Size)
+	}
+	if len(imageConfig.RootFS.DiffIDs) != 1 || imageConfig.RootFS.DiffIDs[0] != manifest.Layers[0].Digest {
+		t.Errorf("Expected diff_ids to match the uncompressed layer digest, got %v", imageConfig.RootFS.DiffIDs)
+	}
+
+	return index, manifest, imageConfig
+}
+
+func TestWriteOciLayout(t *testing.T) {
+	tests := []struct {
+		name         string
+		arch         string
+		expectedArch string
+	}{
+		{name: "x86_64", arch: "x86_64", expectedArch: "amd64"},
+		{name: "aarch64", arch: "aarch64", expectedArch: "arm64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			layerContent := []byte("rootfs layer content")
+			layerPath := filepath.Join(tempDir, "rootfs.tar")
+			if err := os.WriteFile(layerPath, layerContent, 0644); err != nil {
+				t.Fatalf("Failed to create layer file: %v", err)
+			}
+			layoutPath := filepath.Join(tempDir, "layout")
+			created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+			if err := writeOciLayout(layoutPath, layerPath, tt.arch, "1.0.0", created); err != nil {
+				t.Fatalf("writeOciLayout failed: %v", err)
+			}
+
+			index, manifest, imageConfig := verifyOciLayout(t, layoutPath)
+			if manifest.Layers[0].Digest != sha256Digest(layerContent) {
+				t.Errorf("Expected layer digest %s, got %s", sha256Digest(layerContent), manifest.Layers[0].Digest)
+			}
+			if manifest.Layers[0].MediaType != ociLayerMediaType {
+				t.Errorf("Unexpected layer media type: %s", manifest.Layers[0].MediaType)
+			}
+			if manifest.Config.MediaType != ociConfigMediaType {
+				t.Errorf("Unexpected config media type: %s", manifest.Config.MediaType)
+			}
+			if got := index.Manifests[0].Annotations[ociRefNameAnnotation]; got != "1.0.0" {
+				t.Errorf("Expected ref name 1.0.0, got %q", got)
+			}
+			if imageConfig.Architecture != tt.expectedArch || imageConfig.OS != "linux" {
+				t.Errorf("Unexpected platform: %s/%s", imageConfig.OS, imageConfig.Architecture)
+			}
+			if imageConfig.Created != "2026-01-02T03:04:05Z" {
+				t.Errorf("Unexpected created time: %s", imageConfig.Created)
+			}
+			if _, err := os.Stat(layerPath); !os.IsNotExist(err) {
+				t.Errorf("Expected layer file to be moved into the layout")
+			}
+		})
+	}
+}
+
+func TestWriteOciLayoutMissingLayer(t *testing.T) {
+	tempDir := t.TempDir()
+	err := writeOciLayout(filepath.Join(tempDir, "layout"), filepath.Join(tempDir, "missing.tar"),
+		"x86_64", "latest", time.Now())
+	if err == nil {
+		t.Fatal("Expected error for missing layer file")
+	}
+}
+
+func TestOciMaker_BuildOciImage(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name          string
+		installErr    error
+		expectError   bool
+		expectedError string
+	}{
+		{
+			name: "successful_build",
+		},
+		{
+			name:          "install_rootfs_failure",
+			installErr:    fmt.Errorf("package install failed"),
+			expectError:   true,
+			expectedError: "failed to install OCI rootfs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			rootfs := filepath.Join(tempDir, "rootfs")
+			if err := os.MkdirAll(rootfs, 0755); err != nil {
+				t.Fatalf("Failed to create rootfs: %v", err)
+			}
+			executor := &tarRecordingExecutor{}
+			shell.Default = executor
+
+			imageOs := &mockImageOs{installRoot: rootfs, versionInfo: "1.0.0", err: tt.installErr}
+			ociMaker := &OciMaker{
+				template: &config.ImageTemplate{
+					Image:  config.ImageInfo{Name: "test-image"},
+					Target: config.TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "oci"},
+				},
+				ImageBuildDir: filepath.Join(tempDir, "imagebuild"),
+				ImageOs:       imageOs,
+			}
+			if err := os.MkdirAll(ociMaker.ImageBuildDir, 0700); err != nil {
+				t.Fatalf("Failed to create image build dir: %v", err)
+			}
+
+			err := ociMaker.BuildOciImage()
+
+			if imageOs.installImageOsCalls != 0 {
+				t.Errorf("Expected disk image install to be skipped, got %d calls", imageOs.installImageOsCalls)
+			}
+			for _, cmd := range executor.commands {
+				for _, diskStep := range []string{"losetup", "sfdisk", "mkfs", "grub", "bootctl", "ukify", "sbsign"} {
+					if strings.Contains(cmd, diskStep) {
+						t.Errorf("Unexpected disk/boot command for oci image: %s", cmd)
+					}
+				}
+			}
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error, but got none")
+				}
+				if !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing %q, got: %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildOciImage failed: %v", err)
+			}
+			if imageOs.installInitrdCalls != 1 {
+				t.Errorf("Expected rootfs install once, got %d", imageOs.installInitrdCalls)
+			}
+
+			expectedLayout := filepath.Join(ociMaker.ImageBuildDir, "test-image-1.0.0-oci")
+			if ociMaker.GetOciLayoutPath() != expectedLayout {
+				t.Errorf("Expected layout path %s, got %s", expectedLayout, ociMaker.GetOciLayoutPath())
+			}
+			index, _, _ := verifyOciLayout(t, expectedLayout)
+			if got := index.Manifests[0].Annotations[ociRefNameAnnotation]; got != "1.0.0" {
+				t.Errorf("Expected ref name 1.0.0, got %q", got)
+			}
+		})
+	}
+}
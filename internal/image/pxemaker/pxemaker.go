@@ -0,0 +1,317 @@
+package pxemaker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/chroot"
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/config/manifest"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imageboot"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imageos"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/mount"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
+)
+
+// pxeBaseURL is the placeholder URL of the HTTP server the artifacts are
+// served from in the sample boot configurations.
+const pxeBaseURL = "http://pxe-server/images"
+
+type PxeMakerInterface interface {
+	Init() error
+	BuildPxeImage() error
+	GetPxeVersion() string
+	GetPxeRootfsPath() string
+	GetPxeArtifacts() PxeArtifacts
+	CleanPxeRootfs() error
+}
+
+// PxeArtifacts are the paths of the files a PXE image is exported as.
+type PxeArtifacts struct {
+	Kernel   string
+	Initrd   string
+	Rootfs   string
+	IpxeCfg  string
+	PxeLinux string
+}
+
+type PxeMaker struct {
+	template      *config.ImageTemplate
+	ImageBuildDir string
+	PxeRootfsPath string
+	Artifacts     PxeArtifacts
+	VersionInfo   string
+	ChrootEnv     chroot.ChrootEnvInterface
+	ImageOs       imageos.ImageOsInterface
+}
+
+var log = logger.Logger()
+
+func NewPxeMaker(chrootEnv chroot.ChrootEnvInterface, template *config.ImageTemplate) (*PxeMaker, error) {
+	// nil checking is done in the constructor only; the template schema has
+	// already been validated at load time
+	if template == nil {
+		return nil, fmt.Errorf("image template cannot be nil")
+	}
+	if chrootEnv == nil {
+		return nil, fmt.Errorf("chroot environment cannot be nil")
+	}
+
+	imageOs, err := imageos.NewImageOs(chrootEnv, template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image OS: %w", err)
+	}
+
+	return &PxeMaker{
+		template:  template,
+		ChrootEnv: chrootEnv,
+		ImageOs:   imageOs,
+	}, nil
+}
+
+func (pxeMaker *PxeMaker) Init() error {
+	globalWorkDir, err := config.WorkDir()
+	if err != nil {
+		return fmt.Errorf("failed to get global work directory: %w", err)
+	}
+
+	providerId := system.GetProviderId(
+		pxeMaker.template.Target.OS,
+		pxeMaker.template.Target.Dist,
+		pxeMaker.template.Target.Arch,
+	)
+
+	pxeMaker.ImageBuildDir = filepath.Join(
+		globalWorkDir,
+		providerId,
+		"imagebuild",
+		pxeMaker.template.GetSystemConfigName(),
+	)
+
+	return os.MkdirAll(pxeMaker.ImageBuildDir, 0700)
+}
+
+func (pxeMaker *PxeMaker) GetPxeVersion() string {
+	return pxeMaker.VersionInfo
+}
+
+func (pxeMaker *PxeMaker) GetPxeRootfsPath() string {
+	return pxeMaker.PxeRootfsPath
+}
+
+func (pxeMaker *PxeMaker) GetPxeArtifacts() PxeArtifacts {
+	return pxeMaker.Artifacts
+}
+
+// BuildPxeImage installs the image rootfs and exports it for network boot:
+// the kernel and initramfs of the rootfs, the rootfs as a squashfs image, and
+// sample iPXE and pxelinux configurations booting them. Packages are
+// installed and the system configuration is applied the same way as for
+// initrd images, so no disk, partition, bootloader or signing steps are run.
+func (pxeMaker *PxeMaker) BuildPxeImage() (err error) {
+	log.Infof("Building PXE artifacts for: %s", pxeMaker.template.GetImageName())
+
+	imageName := pxeMaker.template.GetImageName()
+
+	pxeMaker.PxeRootfsPath, pxeMaker.VersionInfo, err = pxeMaker.ImageOs.InstallInitrd()
+	if err != nil {
+		if cleanErr := pxeMaker.CleanPxeRootfs(); cleanErr != nil {
+			log.Errorf("Failed to clean PXE rootfs after install failure: %v", cleanErr)
+		}
+		return fmt.Errorf("failed to install PXE rootfs: %w", err)
+	}
+
+	// Copy SBOM into the rootfs (inside the image)
+	if err := manifest.CopySBOMToChroot(pxeMaker.PxeRootfsPath); err != nil {
+		log.Warnf("Failed to copy SBOM into PXE rootfs: %v", err)
+		// Don't fail the build if SBOM copy fails, just log warning
+	}
+
+	if err := mount.UmountPath(pxeMaker.PxeRootfsPath + chroot.ChrootRepoDir); err != nil {
+		log.Errorf("Failed to unmount cache-repo %s: %v",
+			pxeMaker.PxeRootfsPath+chroot.ChrootRepoDir, err)
+		return fmt.Errorf("failed to unmount cache-repo %s: %w",
+			pxeMaker.PxeRootfsPath+chroot.ChrootRepoDir, err)
+	}
+
+	pkgType := pxeMaker.ChrootEnv.GetTargetOsPkgType()
+	kernelVersion, err := imageboot.TargetKernelVersion(pxeMaker.PxeRootfsPath, pkgType, pxeMaker.template)
+	if err != nil {
+		return fmt.Errorf("failed to get kernel version of PXE rootfs: %w", err)
+	}
+	initrdName, err := findInitramfs(pxeMaker.PxeRootfsPath, kernelVersion)
+	if err != nil {
+		return err
+	}
+
+	baseName := imageName
+	if pxeMaker.VersionInfo != "" {
+		baseName = fmt.Sprintf("%s-%s", imageName, pxeMaker.VersionInfo)
+	}
+	pxeMaker.Artifacts = PxeArtifacts{
+		Kernel:   filepath.Join(pxeMaker.ImageBuildDir, baseName+"-vmlinuz"),
+		Initrd:   filepath.Join(pxeMaker.ImageBuildDir, baseName+"-initrd.img"),
+		Rootfs:   filepath.Join(pxeMaker.ImageBuildDir, baseName+"-rootfs.squashfs"),
+		IpxeCfg:  filepath.Join(pxeMaker.ImageBuildDir, baseName+".ipxe"),
+		PxeLinux: filepath.Join(pxeMaker.ImageBuildDir, baseName+"-pxelinux.cfg"),
+	}
+
+	bootFiles := map[string]string{
+		filepath.Join(pxeMaker.PxeRootfsPath, "boot", "vmlinuz-"+kernelVersion): pxeMaker.Artifacts.Kernel,
+		filepath.Join(pxeMaker.PxeRootfsPath, "boot", initrdName):               pxeMaker.Artifacts.Initrd,
+	}
+	for src, dst := range bootFiles {
+		if err := file.CopyFile(src, dst, "", true); err != nil {
+			log.Errorf("Failed to copy %s to %s: %v", src, dst, err)
+			return fmt.Errorf("failed to copy %s to output directory: %w", filepath.Base(src), err)
+		}
+	}
+
+	if err := createRootfsSquashfs(pxeMaker.PxeRootfsPath, pxeMaker.Artifacts.Rootfs); err != nil {
+		return fmt.Errorf("failed to create PXE rootfs image: %w", err)
+	}
+
+	for _, path := range []string{pxeMaker.Artifacts.Kernel, pxeMaker.Artifacts.Initrd, pxeMaker.Artifacts.Rootfs} {
+		// The artifacts are created with sudo; make them readable for the user
+		if _, err := shell.ExecCmd("chmod 0644 "+path, true, shell.HostPath, nil); err != nil {
+			log.Errorf("Failed to set permissions for %s: %v", path, err)
+			return fmt.Errorf("failed to set permissions for %s: %w", path, err)
+		}
+	}
+
+	if err := pxeMaker.writeBootConfigs(initrdName); err != nil {
+		return err
+	}
+
+	// Copy SBOM to image build directory
+	if err := manifest.CopySBOMToImageBuildDir(pxeMaker.ImageBuildDir); err != nil {
+		log.Warnf("Failed to copy SBOM to image build directory: %v", err)
+		// Don't fail the build if SBOM copy fails, just log warning
+	}
+
+	pxeMaker.template.FinishPureImageBuildTimer()
+	pureImageBuildDuration := pxeMaker.template.GetPureImageBuildDuration()
+	if pureImageBuildDuration > 0 {
+		log.Infof("Pure PXE image build time: %s", pureImageBuildDuration.Round(time.Millisecond))
+		log.Infof("PXE image build completed successfully: %s", pxeMaker.ImageBuildDir)
+	}
+
+	return nil
+}
+
+// findInitramfs returns the file name of the initramfs of kernelVersion in
+// the /boot directory of rootfsPath, as generated by dracut or by
+// initramfs-tools.
+func findInitramfs(rootfsPath, kernelVersion string) (string, error) {
+	for _, name := range []string{"initramfs-" + kernelVersion + ".img", "initrd.img-" + kernelVersion} {
+		if _, err := os.Stat(filepath.Join(rootfsPath, "boot", name)); err == nil {
+			return name, nil
+		}
+	}
+	log.Errorf("No initramfs found for kernel %s in /boot", kernelVersion)
+	return "", fmt.Errorf("no initramfs found for kernel %s in /boot; install dracut or initramfs-tools in the image", kernelVersion)
+}
+
+// createRootfsSquashfs compresses rootfsPath, without the cache repository
+// mount point, into the squashfs image squashfsPath.
+func createRootfsSquashfs(rootfsPath, squashfsPath string) error {
+	cmdStr := fmt.Sprintf("mksquashfs %s %s -noappend -comp zstd -xattrs -e %s",
+		rootfsPath, squashfsPath, strings.TrimPrefix(chroot.ChrootRepoDir, "/"))
+	if _, err := shell.ExecCmdWithStream(cmdStr, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to create squashfs image of rootfs %s: %v", rootfsPath, err)
+		return fmt.Errorf("failed to create squashfs image of rootfs %s: %w", rootfsPath, err)
+	}
+	if _, err := os.Stat(squashfsPath); os.IsNotExist(err) {
+		log.Errorf("Squashfs image does not exist: %s", squashfsPath)
+		return fmt.Errorf("squashfs image does not exist: %s", squashfsPath)
+	}
+	return nil
+}
+
+// pxeBootArgs returns the kernel command line booting the rootfs squashfs
+// image served at rootfsURL: with the dracut live modules if initrdName was
+// generated by dracut, otherwise with live-boot.
+func pxeBootArgs(initrdName, rootfsURL, cmdline string) string {
+	args := "boot=live fetch=" + rootfsURL
+	if strings.HasPrefix(initrdName, "initramfs-") {
+		args = "root=live:" + rootfsURL + " rd.live.image"
+	}
+	return strings.TrimSpace(args + " " + cmdline)
+}
+
+// writeBootConfigs writes the sample iPXE script and pxelinux configuration
+// booting the artifacts from pxeBaseURL, which is to be replaced with the URL
+// they are served from.
+func (pxeMaker *PxeMaker) writeBootConfigs(initrdName string) error {
+	artifacts := pxeMaker.Artifacts
+	kernel := filepath.Base(artifacts.Kernel)
+	initrd := filepath.Base(artifacts.Initrd)
+	rootfs := filepath.Base(artifacts.Rootfs)
+	cmdline := pxeMaker.template.GetKernelCmdline()
+	label := pxeMaker.template.GetImageName()
+
+	ipxe := fmt.Sprintf(`#!ipxe
+# Sample iPXE script for %[1]s; set base-url to where the files are served
+set base-url %[2]s
+kernel ${base-url}/%[3]s initrd=%[4]s %[5]s
+initrd ${base-url}/%[4]s
+boot
+`, label, pxeBaseURL, kernel, initrd, pxeBootArgs(initrdName, "${base-url}/"+rootfs, cmdline))
+
+	pxelinux := fmt.Sprintf(`# Sample pxelinux configuration for %[1]s; replace %[2]s with where the
+# squashfs image is served, and copy the kernel and initrd to the TFTP root
+DEFAULT %[1]s
+LABEL %[1]s
+  KERNEL %[3]s
+  INITRD %[4]s
+  APPEND %[5]s
+`, label, pxeBaseURL, kernel, initrd, pxeBootArgs(initrdName, pxeBaseURL+"/"+rootfs, cmdline))
+
+	for path, content := range map[string]string{artifacts.IpxeCfg: ipxe, artifacts.PxeLinux: pxelinux} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			log.Errorf("Failed to write PXE boot configuration %s: %v", path, err)
+			return fmt.Errorf("failed to write PXE boot configuration %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func (pxeMaker *PxeMaker) CleanPxeRootfs() error {
+	log.Infof("Cleaning up PXE rootfs: %s", pxeMaker.PxeRootfsPath)
+
+	if pxeMaker.PxeRootfsPath == "" {
+		log.Debugf("PXE rootfs path is empty, nothing to clean")
+		return nil
+	}
+
+	if _, err := os.Stat(pxeMaker.PxeRootfsPath); os.IsNotExist(err) {
+		log.Debugf("PXE rootfs path does not exist: %s", pxeMaker.PxeRootfsPath)
+		return nil
+	}
+
+	if err := mount.UmountPath(pxeMaker.PxeRootfsPath + chroot.ChrootRepoDir); err != nil {
+		log.Errorf("Failed to unmount cache-repo %s: %v",
+			pxeMaker.PxeRootfsPath+chroot.ChrootRepoDir, err)
+		return fmt.Errorf("failed to unmount cache-repo %s: %w",
+			pxeMaker.PxeRootfsPath+chroot.ChrootRepoDir, err)
+	}
+
+	if imageos.RootfsKept(pxeMaker.PxeRootfsPath, pxeMaker.template) {
+		log.Infof("Keeping PXE rootfs %s for the next incremental build", pxeMaker.PxeRootfsPath)
+		return nil
+	}
+
+	if _, err := shell.ExecCmd("rm -rf "+pxeMaker.PxeRootfsPath, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to remove PXE rootfs directory %s: %v",
+			pxeMaker.PxeRootfsPath, err)
+		return fmt.Errorf("failed to remove PXE rootfs directory: %w", err)
+	}
+
+	return nil
+}
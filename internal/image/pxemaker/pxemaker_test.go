@@ -0,0 +1,253 @@
+package pxemaker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/chroot"
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// exportExecutor records every command and runs the file copies for real.
+// mksquashfs is simulated by writing the image named on its command line.
+type exportExecutor struct {
+	commands []string
+}
+
+func (e *exportExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.commands = append(e.commands, cmdStr)
+	if strings.HasPrefix(cmdStr, "mksquashfs ") {
+		fields := strings.Fields(cmdStr)
+		return "", os.WriteFile(fields[2], []byte("hsqs"), 0644)
+	}
+	for _, prefix := range []string{"mkdir ", "cp ", "chmod "} {
+		if strings.HasPrefix(cmdStr, prefix) {
+			output, err := exec.Command("bash", "-c", cmdStr).CombinedOutput()
+			if err != nil {
+				return string(output), fmt.Errorf("%s: %w", output, err)
+			}
+			return string(output), nil
+		}
+	}
+	return "", nil
+}
+
+func (e *exportExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *exportExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *exportExecutor) ExecCmdWithInput(inputStr string, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+type mockImageOs struct {
+	installRoot         string
+	versionInfo         string
+	err                 error
+	installInitrdCalls  int
+	installImageOsCalls int
+}
+
+func (m *mockImageOs) GetInstallRoot() string {
+	return m.installRoot
+}
+
+func (m *mockImageOs) InstallInitrd() (string, string, error) {
+	m.installInitrdCalls++
+	return m.installRoot, m.versionInfo, m.err
+}
+
+func (m *mockImageOs) InstallImageOs(diskPathIdMap map[string]string) (string, error) {
+	m.installImageOsCalls++
+	return m.versionInfo, m.err
+}
+
+type mockChrootEnv struct {
+	chroot.ChrootEnvInterface
+	pkgType string
+}
+
+func (m *mockChrootEnv) GetTargetOsPkgType() string {
+	return m.pkgType
+}
+
+// createTestRootfs lays out a minimal rootfs with a kernel and the
+// initramfs named initrdName.
+func createTestRootfs(t *testing.T, rootfs, initrdName string) {
+	t.Helper()
+	files := map[string]string{
+		"etc/os-release":         "NAME=Test\n",
+		"boot/vmlinuz-6.12.0":    "kernel",
+		"boot/" + initrdName:     "initramfs",
+		"cdrom/cache-repo/pkg":   "cached package",
+		"usr/lib/modules/.dummy": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(rootfs, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+}
+
+func TestPxeMaker_BuildPxeImage(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name          string
+		pkgType       string
+		initrdName    string
+		installErr    error
+		expectError   bool
+		expectedError string
+		wantBootArgs  string
+	}{
+		{
+			name:         "dracut_initramfs",
+			pkgType:      "rpm",
+			initrdName:   "initramfs-6.12.0.img",
+			wantBootArgs: "root=live:${base-url}/test-image-1.0.0-rootfs.squashfs rd.live.image console=ttyS1",
+		},
+		{
+			name:         "initramfs_tools_initrd",
+			pkgType:      "deb",
+			initrdName:   "initrd.img-6.12.0",
+			wantBootArgs: "boot=live fetch=${base-url}/test-image-1.0.0-rootfs.squashfs console=ttyS1",
+		},
+		{
+			name:          "missing_initramfs",
+			pkgType:       "rpm",
+			initrdName:    "config-6.12.0",
+			expectError:   true,
+			expectedError: "no initramfs found for kernel 6.12.0",
+		},
+		{
+			name:          "install_rootfs_failure",
+			pkgType:       "rpm",
+			initrdName:    "initramfs-6.12.0.img",
+			installErr:    fmt.Errorf("package install failed"),
+			expectError:   true,
+			expectedError: "failed to install PXE rootfs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			rootfs := filepath.Join(tempDir, "rootfs")
+			createTestRootfs(t, rootfs, tt.initrdName)
+			executor := &exportExecutor{}
+			shell.Default = executor
+
+			imageOs := &mockImageOs{installRoot: rootfs, versionInfo: "1.0.0", err: tt.installErr}
+			pxeMaker := &PxeMaker{
+				template: &config.ImageTemplate{
+					Image:  config.ImageInfo{Name: "test-image"},
+					Target: config.TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "pxe"},
+					SystemConfig: config.SystemConfig{
+						Kernel: config.KernelConfig{Cmdline: "console=ttyS1"},
+					},
+				},
+				ImageBuildDir: filepath.Join(tempDir, "imagebuild"),
+				ChrootEnv:     &mockChrootEnv{pkgType: tt.pkgType},
+				ImageOs:       imageOs,
+			}
+			if err := os.MkdirAll(pxeMaker.ImageBuildDir, 0700); err != nil {
+				t.Fatalf("Failed to create image build dir: %v", err)
+			}
+
+			err := pxeMaker.BuildPxeImage()
+
+			if imageOs.installImageOsCalls != 0 {
+				t.Errorf("Expected disk image install to be skipped, got %d calls", imageOs.installImageOsCalls)
+			}
+			for _, cmd := range executor.commands {
+				for _, diskStep := range []string{"losetup", "sfdisk", "mkfs", "grub", "bootctl", "ukify", "sbsign"} {
+					if strings.Contains(cmd, diskStep) {
+						t.Errorf("Unexpected disk/boot command for PXE image: %s", cmd)
+					}
+				}
+			}
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error, but got none")
+				}
+				if !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing %q, got: %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPxeImage failed: %v", err)
+			}
+			if imageOs.installInitrdCalls != 1 {
+				t.Errorf("Expected rootfs install once, got %d", imageOs.installInitrdCalls)
+			}
+
+			artifacts := pxeMaker.GetPxeArtifacts()
+			expected := map[string]string{
+				artifacts.Kernel: "kernel",
+				artifacts.Initrd: "initramfs",
+				artifacts.Rootfs: "hsqs",
+			}
+			for path, content := range expected {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Errorf("Expected PXE artifact %s: %v", path, err)
+					continue
+				}
+				if string(data) != content {
+					t.Errorf("Expected %s to contain %q, got %q", path, content, data)
+				}
+			}
+			if filepath.Base(artifacts.Kernel) != "test-image-1.0.0-vmlinuz" {
+				t.Errorf("Unexpected kernel artifact name: %s", artifacts.Kernel)
+			}
+
+			squashfsCmd := ""
+			for _, cmd := range executor.commands {
+				if strings.HasPrefix(cmd, "mksquashfs ") {
+					squashfsCmd = cmd
+				}
+			}
+			if !strings.HasPrefix(squashfsCmd, "mksquashfs "+rootfs+" ") || !strings.Contains(squashfsCmd, "-e cdrom/cache-repo") {
+				t.Errorf("Expected the rootfs without the cache repository to be squashed, got: %q", squashfsCmd)
+			}
+
+			ipxe, err := os.ReadFile(artifacts.IpxeCfg)
+			if err != nil {
+				t.Fatalf("Expected an iPXE script: %v", err)
+			}
+			for _, line := range []string{
+				"#!ipxe",
+				"kernel ${base-url}/test-image-1.0.0-vmlinuz initrd=test-image-1.0.0-initrd.img " + tt.wantBootArgs,
+				"initrd ${base-url}/test-image-1.0.0-initrd.img",
+			} {
+				if !strings.Contains(string(ipxe), line) {
+					t.Errorf("Expected iPXE script to contain %q, got:\n%s", line, ipxe)
+				}
+			}
+			pxelinux, err := os.ReadFile(artifacts.PxeLinux)
+			if err != nil {
+				t.Fatalf("Expected a pxelinux configuration: %v", err)
+			}
+			if !strings.Contains(string(pxelinux), "KERNEL test-image-1.0.0-vmlinuz") {
+				t.Errorf("Expected pxelinux configuration to boot the kernel, got:\n%s", pxelinux)
+			}
+		})
+	}
+}
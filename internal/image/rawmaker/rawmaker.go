@@ -86,6 +86,7 @@ func (rawMaker *RawMaker) cleanupImageFileOnError(imagePath string) {
 	if imagePath == "" {
 		return
 	}
+	defer shell.BeginCleanup()()
 
 	if _, statErr := os.Stat(imagePath); statErr == nil {
 		log.Warnf("Cleaning up image file due to error: %s", imagePath)
@@ -116,12 +117,25 @@ func (rawMaker *RawMaker) BuildRawImage() error {
 	imageName := rawMaker.template.GetImageName()
 	imageFile := filepath.Join(rawMaker.ImageBuildDir, imageName+".raw")
 
-	log.Infof("Creating raw image file: %s", imageFile)
-
-	// Create loop device
-	loopDevPath, diskPathIdMap, err := rawMaker.LoopDev.CreateRawImageLoopDev(imageFile, rawMaker.template)
-	if err != nil {
-		return fmt.Errorf("failed to create loop device: %w", err)
+	// Create loop device, or attach the raw image of the build being resumed
+	// once its packages are installed
+	var loopDevPath string
+	var diskPathIdMap map[string]string
+	var err error
+	checkpoint := rawMaker.template.Checkpoint
+	if checkpoint.IsCompleted(config.StageInstall) {
+		log.Infof("Resuming the build of raw image file: %s", imageFile)
+		loopDevPath, diskPathIdMap, err = rawMaker.LoopDev.AttachRawImageLoopDev(imageFile, rawMaker.template, checkpoint.DiskPartitions)
+		if err != nil {
+			return fmt.Errorf("failed to attach loop device: %w", err)
+		}
+	} else {
+		log.Infof("Creating raw image file: %s", imageFile)
+		loopDevPath, diskPathIdMap, err = rawMaker.LoopDev.CreateRawImageLoopDev(imageFile, rawMaker.template)
+		if err != nil {
+			return fmt.Errorf("failed to create loop device: %w", err)
+		}
+		checkpoint.RecordDiskPartitions(diskPathIdMap)
 	}
 
 	// Setup cleanup for loop device (always needed)
@@ -141,14 +155,23 @@ func (rawMaker *RawMaker) BuildRawImage() error {
 	versionInfo, err := rawMaker.ImageOs.InstallImageOs(diskPathIdMap)
 	if err != nil {
 		// Loop device will be cleaned up by defer
-		// Image file cleanup handled separately if needed
-		rawMaker.cleanupImageFileOnError(imageFile)
+		// Image file cleanup handled separately if needed, the stages after
+		// install resume from the image file
+		if checkpoint.IsCompleted(config.StageInstall) {
+			log.Infof("Keeping image file %s to resume the build from", imageFile)
+		} else {
+			rawMaker.cleanupImageFileOnError(imageFile)
+		}
 		return fmt.Errorf("failed to install OS: %w", err)
 	}
 
 	log.Infof("OS installation completed with version: %s", versionInfo)
 
 	// File renaming
+	// Past this point the build is no longer resumable from the image file
+	if err := checkpoint.Remove(); err != nil {
+		log.Warnf("%v", err)
+	}
 	finalImagePath, err := rawMaker.renameImageFile(imageFile, imageName, versionInfo)
 	if err != nil {
 		rawMaker.cleanupImageFileOnError(imageFile)
@@ -103,11 +103,11 @@ func (m *mockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string
 	return nil
 }
 
-func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return nil
 }
 
-func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return nil
 }
 
@@ -119,12 +119,15 @@ type mockLoopDev struct {
 	shouldFailCreate bool
 	shouldFailDelete bool
 	loopDevPath      string
+	created          bool
+	attached         map[string]string // partitions of the attached raw image
 }
 
 func (m *mockLoopDev) CreateRawImageLoopDev(filePath string, template *config.ImageTemplate) (string, map[string]string, error) {
 	if m.shouldFailCreate {
 		return "", nil, fmt.Errorf("mock loop device creation failure")
 	}
+	m.created = true
 	diskPathIdMap := map[string]string{
 		"root": "/dev/loop0p1",
 		"boot": "/dev/loop0p2",
@@ -132,6 +135,11 @@ func (m *mockLoopDev) CreateRawImageLoopDev(filePath string, template *config.Im
 	return m.loopDevPath, diskPathIdMap, nil
 }
 
+func (m *mockLoopDev) AttachRawImageLoopDev(filePath string, template *config.ImageTemplate, prevDiskPathIdMap map[string]string) (string, map[string]string, error) {
+	m.attached = prevDiskPathIdMap
+	return m.loopDevPath, prevDiskPathIdMap, nil
+}
+
 func (m *mockLoopDev) LoopSetupDelete(loopDevPath string) error {
 	if m.shouldFailDelete {
 		return fmt.Errorf("mock loop device deletion failure")
@@ -1221,3 +1229,63 @@ func TestRawMaker_Interface_Compliance(t *testing.T) {
 		t.Error("Expected error without proper setup")
 	}
 }
+
+func TestRawMaker_BuildRawImage_ResumeAfterInstall(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "mkdir", Output: "", Error: nil},
+		{Pattern: "rm", Output: "", Error: nil},
+	})
+
+	tempDir := t.TempDir()
+	chrootEnv := &mockChrootEnv{pkgType: "rpm", chrootEnvRoot: tempDir}
+	if err := os.MkdirAll(chrootEnv.GetChrootImageBuildDir(), 0700); err != nil {
+		t.Fatalf("Failed to create chroot image build dir: %v", err)
+	}
+	os.Setenv("IMAGE_COMPOSER_WORK_DIR", tempDir)
+	defer os.Unsetenv("IMAGE_COMPOSER_WORK_DIR")
+
+	template := &config.ImageTemplate{
+		Target:       config.TargetInfo{OS: "azure-linux", Dist: "azl3", Arch: "x86_64"},
+		Image:        config.ImageInfo{Name: "test-image"},
+		SystemConfig: config.SystemConfig{Name: "test-config"},
+	}
+	checkpoint, err := config.NewBuildCheckpoint(filepath.Join(tempDir, "build-checkpoint.json"), template)
+	if err != nil {
+		t.Fatalf("Failed to create build checkpoint: %v", err)
+	}
+	partitions := map[string]string{"root": "/dev/loop3p1", "boot": "/dev/loop3p2"}
+	checkpoint.RecordDiskPartitions(partitions)
+	checkpoint.Complete(config.StageResolve, config.StageDownload, config.StageInstall)
+	template.Checkpoint = checkpoint
+
+	rawMaker, err := rawmaker.NewRawMaker(chrootEnv, template)
+	if err != nil {
+		t.Fatalf("Failed to create RawMaker: %v", err)
+	}
+	loopDev := &mockLoopDev{loopDevPath: "/dev/loop0"}
+	rawMaker.LoopDev = loopDev
+	rawMaker.ImageOs = &mockImageOs{shouldFailInstall: true}
+	if err := rawMaker.Init(); err != nil {
+		t.Fatalf("Failed to initialize RawMaker: %v", err)
+	}
+	imageFile := filepath.Join(rawMaker.ImageBuildDir, "test-image.raw")
+	if err := os.WriteFile(imageFile, []byte("partially built image"), 0644); err != nil {
+		t.Fatalf("Failed to create image file: %v", err)
+	}
+
+	err = rawMaker.BuildRawImage()
+	if err == nil || !strings.Contains(err.Error(), "failed to install OS") {
+		t.Fatalf("Expected the install failure, got: %v", err)
+	}
+	if loopDev.created {
+		t.Error("Expected the raw image of the resumed build to be reused, not created")
+	}
+	if len(loopDev.attached) != len(partitions) {
+		t.Errorf("Expected the recorded partitions to be attached, got %v", loopDev.attached)
+	}
+	if _, err := os.Stat(imageFile); err != nil {
+		t.Errorf("Expected the image file to be kept for the next resume: %v", err)
+	}
+}
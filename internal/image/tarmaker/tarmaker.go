@@ -0,0 +1,218 @@
+package tarmaker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/chroot"
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/config/manifest"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imageos"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/mount"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
+)
+
+type TarMakerInterface interface {
+	Init() error
+	BuildTarImage() error
+	GetTarVersion() string
+	GetTarImagePath() string
+	GetTarRootfsPath() string
+	CleanTarRootfs() error
+}
+
+type TarMaker struct {
+	template      *config.ImageTemplate
+	ImageBuildDir string
+	TarRootfsPath string
+	TarImagePath  string
+	VersionInfo   string
+	ChrootEnv     chroot.ChrootEnvInterface
+	ImageOs       imageos.ImageOsInterface
+}
+
+var log = logger.Logger()
+
+func NewTarMaker(chrootEnv chroot.ChrootEnvInterface, template *config.ImageTemplate) (*TarMaker, error) {
+	// nil checking is done in the constructor only; the template schema has
+	// already been validated at load time
+	if template == nil {
+		return nil, fmt.Errorf("image template cannot be nil")
+	}
+	if chrootEnv == nil {
+		return nil, fmt.Errorf("chroot environment cannot be nil")
+	}
+
+	imageOs, err := imageos.NewImageOs(chrootEnv, template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image OS: %w", err)
+	}
+
+	return &TarMaker{
+		template:  template,
+		ChrootEnv: chrootEnv,
+		ImageOs:   imageOs,
+	}, nil
+}
+
+func (tarMaker *TarMaker) Init() error {
+	globalWorkDir, err := config.WorkDir()
+	if err != nil {
+		return fmt.Errorf("failed to get global work directory: %w", err)
+	}
+
+	providerId := system.GetProviderId(
+		tarMaker.template.Target.OS,
+		tarMaker.template.Target.Dist,
+		tarMaker.template.Target.Arch,
+	)
+
+	tarMaker.ImageBuildDir = filepath.Join(
+		globalWorkDir,
+		providerId,
+		"imagebuild",
+		tarMaker.template.GetSystemConfigName(),
+	)
+
+	return os.MkdirAll(tarMaker.ImageBuildDir, 0700)
+}
+
+func (tarMaker *TarMaker) GetTarVersion() string {
+	return tarMaker.VersionInfo
+}
+
+func (tarMaker *TarMaker) GetTarImagePath() string {
+	return tarMaker.TarImagePath
+}
+
+func (tarMaker *TarMaker) GetTarRootfsPath() string {
+	return tarMaker.TarRootfsPath
+}
+
+// BuildTarImage installs the image rootfs and exports it as a gzip-compressed
+// tarball. Packages are installed and the system configuration is applied the
+// same way as for initrd images, so no disk, partition, bootloader or signing
+// steps are run and no fstab is generated.
+func (tarMaker *TarMaker) BuildTarImage() (err error) {
+	log.Infof("Building rootfs tarball for: %s", tarMaker.template.GetImageName())
+
+	imageName := tarMaker.template.GetImageName()
+
+	tarMaker.TarRootfsPath, tarMaker.VersionInfo, err = tarMaker.ImageOs.InstallInitrd()
+	if err != nil {
+		if cleanErr := tarMaker.CleanTarRootfs(); cleanErr != nil {
+			log.Errorf("Failed to clean tar rootfs after install failure: %v", cleanErr)
+		}
+		return fmt.Errorf("failed to install tar rootfs: %w", err)
+	}
+
+	// Copy SBOM into the rootfs (inside the image)
+	if err := manifest.CopySBOMToChroot(tarMaker.TarRootfsPath); err != nil {
+		log.Warnf("Failed to copy SBOM into tar rootfs: %v", err)
+		// Don't fail the build if SBOM copy fails, just log warning
+	}
+
+	if err := mount.UmountPath(tarMaker.TarRootfsPath + chroot.ChrootRepoDir); err != nil {
+		log.Errorf("Failed to unmount cache-repo %s: %v",
+			tarMaker.TarRootfsPath+chroot.ChrootRepoDir, err)
+		return fmt.Errorf("failed to unmount cache-repo %s: %w",
+			tarMaker.TarRootfsPath+chroot.ChrootRepoDir, err)
+	}
+
+	fileName := imageName
+	if tarMaker.VersionInfo != "" {
+		fileName = fmt.Sprintf("%s-%s", imageName, tarMaker.VersionInfo)
+	}
+	tarMaker.TarImagePath = filepath.Join(tarMaker.ImageBuildDir, fileName+".tar.gz")
+	// Archive entries are clamped to SOURCE_DATE_EPOCH, or to the Unix epoch
+	// when it is unset, so two builds of the same template produce
+	// byte-identical tarballs
+	mtime, _ := system.SourceDateEpoch()
+	if err := createRootfsArchive(tarMaker.TarRootfsPath, tarMaker.TarImagePath, mtime); err != nil {
+		return fmt.Errorf("failed to create rootfs tarball: %w", err)
+	}
+
+	// Copy SBOM to image build directory
+	if err := manifest.CopySBOMToImageBuildDir(tarMaker.ImageBuildDir); err != nil {
+		log.Warnf("Failed to copy SBOM to image build directory: %v", err)
+		// Don't fail the build if SBOM copy fails, just log warning
+	}
+
+	tarMaker.template.FinishPureImageBuildTimer()
+	pureImageBuildDuration := tarMaker.template.GetPureImageBuildDuration()
+	if pureImageBuildDuration > 0 {
+		log.Infof("Pure tar image build time: %s", pureImageBuildDuration.Round(time.Millisecond))
+		log.Infof("Tar image build completed successfully: %s", tarMaker.TarImagePath)
+	}
+
+	return nil
+}
+
+// createRootfsArchive archives rootfsPath into archivePath (a .tar.gz path).
+// Entries are sorted, their timestamps are clamped to mtime and the gzip
+// header carries no name or timestamp, so the output only depends on the
+// rootfs content. Numeric ownership, permissions and extended attributes are
+// preserved.
+func createRootfsArchive(rootfsPath, archivePath string, mtime int64) error {
+	tarPath := strings.TrimSuffix(archivePath, ".gz")
+	cmdStr := fmt.Sprintf("tar --sort=name --mtime=@%d --clamp-mtime --numeric-owner --xattrs --xattrs-include=* "+
+		"--pax-option=exthdr.name=%%d/PaxHeaders/%%f,delete=atime,delete=ctime "+
+		"--exclude=.%s -C %s -cf %s .", mtime, chroot.ChrootRepoDir, rootfsPath, tarPath)
+	if _, err := shell.ExecCmdWithStage("tar", cmdStr, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to archive rootfs %s: %v", rootfsPath, err)
+		return fmt.Errorf("failed to archive rootfs %s: %w", rootfsPath, err)
+	}
+	if _, err := shell.ExecCmd("gzip -n -f "+tarPath, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to compress rootfs archive %s: %v", tarPath, err)
+		return fmt.Errorf("failed to compress rootfs archive %s: %w", tarPath, err)
+	}
+	// The archive is created with sudo; make it readable for the user
+	if _, err := shell.ExecCmd("chmod 0644 "+archivePath, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to set permissions for rootfs tarball %s: %v", archivePath, err)
+		return fmt.Errorf("failed to set permissions for rootfs tarball %s: %w", archivePath, err)
+	}
+	if _, err := os.Stat(archivePath); os.IsNotExist(err) {
+		log.Errorf("Rootfs tarball does not exist: %s", archivePath)
+		return fmt.Errorf("rootfs tarball does not exist: %s", archivePath)
+	}
+	return nil
+}
+
+func (tarMaker *TarMaker) CleanTarRootfs() error {
+	log.Infof("Cleaning up tar rootfs: %s", tarMaker.TarRootfsPath)
+
+	if tarMaker.TarRootfsPath == "" {
+		log.Debugf("Tar rootfs path is empty, nothing to clean")
+		return nil
+	}
+
+	if _, err := os.Stat(tarMaker.TarRootfsPath); os.IsNotExist(err) {
+		log.Debugf("Tar rootfs path does not exist: %s", tarMaker.TarRootfsPath)
+		return nil
+	}
+
+	if err := mount.UmountPath(tarMaker.TarRootfsPath + chroot.ChrootRepoDir); err != nil {
+		log.Errorf("Failed to unmount cache-repo %s: %v",
+			tarMaker.TarRootfsPath+chroot.ChrootRepoDir, err)
+		return fmt.Errorf("failed to unmount cache-repo %s: %w",
+			tarMaker.TarRootfsPath+chroot.ChrootRepoDir, err)
+	}
+
+	if imageos.RootfsKept(tarMaker.TarRootfsPath, tarMaker.template) {
+		log.Infof("Keeping tar rootfs %s for the next incremental build", tarMaker.TarRootfsPath)
+		return nil
+	}
+
+	if _, err := shell.ExecCmd("rm -rf "+tarMaker.TarRootfsPath, true, shell.HostPath, nil); err != nil {
+		log.Errorf("Failed to remove tar rootfs directory %s: %v",
+			tarMaker.TarRootfsPath, err)
+		return fmt.Errorf("failed to remove tar rootfs directory: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package tarmaker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// archiveExecutor records every command and runs the archive commands for
+// real, so the produced tarball can be inspected.
+type archiveExecutor struct {
+	commands []string
+}
+
+func (e *archiveExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.commands = append(e.commands, cmdStr)
+	for _, prefix := range []string{"tar ", "gzip ", "chmod "} {
+		if strings.HasPrefix(cmdStr, prefix) {
+			output, err := exec.Command("bash", "-c", cmdStr).CombinedOutput()
+			if err != nil {
+				return string(output), fmt.Errorf("%s: %w", output, err)
+			}
+			return string(output), nil
+		}
+	}
+	return "", nil
+}
+
+func (e *archiveExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *archiveExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+func (e *archiveExecutor) ExecCmdWithInput(inputStr string, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return e.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+}
+
+type mockImageOs struct {
+	installRoot         string
+	versionInfo         string
+	err                 error
+	installInitrdCalls  int
+	installImageOsCalls int
+}
+
+func (m *mockImageOs) GetInstallRoot() string {
+	return m.installRoot
+}
+
+func (m *mockImageOs) InstallInitrd() (string, string, error) {
+	m.installInitrdCalls++
+	return m.installRoot, m.versionInfo, m.err
+}
+
+func (m *mockImageOs) InstallImageOs(diskPathIdMap map[string]string) (string, error) {
+	m.installImageOsCalls++
+	return m.versionInfo, m.err
+}
+
+// createTestRootfs lays out a minimal rootfs, including the cache repository
+// directory that must not end up in the archive.
+func createTestRootfs(t *testing.T, rootfs string) {
+	t.Helper()
+	files := map[string]string{
+		"etc/hostname":          "test-host\n",
+		"etc/os-release":        "NAME=Test\n",
+		"usr/bin/sh":            "#!/bin/true\n",
+		"cdrom/cache-repo/pkg":  "cached package",
+		"var/lib/misc/.keepdir": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(rootfs, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+}
+
+func readArchiveEntries(t *testing.T, archivePath string) []*tar.Header {
+	t.Helper()
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Archive is not gzip compressed: %v", err)
+	}
+	defer gz.Close()
+
+	var headers []*tar.Header
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func TestCreateRootfsArchive(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+	shell.Default = &archiveExecutor{}
+
+	tempDir := t.TempDir()
+	rootfs := filepath.Join(tempDir, "rootfs")
+	createTestRootfs(t, rootfs)
+
+	archivePath := filepath.Join(tempDir, "rootfs.tar.gz")
+	if err := createRootfsArchive(rootfs, archivePath, 0); err != nil {
+		t.Fatalf("createRootfsArchive failed: %v", err)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(archivePath, ".gz")); !os.IsNotExist(err) {
+		t.Errorf("Expected intermediate tar file to be replaced by the compressed archive")
+	}
+
+	topLevel := map[string]bool{}
+	for _, header := range readArchiveEntries(t, archivePath) {
+		name := strings.TrimPrefix(header.Name, "./")
+		if name == "" {
+			continue
+		}
+		if strings.Contains(name, "cache-repo") {
+			t.Errorf("Expected the mounted cache repository to be excluded, got %s", header.Name)
+		}
+		topLevel[strings.SplitN(name, "/", 2)[0]] = true
+		if header.ModTime.Unix() != 0 {
+			t.Errorf("Expected %s mtime to be clamped to 0, got %v", header.Name, header.ModTime)
+		}
+	}
+	for _, entry := range []string{"etc", "usr", "var"} {
+		if !topLevel[entry] {
+			t.Errorf("Expected top-level entry %s in archive, got %v", entry, topLevel)
+		}
+	}
+
+	// A second archive of the same content must be byte-identical
+	first, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(rootfs, "etc", "hostname"), later, later); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+	secondPath := filepath.Join(tempDir, "rootfs-again.tar.gz")
+	if err := createRootfsArchive(rootfs, secondPath, 0); err != nil {
+		t.Fatalf("createRootfsArchive failed: %v", err)
+	}
+	second, err := os.ReadFile(secondPath)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("Expected reproducible archives, got different content")
+	}
+}
+
+func TestTarMaker_BuildTarImage(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name          string
+		installErr    error
+		expectError   bool
+		expectedError string
+	}{
+		{
+			name: "successful_build",
+		},
+		{
+			name:          "install_rootfs_failure",
+			installErr:    fmt.Errorf("package install failed"),
+			expectError:   true,
+			expectedError: "failed to install tar rootfs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			rootfs := filepath.Join(tempDir, "rootfs")
+			createTestRootfs(t, rootfs)
+			executor := &archiveExecutor{}
+			shell.Default = executor
+
+			imageOs := &mockImageOs{installRoot: rootfs, versionInfo: "1.0.0", err: tt.installErr}
+			tarMaker := &TarMaker{
+				template: &config.ImageTemplate{
+					Image:  config.ImageInfo{Name: "test-image"},
+					Target: config.TargetInfo{OS: "ubuntu", Dist: "ubuntu24", Arch: "x86_64", ImageType: "tar"},
+				},
+				ImageBuildDir: filepath.Join(tempDir, "imagebuild"),
+				ImageOs:       imageOs,
+			}
+			if err := os.MkdirAll(tarMaker.ImageBuildDir, 0700); err != nil {
+				t.Fatalf("Failed to create image build dir: %v", err)
+			}
+
+			err := tarMaker.BuildTarImage()
+
+			if imageOs.installImageOsCalls != 0 {
+				t.Errorf("Expected disk image install to be skipped, got %d calls", imageOs.installImageOsCalls)
+			}
+			for _, cmd := range executor.commands {
+				for _, diskStep := range []string{"losetup", "sfdisk", "mkfs", "grub", "bootctl", "ukify", "sbsign"} {
+					if strings.Contains(cmd, diskStep) {
+						t.Errorf("Unexpected disk/boot command for tar image: %s", cmd)
+					}
+				}
+			}
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error, but got none")
+				}
+				if !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing %q, got: %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildTarImage failed: %v", err)
+			}
+			if imageOs.installInitrdCalls != 1 {
+				t.Errorf("Expected rootfs install once, got %d", imageOs.installInitrdCalls)
+			}
+
+			expectedPath := filepath.Join(tarMaker.ImageBuildDir, "test-image-1.0.0.tar.gz")
+			if tarMaker.GetTarImagePath() != expectedPath {
+				t.Errorf("Expected tarball path %s, got %s", expectedPath, tarMaker.GetTarImagePath())
+			}
+			if len(readArchiveEntries(t, expectedPath)) == 0 {
+				t.Errorf("Expected tarball to contain the rootfs")
+			}
+		})
+	}
+}
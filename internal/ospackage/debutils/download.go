@@ -31,6 +31,7 @@ type Repository struct {
 	Component     string
 	Priority      int
 	AllowPackages []string
+	Snapshot      ospackage.SnapshotPin
 }
 
 // repoConfig hold repo related info
@@ -45,10 +46,11 @@ type RepoConfig struct {
 	PbGPGKey      string
 	ReleaseFile   string
 	ReleaseSign   string
-	BuildPath     string   // path to store builds, relative to the root of the repo
-	Arch          string   // architecture, e.g., amd64, all
-	Priority      int      // repository priority (higher numbers = higher priority)
-	AllowPackages []string // optional package filter for this repository
+	BuildPath     string                // path to store builds, relative to the root of the repo
+	Arch          string                // architecture, e.g., amd64, all
+	Priority      int                   // repository priority (higher numbers = higher priority)
+	AllowPackages []string              // optional package filter for this repository
+	Snapshot      ospackage.SnapshotPin // expected Release file snapshot, unchecked when empty
 }
 
 type pkgChecksum struct {
@@ -64,6 +66,10 @@ var (
 	Architecture string
 	UserRepo     []config.PackageRepository
 	ReportPath   = "builds"
+
+	// Explain makes ResolveDependencies report the dependency path behind
+	// resolve failures and log why each resolved package was included.
+	Explain bool
 )
 
 // Packages returns the list of base packages
@@ -71,7 +77,9 @@ func Packages() ([]ospackage.PackageInfo, error) {
 	log := logger.Logger()
 	log.Infof("fetching packages from %s", RepoCfg.PkgList)
 
-	packages, err := ParseRepositoryMetadata(RepoCfg.PkgPrefix, GzHref, RepoCfg.ReleaseFile, RepoCfg.ReleaseSign, RepoCfg.PbGPGKey, RepoCfg.BuildPath, RepoCfg.Arch, RepoCfg.AllowPackages)
+	repoCfg := RepoCfg
+	repoCfg.PkgList = GzHref
+	packages, err := NewRepoClient(repoCfg).ListPackages()
 	if err != nil {
 		return nil, fmt.Errorf("parsing default repo failed: %w", err)
 	}
@@ -95,7 +103,7 @@ func PackagesFromMultipleRepos() ([]ospackage.PackageInfo, error) {
 	for i, repoCfg := range RepoCfgs {
 		log.Infof("fetching packages from repository %d: %s (%s)", i+1, repoCfg.Name, repoCfg.PkgList)
 
-		packages, err := ParseRepositoryMetadata(repoCfg.PkgPrefix, repoCfg.PkgList, repoCfg.ReleaseFile, repoCfg.ReleaseSign, repoCfg.PbGPGKey, repoCfg.BuildPath, repoCfg.Arch, repoCfg.AllowPackages)
+		packages, err := NewRepoClient(repoCfg).ListPackages()
 		if err != nil {
 			log.Warnf("Failed to parse repository %s: %v", repoCfg.Name, err)
 			failedRepos = append(failedRepos, repoCfg.Name)
@@ -122,7 +130,7 @@ func BuildRepoConfigs(userRepoList []Repository, arch string) ([]RepoConfig, err
 		connectSuccess := false
 		id := repoItem.ID
 		codename := repoItem.Codename
-		baseURL := repoItem.URL
+		baseURL := ospackage.LocalRepoURL(repoItem.URL)
 		pkey := repoItem.PKey
 		archs := arch + ",all"
 		releaseNm := "Release"
@@ -155,6 +163,7 @@ func BuildRepoConfigs(userRepoList []Repository, arch string) ([]RepoConfig, err
 					Arch:          localArch,
 					Priority:      repoItem.Priority,
 					AllowPackages: repoItem.AllowPackages,
+					Snapshot:      repoItem.Snapshot,
 				}
 				userRepo = append(userRepo, repo)
 				connectSuccess = true
@@ -231,10 +240,11 @@ func UserPackages() ([]ospackage.PackageInfo, error) {
 			Codename:      repo.Codename,
 			URL:           repo.URL,
 			Path:          repo.Path,
-			PKey:          repo.PKey,
+			PKey:          repo.ReleaseKey(),
 			Component:     repo.Component,
 			Priority:      repo.Priority,
 			AllowPackages: repo.AllowPackages,
+			Snapshot:      repo.SnapshotPin(),
 		})
 	}
 
@@ -251,7 +261,7 @@ func UserPackages() ([]ospackage.PackageInfo, error) {
 	var allUserPackages []ospackage.PackageInfo
 	for _, rpItx := range userRepo {
 
-		userPkgs, err := ParseRepositoryMetadata(rpItx.PkgPrefix, rpItx.PkgList, rpItx.ReleaseFile, rpItx.ReleaseSign, rpItx.PbGPGKey, rpItx.BuildPath, rpItx.Arch, rpItx.AllowPackages)
+		userPkgs, err := NewRepoClient(rpItx).ListPackages()
 		if err != nil {
 			return nil, fmt.Errorf("parsing user repo failed: %w", err)
 		}
@@ -272,7 +282,7 @@ func checkFileExists(url string) (bool, error) {
 	client := network.NewSecureHTTPClient()
 
 	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", config.RewriteRepoURL(url), nil)
 	if err != nil {
 		return false, fmt.Errorf("creating request for %s: %w", url, err)
 	}
@@ -371,11 +381,17 @@ func Validate(destDir string, downloadPkgList []string) error {
 
 // Resolve resolves dependencies
 func Resolve(req []ospackage.PackageInfo, all []ospackage.PackageInfo) ([]ospackage.PackageInfo, error) {
+	return resolve(req, all, nil)
+}
+
+// resolve implements Resolve, calling onResolved, if not nil, with each
+// package as soon as it joins the resolution.
+func resolve(req []ospackage.PackageInfo, all []ospackage.PackageInfo, onResolved func(ospackage.PackageInfo)) ([]ospackage.PackageInfo, error) {
 	log := logger.Logger()
 
 	log.Infof("resolving dependencies for %d DEBIANs", len(req))
 	// Resolve all the required dependencies for the initial seed of Debian packages
-	needed, err := ResolveDependencies(req, all)
+	needed, _, err := resolveDependencyGraph(req, all, onResolved)
 	if err != nil {
 		log.Debugf("resolving dependencies failed: %v", err)
 		return nil, fmt.Errorf("resolving dependencies failed: %w", err)
@@ -406,6 +422,47 @@ func Resolve(req []ospackage.PackageInfo, all []ospackage.PackageInfo) ([]ospack
 	return needed, nil
 }
 
+// resolveAndStream resolves the dependencies of req like Resolve. When
+// config.StreamDownloads is set, each package is downloaded to destDir as soon
+// as it is resolved, while the resolution continues.
+func resolveAndStream(req []ospackage.PackageInfo, all []ospackage.PackageInfo, destDir string) ([]ospackage.PackageInfo, error) {
+	if !config.StreamDownloads() {
+		needed, err := Resolve(req, all)
+		if err != nil {
+			return nil, fmt.Errorf("resolving packages: %w", err)
+		}
+		return needed, nil
+	}
+
+	logger.Logger().Infof("downloading packages to %s while resolving dependencies", destDir)
+	stream := pkgfetcher.NewStream(destDir, config.Workers())
+	needed, err := resolve(req, all, func(pkg ospackage.PackageInfo) {
+		stream.Add(pkg.URL)
+	})
+	streamErr := stream.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("resolving packages: %w", err)
+	}
+	if streamErr != nil {
+		return nil, fmt.Errorf("fetch failed: %w", streamErr)
+	}
+	return needed, nil
+}
+
+// checkKernelPackages rejects kernel packages of pkgList missing from the
+// repository listing all up front, as the image would otherwise boot a
+// different kernel than the one requested.
+func checkKernelPackages(pkgList []string, pkgSources map[string]config.PackageSource, all []ospackage.PackageInfo) error {
+	kernelPkgs := config.PackagesFromSource(pkgList, pkgSources, config.PackageSourceKernel)
+	if len(kernelPkgs) == 0 {
+		return nil
+	}
+	if _, err := MatchRequested(kernelPkgs, all); err != nil {
+		return fmt.Errorf("kernel package not available in the configured repositories: %w", err)
+	}
+	return nil
+}
+
 // MatchRequested matches requested packages
 func MatchRequested(requests []string, all []ospackage.PackageInfo) ([]ospackage.PackageInfo, error) {
 	log := logger.Logger()
@@ -415,7 +472,7 @@ func MatchRequested(requests []string, all []ospackage.PackageInfo) ([]ospackage
 	gotMissingPkg := false
 
 	for _, want := range requests {
-		if pkg, found := ResolveTopPackageConflicts(want, all); found {
+		if pkg, found := resolveRequestedSpec(want, all); found {
 			out = append(out, pkg)
 		} else {
 			requestedPkgs = append(requestedPkgs, want)
@@ -435,6 +492,17 @@ func MatchRequested(requests []string, all []ospackage.PackageInfo) ([]ospackage
 	return out, nil
 }
 
+// resolveRequestedSpec resolves the requested package spec want, trying its
+// alternatives in order, and "name=version" pins as "name_version" requests.
+func resolveRequestedSpec(want string, all []ospackage.PackageInfo) (ospackage.PackageInfo, bool) {
+	for _, key := range ospackage.ParsePackageSpec(want).MatchKeys("_") {
+		if pkg, found := ResolveTopPackageConflicts(key, all); found {
+			return pkg, true
+		}
+	}
+	return ospackage.PackageInfo{}, false
+}
+
 // WriteArrayToFile writes the contents of arr to a JSON file.
 // The file will contain a report_type and a "missing" array of strings.
 // The filename will be prefixed with the current date and time in "YYYYMMDD_HHMMSS_" format.
@@ -473,11 +541,12 @@ func WriteArrayToFile(arr []string, title string) (string, error) {
 
 // DownloadPackages downloads packages and returns the list of downloaded package names.
 func DownloadPackages(pkgList []string, destDir, dotFile string, pkgSources map[string]config.PackageSource, systemRootsOnly bool) ([]string, error) {
-	downloadedPkgs, _, err := DownloadPackagesComplete(pkgList, destDir, dotFile, pkgSources, systemRootsOnly)
+	downloadedPkgs, _, err := DownloadPackagesComplete(pkgList, destDir, dotFile, pkgSources, systemRootsOnly, nil)
 	return downloadedPkgs, err
 }
 
-func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSources map[string]config.PackageSource, systemRootsOnly bool) ([]string, []ospackage.PackageInfo, error) {
+func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSources map[string]config.PackageSource, systemRootsOnly bool,
+	spaceCheck ospackage.SpaceCheck) ([]string, []ospackage.PackageInfo, error) {
 	var downloadPkgList []string
 
 	log := logger.Logger()
@@ -519,6 +588,10 @@ func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSour
 	}
 	all = append(all, localRepoPkgs...)
 
+	if err := checkKernelPackages(pkgList, pkgSources, all); err != nil {
+		return downloadPkgList, nil, err
+	}
+
 	// Match the packages in the template against all the packages
 	req, err := MatchRequested(pkgList, all)
 	if err != nil {
@@ -526,10 +599,20 @@ func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSour
 	}
 	log.Infof("matched a total of %d packages", len(req))
 
-	// Resolve the dependencies of the requested packages
-	needed, err := Resolve(req, all)
+	// Ensure dest directory exists
+	absDestDir, err := filepath.Abs(destDir)
 	if err != nil {
-		return downloadPkgList, nil, fmt.Errorf("resolving packages: %w", err)
+		return downloadPkgList, nil, fmt.Errorf("resolving cache directory: %w", err)
+	}
+	if err := os.MkdirAll(absDestDir, 0755); err != nil {
+		return downloadPkgList, nil, fmt.Errorf("creating cache directory %s: %w", absDestDir, err)
+	}
+
+	// Resolve the dependencies of the requested packages, downloading them
+	// meanwhile when streaming
+	needed, err := resolveAndStream(req, all, absDestDir)
+	if err != nil {
+		return downloadPkgList, nil, err
 	}
 	log.Infof("resolved %d packages", len(needed))
 
@@ -557,16 +640,14 @@ func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSour
 		downloadPkgList = append(downloadPkgList, filepath.Base(pkg.URL))
 	}
 
-	// Ensure dest directory exists
-	absDestDir, err := filepath.Abs(destDir)
-	if err != nil {
-		return downloadPkgList, nil, fmt.Errorf("resolving cache directory: %w", err)
-	}
-	if err := os.MkdirAll(absDestDir, 0755); err != nil {
-		return downloadPkgList, nil, fmt.Errorf("creating cache directory %s: %w", absDestDir, err)
+	if spaceCheck != nil {
+		if err := spaceCheck(sorted_pkgs, absDestDir); err != nil {
+			return downloadPkgList, nil, fmt.Errorf("disk space check failed: %w", err)
+		}
 	}
 
-	// Download packages using configured workers and cache directory
+	// Download packages using configured workers and cache directory; the
+	// packages streamed during resolution are already there and skipped
 	log.Infof("downloading %d packages to %s using %d workers", len(urls), absDestDir, config.Workers())
 	if err := pkgfetcher.FetchPackages(urls, absDestDir, config.Workers()); err != nil {
 		return downloadPkgList, nil, fmt.Errorf("fetch failed: %w", err)
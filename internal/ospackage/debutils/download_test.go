@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
@@ -672,6 +673,64 @@ func TestMatchRequested(t *testing.T) {
 	}
 }
 
+func TestCheckKernelPackages(t *testing.T) {
+	all := []ospackage.PackageInfo{
+		{Name: "linux-image-amd64", Version: "6.12.74-2", URL: "http://example.com/linux-image-amd64.deb"},
+		{Name: "linux-image-rt-amd64", Version: "6.12.74-2", URL: "http://example.com/linux-image-rt-amd64.deb"},
+	}
+	pkgSources := map[string]config.PackageSource{
+		"linux-image-rt-amd64": config.PackageSourceKernel,
+		"missing-tool":         config.PackageSourceSystem,
+	}
+
+	if err := checkKernelPackages([]string{"linux-image-rt-amd64", "missing-tool"}, pkgSources, all); err != nil {
+		t.Errorf("expected available kernel package to pass, got: %v", err)
+	}
+
+	pkgSources["linux-image-missing-amd64"] = config.PackageSourceKernel
+	err := checkKernelPackages([]string{"linux-image-missing-amd64"}, pkgSources, all)
+	if err == nil || !strings.Contains(err.Error(), "kernel package not available") {
+		t.Errorf("expected missing kernel package to be rejected, got: %v", err)
+	}
+}
+
+func TestResolveAndStream(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, filepath.Base(r.URL.Path))
+		mu.Unlock()
+		_, _ = w.Write([]byte("deb content"))
+	}))
+	defer server.Close()
+
+	origConfig := config.Global()
+	defer config.SetGlobal(origConfig)
+	streamingConfig := config.Global()
+	streamingConfig.StreamDownloads = true
+	config.SetGlobal(streamingConfig)
+
+	all := []ospackage.PackageInfo{
+		{Name: "app", Version: "1.0", URL: server.URL + "/pool/main/a/app/app_1.0_amd64.deb", Requires: []string{"libfoo"}},
+		{Name: "libfoo", Version: "1.6", URL: server.URL + "/pool/main/l/libfoo/libfoo_1.6_amd64.deb", Requires: []string{"libbase"}},
+		{Name: "libbase", Version: "3.0", URL: server.URL + "/pool/main/l/libbase/libbase_3.0_amd64.deb"},
+	}
+	destDir := t.TempDir()
+	needed, err := resolveAndStream([]ospackage.PackageInfo{{Name: "app", Version: "1.0"}}, all, destDir)
+	if err != nil {
+		t.Fatalf("resolveAndStream failed: %v", err)
+	}
+	if len(needed) != 3 || len(requested) != 3 {
+		t.Fatalf("expected 3 packages resolved and downloaded, got %d and %v", len(needed), requested)
+	}
+	for _, pkg := range needed {
+		if _, err := os.Stat(filepath.Join(destDir, filepath.Base(pkg.URL))); err != nil {
+			t.Errorf("expected %s to be downloaded while resolving: %v", pkg.Name, err)
+		}
+	}
+}
+
 // TestWriteArrayToFile tests the WriteArrayToFile function
 func TestWriteArrayToFile(t *testing.T) {
 	// Save original ReportPath
@@ -899,7 +958,7 @@ func TestDownloadPackagesComplete(t *testing.T) {
 				t.Fatalf("Failed to setup test: %v", err)
 			}
 
-			downloadList, packageInfos, err := DownloadPackagesComplete(tt.pkgList, tempDir, "", nil, false)
+			downloadList, packageInfos, err := DownloadPackagesComplete(tt.pkgList, tempDir, "", nil, false, nil)
 
 			if tt.expectError {
 				if err == nil {
@@ -0,0 +1,66 @@
+package debutils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// resolveExplanation records why ResolveDependencies included each package,
+// so that the dependency path to a package can be reported when Explain is set.
+type resolveExplanation struct {
+	requiredBy map[string]string // package name -> package that first required it, "" for requested packages
+}
+
+func newResolveExplanation() *resolveExplanation {
+	return &resolveExplanation{requiredBy: make(map[string]string)}
+}
+
+// addRequested records name as one of the requested packages.
+func (e *resolveExplanation) addRequested(name string) {
+	e.requiredBy[name] = ""
+}
+
+// addRequired records that parent pulled in name, unless name was already
+// included through another path.
+func (e *resolveExplanation) addRequired(parent, name string) {
+	if _, ok := e.requiredBy[name]; !ok {
+		e.requiredBy[name] = parent
+	}
+}
+
+// path returns the chain of packages from a requested package down to name.
+func (e *resolveExplanation) path(name string) []string {
+	var chain []string
+	seen := make(map[string]bool)
+	for cur := name; cur != "" && !seen[cur]; cur = e.requiredBy[cur] {
+		seen[cur] = true
+		chain = append([]string{cur}, chain...)
+	}
+	return chain
+}
+
+// chain formats the path to name as "requested -> requirement -> ... -> name".
+func (e *resolveExplanation) chain(name string) string {
+	return strings.Join(e.path(name), " -> ")
+}
+
+// missingChain formats the path through parent to the missing dependency dep.
+func (e *resolveExplanation) missingChain(parent, dep string) string {
+	return fmt.Sprintf("%s -> %s (missing)", e.chain(parent), dep)
+}
+
+// included returns one "name: path" line per package in names, sorted by
+// package name.
+func (e *resolveExplanation) included(names []string) []string {
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		if e.requiredBy[name] == "" {
+			lines = append(lines, fmt.Sprintf("%s: requested", name))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", name, e.chain(name)))
+	}
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,79 @@
+package debutils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+)
+
+// RepoClient is the deb implementation of ospackage.RepositoryClient. The
+// metadata is the Packages index of one component and architecture, checked
+// against the repository Release file.
+type RepoClient struct {
+	cfg      RepoConfig
+	packages []ospackage.PackageInfo
+	fetched  bool
+}
+
+var _ ospackage.RepositoryClient = (*RepoClient)(nil)
+
+// NewRepoClient returns a client for the repository described by cfg.
+func NewRepoClient(cfg RepoConfig) *RepoClient {
+	return &RepoClient{cfg: cfg}
+}
+
+// FetchMetadata downloads the Release file and Packages index, verifies
+// them, checks the Release file against the snapshot pin of the repository,
+// and parses the index.
+func (c *RepoClient) FetchMetadata() error {
+	packages, err := ParseRepositoryMetadata(c.cfg.PkgPrefix, c.cfg.PkgList, c.cfg.ReleaseFile, c.cfg.ReleaseSign,
+		c.cfg.PbGPGKey, c.cfg.BuildPath, c.cfg.Arch, c.cfg.AllowPackages)
+	if err != nil {
+		return err
+	}
+	if c.cfg.Snapshot.IsSet() {
+		// ParseRepositoryMetadata leaves the verified Release file in BuildPath
+		release, err := os.ReadFile(filepath.Join(c.cfg.BuildPath, filepath.Base(c.cfg.ReleaseFile)))
+		if err != nil {
+			return fmt.Errorf("reading Release file of %s: %w", c.cfg.ReleaseFile, err)
+		}
+		if err := c.cfg.Snapshot.Verify(c.cfg.ReleaseFile, releaseDate(release), release); err != nil {
+			return err
+		}
+	}
+	c.packages = packages
+	c.fetched = true
+	return nil
+}
+
+// ListPackages returns the packages in the Packages index.
+func (c *RepoClient) ListPackages() ([]ospackage.PackageInfo, error) {
+	if !c.fetched {
+		if err := c.FetchMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return c.packages, nil
+}
+
+// ResolveURL returns the download URL of relPath within the repository.
+func (c *RepoClient) ResolveURL(relPath string) string {
+	fullURL, _ := getFullUrl(relPath, c.cfg.PkgPrefix)
+	return fullURL
+}
+
+// releaseDate returns the Date field of a Release file, or "" if it has none.
+func releaseDate(release []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(release))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "Date:"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
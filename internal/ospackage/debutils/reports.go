@@ -18,6 +18,7 @@ type MinimalPackageInfo struct {
 	Version string `json:"version"`
 	Origin  string `json:"origin"`
 	URL     string `json:"url"`
+	Repo    string `json:"repository,omitempty"`
 	Parent  string `json:"parent,omitempty"`
 	Child   string `json:"child,omitempty"`
 	Found   bool   `json:"found"`
@@ -58,6 +59,7 @@ func BuildDependencyChains(parentChildPairs [][]ospackage.PackageInfo) string {
 			Version: pkg.Version,
 			Origin:  pkg.Origin,
 			URL:     pkg.URL,
+			Repo:    pkg.Repository,
 		}
 	}
 
@@ -9,6 +9,7 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -141,14 +142,14 @@ func ParseRepositoryMetadata(baseURL string, pkggz string, releaseFile string, r
 	if isTrustedRepo {
 		// For trusted repos, skip Release.gpg and GPG key download
 		localFiles = []string{localPkggzFile, localReleaseFile}
-		urllist = []string{pkggz, releaseFile}
+		urllist = []string{releaseFile}
 	} else if pbkeyIsURL {
 		// Remove any existing local files to ensure fresh downloads
 		localFiles = []string{localPkggzFile, localReleaseFile, localReleaseSign, localPBGPGKey}
-		urllist = []string{pkggz, releaseFile, releaseSign, pbGPGKey}
+		urllist = []string{releaseFile, releaseSign, pbGPGKey}
 	} else {
 		localFiles = []string{localPkggzFile, localReleaseFile, localReleaseSign}
-		urllist = []string{pkggz, releaseFile, releaseSign}
+		urllist = []string{releaseFile, releaseSign}
 	}
 
 	for _, f := range localFiles {
@@ -173,15 +174,20 @@ func ParseRepositoryMetadata(baseURL string, pkggz string, releaseFile string, r
 		return nil, fmt.Errorf("release file verification failed")
 	}
 
-	// verify the sham256 checksum of the Packages.gz file
-	log.Infof("verifying checksum of package metadata file %s %s", baseURL, localPkggzFile)
 	// get component from buildPath
 	component := "main"
 	// Detect last underscore and extract the word after it as component
 	if idx := strings.LastIndex(buildPath, "_"); idx != -1 && len(buildPath) > idx+1 {
 		component = buildPath[idx+1:]
 	}
-	//
+
+	// The package index is located through the verified Release file
+	if err := fetchPackagesIndex(pkggz, localPkggzFile, localReleaseFile, arch, component); err != nil {
+		return nil, err
+	}
+
+	// verify the sham256 checksum of the Packages.gz file
+	log.Infof("verifying checksum of package metadata file %s %s", baseURL, localPkggzFile)
 	pkggzVryResult, err := VerifyPackagegz(localReleaseFile, localPkggzFile, arch, component)
 	if err != nil {
 		return nil, fmt.Errorf("failed to verify pkg file: %w", err)
@@ -206,14 +212,73 @@ func ParseRepositoryMetadata(baseURL string, pkggz string, releaseFile string, r
 	if len(files) == 0 {
 		return nil, fmt.Errorf("no decompressed files found")
 	}
-	f, err := os.Open(files[0])
+	return parsePackagesFile(files[0], baseURL, packageFilter)
+}
+
+// fetchPackagesIndex downloads the package index pkggz to localPkggzFile. When
+// the Release file declares Acquire-By-Hash, the index is fetched from its
+// by-hash/SHA256/<checksum> path, which stays consistent with the Release file
+// while the mirror is being updated; the regular path is the fallback when
+// the Release file does not list the index or the hashed path fails.
+func fetchPackagesIndex(pkggz, localPkggzFile, localReleaseFile, arch, component string) error {
+	log := logger.Logger()
+	pkgMetaDir := filepath.Dir(localPkggzFile)
+
+	if hashedURL := packagesByHashURL(pkggz, localReleaseFile, arch, component); hashedURL != "" {
+		log.Infof("fetching package index %s by hash from %s", pkggz, hashedURL)
+		err := pkgfetcher.FetchPackages([]string{hashedURL}, pkgMetaDir, 1)
+		if err == nil {
+			hashedFile := filepath.Join(pkgMetaDir, path.Base(hashedURL))
+			if err := os.Rename(hashedFile, localPkggzFile); err != nil {
+				return fmt.Errorf("failed to move package index %s: %w", hashedFile, err)
+			}
+			return nil
+		}
+		log.Warnf("failed to fetch package index by hash from %s, falling back to %s: %v", hashedURL, pkggz, err)
+	}
+
+	if err := pkgfetcher.FetchPackages([]string{pkggz}, pkgMetaDir, 1); err != nil {
+		return fmt.Errorf("failed to fetch package index %s: %w", pkggz, err)
+	}
+	return nil
+}
+
+// packagesByHashURL returns the by-hash URL of the package index pkggz from
+// the Release file, or "" if the Release file does not declare Acquire-By-Hash
+// or has no SHA256 checksum for the index.
+func packagesByHashURL(pkggz, releaseFile, arch, component string) string {
+	byHash, err := releaseAcquireByHash(releaseFile)
+	if err != nil || !byHash {
+		return ""
+	}
+	indexPath := fmt.Sprintf("%s/binary-%s/%s", component, arch, path.Base(pkggz))
+	checksum, _, err := findReleaseEntry(releaseFile, "SHA256", indexPath)
+	if err != nil || checksum == "" {
+		return ""
+	}
+	idx := strings.LastIndex(pkggz, "/")
+	if idx == -1 {
+		return ""
+	}
+	return fmt.Sprintf("%s/by-hash/SHA256/%s", pkggz[:idx], strings.ToLower(checksum))
+}
+
+// parsePackagesFile parses a decompressed Packages file. A file without any
+// package stanza is rejected, since a repository never legitimately publishes
+// an empty index and accepting it would silently resolve to zero packages.
+func parsePackagesFile(packagesFile string, baseURL string, packageFilter []string) ([]ospackage.PackageInfo, error) {
+	log := logger.Logger()
+
+	f, err := os.Open(packagesFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open decompressed file: %w", err)
 	}
 	defer f.Close()
 
+	// stanzas counts every package entry, including those dropped by the filter
+	stanzas := 0
 	var pkgs []ospackage.PackageInfo
-	pkg := ospackage.PackageInfo{}
+	pkg := ospackage.PackageInfo{Repository: baseURL}
 	reader := bufio.NewReader(f)
 	for {
 		line, err := reader.ReadString('\n')
@@ -225,10 +290,11 @@ func ParseRepositoryMetadata(baseURL string, pkggz string, releaseFile string, r
 		if line == "" {
 			// End of one package entry
 			if pkg.Name != "" {
+				stanzas++
 				if matchesPackageFilter(pkg.Name, packageFilter) {
 					pkgs = append(pkgs, pkg)
 				}
-				pkg = ospackage.PackageInfo{}
+				pkg = ospackage.PackageInfo{Repository: baseURL}
 			}
 			if err == io.EOF {
 				break
@@ -253,12 +319,14 @@ func ParseRepositoryMetadata(baseURL string, pkggz string, releaseFile string, r
 		case "Version":
 			pkg.Version = val
 		case "Pre-Depends":
-			// Split dependencies by comma and clean each dependency
+			// Pre-dependencies are dependencies that must also be installed
+			// before the package, which the install order keeps
 			deps := strings.Split(val, ",")
 			for _, dep := range deps {
 				cleanedDep := CleanDependencyName(dep)
 				if cleanedDep != "" {
 					pkg.Requires = append(pkg.Requires, cleanedDep)
+					pkg.PreDepends = append(pkg.PreDepends, cleanedDep)
 				}
 			}
 		case "Depends":
@@ -285,6 +353,10 @@ func ParseRepositoryMetadata(baseURL string, pkggz string, releaseFile string, r
 			pkg.Provides = deps
 		case "Filename":
 			pkg.URL, _ = getFullUrl(val, baseURL)
+		case "Size":
+			if size, err := strconv.ParseInt(val, 10, 64); err == nil {
+				pkg.Size = size
+			}
 		case "SHA256":
 			pkg.Checksums = append(pkg.Checksums, ospackage.Checksum{
 				Algorithm: "SHA256",
@@ -311,6 +383,8 @@ func ParseRepositoryMetadata(baseURL string, pkggz string, releaseFile string, r
 			}
 		case "Maintainer":
 			pkg.Origin = val
+		case "License":
+			pkg.License = val
 		}
 		if err == io.EOF {
 			break
@@ -320,11 +394,17 @@ func ParseRepositoryMetadata(baseURL string, pkggz string, releaseFile string, r
 
 	// Add the last package if file doesn't end with a blank line
 	if pkg.Name != "" {
+		stanzas++
 		if matchesPackageFilter(pkg.Name, packageFilter) {
 			pkgs = append(pkgs, pkg)
 		}
 	}
 
+	if stanzas == 0 {
+		log.Errorf("Package metadata %s contains no package entries", packagesFile)
+		return nil, fmt.Errorf("empty or truncated repository metadata %s: no package entries found", packagesFile)
+	}
+
 	return pkgs, nil
 }
 
@@ -392,8 +472,8 @@ func filterCandidatesByPriority(candidates []ospackage.PackageInfo) []ospackage.
 		}
 	}
 
-	// Sort by APT priority rules
-	sort.Slice(filtered, func(i, j int) bool {
+	// Sort by APT priority rules, keeping the order of equally ranked candidates
+	sort.SliceStable(filtered, func(i, j int) bool {
 		pkgI := filtered[i]
 		pkgJ := filtered[j]
 
@@ -446,7 +526,7 @@ func filterCandidatesByPriorityWithTarget(candidates []ospackage.PackageInfo, ta
 	}
 
 	// Sort by simple rule: exact name matches first, then provides matches
-	sort.Slice(filtered, func(i, j int) bool {
+	sort.SliceStable(filtered, func(i, j int) bool {
 		pkgI := filtered[i]
 		pkgJ := filtered[j]
 
@@ -491,8 +571,12 @@ func filterCandidatesByPriorityWithTarget(candidates []ospackage.PackageInfo, ta
 			return versionCmp
 		}
 
-		// For provides matches, maintain stable order (don't compare different versioning schemes)
-		return false
+		// Providers of a virtual package: highest version first, then by name
+		// so that the choice does not depend on the repository listing order
+		if versionCmp := compareVersions(pkgI.Version, pkgJ.Version); versionCmp != 0 {
+			return versionCmp > 0
+		}
+		return pkgI.Name < pkgJ.Name
 	})
 
 	return filtered
@@ -554,7 +638,29 @@ func comparePriorityBehavior(pkgA, pkgB ospackage.PackageInfo) bool {
 // ResolveDependencies takes a seed list of PackageInfos (the exact versions
 // matched) and the full list of all PackageInfos from the repo, and
 // returns the minimal closure of PackageInfos needed to satisfy all Requires.
+// The closure is sorted by package Name, so the same inputs resolve to the
+// same order whatever the order of requested and all.
+// When Explain is set, a failure names the dependency path from a requested
+// package to the requirement that could not be satisfied, and a success logs
+// the path through which each package was included.
 func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.PackageInfo) ([]ospackage.PackageInfo, error) {
+	result, _, err := ResolveDependencyGraph(requested, all)
+	return result, err
+}
+
+// ResolveDependencyGraph resolves the dependencies of requested like
+// ResolveDependencies, and also returns the resolution as a dependency graph
+// with an edge from each package to every resolved package satisfying one of
+// its requirements.
+func ResolveDependencyGraph(requested []ospackage.PackageInfo, all []ospackage.PackageInfo) ([]ospackage.PackageInfo, *ospackage.DependencyGraph, error) {
+	return resolveDependencyGraph(requested, all, nil)
+}
+
+// resolveDependencyGraph implements ResolveDependencyGraph. onResolved, if not
+// nil, is called with each package as soon as it joins the resolution, before
+// the dependencies of later packages are resolved. A package later replaced by
+// a higher priority candidate has been reported already.
+func resolveDependencyGraph(requested []ospackage.PackageInfo, all []ospackage.PackageInfo, onResolved func(ospackage.PackageInfo)) ([]ospackage.PackageInfo, *ospackage.DependencyGraph, error) {
 	log := logger.Logger()
 
 	// Build maps for fast lookup
@@ -565,23 +671,33 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 			byNameVer[key] = pi
 		}
 	}
+	index := newPackageIndex(all)
 	neededSet := make(map[string]struct{})
 	resolvedDeps := make(map[string]ospackage.PackageInfo) // Track resolved dependencies for conflict detection
+	explanation := newResolveExplanation()
+	var edges []ospackage.DependencyEdge // package -> resolved dependency, for the graph
 	queue := make([]ospackage.PackageInfo, 0, len(requested))
 	for _, pi := range requested {
 		if pi.Version != "" {
 			key := fmt.Sprintf("%s=%s", pi.Name, pi.Version)
 			if pkg, ok := byNameVer[key]; ok {
+				if pi.URL != "" {
+					// Keep the candidate the repository priorities selected
+					// when several repositories carry the same version
+					pkg = pi
+				}
 				queue = append(queue, pkg)
+				explanation.addRequested(pkg.Name)
 				continue
 			}
 		}
-		return nil, fmt.Errorf("requested package %q not in repo listing", pi.Name)
+		return nil, nil, fmt.Errorf("requested package %q not in repo listing", pi.Name)
 	}
 
 	// depedencies resolution logic
 	result := make([]ospackage.PackageInfo, 0)
 	var parentChildPairs [][]ospackage.PackageInfo // Track parent->child relationships for reporting
+	var missingChains []string                     // Dependency paths to missing packages, for Explain
 	gotMissingPkg := false
 
 	for len(queue) > 0 {
@@ -593,6 +709,9 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 		}
 		neededSet[cur.Name] = struct{}{}
 		result = append(result, cur)
+		if onResolved != nil {
+			onResolved(cur)
+		}
 
 		// Traverse dependencies
 		for _, dep := range cur.Requires {
@@ -685,7 +804,7 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 
 						// Before throwing error, check if there's a higher priority candidate available
 						// But only allow replacement if we don't have an exact version conflict
-						candidates := findAllCandidates(depName, all)
+						candidates := index.candidates(depName)
 
 						if len(candidates) > 0 && !hasExactVersionConstraint {
 							// Find candidates that satisfy the version constraint
@@ -748,6 +867,7 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 										queue = append(queue, newCandidate)
 										resolvedDeps[depName] = newCandidate
 										AddParentChildPair(cur, newCandidate, &parentChildPairs)
+										edges = append(edges, ospackage.DependencyEdge{From: cur.Name, To: newCandidate.Name, Requirement: depName})
 										continue
 									} else {
 										log.Debugf("new candidate does not have higher priority, cannot replace")
@@ -755,24 +875,33 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 								}
 							}
 						}
-						return nil, fmt.Errorf("conflicting package dependencies: %s_%s requires %s_%s, but %s_%s is already installed", cur.Name, cur.Version, requiredDep, requiredVer, resolvedPkg.Name, resolvedPkg.Version)
+						conflictErr := fmt.Errorf("conflicting package dependencies: %s_%s requires %s_%s, but %s_%s is already installed", cur.Name, cur.Version, requiredDep, requiredVer, resolvedPkg.Name, resolvedPkg.Version)
+						if Explain {
+							return nil, nil, fmt.Errorf("%w (required via %s -> %s, already included via %s)", conflictErr,
+								explanation.chain(cur.Name), requiredDep, explanation.chain(resolvedPkg.Name))
+						}
+						return nil, nil, conflictErr
 					}
 				}
+				edges = append(edges, ospackage.DependencyEdge{From: cur.Name, To: resolvedPkg.Name, Requirement: depName})
 				continue
 			}
 
-			candidates := findAllCandidates(depName, all)
+			candidates := index.candidates(depName)
 			if len(candidates) >= 1 {
 				// Pick the candidate using the resolver and add it to the queue
 				chosenCandidate, err := resolveMultiCandidates(cur, candidates)
 				if err != nil {
 					gotMissingPkg = true
 					AddParentMissingChildPair(cur, depName+"(missing)", &parentChildPairs)
+					missingChains = append(missingChains, explanation.missingChain(cur.Name, depName))
 					log.Warnf("failed to resolve multiple candidates for dependency %q of package %q: %v", depName, cur.Name, err)
 					continue
 				}
 				queue = append(queue, chosenCandidate)
 				resolvedDeps[depName] = chosenCandidate // Track resolved dependency
+				explanation.addRequired(cur.Name, chosenCandidate.Name)
+				edges = append(edges, ospackage.DependencyEdge{From: cur.Name, To: chosenCandidate.Name, Requirement: depName})
 				AddParentChildPair(cur, chosenCandidate, &parentChildPairs)
 				continue
 			} else {
@@ -784,13 +913,15 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 						alternatives := strings.Split(constraint.Alternative, "|")
 						for _, altName := range alternatives {
 							altName = strings.TrimSpace(altName)
-							altCandidates := findAllCandidates(altName, all)
+							altCandidates := index.candidates(altName)
 							if len(altCandidates) >= 1 {
 								chosenCandidate, err := resolveMultiCandidates(cur, altCandidates)
 								if err == nil {
 									log.Infof("Successfully resolved alternative %q version %q for missing dependency %q", altName, chosenCandidate.Version, depName)
 									queue = append(queue, chosenCandidate)
 									resolvedDeps[altName] = chosenCandidate // Track resolved alternative dependency
+									explanation.addRequired(cur.Name, chosenCandidate.Name)
+									edges = append(edges, ospackage.DependencyEdge{From: cur.Name, To: chosenCandidate.Name, Requirement: altName})
 									AddParentChildPair(cur, chosenCandidate, &parentChildPairs)
 									alternativeResolved = true
 									break
@@ -809,6 +940,7 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 					log.Warnf("no candidates found for dependency %q of package %q", depName, cur.Name)
 					gotMissingPkg = true
 					AddParentMissingChildPair(cur, depName+"(missing)", &parentChildPairs)
+					missingChains = append(missingChains, explanation.missingChain(cur.Name, depName))
 				}
 				continue
 			}
@@ -818,7 +950,11 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 	// check missing dep and write report
 	if gotMissingPkg {
 		report := BuildDependencyChains(parentChildPairs)
-		return nil, fmt.Errorf("one or more requested dependencies not found. See list in %s", report)
+		if Explain {
+			return nil, nil, fmt.Errorf("one or more requested dependencies not found: %s. See list in %s",
+				strings.Join(missingChains, "; "), report)
+		}
+		return nil, nil, fmt.Errorf("one or more requested dependencies not found. See list in %s", report)
 	}
 
 	// Sort result by package name for determinism
@@ -826,18 +962,32 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 		return result[i].Name < result[j].Name
 	})
 
-	return result, nil
-}
+	if Explain {
+		names := make([]string, 0, len(result))
+		for _, pkg := range result {
+			names = append(names, pkg.Name)
+		}
+		for _, line := range explanation.included(names) {
+			log.Infof("Included %s", line)
+		}
+	}
 
-func getFullUrl(filePath string, baseUrl string) (string, error) {
-	// Check if the file path is already a full URL
-	if strings.HasPrefix(filePath, "http://") || strings.HasPrefix(filePath, "https://") {
-		return filePath, nil
+	requestedNames := make([]string, 0, len(requested))
+	for _, pi := range requested {
+		requestedNames = append(requestedNames, pi.Name)
 	}
+	graph := ospackage.NewDependencyGraph(result, requestedNames)
+	for _, edge := range edges {
+		graph.AddEdge(edge.From, edge.To, edge.Requirement)
+	}
+
+	return result, graph, nil
+}
 
-	// If not, construct the full URL using the base URL
-	fullURL := fmt.Sprintf("%s/%s", strings.TrimSuffix(baseUrl, "/"), filePath)
-	return fullURL, nil
+// getFullUrl resolves the Filename of a Packages entry against the pool prefix
+// of its repository.
+func getFullUrl(filePath string, baseUrl string) (string, error) {
+	return ospackage.ResolveURL(baseUrl, filePath), nil
 }
 
 // CompareDebianVersions compares two Debian version strings.
@@ -1073,27 +1223,7 @@ func CompareDebianVersions(a, b string) (int, error) {
 //	"python3 | python3-dev" -> "python3"
 //	"gcc:amd64" -> "gcc"
 func CleanDependencyName(dep string) string {
-	depName := strings.TrimSpace(dep)
-
-	// Handle alternatives (|) - take the first option
-	if idx := strings.Index(depName, "|"); idx > 0 {
-		depName = strings.TrimSpace(depName[:idx])
-	}
-
-	// Handle architecture qualifiers (:)
-	if idx := strings.Index(depName, ":"); idx > 0 {
-		depName = depName[:idx]
-	}
-
-	// Handle version constraints - remove everything from opening parenthesis
-	if idx := strings.Index(depName, "("); idx > 0 {
-		depName = strings.TrimSpace(depName[:idx])
-	} else if idx := strings.Index(depName, " "); idx > 0 {
-		// Handle cases where there's a space but no parentheses
-		depName = depName[:idx]
-	}
-
-	return strings.TrimSpace(depName)
+	return ospackage.ParsePackageSpec(dep).Name
 }
 
 // compareVersions compares two Debian package versions
@@ -1236,31 +1366,40 @@ func ResolveTopPackageConflicts(want string, all []ospackage.PackageInfo) (ospac
 	return candidates[0], true
 }
 
-// Helper function to find all candidates for a dependency
-func findAllCandidates(depName string, all []ospackage.PackageInfo) []ospackage.PackageInfo {
-	var candidates []ospackage.PackageInfo
+// packageIndex maps package names and the virtual package names listed in
+// their Provides field to the packages of a repository listing, so that a
+// dependency is looked up without scanning every package.
+type packageIndex struct {
+	byName     map[string][]ospackage.PackageInfo
+	byProvides map[string][]ospackage.PackageInfo
+}
 
-	// First pass: look for exact name matches
+// newPackageIndex indexes all packages of a repository listing.
+func newPackageIndex(all []ospackage.PackageInfo) *packageIndex {
+	idx := &packageIndex{
+		byName:     make(map[string][]ospackage.PackageInfo, len(all)),
+		byProvides: make(map[string][]ospackage.PackageInfo),
+	}
 	for _, pi := range all {
-		if pi.Name == depName {
-			candidates = append(candidates, pi)
+		idx.byName[pi.Name] = append(idx.byName[pi.Name], pi)
+		for _, provided := range pi.Provides {
+			idx.byProvides[provided] = append(idx.byProvides[provided], pi)
 		}
 	}
+	return idx
+}
 
-	// If no direct matches found, search in Provides field
+// candidates returns the packages that can satisfy depName: the real packages
+// named depName if there are any, otherwise the packages providing it. They
+// are sorted by APT priority with the preferred candidate first.
+func (idx *packageIndex) candidates(depName string) []ospackage.PackageInfo {
+	candidates := idx.byName[depName]
 	if len(candidates) == 0 {
-		for _, pi := range all {
-			for _, provided := range pi.Provides {
-				if provided == depName {
-					candidates = append(candidates, pi)
-				}
-			}
-		}
+		candidates = idx.byProvides[depName]
 	}
 
 	// Apply APT priority filtering and sorting with exact name preference
-	filtered := filterCandidatesByPriorityWithTarget(candidates, depName)
-	return filtered
+	return filterCandidatesByPriorityWithTarget(candidates, depName)
 }
 
 // Helper function to resolve multiple candidates by picking the last one
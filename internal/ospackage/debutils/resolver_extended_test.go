@@ -243,9 +243,10 @@ func TestVersionConstraints(t *testing.T) {
 	}
 }
 
-// TestComplexDependencyResolution tests complex dependency scenarios
-func TestComplexDependencyResolution(t *testing.T) {
-	all := []ospackage.PackageInfo{
+// complexDependencyPackages returns a repository listing in which app
+// requires libfoo (>= 1.5) and libbar (= 2.0), and libfoo requires libbase.
+func complexDependencyPackages() []ospackage.PackageInfo {
+	return []ospackage.PackageInfo{
 		{
 			Name:        "app",
 			Version:     "1.0",
@@ -286,7 +287,11 @@ func TestComplexDependencyResolution(t *testing.T) {
 			URL:     "http://archive.ubuntu.com/ubuntu/pool/main/l/libbase/libbase_3.0_amd64.deb",
 		},
 	}
+}
 
+// TestComplexDependencyResolution tests complex dependency scenarios
+func TestComplexDependencyResolution(t *testing.T) {
+	all := complexDependencyPackages()
 	req := []ospackage.PackageInfo{{Name: "app", Version: "1.0"}}
 
 	result, err := debutils.ResolveDependencies(req, all)
@@ -318,6 +323,59 @@ func TestComplexDependencyResolution(t *testing.T) {
 	}
 }
 
+// TestComplexDependencyGraph tests that the dependency graph of the complex
+// scenario matches the resolved relationships
+func TestComplexDependencyGraph(t *testing.T) {
+	req := []ospackage.PackageInfo{{Name: "app", Version: "1.0"}}
+
+	result, graph, err := debutils.ResolveDependencyGraph(req, complexDependencyPackages())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(graph.Nodes) != len(result) {
+		t.Errorf("Expected %d nodes, got %d", len(result), len(graph.Nodes))
+	}
+	for _, pkg := range result {
+		node := graph.Node(pkg.Name)
+		if node == nil {
+			t.Errorf("Resolved package %s has no node", pkg.Name)
+			continue
+		}
+		if node.Version != pkg.Version {
+			t.Errorf("Node %s: expected version %s, got %s", pkg.Name, pkg.Version, node.Version)
+		}
+		if node.Requested != (pkg.Name == "app") {
+			t.Errorf("Node %s: unexpected requested flag %v", pkg.Name, node.Requested)
+		}
+	}
+
+	expectedEdges := []ospackage.DependencyEdge{
+		{From: "app", To: "libbar", Requirement: "libbar", Kind: ospackage.EdgeRequires},
+		{From: "app", To: "libfoo", Requirement: "libfoo", Kind: ospackage.EdgeRequires},
+		{From: "libfoo", To: "libbase", Requirement: "libbase", Kind: ospackage.EdgeRequires},
+	}
+	if fmt.Sprint(graph.Edges) != fmt.Sprint(expectedEdges) {
+		t.Errorf("Expected edges %v, got %v", expectedEdges, graph.Edges)
+	}
+
+	var dot strings.Builder
+	if err := graph.WriteDOT(&dot); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	for _, want := range []string{
+		"\"app\" [label=\"app\\n1.0\", style=bold];",
+		"\"libfoo\" [label=\"libfoo\\n1.6\"];",
+		"\"app\" -> \"libbar\";",
+		"\"app\" -> \"libfoo\";",
+		"\"libfoo\" -> \"libbase\";",
+	} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("Expected DOT output to contain %s, got:\n%s", want, dot.String())
+		}
+	}
+}
+
 // TestRepositoryPriority tests repository-based dependency resolution
 func TestRepositoryPriority(t *testing.T) {
 	// Test that dependencies are resolved from the same repository when possible
@@ -370,6 +428,61 @@ func TestRepositoryPriority(t *testing.T) {
 	}
 }
 
+// TestRepositoryPriorityOverlay tests that a higher priority overlay
+// repository provides its packages even when the base repository has newer
+// versions of them, while the other packages still come from the base
+func TestRepositoryPriorityOverlay(t *testing.T) {
+	origRepoCfgs := debutils.RepoCfgs
+	defer func() { debutils.RepoCfgs = origRepoCfgs }()
+
+	const baseURL = "http://base.example.com/ubuntu"
+	const overlayURL = "http://overlay.example.com/ubuntu"
+	deb := func(repoURL, name, version string, requires ...string) ospackage.PackageInfo {
+		return ospackage.PackageInfo{
+			Name:        name,
+			Version:     version,
+			URL:         fmt.Sprintf("%s/pool/main/%s_%s_amd64.deb", repoURL, name, version),
+			Requires:    requires,
+			RequiresVer: requires,
+		}
+	}
+	all := []ospackage.PackageInfo{
+		deb(baseURL, "libfoo", "2.0"),
+		deb(baseURL, "app", "1.0", "libfoo"),
+		deb(baseURL, "tool", "3.0"),
+		deb(overlayURL, "libfoo", "1.5"),
+	}
+	debutils.RepoCfgs = []debutils.RepoConfig{
+		{PkgPrefix: baseURL, Priority: 500},
+		{PkgPrefix: overlayURL, Priority: 600},
+	}
+
+	requested, err := debutils.MatchRequested([]string{"libfoo", "app", "tool"}, all)
+	if err != nil {
+		t.Fatalf("MatchRequested failed: %v", err)
+	}
+	resolved, err := debutils.ResolveDependencies(requested, all)
+	if err != nil {
+		t.Fatalf("ResolveDependencies failed: %v", err)
+	}
+
+	want := map[string]string{
+		"libfoo": overlayURL + "/pool/main/libfoo_1.5_amd64.deb",
+		"app":    baseURL + "/pool/main/app_1.0_amd64.deb",
+		"tool":   baseURL + "/pool/main/tool_3.0_amd64.deb",
+	}
+	for _, pkgs := range [][]ospackage.PackageInfo{requested, resolved} {
+		if len(pkgs) != len(want) {
+			t.Fatalf("Expected %d packages, got %+v", len(want), pkgs)
+		}
+		for _, pkg := range pkgs {
+			if pkg.URL != want[pkg.Name] {
+				t.Errorf("Expected %s from %s, got %s", pkg.Name, want[pkg.Name], pkg.URL)
+			}
+		}
+	}
+}
+
 // TestConflictingVersionRequirements tests conflicting version scenarios
 func TestConflictingVersionRequirements(t *testing.T) {
 	all := []ospackage.PackageInfo{
@@ -474,6 +587,87 @@ func TestProviderResolution(t *testing.T) {
 	}
 }
 
+// TestProviderResolutionDeterministic tests that a virtual dependency with
+// several providers resolves to the same package whatever the order of the
+// repository listing
+func TestProviderResolutionDeterministic(t *testing.T) {
+	consumer := ospackage.PackageInfo{
+		Name:     "consumer",
+		Version:  "1.0",
+		URL:      "http://archive.ubuntu.com/ubuntu/pool/main/c/consumer/consumer_1.0_amd64.deb",
+		Requires: []string{"virtual-service"},
+	}
+	provider := func(name, version string, provides ...string) ospackage.PackageInfo {
+		return ospackage.PackageInfo{
+			Name:     name,
+			Version:  version,
+			URL:      fmt.Sprintf("http://archive.ubuntu.com/ubuntu/pool/main/p/%s/%s_%s_amd64.deb", name, name, version),
+			Provides: provides,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		providers []ospackage.PackageInfo
+		expected  string
+	}{
+		{
+			name: "highest version wins",
+			providers: []ospackage.PackageInfo{
+				provider("provider-a", "1.0", "virtual-service"),
+				provider("provider-b", "2.0", "virtual-service"),
+				provider("provider-c", "1.5", "virtual-service"),
+			},
+			expected: "provider-b",
+		},
+		{
+			name: "same version falls back to name",
+			providers: []ospackage.PackageInfo{
+				provider("provider-c", "2.0", "virtual-service"),
+				provider("provider-b", "2.0", "virtual-service"),
+				provider("provider-a", "1.0", "virtual-service"),
+			},
+			expected: "provider-b",
+		},
+		{
+			name: "real package wins over providers",
+			providers: []ospackage.PackageInfo{
+				provider("provider-a", "9.0", "virtual-service"),
+				provider("virtual-service", "1.0"),
+				provider("provider-b", "8.0", "virtual-service"),
+			},
+			expected: "virtual-service",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Try every rotation of the providers in the listing
+			for shift := range tt.providers {
+				all := []ospackage.PackageInfo{consumer}
+				for i := range tt.providers {
+					all = append(all, tt.providers[(i+shift)%len(tt.providers)])
+				}
+
+				req := []ospackage.PackageInfo{{Name: "consumer", Version: "1.0"}}
+				result, err := debutils.ResolveDependencies(req, all)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if len(result) != 2 {
+					t.Fatalf("Expected 2 packages, got %d", len(result))
+				}
+				for _, pkg := range result {
+					if pkg.Name != "consumer" && pkg.Name != tt.expected {
+						t.Errorf("Listing rotated by %d: expected %s to provide virtual-service, got %s",
+							shift, tt.expected, pkg.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
 // TestGetFullUrlLogic tests URL construction logic indirectly
 func TestGetFullUrlLogic(t *testing.T) {
 	// Since getFullUrl is not exported, we test its behavior indirectly
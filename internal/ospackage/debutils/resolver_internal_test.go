@@ -1,7 +1,18 @@
 package debutils
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
 )
 
 func TestIsGlobPattern(t *testing.T) {
@@ -120,6 +131,18 @@ func TestGetFullUrl(t *testing.T) {
 			baseUrl:  "http://example.com/",
 			expected: "http://example.com/pool/main/curl.deb",
 		},
+		{
+			name:     "leading slash of relative path is not doubled",
+			filePath: "/pool/main/curl.deb",
+			baseUrl:  "http://example.com/debian/",
+			expected: "http://example.com/debian/pool/main/curl.deb",
+		},
+		{
+			name:     "protocol-relative URL takes the scheme of the base URL",
+			filePath: "//mirror.example.com/pool/main/curl.deb",
+			baseUrl:  "http://example.com",
+			expected: "http://mirror.example.com/pool/main/curl.deb",
+		},
 	}
 
 	for _, tt := range tests {
@@ -134,3 +157,163 @@ func TestGetFullUrl(t *testing.T) {
 		})
 	}
 }
+
+// linearCandidates finds the candidates for depName by scanning every package.
+func linearCandidates(depName string, all []ospackage.PackageInfo) []ospackage.PackageInfo {
+	var candidates []ospackage.PackageInfo
+	for _, pi := range all {
+		if pi.Name == depName {
+			candidates = append(candidates, pi)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, pi := range all {
+			for _, provided := range pi.Provides {
+				if provided == depName {
+					candidates = append(candidates, pi)
+				}
+			}
+		}
+	}
+	return filterCandidatesByPriorityWithTarget(candidates, depName)
+}
+
+func TestPackageIndexMatchesLinearScan(t *testing.T) {
+	pkg := func(name, version string, provides ...string) ospackage.PackageInfo {
+		return ospackage.PackageInfo{
+			Name:     name,
+			Version:  version,
+			URL:      fmt.Sprintf("http://example.com/pool/main/%s_%s_amd64.deb", name, version),
+			Provides: provides,
+		}
+	}
+	all := []ospackage.PackageInfo{
+		pkg("mail-transport-agent", "1.0"),
+		pkg("postfix", "3.8", "mail-transport-agent", "default-mta"),
+		pkg("exim4", "4.97", "mail-transport-agent", "default-mta"),
+		pkg("postfix", "3.9", "mail-transport-agent", "default-mta"),
+		pkg("awk-a", "1.0", "awk"),
+		pkg("awk-b", "1.0", "awk"),
+		pkg("mawk", "1.3", "awk"),
+		pkg("libc6", "2.39"),
+		pkg("libc6", "2.38"),
+	}
+	index := newPackageIndex(all)
+
+	for _, depName := range []string{"mail-transport-agent", "default-mta", "awk", "postfix", "libc6", "missing"} {
+		t.Run(depName, func(t *testing.T) {
+			got := index.candidates(depName)
+			want := linearCandidates(depName, all)
+			if len(got) != len(want) {
+				t.Fatalf("index returned %d candidates, linear scan %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].Name != want[i].Name || got[i].Version != want[i].Version {
+					t.Errorf("candidate %d: index returned %s=%s, linear scan %s=%s",
+						i, got[i].Name, got[i].Version, want[i].Name, want[i].Version)
+				}
+			}
+		})
+	}
+
+	// Providers are ordered by version, then by name
+	awk := index.candidates("awk")
+	if len(awk) != 3 || awk[0].Name != "mawk" || awk[1].Name != "awk-a" || awk[2].Name != "awk-b" {
+		t.Errorf("unexpected awk providers order: %+v", awk)
+	}
+}
+
+func TestParseRepositoryMetadataByHash(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write([]byte("Package: hello\nVersion: 2.10-3\nArchitecture: amd64\nFilename: pool/main/h/hello/hello_2.10-3_amd64.deb\n\n")); err != nil {
+		t.Fatalf("Failed to compress Packages: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to compress Packages: %v", err)
+	}
+	index := gz.Bytes()
+	checksum := fmt.Sprintf("%x", sha256.Sum256(index))
+	release := fmt.Sprintf("Origin: Test\nCodename: trixie\nAcquire-By-Hash: yes\nSHA256:\n %s %d main/binary-amd64/Packages.gz\n", checksum, len(index))
+
+	const indexDir = "/dists/trixie/main/binary-amd64"
+	tests := []struct {
+		name          string
+		release       string
+		byHashContent []byte // nil serves a 404
+		direct        bool   // serve the index at its regular path
+		expectFetched string
+		errorContains string
+	}{
+		{
+			name:          "fetches hashed path",
+			release:       release,
+			byHashContent: index,
+			expectFetched: indexDir + "/by-hash/SHA256/" + checksum,
+		},
+		{
+			name:          "falls back to direct path",
+			release:       release,
+			direct:        true,
+			expectFetched: indexDir + "/Packages.gz",
+		},
+		{
+			name:          "direct path without acquire-by-hash",
+			release:       strings.Replace(release, "Acquire-By-Hash: yes\n", "", 1),
+			byHashContent: index,
+			direct:        true,
+			expectFetched: indexDir + "/Packages.gz",
+		},
+		{
+			name:          "hashed path content is verified",
+			release:       release,
+			byHashContent: append([]byte("stale"), index[5:]...),
+			errorContains: "checksum mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var served []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/dists/trixie/Release":
+					_, _ = w.Write([]byte(tt.release))
+					return
+				case r.URL.Path == indexDir+"/Packages.gz" && tt.direct:
+					_, _ = w.Write(index)
+				case strings.HasPrefix(r.URL.Path, indexDir+"/by-hash/") && tt.byHashContent != nil:
+					_, _ = w.Write(tt.byHashContent)
+				default:
+					http.NotFound(w, r)
+					return
+				}
+				mu.Lock()
+				served = append(served, r.URL.Path)
+				mu.Unlock()
+			}))
+			defer server.Close()
+
+			buildPath := filepath.Join(t.TempDir(), "trixie_main")
+			pkgs, err := ParseRepositoryMetadata(server.URL, server.URL+indexDir+"/Packages.gz",
+				server.URL+"/dists/trixie/Release", server.URL+"/dists/trixie/Release.gpg",
+				"[trusted=yes]", buildPath, "amd64", nil)
+			if tt.errorContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorContains) {
+					t.Fatalf("Expected error containing %q, got: %v", tt.errorContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRepositoryMetadata failed: %v", err)
+			}
+			if len(pkgs) != 1 || pkgs[0].Name != "hello" {
+				t.Errorf("Expected the hello package, got %+v", pkgs)
+			}
+			if len(served) != 1 || served[0] != tt.expectFetched {
+				t.Errorf("Expected the index to be fetched from %s, got %v", tt.expectFetched, served)
+			}
+		})
+	}
+}
@@ -2,13 +2,16 @@ package debutils
 
 import (
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/pkgsorter"
 )
 
 func TestResolveDependenciesAdvanced(t *testing.T) {
@@ -653,3 +656,325 @@ func TestResolveTopPackageConflicts(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePackagesFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		packageFilter []string
+		expectError   bool
+		expectedNames []string
+		expectedSizes []int64
+	}{
+		{
+			name: "two stanzas",
+			content: "Package: bash\nVersion: 5.2-1\nArchitecture: amd64\nFilename: pool/main/b/bash/bash_5.2-1_amd64.deb\nSize: 1484728\n\n" +
+				"Package: coreutils\nVersion: 9.1-1\nArchitecture: amd64\nFilename: pool/main/c/coreutils/coreutils_9.1-1_amd64.deb\n",
+			expectedNames: []string{"bash", "coreutils"},
+			expectedSizes: []int64{1484728, 0},
+		},
+		{
+			name:        "empty file",
+			content:     "",
+			expectError: true,
+		},
+		{
+			name:        "only blank lines",
+			content:     "\n\n\n",
+			expectError: true,
+		},
+		{
+			name:          "filter drops every entry",
+			content:       "Package: bash\nVersion: 5.2-1\n\n",
+			packageFilter: []string{"zsh"},
+			expectedNames: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packagesFile := filepath.Join(t.TempDir(), "Packages")
+			if err := os.WriteFile(packagesFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write Packages file: %v", err)
+			}
+
+			pkgs, err := parsePackagesFile(packagesFile, "http://example.com/debian", tt.packageFilter)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected error but got none")
+				}
+				if !strings.Contains(err.Error(), "empty or truncated repository metadata") {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(pkgs) != len(tt.expectedNames) {
+				t.Fatalf("Expected %d packages, got %d", len(tt.expectedNames), len(pkgs))
+			}
+			for i, name := range tt.expectedNames {
+				if pkgs[i].Name != name {
+					t.Errorf("Expected package %d to be %s, got %s", i, name, pkgs[i].Name)
+				}
+			}
+			for i, size := range tt.expectedSizes {
+				if pkgs[i].Size != size {
+					t.Errorf("Expected package %d size %d, got %d", i, size, pkgs[i].Size)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePackagesFilePreDependsOrder(t *testing.T) {
+	// aaa-tool and zz-lib depend on each other, which alone would install
+	// them alphabetically, but aaa-tool pre-depends on zz-lib
+	content := "Package: test-package\nVersion: 1.0.0-1\nDepends: libc6 (>= 2.31)\nPre-Depends: dpkg (>= 1.17.5)\n\n" +
+		"Package: dpkg\nVersion: 1.22.6\nDepends: libc6\n\n" +
+		"Package: libc6\nVersion: 2.39-0ubuntu8\n\n" +
+		"Package: aaa-tool\nVersion: 1.0\nPre-Depends: zz-lib (>= 1.0)\n\n" +
+		"Package: zz-lib\nVersion: 1.0\nDepends: aaa-tool, libc6\n"
+	packagesFile := filepath.Join(t.TempDir(), "Packages")
+	if err := os.WriteFile(packagesFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Packages file: %v", err)
+	}
+
+	pkgs, err := parsePackagesFile(packagesFile, "http://example.com/debian", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := pkgs[0]; !slices.Equal(got.PreDepends, []string{"dpkg"}) || !slices.Equal(got.Requires, []string{"libc6", "dpkg"}) {
+		t.Errorf("Expected dpkg as pre-dependency and dependency of test-package, got PreDepends=%v Requires=%v",
+			got.PreDepends, got.Requires)
+	}
+
+	sorted, err := pkgsorter.SortPackages(pkgs)
+	if err != nil {
+		t.Fatalf("SortPackages failed: %v", err)
+	}
+	position := make(map[string]int)
+	for i, pkg := range sorted {
+		position[pkg.Name] = i
+	}
+	for pkg, preDep := range map[string]string{"test-package": "dpkg", "aaa-tool": "zz-lib"} {
+		if position[preDep] >= position[pkg] {
+			t.Errorf("Expected pre-dependency %s to be installed before %s, got order %v", preDep, pkg, position)
+		}
+	}
+}
+
+func TestPackageRepositoryOrigin(t *testing.T) {
+	oldRepoCfgs := RepoCfgs
+	defer func() { RepoCfgs = oldRepoCfgs }()
+
+	const archiveURL = "http://archive.ubuntu.com/ubuntu"
+	const ppaURL = "http://ppa.launchpad.net/test/ppa/ubuntu"
+	repos := map[string]string{
+		archiveURL: "Package: tool\nVersion: 1.0\nFilename: pool/main/t/tool/tool_1.0_amd64.deb\nDepends: libtool\n\n" +
+			"Package: libtool\nVersion: 1.0\nFilename: pool/main/l/libtool/libtool_1.0_amd64.deb\n",
+		ppaURL: "Package: tool\nVersion: 1.0\nFilename: pool/main/t/tool/tool_1.0_amd64.deb\nDepends: libtool\n",
+	}
+
+	var all []ospackage.PackageInfo
+	for baseURL, content := range repos {
+		packagesFile := filepath.Join(t.TempDir(), "Packages")
+		if err := os.WriteFile(packagesFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write Packages file: %v", err)
+		}
+		pkgs, err := parsePackagesFile(packagesFile, baseURL, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, pkg := range pkgs {
+			if pkg.Repository != baseURL {
+				t.Errorf("Expected %s parsed from %s to record it as its repository, got %q", pkg.Name, baseURL, pkg.Repository)
+			}
+		}
+		all = append(all, pkgs...)
+	}
+
+	RepoCfgs = []RepoConfig{
+		{PkgPrefix: archiveURL, Priority: 500},
+		{PkgPrefix: ppaURL, Priority: 990},
+	}
+	tool, found := resolveRequestedSpec("tool", all)
+	if !found {
+		t.Fatal("Expected tool to be resolved")
+	}
+	if tool.Repository != ppaURL {
+		t.Errorf("Expected tool from the preferred repository %s, got %s", ppaURL, tool.Repository)
+	}
+
+	_, graph, err := ResolveDependencyGraph([]ospackage.PackageInfo{tool}, all)
+	if err != nil {
+		t.Fatalf("ResolveDependencyGraph failed: %v", err)
+	}
+	for name, repo := range map[string]string{"tool": ppaURL, "libtool": archiveURL} {
+		if node := graph.Node(name); node == nil || node.Repository != repo {
+			t.Errorf("Expected %s to be resolved from %s, got %+v", name, repo, node)
+		}
+	}
+}
+
+func TestResolveDependenciesExplain(t *testing.T) {
+	originalReportPath := ReportPath
+	ReportPath = t.TempDir()
+	defer func() {
+		ReportPath = originalReportPath
+		Explain = false
+	}()
+
+	pkg := func(name, version string, requires ...string) ospackage.PackageInfo {
+		return ospackage.PackageInfo{
+			Name:        name,
+			Version:     version,
+			Requires:    requires,
+			RequiresVer: requires,
+			URL:         fmt.Sprintf("http://archive.ubuntu.com/ubuntu/pool/main/%s_%s_amd64.deb", name, version),
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		requested    []ospackage.PackageInfo
+		all          []ospackage.PackageInfo
+		explain      bool
+		errorContain []string
+		errorExclude string
+	}{
+		{
+			name:      "missing transitive dependency",
+			requested: []ospackage.PackageInfo{{Name: "curl", Version: "8.5"}},
+			all: []ospackage.PackageInfo{
+				pkg("curl", "8.5", "libcurl4"),
+				pkg("libcurl4", "8.5", "libssl3"),
+			},
+			explain:      true,
+			errorContain: []string{"curl -> libcurl4 -> libssl3 (missing)"},
+		},
+		{
+			name:      "conflict between two roots",
+			requested: []ospackage.PackageInfo{{Name: "app-a", Version: "1.0"}, {Name: "app-b", Version: "1.0"}},
+			all: []ospackage.PackageInfo{
+				pkg("app-a", "1.0", "liba"),
+				pkg("liba", "1.0", "libfoo (= 1.0)"),
+				pkg("app-b", "1.0", "libfoo (= 2.0)"),
+				pkg("libfoo", "1.0"),
+				pkg("libfoo", "2.0"),
+			},
+			explain: true,
+			errorContain: []string{
+				"conflicting package dependencies",
+				// app-b is resolved before liba, so its libfoo 2.0 is included first
+				"required via app-a -> liba -> libfoo",
+				"already included via app-b -> libfoo",
+			},
+		},
+		{
+			name:      "no explanation without explain mode",
+			requested: []ospackage.PackageInfo{{Name: "curl", Version: "8.5"}},
+			all: []ospackage.PackageInfo{
+				pkg("curl", "8.5", "libcurl4"),
+				pkg("libcurl4", "8.5", "libssl3"),
+			},
+			errorContain: []string{"one or more requested dependencies not found"},
+			errorExclude: "->",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			Explain = tc.explain
+			_, err := ResolveDependencies(tc.requested, tc.all)
+			if err == nil {
+				t.Fatalf("expected resolve error")
+			}
+			for _, want := range tc.errorContain {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got: %v", want, err)
+				}
+			}
+			if tc.errorExclude != "" && strings.Contains(err.Error(), tc.errorExclude) {
+				t.Errorf("expected error without %q, got: %v", tc.errorExclude, err)
+			}
+		})
+	}
+}
+
+func TestResolveDependenciesStableOrder(t *testing.T) {
+	pkg := func(name, version string, requires ...string) ospackage.PackageInfo {
+		return ospackage.PackageInfo{
+			Name:        name,
+			Version:     version,
+			Requires:    requires,
+			RequiresVer: requires,
+			URL:         fmt.Sprintf("http://archive.ubuntu.com/ubuntu/pool/main/%s_%s_amd64.deb", name, version),
+		}
+	}
+	all := []ospackage.PackageInfo{
+		pkg("curl", "8.5", "libcurl4", "zlib1g"),
+		pkg("wget", "1.21", "libssl3", "zlib1g"),
+		pkg("libcurl4", "8.5", "libssl3", "libnghttp2-14 (>= 1.50)"),
+		pkg("libssl3", "3.0", "libc6"),
+		pkg("libnghttp2-14", "1.59", "libc6"),
+		pkg("zlib1g", "1.3", "libc6"),
+		pkg("libc6", "2.39"),
+		pkg("unused", "1.0"),
+	}
+	requested := []ospackage.PackageInfo{{Name: "curl", Version: "8.5"}, {Name: "wget", Version: "1.21"}}
+	order := func(pkgs []ospackage.PackageInfo) string {
+		var lines []string
+		for _, p := range pkgs {
+			lines = append(lines, p.Name+" "+p.Version)
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	var want string
+	for i := 0; i < 50; i++ {
+		allCopy := append([]ospackage.PackageInfo(nil), all...)
+		reqCopy := append([]ospackage.PackageInfo(nil), requested...)
+		rng.Shuffle(len(allCopy), func(a, b int) { allCopy[a], allCopy[b] = allCopy[b], allCopy[a] })
+		rng.Shuffle(len(reqCopy), func(a, b int) { reqCopy[a], reqCopy[b] = reqCopy[b], reqCopy[a] })
+
+		result, err := ResolveDependencies(reqCopy, allCopy)
+		if err != nil {
+			t.Fatalf("ResolveDependencies failed: %v", err)
+		}
+		got := order(result)
+		if i == 0 {
+			want = got
+			if len(result) != 7 {
+				t.Fatalf("expected 7 resolved packages, got:\n%s", got)
+			}
+			continue
+		}
+		if got != want {
+			t.Fatalf("run %d resolved a different order:\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+}
+
+func TestResolveExplanationIncluded(t *testing.T) {
+	explanation := newResolveExplanation()
+	explanation.addRequested("curl")
+	explanation.addRequired("curl", "libcurl4")
+	explanation.addRequired("libcurl4", "libssl3")
+	explanation.addRequested("openssl")
+	// libssl3 stays explained through the first package that required it
+	explanation.addRequired("openssl", "libssl3")
+
+	got := explanation.included([]string{"libssl3", "curl", "libcurl4", "openssl"})
+	want := []string{
+		"curl: requested",
+		"libcurl4: curl -> libcurl4",
+		"libssl3: curl -> libcurl4 -> libssl3",
+		"openssl: requested",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("included() = %q, want %q", got, want)
+	}
+}
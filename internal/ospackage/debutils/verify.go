@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -104,12 +105,20 @@ func VerifyPackagegz(relPath string, pkggzPath string, arch string, component st
 	// Get expected checksum from Release file
 	pkgPathSrch := fmt.Sprintf("%s/binary-%s/%s", component, arch, baseFile)
 	log.Infof("Searching for %s in Release file %s", pkgPathSrch, relPath)
-	checksum, err := findChecksumInRelease(relPath, "SHA256", pkgPathSrch)
+	checksum, size, err := findReleaseEntry(relPath, "SHA256", pkgPathSrch)
 	log.Infof("Checksum from Release file (%s): %s Err:%s", relPath, checksum, err)
 	if err != nil {
 		return false, fmt.Errorf("failed to get checksum from Release: %w", err)
 	}
 
+	// A size mismatch means the mirror served an empty or cut-off file; report
+	// that directly rather than as an opaque checksum mismatch
+	if info, statErr := os.Stat(pkggzPath); statErr == nil && size >= 0 && info.Size() != size {
+		log.Errorf("Size mismatch for %s: Release declares %d bytes, got %d", pkggzPath, size, info.Size())
+		return false, fmt.Errorf("empty or truncated repository metadata %s: Release declares %d bytes, got %d",
+			pkggzPath, size, info.Size())
+	}
+
 	// Compute actual checksum of Packages.gz
 	actual, err := computeFileSHA256(pkggzPath)
 	if err != nil {
@@ -354,9 +363,44 @@ func computeFileSHA256(path string) (string, error) {
 // FindChecksumInRelease parses the Release file and returns the checksum for the given file and checksum type.
 // Example: findChecksumInRelease("Release", "SHA256", "main/binary-amd64/Packages.gz")
 func findChecksumInRelease(releasePath, checksumType, fileName string) (string, error) {
+	checksum, _, err := findReleaseEntry(releasePath, checksumType, fileName)
+	return checksum, err
+}
+
+// releaseAcquireByHash reports whether the Release file declares
+// "Acquire-By-Hash: yes", meaning the indices it lists are also served under
+// by-hash/<checksum type>/<checksum> next to their regular path.
+func releaseAcquireByHash(releasePath string) (bool, error) {
 	f, err := os.Open(releasePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open release file: %w", err)
+		return false, fmt.Errorf("failed to open release file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// The checksum sections follow the header fields
+		if line == "" || strings.HasPrefix(line, " ") {
+			break
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "Acquire-By-Hash") {
+			return strings.EqualFold(strings.TrimSpace(value), "yes"), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("error reading release file: %v", err)
+	}
+	return false, nil
+}
+
+// findReleaseEntry returns the checksum and declared size of fileName from the
+// checksumType section of the Release file. The size is -1 if it is not a number.
+func findReleaseEntry(releasePath, checksumType, fileName string) (string, int64, error) {
+	f, err := os.Open(releasePath)
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to open release file: %w", err)
 	}
 	defer f.Close()
 
@@ -385,16 +429,20 @@ func findChecksumInRelease(releasePath, checksumType, fileName string) (string,
 				continue
 			}
 			if parts[2] == fileName {
-				return parts[0], nil
+				size, err := strconv.ParseInt(parts[1], 10, 64)
+				if err != nil {
+					size = -1
+				}
+				return parts[0], size, nil
 			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading release file: %v", err)
+		return "", -1, fmt.Errorf("error reading release file: %v", err)
 	}
 
 	log := logger.Logger()
 	log.Warnf("Could not find %s in section %s of %s", fileName, checksumType, releasePath)
-	return "", fmt.Errorf("checksum for %s (%s) not found", fileName, checksumType)
+	return "", -1, fmt.Errorf("checksum for %s (%s) not found", fileName, checksumType)
 }
@@ -78,6 +78,33 @@ SHA256:
 			expectError:   true,
 			errorContains: "checksum mismatch",
 		},
+		{
+			name: "truncated packages file",
+			setupFiles: func(tempDir string) (string, string, string) {
+				pkggzPath := filepath.Join(tempDir, "Packages.gz")
+				content := []byte("test packages")
+				err := os.WriteFile(pkggzPath, content, 0644)
+				if err != nil {
+					t.Fatalf("Failed to create test packages file: %v", err)
+				}
+
+				// Release declares the full 21-byte file
+				relPath := filepath.Join(tempDir, "Release")
+				releaseContent := fmt.Sprintf(`Suite: stable
+SHA256:
+ %x 21 main/binary-amd64/Packages.gz
+`, sha256.Sum256([]byte("test packages content")))
+				err = os.WriteFile(relPath, []byte(releaseContent), 0644)
+				if err != nil {
+					t.Fatalf("Failed to create Release file: %v", err)
+				}
+
+				return relPath, pkggzPath, "amd64"
+			},
+			expectOK:      false,
+			expectError:   true,
+			errorContains: "empty or truncated repository metadata",
+		},
 		{
 			name: "release file not found",
 			setupFiles: func(tempDir string) (string, string, string) {
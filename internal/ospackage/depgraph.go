@@ -0,0 +1,140 @@
+package ospackage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Kinds of DependencyEdge
+const (
+	EdgeRequires = "requires" // the requirement names the package itself
+	EdgeProvides = "provides" // the requirement is a capability the package provides
+)
+
+// DependencyGraph is the result of a dependency resolution as a DAG: the
+// resolved packages, and which package required which. It serializes to JSON
+// as it is, and to DOT with WriteDOT.
+type DependencyGraph struct {
+	Nodes []DependencyNode `json:"nodes"` // sorted by name
+	Edges []DependencyEdge `json:"edges"` // sorted by from, then to
+}
+
+// DependencyNode is one resolved package of a DependencyGraph.
+type DependencyNode struct {
+	Name       string `json:"name"`
+	Package    string `json:"package,omitempty"` // canonical package name, when Name is a file name
+	Version    string `json:"version"`
+	Arch       string `json:"arch,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Repository string `json:"repository,omitempty"` // base URL of the repository the package was resolved from
+	Requested  bool   `json:"requested"`            // part of the requested seed list
+}
+
+// DependencyEdge records that package From required package To, which
+// satisfies Requirement, the name of the required package or capability.
+type DependencyEdge struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Requirement string `json:"requirement,omitempty"`
+	Kind        string `json:"kind"` // EdgeRequires or EdgeProvides
+}
+
+// NewDependencyGraph returns the graph of the resolved packages, with the
+// packages named in requested marked as such and no edges.
+func NewDependencyGraph(resolved []PackageInfo, requested []string) *DependencyGraph {
+	isRequested := make(map[string]bool, len(requested))
+	for _, name := range requested {
+		isRequested[name] = true
+	}
+	graph := &DependencyGraph{Nodes: make([]DependencyNode, 0, len(resolved)), Edges: []DependencyEdge{}}
+	for _, pkg := range resolved {
+		graph.Nodes = append(graph.Nodes, DependencyNode{
+			Name:       pkg.Name,
+			Package:    pkg.PkgName,
+			Version:    pkg.Version,
+			Arch:       pkg.Arch,
+			URL:        pkg.URL,
+			Repository: pkg.Repository,
+			Requested:  isRequested[pkg.Name],
+		})
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].Name < graph.Nodes[j].Name
+	})
+	return graph
+}
+
+// Node returns the package named name, or nil if the graph has none.
+func (g *DependencyGraph) Node(name string) *DependencyNode {
+	i := sort.Search(len(g.Nodes), func(i int) bool { return g.Nodes[i].Name >= name })
+	if i < len(g.Nodes) && g.Nodes[i].Name == name {
+		return &g.Nodes[i]
+	}
+	return nil
+}
+
+// AddEdge records that from required to through requirement. Edges to or
+// from packages that are not nodes of the graph, self edges and duplicates
+// are ignored.
+func (g *DependencyGraph) AddEdge(from, to, requirement string) {
+	toNode := g.Node(to)
+	if from == to || g.Node(from) == nil || toNode == nil {
+		return
+	}
+	i := sort.Search(len(g.Edges), func(i int) bool {
+		e := g.Edges[i]
+		return e.From > from || (e.From == from && e.To >= to)
+	})
+	if i < len(g.Edges) && g.Edges[i].From == from && g.Edges[i].To == to {
+		return
+	}
+	kind := EdgeRequires
+	if requirement != "" && requirement != toNode.Name && requirement != toNode.Package {
+		kind = EdgeProvides
+	}
+	edge := DependencyEdge{From: from, To: to, Requirement: requirement, Kind: kind}
+	g.Edges = append(g.Edges, DependencyEdge{})
+	copy(g.Edges[i+1:], g.Edges[i:])
+	g.Edges[i] = edge
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Nodes are labeled with
+// their version, requested packages are drawn bold, and edges satisfied
+// through a provided capability are dashed and labeled with it.
+func (g *DependencyGraph) WriteDOT(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	fmt.Fprintln(writer, "digraph G {")
+	fmt.Fprintln(writer, "  rankdir=LR;")
+	fmt.Fprintln(writer, "  node [shape=box];")
+	for _, node := range g.Nodes {
+		attrs := fmt.Sprintf("label=%s", dotQuote(node.Name+"\n"+node.Version))
+		if node.Requested {
+			attrs += ", style=bold"
+		}
+		fmt.Fprintf(writer, "  %s [%s];\n", dotQuote(node.Name), attrs)
+	}
+	for _, edge := range g.Edges {
+		if edge.Kind == EdgeProvides {
+			fmt.Fprintf(writer, "  %s -> %s [label=%s, style=dashed];\n",
+				dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Requirement))
+			continue
+		}
+		fmt.Fprintf(writer, "  %s -> %s;\n", dotQuote(edge.From), dotQuote(edge.To))
+	}
+	fmt.Fprintln(writer, "}")
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("writing DOT graph: %w", err)
+	}
+	return nil
+}
+
+// dotQuote returns s as a quoted DOT ID.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,123 @@
+package ospackage_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+)
+
+func testDependencyGraph() *ospackage.DependencyGraph {
+	graph := ospackage.NewDependencyGraph([]ospackage.PackageInfo{
+		{Name: "mta", Version: "1.0"},
+		{Name: "app", Version: "2.0", Arch: "amd64"},
+		{Name: "bash-5.2-1.x86_64.rpm", PkgName: "bash", Version: "5.2-1"},
+		{Name: `odd"name`, Version: `1\2`},
+	}, []string{"app"})
+	graph.AddEdge("app", "mta", "mail-transport-agent")
+	graph.AddEdge("app", "bash-5.2-1.x86_64.rpm", "bash")
+	graph.AddEdge("app", "mta", "mail-transport-agent") // duplicate
+	graph.AddEdge("app", "missing", "missing")          // not resolved
+	graph.AddEdge("app", "app", "app")                  // self edge
+	graph.AddEdge(`odd"name`, "app", "app")
+	return graph
+}
+
+func TestDependencyGraphEdges(t *testing.T) {
+	graph := testDependencyGraph()
+
+	want := []ospackage.DependencyEdge{
+		{From: "app", To: "bash-5.2-1.x86_64.rpm", Requirement: "bash", Kind: ospackage.EdgeRequires},
+		{From: "app", To: "mta", Requirement: "mail-transport-agent", Kind: ospackage.EdgeProvides},
+		{From: `odd"name`, To: "app", Requirement: "app", Kind: ospackage.EdgeRequires},
+	}
+	if !reflect.DeepEqual(graph.Edges, want) {
+		t.Errorf("Edges = %+v, want %+v", graph.Edges, want)
+	}
+	if node := graph.Node("app"); node == nil || !node.Requested || node.Arch != "amd64" {
+		t.Errorf("expected app to be a requested amd64 node, got %+v", node)
+	}
+	if node := graph.Node("mta"); node == nil || node.Requested {
+		t.Errorf("expected mta to be a node that was not requested, got %+v", node)
+	}
+	if graph.Node("missing") != nil {
+		t.Errorf("expected no node for an unresolved package")
+	}
+}
+
+func TestDependencyGraphJSON(t *testing.T) {
+	graph := testDependencyGraph()
+
+	data, err := json.Marshal(graph)
+	if err != nil {
+		t.Fatalf("failed to marshal graph: %v", err)
+	}
+	var decoded ospackage.DependencyGraph
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal graph: %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, graph) {
+		t.Errorf("JSON round trip = %+v, want %+v", decoded, *graph)
+	}
+	if !strings.Contains(string(data), `"kind":"provides"`) {
+		t.Errorf("expected edge kinds in JSON output, got %s", data)
+	}
+}
+
+// dotIDPattern matches a quoted DOT ID
+const dotIDPattern = `"(?:[^"\\]|\\.)*"`
+
+var (
+	dotNodePattern = regexp.MustCompile(`^  (` + dotIDPattern + `) \[label=` + dotIDPattern + `(?:, style=bold)?\];$`)
+	dotEdgePattern = regexp.MustCompile(`^  (` + dotIDPattern + `) -> (` + dotIDPattern + `)(?: \[label=` + dotIDPattern + `, style=dashed\])?;$`)
+)
+
+func TestDependencyGraphWriteDOT(t *testing.T) {
+	graph := testDependencyGraph()
+
+	var out strings.Builder
+	if err := graph.WriteDOT(&out); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) < 4 || lines[0] != "digraph G {" || lines[len(lines)-1] != "}" {
+		t.Fatalf("expected a digraph statement, got:\n%s", out.String())
+	}
+
+	// Every statement must parse, and every edge must join declared nodes
+	nodes := make(map[string]bool)
+	edges := 0
+	for _, line := range lines[1 : len(lines)-1] {
+		if line == "  rankdir=LR;" || line == "  node [shape=box];" {
+			continue
+		}
+		if m := dotNodePattern.FindStringSubmatch(line); m != nil {
+			nodes[m[1]] = true
+			continue
+		}
+		m := dotEdgePattern.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("invalid DOT statement: %s", line)
+			continue
+		}
+		if !nodes[m[1]] || !nodes[m[2]] {
+			t.Errorf("edge between undeclared nodes: %s", line)
+		}
+		edges++
+	}
+	if len(nodes) != len(graph.Nodes) || edges != len(graph.Edges) {
+		t.Errorf("expected %d nodes and %d edges, got %d and %d", len(graph.Nodes), len(graph.Edges), len(nodes), edges)
+	}
+
+	for _, want := range []string{
+		`"app" -> "mta" [label="mail-transport-agent", style=dashed];`,
+		`"odd\"name" [label="odd\"name\n1\\2"];`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected DOT output to contain %s, got:\n%s", want, out.String())
+		}
+	}
+}
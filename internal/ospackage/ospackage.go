@@ -6,19 +6,27 @@ type PackageInfo struct {
 	Type             string // e.g. "rpm", "deb", "apk"
 	Description      string // e.g. "Abseil C++ Common Libraries"
 	Origin           string // e.g. "Intel", the vendor or supplier of the package
+	Repository       string // base URL of the repository whose metadata listed the package
 	License          string // e.g. "Apache-2.0"
 	Version          string // e.g. "7.88.1-10+deb12u5"
 	Arch             string // e.g. "x86_64", "noarch", "src"
 	URL              string // download URL
+	Size             int64  // download size in bytes from the repository metadata, 0 if unknown
 	Checksums        []Checksum
 	Provides         []string // capabilities this package provides (rpm:entry names)
 	Requires         []string // capabilities this package requires
 	RequiresVer      []string // version constraints for the required capabilities
 	RequiresPkgNames []string // canonical package names of dependencies (extracted from Requires)
+	PreDepends       []string // required packages to install before this one (deb Pre-Depends), also in Requires
 	Files            []string // list of files in this package (rpm:files)
 	PkgName          string   // name of the package
 }
 
+// SpaceCheck is called with the resolved packages and their download
+// directory before any package is fetched, so that a build that cannot fit on
+// disk fails before downloading anything.
+type SpaceCheck func(pkgs []PackageInfo, destDir string) error
+
 // Checksum holds the algorithm and value of a checksum.
 type Checksum struct {
 	Algorithm string
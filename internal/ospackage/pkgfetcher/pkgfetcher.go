@@ -1,27 +1,61 @@
 package pkgfetcher
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/network"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 	"github.com/schollz/progressbar/v3"
 )
 
 const (
 	maxDownloadAttempts = 3
 	initialRetryBackoff = 500 * time.Millisecond
+	// maxWorkersPerCPU bounds the download workers; downloads are I/O bound, so
+	// several workers per CPU pay off, but each one holds open connections and
+	// files.
+	maxWorkersPerCPU = 8
 )
 
+// numCPU is replaced in tests to make the worker limit predictable.
+var numCPU = runtime.NumCPU
+
+// EffectiveWorkers returns the number of download workers to run for a
+// requested count: at least 1 and at most maxWorkersPerCPU per CPU. A warning
+// is logged when the requested count is clamped.
+func EffectiveWorkers(requested int) int {
+	log := logger.Logger()
+
+	maxWorkers := maxWorkersPerCPU * numCPU()
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	switch {
+	case requested < 1:
+		log.Warnf("invalid download worker count %d, using 1 worker", requested)
+		return 1
+	case requested > maxWorkers:
+		log.Warnf("download worker count %d exceeds the limit of %d (%d per CPU), using %d workers",
+			requested, maxWorkers, maxWorkersPerCPU, maxWorkers)
+		return maxWorkers
+	default:
+		return requested
+	}
+}
+
 func shouldRetryHTTPStatus(statusCode int) bool {
 	switch statusCode {
 	case http.StatusRequestTimeout,
@@ -44,11 +78,17 @@ func downloadWithRetry(client *http.Client, url, destPath string, threadcontext
 	backoff := initialRetryBackoff
 
 	for attempt := 1; attempt <= maxDownloadAttempts; attempt++ {
-		resp, err := client.Get(url)
+		if err := shell.CheckBuildDeadline(); err != nil {
+			return fmt.Errorf("download of %s stopped: %w", url, err)
+		}
+		ctx, cancel := buildDeadlineContext()
+		resp, err := getWithContext(ctx, client, url)
 		if err != nil {
+			cancel()
 			lastErr = err
 		} else {
 			func() {
+				defer cancel()
 				defer resp.Body.Close()
 
 				if resp.StatusCode != http.StatusOK {
@@ -114,10 +154,31 @@ func downloadWithRetry(client *http.Client, url, destPath string, threadcontext
 	return fmt.Errorf("download failed after %d attempts: %w", maxDownloadAttempts, lastErr)
 }
 
+// buildDeadlineContext returns a context that expires at shell.BuildDeadline,
+// so that a download in progress stops with the build.
+func buildDeadlineContext() (context.Context, context.CancelFunc) {
+	if shell.BuildDeadline.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithDeadline(context.Background(), shell.BuildDeadline)
+}
+
+// getWithContext sends a GET request for url bound to ctx.
+func getWithContext(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
 // FetchPackages downloads the given URLs into destDir using a pool of workers.
-// It shows a single progress bar tracking files completed vs total.
+// It shows a single progress bar tracking files completed vs total. The
+// worker count is clamped with EffectiveWorkers. The URLs are rewritten by
+// the configured repository mirrors; the files keep their upstream names.
 func FetchPackages(urls []string, destDir string, workers int) error {
 	log := logger.Logger()
+	workers = EffectiveWorkers(workers)
 
 	total := len(urls)
 	jobs := make(chan string, total)
@@ -146,13 +207,11 @@ func FetchPackages(urls []string, destDir string, workers int) error {
 	// start worker goroutines
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func() {
+		go func(i int) {
 			defer wg.Done()
 			for url := range jobs {
-				name := path.Base(url)
-
 				// update description to current file
-				bar.Describe(name)
+				bar.Describe(path.Base(url))
 
 				// ensure destination directory exists
 				if err := os.MkdirAll(destDir, 0755); err != nil {
@@ -163,25 +222,7 @@ func FetchPackages(urls []string, destDir string, workers int) error {
 					continue
 				}
 
-				destPath := filepath.Join(destDir, name)
-				if fi, err := os.Stat(destPath); err == nil {
-					if fi.Size() > 0 {
-						//log.Debugf("skipping existing %s", name)
-						if err := bar.Add(1); err != nil {
-							log.Errorf("failed to add to progress bar: %v", err)
-						}
-						continue
-					}
-					// file exists but zero size: re-download
-					log.Warnf("re-downloading zero-size %s", name)
-				}
-				client := network.GetSecureHTTPClient()
-				// S3/CloudFront treats literal '+' as space; encode it as %2B in the
-				// download URL only (the local filename keeps the original '+').
-				downloadURL := strings.ReplaceAll(url, "+", "%2B")
-				err := downloadWithRetry(client, downloadURL, destPath, i)
-
-				if err != nil {
+				if err := fetchFile(url, destDir, i); err != nil {
 					log.Errorf("downloading %s failed: %v", url, err)
 					downloadError.Store(true)
 				}
@@ -190,7 +231,7 @@ func FetchPackages(urls []string, destDir string, workers int) error {
 					log.Errorf("failed to add to progress bar: %v", err)
 				}
 			}
-		}()
+		}(i)
 	}
 
 	// enqueue jobs
@@ -211,3 +252,95 @@ func FetchPackages(urls []string, destDir string, workers int) error {
 	}
 	return nil
 }
+
+// fetchFile downloads url into the existing directory destDir, unless a
+// non-empty file of the same name is already there. worker scales the retry
+// backoff.
+func fetchFile(url, destDir string, worker int) error {
+	log := logger.Logger()
+	name := path.Base(url)
+
+	destPath := filepath.Join(destDir, name)
+	if fi, err := os.Stat(destPath); err == nil {
+		if fi.Size() > 0 {
+			return nil
+		}
+		// file exists but zero size: re-download
+		log.Warnf("re-downloading zero-size %s", name)
+	}
+	client := network.GetSecureHTTPClient()
+	// S3/CloudFront treats literal '+' as space; encode it as %2B in the
+	// download URL only (the local filename keeps the original '+').
+	downloadURL := strings.ReplaceAll(config.RewriteRepoURL(url), "+", "%2B")
+	return downloadWithRetry(client, downloadURL, destPath, worker)
+}
+
+// Stream downloads packages into a directory while their URLs are still being
+// produced, such as during dependency resolution, instead of waiting for the
+// complete list like FetchPackages. Add blocks while the queue of pending
+// downloads is full, so the producer cannot run arbitrarily far ahead of the
+// workers. A Stream must be finished with Wait.
+type Stream struct {
+	destDir string
+	jobs    chan string
+	seen    map[string]bool // URLs added so far, to download each once
+	wg      sync.WaitGroup
+	failed  atomic.Int32
+	fetched atomic.Int32
+}
+
+// NewStream starts workers download workers, clamped with EffectiveWorkers,
+// fetching the URLs added to the stream into destDir.
+func NewStream(destDir string, workers int) *Stream {
+	log := logger.Logger()
+	workers = EffectiveWorkers(workers)
+
+	s := &Stream{
+		destDir: destDir,
+		jobs:    make(chan string, 2*workers),
+		seen:    make(map[string]bool),
+	}
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go func(i int) {
+			defer s.wg.Done()
+			for url := range s.jobs {
+				err := os.MkdirAll(destDir, 0755)
+				if err == nil {
+					err = fetchFile(url, destDir, i)
+				}
+				if err != nil {
+					log.Errorf("downloading %s failed: %v", url, err)
+					s.failed.Add(1)
+					continue
+				}
+				s.fetched.Add(1)
+			}
+		}(i)
+	}
+	return s
+}
+
+// Add queues url for download. URLs added before are ignored. Add must not be
+// called concurrently or after Wait.
+func (s *Stream) Add(url string) {
+	if url == "" || s.seen[url] {
+		return
+	}
+	s.seen[url] = true
+	s.jobs <- url
+}
+
+// Wait stops accepting URLs, waits for the queued downloads to finish, and
+// returns an error if any of them failed.
+func (s *Stream) Wait() error {
+	log := logger.Logger()
+
+	close(s.jobs)
+	s.wg.Wait()
+	if failed := s.failed.Load(); failed > 0 {
+		return fmt.Errorf("%d of %d streamed downloads failed", failed, len(s.seen))
+	}
+	log.Infof("streamed %d packages to %s", s.fetched.Load(), s.destDir)
+	return nil
+}
@@ -9,11 +9,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/network"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 )
 
 type roundTripFunc func(*http.Request) (*http.Response, error)
@@ -114,6 +118,53 @@ func TestFetchPackages_EmptyURLs(t *testing.T) {
 	}
 }
 
+// TestEffectiveWorkers tests that the worker count is clamped to at least one
+// and at most maxWorkersPerCPU workers per CPU
+func TestEffectiveWorkers(t *testing.T) {
+	originalNumCPU := numCPU
+	defer func() { numCPU = originalNumCPU }()
+	numCPU = func() int { return 4 }
+
+	tests := []struct {
+		name      string
+		requested int
+		expected  int
+	}{
+		{name: "zero", requested: 0, expected: 1},
+		{name: "negative", requested: -5, expected: 1},
+		{name: "reasonable", requested: 8, expected: 8},
+		{name: "at limit", requested: 32, expected: 32},
+		{name: "huge", requested: 1000000, expected: 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EffectiveWorkers(tt.requested); got != tt.expected {
+				t.Errorf("EffectiveWorkers(%d) = %d, expected %d", tt.requested, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestFetchPackages_ZeroWorkers tests that downloads still run with a worker
+// count below one
+func TestFetchPackages_ZeroWorkers(t *testing.T) {
+	tempDir := t.TempDir()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("mock package content"))
+	}))
+	defer server.Close()
+
+	if err := FetchPackages([]string{server.URL + "/package.rpm"}, tempDir, 0); err != nil {
+		t.Fatalf("FetchPackages failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "package.rpm")); err != nil {
+		t.Errorf("Expected package.rpm to be downloaded: %v", err)
+	}
+}
+
 // TestFetchPackages_HTTPErrors tests handling of HTTP errors
 func TestFetchPackages_HTTPErrors(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "pkgfetcher_test")
@@ -494,6 +545,46 @@ func TestDownloadWithRetry_TransientThenSuccess(t *testing.T) {
 	}
 }
 
+func TestDownloadWithRetry_StopsAtBuildDeadline(t *testing.T) {
+	origDeadline := shell.BuildDeadline
+	defer func() { shell.BuildDeadline = origDeadline }()
+
+	var requestCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "slow.rpm")
+	client := network.GetSecureHTTPClient()
+
+	shell.BuildDeadline = time.Now().Add(200 * time.Millisecond)
+	start := time.Now()
+	err := downloadWithRetry(client, server.URL+"/slow.rpm", destPath, 0)
+	if !errors.Is(err, shell.ErrBuildDeadline) {
+		t.Fatalf("expected a build deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("download stopped %s after it started, expected it to stop at the deadline", elapsed)
+	}
+	if got := atomic.LoadInt32(&requestCount); got != 1 {
+		t.Errorf("expected 1 request before the deadline, got %d", got)
+	}
+
+	// Nothing is requested once the deadline passed
+	err = downloadWithRetry(client, server.URL+"/slow.rpm", destPath, 0)
+	if !errors.Is(err, shell.ErrBuildDeadline) {
+		t.Fatalf("expected a build deadline error after the deadline, got %v", err)
+	}
+	if got := atomic.LoadInt32(&requestCount); got != 1 {
+		t.Errorf("expected no request after the deadline, got %d in total", got)
+	}
+}
+
 func TestDownloadWithRetry_EmptyBodyFailsAfterRetries(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "pkgfetcher_test")
 	if err != nil {
@@ -664,3 +755,144 @@ func TestFetchPackages_PlusEncodedAsPercentTwoBInURL(t *testing.T) {
 		t.Fatalf("unexpected file content: %q", string(content))
 	}
 }
+
+func TestFetchPackages_RepoMirrorRewritesMetadataAndPackageURLs(t *testing.T) {
+	var requested []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	originalGlobal := config.Global()
+	defer config.SetGlobal(originalGlobal)
+	g := config.DefaultGlobalConfig()
+	g.RepoMirrors = []config.RepoMirror{
+		{Prefix: "https://mirror.elxr.dev/", Replace: server.URL + "/elxr-mirror/"},
+	}
+	if err := g.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	config.SetGlobal(g)
+
+	// The Packages index and the package URL resolved from it both come
+	// from the upstream repository and must end up on the mirror.
+	repoBase := "https://mirror.elxr.dev/elxr"
+	packagesURL := repoBase + "/dists/aria/main/binary-amd64/Packages.gz"
+	packageURL := ospackage.ResolveURL(repoBase, "pool/main/c/curl/curl_8.14.1-2_amd64.deb")
+
+	destDir := t.TempDir()
+	if err := FetchPackages([]string{packagesURL, packageURL}, destDir, 1); err != nil {
+		t.Fatalf("FetchPackages failed: %v", err)
+	}
+
+	want := map[string]bool{
+		"/elxr-mirror/elxr/dists/aria/main/binary-amd64/Packages.gz": true,
+		"/elxr-mirror/elxr/pool/main/c/curl/curl_8.14.1-2_amd64.deb": true,
+	}
+	if len(requested) != len(want) {
+		t.Fatalf("expected %d requests to the mirror, got %v", len(want), requested)
+	}
+	for _, path := range requested {
+		if !want[path] {
+			t.Errorf("unexpected mirror request %s, want one of %v", path, want)
+		}
+	}
+
+	// The downloaded files keep their upstream names
+	for _, name := range []string{"Packages.gz", "curl_8.14.1-2_amd64.deb"} {
+		if _, err := os.Stat(filepath.Join(destDir, name)); err != nil {
+			t.Errorf("expected %s to be downloaded: %v", name, err)
+		}
+	}
+}
+
+func TestStream_DownloadsWhileURLsAreAdded(t *testing.T) {
+	requested := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- r.URL.Path
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	destDir := t.TempDir()
+	stream := NewStream(destDir, 2)
+
+	// The first download starts before any more URLs are produced
+	stream.Add(server.URL + "/first.rpm")
+	select {
+	case got := <-requested:
+		if got != "/first.rpm" {
+			t.Errorf("expected /first.rpm to be requested, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the download to start before Wait")
+	}
+
+	stream.Add(server.URL + "/second.rpm")
+	stream.Add(server.URL + "/first.rpm") // duplicate
+	if err := stream.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	close(requested)
+	if len(requested) != 1 {
+		t.Errorf("expected a single further download, got %d", len(requested))
+	}
+	for _, name := range []string{"first.rpm", "second.rpm"} {
+		if content, err := os.ReadFile(filepath.Join(destDir, name)); err != nil || string(content) != "content of /"+name {
+			t.Errorf("expected %s to be downloaded, got %q, %v", name, content, err)
+		}
+	}
+}
+
+func TestStream_Backpressure(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	origNumCPU := numCPU
+	numCPU = func() int { return 1 }
+	defer func() { numCPU = origNumCPU }()
+
+	stream := NewStream(t.TempDir(), 1)
+	var added atomic.Int32
+	go func() {
+		for i := 0; i < 10; i++ {
+			stream.Add(fmt.Sprintf("%s/pkg%d.rpm", server.URL, i))
+			added.Add(1)
+		}
+	}()
+
+	// One download in flight and a queue of two: the producer must block
+	time.Sleep(200 * time.Millisecond)
+	if n := added.Load(); n > 4 {
+		t.Errorf("expected Add to block while the queue is full, %d URLs were added", n)
+	}
+	close(release)
+	for added.Load() < 10 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := stream.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+}
+
+func TestStream_ReportsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	stream := NewStream(t.TempDir(), 1)
+	stream.Add(server.URL + "/missing.rpm")
+	err := stream.Wait()
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 streamed downloads failed") {
+		t.Errorf("expected a failed download to be reported, got: %v", err)
+	}
+}
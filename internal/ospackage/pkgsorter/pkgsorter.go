@@ -106,11 +106,7 @@ func SortPackages(packages []ospackage.PackageInfo) ([]ospackage.PackageInfo, er
 
 	var sortedPackages []ospackage.PackageInfo
 	for _, sccID := range sortedSccIndices {
-		scc := sccs[sccID]
-		// The order within a cycle doesn't matter, so we sort alphabetically
-		// for a deterministic result.
-		sort.Strings(scc)
-		for _, pkgName := range scc {
+		for _, pkgName := range orderCycle(sccs[sccID], packageMap) {
 			sortedPackages = append(sortedPackages, packageMap[pkgName])
 		}
 	}
@@ -130,6 +126,46 @@ func SortPackages(packages []ospackage.PackageInfo) ([]ospackage.PackageInfo, er
 	return sortedPackages, nil
 }
 
+// orderCycle returns the packages of the cycle scc in install order. Plain
+// dependencies cannot all be installed first within a cycle, but
+// pre-dependencies must be, so packages come after their pre-dependencies in
+// the cycle and are otherwise sorted alphabetically for a deterministic
+// result. A cycle of pre-dependencies, which Debian policy forbids, is broken
+// alphabetically.
+func orderCycle(scc []string, packageMap map[string]ospackage.PackageInfo) []string {
+	remaining := make(map[string]int, len(scc)) // pre-dependencies in the cycle not yet ordered
+	dependents := make(map[string][]string, len(scc))
+	for _, name := range scc {
+		remaining[name] = 0
+	}
+	for _, name := range scc {
+		for _, preDep := range packageMap[name].PreDepends {
+			if _, inCycle := remaining[preDep]; inCycle && preDep != name && !slices.Contains(dependents[preDep], name) {
+				dependents[preDep] = append(dependents[preDep], name)
+				remaining[name]++
+			}
+		}
+	}
+
+	pending := slices.Clone(scc)
+	sort.Strings(pending)
+	ordered := make([]string, 0, len(scc))
+	for len(pending) > 0 {
+		next := slices.IndexFunc(pending, func(name string) bool { return remaining[name] == 0 })
+		if next == -1 {
+			logger.Logger().Warnf("Pre-dependency cycle between packages %v, installing them alphabetically", pending)
+			return append(ordered, pending...)
+		}
+		name := pending[next]
+		pending = slices.Delete(pending, next, next+1)
+		ordered = append(ordered, name)
+		for _, dependent := range dependents[name] {
+			remaining[dependent]--
+		}
+	}
+	return ordered
+}
+
 // Tarjan's Algorithm for finding SCCs ---
 type tarjan struct {
 	adj       map[string][]string
@@ -62,6 +62,28 @@ func TestSortPackages(t *testing.T) {
 			wantErr:       false, // The SCC sorter should NOT error on cycles.
 			isOrderStrict: true,
 		},
+		{
+			name: "Pre-Dependency Within Cycle",
+			input: []ospackage.PackageInfo{
+				{Name: "A", Requires: []string{"Z"}, PreDepends: []string{"Z"}},
+				{Name: "Z", Requires: []string{"A"}},
+			},
+			// Alphabetical within the cycle, except that a pre-dependency comes first.
+			want:          []string{"Z", "A"},
+			wantErr:       false,
+			isOrderStrict: true,
+		},
+		{
+			name: "Pre-Dependency Cycle",
+			input: []ospackage.PackageInfo{
+				{Name: "B", Requires: []string{"A"}, PreDepends: []string{"A"}},
+				{Name: "A", Requires: []string{"B"}, PreDepends: []string{"B"}},
+			},
+			// Debian policy forbids such a cycle; it is broken alphabetically.
+			want:          []string{"A", "B"},
+			wantErr:       false,
+			isOrderStrict: true,
+		},
 		{
 			name: "Multi-Package Cycle",
 			input: []ospackage.PackageInfo{
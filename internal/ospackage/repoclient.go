@@ -0,0 +1,19 @@
+package ospackage
+
+// RepositoryClient reads the package index of a single package repository.
+// rpmutils and debutils provide the rpm and deb implementations, so
+// features that apply to every repository type (metadata caching, signature
+// checks, mirrors) can be built once against this interface.
+type RepositoryClient interface {
+	// FetchMetadata downloads the repository index and, where the repository
+	// is configured for it, verifies it.
+	FetchMetadata() error
+
+	// ListPackages returns the packages in the repository index, fetching
+	// the metadata first if FetchMetadata has not been called.
+	ListPackages() ([]PackageInfo, error)
+
+	// ResolveURL returns the download URL of a path relative to the
+	// repository root.
+	ResolveURL(relPath string) string
+}
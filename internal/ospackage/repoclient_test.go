@@ -0,0 +1,415 @@
+package ospackage_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/debutils"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/pkgfetcher"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/rpmutils"
+)
+
+var (
+	_ ospackage.RepositoryClient = (*rpmutils.RepoClient)(nil)
+	_ ospackage.RepositoryClient = (*debutils.RepoClient)(nil)
+)
+
+func gzipBytes(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatalf("failed to gzip content: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// serveFiles starts a server returning files by request path.
+func serveFiles(t *testing.T, files map[string][]byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// rpmRepoFiles returns a synthetic rpm repository holding a single bash
+// package, keyed by path within the repository.
+func rpmRepoFiles(t *testing.T) map[string][]byte {
+	t.Helper()
+	primary := `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="1">
+<package type="rpm">
+  <name>bash</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="5.2" rel="1"/>
+  <size package="1024"/>
+  <location href="pool/bash_5.2-1_x86_64.pkg"/>
+</package>
+</metadata>`
+	repomd := `<?xml version="1.0" encoding="UTF-8"?>
+<repomd xmlns="http://linux.duke.edu/metadata/repo">
+  <revision>1700000000</revision>
+  <data type="primary"><location href="repodata/primary.xml.gz"/></data>
+</repomd>`
+	return map[string][]byte{
+		"/repodata/repomd.xml":        []byte(repomd),
+		"/repodata/primary.xml.gz":    gzipBytes(t, primary),
+		"/pool/bash_5.2-1_x86_64.pkg": []byte("bash package"),
+	}
+}
+
+// newRPMRepo serves a synthetic rpm repository holding a single bash package.
+func newRPMRepo(t *testing.T) *httptest.Server {
+	t.Helper()
+	return serveFiles(t, rpmRepoFiles(t))
+}
+
+// debRepoFiles returns a synthetic deb repository holding a single bash
+// package, keyed by path within the repository.
+func debRepoFiles(t *testing.T) map[string][]byte {
+	t.Helper()
+	packagesGz := gzipBytes(t, `Package: bash
+Version: 5.2-1
+Architecture: x86_64
+Size: 1024
+Filename: pool/bash_5.2-1_x86_64.pkg
+Description: GNU Bourne Again SHell
+
+`)
+	sum := sha256.Sum256(packagesGz)
+	release := fmt.Sprintf("Origin: test\nDate: Tue, 14 Nov 2023 22:13:20 UTC\nSHA256:\n %s %d main/binary-x86_64/Packages.gz\n",
+		hex.EncodeToString(sum[:]), len(packagesGz))
+	return map[string][]byte{
+		"/dists/test/main/binary-x86_64/Packages.gz": packagesGz,
+		"/dists/test/Release":                        []byte(release),
+		"/pool/bash_5.2-1_x86_64.pkg":                []byte("bash package"),
+	}
+}
+
+// debRepoConfig returns the client configuration of the trusted deb
+// repository at baseURL.
+func debRepoConfig(t *testing.T, baseURL string) debutils.RepoConfig {
+	t.Helper()
+	return debutils.RepoConfig{
+		Name:        "test",
+		PkgList:     baseURL + "/dists/test/main/binary-x86_64/Packages.gz",
+		PkgPrefix:   baseURL,
+		ReleaseFile: baseURL + "/dists/test/Release",
+		ReleaseSign: baseURL + "/dists/test/Release.gpg",
+		PbGPGKey:    "[trusted=yes]",
+		BuildPath:   t.TempDir(),
+		Arch:        "x86_64",
+	}
+}
+
+// newDebRepo serves a synthetic trusted deb repository holding a single bash
+// package, and returns the client configuration for it.
+func newDebRepo(t *testing.T) (*httptest.Server, debutils.RepoConfig) {
+	t.Helper()
+	server := serveFiles(t, debRepoFiles(t))
+	return server, debRepoConfig(t, server.URL)
+}
+
+// writeRepoDir lays files out in a temporary directory, as on a mounted ISO.
+func writeRepoDir(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+	return dir
+}
+
+// packageSummary keeps the PackageInfo fields both backends fill from their
+// indexes, with the rpm epoch stripped so versions use the same form.
+func packageSummary(pkg ospackage.PackageInfo) string {
+	name := pkg.PkgName
+	if name == "" {
+		name = pkg.Name
+	}
+	return fmt.Sprintf("name=%s version=%s arch=%s size=%d url=%s",
+		name, strings.TrimPrefix(pkg.Version, "0:"), pkg.Arch, pkg.Size, pkg.URL)
+}
+
+func TestRepositoryClientsReturnEquivalentPackages(t *testing.T) {
+	rpmServer := newRPMRepo(t)
+	debServer, debCfg := newDebRepo(t)
+
+	clients := map[string]ospackage.RepositoryClient{
+		"rpm": rpmutils.NewRepoClient(rpmutils.RepoConfig{URL: rpmServer.URL}),
+		"deb": debutils.NewRepoClient(debCfg),
+	}
+	servers := map[string]string{"rpm": rpmServer.URL, "deb": debServer.URL}
+
+	for backend, client := range clients {
+		t.Run(backend, func(t *testing.T) {
+			if err := client.FetchMetadata(); err != nil {
+				t.Fatalf("FetchMetadata failed: %v", err)
+			}
+			pkgs, err := client.ListPackages()
+			if err != nil {
+				t.Fatalf("ListPackages failed: %v", err)
+			}
+			if len(pkgs) != 1 {
+				t.Fatalf("expected 1 package, got %d", len(pkgs))
+			}
+
+			wantURL := servers[backend] + "/pool/bash_5.2-1_x86_64.pkg"
+			want := fmt.Sprintf("name=bash version=5.2-1 arch=x86_64 size=1024 url=%s", wantURL)
+			if got := packageSummary(pkgs[0]); got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+			if got := client.ResolveURL("pool/bash_5.2-1_x86_64.pkg"); got != wantURL {
+				t.Errorf("expected resolved URL %q, got %q", wantURL, got)
+			}
+		})
+	}
+}
+
+func TestRepositoryClientsListWithoutExplicitFetch(t *testing.T) {
+	rpmServer := newRPMRepo(t)
+	_, debCfg := newDebRepo(t)
+
+	clients := map[string]ospackage.RepositoryClient{
+		"rpm": rpmutils.NewRepoClient(rpmutils.RepoConfig{URL: rpmServer.URL}),
+		"deb": debutils.NewRepoClient(debCfg),
+	}
+	for backend, client := range clients {
+		t.Run(backend, func(t *testing.T) {
+			pkgs, err := client.ListPackages()
+			if err != nil {
+				t.Fatalf("ListPackages failed: %v", err)
+			}
+			if len(pkgs) != 1 {
+				t.Fatalf("expected 1 package, got %d", len(pkgs))
+			}
+		})
+	}
+}
+
+func TestRepositoryClientsFetchMetadataErrors(t *testing.T) {
+	server := serveFiles(t, map[string][]byte{})
+	clients := map[string]ospackage.RepositoryClient{
+		"rpm": rpmutils.NewRepoClient(rpmutils.RepoConfig{URL: server.URL}),
+		"deb": debutils.NewRepoClient(debutils.RepoConfig{
+			PkgList:     server.URL + "/dists/test/main/binary-x86_64/Packages.gz",
+			PkgPrefix:   server.URL,
+			ReleaseFile: server.URL + "/dists/test/Release",
+			PbGPGKey:    "[trusted=yes]",
+			BuildPath:   t.TempDir(),
+			Arch:        "x86_64",
+		}),
+	}
+	for backend, client := range clients {
+		t.Run(backend, func(t *testing.T) {
+			if err := client.FetchMetadata(); err == nil {
+				t.Error("expected error for a repository without metadata")
+			}
+		})
+	}
+}
+
+// TestRepoClientResolveURL checks that both backends resolve absolute,
+// protocol-relative and repo-relative locations the same way.
+func TestRepoClientResolveURL(t *testing.T) {
+	const base = "http://repo.example.com/base/"
+	clients := map[string]ospackage.RepositoryClient{
+		"rpm": rpmutils.NewRepoClient(rpmutils.RepoConfig{URL: base}),
+		"deb": debutils.NewRepoClient(debutils.RepoConfig{PkgPrefix: base}),
+	}
+	tests := []struct {
+		name     string
+		ref      string
+		expected string
+	}{
+		{"relative", "pool/main/a.pkg", "http://repo.example.com/base/pool/main/a.pkg"},
+		{"relative with leading slash", "/pool/main/a.pkg", "http://repo.example.com/base/pool/main/a.pkg"},
+		{"absolute http", "http://mirror.example.com/a.pkg", "http://mirror.example.com/a.pkg"},
+		{"absolute https", "https://mirror.example.com/a.pkg", "https://mirror.example.com/a.pkg"},
+		{"absolute file", "file:///srv/repo/a.pkg", "file:///srv/repo/a.pkg"},
+		{"protocol-relative", "//cdn.example.com/a.pkg", "http://cdn.example.com/a.pkg"},
+	}
+	for backend, client := range clients {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				if got := client.ResolveURL(tt.ref); got != tt.expected {
+					t.Errorf("ResolveURL(%q) = %q, want %q", tt.ref, got, tt.expected)
+				}
+			})
+		}
+	}
+
+	if got := ospackage.ResolveURL("", "//cdn.example.com/a.pkg"); got != "https://cdn.example.com/a.pkg" {
+		t.Errorf("expected protocol-relative URL without base scheme to default to https, got %q", got)
+	}
+}
+
+// servedSHA256 returns the sha256 of the file served at url.
+func servedSHA256(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		t.Fatalf("failed to read %s: %v", url, err)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestRepositoryClientsSnapshotPin(t *testing.T) {
+	rpmServer := newRPMRepo(t)
+	_, debCfg := newDebRepo(t)
+	rpmChecksum := servedSHA256(t, rpmServer.URL+"/repodata/repomd.xml")
+	debChecksum := servedSHA256(t, debCfg.ReleaseFile)
+
+	newClients := func(rpmPin, debPin ospackage.SnapshotPin) map[string]ospackage.RepositoryClient {
+		cfg := debCfg
+		cfg.Snapshot = debPin
+		cfg.BuildPath = t.TempDir()
+		return map[string]ospackage.RepositoryClient{
+			"rpm": rpmutils.NewRepoClient(rpmutils.RepoConfig{URL: rpmServer.URL, Snapshot: rpmPin}),
+			"deb": debutils.NewRepoClient(cfg),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		rpmPin      ospackage.SnapshotPin
+		debPin      ospackage.SnapshotPin
+		expectedErr string
+	}{
+		{
+			name:   "revision matches",
+			rpmPin: ospackage.SnapshotPin{Revision: "1700000000"},
+			debPin: ospackage.SnapshotPin{Revision: "Tue, 14 Nov 2023 22:13:20 UTC"},
+		},
+		{
+			name:   "checksum matches",
+			rpmPin: ospackage.SnapshotPin{Checksum: rpmChecksum},
+			debPin: ospackage.SnapshotPin{Checksum: "sha256:" + debChecksum},
+		},
+		{
+			name:        "revision moved",
+			rpmPin:      ospackage.SnapshotPin{Revision: "1690000000"},
+			debPin:      ospackage.SnapshotPin{Revision: "Mon, 24 Jul 2023 04:26:40 UTC"},
+			expectedErr: "repo snapshot mismatch",
+		},
+		{
+			name:        "checksum moved",
+			rpmPin:      ospackage.SnapshotPin{Revision: "1700000000", Checksum: strings.Repeat("0", 64)},
+			debPin:      ospackage.SnapshotPin{Checksum: strings.Repeat("0", 64)},
+			expectedErr: "repo snapshot mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		for backend, client := range newClients(tt.rpmPin, tt.debPin) {
+			t.Run(tt.name+"/"+backend, func(t *testing.T) {
+				err := client.FetchMetadata()
+				if tt.expectedErr == "" {
+					if err != nil {
+						t.Fatalf("FetchMetadata failed: %v", err)
+					}
+					return
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedErr, err)
+				}
+			})
+		}
+	}
+}
+
+func TestLocalRepoURL(t *testing.T) {
+	tests := []struct {
+		location string
+		expected string
+	}{
+		{"/mnt/iso/BaseOS", "file:///mnt/iso/BaseOS"},
+		{"/mnt/iso/BaseOS/", "file:///mnt/iso/BaseOS"},
+		{"/mnt/iso/{arch}", "file:///mnt/iso/{arch}"},
+		{"file:///mnt/iso", "file:///mnt/iso"},
+		{"https://repo.example.com/base", "https://repo.example.com/base"},
+		{"//cdn.example.com/base", "//cdn.example.com/base"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ospackage.LocalRepoURL(tt.location); got != tt.expected {
+			t.Errorf("LocalRepoURL(%q) = %q, want %q", tt.location, got, tt.expected)
+		}
+	}
+}
+
+// TestRepositoryClientsLocalDirectory checks that both backends read metadata
+// and packages from a repository directory without any server.
+func TestRepositoryClientsLocalDirectory(t *testing.T) {
+	rpmDir := writeRepoDir(t, rpmRepoFiles(t))
+	debDir := writeRepoDir(t, debRepoFiles(t))
+
+	tests := []struct {
+		name   string
+		dir    string
+		client ospackage.RepositoryClient
+	}{
+		{"rpm local path", rpmDir, rpmutils.NewRepoClient(rpmutils.RepoConfig{URL: rpmDir})},
+		{"rpm file URL", rpmDir, rpmutils.NewRepoClient(rpmutils.RepoConfig{URL: "file://" + rpmDir})},
+		{"deb file URL", debDir, debutils.NewRepoClient(debRepoConfig(t, ospackage.LocalRepoURL(debDir)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.client.FetchMetadata(); err != nil {
+				t.Fatalf("FetchMetadata failed: %v", err)
+			}
+			pkgs, err := tt.client.ListPackages()
+			if err != nil {
+				t.Fatalf("ListPackages failed: %v", err)
+			}
+			if len(pkgs) != 1 {
+				t.Fatalf("expected 1 package, got %d", len(pkgs))
+			}
+			wantURL := "file://" + tt.dir + "/pool/bash_5.2-1_x86_64.pkg"
+			if pkgs[0].URL != wantURL {
+				t.Fatalf("expected package URL %q, got %q", wantURL, pkgs[0].URL)
+			}
+
+			destDir := t.TempDir()
+			if err := pkgfetcher.FetchPackages([]string{pkgs[0].URL}, destDir, 1); err != nil {
+				t.Fatalf("FetchPackages failed: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(destDir, "bash_5.2-1_x86_64.pkg"))
+			if err != nil || string(data) != "bash package" {
+				t.Errorf("expected package to be copied from disk, got %q, %v", data, err)
+			}
+		})
+	}
+}
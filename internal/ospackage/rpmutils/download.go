@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -32,6 +33,7 @@ type RepoConfig struct {
 	RepoGPGCheck bool
 	Enabled      bool
 	GPGKey       string
+	Snapshot     ospackage.SnapshotPin // expected repomd.xml snapshot, unchecked when empty
 }
 
 var (
@@ -45,7 +47,8 @@ func Packages() ([]ospackage.PackageInfo, error) {
 	log := logger.Logger()
 	log.Infof("fetching packages from %s", RepoCfg.URL)
 
-	packages, err := ParseRepositoryMetadata(RepoCfg.URL, GzHref, nil)
+	client := &RepoClient{cfg: RepoCfg, primaryHref: GzHref}
+	packages, err := client.ListPackages()
 	if err != nil {
 		log.Errorf("parsing primary.xml.gz failed: %v", err)
 		return nil, err
@@ -124,6 +127,10 @@ func UserPackages() ([]ospackage.PackageInfo, error) {
 	log := logger.Logger()
 	log.Infof("fetching packages from %s", "user package list")
 
+	if err := config.CheckDuplicateRepositories(UserRepo); err != nil {
+		return nil, fmt.Errorf("invalid package repositories: %w", err)
+	}
+
 	repoList := make([]struct {
 		id            string
 		codename      string
@@ -132,6 +139,7 @@ func UserPackages() ([]ospackage.PackageInfo, error) {
 		pkey          string
 		pkeys         []string
 		allowPackages []string
+		snapshot      ospackage.SnapshotPin
 	}, 0, len(UserRepo))
 	for i, repo := range UserRepo {
 		if repo.URL == "" || repo.URL == "<URL>" {
@@ -146,14 +154,16 @@ func UserPackages() ([]ospackage.PackageInfo, error) {
 			pkey          string
 			pkeys         []string
 			allowPackages []string
+			snapshot      ospackage.SnapshotPin
 		}{
 			id:            fmt.Sprintf("rpmcustrepo%d", i+1),
 			codename:      repo.Codename,
-			url:           repo.URL,
+			url:           ospackage.LocalRepoURL(repo.URL),
 			path:          repo.Path,
 			pkey:          repo.PKey,
 			pkeys:         repo.PKeys,
 			allowPackages: repo.AllowPackages,
+			snapshot:      repo.SnapshotPin(),
 		})
 	}
 
@@ -186,6 +196,7 @@ func UserPackages() ([]ospackage.PackageInfo, error) {
 				URL:          baseURL,
 				Path:         path,
 				Section:      fmt.Sprintf("[%s]", codename),
+				Snapshot:     repoItem.snapshot,
 			},
 			AllowPackages: allowPackages,
 		}
@@ -202,7 +213,7 @@ func UserPackages() ([]ospackage.PackageInfo, error) {
 			continue
 		}
 
-		primaryXmlURL, err := FetchPrimaryURL(repoMetaDataURL)
+		primaryXmlURL, err := FetchPinnedPrimaryURL(repoMetaDataURL, rpItx.Snapshot)
 		if err != nil {
 			return nil, fmt.Errorf("fetching %s URL failed: %w", repoMetaDataURL, err)
 		}
@@ -282,9 +293,11 @@ func convertBinaryGPGToAscii(binaryData []byte) ([]byte, error) {
 	}
 
 	return armoredBuf.Bytes(), nil
-} // createTempGPGKeyFiles downloads multiple GPG keys from URLs and creates temporary files.
+}
+
+// CreateTempGPGKeyFiles downloads multiple GPG keys from URLs and creates temporary files.
 // Returns the file paths and a cleanup function. The caller is responsible for calling cleanup.
-func createTempGPGKeyFiles(gpgKeyURLs []string) (keyPaths []string, cleanup func(), err error) {
+func CreateTempGPGKeyFiles(gpgKeyURLs []string) (keyPaths []string, cleanup func(), err error) {
 	log := logger.Logger()
 
 	if len(gpgKeyURLs) == 0 {
@@ -307,7 +320,7 @@ func createTempGPGKeyFiles(gpgKeyURLs []string) (keyPaths []string, cleanup func
 		// Check if the GPG key URL is a binary file (ends with .gpg or .bin)
 		isBinary := strings.HasSuffix(strings.ToLower(gpgKeyURL), ".gpg") || strings.HasSuffix(strings.ToLower(gpgKeyURL), ".bin")
 
-		resp, err := client.Get(gpgKeyURL)
+		resp, err := client.Get(config.RewriteRepoURL(gpgKeyURL))
 		if err != nil {
 			// Cleanup any files created so far
 			for _, f := range tempFiles {
@@ -316,6 +329,14 @@ func createTempGPGKeyFiles(gpgKeyURLs []string) (keyPaths []string, cleanup func
 			}
 			return nil, nil, fmt.Errorf("fetch GPG key %s: %w", gpgKeyURL, err)
 		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			for _, f := range tempFiles {
+				f.Close()
+				os.Remove(f.Name())
+			}
+			return nil, nil, fmt.Errorf("fetch GPG key %s: HTTP status %d", gpgKeyURL, resp.StatusCode)
+		}
 
 		keyBytes, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
@@ -479,7 +500,7 @@ func Validate(destDir string) error {
 	}
 
 	// Create temporary GPG key files
-	gpgKeyPaths, cleanup, err := createTempGPGKeyFiles(gpgKeyURLs)
+	gpgKeyPaths, cleanup, err := CreateTempGPGKeyFiles(gpgKeyURLs)
 	if err != nil {
 		return fmt.Errorf("failed to create temp GPG key files: %w", err)
 	}
@@ -507,6 +528,37 @@ func Validate(destDir string) error {
 	return nil
 }
 
+// ImageGPGKeyURLs returns the GPG key URLs of the repositories with gpgcheck
+// enabled that the image packages are installed from: those of RepoCfg when
+// its GPGCheck is set, and those of the remote UserRepo repositories. Keys
+// marked [trusted=yes] or left as placeholders are skipped, and each URL is
+// returned once.
+func ImageGPGKeyURLs() []string {
+	var candidates []string
+	if RepoCfg.GPGCheck {
+		candidates = append(candidates, splitGPGKeyURLs(RepoCfg.GPGKey)...)
+	}
+	for _, userRepo := range UserRepo {
+		if userRepo.Path != "" {
+			continue
+		}
+		candidates = append(candidates, splitGPGKeyURLs(userRepo.PKey)...)
+		candidates = append(candidates, userRepo.PKeys...)
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for _, url := range candidates {
+		url = strings.TrimSpace(url)
+		if url == "" || url == "<PUBLIC_KEY_URL>" || url == "[trusted=yes]" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		urls = append(urls, url)
+	}
+	return urls
+}
+
 func splitGPGKeyURLs(value string) []string {
 	parts := strings.FieldsFunc(value, func(r rune) bool {
 		return r == ',' || r == '\n' || r == '\r'
@@ -523,13 +575,33 @@ func splitGPGKeyURLs(value string) []string {
 	return urls
 }
 
+// checkKernelPackages rejects kernel packages of pkgList missing from the
+// repository listing all up front, as the image would otherwise boot a
+// different kernel than the one requested.
+func checkKernelPackages(pkgList []string, pkgSources map[string]config.PackageSource, all []ospackage.PackageInfo) error {
+	kernelPkgs := config.PackagesFromSource(pkgList, pkgSources, config.PackageSourceKernel)
+	if len(kernelPkgs) == 0 {
+		return nil
+	}
+	if _, err := MatchRequested(kernelPkgs, all); err != nil {
+		return fmt.Errorf("kernel package not available in the configured repositories: %w", err)
+	}
+	return nil
+}
+
 func Resolve(req []ospackage.PackageInfo, all []ospackage.PackageInfo) ([]ospackage.PackageInfo, error) {
+	return resolve(req, all, nil)
+}
+
+// resolve implements Resolve, calling onResolved, if not nil, with each
+// package as soon as it joins the resolution.
+func resolve(req []ospackage.PackageInfo, all []ospackage.PackageInfo, onResolved func(ospackage.PackageInfo)) ([]ospackage.PackageInfo, error) {
 	log := logger.Logger()
 
 	log.Infof("resolving dependencies for %d RPMs", len(req))
 
 	// Resolve all the required dependencies for the initial seed of RPMs
-	needed, err := ResolveDependencies(req, all)
+	needed, _, err := resolveDependencyGraph(req, all, onResolved)
 	if err != nil {
 		log.Errorf("resolving dependencies failed: %v", err)
 		return nil, err
@@ -543,14 +615,42 @@ func Resolve(req []ospackage.PackageInfo, all []ospackage.PackageInfo) ([]ospack
 	return needed, nil
 }
 
+// resolveAndStream resolves the dependencies of req like Resolve. When
+// config.StreamDownloads is set, each package is downloaded to destDir as soon
+// as it is resolved, while the resolution continues.
+func resolveAndStream(req []ospackage.PackageInfo, all []ospackage.PackageInfo, destDir string) ([]ospackage.PackageInfo, error) {
+	if !config.StreamDownloads() {
+		needed, err := Resolve(req, all)
+		if err != nil {
+			return nil, fmt.Errorf("resolving packages: %v", err)
+		}
+		return needed, nil
+	}
+
+	logger.Logger().Infof("Downloading packages to %s while resolving dependencies", destDir)
+	stream := pkgfetcher.NewStream(destDir, config.Workers())
+	needed, err := resolve(req, all, func(pkg ospackage.PackageInfo) {
+		stream.Add(pkg.URL)
+	})
+	streamErr := stream.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("resolving packages: %v", err)
+	}
+	if streamErr != nil {
+		return nil, fmt.Errorf("fetch failed: %v", streamErr)
+	}
+	return needed, nil
+}
+
 // DownloadPackages downloads packages and returns the list of downloaded package names.
 func DownloadPackages(pkgList []string, destDir, dotFile string, pkgSources map[string]config.PackageSource, systemRootsOnly bool) ([]string, error) {
-	downloadedPkgs, _, err := DownloadPackagesComplete(pkgList, destDir, dotFile, pkgSources, systemRootsOnly)
+	downloadedPkgs, _, err := DownloadPackagesComplete(pkgList, destDir, dotFile, pkgSources, systemRootsOnly, nil)
 	return downloadedPkgs, err
 }
 
 // DownloadPackagesComplete downloads packages and returns both package names and full package info.
-func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSources map[string]config.PackageSource, systemRootsOnly bool) ([]string, []ospackage.PackageInfo, error) {
+func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSources map[string]config.PackageSource, systemRootsOnly bool,
+	spaceCheck ospackage.SpaceCheck) ([]string, []ospackage.PackageInfo, error) {
 	var downloadPkgList []string
 
 	log := logger.Logger()
@@ -590,6 +690,10 @@ func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSour
 		// If PkgName is not found or is at the beginning, keep the original Name
 	}
 
+	if err := checkKernelPackages(pkgList, pkgSources, all); err != nil {
+		return downloadPkgList, nil, err
+	}
+
 	// Match the packages in the template against all the packages
 	req, err := MatchRequested(pkgList, all)
 	if err != nil {
@@ -601,10 +705,20 @@ func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSour
 		log.Debugf("-> %s", pkg.Name)
 	}
 
-	// Resolve the dependencies of the requested packages
-	needed, err := Resolve(req, all)
+	// Ensure dest directory exists
+	absDestDir, err := filepath.Abs(destDir)
+	if err != nil {
+		return downloadPkgList, nil, fmt.Errorf("resolving cache directory: %v", err)
+	}
+	if err := os.MkdirAll(absDestDir, 0755); err != nil {
+		return downloadPkgList, nil, fmt.Errorf("creating cache directory %s: %v", absDestDir, err)
+	}
+
+	// Resolve the dependencies of the requested packages, downloading them
+	// meanwhile when streaming
+	needed, err := resolveAndStream(req, all, absDestDir)
 	if err != nil {
-		return downloadPkgList, nil, fmt.Errorf("resolving packages: %v", err)
+		return downloadPkgList, nil, err
 	}
 
 	sorted_pkgs, err := pkgsorter.SortPackages(needed)
@@ -631,16 +745,14 @@ func DownloadPackagesComplete(pkgList []string, destDir, dotFile string, pkgSour
 		downloadPkgList = append(downloadPkgList, path.Base(pkg.URL))
 	}
 
-	// Ensure dest directory exists
-	absDestDir, err := filepath.Abs(destDir)
-	if err != nil {
-		return downloadPkgList, nil, fmt.Errorf("resolving cache directory: %v", err)
-	}
-	if err := os.MkdirAll(absDestDir, 0755); err != nil {
-		return downloadPkgList, nil, fmt.Errorf("creating cache directory %s: %v", absDestDir, err)
+	if spaceCheck != nil {
+		if err := spaceCheck(sorted_pkgs, absDestDir); err != nil {
+			return downloadPkgList, nil, fmt.Errorf("disk space check failed: %w", err)
+		}
 	}
 
-	// Download packages using configured workers and cache directory
+	// Download packages using configured workers and cache directory; the
+	// packages streamed during resolution are already there and skipped
 	log.Infof("Downloading %d packages to %s using %d workers", len(urls), absDestDir, config.Workers())
 	if err := pkgfetcher.FetchPackages(urls, absDestDir, config.Workers()); err != nil {
 		return downloadPkgList, nil, fmt.Errorf("fetch failed: %v", err)
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -91,6 +92,15 @@ func TestUserPackages(t *testing.T) {
 			},
 			expectError: true, // Will fail due to network call
 		},
+		{
+			name: "duplicate user repositories",
+			userRepos: []config.PackageRepository{
+				{URL: "https://example.com/repo", Codename: "stable", PKey: "https://example.com/key.asc"},
+				{URL: "https://example.com/repo/", Codename: "stable", PKey: "https://example.com/other.asc"},
+			},
+			expectError: true,
+			errorMsg:    "are duplicates",
+		},
 		{
 			name: "local repository is handled elsewhere",
 			userRepos: []config.PackageRepository{
@@ -1169,7 +1179,7 @@ func TestDownloadPackagesComplete(t *testing.T) {
 			}
 			defer os.RemoveAll(tmpDir)
 
-			downloadList, packageInfos, err := rpmutils.DownloadPackagesComplete(tc.pkgList, tmpDir, "", nil, false)
+			downloadList, packageInfos, err := rpmutils.DownloadPackagesComplete(tc.pkgList, tmpDir, "", nil, false, nil)
 
 			if tc.expectError {
 				if err == nil {
@@ -1300,7 +1310,7 @@ func TestDownloadPackagesCompleteFunction(t *testing.T) {
 			}
 			defer os.RemoveAll(tmpDir)
 
-			downloadList, packageInfos, err := rpmutils.DownloadPackagesComplete(tc.pkgList, tmpDir, "", nil, false)
+			downloadList, packageInfos, err := rpmutils.DownloadPackagesComplete(tc.pkgList, tmpDir, "", nil, false, nil)
 
 			if tc.expectError {
 				if err == nil {
@@ -1510,3 +1520,33 @@ func TestUserRepoConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestImageGPGKeyURLs(t *testing.T) {
+	originalRepoCfg := rpmutils.RepoCfg
+	originalUserRepo := rpmutils.UserRepo
+	defer func() {
+		rpmutils.RepoCfg = originalRepoCfg
+		rpmutils.UserRepo = originalUserRepo
+	}()
+
+	rpmutils.UserRepo = []config.PackageRepository{
+		{URL: "https://vendor.example.com/rpm", PKey: "https://vendor.example.com/key.asc", PKeys: []string{"https://repo.example.com/b.asc"}},
+		{URL: "https://trusted.example.com/rpm", PKey: "[trusted=yes]"},
+		{Path: "/srv/local-repo", PKey: "https://local.example.com/key.asc"},
+	}
+
+	rpmutils.RepoCfg = rpmutils.RepoConfig{
+		GPGCheck: true,
+		GPGKey:   "https://repo.example.com/a.asc,https://repo.example.com/b.asc",
+	}
+	want := []string{"https://repo.example.com/a.asc", "https://repo.example.com/b.asc", "https://vendor.example.com/key.asc"}
+	if got := rpmutils.ImageGPGKeyURLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImageGPGKeyURLs() = %v, want %v", got, want)
+	}
+
+	rpmutils.RepoCfg.GPGCheck = false
+	want = []string{"https://vendor.example.com/key.asc", "https://repo.example.com/b.asc"}
+	if got := rpmutils.ImageGPGKeyURLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImageGPGKeyURLs() without gpgcheck on the provider repository = %v, want %v", got, want)
+	}
+}
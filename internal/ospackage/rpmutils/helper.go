@@ -49,7 +49,11 @@ func getRepositoryPriority(packageURL string) int {
 	return highestPriority
 }
 
-func selectByPriorityThenRepo(parentBase string, candidates []ospackage.PackageInfo) ospackage.PackageInfo {
+// filterHighestPriority returns the candidates from the repositories with the
+// highest priority among them, in their original order. As with dnf, packages
+// of lower priority repositories are not considered when a higher priority
+// repository provides the package, whatever their versions.
+func filterHighestPriority(candidates []ospackage.PackageInfo) []ospackage.PackageInfo {
 	highestPriority := -1
 	highestPriorityCandidates := make([]ospackage.PackageInfo, 0, len(candidates))
 
@@ -67,6 +71,12 @@ func selectByPriorityThenRepo(parentBase string, candidates []ospackage.PackageI
 		}
 	}
 
+	return highestPriorityCandidates
+}
+
+func selectByPriorityThenRepo(parentBase string, candidates []ospackage.PackageInfo) ospackage.PackageInfo {
+	highestPriorityCandidates := filterHighestPriority(candidates)
+
 	if len(highestPriorityCandidates) == 1 {
 		return highestPriorityCandidates[0]
 	}
@@ -452,6 +462,10 @@ func ResolveTopPackageConflicts(want string, all []ospackage.PackageInfo) (ospac
 		return candidates[0], true
 	}
 
+	// A higher priority repository overrides the others for the package,
+	// even when they have newer versions of it
+	candidates = filterHighestPriority(candidates)
+
 	// If multiple candidates, apply further filtering based on Dist
 	if Dist != "" {
 		// Filter candidates by release if any candidate matches Dist
@@ -0,0 +1,56 @@
+package rpmutils
+
+import (
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+)
+
+// repomdPath is the location of the repository index, relative to the repo root
+const repomdPath = "repodata/repomd.xml"
+
+// RepoClient is the rpm implementation of ospackage.RepositoryClient. The
+// metadata is the primary package list referenced by repodata/repomd.xml.
+type RepoClient struct {
+	cfg         RepoConfig
+	primaryHref string
+}
+
+var _ ospackage.RepositoryClient = (*RepoClient)(nil)
+
+// NewRepoClient returns a client for the repository at cfg.URL, which may
+// also be a local directory holding repodata/.
+func NewRepoClient(cfg RepoConfig) *RepoClient {
+	cfg.URL = ospackage.LocalRepoURL(cfg.URL)
+	return &RepoClient{cfg: cfg}
+}
+
+// FetchMetadata reads repomd.xml, checks it against the snapshot pin of the
+// repository and records the location of the primary package list.
+func (c *RepoClient) FetchMetadata() error {
+	href, err := FetchPinnedPrimaryURL(c.ResolveURL(repomdPath), c.cfg.Snapshot)
+	if err != nil {
+		return err
+	}
+	c.primaryHref = href
+	return nil
+}
+
+// PrimaryHref returns the location of the primary package list relative to
+// the repository root, or "" before the metadata has been fetched.
+func (c *RepoClient) PrimaryHref() string {
+	return c.primaryHref
+}
+
+// ListPackages parses the primary package list of the repository.
+func (c *RepoClient) ListPackages() ([]ospackage.PackageInfo, error) {
+	if c.primaryHref == "" {
+		if err := c.FetchMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return ParseRepositoryMetadata(c.cfg.URL, c.primaryHref, nil)
+}
+
+// ResolveURL returns the download URL of relPath within the repository.
+func (c *RepoClient) ResolveURL(relPath string) string {
+	return ospackage.ResolveURL(c.cfg.URL, relPath)
+}
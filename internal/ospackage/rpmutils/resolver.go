@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -52,7 +54,7 @@ func fetchURLWithRetry(client *http.Client, targetURL, resourceName string) ([]b
 	var lastErr error
 
 	for attempt := 1; attempt <= metadataMaxDownloadAttempts; attempt++ {
-		resp, err := client.Get(targetURL)
+		resp, err := client.Get(config.RewriteRepoURL(targetURL))
 		if err != nil {
 			lastErr = err
 		} else {
@@ -253,7 +255,7 @@ func matchesPackageFilter(pkgName string, filter []string) bool {
 func ParseRepositoryMetadata(baseURL, gzHref string, packageFilter []string) ([]ospackage.PackageInfo, error) {
 	log := logger.Logger()
 
-	fullURL := strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(gzHref, "/")
+	fullURL := ospackage.ResolveURL(baseURL, gzHref)
 	log.Infof("Fetching and parsing repository metadata from %s", fullURL)
 
 	// Create cache directory for XML files using same pattern as debutils
@@ -295,6 +297,9 @@ func ParseRepositoryMetadata(baseURL, gzHref string, packageFilter []string) ([]
 		err = fmt.Errorf("unsupported compression type %s", ext)
 	}
 
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("empty or truncated repository metadata %s: %w", fullURL, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -309,6 +314,10 @@ func ParseRepositoryMetadata(baseURL, gzHref string, packageFilter []string) ([]
 	var (
 		infos   []ospackage.PackageInfo
 		curInfo *ospackage.PackageInfo
+		// package entries seen, including those dropped by the filter, and the
+		// count declared by the <metadata packages="N"> attribute (-1 if absent)
+		parsedCount   int
+		declaredCount = -1
 	)
 
 	for {
@@ -316,15 +325,28 @@ func ParseRepositoryMetadata(baseURL, gzHref string, packageFilter []string) ([]
 		if err == io.EOF {
 			break
 		} else if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.Is(err, io.ErrUnexpectedEOF) || (errors.As(err, &syntaxErr) && strings.Contains(syntaxErr.Msg, "unexpected EOF")) {
+				return nil, fmt.Errorf("empty or truncated repository metadata %s: %w", fullURL, err)
+			}
 			return nil, err
 		}
 
 		switch elem := tok.(type) {
 		case xml.StartElement:
 			switch elem.Name.Local {
+			case "metadata":
+				for _, attr := range elem.Attr {
+					if attr.Name.Local == "packages" {
+						if n, convErr := strconv.Atoi(attr.Value); convErr == nil {
+							declaredCount = n
+						}
+					}
+				}
+
 			case "package":
 				// start a new PackageInfo
-				curInfo = &ospackage.PackageInfo{}
+				curInfo = &ospackage.PackageInfo{Repository: baseURL}
 				curInfo.Type = "rpm"
 
 			case "version":
@@ -357,11 +379,22 @@ func ParseRepositoryMetadata(baseURL, gzHref string, packageFilter []string) ([]
 					curInfo.Version = versionStr
 				}
 
+			case "size":
+				// <size package="..." installed="..." archive="..."/>
+				for _, a := range elem.Attr {
+					if a.Name.Local == "package" && curInfo != nil {
+						if size, err := strconv.ParseInt(a.Value, 10, 64); err == nil {
+							curInfo.Size = size
+						}
+						break
+					}
+				}
+
 			case "location":
 				// read the href and build full URL + infer Name (filename)
 				for _, a := range elem.Attr {
 					if a.Name.Local == "href" {
-						curInfo.URL = strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(a.Value, "/")
+						curInfo.URL = ospackage.ResolveURL(baseURL, a.Value)
 						curInfo.Name = path.Base(a.Value)
 						break
 					}
@@ -533,6 +566,7 @@ func ParseRepositoryMetadata(baseURL, gzHref string, packageFilter []string) ([]
 		case xml.EndElement:
 			switch elem.Name.Local {
 			case "package":
+				parsedCount++
 				if curInfo.Arch == "src" {
 					continue
 				}
@@ -551,12 +585,39 @@ func ParseRepositoryMetadata(baseURL, gzHref string, packageFilter []string) ([]
 		saveUncompressedXML(xmlCacheDir, gzHref, baseURL, xmlBuffer.Bytes())
 	}
 
+	if parsedCount == 0 {
+		log.Errorf("Repository metadata %s contains no package entries", fullURL)
+		return nil, fmt.Errorf("empty or truncated repository metadata %s: no package entries found", fullURL)
+	}
+	if declaredCount >= 0 && parsedCount != declaredCount {
+		log.Errorf("Repository metadata %s declares %d packages but contains %d", fullURL, declaredCount, parsedCount)
+		return nil, fmt.Errorf("empty or truncated repository metadata %s: declares %d packages but contains %d",
+			fullURL, declaredCount, parsedCount)
+	}
+
 	return infos, nil
 }
 
 // FetchPrimaryURL downloads repomd.xml and returns the href of the primary metadata.
 // It also saves the repomd.xml file to cache for debugging purposes.
 func FetchPrimaryURL(repomdURL string) (string, error) {
+	return FetchPinnedPrimaryURL(repomdURL, ospackage.SnapshotPin{})
+}
+
+// repomdRevision returns the <revision> of repomd.xml, or "" if it has none.
+func repomdRevision(repomdData []byte) string {
+	var repomd struct {
+		Revision string `xml:"revision"`
+	}
+	if err := xml.Unmarshal(repomdData, &repomd); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(repomd.Revision)
+}
+
+// FetchPinnedPrimaryURL is FetchPrimaryURL for a repository pinned to a
+// snapshot; it fails if the served repomd.xml does not match pin.
+func FetchPinnedPrimaryURL(repomdURL string, pin ospackage.SnapshotPin) (string, error) {
 	log := logger.Logger()
 
 	client := network.NewSecureHTTPClient()
@@ -583,6 +644,13 @@ func FetchPrimaryURL(repomdURL string) (string, error) {
 		}
 	}
 
+	if pin.IsSet() {
+		if err := pin.Verify(baseURL, repomdRevision(repomdData), repomdData); err != nil {
+			return "", err
+		}
+		log.Infof("repository %s matches pinned snapshot", baseURL)
+	}
+
 	dec := xml.NewDecoder(bytes.NewReader(repomdData))
 
 	// Walk the tokens looking for <data type="primary">
@@ -641,7 +709,7 @@ func FetchPrimaryURL(repomdURL string) (string, error) {
 }
 
 func GetRepoMetaDataURL(baseURL, repoMetaXmlPath string) string {
-	repoMetaDataURL := strings.TrimRight(baseURL, "/") + "/" + repoMetaXmlPath
+	repoMetaDataURL := ospackage.ResolveURL(baseURL, repoMetaXmlPath)
 	// Check if baseURL is a valid URL,
 	if !strings.HasPrefix(repoMetaDataURL, "http://") && !strings.HasPrefix(repoMetaDataURL, "https://") {
 		return ""
@@ -668,6 +736,17 @@ func convertFlags(flags string) string {
 }
 
 // MatchRequested matches requested package names to the best available versions in the repo.
+// resolveRequestedSpec resolves the requested package spec want, trying its
+// alternatives in order, and "name=version" pins as "name-version" requests.
+func resolveRequestedSpec(want string, all []ospackage.PackageInfo) (ospackage.PackageInfo, bool) {
+	for _, key := range ospackage.ParsePackageSpec(want).MatchKeys("-") {
+		if pkg, found := ResolveTopPackageConflicts(key, all); found {
+			return pkg, true
+		}
+	}
+	return ospackage.PackageInfo{}, false
+}
+
 func MatchRequested(requests []string, all []ospackage.PackageInfo) ([]ospackage.PackageInfo, error) {
 
 	var out []ospackage.PackageInfo
@@ -689,7 +768,7 @@ func MatchRequested(requests []string, all []ospackage.PackageInfo) ([]ospackage
 			continue
 		}
 
-		if pkg, found := ResolveTopPackageConflicts(want, all); found {
+		if pkg, found := resolveRequestedSpec(want, all); found {
 			key := fmt.Sprintf("%s=%s", pkg.Name, pkg.Version)
 			if _, ok := seen[key]; ok {
 				continue
@@ -706,7 +785,25 @@ func MatchRequested(requests []string, all []ospackage.PackageInfo) ([]ospackage
 // ResolveDependencies takes a seed list of PackageInfos (the exact versions
 // matched) and the full list of all PackageInfos from the repo, and
 // returns the minimal closure of PackageInfos needed to satisfy all Requires.
+// The closure is sorted by package Name, so the same inputs resolve to the
+// same order whatever the order of requested and all.
 func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.PackageInfo) ([]ospackage.PackageInfo, error) {
+	result, _, err := ResolveDependencyGraph(requested, all)
+	return result, err
+}
+
+// ResolveDependencyGraph resolves the dependencies of requested like
+// ResolveDependencies, and also returns the resolution as a dependency graph
+// with an edge from each package to every resolved package satisfying one of
+// its requirements.
+func ResolveDependencyGraph(requested []ospackage.PackageInfo, all []ospackage.PackageInfo) ([]ospackage.PackageInfo, *ospackage.DependencyGraph, error) {
+	return resolveDependencyGraph(requested, all, nil)
+}
+
+// resolveDependencyGraph implements ResolveDependencyGraph. onResolved, if not
+// nil, is called with each package as soon as it joins the resolution, before
+// the dependencies of later packages are resolved.
+func resolveDependencyGraph(requested []ospackage.PackageInfo, all []ospackage.PackageInfo, onResolved func(ospackage.PackageInfo)) ([]ospackage.PackageInfo, *ospackage.DependencyGraph, error) {
 	log := logger.Logger()
 
 	// Build maps for fast lookup
@@ -729,6 +826,7 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 	}
 
 	neededSet := make(map[string]struct{})
+	var edges []ospackage.DependencyEdge // package -> resolved dependency, for the graph
 	queue := make([]ospackage.PackageInfo, 0, len(requested))
 
 	// Initialize queue with requested packages
@@ -740,7 +838,7 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 				continue
 			}
 		}
-		return nil, fmt.Errorf("requested package %q not in repo listing", pi.Name)
+		return nil, nil, fmt.Errorf("requested package %q not in repo listing", pi.Name)
 	}
 
 	// Use a map to store results so we can modify them
@@ -758,6 +856,9 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 		// Store a copy in the result map so we can modify it
 		curCopy := cur
 		resultMap[cur.Name] = &curCopy
+		if onResolved != nil {
+			onResolved(cur)
+		}
 
 		// Process dependencies
 		for _, dep := range cur.RequiresVer {
@@ -786,10 +887,11 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 								break
 							}
 						}
-						return nil, fmt.Errorf("conflicting package dependencies: %s_%s requires %s, but %s is already selected",
+						return nil, nil, fmt.Errorf("conflicting package dependencies: %s_%s requires %s, but %s is already selected",
 							cur.Name, cur.Version, requiredVer, existing[0].Name)
 					}
 				}
+				edges = append(edges, ospackage.DependencyEdge{From: cur.Name, To: filename, Requirement: depName})
 				// Append to parent's Requires field even if already resolved
 				if resultPkg, exists := resultMap[cur.Name]; exists {
 					resultPkg.Requires = append(resultPkg.Requires, filename)
@@ -811,14 +913,14 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 			// Find candidates for this dependency
 			candidates, err := findAllCandidates(cur, depName, all)
 			if err != nil {
-				return nil, fmt.Errorf("failed to find candidates for dependency %q of package %q: %v", depName, cur.Name, err)
+				return nil, nil, fmt.Errorf("failed to find candidates for dependency %q of package %q: %v", depName, cur.Name, err)
 			}
 
 			if len(candidates) >= 1 {
 				chosenCandidate, err := resolveMultiCandidates(cur, candidates)
 				if err != nil {
 					log.Errorf("failed to resolve multiple candidates for dependency %q of package %q: %v", depName, cur.Name, err)
-					return nil, fmt.Errorf("failed to resolve multiple candidates for dependency %q of package %q: %v", depName, cur.Name, err)
+					return nil, nil, fmt.Errorf("failed to resolve multiple candidates for dependency %q of package %q: %v", depName, cur.Name, err)
 				}
 
 				// Update the parent's Requires field with the chosen candidate's name
@@ -834,11 +936,12 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 					}
 				}
 
+				edges = append(edges, ospackage.DependencyEdge{From: cur.Name, To: chosenCandidate.Name, Requirement: depName})
 				// Add chosen candidate to the queue for further processing
 				queue = append(queue, chosenCandidate)
 			} else {
 				// FAIL FAST instead of just warning
-				// return nil, fmt.Errorf("no candidates found for required dependency %q of package %q", depName, cur.Name)
+				// return nil, nil, fmt.Errorf("no candidates found for required dependency %q of package %q", depName, cur.Name)
 				log.Warnf("No candidates found for required dependency %q of package %q", depName, cur.Name)
 			}
 		}
@@ -855,22 +958,33 @@ func ResolveDependencies(requested []ospackage.PackageInfo, all []ospackage.Pack
 		return result[i].Name < result[j].Name
 	})
 
+	requestedNames := make([]string, 0, len(requested))
+	for _, pi := range requested {
+		requestedNames = append(requestedNames, pi.Name)
+	}
+	graph := ospackage.NewDependencyGraph(result, requestedNames)
+	for _, edge := range edges {
+		graph.AddEdge(edge.From, edge.To, edge.Requirement)
+	}
+
 	log.Infof("Successfully resolved %d packages from %d requested packages", len(result), len(requested))
-	return result, nil
+	return result, graph, nil
 }
 
 // findMatchingKeyInNeededSet checks if any key in neededSet contains depName as a substring,
-// and returns the first matching key whose base package name equals depName.
+// and returns the matching key whose base package name equals depName. When several keys
+// match, the lowest one is returned, so the result does not depend on map iteration order.
 func findMatchingKeyInNeededSet(neededSet map[string]struct{}, depName string) (string, bool) {
+	match := ""
 	for k := range neededSet {
 		if strings.Contains(k, depName) {
 			fileName := extractBasePackageNameFromFile(k)
-			if fileName == depName {
-				return k, true
+			if fileName == depName && (match == "" || k < match) {
+				match = k
 			}
 		}
 	}
-	return "", false
+	return match, match != ""
 }
 
 // generateRPMMetadataDir creates a dynamic directory name for RPM metadata storage
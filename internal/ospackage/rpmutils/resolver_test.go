@@ -4,16 +4,21 @@ import (
 	"bytes"
 	"compress/gzip"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/pkgfetcher"
 	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/resolvertest"
 )
 
@@ -300,14 +305,16 @@ func TestParsePrimary(t *testing.T) {
 	tests := []struct {
 		name          string
 		xmlContent    string
+		rawContent    []byte // served as-is instead of compressing xmlContent
 		filename      string
 		expectedError bool
+		errorContains string
 		expectedCount int
 		expectedNames []string
 	}{
 		{
 			name:          "simple gzipped XML",
-			xmlContent:    `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="2"><package type="rpm"><name>bash</name><arch>x86_64</arch><location href="bash-5.1-8.el9.x86_64.rpm"/><format><rpm:license>GPLv3+</rpm:license><rpm:vendor>Red Hat, Inc.</rpm:vendor><rpm:provides><rpm:entry name="bash"/></rpm:provides><rpm:requires><rpm:entry name="glibc"/></rpm:requires></format></package><package type="rpm"><name>glibc</name><arch>x86_64</arch><location href="glibc-2.32-1.el9.x86_64.rpm"/><format><rpm:license>LGPLv2+</rpm:license><rpm:vendor>Red Hat, Inc.</rpm:vendor><rpm:provides><rpm:entry name="glibc"/></rpm:provides></format></package></metadata>`,
+			xmlContent:    `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="2"><package type="rpm"><name>bash</name><arch>x86_64</arch><size package="1774536" installed="7738634" archive="7768080"/><location href="bash-5.1-8.el9.x86_64.rpm"/><format><rpm:license>GPLv3+</rpm:license><rpm:vendor>Red Hat, Inc.</rpm:vendor><rpm:provides><rpm:entry name="bash"/></rpm:provides><rpm:requires><rpm:entry name="glibc"/></rpm:requires></format></package><package type="rpm"><name>glibc</name><arch>x86_64</arch><location href="glibc-2.32-1.el9.x86_64.rpm"/><format><rpm:license>LGPLv2+</rpm:license><rpm:vendor>Red Hat, Inc.</rpm:vendor><rpm:provides><rpm:entry name="glibc"/></rpm:provides></format></package></metadata>`,
 			filename:      "primary.xml.gz",
 			expectedError: false,
 			expectedCount: 2,
@@ -317,9 +324,29 @@ func TestParsePrimary(t *testing.T) {
 			name:          "empty metadata",
 			xmlContent:    `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://linux.duke.edu/metadata/common" packages="0"></metadata>`,
 			filename:      "empty.xml.gz",
-			expectedError: false,
-			expectedCount: 0,
-			expectedNames: []string{},
+			expectedError: true,
+			errorContains: "empty or truncated repository metadata",
+		},
+		{
+			name:          "zero-byte file",
+			rawContent:    []byte{},
+			filename:      "primary.xml.gz",
+			expectedError: true,
+			errorContains: "empty or truncated repository metadata",
+		},
+		{
+			name:          "truncated primary.xml",
+			xmlContent:    `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="2"><package type="rpm"><name>bash</name><arch>x86_64</arch><location href="bash-5.1-8.el9.x86_64.rpm"/><format><rpm:license>GPLv3+</rpm:license><rpm:vendor>Red Hat, Inc.</rpm:vendor><rpm:provides><rpm:entry name="bash"/></rpm:provides><rpm:requires><rpm:entry name="glibc"/></rpm:requires></format></package><package type="rpm"><name>glibc</name><arch>x86_64</arch><location href="glibc-2.32-1.el9.x86_64.rpm"/><format><rpm:license>LGPLv2+</rpm:license><rpm:vendor>Red Hat, Inc.</rpm:vendor><rpm:provides><rpm:entry name="glibc"/></rpm:provides></format></package></metadata>`[:400],
+			filename:      "primary.xml.gz",
+			expectedError: true,
+			errorContains: "empty or truncated repository metadata",
+		},
+		{
+			name:          "fewer packages than declared",
+			xmlContent:    `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://linux.duke.edu/metadata/common" packages="3"><package type="rpm"><name>bash</name><arch>x86_64</arch><location href="bash-5.1-8.el9.x86_64.rpm"/></package></metadata>`,
+			filename:      "primary.xml.gz",
+			expectedError: true,
+			errorContains: "declares 3 packages but contains 1",
 		},
 		{
 			name:          "invalid compression",
@@ -334,7 +361,9 @@ func TestParsePrimary(t *testing.T) {
 			// Create a test server that serves the XML content
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				// Set appropriate content type and serve compressed content
-				if strings.HasSuffix(tt.filename, ".gz") {
+				if tt.rawContent != nil {
+					_, _ = w.Write(tt.rawContent)
+				} else if strings.HasSuffix(tt.filename, ".gz") {
 					w.Header().Set("Content-Type", "application/gzip")
 					// Compress the content properly
 					content := compressGzip(t, tt.xmlContent)
@@ -352,6 +381,8 @@ func TestParsePrimary(t *testing.T) {
 			if tt.expectedError {
 				if err == nil {
 					t.Error("Expected error, but got none")
+				} else if tt.errorContains != "" && !strings.Contains(err.Error(), tt.errorContains) {
+					t.Errorf("Expected error containing %q, got: %v", tt.errorContains, err)
 				}
 				return
 			}
@@ -404,6 +435,9 @@ func TestParsePrimary(t *testing.T) {
 				if bashPkg.Origin != "Red Hat, Inc." {
 					t.Errorf("bash origin should be 'Red Hat, Inc.', got %s", bashPkg.Origin)
 				}
+				if bashPkg.Size != 1774536 {
+					t.Errorf("bash size should be the package download size 1774536, got %d", bashPkg.Size)
+				}
 			}
 		})
 	}
@@ -667,7 +701,7 @@ func TestGetRepoMetaDataURL(t *testing.T) {
 			name:            "Path with leading slash",
 			baseURL:         "https://repo.example.com/rpm/",
 			repoMetaXmlPath: "/repodata/repomd.xml",
-			expected:        "https://repo.example.com/rpm//repodata/repomd.xml", // Function creates double slash
+			expected:        "https://repo.example.com/rpm/repodata/repomd.xml",
 		},
 	}
 
@@ -710,6 +744,108 @@ func TestParseRepositoryMetadata_RetryTransientFailure(t *testing.T) {
 	}
 }
 
+func TestParseRepositoryMetadata_RecordsRepository(t *testing.T) {
+	originalUserRepo := UserRepo
+	defer func() { UserRepo = originalUserRepo }()
+
+	newRepo := func(release string) *httptest.Server {
+		xmlContent := `<?xml version="1.0" encoding="UTF-8"?><metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="1"><package type="rpm"><name>bash</name><arch>x86_64</arch><version epoch="0" ver="5.2" rel="` + release + `"/><location href="bash-5.2-` + release + `.x86_64.rpm"/></package></metadata>`
+		compressed := compressGzip(t, xmlContent)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(compressed)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	base := newRepo("1.azl3")
+	extra := newRepo("2.azl3")
+
+	var all []ospackage.PackageInfo
+	for _, server := range []*httptest.Server{base, extra} {
+		pkgs, err := ParseRepositoryMetadata(server.URL+"/", "primary.xml.gz", nil)
+		if err != nil {
+			t.Fatalf("ParseRepositoryMetadata(%s) failed: %v", server.URL, err)
+		}
+		if len(pkgs) != 1 || pkgs[0].Repository != server.URL+"/" {
+			t.Fatalf("expected bash to come from repository %s/, got %+v", server.URL, pkgs)
+		}
+		all = append(all, pkgs...)
+	}
+
+	UserRepo = []config.PackageRepository{{URL: base.URL, Priority: 900}, {URL: extra.URL, Priority: 100}}
+	chosen := selectByPriorityThenRepo("", all)
+	if chosen.Repository != base.URL+"/" {
+		t.Errorf("expected bash from the higher priority repository %s/, got it from %s", base.URL, chosen.Repository)
+	}
+	if graph := ospackage.NewDependencyGraph([]ospackage.PackageInfo{chosen}, nil); graph.Nodes[0].Repository != base.URL+"/" {
+		t.Errorf("expected the resolved package list to record repository %s/, got %q", base.URL, graph.Nodes[0].Repository)
+	}
+}
+
+func TestMatchRequested_PriorityOverlayRepository(t *testing.T) {
+	originalUserRepo := UserRepo
+	defer func() { UserRepo = originalUserRepo }()
+
+	const baseURL = "https://base.example.com/azl3/x86_64"
+	const overlayURL = "https://overlay.example.com/azl3/x86_64"
+	rpm := func(repoURL, name, version string, requires ...string) ospackage.PackageInfo {
+		fileName := fmt.Sprintf("%s-%s.x86_64.rpm", name, version)
+		return ospackage.PackageInfo{
+			Name:        fileName,
+			PkgName:     name,
+			Version:     version,
+			URL:         repoURL + "/Packages/" + fileName,
+			Requires:    requires,
+			RequiresVer: requires,
+		}
+	}
+	all := []ospackage.PackageInfo{
+		rpm(baseURL, "libfoo", "2.0-1.azl3"),
+		rpm(baseURL, "app", "1.0-1.azl3", "libfoo"),
+		rpm(baseURL, "tool", "3.0-1.azl3"),
+		rpm(overlayURL, "libfoo", "1.5-1.azl3"),
+	}
+	UserRepo = []config.PackageRepository{
+		{URL: baseURL, Priority: 500},
+		{URL: overlayURL, Priority: 900},
+	}
+
+	requested, err := MatchRequested([]string{"libfoo", "app", "tool"}, all)
+	if err != nil {
+		t.Fatalf("MatchRequested failed: %v", err)
+	}
+	resolved, err := ResolveDependencies(requested, all)
+	if err != nil {
+		t.Fatalf("ResolveDependencies failed: %v", err)
+	}
+
+	want := map[string]string{
+		"libfoo": overlayURL + "/Packages/libfoo-1.5-1.azl3.x86_64.rpm",
+		"app":    baseURL + "/Packages/app-1.0-1.azl3.x86_64.rpm",
+		"tool":   baseURL + "/Packages/tool-3.0-1.azl3.x86_64.rpm",
+	}
+	for _, pkgs := range [][]ospackage.PackageInfo{requested, resolved} {
+		if len(pkgs) != len(want) {
+			t.Fatalf("expected %d packages, got %+v", len(want), pkgs)
+		}
+		for _, pkg := range pkgs {
+			if pkg.URL != want[pkg.PkgName] {
+				t.Errorf("expected %s from %s, got %s", pkg.PkgName, want[pkg.PkgName], pkg.URL)
+			}
+		}
+	}
+
+	// Without priorities the newer version of the base repository wins
+	UserRepo = []config.PackageRepository{{URL: baseURL}, {URL: overlayURL}}
+	requested, err = MatchRequested([]string{"libfoo"}, all)
+	if err != nil {
+		t.Fatalf("MatchRequested failed: %v", err)
+	}
+	if len(requested) != 1 || requested[0].Version != "2.0-1.azl3" {
+		t.Errorf("expected libfoo 2.0-1.azl3 without priorities, got %+v", requested)
+	}
+}
+
 func TestFetchPrimaryURL_NoRetryOnPermanentFailure(t *testing.T) {
 	var requestCount int32
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -726,3 +862,220 @@ func TestFetchPrimaryURL_NoRetryOnPermanentFailure(t *testing.T) {
 		t.Fatalf("expected 1 request for permanent error, got %d", atomic.LoadInt32(&requestCount))
 	}
 }
+
+func TestResolveDependencyGraph(t *testing.T) {
+	all := []ospackage.PackageInfo{
+		{Name: "app-1.0-1.azl3.x86_64.rpm", URL: "https://repo.example.com/azl3/x86_64/Packages/app-1.0-1.azl3.x86_64.rpm", PkgName: "app", Version: "1.0-1.azl3", RequiresVer: []string{"libfoo >= 1.5", "libbar"}},
+		{Name: "libfoo-1.6-1.azl3.x86_64.rpm", URL: "https://repo.example.com/azl3/x86_64/Packages/libfoo-1.6-1.azl3.x86_64.rpm", PkgName: "libfoo", Version: "1.6-1.azl3", RequiresVer: []string{"libbase.so.3()(64bit)"}},
+		{Name: "libbar-2.0-1.azl3.x86_64.rpm", URL: "https://repo.example.com/azl3/x86_64/Packages/libbar-2.0-1.azl3.x86_64.rpm", PkgName: "libbar", Version: "2.0-1.azl3"},
+		{Name: "libbase-3.0-1.azl3.x86_64.rpm", URL: "https://repo.example.com/azl3/x86_64/Packages/libbase-3.0-1.azl3.x86_64.rpm", PkgName: "libbase", Version: "3.0-1.azl3", Provides: []string{"libbase.so.3()(64bit)"}},
+	}
+	req := []ospackage.PackageInfo{{Name: "app-1.0-1.azl3.x86_64.rpm", Version: "1.0-1.azl3"}}
+
+	result, graph, err := ResolveDependencyGraph(req, all)
+	if err != nil {
+		t.Fatalf("ResolveDependencyGraph failed: %v", err)
+	}
+	if len(result) != 4 || len(graph.Nodes) != 4 {
+		t.Fatalf("expected 4 resolved packages and nodes, got %d and %d", len(result), len(graph.Nodes))
+	}
+
+	want := []ospackage.DependencyEdge{
+		{From: "app-1.0-1.azl3.x86_64.rpm", To: "libbar-2.0-1.azl3.x86_64.rpm", Requirement: "libbar", Kind: ospackage.EdgeRequires},
+		{From: "app-1.0-1.azl3.x86_64.rpm", To: "libfoo-1.6-1.azl3.x86_64.rpm", Requirement: "libfoo", Kind: ospackage.EdgeRequires},
+		{From: "libfoo-1.6-1.azl3.x86_64.rpm", To: "libbase-3.0-1.azl3.x86_64.rpm", Requirement: "libbase.so.3()(64bit)", Kind: ospackage.EdgeProvides},
+	}
+	if !reflect.DeepEqual(graph.Edges, want) {
+		t.Errorf("Edges = %+v, want %+v", graph.Edges, want)
+	}
+	if node := graph.Node("app-1.0-1.azl3.x86_64.rpm"); node == nil || !node.Requested || node.Package != "app" {
+		t.Errorf("expected app to be a requested node, got %+v", node)
+	}
+}
+
+func TestResolveDependenciesStableOrder(t *testing.T) {
+	pkg := func(name, version string, requires []string, provides ...string) ospackage.PackageInfo {
+		file := fmt.Sprintf("%s-%s.x86_64.rpm", name, version)
+		return ospackage.PackageInfo{
+			Name:        file,
+			URL:         "https://repo.example.com/azl3/x86_64/Packages/" + file,
+			PkgName:     name,
+			Version:     version,
+			RequiresVer: requires,
+			Provides:    provides,
+		}
+	}
+	all := []ospackage.PackageInfo{
+		pkg("app", "1.0-1.azl3", []string{"libfoo >= 1.5", "libbar", "zlib"}),
+		pkg("tool", "2.1-1.azl3", []string{"libfoo", "libbase.so.3()(64bit)"}),
+		pkg("libfoo", "1.6-1.azl3", []string{"libbase.so.3()(64bit)", "zlib"}),
+		pkg("libbar", "2.0-1.azl3", nil),
+		pkg("libbase", "3.0-1.azl3", nil, "libbase.so.3()(64bit)"),
+		pkg("zlib", "1.3-1.azl3", nil),
+		pkg("unused", "1.0-1.azl3", nil),
+	}
+	requested := []ospackage.PackageInfo{
+		{Name: "app-1.0-1.azl3.x86_64.rpm", Version: "1.0-1.azl3"},
+		{Name: "tool-2.1-1.azl3.x86_64.rpm", Version: "2.1-1.azl3"},
+	}
+	order := func(pkgs []ospackage.PackageInfo) string {
+		var lines []string
+		for _, p := range pkgs {
+			lines = append(lines, fmt.Sprintf("%s %s %v", p.Name, p.Version, p.Requires))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	var want string
+	for i := 0; i < 50; i++ {
+		allCopy := append([]ospackage.PackageInfo(nil), all...)
+		reqCopy := append([]ospackage.PackageInfo(nil), requested...)
+		rng.Shuffle(len(allCopy), func(a, b int) { allCopy[a], allCopy[b] = allCopy[b], allCopy[a] })
+		rng.Shuffle(len(reqCopy), func(a, b int) { reqCopy[a], reqCopy[b] = reqCopy[b], reqCopy[a] })
+
+		result, err := ResolveDependencies(reqCopy, allCopy)
+		if err != nil {
+			t.Fatalf("ResolveDependencies failed: %v", err)
+		}
+		got := order(result)
+		if i == 0 {
+			want = got
+			if len(result) != 6 {
+				t.Fatalf("expected 6 resolved packages, got:\n%s", got)
+			}
+			continue
+		}
+		if got != want {
+			t.Fatalf("run %d resolved a different order:\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+}
+
+func TestCheckKernelPackages(t *testing.T) {
+	all := []ospackage.PackageInfo{
+		{Name: "kernel-6.6.44-1.azl3.x86_64.rpm", PkgName: "kernel", Version: "6.6.44-1.azl3"},
+		{Name: "kernel-rt-6.6.44-1.azl3.x86_64.rpm", PkgName: "kernel-rt", Version: "6.6.44-1.azl3"},
+	}
+	pkgSources := map[string]config.PackageSource{
+		"kernel-rt":    config.PackageSourceKernel,
+		"missing-tool": config.PackageSourceSystem,
+	}
+
+	if err := checkKernelPackages([]string{"kernel-rt", "missing-tool"}, pkgSources, all); err != nil {
+		t.Errorf("expected available kernel package to pass, got: %v", err)
+	}
+
+	pkgSources["kernel-64k"] = config.PackageSourceKernel
+	err := checkKernelPackages([]string{"kernel-64k"}, pkgSources, all)
+	if err == nil || !strings.Contains(err.Error(), "kernel package not available") {
+		t.Errorf("expected missing kernel package to be rejected, got: %v", err)
+	}
+}
+
+// streamingPackages returns a dependency chain app -> libfoo -> libbase, plus
+// libbar, served by server.
+func streamingPackages(serverURL string) []ospackage.PackageInfo {
+	base := serverURL + "/azl3/x86_64/Packages/"
+	return []ospackage.PackageInfo{
+		{Name: "app-1.0-1.azl3.x86_64.rpm", URL: base + "app-1.0-1.azl3.x86_64.rpm", PkgName: "app", Version: "1.0-1.azl3", RequiresVer: []string{"libfoo", "libbar"}},
+		{Name: "libfoo-1.6-1.azl3.x86_64.rpm", URL: base + "libfoo-1.6-1.azl3.x86_64.rpm", PkgName: "libfoo", Version: "1.6-1.azl3", RequiresVer: []string{"libbase"}},
+		{Name: "libbar-2.0-1.azl3.x86_64.rpm", URL: base + "libbar-2.0-1.azl3.x86_64.rpm", PkgName: "libbar", Version: "2.0-1.azl3"},
+		{Name: "libbase-3.0-1.azl3.x86_64.rpm", URL: base + "libbase-3.0-1.azl3.x86_64.rpm", PkgName: "libbase", Version: "3.0-1.azl3"},
+	}
+}
+
+func TestResolveStreamsDownloads(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[filepath.Base(r.URL.Path)] = true
+		mu.Unlock()
+		_, _ = w.Write([]byte("rpm content"))
+	}))
+	defer server.Close()
+	wasRequested := func(name string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return requested[name]
+	}
+
+	all := streamingPackages(server.URL)
+	req := []ospackage.PackageInfo{{Name: "app-1.0-1.azl3.x86_64.rpm", Version: "1.0-1.azl3"}}
+	stream := pkgfetcher.NewStream(t.TempDir(), 2)
+
+	// The last package of the chain is resolved only once the download of the
+	// first one is under way
+	downloadedDuringResolve := false
+	needed, err := resolve(req, all, func(pkg ospackage.PackageInfo) {
+		stream.Add(pkg.URL)
+		if pkg.PkgName != "libbase" {
+			return
+		}
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if wasRequested("app-1.0-1.azl3.x86_64.rpm") {
+				downloadedDuringResolve = true
+				return
+			}
+		}
+	})
+	if waitErr := stream.Wait(); waitErr != nil {
+		t.Fatalf("streamed downloads failed: %v", waitErr)
+	}
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if !downloadedDuringResolve {
+		t.Error("expected the first package to be downloading before the resolution completed")
+	}
+	if len(needed) != 4 {
+		t.Errorf("expected 4 resolved packages, got %d", len(needed))
+	}
+	for _, pkg := range all {
+		if !wasRequested(pkg.Name) {
+			t.Errorf("expected %s to be downloaded", pkg.Name)
+		}
+	}
+}
+
+func TestResolveAndStream(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte("rpm content"))
+	}))
+	defer server.Close()
+
+	origConfig := config.Global()
+	defer config.SetGlobal(origConfig)
+	req := []ospackage.PackageInfo{{Name: "app-1.0-1.azl3.x86_64.rpm", Version: "1.0-1.azl3"}}
+
+	// Without streaming, nothing is downloaded during the resolution
+	destDir := t.TempDir()
+	if _, err := resolveAndStream(req, streamingPackages(server.URL), destDir); err != nil {
+		t.Fatalf("resolveAndStream failed: %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected no downloads without streaming, got %d", n)
+	}
+
+	streamingConfig := config.Global()
+	streamingConfig.StreamDownloads = true
+	config.SetGlobal(streamingConfig)
+	needed, err := resolveAndStream(req, streamingPackages(server.URL), destDir)
+	if err != nil {
+		t.Fatalf("resolveAndStream failed: %v", err)
+	}
+	for _, pkg := range needed {
+		if _, err := os.Stat(filepath.Join(destDir, pkg.Name)); err != nil {
+			t.Errorf("expected %s to be downloaded while resolving: %v", pkg.Name, err)
+		}
+	}
+
+	// A failed download fails the resolution step
+	server.Config.Handler = http.NotFoundHandler()
+	if _, err := resolveAndStream(req, streamingPackages(server.URL), t.TempDir()); err == nil || !strings.Contains(err.Error(), "fetch failed") {
+		t.Errorf("expected a failed streamed download to be reported, got: %v", err)
+	}
+}
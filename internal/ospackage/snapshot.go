@@ -0,0 +1,40 @@
+package ospackage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// SnapshotPin pins a repository to one published snapshot of its metadata,
+// so a build fails instead of silently picking up packages from a newer one.
+// Empty fields are not checked.
+type SnapshotPin struct {
+	Revision string // <revision> of repomd.xml, or the Date field of a Debian Release file
+	Checksum string // sha256 of repomd.xml or of the Release file
+}
+
+// IsSet reports whether the pin checks anything.
+func (p SnapshotPin) IsSet() bool {
+	return p.Revision != "" || p.Checksum != ""
+}
+
+// Verify checks the revision and content of the metadata served by repo
+// against the pin.
+func (p SnapshotPin) Verify(repo, revision string, metadata []byte) error {
+	if p.Revision != "" && strings.TrimSpace(revision) != strings.TrimSpace(p.Revision) {
+		return fmt.Errorf("repo snapshot mismatch for %s: expected revision %q, repository serves %q",
+			repo, p.Revision, revision)
+	}
+	if p.Checksum != "" {
+		sum := sha256.Sum256(metadata)
+		served := hex.EncodeToString(sum[:])
+		expected := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(p.Checksum), "sha256:"))
+		if served != expected {
+			return fmt.Errorf("repo snapshot mismatch for %s: expected metadata sha256 %s, repository serves %s",
+				repo, expected, served)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package ospackage
+
+import (
+	"regexp"
+	"strings"
+)
+
+// archQualifierRe matches the architecture qualifier of "name:arch", such as
+// amd64, x86_64 or any. Versions after an epoch, as in "name_1:2.0", never
+// match since they contain dots or start an underscored name.
+var archQualifierRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// PackageSpec is a package specification as written in image templates and
+// package dependency fields, split into its parts:
+//   - "name"
+//   - "name=version", a template pin to an exact version
+//   - "name (>= version)" and "name >= version", versioned dependencies
+//   - "name:arch", a Debian architecture qualifier
+//   - "name | alt | ...", alternatives of which any one satisfies the spec
+type PackageSpec struct {
+	Name         string        // package name
+	Arch         string        // architecture qualifier, empty if none
+	Op           string        // version operator such as "=", ">=" or "<<", empty if unversioned
+	Version      string        // version the operator applies to
+	Alternatives []PackageSpec // further alternatives after "|", in order
+}
+
+// ParsePackageSpec parses spec. Parts it does not recognize are kept in Name,
+// so plain names, globs and "name_version" requests pass through unchanged.
+func ParsePackageSpec(spec string) PackageSpec {
+	parts := strings.Split(spec, "|")
+	parsed := parseSinglePackageSpec(parts[0])
+	for _, alt := range parts[1:] {
+		if altSpec := parseSinglePackageSpec(alt); altSpec.Name != "" {
+			parsed.Alternatives = append(parsed.Alternatives, altSpec)
+		}
+	}
+	return parsed
+}
+
+func parseSinglePackageSpec(spec string) PackageSpec {
+	var parsed PackageSpec
+	spec = strings.TrimSpace(spec)
+
+	name := spec
+	if idx := strings.Index(spec, "("); idx > 0 {
+		// "name (>= 1.0)"
+		name = strings.TrimSpace(spec[:idx])
+		constraint := spec[idx+1:]
+		if end := strings.Index(constraint, ")"); end != -1 {
+			constraint = constraint[:end]
+		}
+		parsed.Op, parsed.Version = splitVersionConstraint(constraint)
+	} else if fields := strings.Fields(spec); len(fields) == 3 && isVersionOp(fields[1]) {
+		// "name >= 1.0"
+		name = fields[0]
+		parsed.Op, parsed.Version = fields[1], fields[2]
+	} else if fields := strings.Fields(spec); len(fields) > 1 {
+		name = fields[0]
+	} else if before, after, found := strings.Cut(spec, "="); found && before != "" && !strings.ContainsAny(before, "<>!") {
+		// "name=1.0"
+		name = before
+		parsed.Op, parsed.Version = "=", strings.TrimSpace(after)
+	}
+
+	if before, after, found := strings.Cut(name, ":"); found && before != "" &&
+		!strings.Contains(before, "_") && archQualifierRe.MatchString(after) {
+		name, parsed.Arch = before, after
+	}
+	parsed.Name = strings.TrimSpace(name)
+	return parsed
+}
+
+// splitVersionConstraint splits ">= 1.0" or ">=1.0" into operator and version.
+func splitVersionConstraint(constraint string) (op, version string) {
+	constraint = strings.TrimSpace(constraint)
+	for _, candidate := range []string{"<<", ">>", "<=", ">=", "==", "=", "<", ">"} {
+		if strings.HasPrefix(constraint, candidate) {
+			return candidate, strings.TrimSpace(strings.TrimPrefix(constraint, candidate))
+		}
+	}
+	return "", constraint
+}
+
+func isVersionOp(s string) bool {
+	switch s {
+	case "=", "==", "<", ">", "<=", ">=", "<<", ">>":
+		return true
+	}
+	return false
+}
+
+// InFamily reports whether the package is base itself or one of its
+// "base-*" subpackages, e.g. dracut-core for dracut.
+func (s PackageSpec) InFamily(base string) bool {
+	return s.Name == base || strings.HasPrefix(s.Name, base+"-")
+}
+
+// MatchKeys returns the requests the repository resolvers look up for the
+// spec and its alternatives, in order: the package name, or for an exact
+// "name=version" pin the name and version joined with versionSep, which is
+// "_" for Debian and "-" for RPM package requests.
+func (s PackageSpec) MatchKeys(versionSep string) []string {
+	specs := append([]PackageSpec{s}, s.Alternatives...)
+	keys := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Op == "=" && spec.Version != "" {
+			keys = append(keys, spec.Name+versionSep+spec.Version)
+			continue
+		}
+		keys = append(keys, spec.Name)
+	}
+	return keys
+}
@@ -0,0 +1,85 @@
+package ospackage_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+)
+
+func TestParsePackageSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want ospackage.PackageSpec
+	}{
+		{spec: "curl", want: ospackage.PackageSpec{Name: "curl"}},
+		{spec: "  curl  ", want: ospackage.PackageSpec{Name: "curl"}},
+		{spec: "curl=8.5.0-2", want: ospackage.PackageSpec{Name: "curl", Op: "=", Version: "8.5.0-2"}},
+		{spec: "libc6 (>= 2.34)", want: ospackage.PackageSpec{Name: "libc6", Op: ">=", Version: "2.34"}},
+		{spec: "libc6 (<<2.40)", want: ospackage.PackageSpec{Name: "libc6", Op: "<<", Version: "2.40"}},
+		{spec: "glibc >= 2.38", want: ospackage.PackageSpec{Name: "glibc", Op: ">=", Version: "2.38"}},
+		{spec: "gcc:amd64", want: ospackage.PackageSpec{Name: "gcc", Arch: "amd64"}},
+		{spec: "python3:any (>= 3.11)", want: ospackage.PackageSpec{Name: "python3", Arch: "any", Op: ">=", Version: "3.11"}},
+		{
+			spec: "default-mta | mail-transport-agent (>= 1.0)",
+			want: ospackage.PackageSpec{
+				Name:         "default-mta",
+				Alternatives: []ospackage.PackageSpec{{Name: "mail-transport-agent", Op: ">=", Version: "1.0"}},
+			},
+		},
+		// Forms the resolvers match directly are passed through unchanged
+		{spec: "acct_6.6.4-5+b1", want: ospackage.PackageSpec{Name: "acct_6.6.4-5+b1"}},
+		{spec: "qemu-system_3:9.1", want: ospackage.PackageSpec{Name: "qemu-system_3:9.1"}},
+		{spec: "kernel-6.12.9-1", want: ospackage.PackageSpec{Name: "kernel-6.12.9-1"}},
+		{spec: "linux-image-*", want: ospackage.PackageSpec{Name: "linux-image-*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if got := ospackage.ParsePackageSpec(tt.spec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePackageSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageSpecInFamily(t *testing.T) {
+	tests := []struct {
+		spec string
+		base string
+		want bool
+	}{
+		{spec: "dracut", base: "dracut", want: true},
+		{spec: "dracut-core=059-1", base: "dracut", want: true},
+		{spec: "dracut-core:amd64", base: "dracut", want: true},
+		{spec: "dracutx", base: "dracut", want: false},
+		{spec: "curl | dracut", base: "dracut", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := ospackage.ParsePackageSpec(tt.spec).InFamily(tt.base); got != tt.want {
+			t.Errorf("ParsePackageSpec(%q).InFamily(%q) = %v, want %v", tt.spec, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestPackageSpecMatchKeys(t *testing.T) {
+	tests := []struct {
+		spec       string
+		versionSep string
+		want       []string
+	}{
+		{spec: "curl", versionSep: "_", want: []string{"curl"}},
+		{spec: "curl=8.5.0-2", versionSep: "_", want: []string{"curl_8.5.0-2"}},
+		{spec: "curl=8.5.0-2", versionSep: "-", want: []string{"curl-8.5.0-2"}},
+		{spec: "libc6 (>= 2.34)", versionSep: "_", want: []string{"libc6"}},
+		{spec: "vim | nano=7.2-1", versionSep: "_", want: []string{"vim", "nano_7.2-1"}},
+	}
+
+	for _, tt := range tests {
+		got := ospackage.ParsePackageSpec(tt.spec).MatchKeys(tt.versionSep)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePackageSpec(%q).MatchKeys(%q) = %v, want %v", tt.spec, tt.versionSep, got, tt.want)
+		}
+	}
+}
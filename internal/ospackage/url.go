@@ -0,0 +1,44 @@
+package ospackage
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// LocalRepoURL returns the URL of a repository location, which may be an
+// absolute local directory such as the mount point of a vendor ISO. A local
+// directory becomes a file:// URL, so metadata and packages are read straight
+// from disk; any other location is returned as is.
+func LocalRepoURL(location string) string {
+	if !filepath.IsAbs(location) || strings.HasPrefix(location, "//") {
+		return location
+	}
+	// Not escaped, so placeholders such as {arch} survive for later substitution
+	return "file://" + filepath.Clean(location)
+}
+
+// ResolveURL returns the download URL of ref, a package or metadata location
+// read from repository metadata, within the repository at baseURL:
+//   - absolute URLs such as "https://mirror/pool/a.deb" or "file:///repo/a.rpm"
+//     are returned as is
+//   - protocol-relative URLs such as "//mirror/pool/a.deb" take the scheme of
+//     baseURL, or https if baseURL has none
+//   - any other ref is a path relative to the repository root and is joined
+//     to baseURL with exactly one slash between them
+func ResolveURL(baseURL, ref string) string {
+	if u, err := url.Parse(ref); err == nil && u.IsAbs() && (u.Host != "" || u.Scheme == "file") {
+		return ref
+	}
+	if strings.HasPrefix(ref, "//") {
+		scheme := "https"
+		if u, err := url.Parse(baseURL); err == nil && u.Scheme != "" {
+			scheme = u.Scheme
+		}
+		return scheme + ":" + ref
+	}
+	if baseURL == "" {
+		return ref
+	}
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(ref, "/")
+}
@@ -1,6 +1,7 @@
 package azl
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -50,10 +51,10 @@ func (m *mockChrootEnv) InitChrootEnv(targetOs, targetDist, targetArch string) e
 	return nil
 }
 func (m *mockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string) error { return nil }
-func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return nil
 }
-func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return nil
 }
 func (m *mockChrootEnv) UpdateSystemPkgs(template *config.ImageTemplate) error { return nil }
@@ -550,23 +551,21 @@ func TestAzlBuildImageValidTypes(t *testing.T) {
 	}
 }
 
-// TestAzlPostProcessWithNilChroot tests PostProcess with nil chrootEnv
+// TestAzlPostProcessWithNilChroot tests PostProcess returns an error with nil chrootEnv
 func TestAzlPostProcessWithNilChroot(t *testing.T) {
 	azl := &AzureLinux{}
 	template := createTestImageTemplate()
 
-	// Test that PostProcess panics with nil chrootEnv (current behavior)
-	// We use defer/recover to catch the panic and validate it
-	defer func() {
-		if r := recover(); r != nil {
-			t.Logf("PostProcess correctly panicked with nil chrootEnv: %v", r)
-		} else {
-			t.Error("Expected PostProcess to panic with nil chrootEnv")
-		}
-	}()
+	err := azl.PostProcess(template, nil)
+	if !errors.Is(err, provider.ErrChrootNotInitialized) {
+		t.Errorf("Expected chroot environment not initialized error, got: %v", err)
+	}
 
-	// This will panic due to nil chrootEnv
-	_ = azl.PostProcess(template, nil)
+	// A build error, such as the failed Init, is kept
+	err = azl.PostProcess(template, fmt.Errorf("init failed"))
+	if !errors.Is(err, provider.ErrChrootNotInitialized) || !strings.Contains(err.Error(), "init failed") {
+		t.Errorf("Expected the build error and chroot environment not initialized error, got: %v", err)
+	}
 }
 
 // TestAzlPostProcessErrorHandling tests PostProcess error handling logic
@@ -741,6 +740,14 @@ func TestAzlDownloadImagePkgs(t *testing.T) {
 	t.Skip("downloadImagePkgs requires proper Azure Linux initialization with chrootEnv - function exists and is callable")
 }
 
+// TestAzlDownloadImagePkgsNotInitialized tests a provider Init was not called on
+func TestAzlDownloadImagePkgsNotInitialized(t *testing.T) {
+	err := (&AzureLinux{}).downloadImagePkgs(createTestImageTemplate())
+	if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("Expected provider not initialized error, got: %v", err)
+	}
+}
+
 // TestAzlPreProcessWithMockEnv tests PreProcess with proper mock chrootEnv
 func TestAzlPreProcessWithMockEnv(t *testing.T) {
 	azl := &AzureLinux{
@@ -0,0 +1,27 @@
+package provider
+
+import (
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+)
+
+// RunDownloadStage runs download, the provider step resolving and
+// downloading the image packages of template, and records the resolve and
+// download stages in the build checkpoint. When the build being resumed
+// already completed them, download is skipped and the resolved package lists
+// are restored from the checkpoint instead; the packages themselves are still
+// in the package cache.
+func RunDownloadStage(template *config.ImageTemplate, download func() error) error {
+	checkpoint := template.Checkpoint
+	if checkpoint.IsCompleted(config.StageDownload) {
+		logger.Logger().Infof("Skipping the resolve and download stages, completed by the resumed build")
+		checkpoint.RestorePackageLists(template)
+		return nil
+	}
+	if err := download(); err != nil {
+		return err
+	}
+	checkpoint.RecordPackageLists(template)
+	checkpoint.Complete(config.StageResolve, config.StageDownload)
+	return nil
+}
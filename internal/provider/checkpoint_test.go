@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+)
+
+func TestRunDownloadStage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build-checkpoint.json")
+	template := &config.ImageTemplate{SystemConfig: config.SystemConfig{Name: "test-config"}}
+	checkpoint, err := config.NewBuildCheckpoint(path, template)
+	if err != nil {
+		t.Fatalf("NewBuildCheckpoint() error = %v", err)
+	}
+	template.Checkpoint = checkpoint
+
+	downloads := 0
+	download := func() error {
+		downloads++
+		template.KernelPkgList = []string{"kernel"}
+		template.FullPkgList = []string{"kernel-6.12.rpm", "bash-5.2.rpm"}
+		return nil
+	}
+	if err := RunDownloadStage(template, download); err != nil {
+		t.Fatalf("RunDownloadStage() error = %v", err)
+	}
+	if downloads != 1 || !checkpoint.IsCompleted(config.StageResolve) || !checkpoint.IsCompleted(config.StageDownload) {
+		t.Fatalf("expected one download completing both stages, got %d downloads and %v", downloads, checkpoint.Completed)
+	}
+
+	// A resumed build restores the package lists instead of downloading
+	resumedTemplate := &config.ImageTemplate{SystemConfig: config.SystemConfig{Name: "test-config"}}
+	resumedTemplate.Checkpoint, err = config.ResumeBuildCheckpoint(path, resumedTemplate)
+	if err != nil {
+		t.Fatalf("ResumeBuildCheckpoint() error = %v", err)
+	}
+	if err := RunDownloadStage(resumedTemplate, func() error { return fmt.Errorf("download must be skipped") }); err != nil {
+		t.Fatalf("RunDownloadStage() error = %v", err)
+	}
+	if !reflect.DeepEqual(resumedTemplate.FullPkgList, template.FullPkgList) ||
+		!reflect.DeepEqual(resumedTemplate.KernelPkgList, template.KernelPkgList) {
+		t.Errorf("package lists were not restored: %v %v", resumedTemplate.FullPkgList, resumedTemplate.KernelPkgList)
+	}
+
+	// Without a checkpoint, failures are returned and nothing is recorded
+	if err := RunDownloadStage(&config.ImageTemplate{}, func() error { return fmt.Errorf("boom") }); err == nil {
+		t.Fatal("expected the download error")
+	}
+}
@@ -9,7 +9,10 @@ import (
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/image/initrdmaker"
 	"github.com/open-edge-platform/image-composer-tool/internal/image/isomaker"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/ocimaker"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/pxemaker"
 	"github.com/open-edge-platform/image-composer-tool/internal/image/rawmaker"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/tarmaker"
 	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/debutils"
 	"github.com/open-edge-platform/image-composer-tool/internal/provider"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/display"
@@ -49,6 +52,17 @@ func (p *debian13) Name(dist, arch string) string {
 	return system.GetProviderId(OsName, dist, arch)
 }
 
+// Capabilities returns the image types, architectures, boot modes and
+// features the provider supports
+func (p *debian13) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		ImageTypes: []string{"raw", "img", "iso", "oci", "tar", "pxe"},
+		Arches:     []string{"x86_64", "aarch64"},
+		BootModes:  []string{"efi", "legacy"},
+		Features:   []string{provider.FeatureUKI, provider.FeatureImmutability, provider.FeatureSecureBoot},
+	}
+}
+
 // Init will initialize the provider, fetching repo configuration
 func (p *debian13) Init(dist, arch string) error {
 	// Normalize architecture names
@@ -85,7 +99,7 @@ func (p *debian13) PreProcess(template *config.ImageTemplate) error {
 	}
 
 	template.StartDownloadImagePkgsTimer()
-	if err := p.downloadImagePkgs(template); err != nil {
+	if err := provider.RunDownloadStage(template, func() error { return p.downloadImagePkgs(template) }); err != nil {
 		template.FinishDownloadImagePkgsTimer()
 		return fmt.Errorf("failed to download image packages: %w", err)
 	}
@@ -106,6 +120,10 @@ func (p *debian13) BuildImage(template *config.ImageTemplate) error {
 		return fmt.Errorf("template cannot be nil")
 	}
 
+	if err := p.Capabilities().Validate(template); err != nil {
+		return err
+	}
+
 	log.Infof("Building image: %s", template.GetImageName())
 
 	// Create makers with template when needed
@@ -116,6 +134,12 @@ func (p *debian13) BuildImage(template *config.ImageTemplate) error {
 		return p.buildInitrdImage(template)
 	case "iso":
 		return p.buildIsoImage(template)
+	case "oci":
+		return p.buildOciImage(template)
+	case "tar":
+		return p.buildTarImage(template)
+	case "pxe":
+		return p.buildPxeImage(template)
 	default:
 		return fmt.Errorf("unsupported image type: %s", template.Target.ImageType)
 	}
@@ -181,6 +205,75 @@ func (p *debian13) buildInitrdImage(template *config.ImageTemplate) error {
 	return nil
 }
 
+func (p *debian13) buildOciImage(template *config.ImageTemplate) error {
+	// Create OciMaker with template (dependency injection)
+	ociMaker, err := ocimaker.NewOciMaker(p.chrootEnv, template)
+	if err != nil {
+		return fmt.Errorf("failed to create oci maker: %w", err)
+	}
+
+	// Use the maker
+	if err := ociMaker.Init(); err != nil {
+		return fmt.Errorf("failed to initialize oci image maker: %w", err)
+	}
+	if err := ociMaker.BuildOciImage(); err != nil {
+		return fmt.Errorf("failed to build oci image: %w", err)
+	}
+	if err := ociMaker.CleanOciRootfs(); err != nil {
+		return fmt.Errorf("failed to clean oci rootfs: %w", err)
+	}
+
+	displayImageArtifacts(ociMaker.ImageBuildDir, "OCI")
+
+	return nil
+}
+
+func (p *debian13) buildTarImage(template *config.ImageTemplate) error {
+	// Create TarMaker with template (dependency injection)
+	tarMaker, err := tarmaker.NewTarMaker(p.chrootEnv, template)
+	if err != nil {
+		return fmt.Errorf("failed to create tar maker: %w", err)
+	}
+
+	// Use the maker
+	if err := tarMaker.Init(); err != nil {
+		return fmt.Errorf("failed to initialize tar image maker: %w", err)
+	}
+	if err := tarMaker.BuildTarImage(); err != nil {
+		return fmt.Errorf("failed to build tar image: %w", err)
+	}
+	if err := tarMaker.CleanTarRootfs(); err != nil {
+		return fmt.Errorf("failed to clean tar rootfs: %w", err)
+	}
+
+	displayImageArtifacts(tarMaker.ImageBuildDir, "TAR")
+
+	return nil
+}
+
+func (p *debian13) buildPxeImage(template *config.ImageTemplate) error {
+	// Create PxeMaker with template (dependency injection)
+	pxeMaker, err := pxemaker.NewPxeMaker(p.chrootEnv, template)
+	if err != nil {
+		return fmt.Errorf("failed to create pxe maker: %w", err)
+	}
+
+	// Use the maker
+	if err := pxeMaker.Init(); err != nil {
+		return fmt.Errorf("failed to initialize pxe image maker: %w", err)
+	}
+	if err := pxeMaker.BuildPxeImage(); err != nil {
+		return fmt.Errorf("failed to build pxe image: %w", err)
+	}
+	if err := pxeMaker.CleanPxeRootfs(); err != nil {
+		return fmt.Errorf("failed to clean pxe rootfs: %w", err)
+	}
+
+	displayImageArtifacts(pxeMaker.ImageBuildDir, "PXE")
+
+	return nil
+}
+
 func (p *debian13) buildIsoImage(template *config.ImageTemplate) error {
 	// Create IsoMaker with template (dependency injection)
 	isoMaker, err := isomaker.NewIsoMaker(p.chrootEnv, template)
@@ -210,11 +303,14 @@ func (p *debian13) buildIsoImage(template *config.ImageTemplate) error {
 }
 
 func (p *debian13) PostProcess(template *config.ImageTemplate, err error) error {
+	if p.chrootEnv == nil {
+		return provider.ChrootNotInitializedError(err)
+	}
 	if err := p.chrootEnv.CleanupChrootEnv(template.Target.OS,
 		template.Target.Dist, template.Target.Arch); err != nil {
 		return fmt.Errorf("failed to cleanup chroot environment: %w", err)
 	}
-	return nil
+	return err
 }
 
 func (p *debian13) installHostDependency() error {
@@ -236,6 +332,9 @@ func (p *debian13) installHostDependency() error {
 	if err != nil {
 		return fmt.Errorf("failed to get host package manager: %w", err)
 	}
+	if err := system.CheckHostPkgTools(hostPkgManager, dependencyInfo); err != nil {
+		return err
+	}
 
 	for cmd, pkg := range dependencyInfo {
 		cmdExist, err := shell.IsCommandExist(cmd, shell.HostPath)
@@ -256,6 +355,9 @@ func (p *debian13) installHostDependency() error {
 }
 
 func (p *debian13) downloadImagePkgs(template *config.ImageTemplate) error {
+	if len(p.repoCfgs) == 0 {
+		return provider.ErrNotInitialized
+	}
 	if err := p.chrootEnv.UpdateSystemPkgs(template); err != nil {
 		return fmt.Errorf("failed to update system packages: %w", err)
 	}
@@ -268,11 +370,6 @@ func (p *debian13) downloadImagePkgs(template *config.ImageTemplate) error {
 	}
 	pkgCacheDir := filepath.Join(globalCache, "pkgCache", providerId)
 
-	// Configure multiple repositories
-	if len(p.repoCfgs) == 0 {
-		return fmt.Errorf("no repository configurations available")
-	}
-
 	// Get user repositories from template
 	userRepos := template.GetPackageRepositories()
 
@@ -307,7 +404,11 @@ func (p *debian13) downloadImagePkgs(template *config.ImageTemplate) error {
 			i+1, cfg.Name, cfg.PkgList, cfg.PkgPrefix, cfg.Priority)
 	}
 
-	fullPkgList, fullPkgListBom, err := debutils.DownloadPackagesComplete(pkgList, pkgCacheDir, template.DotFilePath, pkgSources, template.DotSystemOnly)
+	debutils.Explain = template.ExplainResolve
+	defer func() { debutils.Explain = false }()
+
+	fullPkgList, fullPkgListBom, err := debutils.DownloadPackagesComplete(pkgList, pkgCacheDir, template.DotFilePath, pkgSources, template.DotSystemOnly,
+		provider.BuildSpaceCheck(template))
 	if err != nil {
 		return fmt.Errorf("failed to download packages: %w", err)
 	}
@@ -331,7 +432,7 @@ func buildUserRepoList(userRepos []config.PackageRepository) []debutils.Reposito
 			ID:            fmt.Sprintf("user-%s", baseURL),
 			Codename:      userRepo.Codename,
 			URL:           userRepo.URL,
-			PKey:          userRepo.PKey,
+			PKey:          userRepo.ReleaseKey(),
 			Component:     userRepo.Component,
 			Priority:      userRepo.Priority,
 			AllowPackages: userRepo.AllowPackages,
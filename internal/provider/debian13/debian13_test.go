@@ -1,6 +1,7 @@
 package debian13
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -239,10 +240,10 @@ func (m *mockChrootEnv) InitChrootEnv(targetOs, targetDist, targetArch string) e
 	return nil
 }
 func (m *mockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string) error { return nil }
-func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return nil
 }
-func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return nil
 }
 func (m *mockChrootEnv) UpdateSystemPkgs(template *config.ImageTemplate) error { return nil }
@@ -486,7 +487,7 @@ func TestDebian13ProviderPostProcess(t *testing.T) {
 		t.Logf("PostProcess failed as expected due to chroot cleanup dependencies: %v", err)
 	}
 
-	// Test with input error - PostProcess should clean up and return nil (not the input error)
+	// Test with input error - PostProcess should clean up and return the input error
 	inputError := fmt.Errorf("some build error")
 	err = debian.PostProcess(template, inputError)
 	if err != nil {
@@ -494,6 +495,37 @@ func TestDebian13ProviderPostProcess(t *testing.T) {
 	}
 }
 
+// TestDebian13PostProcessWithNilChroot tests PostProcess returns an error with nil chrootEnv
+func TestDebian13PostProcessWithNilChroot(t *testing.T) {
+	debian := &debian13{}
+	template := createTestImageTemplate()
+
+	err := debian.PostProcess(template, nil)
+	if !errors.Is(err, provider.ErrChrootNotInitialized) {
+		t.Errorf("Expected chroot environment not initialized error, got: %v", err)
+	}
+
+	// A build error, such as the failed Init, is kept
+	err = debian.PostProcess(template, fmt.Errorf("init failed"))
+	if !errors.Is(err, provider.ErrChrootNotInitialized) || !strings.Contains(err.Error(), "init failed") {
+		t.Errorf("Expected the build error and chroot environment not initialized error, got: %v", err)
+	}
+}
+
+// TestDebian13PostProcessReturnsInputError tests that PostProcess keeps the
+// build error once the chroot environment is cleaned up
+func TestDebian13PostProcessReturnsInputError(t *testing.T) {
+	debian := &debian13{chrootEnv: &mockChrootEnv{}}
+	inputErr := fmt.Errorf("image build failed")
+
+	if err := debian.PostProcess(createTestImageTemplate(), inputErr); err != inputErr {
+		t.Errorf("Expected PostProcess to return input error, got: %v", err)
+	}
+	if err := debian.PostProcess(createTestImageTemplate(), nil); err != nil {
+		t.Errorf("Expected nil error when input error is nil, got: %v", err)
+	}
+}
+
 // TestDebian13ProviderInstallHostDependency tests installHostDependency method
 func TestDebian13ProviderInstallHostDependency(t *testing.T) {
 	// Save original shell executor and restore after test
@@ -819,17 +851,11 @@ func TestDebian13PostProcessErrorHandling(t *testing.T) {
 
 	t.Logf("PostProcess method has correct signature: %T", postProcessFunc)
 
-	// Test that PostProcess with nil chrootEnv will panic - catch and validate
-	defer func() {
-		if r := recover(); r != nil {
-			t.Logf("PostProcess correctly panicked with nil chrootEnv: %v", r)
-		} else {
-			t.Error("Expected PostProcess to panic with nil chrootEnv")
-		}
-	}()
-
-	// This will panic due to nil chrootEnv, which we catch above
-	_ = debian.PostProcess(template, inputError)
+	// PostProcess with nil chrootEnv returns an error keeping the build error
+	err := debian.PostProcess(template, inputError)
+	if !errors.Is(err, provider.ErrChrootNotInitialized) || !errors.Is(err, inputError) {
+		t.Errorf("Expected the build error and chroot environment not initialized error, got: %v", err)
+	}
 }
 
 // TestDebian13DownloadImagePkgs tests downloadImagePkgs method structure
@@ -855,8 +881,8 @@ func TestDebian13DownloadImagePkgs(t *testing.T) {
 	if err != nil {
 		t.Logf("downloadImagePkgs failed as expected due to external dependencies: %v", err)
 		// Verify error messages to ensure proper error handling
-		if strings.Contains(err.Error(), "no repository configurations available") {
-			t.Error("Repository configurations were provided but still got 'no repository configurations' error")
+		if errors.Is(err, provider.ErrNotInitialized) {
+			t.Error("Repository configurations were provided but still got provider not initialized error")
 		}
 	} else {
 		// If successful, verify that template.FullPkgList was populated
@@ -895,9 +921,9 @@ func TestDebian13MultipleRepositories(t *testing.T) {
 	err := debian.downloadImagePkgs(template)
 	if err != nil {
 		t.Logf("downloadImagePkgs with multiple repos failed as expected: %v", err)
-		// Should not fail due to "no repository configurations available"
-		if strings.Contains(err.Error(), "no repository configurations available") {
-			t.Error("Should not get 'no repository configurations' error when multiple repos are configured")
+		// Should not fail due to provider not initialized
+		if errors.Is(err, provider.ErrNotInitialized) {
+			t.Error("Should not get provider not initialized error when multiple repos are configured")
 		}
 	} else {
 		t.Logf("downloadImagePkgs with multiple repositories succeeded")
@@ -1082,8 +1108,16 @@ func TestDebian13DownloadImagePkgsNoRepos(t *testing.T) {
 	err := debian.downloadImagePkgs(template)
 	if err == nil {
 		t.Error("Expected downloadImagePkgs to fail with no repositories")
-	} else if !strings.Contains(err.Error(), "no repository configurations available") {
-		t.Errorf("Expected 'no repository configurations available' error, got: %v", err)
+	} else if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("Expected provider not initialized error, got: %v", err)
+	}
+}
+
+// TestDebian13DownloadImagePkgsNotInitialized tests a provider Init was not called on
+func TestDebian13DownloadImagePkgsNotInitialized(t *testing.T) {
+	err := (&debian13{}).downloadImagePkgs(createTestImageTemplate())
+	if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("Expected provider not initialized error, got: %v", err)
 	}
 }
 
@@ -1466,7 +1500,7 @@ func TestDebian13PreProcessDownloadPackagesError(t *testing.T) {
 	err := debian.PreProcess(template)
 	if err != nil {
 		// Should fail at downloadImagePkgs due to missing repos
-		if strings.Contains(err.Error(), "no repository configurations available") ||
+		if errors.Is(err, provider.ErrNotInitialized) ||
 			strings.Contains(err.Error(), "failed to download image packages") ||
 			strings.Contains(err.Error(), "failed to install host dependency") {
 			t.Logf("PreProcess failed as expected at download packages: %v", err)
@@ -1840,8 +1874,8 @@ func TestDebian13DownloadImagePkgsWithFullTemplate(t *testing.T) {
 	if err != nil {
 		t.Logf("downloadImagePkgs failed as expected: %v", err)
 		// Should not fail due to missing repo configs
-		if strings.Contains(err.Error(), "no repository configurations available") {
-			t.Error("Should not get 'no repository configurations' error when repos are configured")
+		if errors.Is(err, provider.ErrNotInitialized) {
+			t.Error("Should not get provider not initialized error when repos are configured")
 		}
 	} else {
 		// Verify template fields are populated
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/imagedisc"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
+)
+
+// RootfsOverheadFactor estimates the installed size of the image rootfs as a
+// multiple of the compressed size of its packages.
+const RootfsOverheadFactor = 3
+
+// buildSpaceMargin is the safety margin added to the space a build needs.
+const buildSpaceMargin = 0.20
+
+// BuildSpaceCheck returns the space check to download the packages of
+// template with: it makes sure the package cache can hold the packages that
+// still have to be downloaded and the work directory can hold the rootfs and
+// the disk image of template.
+func BuildSpaceCheck(template *config.ImageTemplate) ospackage.SpaceCheck {
+	return func(pkgs []ospackage.PackageInfo, destDir string) error {
+		workDir, err := config.WorkDir()
+		if err != nil {
+			return fmt.Errorf("failed to get global work directory: %w", err)
+		}
+		return file.CheckDiskSpace(buildSpaceMargin, estimateBuildSpace(template, pkgs, destDir, workDir)...)
+	}
+}
+
+// estimateBuildSpace lists the space a build of template needs once pkgs have
+// been resolved. Packages already present in destDir are not downloaded again;
+// sizes missing from the repository metadata count as zero. The disk image is
+// sized after its A/B layout, if any, is applied.
+func estimateBuildSpace(template *config.ImageTemplate, pkgs []ospackage.PackageInfo, destDir, workDir string) []file.DiskSpaceRequirement {
+	log := logger.Logger()
+
+	var downloadBytes, packageBytes int64
+	for _, pkg := range pkgs {
+		if pkg.Size <= 0 {
+			continue
+		}
+		packageBytes += pkg.Size
+		if _, err := os.Stat(filepath.Join(destDir, path.Base(pkg.URL))); err == nil {
+			continue
+		}
+		downloadBytes += pkg.Size
+	}
+
+	// The slot B partitions of an A/B layout are only added to the disk when
+	// it is created, so apply the layout to a copy to size the disk image
+	disk := template.Disk
+	if err := imagedisc.ApplyABLayout(&disk); err != nil {
+		log.Warnf("Ignoring A/B disk layout in disk space estimate: %v", err)
+		disk = template.Disk
+	}
+
+	var imageBytes int64
+	if disk.Size != "" {
+		size, err := imagedisc.TranslateSizeStrToBytes(disk.Size)
+		if err != nil {
+			log.Warnf("Ignoring disk size %q in disk space estimate: %v", disk.Size, err)
+		} else {
+			imageBytes = int64(size)
+		}
+	}
+
+	return []file.DiskSpaceRequirement{
+		{Path: destDir, Bytes: downloadBytes, Purpose: "package downloads"},
+		{Path: workDir, Bytes: packageBytes * RootfsOverheadFactor, Purpose: "image rootfs"},
+		{Path: workDir, Bytes: imageBytes, Purpose: "disk image"},
+	}
+}
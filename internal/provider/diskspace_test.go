@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/ospackage"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+)
+
+const mib = 1024 * 1024
+
+func testSpacePackages() []ospackage.PackageInfo {
+	return []ospackage.PackageInfo{
+		{Name: "bash", URL: "http://example.com/pool/bash_5.2_amd64.deb", Size: 100 * mib},
+		{Name: "coreutils", URL: "http://example.com/pool/coreutils_9.1_amd64.deb", Size: 200 * mib},
+		{Name: "unknown-size", URL: "http://example.com/pool/unknown_1.0_amd64.deb"},
+	}
+}
+
+func TestEstimateBuildSpace(t *testing.T) {
+	cacheDir := t.TempDir()
+	workDir := t.TempDir()
+	// bash is already cached and will not be downloaded again
+	if err := os.WriteFile(filepath.Join(cacheDir, "bash_5.2_amd64.deb"), []byte("cached"), 0644); err != nil {
+		t.Fatalf("Failed to create cached package: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		disk     config.DiskConfig
+		expected []file.DiskSpaceRequirement
+	}{
+		{
+			name: "raw_image",
+			disk: config.DiskConfig{Size: "4GiB"},
+			expected: []file.DiskSpaceRequirement{
+				{Path: cacheDir, Bytes: 200 * mib, Purpose: "package downloads"},
+				{Path: workDir, Bytes: 300 * mib * RootfsOverheadFactor, Purpose: "image rootfs"},
+				{Path: workDir, Bytes: 4096 * mib, Purpose: "disk image"},
+			},
+		},
+		{
+			// The 2GiB slot B copy of the root partition grows the disk
+			name: "ab_layout",
+			disk: config.DiskConfig{
+				Size:               "4GiB",
+				PartitionTableType: "gpt",
+				Layout:             config.DiskLayoutAB,
+				Partitions: []config.PartitionInfo{
+					{ID: "esp", Type: "esp", Start: "1MiB", End: "513MiB", FsType: "fat32", MountPoint: "/boot/efi"},
+					{ID: "rootfs", Type: "linux-root-amd64", Start: "513MiB", End: "2561MiB", FsType: "ext4", MountPoint: "/"},
+				},
+			},
+			expected: []file.DiskSpaceRequirement{
+				{Path: cacheDir, Bytes: 200 * mib, Purpose: "package downloads"},
+				{Path: workDir, Bytes: 300 * mib * RootfsOverheadFactor, Purpose: "image rootfs"},
+				{Path: workDir, Bytes: 6144 * mib, Purpose: "disk image"},
+			},
+		},
+		{
+			name: "no_disk",
+			expected: []file.DiskSpaceRequirement{
+				{Path: cacheDir, Bytes: 200 * mib, Purpose: "package downloads"},
+				{Path: workDir, Bytes: 300 * mib * RootfsOverheadFactor, Purpose: "image rootfs"},
+				{Path: workDir, Bytes: 0, Purpose: "disk image"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &config.ImageTemplate{Disk: tt.disk}
+			got := estimateBuildSpace(template, testSpacePackages(), cacheDir, workDir)
+			if !reflect.DeepEqual(template.Disk, tt.disk) {
+				t.Errorf("Expected the template disk to be left unchanged, got %+v", template.Disk)
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %d requirements, got %+v", len(tt.expected), got)
+			}
+			for i := range tt.expected {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Requirement %d: expected %+v, got %+v", i, tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildSpaceCheck(t *testing.T) {
+	originalFilesystemSpace := file.FilesystemSpace
+	originalConfig := config.Global()
+	originalWorkDir := originalConfig.WorkDir
+	defer func() {
+		file.FilesystemSpace = originalFilesystemSpace
+		originalConfig.WorkDir = originalWorkDir
+		config.SetGlobal(originalConfig)
+	}()
+
+	cacheDir := t.TempDir()
+	currentConfig := config.Global()
+	currentConfig.WorkDir = t.TempDir()
+	config.SetGlobal(currentConfig)
+
+	// 300 MiB of packages and a 4 GiB disk need 300 MiB + 900 MiB + 4 GiB,
+	// plus the safety margin, when the cache and work directory share a
+	// filesystem
+	template := &config.ImageTemplate{Disk: config.DiskConfig{Size: "4GiB"}}
+
+	tests := []struct {
+		name        string
+		available   uint64
+		expectError bool
+	}{
+		{name: "fits", available: 7 * 1024 * mib},
+		{name: "does_not_fit", available: 6 * 1024 * mib, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file.FilesystemSpace = func(path string) (uint64, uint64, error) {
+				return 1, tt.available, nil
+			}
+
+			err := BuildSpaceCheck(template)(testSpacePackages(), cacheDir)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected the build to be refused, got nil")
+				}
+				for _, want := range []string{"insufficient disk space", "short by 211.20 MiB", "package downloads", "disk image"} {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Expected error to contain %q, got %q", want, err.Error())
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package elxr
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -231,10 +232,10 @@ func (m *mockChrootEnv) InitChrootEnv(targetOs, targetDist, targetArch string) e
 	return nil
 }
 func (m *mockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string) error { return nil }
-func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return nil
 }
-func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return nil
 }
 func (m *mockChrootEnv) UpdateSystemPkgs(template *config.ImageTemplate) error { return nil }
@@ -434,7 +435,7 @@ func TestElxrProviderPostProcess(t *testing.T) {
 		t.Logf("PostProcess failed as expected due to chroot cleanup dependencies: %v", err)
 	}
 
-	// Test with input error - PostProcess should clean up and return nil (not the input error)
+	// Test with input error - PostProcess should clean up and return the input error
 	inputError := fmt.Errorf("some build error")
 	err = elxr.PostProcess(template, inputError)
 	if err != nil {
@@ -744,17 +745,11 @@ func TestElxrPostProcessErrorHandling(t *testing.T) {
 
 	t.Logf("PostProcess method has correct signature: %T", postProcessFunc)
 
-	// Test that PostProcess with nil chrootEnv will panic - catch and validate
-	defer func() {
-		if r := recover(); r != nil {
-			t.Logf("PostProcess correctly panicked with nil chrootEnv: %v", r)
-		} else {
-			t.Error("Expected PostProcess to panic with nil chrootEnv")
-		}
-	}()
-
-	// This will panic due to nil chrootEnv, which we catch above
-	_ = elxr.PostProcess(template, inputError)
+	// PostProcess with nil chrootEnv returns an error keeping the build error
+	err := elxr.PostProcess(template, inputError)
+	if !errors.Is(err, provider.ErrChrootNotInitialized) || !errors.Is(err, inputError) {
+		t.Errorf("Expected the build error and chroot environment not initialized error, got: %v", err)
+	}
 }
 
 // TestElxrPreProcessWithMockEnv tests PreProcess with proper mock chrootEnv
@@ -819,13 +814,16 @@ func TestElxrDownloadImagePkgsNoRepos(t *testing.T) {
 	template := createTestImageTemplate()
 
 	err := elxr.downloadImagePkgs(template)
-	if err == nil {
-		t.Error("Expected error when no repositories configured")
+	if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("Expected provider not initialized error, got: %v", err)
 	}
+}
 
-	expectedError := "no repository configurations available"
-	if !strings.Contains(err.Error(), expectedError) {
-		t.Errorf("Expected error containing '%s', got: %v", expectedError, err)
+// TestElxrDownloadImagePkgsNotInitialized tests a provider Init was not called on
+func TestElxrDownloadImagePkgsNotInitialized(t *testing.T) {
+	err := (&eLxr{}).downloadImagePkgs(createTestImageTemplate())
+	if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("Expected provider not initialized error, got: %v", err)
 	}
 }
 
@@ -897,11 +895,17 @@ func TestElxrPostProcessSuccess(t *testing.T) {
 
 	template := createTestImageTemplate()
 
-	// Test with no input error - PostProcess should only return cleanup errors
+	// Test with no input error
 	err := elxr.PostProcess(template, nil)
 	if err != nil {
-		// PostProcess currently doesn't propagate the input error, only cleanup errors
-		t.Logf("PostProcess returned error: %v", err)
+		t.Errorf("Expected nil error when input error is nil, got: %v", err)
+	}
+
+	// Test with input error - should return the same error
+	inputErr := fmt.Errorf("build failed")
+	err = elxr.PostProcess(template, inputErr)
+	if err != inputErr {
+		t.Errorf("Expected PostProcess to return input error, got: %v", err)
 	}
 }
 
@@ -1144,6 +1148,7 @@ func TestElxrInstallHostDependencyInstallError(t *testing.T) {
 
 	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
 		{Pattern: "command -v .*", Output: "", Error: fmt.Errorf("missing")},
+		{Pattern: "apt-cache policy .*", Output: "  Candidate: 1.0\n", Error: nil},
 		{Pattern: "sudo apt install -y .*", Output: "", Error: fmt.Errorf("install failed")},
 	})
 
@@ -1161,7 +1166,10 @@ func TestElxrInstallHostDependencyInstallError(t *testing.T) {
 }
 
 func TestElxrDownloadImagePkgsUpdateSystemError(t *testing.T) {
-	elxr := &eLxr{chrootEnv: &mockElxrUpdateErrEnv{err: fmt.Errorf("update failed")}}
+	elxr := &eLxr{
+		chrootEnv: &mockElxrUpdateErrEnv{err: fmt.Errorf("update failed")},
+		repoCfgs:  []debutils.RepoConfig{{Name: "Test Repo"}},
+	}
 
 	err := elxr.downloadImagePkgs(createTestImageTemplate())
 	if err == nil {
@@ -9,7 +9,10 @@ import (
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/image/initrdmaker"
 	"github.com/open-edge-platform/image-composer-tool/internal/image/isomaker"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/ocimaker"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/pxemaker"
 	"github.com/open-edge-platform/image-composer-tool/internal/image/rawmaker"
+	"github.com/open-edge-platform/image-composer-tool/internal/image/tarmaker"
 	"github.com/open-edge-platform/image-composer-tool/internal/ospackage/rpmutils"
 	"github.com/open-edge-platform/image-composer-tool/internal/provider"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/display"
@@ -50,6 +53,18 @@ func (p *Emt) Name(dist, arch string) string {
 	return system.GetProviderId(OsName, dist, arch)
 }
 
+// Capabilities returns the image types, architectures, boot modes and
+// features the provider supports
+func (p *Emt) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		ImageTypes: []string{"raw", "img", "iso", "oci", "tar", "pxe"},
+		// Only an x86_64 package repository is published for EMT
+		Arches:    []string{"x86_64"},
+		BootModes: []string{"efi", "legacy"},
+		Features:  []string{provider.FeatureUKI, provider.FeatureImmutability, provider.FeatureSecureBoot},
+	}
+}
+
 // Init will initialize the provider, using centralized config with secure HTTP
 func (p *Emt) Init(dist, arch string) error {
 	// Load centralized YAML configuration first
@@ -60,16 +75,15 @@ func (p *Emt) Init(dist, arch string) error {
 	}
 
 	// Use secure HTTP to fetch repository metadata from the centralized config URL
-	// Note: rpmutils.FetchPrimaryURL internally uses network.NewSecureHTTPClient() for secure HTTPS communication
-	repoDataURL := cfg.URL + "/" + repodata
-	href, err := rpmutils.FetchPrimaryURL(repoDataURL)
-	if err != nil {
-		log.Errorf("Fetch primary.xml.zst failed from %s: %v", repoDataURL, err)
+	// Note: the rpm repository client uses network.NewSecureHTTPClient() for secure HTTPS communication
+	repoClient := rpmutils.NewRepoClient(cfg)
+	if err := repoClient.FetchMetadata(); err != nil {
+		log.Errorf("Fetch primary.xml.zst failed from %s: %v", repoClient.ResolveURL(repodata), err)
 		return err
 	}
 
 	p.repoCfg = cfg
-	p.zstHref = href
+	p.zstHref = repoClient.PrimaryHref()
 
 	log.Infof("EMT provider initialized for dist=%s, arch=%s", dist, arch)
 	log.Infof("repo section=%s", cfg.Section)
@@ -92,7 +106,7 @@ func (p *Emt) PreProcess(template *config.ImageTemplate) error {
 	}
 
 	template.StartDownloadImagePkgsTimer()
-	if err := p.downloadImagePkgs(template); err != nil {
+	if err := provider.RunDownloadStage(template, func() error { return p.downloadImagePkgs(template) }); err != nil {
 		template.FinishDownloadImagePkgsTimer()
 		return fmt.Errorf("failed to download image packages: %w", err)
 	}
@@ -113,6 +127,10 @@ func (p *Emt) BuildImage(template *config.ImageTemplate) error {
 		return fmt.Errorf("template cannot be nil")
 	}
 
+	if err := p.Capabilities().Validate(template); err != nil {
+		return err
+	}
+
 	log.Infof("Building image: %s", template.GetImageName())
 
 	// Create makers with template when needed
@@ -123,6 +141,12 @@ func (p *Emt) BuildImage(template *config.ImageTemplate) error {
 		return p.buildInitrdImage(template)
 	case "iso":
 		return p.buildIsoImage(template)
+	case "oci":
+		return p.buildOciImage(template)
+	case "tar":
+		return p.buildTarImage(template)
+	case "pxe":
+		return p.buildPxeImage(template)
 	default:
 		return fmt.Errorf("unsupported image type: %s", template.Target.ImageType)
 	}
@@ -188,6 +212,75 @@ func (p *Emt) buildInitrdImage(template *config.ImageTemplate) error {
 	return nil
 }
 
+func (p *Emt) buildOciImage(template *config.ImageTemplate) error {
+	// Create OciMaker with template (dependency injection)
+	ociMaker, err := ocimaker.NewOciMaker(p.chrootEnv, template)
+	if err != nil {
+		return fmt.Errorf("failed to create oci maker: %w", err)
+	}
+
+	// Use the maker
+	if err := ociMaker.Init(); err != nil {
+		return fmt.Errorf("failed to initialize oci image maker: %w", err)
+	}
+	if err := ociMaker.BuildOciImage(); err != nil {
+		return fmt.Errorf("failed to build oci image: %w", err)
+	}
+	if err := ociMaker.CleanOciRootfs(); err != nil {
+		return fmt.Errorf("failed to clean oci rootfs: %w", err)
+	}
+
+	displayImageArtifacts(ociMaker.ImageBuildDir, "OCI")
+
+	return nil
+}
+
+func (p *Emt) buildTarImage(template *config.ImageTemplate) error {
+	// Create TarMaker with template (dependency injection)
+	tarMaker, err := tarmaker.NewTarMaker(p.chrootEnv, template)
+	if err != nil {
+		return fmt.Errorf("failed to create tar maker: %w", err)
+	}
+
+	// Use the maker
+	if err := tarMaker.Init(); err != nil {
+		return fmt.Errorf("failed to initialize tar image maker: %w", err)
+	}
+	if err := tarMaker.BuildTarImage(); err != nil {
+		return fmt.Errorf("failed to build tar image: %w", err)
+	}
+	if err := tarMaker.CleanTarRootfs(); err != nil {
+		return fmt.Errorf("failed to clean tar rootfs: %w", err)
+	}
+
+	displayImageArtifacts(tarMaker.ImageBuildDir, "TAR")
+
+	return nil
+}
+
+func (p *Emt) buildPxeImage(template *config.ImageTemplate) error {
+	// Create PxeMaker with template (dependency injection)
+	pxeMaker, err := pxemaker.NewPxeMaker(p.chrootEnv, template)
+	if err != nil {
+		return fmt.Errorf("failed to create pxe maker: %w", err)
+	}
+
+	// Use the maker
+	if err := pxeMaker.Init(); err != nil {
+		return fmt.Errorf("failed to initialize pxe image maker: %w", err)
+	}
+	if err := pxeMaker.BuildPxeImage(); err != nil {
+		return fmt.Errorf("failed to build pxe image: %w", err)
+	}
+	if err := pxeMaker.CleanPxeRootfs(); err != nil {
+		return fmt.Errorf("failed to clean pxe rootfs: %w", err)
+	}
+
+	displayImageArtifacts(pxeMaker.ImageBuildDir, "PXE")
+
+	return nil
+}
+
 func (p *Emt) buildIsoImage(template *config.ImageTemplate) error {
 	// Create IsoMaker with template (dependency injection)
 	isoMaker, err := isomaker.NewIsoMaker(p.chrootEnv, template)
@@ -219,6 +312,9 @@ func (p *Emt) buildIsoImage(template *config.ImageTemplate) error {
 }
 
 func (p *Emt) PostProcess(template *config.ImageTemplate, err error) error {
+	if p.chrootEnv == nil {
+		return provider.ChrootNotInitializedError(err)
+	}
 	if err := p.chrootEnv.CleanupChrootEnv(template.Target.OS,
 		template.Target.Dist, template.Target.Arch); err != nil {
 		return fmt.Errorf("failed to cleanup chroot environment: %w", err)
@@ -240,6 +336,9 @@ func (p *Emt) installHostDependency() error {
 	if err != nil {
 		return fmt.Errorf("failed to get host package manager: %w", err)
 	}
+	if err := system.CheckHostPkgTools(hostPkgManager, dependencyInfo); err != nil {
+		return err
+	}
 
 	for cmd, pkg := range dependencyInfo {
 		cmdExist, err := shell.IsCommandExist(cmd, shell.HostPath)
@@ -260,6 +359,9 @@ func (p *Emt) installHostDependency() error {
 }
 
 func (p *Emt) downloadImagePkgs(template *config.ImageTemplate) error {
+	if p.zstHref == "" {
+		return provider.ErrNotInitialized
+	}
 	if err := p.chrootEnv.UpdateSystemPkgs(template); err != nil {
 		return fmt.Errorf("failed to update system packages: %w", err)
 	}
@@ -277,7 +379,8 @@ func (p *Emt) downloadImagePkgs(template *config.ImageTemplate) error {
 
 	rpmutils.UserRepo = template.GetPackageRepositories()
 
-	fullPkgList, fullPkgListBom, err := rpmutils.DownloadPackagesComplete(pkgList, pkgCacheDir, template.DotFilePath, pkgSources, template.DotSystemOnly)
+	fullPkgList, fullPkgListBom, err := rpmutils.DownloadPackagesComplete(pkgList, pkgCacheDir, template.DotFilePath, pkgSources, template.DotSystemOnly,
+		provider.BuildSpaceCheck(template))
 	if err != nil {
 		return fmt.Errorf("failed to download packages: %w", err)
 	}
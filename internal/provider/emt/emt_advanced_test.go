@@ -10,6 +10,7 @@ import (
 
 	"github.com/open-edge-platform/image-composer-tool/internal/chroot"
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
 )
@@ -74,11 +75,11 @@ func (m *mockEmtChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch str
 	return m.cleanupErr
 }
 
-func (m *mockEmtChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockEmtChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return nil
 }
 
-func (m *mockEmtChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockEmtChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return nil
 }
 
@@ -274,6 +275,7 @@ func TestEmtInstallHostDependencyInstallFailure(t *testing.T) {
 func TestEmtDownloadImagePkgsUpdateError(t *testing.T) {
 	provider := &Emt{
 		chrootEnv: &mockEmtChrootEnv{updateSystemPkgsErr: errors.New("update failed")},
+		zstHref:   "repodata/primary.xml.zst",
 	}
 
 	err := provider.downloadImagePkgs(createTestImageTemplate())
@@ -286,11 +288,18 @@ func TestEmtDownloadImagePkgsUpdateError(t *testing.T) {
 	}
 }
 
+func TestEmtDownloadImagePkgsNotInitialized(t *testing.T) {
+	err := (&Emt{}).downloadImagePkgs(createTestImageTemplate())
+	if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("expected provider not initialized error, got %v", err)
+	}
+}
+
 func TestEmtDownloadImagePkgsDownloadFailure(t *testing.T) {
 	setTempGlobalDirs(t)
 
 	mockEnv := &mockEmtChrootEnv{}
-	provider := &Emt{chrootEnv: mockEnv}
+	provider := &Emt{chrootEnv: mockEnv, zstHref: "repodata/primary.xml.zst"}
 
 	err := provider.downloadImagePkgs(createTestImageTemplate())
 	if err == nil {
@@ -337,7 +346,7 @@ func TestEmtPreProcessDownloadError(t *testing.T) {
 	})
 
 	mockEnv := &mockEmtChrootEnv{}
-	provider := &Emt{chrootEnv: mockEnv}
+	provider := &Emt{chrootEnv: mockEnv, zstHref: "repodata/primary.xml.zst"}
 
 	err := provider.PreProcess(createTestImageTemplate())
 	if err == nil {
@@ -1,6 +1,7 @@
 package emt
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -614,23 +615,21 @@ func TestEmtBuildIsoImageMethod(t *testing.T) {
 	}
 }
 
-// TestEmtPostProcessWithNilChroot tests PostProcess with nil chrootEnv
+// TestEmtPostProcessWithNilChroot tests PostProcess returns an error with nil chrootEnv
 func TestEmtPostProcessWithNilChroot(t *testing.T) {
 	emt := &Emt{}
 	template := createTestImageTemplate()
 
-	// Test that PostProcess panics with nil chrootEnv (current behavior)
-	// We use defer/recover to catch the panic and validate it
-	defer func() {
-		if r := recover(); r != nil {
-			t.Logf("PostProcess correctly panicked with nil chrootEnv: %v", r)
-		} else {
-			t.Error("Expected PostProcess to panic with nil chrootEnv")
-		}
-	}()
+	err := emt.PostProcess(template, nil)
+	if !errors.Is(err, provider.ErrChrootNotInitialized) {
+		t.Errorf("Expected chroot environment not initialized error, got: %v", err)
+	}
 
-	// This will panic due to nil chrootEnv
-	_ = emt.PostProcess(template, nil)
+	// A build error, such as the failed Init, is kept
+	err = emt.PostProcess(template, fmt.Errorf("init failed"))
+	if !errors.Is(err, provider.ErrChrootNotInitialized) || !strings.Contains(err.Error(), "init failed") {
+		t.Errorf("Expected the build error and chroot environment not initialized error, got: %v", err)
+	}
 }
 
 // TestEmtPostProcessActual tests the actual PostProcess method call
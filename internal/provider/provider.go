@@ -1,7 +1,12 @@
 package provider
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/slice"
 )
 
 // Provider is the interface every OSV plugin must implement.
@@ -20,6 +25,93 @@ type Provider interface {
 
 	// PostProcess does any final steps after the image is built.
 	PostProcess(template *config.ImageTemplate, err error) error
+
+	// Capabilities reports the image types, architectures, boot modes and
+	// features the provider supports.
+	Capabilities() Capabilities
+}
+
+// ErrNotInitialized is returned when a provider is asked for its packages
+// before a successful Init loaded its repository configuration.
+var ErrNotInitialized = errors.New("provider not initialized: Init must succeed before packages can be resolved")
+
+// ErrChrootNotInitialized is returned by PostProcess when there is no chroot
+// environment to clean up, because Init was not called or failed.
+var ErrChrootNotInitialized = errors.New("chroot environment not initialized")
+
+// ChrootNotInitializedError returns the error of a PostProcess without a
+// chroot environment: ErrChrootNotInitialized, after the build error err if
+// there is one, so that the reason the build failed is not hidden.
+func ChrootNotInitializedError(err error) error {
+	if err == nil {
+		return ErrChrootNotInitialized
+	}
+	return fmt.Errorf("%w; %w", err, ErrChrootNotInitialized)
+}
+
+// Optional features a provider can report in Capabilities.Features
+const (
+	FeatureUKI          = "uki"          // Unified Kernel Image boot
+	FeatureImmutability = "immutability" // dm-verity protected root filesystem
+	FeatureSecureBoot   = "secure-boot"  // UEFI Secure Boot signing
+)
+
+// Capabilities describes what a provider can build.
+type Capabilities struct {
+	ImageTypes []string // target.imageType values, e.g. "raw", "iso"
+	Arches     []string // target.arch values, e.g. "x86_64", "aarch64"
+	BootModes  []string // bootloader.bootType values, e.g. "efi", "legacy"
+	Features   []string // optional features, e.g. FeatureUKI
+}
+
+// archAliases maps Debian-style architecture names to the names used in
+// templates.
+var archAliases = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+}
+
+// SupportsArch reports whether arch is one of the supported architectures.
+// Debian-style names such as amd64 are accepted as aliases.
+func (c Capabilities) SupportsArch(arch string) bool {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	if alias, ok := archAliases[arch]; ok {
+		arch = alias
+	}
+	return slice.Contains(c.Arches, arch)
+}
+
+// HasFeature reports whether feature is one of the supported features.
+func (c Capabilities) HasFeature(feature string) bool {
+	return slice.Contains(c.Features, feature)
+}
+
+// Validate checks that the image type, architecture and boot mode requested
+// by template are supported, so a build can be rejected before any work is
+// done. An empty boot mode is left to the bootloader defaults.
+func (c Capabilities) Validate(template *config.ImageTemplate) error {
+	if template == nil {
+		return fmt.Errorf("template cannot be nil")
+	}
+	if !slice.Contains(c.ImageTypes, template.Target.ImageType) {
+		return fmt.Errorf("unsupported image type: %s", template.Target.ImageType)
+	}
+	if !c.SupportsArch(template.Target.Arch) {
+		return fmt.Errorf("unsupported architecture: %s (supported: %s)",
+			template.Target.Arch, strings.Join(c.Arches, ", "))
+	}
+	bootType := template.SystemConfig.Bootloader.BootType
+	if bootType != "" && !slice.Contains(c.BootModes, bootType) {
+		return fmt.Errorf("unsupported boot type: %s (supported: %s)",
+			bootType, strings.Join(c.BootModes, ", "))
+	}
+	if template.SystemConfig.Kernel.UKI && !c.HasFeature(FeatureUKI) {
+		return fmt.Errorf("unified kernel images are not supported by this provider")
+	}
+	if template.IsImmutabilityEnabled() && !c.HasFeature(FeatureImmutability) {
+		return fmt.Errorf("immutability is not supported by this provider")
+	}
+	return nil
 }
 
 var (
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
@@ -52,6 +53,10 @@ func (m *MockProvider) PostProcess(template *config.ImageTemplate, err error) er
 	return nil
 }
 
+func (m *MockProvider) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
 // Helper function to create a test ImageTemplate
 func createTestImageTemplate() *config.ImageTemplate {
 	return &config.ImageTemplate{
@@ -466,3 +471,54 @@ func TestProviderWorkflow(t *testing.T) {
 		}
 	}
 }
+
+func TestCapabilitiesValidate(t *testing.T) {
+	caps := Capabilities{
+		ImageTypes: []string{"raw", "iso"},
+		Arches:     []string{"x86_64"},
+		BootModes:  []string{"efi"},
+		Features:   []string{FeatureUKI},
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(template *config.ImageTemplate)
+		wantErr string
+	}{
+		{name: "supported", modify: func(template *config.ImageTemplate) {}},
+		{name: "debian arch alias", modify: func(template *config.ImageTemplate) { template.Target.Arch = "amd64" }},
+		{name: "unsupported image type", modify: func(template *config.ImageTemplate) { template.Target.ImageType = "oci" },
+			wantErr: "unsupported image type: oci"},
+		{name: "unsupported arch", modify: func(template *config.ImageTemplate) { template.Target.Arch = "aarch64" },
+			wantErr: "unsupported architecture: aarch64"},
+		{name: "unsupported boot type", modify: func(template *config.ImageTemplate) { template.SystemConfig.Bootloader.BootType = "legacy" },
+			wantErr: "unsupported boot type: legacy"},
+		{name: "uki supported", modify: func(template *config.ImageTemplate) { template.SystemConfig.Kernel.UKI = true }},
+		{name: "immutability unsupported", modify: func(template *config.ImageTemplate) { template.SystemConfig.Immutability.Enabled = true },
+			wantErr: "immutability is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := createTestImageTemplate()
+			template.Target.ImageType = "raw"
+			template.Target.Arch = "x86_64"
+			tt.modify(template)
+
+			err := caps.Validate(template)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := caps.Validate(nil); err == nil {
+		t.Error("expected error for nil template")
+	}
+}
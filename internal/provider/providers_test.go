@@ -0,0 +1,106 @@
+package provider_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/config"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider/azl"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider/debian13"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider/elxr"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider/emt"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider/rcd"
+	"github.com/open-edge-platform/image-composer-tool/internal/provider/ubuntu"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
+)
+
+// targetProviders lists every OS provider with the architectures it builds
+var targetProviders = []struct {
+	osName   string
+	dist     string
+	register func(targetOs, targetDist, targetArch string) error
+	arches   string
+}{
+	{osName: azl.OsName, dist: "azl3", register: azl.Register, arches: "x86_64,aarch64"},
+	{osName: debian13.OsName, dist: "debian13", register: debian13.Register, arches: "x86_64,aarch64"},
+	{osName: elxr.OsName, dist: "elxr12", register: elxr.Register, arches: "x86_64,aarch64"},
+	{osName: emt.OsName, dist: "emt3", register: emt.Register, arches: "x86_64"},
+	{osName: rcd.OsName, dist: "el10", register: rcd.Register, arches: "x86_64"},
+	{osName: ubuntu.OsName, dist: "ubuntu24", register: ubuntu.Register, arches: "x86_64,aarch64"},
+}
+
+// registerTargetProvider registers the provider of osName with the target
+// configurations of the repository and a temporary work directory, and
+// returns it
+func registerTargetProvider(t *testing.T, osName, dist string,
+	register func(targetOs, targetDist, targetArch string) error) provider.Provider {
+	t.Helper()
+
+	originalConfig := *config.Global()
+	t.Cleanup(func() { config.SetGlobal(&originalConfig) })
+	configDir, err := filepath.Abs(filepath.Join("..", "..", "config"))
+	if err != nil {
+		t.Fatalf("Failed to resolve the config directory: %v", err)
+	}
+	testConfig := originalConfig
+	testConfig.ConfigDir = configDir
+	testConfig.WorkDir = t.TempDir()
+	config.SetGlobal(&testConfig)
+
+	if err := register(osName, dist, "x86_64"); err != nil {
+		t.Fatalf("Failed to register the %s provider: %v", osName, err)
+	}
+	p, ok := provider.Get(system.GetProviderId(osName, dist, "x86_64"))
+	if !ok {
+		t.Fatalf("The %s provider is not registered", osName)
+	}
+	return p
+}
+
+// TestProviderCapabilities tests the capability set reported by every provider
+func TestProviderCapabilities(t *testing.T) {
+	for _, tt := range targetProviders {
+		t.Run(tt.osName, func(t *testing.T) {
+			caps := registerTargetProvider(t, tt.osName, tt.dist, tt.register).Capabilities()
+
+			if got := strings.Join(caps.ImageTypes, ","); got != "raw,img,iso,oci,tar,pxe" {
+				t.Errorf("Expected image types raw,img,iso,oci,tar,pxe, got %s", got)
+			}
+			if got := strings.Join(caps.Arches, ","); got != tt.arches {
+				t.Errorf("Expected arches %s, got %s", tt.arches, got)
+			}
+			if got := strings.Join(caps.BootModes, ","); got != "efi,legacy" {
+				t.Errorf("Expected boot modes efi,legacy, got %s", got)
+			}
+			for _, feature := range []string{provider.FeatureUKI, provider.FeatureImmutability, provider.FeatureSecureBoot} {
+				if !caps.HasFeature(feature) {
+					t.Errorf("Expected feature %s to be supported", feature)
+				}
+			}
+		})
+	}
+}
+
+// TestProviderBuildImageUnsupportedArch tests that every provider rejects an
+// unsupported architecture before building anything
+func TestProviderBuildImageUnsupportedArch(t *testing.T) {
+	for _, tt := range targetProviders {
+		t.Run(tt.osName, func(t *testing.T) {
+			p := registerTargetProvider(t, tt.osName, tt.dist, tt.register)
+
+			template := &config.ImageTemplate{
+				Image:  config.ImageInfo{Name: "test-image", Version: "1.0.0"},
+				Target: config.TargetInfo{OS: tt.osName, Dist: tt.dist, Arch: "armv7hl", ImageType: "raw"},
+			}
+			err := p.BuildImage(template)
+			if err == nil {
+				t.Fatal("Expected error for unsupported architecture")
+			}
+			if !strings.Contains(err.Error(), "unsupported architecture: armv7hl") {
+				t.Errorf("Expected unsupported architecture error, got '%s'", err.Error())
+			}
+		})
+	}
+}
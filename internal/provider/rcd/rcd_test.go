@@ -1,6 +1,7 @@
 package rcd
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -51,10 +52,10 @@ func (m *mockChrootEnv) InitChrootEnv(targetOs, targetDist, targetArch string) e
 	return nil
 }
 func (m *mockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string) error { return nil }
-func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return nil
 }
-func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return nil
 }
 func (m *mockChrootEnv) UpdateSystemPkgs(template *config.ImageTemplate) error { return nil }
@@ -550,23 +551,21 @@ func TestRCDBuildImageValidTypes(t *testing.T) {
 	}
 }
 
-// TestRCDPostProcessWithNilChroot tests PostProcess with nil chrootEnv
+// TestRCDPostProcessWithNilChroot tests PostProcess returns an error with nil chrootEnv
 func TestRCDPostProcessWithNilChroot(t *testing.T) {
 	rcd := &RCD{}
 	template := createTestImageTemplate()
 
-	// Test that PostProcess panics with nil chrootEnv (current behavior)
-	// We use defer/recover to catch the panic and validate it
-	defer func() {
-		if r := recover(); r != nil {
-			t.Logf("PostProcess correctly panicked with nil chrootEnv: %v", r)
-		} else {
-			t.Error("Expected PostProcess to panic with nil chrootEnv")
-		}
-	}()
+	err := rcd.PostProcess(template, nil)
+	if !errors.Is(err, provider.ErrChrootNotInitialized) {
+		t.Errorf("Expected chroot environment not initialized error, got: %v", err)
+	}
 
-	// This will panic due to nil chrootEnv
-	_ = rcd.PostProcess(template, nil)
+	// A build error, such as the failed Init, is kept
+	err = rcd.PostProcess(template, fmt.Errorf("init failed"))
+	if !errors.Is(err, provider.ErrChrootNotInitialized) || !strings.Contains(err.Error(), "init failed") {
+		t.Errorf("Expected the build error and chroot environment not initialized error, got: %v", err)
+	}
 }
 
 // TestRCDPostProcessErrorHandling tests PostProcess error handling logic
@@ -880,7 +879,10 @@ func TestRCDInstallHostDependencyInstallError(t *testing.T) {
 }
 
 func TestRCDDownloadImagePkgsUpdateSystemError(t *testing.T) {
-	rcd := &RCD{chrootEnv: &mockChrootEnvUpdateErr{err: fmt.Errorf("update failed")}}
+	rcd := &RCD{
+		gzHref:    "repodata/primary.xml.gz",
+		chrootEnv: &mockChrootEnvUpdateErr{err: fmt.Errorf("update failed")},
+	}
 
 	err := rcd.downloadImagePkgs(createTestImageTemplate())
 	if err == nil {
@@ -891,6 +893,14 @@ func TestRCDDownloadImagePkgsUpdateSystemError(t *testing.T) {
 	}
 }
 
+// TestRCDDownloadImagePkgsNotInitialized tests a provider Init was not called on
+func TestRCDDownloadImagePkgsNotInitialized(t *testing.T) {
+	err := (&RCD{}).downloadImagePkgs(createTestImageTemplate())
+	if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("Expected provider not initialized error, got: %v", err)
+	}
+}
+
 func TestLoadRepoConfigFromYAMLInvalidDist(t *testing.T) {
 	originalDir, _ := os.Getwd()
 	defer func() {
@@ -1,6 +1,7 @@
 package ubuntu
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -331,10 +332,10 @@ func (m *mockChrootEnv) InitChrootEnv(targetOs, targetDist, targetArch string) e
 	return nil
 }
 func (m *mockChrootEnv) CleanupChrootEnv(targetOs, targetDist, targetArch string) error { return nil }
-func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList []string) error {
+func (m *mockChrootEnv) TdnfInstallPackage(packageName, installRoot string, repositoryIDList, installOptions []string) error {
 	return nil
 }
-func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList []string) error {
+func (m *mockChrootEnv) AptInstallPackage(packageName, installRoot string, repoSrcList, installOptions []string) error {
 	return nil
 }
 func (m *mockChrootEnv) UpdateSystemPkgs(template *config.ImageTemplate) error { return nil }
@@ -478,17 +479,41 @@ func TestUbuntuInstallHostDependencyCommandCheckError(t *testing.T) {
 	}
 }
 
-func TestUbuntuPostProcessReturnsNilOnCleanupSuccess(t *testing.T) {
+func TestUbuntuPostProcessReturnsInputErrorOnCleanupSuccess(t *testing.T) {
 	ubuntu := &ubuntu{chrootEnv: &mockChrootEnv{}}
+	inputErr := fmt.Errorf("upstream build failure")
 
-	err := ubuntu.PostProcess(createTestImageTemplate(), fmt.Errorf("upstream build failure"))
-	if err != nil {
-		t.Fatalf("expected nil when cleanup succeeds, got %v", err)
+	err := ubuntu.PostProcess(createTestImageTemplate(), inputErr)
+	if err != inputErr {
+		t.Fatalf("expected input error to be returned when cleanup succeeds, got %v", err)
+	}
+	if err := ubuntu.PostProcess(createTestImageTemplate(), nil); err != nil {
+		t.Fatalf("expected nil when the build and cleanup succeed, got %v", err)
+	}
+}
+
+// TestUbuntuPostProcessWithNilChroot tests PostProcess returns an error with nil chrootEnv
+func TestUbuntuPostProcessWithNilChroot(t *testing.T) {
+	ubuntu := &ubuntu{}
+	template := createTestImageTemplate()
+
+	err := ubuntu.PostProcess(template, nil)
+	if !errors.Is(err, provider.ErrChrootNotInitialized) {
+		t.Errorf("Expected chroot environment not initialized error, got: %v", err)
+	}
+
+	// A build error, such as the failed Init, is kept
+	err = ubuntu.PostProcess(template, fmt.Errorf("init failed"))
+	if !errors.Is(err, provider.ErrChrootNotInitialized) || !strings.Contains(err.Error(), "init failed") {
+		t.Errorf("Expected the build error and chroot environment not initialized error, got: %v", err)
 	}
 }
 
 func TestUbuntuDownloadImagePkgsUpdateSystemErrorDeterministic(t *testing.T) {
-	ubuntu := &ubuntu{chrootEnv: &updateErrorChrootEnv{updateErr: fmt.Errorf("update failed")}}
+	ubuntu := &ubuntu{
+		repoCfgs:  []debutils.RepoConfig{{Name: "Test Repo", Arch: "amd64"}},
+		chrootEnv: &updateErrorChrootEnv{updateErr: fmt.Errorf("update failed")},
+	}
 
 	err := ubuntu.downloadImagePkgs(createTestImageTemplate())
 	if err == nil {
@@ -772,7 +797,7 @@ func TestUbuntuProviderPostProcess(t *testing.T) {
 		t.Logf("PostProcess failed as expected due to chroot cleanup dependencies: %v", err)
 	}
 
-	// Test with input error - PostProcess should clean up and return nil (not the input error)
+	// Test with input error - PostProcess should clean up and return the input error
 	inputError := fmt.Errorf("some build error")
 	err = ubuntu.PostProcess(template, inputError)
 	if err != nil {
@@ -1114,17 +1139,11 @@ func TestUbuntuPostProcessErrorHandling(t *testing.T) {
 
 	t.Logf("PostProcess method has correct signature: %T", postProcessFunc)
 
-	// Test that PostProcess with nil chrootEnv will panic - catch and validate
-	defer func() {
-		if r := recover(); r != nil {
-			t.Logf("PostProcess correctly panicked with nil chrootEnv: %v", r)
-		} else {
-			t.Error("Expected PostProcess to panic with nil chrootEnv")
-		}
-	}()
-
-	// This will panic due to nil chrootEnv, which we catch above
-	_ = ubuntu.PostProcess(template, inputError)
+	// PostProcess with nil chrootEnv returns an error keeping the build error
+	err := ubuntu.PostProcess(template, inputError)
+	if !errors.Is(err, provider.ErrChrootNotInitialized) || !errors.Is(err, inputError) {
+		t.Errorf("Expected the build error and chroot environment not initialized error, got: %v", err)
+	}
 }
 
 // TestUbuntuDownloadImagePkgs tests downloadImagePkgs method structure
@@ -1152,8 +1171,8 @@ func TestUbuntuDownloadImagePkgs(t *testing.T) {
 	if err != nil {
 		t.Logf("downloadImagePkgs failed as expected due to external dependencies: %v", err)
 		// Verify error messages to ensure proper error handling
-		if strings.Contains(err.Error(), "no repository configurations available") {
-			t.Error("Repository configurations were provided but still got 'no repository configurations' error")
+		if errors.Is(err, provider.ErrNotInitialized) {
+			t.Error("Repository configurations were provided but still got provider not initialized error")
 		}
 	} else {
 		// If successful, verify that template.FullPkgList was populated
@@ -1194,9 +1213,9 @@ func TestUbuntuMultipleRepositories(t *testing.T) {
 	err := ubuntu.downloadImagePkgs(template)
 	if err != nil {
 		t.Logf("downloadImagePkgs with multiple repos failed as expected: %v", err)
-		// Should not fail due to "no repository configurations available"
-		if strings.Contains(err.Error(), "no repository configurations available") {
-			t.Error("Should not get 'no repository configurations' error when multiple repos are configured")
+		// Should not fail due to provider not initialized
+		if errors.Is(err, provider.ErrNotInitialized) {
+			t.Error("Should not get provider not initialized error when multiple repos are configured")
 		}
 	} else {
 		t.Logf("downloadImagePkgs with multiple repositories succeeded")
@@ -1387,8 +1406,16 @@ func TestUbuntuDownloadImagePkgsNoRepos(t *testing.T) {
 	err := ubuntu.downloadImagePkgs(template)
 	if err == nil {
 		t.Error("Expected downloadImagePkgs to fail with no repositories")
-	} else if !strings.Contains(err.Error(), "no repository configurations available") {
-		t.Errorf("Expected 'no repository configurations available' error, got: %v", err)
+	} else if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("Expected provider not initialized error, got: %v", err)
+	}
+}
+
+// TestUbuntuDownloadImagePkgsNotInitialized tests a provider Init was not called on
+func TestUbuntuDownloadImagePkgsNotInitialized(t *testing.T) {
+	err := (&ubuntu{}).downloadImagePkgs(createTestImageTemplate())
+	if !errors.Is(err, provider.ErrNotInitialized) {
+		t.Errorf("Expected provider not initialized error, got: %v", err)
 	}
 }
 
@@ -1788,7 +1815,7 @@ func TestUbuntuPreProcessDownloadPackagesError(t *testing.T) {
 	err := ubuntu.PreProcess(template)
 	if err != nil {
 		// Should fail at downloadImagePkgs due to missing repos
-		if strings.Contains(err.Error(), "no repository configurations available") ||
+		if errors.Is(err, provider.ErrNotInitialized) ||
 			strings.Contains(err.Error(), "failed to download image packages") ||
 			strings.Contains(err.Error(), "failed to install host dependency") {
 			t.Logf("PreProcess failed as expected at download packages: %v", err)
@@ -2176,8 +2203,8 @@ func TestUbuntuDownloadImagePkgsWithFullTemplate(t *testing.T) {
 	if err != nil {
 		t.Logf("downloadImagePkgs failed as expected: %v", err)
 		// Should not fail due to missing repo configs
-		if strings.Contains(err.Error(), "no repository configurations available") {
-			t.Error("Should not get 'no repository configurations' error when repos are configured")
+		if errors.Is(err, provider.ErrNotInitialized) {
+			t.Error("Should not get provider not initialized error when repos are configured")
 		}
 	} else {
 		// Verify template fields are populated
@@ -0,0 +1,264 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// IsArchive reports whether path has the extension of an archive supported by
+// ExtractArchive.
+func IsArchive(path string) bool {
+	_, ok := archiveFormat(path)
+	return ok
+}
+
+func archiveFormat(path string) (string, bool) {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz", true
+	case strings.HasSuffix(name, ".tar"):
+		return "tar", true
+	case strings.HasSuffix(name, ".zip"):
+		return "zip", true
+	}
+	return "", false
+}
+
+// ExtractArchive extracts the tar, tar.gz or zip archive archivePath into
+// dstDir, which is created if needed. The format is chosen by the file
+// extension. Extraction stops with an error at the first entry that would be
+// written outside dstDir, whether through an absolute path, a ".." component,
+// a hard link or a previously extracted symlink. Symlinks themselves are kept
+// as they are, since their targets are resolved inside the image.
+func ExtractArchive(archivePath, dstDir string) error {
+	format, ok := archiveFormat(archivePath)
+	if !ok {
+		return fmt.Errorf("unsupported archive format: %s (expected .tar, .tar.gz, .tgz or .zip)", archivePath)
+	}
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return fmt.Errorf("failed to create extraction directory %s: %w", dstDir, err)
+	}
+
+	if format == "zip" {
+		return extractZip(archivePath, dstDir)
+	}
+
+	r, closeArchive, err := openTar(archivePath, format)
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+	return extractTar(r, archivePath, dstDir)
+}
+
+// ArchiveEntries returns the sorted, cleaned paths of the entries of the
+// archive archivePath, relative to the directory it is extracted into. The
+// directories that only appear as parents of other entries are not listed.
+func ArchiveEntries(archivePath string) ([]string, error) {
+	format, ok := archiveFormat(archivePath)
+	if !ok {
+		return nil, fmt.Errorf("unsupported archive format: %s (expected .tar, .tar.gz, .tgz or .zip)", archivePath)
+	}
+
+	var names []string
+	if format == "zip" {
+		zipReader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+		}
+		defer zipReader.Close()
+		for _, entry := range zipReader.File {
+			names = append(names, entry.Name)
+		}
+	} else {
+		r, closeArchive, err := openTar(archivePath, format)
+		if err != nil {
+			return nil, err
+		}
+		defer closeArchive()
+		tarReader := tar.NewReader(r)
+		for {
+			hdr, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read archive %s: %w", archivePath, err)
+			}
+			names = append(names, hdr.Name)
+		}
+	}
+
+	var entries []string
+	for _, name := range names {
+		entry := filepath.Clean(name)
+		if entry == "." {
+			continue
+		}
+		if !filepath.IsLocal(entry) {
+			return nil, fmt.Errorf("invalid entry in archive %s: path %s escapes the extraction directory", archivePath, name)
+		}
+		entries = append(entries, entry)
+	}
+	slices.Sort(entries)
+	return slices.Compact(entries), nil
+}
+
+// openTar returns a reader of the uncompressed tar stream of archivePath and
+// the function that closes it.
+func openTar(archivePath, format string) (io.Reader, func(), error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+	}
+	if format != "tar.gz" {
+		return f, func() { f.Close() }, nil
+	}
+	gzReader, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to create gzip reader for %s: %w", archivePath, err)
+	}
+	return gzReader, func() { gzReader.Close(); f.Close() }, nil
+}
+
+func extractTar(r io.Reader, archivePath, dstDir string) error {
+	tarReader := tar.NewReader(r)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive %s: %w", archivePath, err)
+		}
+
+		target, err := archiveEntryPath(dstDir, hdr.Name)
+		if err != nil {
+			return fmt.Errorf("invalid entry in archive %s: %w", archivePath, err)
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(target, tarReader, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", target, err)
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", target, err)
+			}
+		case tar.TypeLink:
+			linkTarget, err := archiveEntryPath(dstDir, hdr.Linkname)
+			if err != nil {
+				return fmt.Errorf("invalid hard link %s in archive %s: %w", hdr.Name, archivePath, err)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", target, err)
+			}
+			if err := os.Link(linkTarget, target); err != nil {
+				return fmt.Errorf("failed to create hard link %s: %w", target, err)
+			}
+		default:
+			return fmt.Errorf("unsupported entry %s of type %q in archive %s", hdr.Name, hdr.Typeflag, archivePath)
+		}
+	}
+}
+
+func extractZip(archivePath, dstDir string) error {
+	zipReader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+	}
+	defer zipReader.Close()
+
+	for _, entry := range zipReader.File {
+		target, err := archiveEntryPath(dstDir, entry.Name)
+		if err != nil {
+			return fmt.Errorf("invalid entry in archive %s: %w", archivePath, err)
+		}
+		mode := entry.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()|0700); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", target, err)
+			}
+		case mode.IsRegular():
+			rc, err := entry.Open()
+			if err != nil {
+				return fmt.Errorf("failed to read %s from archive %s: %w", entry.Name, archivePath, err)
+			}
+			err = writeArchiveFile(target, rc, mode.Perm())
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %s in archive %s", entry.Name, archivePath)
+		}
+	}
+	return nil
+}
+
+// archiveEntryPath returns where the archive entry name is extracted under
+// dstDir, or an error if it would end up outside of dstDir.
+func archiveEntryPath(dstDir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("absolute path %s", name)
+	}
+	target := filepath.Join(dstDir, name)
+	if ok, err := IsSubPath(dstDir, target); err != nil || !ok {
+		return "", fmt.Errorf("path %s escapes the extraction directory", name)
+	}
+
+	// Refuse to write through a symlink extracted earlier from the archive
+	rel, err := filepath.Rel(dstDir, target)
+	if err != nil {
+		return "", fmt.Errorf("path %s escapes the extraction directory", name)
+	}
+	current := dstDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		current = filepath.Join(current, part)
+		if info, err := os.Lstat(current); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("path %s goes through symlink %s", name, current)
+		}
+	}
+	return target, nil
+}
+
+func writeArchiveFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", target, err)
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", target, err)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to extract file %s: %w", target, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to extract file %s: %w", target, err)
+	}
+	return nil
+}
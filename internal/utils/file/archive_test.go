@@ -0,0 +1,221 @@
+package file_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/file"
+)
+
+type tarEntry struct {
+	name     string
+	body     string
+	typeflag byte
+	linkname string
+}
+
+func writeTarGz(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+	gzWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzWriter)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: e.typeflag, Linkname: e.linkname}
+		switch e.typeflag {
+		case tar.TypeDir:
+			hdr.Mode = 0755
+		case tar.TypeReg:
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tarWriter.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write header %s: %v", e.name, err)
+		}
+		if e.typeflag == tar.TypeReg {
+			if _, err := tarWriter.Write([]byte(e.body)); err != nil {
+				t.Fatalf("failed to write %s: %v", e.name, err)
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+}
+
+func TestExtractArchiveTarGz(t *testing.T) {
+	tmpDir := t.TempDir()
+	archive := filepath.Join(tmpDir, "payload.tar.gz")
+	writeTarGz(t, archive, []tarEntry{
+		{name: "etc/", typeflag: tar.TypeDir},
+		{name: "etc/app/config.yaml", body: "key: value\n", typeflag: tar.TypeReg},
+		{name: "usr/share/app/data.txt", body: "data", typeflag: tar.TypeReg},
+		{name: "etc/app/current", typeflag: tar.TypeSymlink, linkname: "config.yaml"},
+	})
+
+	dstDir := filepath.Join(tmpDir, "out")
+	if err := file.ExtractArchive(archive, dstDir); err != nil {
+		t.Fatalf("ExtractArchive failed: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		"etc/app/config.yaml":    "key: value\n",
+		"usr/share/app/data.txt": "data",
+		"etc/app/current":        "key: value\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dstDir, path))
+		if err != nil {
+			t.Errorf("expected %s under the target directory: %v", path, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestExtractArchiveRejectsTraversal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		errMsg  string
+	}{
+		{
+			name:    "dot_dot_entry",
+			entries: []tarEntry{{name: "../escaped.txt", body: "x", typeflag: tar.TypeReg}},
+			errMsg:  "escapes the extraction directory",
+		},
+		{
+			name:    "nested_dot_dot_entry",
+			entries: []tarEntry{{name: "etc/../../escaped.txt", body: "x", typeflag: tar.TypeReg}},
+			errMsg:  "escapes the extraction directory",
+		},
+		{
+			name:    "absolute_entry",
+			entries: []tarEntry{{name: "/escaped.txt", body: "x", typeflag: tar.TypeReg}},
+			errMsg:  "absolute path",
+		},
+		{
+			name: "write_through_symlink",
+			entries: []tarEntry{
+				{name: "link", typeflag: tar.TypeSymlink, linkname: ".."},
+				{name: "link/escaped.txt", body: "x", typeflag: tar.TypeReg},
+			},
+			errMsg: "goes through symlink",
+		},
+		{
+			name:    "hard_link_outside",
+			entries: []tarEntry{{name: "passwd", typeflag: tar.TypeLink, linkname: "../../etc/passwd"}},
+			errMsg:  "escapes the extraction directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			archive := filepath.Join(tmpDir, "payload.tgz")
+			writeTarGz(t, archive, tt.entries)
+
+			dstDir := filepath.Join(tmpDir, "out")
+			err := file.ExtractArchive(archive, dstDir)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, "escaped.txt")); !os.IsNotExist(err) {
+				t.Errorf("entry was written outside the target directory")
+			}
+		})
+	}
+}
+
+func TestExtractArchiveZip(t *testing.T) {
+	tmpDir := t.TempDir()
+	archive := filepath.Join(tmpDir, "payload.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	zipWriter := zip.NewWriter(f)
+	w, err := zipWriter.Create("opt/app/run.sh")
+	if err != nil {
+		t.Fatalf("failed to add zip entry: %v", err)
+	}
+	if _, err := w.Write([]byte("#!/bin/sh\n")); err != nil {
+		t.Fatalf("failed to write zip entry: %v", err)
+	}
+	if _, err := zipWriter.Create("../escaped.txt"); err != nil {
+		t.Fatalf("failed to add zip entry: %v", err)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("failed to close zip writer: %v", err)
+	}
+	f.Close()
+
+	dstDir := filepath.Join(tmpDir, "out")
+	err = file.ExtractArchive(archive, dstDir)
+	if err == nil || !strings.Contains(err.Error(), "escapes the extraction directory") {
+		t.Fatalf("expected traversal error, got %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dstDir, "opt/app/run.sh")); err != nil || string(got) != "#!/bin/sh\n" {
+		t.Errorf("expected opt/app/run.sh to be extracted before the bad entry, got %q, %v", got, err)
+	}
+}
+
+func TestArchiveEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	archive := filepath.Join(tmpDir, "payload.tar.gz")
+	writeTarGz(t, archive, []tarEntry{
+		{name: "./", typeflag: tar.TypeDir},
+		{name: "./etc/app/", typeflag: tar.TypeDir},
+		{name: "./etc/app/app.conf", body: "port=80", typeflag: tar.TypeReg},
+		{name: "bin/app", body: "binary", typeflag: tar.TypeReg},
+		{name: "bin/app-latest", typeflag: tar.TypeSymlink, linkname: "app"},
+	})
+
+	entries, err := file.ArchiveEntries(archive)
+	if err != nil {
+		t.Fatalf("ArchiveEntries failed: %v", err)
+	}
+	want := []string{"bin/app", "bin/app-latest", "etc/app", "etc/app/app.conf"}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("expected entries %v, got %v", want, entries)
+	}
+
+	zipArchive := filepath.Join(tmpDir, "payload.zip")
+	f, err := os.Create(zipArchive)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", zipArchive, err)
+	}
+	zipWriter := zip.NewWriter(f)
+	if _, err := zipWriter.Create("../outside"); err != nil {
+		t.Fatalf("failed to add zip entry: %v", err)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("failed to close zip writer: %v", err)
+	}
+	f.Close()
+	if _, err := file.ArchiveEntries(zipArchive); err == nil || !strings.Contains(err.Error(), "escapes the extraction directory") {
+		t.Errorf("expected an escaping entry to be rejected, got %v", err)
+	}
+}
+
+func TestExtractArchiveUnsupportedFormat(t *testing.T) {
+	if file.IsArchive("payload.rar") {
+		t.Errorf("IsArchive(payload.rar) = true, want false")
+	}
+	err := file.ExtractArchive("payload.rar", t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "unsupported archive format") {
+		t.Errorf("expected unsupported format error, got %v", err)
+	}
+}
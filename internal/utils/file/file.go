@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/config"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
 	"gopkg.in/yaml.v3"
 )
 
@@ -283,32 +284,81 @@ func CopyDir(srcDir, dstDir, flags string, sudo bool) error {
 	return nil
 }
 
-// CheckDiskSpace checks if there is sufficient disk space available in the given directory
-// to accommodate the specified size (with a safety margin).
-func CheckDiskSpace(dir string, requiredBytes int64, safetyMarginPercent float64) error {
-	// Use df command to get available space in bytes
-	cmdStr := fmt.Sprintf("df --output=avail -B1 '%s' | tail -n1", dir)
-	output, err := shell.ExecCmd(cmdStr, false, shell.HostPath, nil)
-	if err != nil {
-		return fmt.Errorf("failed to check disk space: %w", err)
-	}
+// DiskSpaceRequirement is an amount of disk space needed under Path.
+type DiskSpaceRequirement struct {
+	Path    string
+	Bytes   int64
+	Purpose string // e.g. "package downloads"
+}
 
-	availableStr := strings.TrimSpace(output)
-	availableBytes, err := strconv.ParseInt(availableStr, 10, 64)
-	if err != nil {
-		return fmt.Errorf("failed to parse disk space output: %w", err)
+// FilesystemSpace returns an identifier of the filesystem holding path and
+// the bytes available on it to unprivileged users. Tests replace it to
+// simulate full filesystems.
+var FilesystemSpace = statfsSpace
+
+// CheckDiskSpace checks if there is sufficient disk space available for the
+// given requirements (with a safety margin). Requirements whose directories
+// share a filesystem are added up, and all shortfalls are reported in a
+// single error.
+func CheckDiskSpace(safetyMarginPercent float64, requirements ...DiskSpaceRequirement) error {
+	type fsUsage struct {
+		available int64
+		required  int64
+		purposes  []string
+	}
+	usage := make(map[uint64]*fsUsage)
+	var order []uint64
+
+	for _, req := range requirements {
+		if req.Bytes <= 0 {
+			continue
+		}
+		fsID, available, err := FilesystemSpace(req.Path)
+		if err != nil {
+			return fmt.Errorf("failed to check disk space for %s: %w", req.Path, err)
+		}
+		u, ok := usage[fsID]
+		if !ok {
+			u = &fsUsage{available: int64(available)}
+			usage[fsID] = u
+			order = append(order, fsID)
+		}
+		u.required += req.Bytes
+		purpose := system.FormatBytes(uint64(req.Bytes))
+		if req.Purpose != "" {
+			purpose += " " + req.Purpose
+		}
+		u.purposes = append(u.purposes, purpose+" in "+req.Path)
 	}
 
 	if safetyMarginPercent < 0 {
 		safetyMarginPercent = 0
 	}
-	safetyMargin := int64(float64(requiredBytes) * safetyMarginPercent)
-	requiredWithMargin := requiredBytes + safetyMargin
-
-	if availableBytes < requiredWithMargin {
-		return fmt.Errorf("insufficient disk space: need %d bytes (including %.0f%% margin), have %d bytes available",
-			requiredWithMargin, safetyMarginPercent*100, availableBytes)
+	var shortfalls []string
+	for _, fsID := range order {
+		u := usage[fsID]
+		requiredWithMargin := u.required + int64(float64(u.required)*safetyMarginPercent)
+		if u.available < requiredWithMargin {
+			shortfalls = append(shortfalls, fmt.Sprintf("need %s (including %.0f%% margin) but only %s available, short by %s (%s)",
+				system.FormatBytes(uint64(requiredWithMargin)), safetyMarginPercent*100, system.FormatBytes(uint64(u.available)),
+				system.FormatBytes(uint64(requiredWithMargin-u.available)), strings.Join(u.purposes, ", ")))
+		}
+	}
+	if len(shortfalls) > 0 {
+		return fmt.Errorf("insufficient disk space: %s", strings.Join(shortfalls, "; "))
 	}
 
 	return nil
 }
+
+func statfsSpace(path string) (uint64, uint64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, 0, err
+	}
+	return uint64(stat.Dev), fs.Bavail * uint64(fs.Bsize), nil
+}
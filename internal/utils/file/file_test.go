@@ -686,7 +686,7 @@ func TestCheckDiskSpace(t *testing.T) {
 	t.Run("sufficient space", func(t *testing.T) {
 		// Request 1KB with 20% margin (1200 bytes total)
 		// Any modern system should have this much space
-		err := file.CheckDiskSpace(dir, 1024, 0.20)
+		err := file.CheckDiskSpace(0.20, file.DiskSpaceRequirement{Path: dir, Bytes: 1024})
 		if err != nil {
 			t.Fatalf("CheckDiskSpace failed with small requirement: %v", err)
 		}
@@ -694,7 +694,7 @@ func TestCheckDiskSpace(t *testing.T) {
 
 	t.Run("zero required bytes", func(t *testing.T) {
 		// Should always succeed with zero requirement
-		err := file.CheckDiskSpace(dir, 0, 0.0)
+		err := file.CheckDiskSpace(0.0, file.DiskSpaceRequirement{Path: dir, Bytes: 0})
 		if err != nil {
 			t.Fatalf("CheckDiskSpace failed with zero requirement: %v", err)
 		}
@@ -704,7 +704,7 @@ func TestCheckDiskSpace(t *testing.T) {
 		// Test with various safety margins
 		margins := []float64{0.0, 0.10, 0.25, 0.50}
 		for _, margin := range margins {
-			err := file.CheckDiskSpace(dir, 1024, margin)
+			err := file.CheckDiskSpace(margin, file.DiskSpaceRequirement{Path: dir, Bytes: 1024})
 			if err != nil {
 				t.Errorf("CheckDiskSpace failed with %.0f%% margin: %v", margin*100, err)
 			}
@@ -713,7 +713,7 @@ func TestCheckDiskSpace(t *testing.T) {
 
 	t.Run("negative safety margin treated as zero", func(t *testing.T) {
 		// Negative margin should be treated as 0
-		err := file.CheckDiskSpace(dir, 1024, -0.10)
+		err := file.CheckDiskSpace(-0.10, file.DiskSpaceRequirement{Path: dir, Bytes: 1024})
 		if err != nil {
 			t.Fatalf("CheckDiskSpace failed with negative margin: %v", err)
 		}
@@ -722,7 +722,7 @@ func TestCheckDiskSpace(t *testing.T) {
 	t.Run("insufficient space", func(t *testing.T) {
 		// Request more space than any reasonable system would have
 		// (1 exabyte = 1,152,921,504,606,846,976 bytes)
-		err := file.CheckDiskSpace(dir, 1152921504606846976, 0.0)
+		err := file.CheckDiskSpace(0.0, file.DiskSpaceRequirement{Path: dir, Bytes: 1152921504606846976})
 		if err == nil {
 			t.Fatal("CheckDiskSpace should fail with unrealistic space requirement")
 		}
@@ -733,9 +733,122 @@ func TestCheckDiskSpace(t *testing.T) {
 
 	t.Run("invalid directory", func(t *testing.T) {
 		// Non-existent directory should fail
-		err := file.CheckDiskSpace("/nonexistent/path/that/does/not/exist", 1024, 0.0)
+		err := file.CheckDiskSpace(0.0, file.DiskSpaceRequirement{Path: "/nonexistent/path/that/does/not/exist", Bytes: 1024})
 		if err == nil {
 			t.Fatal("CheckDiskSpace should fail with non-existent directory")
 		}
 	})
 }
+
+func TestCheckDiskSpaceRequirements(t *testing.T) {
+	originalFilesystemSpace := file.FilesystemSpace
+	defer func() { file.FilesystemSpace = originalFilesystemSpace }()
+
+	tempDir := t.TempDir()
+	cacheDir := filepath.Join(tempDir, "cache")
+	workDir := filepath.Join(tempDir, "work")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		t.Fatalf("Failed to create cache dir: %v", err)
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		t.Fatalf("Failed to create work dir: %v", err)
+	}
+
+	const gib = 1024 * 1024 * 1024
+
+	tests := []struct {
+		name          string
+		available     map[string]uint64 // free bytes per path; each path is its own filesystem
+		sameFs        bool              // report cache and work dir as one filesystem
+		margin        float64
+		requirements  []file.DiskSpaceRequirement
+		expectError   bool
+		errorContains []string
+	}{
+		{
+			name:      "enough_space",
+			available: map[string]uint64{cacheDir: 10 * gib, workDir: 10 * gib},
+			requirements: []file.DiskSpaceRequirement{
+				{Path: cacheDir, Bytes: 2 * gib, Purpose: "package downloads"},
+				{Path: workDir, Bytes: 8 * gib, Purpose: "image rootfs"},
+			},
+		},
+		{
+			name:      "work_dir_short",
+			available: map[string]uint64{cacheDir: 10 * gib, workDir: 1 * gib},
+			requirements: []file.DiskSpaceRequirement{
+				{Path: cacheDir, Bytes: 2 * gib, Purpose: "package downloads"},
+				{Path: workDir, Bytes: 3 * gib, Purpose: "image rootfs"},
+			},
+			expectError: true,
+			errorContains: []string{
+				"insufficient disk space",
+				"need 3.00 GiB (including 0% margin) but only 1.00 GiB available, short by 2.00 GiB",
+				"image rootfs in " + workDir,
+			},
+		},
+		{
+			name:      "shared_filesystem_adds_up",
+			available: map[string]uint64{cacheDir: 4 * gib, workDir: 4 * gib},
+			sameFs:    true,
+			requirements: []file.DiskSpaceRequirement{
+				{Path: cacheDir, Bytes: 2 * gib, Purpose: "package downloads"},
+				{Path: workDir, Bytes: 3 * gib, Purpose: "image rootfs"},
+			},
+			expectError: true,
+			errorContains: []string{
+				"need 5.00 GiB (including 0% margin) but only 4.00 GiB available, short by 1.00 GiB",
+				"package downloads in " + cacheDir,
+				"image rootfs in " + workDir,
+			},
+		},
+		{
+			name:      "margin_added",
+			available: map[string]uint64{workDir: 10 * gib},
+			margin:    0.20,
+			requirements: []file.DiskSpaceRequirement{
+				{Path: workDir, Bytes: 9 * gib, Purpose: "disk image"},
+			},
+			expectError:   true,
+			errorContains: []string{"need 10.80 GiB (including 20% margin)", "short by 819.20 MiB"},
+		},
+		{
+			name:      "zero_requirements_skipped",
+			available: map[string]uint64{},
+			requirements: []file.DiskSpaceRequirement{
+				{Path: cacheDir, Bytes: 0, Purpose: "package downloads"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file.FilesystemSpace = func(path string) (uint64, uint64, error) {
+				available, ok := tt.available[path]
+				if !ok {
+					return 0, 0, fmt.Errorf("unexpected path %s", path)
+				}
+				if tt.sameFs {
+					return 1, available, nil
+				}
+				return uint64(len(path)), available, nil
+			}
+
+			err := file.CheckDiskSpace(tt.margin, tt.requirements...)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				for _, want := range tt.errorContains {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Expected error to contain %q, got %q", want, err.Error())
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -35,6 +35,62 @@ func (n *nopSyncer) Sync() error {
 	return nil // no-op
 }
 
+// warningCore is a zap core that records warning messages while a capture is
+// active. It is part of every logger built by applyConfig, so loggers obtained
+// before a reconfiguration are captured as well.
+type warningCore struct {
+	mu       sync.Mutex
+	active   bool
+	messages []string
+}
+
+func (w *warningCore) Enabled(level zapcore.Level) bool {
+	return level == zapcore.WarnLevel
+}
+
+func (w *warningCore) With(fields []zapcore.Field) zapcore.Core {
+	return w
+}
+
+func (w *warningCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if w.Enabled(entry.Level) {
+		return checked.AddCore(entry, w)
+	}
+	return checked
+}
+
+func (w *warningCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.active {
+		w.messages = append(w.messages, entry.Message)
+	}
+	return nil
+}
+
+func (w *warningCore) Sync() error {
+	return nil
+}
+
+// StartWarningCapture begins recording warning messages logged at any level
+// setting, discarding anything recorded by a previous capture.
+func StartWarningCapture() {
+	warnings.mu.Lock()
+	defer warnings.mu.Unlock()
+	warnings.active = true
+	warnings.messages = nil
+}
+
+// StopWarningCapture ends the current capture and returns the recorded messages.
+func StopWarningCapture() []string {
+	warnings.mu.Lock()
+	defer warnings.mu.Unlock()
+	warnings.active = false
+	messages := warnings.messages
+	warnings.messages = nil
+	return messages
+}
+
 type StatusWriter struct {
 	Status chan string
 }
@@ -53,6 +109,7 @@ var (
 	logFile       *os.File
 	currentConfig Config
 	stderrSyncer  = &nopSyncer{writer: os.Stderr}
+	warnings      = &warningCore{}
 )
 
 func initLogger() {
@@ -87,7 +144,7 @@ func applyConfig(cfg Config) error {
 
 	consoleEncoder := zapcore.NewConsoleEncoder(encoderCfg)
 	consoleCore := zapcore.NewCore(consoleEncoder, zapcore.AddSync(stderrSyncer), atomicLevel)
-	cores := []zapcore.Core{consoleCore}
+	cores := []zapcore.Core{consoleCore, warnings}
 
 	filePath := strings.TrimSpace(cfg.FilePath)
 	if filePath != "" {
@@ -235,6 +235,35 @@ func TestWith(t *testing.T) {
 	}
 }
 
+func TestWarningCapture(t *testing.T) {
+	resetLogger()
+	oldOut := ReplaceStderrWriter(&bytes.Buffer{})
+	defer ReplaceStderrWriter(oldOut)
+
+	log := Logger()
+	log.Warn("before capture")
+
+	StartWarningCapture()
+	log.Info("not a warning")
+	log.Warnf("disk %s is almost full", "/dev/sda")
+	log.Error("not a warning either")
+	// Warnings are recorded even when the console level hides them
+	SetLogLevel("error")
+	log.Warn("hidden warning")
+	captured := StopWarningCapture()
+	SetLogLevel("info")
+
+	log.Warn("after capture")
+
+	expected := []string{"disk /dev/sda is almost full", "hidden warning"}
+	if strings.Join(captured, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected captured warnings %v, got %v", expected, captured)
+	}
+	if leftover := StopWarningCapture(); len(leftover) != 0 {
+		t.Errorf("expected no warnings outside a capture, got %v", leftover)
+	}
+}
+
 func TestSetLogLevel(t *testing.T) {
 	resetLogger()
 
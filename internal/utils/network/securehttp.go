@@ -23,11 +23,19 @@ func GetSecureHTTPClient() *http.Client {
 				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
 			},
 		}
+		registerFileProtocol(base)
 		secureClient = &http.Client{Transport: base}
 	})
 	return secureClient
 }
 
+// registerFileProtocol lets transport serve file:// URLs from the local
+// filesystem, so repositories on a mounted ISO or a local directory are read
+// without any network access.
+func registerFileProtocol(transport *http.Transport) {
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+}
+
 // NewSecureHTTPClient returns an http.Client with a custom TLS configuration.
 func NewSecureHTTPClient() *http.Client {
 
@@ -44,6 +52,7 @@ func NewSecureHTTPClient() *http.Client {
 			// (intentionally omit non-allowed ciphers per Intel CT-35)
 		},
 	}
+	registerFileProtocol(base)
 
 	return &http.Client{Transport: base}
 }
@@ -65,6 +65,21 @@ func ValidatePath(name, s string, lim Limits) error {
 	return nil
 }
 
+// ---------- shell safety ----------
+
+// ShellMetachars are the characters that make the shell do more than pass a
+// word on to the command: run another command, substitute, redirect or quote.
+const ShellMetachars = "`$;&|<>(){}\\\"'!\n\r"
+
+// ValidateShellWord rejects s if it contains any of ShellMetachars or
+// whitespace, so that it can be used as a single word of a shell command.
+func ValidateShellWord(name, s string) error {
+	if i := strings.IndexAny(s, ShellMetachars+" \t"); i != -1 {
+		return fmt.Errorf("%s: %q contains shell metacharacter %q", name, s, s[i])
+	}
+	return nil
+}
+
 // ---------- struct-wide (config) validation ----------
 
 func ValidateStructStrings(obj any, lim Limits) error {
@@ -214,3 +214,17 @@ func TestAttachRecursive_PersistentPreRunE(t *testing.T) {
 		t.Fatal("expected error for bad flag in child")
 	}
 }
+
+func TestValidateShellWord(t *testing.T) {
+	for _, s := range []string{"", "vim", "/etc/app/config.yaml", "linux-image-6.8.0", "kernel*", "edge-node.local"} {
+		if err := ValidateShellWord("word", s); err != nil {
+			t.Errorf("%q rejected: %v", s, err)
+		}
+	}
+	for _, s := range []string{"vim; rm -rf /", "`reboot`", "$(id)", "a|b", "a&&b", "a>b", "two words", "it's", "a\nb"} {
+		err := ValidateShellWord("word", s)
+		if err == nil || !strings.Contains(err.Error(), "shell metacharacter") {
+			t.Errorf("expected %q to be rejected, got %v", s, err)
+		}
+	}
+}
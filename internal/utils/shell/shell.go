@@ -58,6 +58,7 @@ var commandMap = map[string][]string{
 	"flock":              {"/usr/bin/flock"},
 	"fuser":              {"/usr/bin/fuser"},
 	"getent":             {"/usr/bin/getent"},
+	"gpg":                {"/usr/bin/gpg"},
 	"gpgconf":            {"/usr/bin/gpgconf"},
 	"groupadd":           {"/usr/sbin/groupadd"},
 	"gunzip":             {"/usr/bin/gunzip"},
@@ -78,6 +79,8 @@ var commandMap = map[string][]string{
 	"mmdebstrap":         {"/usr/bin/mmdebstrap"},
 	"mkdir":              {"/bin/mkdir"},
 	"mkfs":               {"/usr/sbin/mkfs"},
+	"mkfs.erofs":         {"/usr/bin/mkfs.erofs", "/usr/sbin/mkfs.erofs"},
+	"mksquashfs":         {"/usr/bin/mksquashfs", "/usr/sbin/mksquashfs"},
 	"mkswap":             {"/usr/sbin/mkswap"},
 	"mktemp":             {"/usr/bin/mktemp"},
 	"mount":              {"/usr/bin/mount"},
@@ -148,6 +151,25 @@ type DefaultExecutor struct{}
 
 var Default Executor = &DefaultExecutor{}
 
+// LineStreamer is implemented by executors that can hand every output line to
+// a callback as soon as the command produces it.
+type LineStreamer interface {
+	ExecCmdWithLineHandler(cmdStr string, sudo bool, chrootPath string, envVal []string, onLine func(string)) (string, error)
+}
+
+// StreamStageOutput enables live, stage-prefixed console output for the
+// long-running build steps run through ExecCmdWithStage. Buffered execution
+// is used when it is false.
+var StreamStageOutput = false
+
+// SingleQuote wraps s in single quotes for POSIX shells and escapes any
+// embedded single quotes using the pattern `'"'"'`, which ends the current
+// single-quoted string, adds an escaped single quote, and starts a new
+// single-quoted string.
+func SingleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
 // GetOSEnvirons returns the system environment variables
 func GetOSEnvirons() map[string]string {
 	// Convert os.Environ() to a map
@@ -492,9 +514,12 @@ func (d *DefaultExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, e
 		return "", fmt.Errorf("failed to get full command string: %w", err)
 	}
 
-	cmd := exec.Command("bash", "-c", fullCmdStr)
-	output, err := cmd.CombinedOutput()
-	outputStr := string(output)
+	timeout, byDeadline, err := cmdLimitFor(chrootPath)
+	if err != nil {
+		return "", err
+	}
+	outputStr, err := runBashCmd(fullCmdStr, nil, timeout)
+	err = deadlineErr(err, byDeadline)
 
 	if err != nil {
 		if outputStr != "" {
@@ -523,18 +548,34 @@ func (d *DefaultExecutor) ExecCmdSilent(cmdStr string, sudo bool, chrootPath str
 		return "", fmt.Errorf("failed to get full command string: %w", err)
 	}
 
-	cmd := exec.Command("bash", "-c", fullCmdStr)
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+	timeout, byDeadline, err := cmdLimitFor(chrootPath)
+	if err != nil {
+		return "", err
+	}
+	outputStr, err := runBashCmd(fullCmdStr, nil, timeout)
+	return outputStr, deadlineErr(err, byDeadline)
 }
 
 // ExecCmdWithStream executes a command and streams its output
 func (d *DefaultExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	return d.ExecCmdWithLineHandler(cmdStr, sudo, chrootPath, envVal, func(line string) {
+		log.Debugf(line)
+	})
+}
+
+// ExecCmdWithLineHandler executes a command, passing each non-empty output line
+// to onLine as it is read, and returns the full output. onLine may be called
+// concurrently for stdout and stderr lines
+func (d *DefaultExecutor) ExecCmdWithLineHandler(cmdStr string, sudo bool, chrootPath string, envVal []string, onLine func(string)) (string, error) {
 	fullCmdStr, err := GetFullCmdStr(cmdStr, sudo, chrootPath, envVal)
 	if err != nil {
 		return "", fmt.Errorf("failed to get full command string: %w", err)
 	}
-	cmd := exec.Command("bash", "-c", fullCmdStr)
+	timeout, byDeadline, err := cmdLimitFor(chrootPath)
+	if err != nil {
+		return "", err
+	}
+	cmd := newBashCmd(fullCmdStr, timeout)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return "", fmt.Errorf("failed to get stdout pipe for command %s: %w", fullCmdStr, err)
@@ -547,6 +588,7 @@ func (d *DefaultExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath
 	if err := cmd.Start(); err != nil {
 		return "", fmt.Errorf("failed to start command %s: %w", fullCmdStr, err)
 	}
+	stop := startWatchdog(cmd, timeout)
 
 	// Use channels to collect stdout and stderr in order to preserve full command output.
 	outputChan := make(chan string, 128)
@@ -571,7 +613,7 @@ func (d *DefaultExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath
 			str := scanner.Text()
 			if str != "" {
 				outputChan <- str
-				log.Debugf(str)
+				onLine(str)
 			}
 		}
 	}()
@@ -583,7 +625,7 @@ func (d *DefaultExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath
 			str := scanner.Text()
 			if str != "" {
 				outputChan <- str
-				log.Debugf(str)
+				onLine(str)
 			}
 		}
 	}()
@@ -592,7 +634,11 @@ func (d *DefaultExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath
 	close(outputChan)
 	collectWG.Wait()
 
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	if stop() {
+		return outputStr.String(), deadlineErr(fmt.Errorf("%w after %s", ErrCmdTimeout, timeout), byDeadline)
+	}
+	if err != nil {
 		return outputStr.String(), fmt.Errorf("failed to wait for command %s: %w", fullCmdStr, err)
 	}
 
@@ -606,11 +652,12 @@ func (d *DefaultExecutor) ExecCmdWithInput(inputStr string, cmdStr string, sudo
 		return "", fmt.Errorf("failed to get full command string: %w", err)
 	}
 
-	cmd := exec.Command("bash", "-c", fullCmdStr)
-	cmd.Stdin = strings.NewReader(inputStr)
-
-	output, err := cmd.CombinedOutput()
-	outputStr := string(output)
+	timeout, byDeadline, err := cmdLimitFor(chrootPath)
+	if err != nil {
+		return "", err
+	}
+	outputStr, err := runBashCmd(fullCmdStr, strings.NewReader(inputStr), timeout)
+	err = deadlineErr(err, byDeadline)
 
 	if err != nil {
 		if outputStr != "" {
@@ -642,3 +689,42 @@ func ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []str
 func ExecCmdWithInput(inputStr string, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
 	return Default.ExecCmdWithInput(inputStr, cmdStr, sudo, chrootPath, envVal)
 }
+
+// ExecCmdWithStage runs a long-running build step. By default it behaves like
+// ExecCmd; when StreamStageOutput is enabled the output is streamed and each
+// line is logged as it arrives, prefixed with the stage name.
+func ExecCmdWithStage(stage, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	if !StreamStageOutput {
+		return Default.ExecCmd(cmdStr, sudo, chrootPath, envVal)
+	}
+	return execCmdWithStagePrefix(stage, cmdStr, sudo, chrootPath, envVal)
+}
+
+// ExecCmdWithStreamStage is ExecCmdWithStage for steps that already stream
+// their output: when StreamStageOutput is disabled it keeps using
+// ExecCmdWithStream instead of falling back to buffered execution.
+func ExecCmdWithStreamStage(stage, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	if !StreamStageOutput {
+		return Default.ExecCmdWithStream(cmdStr, sudo, chrootPath, envVal)
+	}
+	return execCmdWithStagePrefix(stage, cmdStr, sudo, chrootPath, envVal)
+}
+
+func execCmdWithStagePrefix(stage, cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	onLine := func(line string) {
+		log.Infof("[%s] %s", stage, line)
+	}
+	if streamer, ok := Default.(LineStreamer); ok {
+		return streamer.ExecCmdWithLineHandler(cmdStr, sudo, chrootPath, envVal, onLine)
+	}
+
+	// Executors without line callbacks only return the output once the
+	// command has finished, so forward it line by line afterwards.
+	output, err := Default.ExecCmdWithStream(cmdStr, sudo, chrootPath, envVal)
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			onLine(line)
+		}
+	}
+	return output, err
+}
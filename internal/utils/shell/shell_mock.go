@@ -52,6 +52,10 @@ func getFullCmdStr(cmdStr string, sudo bool, chrootPath string, envVal []string)
 
 func (m *MockExecutor) execCmdOverride(cmdStr string, sudo bool, chrootPath string, envVal []string) (bool, string, error) {
 	var fallback2Default = true
+	// Refuse commands past BuildDeadline like DefaultExecutor does
+	if _, _, err := cmdLimitFor(chrootPath); err != nil {
+		return false, "", err
+	}
 	fullCmdStr, err := getFullCmdStr(cmdStr, sudo, chrootPath, envVal)
 	if err != nil {
 		return fallback2Default, "", fmt.Errorf("failed to get full command string: %w", err)
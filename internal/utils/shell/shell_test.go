@@ -1,11 +1,13 @@
 package shell_test
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
 )
 
@@ -318,6 +320,146 @@ func TestExecCmdWithStream_Error(t *testing.T) {
 	}
 }
 
+// streamingExecutor is a mock executor that emits canned output line by line
+// through the LineStreamer interface and records which entry point was used.
+type streamingExecutor struct {
+	shell.MockExecutor
+	lines              []string
+	streamCalls        int
+	bufferedCalls      int
+	plainStreamedCalls int
+}
+
+func (e *streamingExecutor) ExecCmdWithStream(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.plainStreamedCalls++
+	return strings.Join(e.lines, "\n"), nil
+}
+
+func (e *streamingExecutor) ExecCmd(cmdStr string, sudo bool, chrootPath string, envVal []string) (string, error) {
+	e.bufferedCalls++
+	return strings.Join(e.lines, "\n"), nil
+}
+
+func (e *streamingExecutor) ExecCmdWithLineHandler(cmdStr string, sudo bool, chrootPath string, envVal []string, onLine func(string)) (string, error) {
+	e.streamCalls++
+	for _, line := range e.lines {
+		onLine(line)
+	}
+	return strings.Join(e.lines, "\n"), nil
+}
+
+func TestExecCmdWithStage(t *testing.T) {
+	originalExecutor := shell.Default
+	originalStream := shell.StreamStageOutput
+	defer func() {
+		shell.Default = originalExecutor
+		shell.StreamStageOutput = originalStream
+	}()
+
+	lines := []string{"Unpacking openssh-server", "Setting up openssh-server", "Processing triggers"}
+
+	t.Run("buffered by default", func(t *testing.T) {
+		executor := &streamingExecutor{lines: lines}
+		shell.Default = executor
+		shell.StreamStageOutput = false
+
+		output, err := shell.ExecCmdWithStage("install", "apt-get install -y openssh-server", true, shell.HostPath, nil)
+		if err != nil {
+			t.Fatalf("ExecCmdWithStage failed: %v", err)
+		}
+		if executor.bufferedCalls != 1 || executor.streamCalls != 0 {
+			t.Errorf("Expected one buffered call and no streaming, got buffered=%d stream=%d",
+				executor.bufferedCalls, executor.streamCalls)
+		}
+		if output != strings.Join(lines, "\n") {
+			t.Errorf("Unexpected output: %q", output)
+		}
+	})
+
+	t.Run("stream stage keeps plain streaming by default", func(t *testing.T) {
+		executor := &streamingExecutor{lines: lines}
+		shell.Default = executor
+		shell.StreamStageOutput = false
+
+		if _, err := shell.ExecCmdWithStreamStage("install", "apt-get install -y openssh-server", true, shell.HostPath, nil); err != nil {
+			t.Fatalf("ExecCmdWithStreamStage failed: %v", err)
+		}
+		if executor.plainStreamedCalls != 1 || executor.bufferedCalls != 0 || executor.streamCalls != 0 {
+			t.Errorf("Expected one plain streaming call, got plain=%d buffered=%d stage=%d",
+				executor.plainStreamedCalls, executor.bufferedCalls, executor.streamCalls)
+		}
+	})
+
+	t.Run("stream stage uses stage prefix when enabled", func(t *testing.T) {
+		executor := &streamingExecutor{lines: lines}
+		shell.Default = executor
+		shell.StreamStageOutput = true
+
+		if _, err := shell.ExecCmdWithStreamStage("install", "apt-get install -y openssh-server", true, shell.HostPath, nil); err != nil {
+			t.Fatalf("ExecCmdWithStreamStage failed: %v", err)
+		}
+		if executor.streamCalls != 1 || executor.plainStreamedCalls != 0 {
+			t.Errorf("Expected one line-handler call, got stage=%d plain=%d",
+				executor.streamCalls, executor.plainStreamedCalls)
+		}
+	})
+
+	t.Run("streams with stage prefix", func(t *testing.T) {
+		executor := &streamingExecutor{lines: lines}
+		shell.Default = executor
+		shell.StreamStageOutput = true
+
+		buf := &bytes.Buffer{}
+		prev := logger.ReplaceStderrWriter(buf)
+		_, err := shell.ExecCmdWithStage("install", "apt-get install -y openssh-server", true, shell.HostPath, nil)
+		_ = logger.Logger().Sync()
+		logger.ReplaceStderrWriter(prev)
+		if err != nil {
+			t.Fatalf("ExecCmdWithStage failed: %v", err)
+		}
+		if executor.streamCalls != 1 || executor.bufferedCalls != 0 {
+			t.Errorf("Expected one streaming call and no buffered call, got buffered=%d stream=%d",
+				executor.bufferedCalls, executor.streamCalls)
+		}
+
+		logs := buf.String()
+		lastIdx := -1
+		for _, line := range lines {
+			idx := strings.Index(logs, "[install] "+line)
+			if idx < 0 {
+				t.Fatalf("Expected log line %q with stage prefix, got: %s", line, logs)
+			}
+			if idx < lastIdx {
+				t.Errorf("Expected line %q to be logged in order", line)
+			}
+			lastIdx = idx
+		}
+	})
+
+	t.Run("forwards lines from executors without line callbacks", func(t *testing.T) {
+		shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+			{Pattern: "ukify build", Output: "Wrote unsigned uki.efi\nDone\n", Error: nil},
+		})
+		shell.StreamStageOutput = true
+
+		buf := &bytes.Buffer{}
+		prev := logger.ReplaceStderrWriter(buf)
+		_, err := shell.ExecCmdWithStage("uki", "ukify build --output uki.efi", true, shell.HostPath, nil)
+		_ = logger.Logger().Sync()
+		logger.ReplaceStderrWriter(prev)
+		if err != nil {
+			t.Fatalf("ExecCmdWithStage failed: %v", err)
+		}
+
+		logs := buf.String()
+		for _, line := range []string{"[uki] Wrote unsigned uki.efi", "[uki] Done"} {
+			if !strings.Contains(logs, line) {
+				t.Errorf("Expected log line %q, got: %s", line, logs)
+			}
+		}
+	})
+}
+
 func TestGetFullCmdStr_UnknownCommand(t *testing.T) {
 	// Test a command that is not in the commandMap
 	// "unknowncmd" is not in the map
@@ -360,3 +502,20 @@ func TestGetFullCmdStr_Env(t *testing.T) {
 		t.Errorf("Expected env var in command, got: %s", fullCmd)
 	}
 }
+
+func TestSingleQuote(t *testing.T) {
+	for _, s := range []string{
+		"plain",
+		"with space",
+		"pkcs11:object=x'; touch /tmp/pwned; '",
+		"$(id) `id` \"double\"",
+	} {
+		out, err := shell.ExecCmd("echo "+shell.SingleQuote(s), false, shell.HostPath, nil)
+		if err != nil {
+			t.Fatalf("ExecCmd failed for %q: %v", s, err)
+		}
+		if got := strings.TrimSuffix(out, "\n"); got != s {
+			t.Errorf("expected the quoted word to reach the command unchanged, got %q, want %q", got, s)
+		}
+	}
+}
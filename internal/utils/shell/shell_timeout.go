@@ -0,0 +1,191 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrCmdTimeout is returned, wrapped, when a command was killed because it
+// ran longer than CmdTimeout.
+var ErrCmdTimeout = errors.New("command timed out")
+
+// CmdTimeout bounds how long a command run inside a chroot may take before
+// every process it started is killed. Zero means no limit.
+var CmdTimeout time.Duration
+
+// CmdRetries is how many more times WithRetry runs a command after it failed
+// or timed out.
+var CmdRetries int
+
+// ErrBuildDeadline is returned, wrapped, when a command was killed or
+// refused because the build ran past BuildDeadline.
+var ErrBuildDeadline = errors.New("build deadline exceeded")
+
+// BuildDeadline is the time by which the whole build must be done. Commands
+// still running then are killed, and commands started later are refused,
+// except during a cleanup phase, see BeginCleanup. Zero means no deadline.
+var BuildDeadline time.Time
+
+// cleanupDepth counts the cleanup phases in progress, see BeginCleanup.
+var cleanupDepth atomic.Int32
+
+// BeginCleanup lifts BuildDeadline for the commands run until the returned
+// function is called, so that a build that ran past its deadline can still
+// unmount and release what it set up, whatever commands that takes. Cleanup
+// phases may nest.
+func BeginCleanup() (end func()) {
+	cleanupDepth.Add(1)
+	return func() { cleanupDepth.Add(-1) }
+}
+
+// CheckBuildDeadline returns an error wrapping ErrBuildDeadline once
+// BuildDeadline passed. Long-running steps that do not run commands, such as
+// downloads, call it to stop in time.
+func CheckBuildDeadline() error {
+	if !BuildDeadline.IsZero() && !time.Now().Before(BuildDeadline) {
+		return fmt.Errorf("%w at %s", ErrBuildDeadline, BuildDeadline.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// cmdKillGrace is how long a timed-out command gets to exit after SIGTERM
+// before whatever is left of it is killed with SIGKILL.
+var cmdKillGrace = 5 * time.Second
+
+// cmdTimeoutFor returns the timeout of a command run in chrootPath.
+func cmdTimeoutFor(chrootPath string) time.Duration {
+	if chrootPath == HostPath {
+		return 0
+	}
+	return CmdTimeout
+}
+
+// cmdLimitFor returns the timeout of a command run in chrootPath: the smaller of
+// its command timeout and the time left until BuildDeadline, in which case
+// byDeadline is set. Once the deadline passed, it returns an error for any
+// command run outside a cleanup phase.
+func cmdLimitFor(chrootPath string) (timeout time.Duration, byDeadline bool, err error) {
+	timeout = cmdTimeoutFor(chrootPath)
+	if BuildDeadline.IsZero() || cleanupDepth.Load() > 0 {
+		return timeout, false, nil
+	}
+	left := time.Until(BuildDeadline)
+	if left <= 0 {
+		return 0, false, CheckBuildDeadline()
+	}
+	if timeout == 0 || left < timeout {
+		return left, true, nil
+	}
+	return timeout, false, nil
+}
+
+// deadlineErr returns err, which a command bounded by the build deadline
+// returned, as an ErrBuildDeadline error when the command timed out.
+func deadlineErr(err error, byDeadline bool) error {
+	if byDeadline && errors.Is(err, ErrCmdTimeout) {
+		return fmt.Errorf("%w, command killed", ErrBuildDeadline)
+	}
+	return err
+}
+
+// newBashCmd returns a bash command running fullCmdStr. With a timeout, the
+// command runs in its own process group so that everything it started can be
+// killed together.
+func newBashCmd(fullCmdStr string, timeout time.Duration) *exec.Cmd {
+	cmd := exec.Command("bash", "-c", fullCmdStr)
+	if timeout > 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		// Do not wait forever for output pipes held open by a process that
+		// escaped the process group
+		cmd.WaitDelay = cmdKillGrace
+	}
+	return cmd
+}
+
+// startWatchdog kills the process group of the started cmd once timeout
+// expires: SIGTERM first, which sudo passes on to the command it runs, then
+// SIGKILL for anything still running cmdKillGrace later. The returned stop
+// function must be called once cmd.Wait returned; it reports whether the
+// command timed out and kills any process of the group left behind.
+func startWatchdog(cmd *exec.Cmd, timeout time.Duration) (stop func() bool) {
+	if timeout <= 0 {
+		return func() bool { return false }
+	}
+
+	pgid := cmd.Process.Pid
+	killGrace := cmdKillGrace
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	fired := false
+	go func() {
+		defer close(exited)
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		fired = true
+		log.Warnf("Command timed out after %s, terminating its processes", timeout)
+		_ = syscall.Kill(-pgid, syscall.SIGTERM)
+
+		grace := time.NewTimer(killGrace)
+		defer grace.Stop()
+		select {
+		case <-done:
+		case <-grace.C:
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		<-exited
+		if !fired {
+			return false
+		}
+		// The direct child was reaped by Wait; children that ignored
+		// SIGTERM and outlived it are killed and reaped by init
+		_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		return true
+	}
+}
+
+// runBashCmd runs fullCmdStr with stdin as its input and returns its combined
+// output, killing it once timeout expires.
+func runBashCmd(fullCmdStr string, stdin io.Reader, timeout time.Duration) (string, error) {
+	cmd := newBashCmd(fullCmdStr, timeout)
+	cmd.Stdin = stdin
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	stop := startWatchdog(cmd, timeout)
+	err := cmd.Wait()
+	if stop() {
+		return output.String(), fmt.Errorf("%w after %s", ErrCmdTimeout, timeout)
+	}
+	return output.String(), err
+}
+
+// WithRetry calls run, calling it again up to CmdRetries times while it
+// fails. Only use it for idempotent commands, which are safe to run again
+// after being killed part way through.
+func WithRetry(run func() (string, error)) (string, error) {
+	output, err := run()
+	for attempt := 1; err != nil && attempt <= CmdRetries; attempt++ {
+		log.Warnf("Command failed, retrying (%d/%d): %v", attempt, CmdRetries, err)
+		output, err = run()
+	}
+	return output, err
+}
@@ -0,0 +1,213 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processRunning reports whether pid is a live process, not counting zombies
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z" && fields[0] != "X"
+}
+
+func TestRunBashCmd_Timeout(t *testing.T) {
+	start := time.Now()
+	_, err := runBashCmd("sleep 30", nil, 200*time.Millisecond)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrCmdTimeout) {
+		t.Fatalf("Expected ErrCmdTimeout, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out after 200ms") {
+		t.Errorf("Expected the error to report the timeout, got: %v", err)
+	}
+	if elapsed >= cmdKillGrace {
+		t.Errorf("Expected sleep to be terminated by SIGTERM, took %s", elapsed)
+	}
+}
+
+func TestRunBashCmd_TimeoutKillsProcessGroup(t *testing.T) {
+	originalGrace := cmdKillGrace
+	cmdKillGrace = 300 * time.Millisecond
+	defer func() { cmdKillGrace = originalGrace }()
+
+	// The ignored SIGTERM is inherited by the background sleep, so only
+	// SIGKILL to the whole process group stops both
+	start := time.Now()
+	output, err := runBashCmd("trap '' TERM; sleep 30 & echo $!; wait", nil, 200*time.Millisecond)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrCmdTimeout) {
+		t.Fatalf("Expected ErrCmdTimeout, got: %v", err)
+	}
+	if elapsed >= 10*time.Second {
+		t.Errorf("Expected the process group to be killed after the grace period, took %s", elapsed)
+	}
+	pid, convErr := strconv.Atoi(strings.TrimSpace(output))
+	if convErr != nil {
+		t.Fatalf("Expected the background pid in the output, got %q", output)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for processRunning(pid) && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if processRunning(pid) {
+		t.Errorf("Expected background process %d to be killed", pid)
+	}
+}
+
+func TestRunBashCmd_WithinTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		cmd         string
+		timeout     time.Duration
+		expectOut   string
+		expectError bool
+	}{
+		{name: "no timeout", cmd: "echo done", timeout: 0, expectOut: "done"},
+		{name: "finishes in time", cmd: "echo done", timeout: 5 * time.Second, expectOut: "done"},
+		{name: "fails in time", cmd: "echo failing; exit 3", timeout: 5 * time.Second, expectOut: "failing", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runBashCmd(tt.cmd, nil, tt.timeout)
+			if errors.Is(err, ErrCmdTimeout) {
+				t.Fatalf("Expected no timeout, got: %v", err)
+			}
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got: %v", tt.expectError, err)
+			}
+			if !strings.Contains(output, tt.expectOut) {
+				t.Errorf("Expected output to contain %q, got %q", tt.expectOut, output)
+			}
+		})
+	}
+}
+
+func TestCmdTimeoutFor(t *testing.T) {
+	originalTimeout := CmdTimeout
+	CmdTimeout = time.Minute
+	defer func() { CmdTimeout = originalTimeout }()
+
+	if got := cmdTimeoutFor(HostPath); got != 0 {
+		t.Errorf("Expected host commands not to time out, got %s", got)
+	}
+	if got := cmdTimeoutFor("/tmp/chroot"); got != time.Minute {
+		t.Errorf("Expected chroot commands to time out after 1m, got %s", got)
+	}
+}
+
+func TestCmdLimitFor_BuildDeadline(t *testing.T) {
+	originalTimeout, originalDeadline := CmdTimeout, BuildDeadline
+	defer func() { CmdTimeout, BuildDeadline = originalTimeout, originalDeadline }()
+	CmdTimeout = time.Minute
+
+	BuildDeadline = time.Now().Add(time.Hour)
+	if timeout, byDeadline, err := cmdLimitFor("/tmp/chroot"); err != nil || byDeadline || timeout != time.Minute {
+		t.Errorf("Expected the command timeout before a far deadline, got %s, %v, %v", timeout, byDeadline, err)
+	}
+	timeout, byDeadline, err := cmdLimitFor(HostPath)
+	if err != nil || !byDeadline || timeout <= 59*time.Minute || timeout > time.Hour {
+		t.Errorf("Expected host commands to be bounded by the deadline, got %s, %v, %v", timeout, byDeadline, err)
+	}
+
+	BuildDeadline = time.Now().Add(-time.Second)
+	if _, _, err := cmdLimitFor("/tmp/chroot"); !errors.Is(err, ErrBuildDeadline) {
+		t.Errorf("Expected commands to be refused after the deadline, got %v", err)
+	}
+	if _, _, err := cmdLimitFor(HostPath); !errors.Is(err, ErrBuildDeadline) {
+		t.Errorf("Expected unmounting outside a cleanup phase to be refused after the deadline, got %v", err)
+	}
+
+	endCleanup := BeginCleanup()
+	if timeout, byDeadline, err := cmdLimitFor("/tmp/chroot"); err != nil || byDeadline || timeout != time.Minute {
+		t.Errorf("Expected commands of a cleanup phase to run after the deadline, got %s, %v, %v", timeout, byDeadline, err)
+	}
+	endInner := BeginCleanup()
+	endInner()
+	if _, _, err := cmdLimitFor(HostPath); err != nil {
+		t.Errorf("Expected the outer cleanup phase to last after a nested one ended, got %v", err)
+	}
+	endCleanup()
+	if _, _, err := cmdLimitFor(HostPath); !errors.Is(err, ErrBuildDeadline) {
+		t.Errorf("Expected commands to be refused again after the cleanup phase, got %v", err)
+	}
+}
+
+func TestExecCmd_BuildDeadline(t *testing.T) {
+	originalDeadline := BuildDeadline
+	defer func() { BuildDeadline = originalDeadline }()
+
+	BuildDeadline = time.Now().Add(200 * time.Millisecond)
+	start := time.Now()
+	_, err := ExecCmd("sleep 30", false, HostPath, nil)
+	if !errors.Is(err, ErrBuildDeadline) {
+		t.Fatalf("Expected a build deadline error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Command was killed %s after it started, expected it at the deadline", elapsed)
+	}
+
+	if _, err := ExecCmd("sleep 0", false, HostPath, nil); !errors.Is(err, ErrBuildDeadline) {
+		t.Errorf("Expected commands to be refused after the deadline, got: %v", err)
+	}
+	endCleanup := BeginCleanup()
+	defer endCleanup()
+	if _, err := ExecCmd("command -v sync && mount >/dev/null", false, HostPath, nil); err != nil {
+		t.Errorf("Expected any command of a cleanup phase to run after the deadline, got: %v", err)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	originalRetries := CmdRetries
+	defer func() { CmdRetries = originalRetries }()
+
+	tests := []struct {
+		name          string
+		retries       int
+		failures      int
+		expectCalls   int
+		expectSuccess bool
+	}{
+		{name: "no retries", retries: 0, failures: 1, expectCalls: 1},
+		{name: "succeeds on retry", retries: 2, failures: 2, expectCalls: 3, expectSuccess: true},
+		{name: "retries exhausted", retries: 2, failures: 5, expectCalls: 3},
+		{name: "first attempt succeeds", retries: 2, failures: 0, expectCalls: 1, expectSuccess: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			CmdRetries = tt.retries
+			calls := 0
+			output, err := WithRetry(func() (string, error) {
+				calls++
+				if calls <= tt.failures {
+					return "", fmt.Errorf("attempt %d: %w after 1s", calls, ErrCmdTimeout)
+				}
+				return "ok", nil
+			})
+			if calls != tt.expectCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectCalls, calls)
+			}
+			if tt.expectSuccess {
+				if err != nil || output != "ok" {
+					t.Errorf("Expected success, got output %q and error %v", output, err)
+				}
+			} else if !errors.Is(err, ErrCmdTimeout) {
+				t.Errorf("Expected the last timeout error, got: %v", err)
+			}
+		})
+	}
+}
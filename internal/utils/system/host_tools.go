@@ -0,0 +1,144 @@
+package system
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+)
+
+// HostToolVersionCmds maps the host tools whose behavior changes between
+// versions, and whose version is recorded for each build, to the command
+// printing their version.
+var HostToolVersionCmds = map[string]string{
+	"mmdebstrap": "mmdebstrap --version",
+	"xorriso":    "xorriso -version",
+	"ukify":      "ukify --version",
+	"rpm":        "rpm --version",
+	"tdnf":       "tdnf --version",
+}
+
+// toolVersionPattern matches the first dotted version number in the output
+// of a version command, e.g. "1.4.3" in "mmdebstrap 1.4.3".
+var toolVersionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// UnknownToolVersion is the version recorded for an installed host tool
+// whose version command fails or prints no version.
+const UnknownToolVersion = "unknown"
+
+// GetHostToolVersions returns the versions of the HostToolVersionCmds tools
+// installed on the host, by tool name. Tools that are not installed are left
+// out.
+func GetHostToolVersions() (map[string]string, error) {
+	tools := make([]string, 0, len(HostToolVersionCmds))
+	for tool := range HostToolVersionCmds {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+
+	versions := make(map[string]string)
+	for _, tool := range tools {
+		exists, err := shell.IsCommandExist(tool, shell.HostPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check command %s existence: %w", tool, err)
+		}
+		if !exists {
+			continue
+		}
+		versions[tool] = UnknownToolVersion
+		output, err := shell.ExecCmdSilent(HostToolVersionCmds[tool], false, shell.HostPath, nil)
+		if err != nil {
+			log.Warnf("Failed to get the version of host tool %s: %v", tool, err)
+			continue
+		}
+		version := toolVersionPattern.FindString(output)
+		if version == "" {
+			log.Warnf("No version found in the output of %q: %s", HostToolVersionCmds[tool], strings.TrimSpace(output))
+			continue
+		}
+		log.Debugf("Host tool %s version %s", tool, version)
+		versions[tool] = version
+	}
+	return versions, nil
+}
+
+// CheckHostToolVersions checks the host tool versions returned by
+// GetHostToolVersions against minimums, which maps tool names to their
+// minimum dotted version. Tools that are not installed are not checked, as
+// the build does not use them; an installed tool of unknown version fails
+// the check. Every tool that is too old is reported in a single error.
+func CheckHostToolVersions(versions, minimums map[string]string) error {
+	tools := make([]string, 0, len(minimums))
+	for tool := range minimums {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+
+	var tooOld []string
+	for _, tool := range tools {
+		version, ok := versions[tool]
+		if !ok {
+			continue
+		}
+		if version == UnknownToolVersion {
+			tooOld = append(tooOld, fmt.Sprintf("%s of unknown version (minimum %s)", tool, minimums[tool]))
+			continue
+		}
+		cmp, err := CompareToolVersions(version, minimums[tool])
+		if err != nil {
+			return fmt.Errorf("invalid version of %s: %w", tool, err)
+		}
+		if cmp < 0 {
+			tooOld = append(tooOld, fmt.Sprintf("%s %s (minimum %s)", tool, version, minimums[tool]))
+		}
+	}
+	if len(tooOld) > 0 {
+		return fmt.Errorf("host tools older than the configured minimum versions: %s",
+			strings.Join(tooOld, ", "))
+	}
+	return nil
+}
+
+// CompareToolVersions compares the dotted numeric versions a and b, and
+// returns -1, 0 or 1 as a is older than, the same as or newer than b.
+// Missing components count as 0, so 1.4 is the same as 1.4.0.
+func CompareToolVersions(a, b string) (int, error) {
+	parse := func(v string) ([]int, error) {
+		var parts []int
+		for _, s := range strings.Split(v, ".") {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%q is not a dotted numeric version", v)
+			}
+			parts = append(parts, n)
+		}
+		return parts, nil
+	}
+	pa, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,123 @@
+package system_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/shell"
+	"github.com/open-edge-platform/image-composer-tool/internal/utils/system"
+)
+
+func TestGetHostToolVersions(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	shell.Default = shell.NewMockExecutor([]shell.MockCommand{
+		{Pattern: "command -v mmdebstrap", Output: "/usr/bin/mmdebstrap\n", Error: nil},
+		{Pattern: "command -v xorriso", Output: "/usr/bin/xorriso\n", Error: nil},
+		{Pattern: "command -v ukify", Output: "/usr/bin/ukify\n", Error: nil},
+		{Pattern: "command -v", Output: "", Error: fmt.Errorf("exit status 1")},
+		{Pattern: "mmdebstrap --version", Output: "mmdebstrap 1.3.5\n", Error: nil},
+		{Pattern: "xorriso -version", Output: "xorriso 1.5.4 : RockRidge filesystem manipulator, libburnia project.\n\nxorriso 1.5.4\nISO 9660 Rock Ridge filesystem manipulator and CD/DVD/BD burn program\n", Error: nil},
+		{Pattern: "ukify --version", Output: "ukify: no version\n", Error: nil},
+	})
+
+	versions, err := system.GetHostToolVersions()
+	if err != nil {
+		t.Fatalf("GetHostToolVersions() error = %v", err)
+	}
+	expected := map[string]string{
+		"mmdebstrap": "1.3.5",
+		"xorriso":    "1.5.4",
+		"ukify":      system.UnknownToolVersion,
+	}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("GetHostToolVersions() = %v, want %v", versions, expected)
+	}
+}
+
+func TestCheckHostToolVersions(t *testing.T) {
+	versions := map[string]string{
+		"mmdebstrap": "1.3.5",
+		"xorriso":    "1.5.4",
+		"ukify":      system.UnknownToolVersion,
+	}
+
+	tests := []struct {
+		name          string
+		minimums      map[string]string
+		errorContains []string
+	}{
+		{
+			name:     "no_minimums",
+			minimums: nil,
+		},
+		{
+			name:     "recent_enough",
+			minimums: map[string]string{"mmdebstrap": "1.3", "xorriso": "1.5.4"},
+		},
+		{
+			name:     "tool_not_installed",
+			minimums: map[string]string{"tdnf": "3.5"},
+		},
+		{
+			name:          "too_old",
+			minimums:      map[string]string{"mmdebstrap": "1.4.0", "xorriso": "1.5.6"},
+			errorContains: []string{"mmdebstrap 1.3.5 (minimum 1.4.0), xorriso 1.5.4 (minimum 1.5.6)"},
+		},
+		{
+			name:          "unknown_version",
+			minimums:      map[string]string{"ukify": "255"},
+			errorContains: []string{"ukify of unknown version (minimum 255)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := system.CheckHostToolVersions(versions, tt.minimums)
+			if len(tt.errorContains) == 0 {
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected error but got none")
+			}
+			for _, msg := range tt.errorContains {
+				if !strings.Contains(err.Error(), msg) {
+					t.Errorf("Expected error containing %q, got: %v", msg, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareToolVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.4.3", "1.4.3", 0},
+		{"1.4", "1.4.0", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"1.3.5", "1.4", -1},
+		{"255", "254.1", 1},
+	}
+	for _, tt := range tests {
+		got, err := system.CompareToolVersions(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("CompareToolVersions(%q, %q) error = %v", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CompareToolVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	if _, err := system.CompareToolVersions("1.x", "1.0"); err == nil {
+		t.Error("Expected an error for a non-numeric version")
+	}
+}
@@ -2,8 +2,12 @@ package system
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/open-edge-platform/image-composer-tool/internal/utils/logger"
@@ -11,8 +15,15 @@ import (
 )
 
 var (
-	log           = logger.Logger()
-	OsReleaseFile = "/etc/os-release"
+	log                  = logger.Logger()
+	OsReleaseFile        = "/etc/os-release"
+	UsrLibOsReleaseFile  = "/usr/lib/os-release"
+	DistReleaseFilesGlob = "/etc/*-release"
+
+	// ErrHostOsUnknown is returned by GetHostOsInfo when neither an
+	// os-release file, lsb_release nor a legacy release file identifies the
+	// host OS.
+	ErrHostOsUnknown = errors.New("could not determine host OS")
 )
 
 func GetHostOsInfo() (map[string]string, error) {
@@ -31,59 +42,184 @@ func GetHostOsInfo() (map[string]string, error) {
 		hostOsInfo["arch"] = strings.TrimSpace(output)
 	}
 
-	// Read from /etc/os-release if it exists
-	if _, err := os.Stat(OsReleaseFile); err == nil {
-		file, err := os.Open(OsReleaseFile)
-		if err == nil {
-			defer file.Close()
-			scanner := bufio.NewScanner(file)
-
-			for scanner.Scan() {
-				line := scanner.Text()
-				if strings.HasPrefix(line, "NAME=") {
-					parts := strings.SplitN(line, "=", 2)
-					if len(parts) == 2 {
-						hostOsInfo["name"] = strings.Trim(strings.TrimSpace(parts[1]), "\"")
-					}
-				} else if strings.HasPrefix(line, "VERSION_ID=") {
-					parts := strings.SplitN(line, "=", 2)
-					if len(parts) == 2 {
-						hostOsInfo["version"] = strings.Trim(strings.TrimSpace(parts[1]), "\"")
-					}
-				}
-			}
+	if readOsReleaseFile(OsReleaseFile, hostOsInfo) {
+		log.Infof("Detected OS info: " + hostOsInfo["name"] + " " +
+			hostOsInfo["version"] + " " + hostOsInfo["arch"])
+		return hostOsInfo, nil
+	}
+
+	lsbErr := readLsbRelease(hostOsInfo)
+	if lsbErr == nil {
+		log.Infof("Detected OS info: " + hostOsInfo["name"] + " " +
+			hostOsInfo["version"] + " " + hostOsInfo["arch"])
+		return hostOsInfo, nil
+	}
+	log.Debugf("lsb_release cannot report the host OS: %v", lsbErr)
+
+	// Minimal containers often lack lsb_release, but still ship the vendor
+	// os-release or a legacy /etc/<distro>-release file
+	if readOsReleaseFile(UsrLibOsReleaseFile, hostOsInfo) || readDistReleaseFiles(hostOsInfo) {
+		log.Infof("Detected OS info: " + hostOsInfo["name"] + " " +
+			hostOsInfo["version"] + " " + hostOsInfo["arch"])
+		return hostOsInfo, nil
+	}
 
-			log.Infof("Detected OS info: " + hostOsInfo["name"] + " " +
-				hostOsInfo["version"] + " " + hostOsInfo["arch"])
+	log.Errorf("Failed to detect host OS info!")
+	return hostOsInfo, fmt.Errorf("%w: none of %s, %s or %s exists and lsb_release failed (%v); "+
+		"install the os-release file of the host distribution (e.g. the base-files package) or lsb_release",
+		ErrHostOsUnknown, OsReleaseFile, UsrLibOsReleaseFile, DistReleaseFilesGlob, lsbErr)
+}
 
-			return hostOsInfo, nil
+// readOsReleaseFile fills the name and version of hostOsInfo from the
+// os-release(5) file at path, and reports whether the file could be read.
+func readOsReleaseFile(path string, hostOsInfo map[string]string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "NAME":
+			hostOsInfo["name"] = parseOsReleaseValue(value)
+		case "VERSION_ID":
+			hostOsInfo["version"] = parseOsReleaseValue(value)
 		}
 	}
+	return true
+}
 
-	output, err = shell.ExecCmd("lsb_release -si", false, shell.HostPath, nil)
+// readLsbRelease fills the name and version of hostOsInfo from lsb_release.
+func readLsbRelease(hostOsInfo map[string]string) error {
+	output, err := shell.ExecCmd("lsb_release -si", false, shell.HostPath, nil)
 	if err != nil {
-		log.Errorf("Failed to get host OS name: %v", err)
-		return hostOsInfo, fmt.Errorf("failed to get host OS name: %w", err)
-	} else {
-		if output != "" {
-			hostOsInfo["name"] = strings.TrimSpace(output)
-			output, err = shell.ExecCmd("lsb_release -sr", false, shell.HostPath, nil)
-			if err != nil {
-				log.Errorf("Failed to get host OS version: %v", err)
-				return hostOsInfo, fmt.Errorf("failed to get host OS version: %w", err)
-			} else {
-				if output != "" {
-					hostOsInfo["version"] = strings.TrimSpace(output)
-					log.Infof("Detected OS info: " + hostOsInfo["name"] + " " +
-						hostOsInfo["version"] + " " + hostOsInfo["arch"])
-					return hostOsInfo, nil
+		return fmt.Errorf("failed to get host OS name: %w", err)
+	}
+	if strings.TrimSpace(output) == "" {
+		return fmt.Errorf("lsb_release reported no host OS name")
+	}
+	name := strings.TrimSpace(output)
+
+	output, err = shell.ExecCmd("lsb_release -sr", false, shell.HostPath, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get host OS version: %w", err)
+	}
+	if strings.TrimSpace(output) == "" {
+		return fmt.Errorf("lsb_release reported no host OS version")
+	}
+	hostOsInfo["name"] = name
+	hostOsInfo["version"] = strings.TrimSpace(output)
+	return nil
+}
+
+// readDistReleaseFiles fills the name and version of hostOsInfo from the
+// first legacy release file matching DistReleaseFilesGlob that it can parse,
+// such as /etc/redhat-release, /etc/alpine-release or /etc/lsb-release.
+func readDistReleaseFiles(hostOsInfo map[string]string) bool {
+	paths, err := filepath.Glob(DistReleaseFilesGlob)
+	if err != nil {
+		return false
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if filepath.Base(path) == "os-release" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if name, version := parseDistReleaseFile(filepath.Base(path), string(data)); name != "" {
+			hostOsInfo["name"] = name
+			hostOsInfo["version"] = version
+			return true
+		}
+	}
+	return false
+}
+
+// parseDistReleaseFile returns the OS name and version from the content of
+// a legacy release file named fileName. It understands the DISTRIB_ID and
+// DISTRIB_RELEASE assignments of lsb-release, "<name> release <version>"
+// lines, and files that hold only a version.
+func parseDistReleaseFile(fileName, content string) (name, version string) {
+	for _, line := range strings.Split(content, "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "DISTRIB_ID":
+			name = parseOsReleaseValue(value)
+		case "DISTRIB_RELEASE":
+			version = parseOsReleaseValue(value)
+		}
+	}
+	if name != "" {
+		return name, version
+	}
+
+	line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	line = strings.TrimSpace(line)
+	if before, after, found := strings.Cut(line, " release "); found {
+		if fields := strings.Fields(after); len(fields) > 0 {
+			version = fields[0]
+		}
+		return strings.TrimSpace(before), version
+	}
+	if line != "" && !strings.ContainsAny(line, " =") {
+		return strings.TrimSuffix(fileName, "-release"), line
+	}
+	return "", ""
+}
+
+// parseOsReleaseValue returns the value of an os-release assignment as a
+// shell would, following os-release(5): double-quoted text may escape $, ",
+// \ and ` with a backslash, single-quoted text is taken literally, and a #
+// that starts a word begins a comment. Unquoted whitespace between words is
+// kept so that non-compliant values like NAME=Alpine Linux still parse.
+func parseOsReleaseValue(raw string) string {
+	raw = strings.TrimSpace(raw)
+
+	var value, pending strings.Builder
+	write := func(c byte) {
+		value.WriteString(pending.String())
+		pending.Reset()
+		value.WriteByte(c)
+	}
+
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			for i++; i < len(raw) && raw[i] != '"'; i++ {
+				if raw[i] == '\\' && i+1 < len(raw) && strings.IndexByte("$\"\\`", raw[i+1]) >= 0 {
+					i++
 				}
+				write(raw[i])
 			}
+		case c == '\'':
+			for i++; i < len(raw) && raw[i] != '\''; i++ {
+				write(raw[i])
+			}
+		case c == '\\' && i+1 < len(raw):
+			i++
+			write(raw[i])
+		case c == ' ' || c == '\t':
+			pending.WriteByte(c)
+		case c == '#' && (i == 0 || pending.Len() > 0):
+			return value.String()
+		default:
+			write(c)
 		}
 	}
-
-	log.Errorf("Failed to detect host OS info!")
-	return hostOsInfo, fmt.Errorf("failed to detect host OS info")
+	return value.String()
 }
 
 func GetHostOsPkgManager() (string, error) {
@@ -105,6 +241,100 @@ func GetHostOsPkgManager() (string, error) {
 	}
 }
 
+// CheckHostPkgTools verifies that a host using hostPkgManager can provide every
+// tool in dependencyInfo, which maps each host command to the host package that
+// provides it. Missing tools whose package is available from the host
+// repositories pass the check so the caller can install them afterwards;
+// everything the host can neither run nor install is reported in a single error
+// so the build fails before any package is installed or downloaded.
+func CheckHostPkgTools(hostPkgManager string, dependencyInfo map[string]string) error {
+	cmds := make([]string, 0, len(dependencyInfo))
+	for cmd := range dependencyInfo {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+
+	var missing []string
+	for _, cmd := range cmds {
+		cmdExist, err := shell.IsCommandExist(cmd, shell.HostPath)
+		if err != nil {
+			return fmt.Errorf("failed to check command %s existence: %w", cmd, err)
+		}
+		if cmdExist {
+			continue
+		}
+		pkg := dependencyInfo[cmd]
+		if isHostPkgAvailable(hostPkgManager, pkg) {
+			log.Debugf("Host command %s is missing but package %s is installable", cmd, pkg)
+			continue
+		}
+		missing = append(missing, fmt.Sprintf("%s (package %s not available from %s repositories)",
+			cmd, pkg, hostPkgManager))
+	}
+
+	if len(missing) > 0 {
+		log.Errorf("Host is missing required tools: %s", strings.Join(missing, ", "))
+		return fmt.Errorf("%s-based host is missing required tools: %s; "+
+			"install them manually or build on a host that provides them",
+			hostPkgManager, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// isHostPkgAvailable reports whether pkg can be installed with the host package manager.
+func isHostPkgAvailable(hostPkgManager, pkg string) bool {
+	switch hostPkgManager {
+	case "apt":
+		output, err := shell.ExecCmdSilent("apt-cache policy "+pkg, false, shell.HostPath, nil)
+		if err != nil {
+			return false
+		}
+		for _, line := range strings.Split(output, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "Candidate:") {
+				candidate := strings.TrimSpace(strings.TrimPrefix(line, "Candidate:"))
+				return candidate != "" && candidate != "(none)"
+			}
+		}
+		return false
+	case "yum", "tdnf":
+		_, err := shell.ExecCmdSilent(hostPkgManager+" info "+pkg, false, shell.HostPath, nil)
+		return err == nil
+	default:
+		return false
+	}
+}
+
+// FormatBytes renders a byte count with a binary unit, e.g. "1.50 GiB".
+func FormatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// SourceDateEpoch returns the Unix timestamp set by SOURCE_DATE_EPOCH, which
+// reproducible builds pin their timestamps to, and whether it is set. An
+// invalid value is ignored with a warning.
+func SourceDateEpoch() (int64, bool) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return 0, false
+	}
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || epoch < 0 {
+		log.Warnf("Ignoring invalid SOURCE_DATE_EPOCH: %s", value)
+		return 0, false
+	}
+	return epoch, true
+}
+
 func GetProviderId(os, dist, arch string) string {
 	return os + "-" + dist + "-" + arch
 }
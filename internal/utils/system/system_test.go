@@ -1,6 +1,7 @@
 package system_test
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,7 +14,13 @@ import (
 
 func TestGetHostOsInfo(t *testing.T) {
 	originalExecutor := shell.Default
-	defer func() { shell.Default = originalExecutor }()
+	originalUsrLibOsReleaseFile := system.UsrLibOsReleaseFile
+	originalDistReleaseFilesGlob := system.DistReleaseFilesGlob
+	defer func() {
+		shell.Default = originalExecutor
+		system.UsrLibOsReleaseFile = originalUsrLibOsReleaseFile
+		system.DistReleaseFilesGlob = originalDistReleaseFilesGlob
+	}()
 
 	tests := []struct {
 		name          string
@@ -23,6 +30,7 @@ func TestGetHostOsInfo(t *testing.T) {
 		expected      map[string]string
 		expectError   bool
 		errorMsg      string
+		errorIs       error
 	}{
 		{
 			name: "successful_os_release_parsing",
@@ -84,7 +92,8 @@ UBUNTU_CODENAME=focal`
 			setupFunc:   nil,
 			expected:    map[string]string{"name": "", "version": "", "arch": "x86_64"},
 			expectError: true,
-			errorMsg:    "failed to get host OS name",
+			errorMsg:    "could not determine host OS",
+			errorIs:     system.ErrHostOsUnknown,
 		},
 		{
 			name: "lsb_release_sr_failure",
@@ -96,7 +105,8 @@ UBUNTU_CODENAME=focal`
 			setupFunc:   nil,
 			expected:    map[string]string{"name": "Ubuntu", "version": "", "arch": "x86_64"},
 			expectError: true,
-			errorMsg:    "failed to get host OS version",
+			errorMsg:    "could not determine host OS",
+			errorIs:     system.ErrHostOsUnknown,
 		},
 		{
 			name: "lsb_release_empty_output",
@@ -107,7 +117,65 @@ UBUNTU_CODENAME=focal`
 			setupFunc:   nil,
 			expected:    map[string]string{"name": "", "version": "", "arch": "x86_64"},
 			expectError: true,
-			errorMsg:    "failed to detect host OS info",
+			errorMsg:    "could not determine host OS",
+			errorIs:     system.ErrHostOsUnknown,
+		},
+		{
+			name: "usr_lib_os_release_fallback",
+			mockCommands: []shell.MockCommand{
+				{Pattern: "uname -m", Output: "x86_64\n", Error: nil},
+				{Pattern: "lsb_release -si", Output: "", Error: fmt.Errorf("lsb_release: command not found")},
+			},
+			setupFunc: func(tempDir string) error {
+				osReleaseContent := `NAME="Azure Linux"
+VERSION_ID="3.0"`
+				return os.WriteFile(filepath.Join(tempDir, "usr-lib-os-release"), []byte(osReleaseContent), 0644)
+			},
+			expected:    map[string]string{"name": "Azure Linux", "version": "3.0", "arch": "x86_64"},
+			expectError: false,
+		},
+		{
+			name: "dist_release_file_fallback",
+			mockCommands: []shell.MockCommand{
+				{Pattern: "uname -m", Output: "x86_64\n", Error: nil},
+				{Pattern: "lsb_release -si", Output: "", Error: fmt.Errorf("lsb_release: command not found")},
+			},
+			setupFunc: func(tempDir string) error {
+				if err := os.MkdirAll(filepath.Join(tempDir, "etc"), 0755); err != nil {
+					return err
+				}
+				return os.WriteFile(filepath.Join(tempDir, "etc", "redhat-release"),
+					[]byte("Red Hat Enterprise Linux release 9.2 (Plow)\n"), 0644)
+			},
+			expected:    map[string]string{"name": "Red Hat Enterprise Linux", "version": "9.2", "arch": "x86_64"},
+			expectError: false,
+		},
+		{
+			name: "lsb_release_file_fallback",
+			mockCommands: []shell.MockCommand{
+				{Pattern: "uname -m", Output: "x86_64\n", Error: nil},
+				{Pattern: "lsb_release -si", Output: "", Error: fmt.Errorf("lsb_release: command not found")},
+			},
+			setupFunc: func(tempDir string) error {
+				if err := os.MkdirAll(filepath.Join(tempDir, "etc"), 0755); err != nil {
+					return err
+				}
+				return os.WriteFile(filepath.Join(tempDir, "etc", "lsb-release"),
+					[]byte("DISTRIB_ID=Ubuntu\nDISTRIB_RELEASE=24.04\n"), 0644)
+			},
+			expected:    map[string]string{"name": "Ubuntu", "version": "24.04", "arch": "x86_64"},
+			expectError: false,
+		},
+		{
+			name: "no_os_release_and_no_lsb_release",
+			mockCommands: []shell.MockCommand{
+				{Pattern: "uname -m", Output: "x86_64\n", Error: nil},
+				{Pattern: "lsb_release -si", Output: "", Error: fmt.Errorf("lsb_release: command not found")},
+			},
+			setupFunc:   func(tempDir string) error { return nil },
+			expectError: true,
+			errorMsg:    "install the os-release file of the host distribution",
+			errorIs:     system.ErrHostOsUnknown,
 		},
 		{
 			name: "os_release_with_quotes",
@@ -204,6 +272,8 @@ ANOTHER_INVALID=`
 			} else {
 				system.OsReleaseFile = "/nonexistent/os-release"
 			}
+			system.UsrLibOsReleaseFile = filepath.Join(tempDir, "usr-lib-os-release")
+			system.DistReleaseFilesGlob = filepath.Join(tempDir, "etc", "*-release")
 
 			result, err := system.GetHostOsInfo()
 
@@ -212,6 +282,8 @@ ANOTHER_INVALID=`
 					t.Error("Expected error, but got none")
 				} else if tt.errorMsg != "" && !strings.Contains(err.Error(), tt.errorMsg) {
 					t.Errorf("Expected error containing '%s', but got: %v", tt.errorMsg, err)
+				} else if tt.errorIs != nil && !errors.Is(err, tt.errorIs) {
+					t.Errorf("Expected error wrapping '%v', but got: %v", tt.errorIs, err)
 				}
 			} else {
 				if err != nil {
@@ -437,6 +509,167 @@ func TestGetProviderId(t *testing.T) {
 	}
 }
 
+func TestCheckHostPkgTools(t *testing.T) {
+	originalExecutor := shell.Default
+	defer func() { shell.Default = originalExecutor }()
+
+	tests := []struct {
+		name           string
+		hostPkgManager string
+		dependencyInfo map[string]string
+		mockCommands   []shell.MockCommand
+		expectError    bool
+		errorContains  []string
+	}{
+		{
+			name:           "apt_host_rpm_target_rpm_missing",
+			hostPkgManager: "apt",
+			dependencyInfo: map[string]string{"rpm": "rpm"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "command -v rpm", Output: "", Error: fmt.Errorf("exit status 1")},
+				{Pattern: "apt-cache policy rpm", Output: "", Error: nil},
+			},
+			expectError: true,
+			errorContains: []string{
+				"apt-based host is missing required tools",
+				"rpm (package rpm not available from apt repositories)",
+			},
+		},
+		{
+			name:           "apt_host_rpm_target_rpm_installable",
+			hostPkgManager: "apt",
+			dependencyInfo: map[string]string{"rpm": "rpm"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "command -v rpm", Output: "", Error: fmt.Errorf("exit status 1")},
+				{Pattern: "apt-cache policy rpm", Output: "rpm:\n  Installed: (none)\n  Candidate: 4.18.2+dfsg-2\n", Error: nil},
+			},
+			expectError: false,
+		},
+		{
+			name:           "apt_host_rpm_target_no_candidate",
+			hostPkgManager: "apt",
+			dependencyInfo: map[string]string{"rpm": "rpm"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "command -v rpm", Output: "", Error: fmt.Errorf("exit status 1")},
+				{Pattern: "apt-cache policy rpm", Output: "rpm:\n  Installed: (none)\n  Candidate: (none)\n", Error: nil},
+			},
+			expectError:   true,
+			errorContains: []string{"missing required tools: rpm"},
+		},
+		{
+			name:           "apt_host_rpm_target_rpm_present",
+			hostPkgManager: "apt",
+			dependencyInfo: map[string]string{"rpm": "rpm"},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "command -v rpm", Output: "/usr/bin/rpm\n", Error: nil},
+			},
+			expectError: false,
+		},
+		{
+			name:           "tdnf_host_deb_target_all_missing",
+			hostPkgManager: "tdnf",
+			dependencyInfo: map[string]string{
+				"mmdebstrap":        "mmdebstrap",
+				"dpkg-scanpackages": "dpkg-dev",
+				"ukify":             "systemd-ukify",
+			},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "command -v ukify", Output: "/usr/bin/ukify\n", Error: nil},
+				{Pattern: "command -v", Output: "", Error: fmt.Errorf("exit status 1")},
+				{Pattern: "tdnf info", Output: "", Error: fmt.Errorf("no matching packages")},
+			},
+			expectError: true,
+			errorContains: []string{
+				"tdnf-based host is missing required tools",
+				"dpkg-scanpackages (package dpkg-dev not available from tdnf repositories), mmdebstrap (package mmdebstrap not available from tdnf repositories)",
+			},
+		},
+		{
+			name:           "yum_host_mixed_availability",
+			hostPkgManager: "yum",
+			dependencyInfo: map[string]string{
+				"mmdebstrap": "mmdebstrap",
+				"qemu-img":   "qemu-img",
+			},
+			mockCommands: []shell.MockCommand{
+				{Pattern: "command -v", Output: "", Error: fmt.Errorf("exit status 1")},
+				{Pattern: "yum info qemu-img", Output: "Name : qemu-img\n", Error: nil},
+				{Pattern: "yum info mmdebstrap", Output: "", Error: fmt.Errorf("no matching packages")},
+			},
+			expectError:   true,
+			errorContains: []string{"missing required tools: mmdebstrap (package mmdebstrap not available from yum repositories);"},
+		},
+		{
+			name:           "empty_dependency_info",
+			hostPkgManager: "apt",
+			dependencyInfo: map[string]string{},
+			expectError:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shell.Default = shell.NewMockExecutor(tt.mockCommands)
+
+			err := system.CheckHostPkgTools(tt.hostPkgManager, tt.dependencyInfo)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected error but got none")
+				}
+				for _, msg := range tt.errorContains {
+					if !strings.Contains(err.Error(), msg) {
+						t.Errorf("Expected error to contain '%s', but got '%s'", msg, err.Error())
+					}
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    uint64
+		expected string
+	}{
+		{bytes: 0, expected: "0 B"},
+		{bytes: 1023, expected: "1023 B"},
+		{bytes: 1536, expected: "1.50 KiB"},
+		{bytes: 5 * 1024 * 1024 * 1024, expected: "5.00 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := system.FormatBytes(tt.bytes); got != tt.expected {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.bytes, got, tt.expected)
+		}
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected int64
+		ok       bool
+	}{
+		{name: "unset", value: "", expected: 0, ok: false},
+		{name: "valid", value: "1700000000", expected: 1700000000, ok: true},
+		{name: "invalid", value: "yesterday", expected: 0, ok: false},
+		{name: "negative", value: "-5", expected: 0, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SOURCE_DATE_EPOCH", tt.value)
+			got, ok := system.SourceDateEpoch()
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("Expected %d, %v, got %d, %v", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
 func TestStopGPGComponents(t *testing.T) {
 	originalExecutor := shell.Default
 	defer func() { shell.Default = originalExecutor }()
@@ -675,6 +908,63 @@ VERSION_ID="1.0=stable"`,
 			},
 			expectError: false,
 		},
+		{
+			name:             "escaped_characters_in_double_quotes",
+			osReleaseContent: "NAME=\"Costs \\$5 \\\\ \\` \\\"quoted\\\" \\n\"\nVERSION_ID=\"1.0\"",
+			mockCommands: []shell.MockCommand{
+				{Pattern: "uname -m", Output: "x86_64\n", Error: nil},
+			},
+			expected: map[string]string{
+				"name":    "Costs $5 \\ ` \"quoted\" \\n",
+				"version": "1.0",
+				"arch":    "x86_64",
+			},
+			expectError: false,
+		},
+		{
+			name: "single_quoted_values",
+			osReleaseContent: `NAME='Fedora "Linux" \$HOME'
+VERSION_ID='40'`,
+			mockCommands: []shell.MockCommand{
+				{Pattern: "uname -m", Output: "x86_64\n", Error: nil},
+			},
+			expected: map[string]string{
+				"name":    "Fedora \"Linux\" \\$HOME",
+				"version": "40",
+				"arch":    "x86_64",
+			},
+			expectError: false,
+		},
+		{
+			name: "trailing_comments",
+			osReleaseContent: `# NAME="Commented Out"
+NAME="Debian GNU/Linux" # distribution name
+VERSION_ID=13 # trixie
+PRETTY_NAME="Debian#13"`,
+			mockCommands: []shell.MockCommand{
+				{Pattern: "uname -m", Output: "x86_64\n", Error: nil},
+			},
+			expected: map[string]string{
+				"name":    "Debian GNU/Linux",
+				"version": "13",
+				"arch":    "x86_64",
+			},
+			expectError: false,
+		},
+		{
+			name: "hash_inside_quotes_and_words",
+			osReleaseContent: `NAME="Distro # One"
+VERSION_ID=1.0#beta`,
+			mockCommands: []shell.MockCommand{
+				{Pattern: "uname -m", Output: "x86_64\n", Error: nil},
+			},
+			expected: map[string]string{
+				"name":    "Distro # One",
+				"version": "1.0#beta",
+				"arch":    "x86_64",
+			},
+			expectError: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -688,10 +978,9 @@ VERSION_ID="1.0=stable"`,
 				t.Fatalf("Failed to write os-release file: %v", err)
 			}
 
-			// Note: Since we can't easily mock the /etc/os-release file access in the system package,
-			// this test primarily validates our understanding of the parsing logic.
-			// In a real scenario, we might need to refactor the system package to accept
-			// a configurable os-release file path for testing.
+			originalOsReleaseFile := system.OsReleaseFile
+			system.OsReleaseFile = osReleasePath
+			defer func() { system.OsReleaseFile = originalOsReleaseFile }()
 
 			result, err := system.GetHostOsInfo()
 
@@ -699,28 +988,14 @@ VERSION_ID="1.0=stable"`,
 				if err == nil {
 					t.Error("Expected error, but got none")
 				}
-			} else {
-				// Since we can't mock the file system access directly,
-				// we'll just verify that the function doesn't crash
-				// and returns valid structure
-				if err != nil && !strings.Contains(err.Error(), "failed to detect host OS info") {
-					// Allow the "failed to detect" error since we can't mock /etc/os-release
-					if !strings.Contains(err.Error(), "failed to get host") {
-						t.Errorf("Unexpected error: %v", err)
-					}
-				}
-				if result == nil {
-					t.Error("Expected non-nil result map")
-				}
-				// Verify map has expected keys
-				if _, ok := result["name"]; !ok {
-					t.Error("Expected 'name' key in result")
-				}
-				if _, ok := result["version"]; !ok {
-					t.Error("Expected 'version' key in result")
-				}
-				if _, ok := result["arch"]; !ok {
-					t.Error("Expected 'arch' key in result")
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for key, want := range tt.expected {
+				if result[key] != want {
+					t.Errorf("Expected %s %q, got %q", key, want, result[key])
 				}
 			}
 		})